@@ -9,18 +9,36 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/api"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/artifacts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/config"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/readonly"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/startup"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/version"
 	"go.uber.org/zap"
 )
 
 var (
 	configPath = flag.String("config", "/app/config.yaml", "Path to configuration file")
 	logLevel   = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-	port       = flag.Int("port", 8080, "Server port")
+	port       = flag.Int("port", 8080, "Server port (overrides api.port)")
 	healthCmd  = flag.Bool("health", false, "Run health check and exit")
+
+	kubeContext = flag.String("kube-context", "", "Kubeconfig context to use (overrides kubernetes.context)")
+	asUser      = flag.String("as", "", "User to impersonate for Kubernetes requests (overrides kubernetes.impersonate.user)")
+	asGroups    = flag.String("as-group", "", "Comma-separated groups to impersonate (overrides kubernetes.impersonate.groups)")
+	asUID       = flag.String("as-uid", "", "UID to impersonate (overrides kubernetes.impersonate.uid)")
 )
 
 func main() {
@@ -40,52 +58,298 @@ func main() {
 	defer func() { _ = logger.Sync() }()
 
 	logger.Info("Starting TrueNAS API Server",
-		zap.String("version", "0.1.0"),
-		zap.String("config", *configPath),
-		zap.Int("port", *port))
+		zap.String("version", version.Version),
+		zap.String("git_commit", version.GitCommit),
+		zap.String("build_date", version.BuildDate),
+		zap.String("config", *configPath))
 
 	// Load configuration
 	cfg, err := config.Load(*configPath)
 	if err != nil {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
+	cfg.Kubernetes.ApplyOverrides(*kubeContext, *asUser, *asGroups, *asUID)
+	if err := applyPortFlag(cfg); err != nil {
+		logger.Fatal("Invalid configuration", zap.Error(err))
+	}
+	logger.Info("Configuration loaded", zap.Any("features", cfg.Features()))
+	for _, warning := range cfg.Warnings {
+		logger.Warn("Configuration: " + warning)
+	}
+	componentLogger := logging.FromZap(logger)
 
 	// Initialize Kubernetes client
 	k8sClient, err := k8s.NewClient(k8s.Config{
-		Kubeconfig: cfg.Kubernetes.Kubeconfig,
-		Namespace:  cfg.Kubernetes.Namespace,
-		InCluster:  cfg.Kubernetes.InCluster,
+		Kubeconfig:        cfg.Kubernetes.Kubeconfig,
+		Context:           cfg.Kubernetes.Context,
+		Namespace:         cfg.Kubernetes.Namespace,
+		InCluster:         cfg.Kubernetes.InCluster,
+		CSIPodSelector:    cfg.Kubernetes.CSIPodSelector,
+		PageSize:          cfg.Kubernetes.ListPageSize,
+		ImpersonateUser:   cfg.Kubernetes.Impersonate.User,
+		ImpersonateGroups: cfg.Kubernetes.Impersonate.Groups,
+		ImpersonateUID:    cfg.Kubernetes.Impersonate.UID,
+		Logger:         componentLogger,
 	})
 	if err != nil {
 		logger.Fatal("Failed to initialize Kubernetes client", zap.Error(err))
 	}
 
+	// API metrics are served on the API port rather than metrics.port
+	var metricsExporter *metrics.Exporter
+	if cfg.Metrics.Enabled {
+		metricsExporter = metrics.NewExporter(metrics.Config{Enabled: true, Path: cfg.Metrics.Path, Logger: logger})
+	}
+
 	// Initialize TrueNAS client
 	timeout, err := time.ParseDuration(cfg.TrueNAS.Timeout)
 	if err != nil {
 		logger.Fatal("Failed to parse TrueNAS timeout", zap.Error(err))
 	}
 	
+	var onParseAnomaly, onReauth func(string)
+	if metricsExporter != nil {
+		onParseAnomaly = metricsExporter.IncParseAnomaly
+		onReauth = metricsExporter.IncTrueNASReauth
+	}
 	truenasClient, err := truenas.NewClient(truenas.Config{
-		URL:      cfg.TrueNAS.URL,
-		Username: cfg.TrueNAS.Username,
-		Password: cfg.TrueNAS.Password,
-		Timeout:  timeout,
-		Insecure: cfg.TrueNAS.Insecure,
-		CAFile:   cfg.TrueNAS.CAFile,
+		URL:             cfg.TrueNAS.URL,
+		Username:        cfg.TrueNAS.Username,
+		Password:        cfg.TrueNAS.Password,
+		Timeout:         timeout,
+		Insecure:        cfg.TrueNAS.Insecure,
+		CAFile:          cfg.TrueNAS.CAFile,
+		ProxyURL:        cfg.TrueNAS.ProxyURL,
+		ResolveOverride: cfg.TrueNAS.ResolveOverride,
+		JobTimeout:      cfg.TrueNAS.JobTimeout,
+		Logger:          componentLogger,
+		StrictParsing:   cfg.TrueNAS.StrictParsing,
+		OnParseAnomaly:  onParseAnomaly,
+		OnReauth:        onReauth,
 	})
 	if err != nil {
 		logger.Fatal("Failed to initialize TrueNAS client", zap.Error(err))
 	}
+	if err := startup.CheckScope(truenasClient, cfg.TrueNAS.Scope(), logger); err != nil {
+		logger.Fatal("Configured TrueNAS pool or parent dataset is missing (truenas.missing_pool: fail)", zap.Error(err))
+	}
+	if cfg.ReadOnly {
+		logger.Warn("Read-only mode: Kubernetes and TrueNAS writes are refused; snapshot cleanup and quota remediation are disabled")
+		k8sClient = readonly.NewK8sClient(k8sClient)
+		truenasClient = readonly.NewTrueNASClient(truenasClient)
+	}
+	if cfg.Monitor.IncrementalSnapshots.Enabled {
+		truenasClient = truenas.NewIncrementalSnapshotClient(truenasClient, truenas.IncrementalOptions{
+			FullRelistEvery: cfg.Monitor.IncrementalSnapshots.FullRelistEvery,
+		})
+	}
+
+	// Active alerts are shared with the monitor through the state file
+	var alertStore *alerts.Store
+	if cfg.Alerts.StateFile != "" {
+		alertStore, err = alerts.NewStore(alerts.StoreConfig{
+			Path:             cfg.Alerts.StateFile,
+			RenotifyInterval: cfg.Alerts.RenotifyInterval,
+		})
+		if err != nil {
+			logger.Fatal("Failed to load alert state", zap.Error(err))
+		}
+	}
+
+	// Initialize tracing; a nil tracer records nothing
+	tracer, err := tracing.NewTracer(tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "truenas-api-server",
+		Logger:      logger,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+
+	// Test every alert destination at startup; POST
+	// /api/v1/admin/alerts/test repeats the test
+	alertDispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router:  alerts.NewRouter(cfg.Alerts.RouterConfig()),
+		Senders: alerts.DefaultSenders(cfg.Alerts.Slack.Webhook),
+		Logger:  logging.FromZap(logger),
+		Digest: alerts.DigestConfig{
+			Window: cfg.Alerts.Digest.Window,
+			TopN:   cfg.Alerts.Digest.TopN,
+			APIURL: cfg.Alerts.Digest.APIURL,
+		},
+	})
+	if err != nil {
+		logger.Fatal("Failed to create alert dispatcher", zap.Error(err))
+	}
+	alertChecks, err := startup.VerifyAlertDestinations(alertDispatcher, "truenas-api-server", cfg.Alerts.Required, metricsExporter, logger)
+	if err != nil {
+		logger.Fatal("Alert destination failed the startup test notification (alerts.required: true)", zap.Error(err))
+	}
+
+	// Snapshot cleanup jobs alert through the configured routes when they
+	// pause on failures
+	var cleanupEngine *cleanup.Engine
+	if cfg.Cleanup.Enabled && !cfg.ReadOnly {
+		var onJobsPruned func(int)
+		if metricsExporter != nil {
+			onJobsPruned = metricsExporter.AddCleanupJobsPruned
+		}
+		cleanupEngine = cleanup.NewEngine(truenasClient, cleanup.Config{
+			Options: cleanup.Options{
+				BatchSize:        cfg.Cleanup.BatchSize,
+				BatchDelay:       cfg.Cleanup.BatchDelay,
+				MaxOpsPerMinute:  cfg.Cleanup.MaxOpsPerMinute,
+				FailureThreshold: cfg.Cleanup.FailureThreshold,
+				DeferDestroy:     cfg.Cleanup.DeferDestroy,
+				HandsOffWindow:   cfg.Cleanup.HandsOffWindow,
+				JobRetention:     cfg.Cleanup.JobRetention,
+				MaxFinishedJobs:  cfg.Cleanup.MaxFinishedJobs,
+			},
+			AlertDispatcher: alertDispatcher,
+			K8sClient:       k8sClient,
+			OnJobsPruned:    onJobsPruned,
+			Logger:          logging.FromZap(logger).Component("cleanup"),
+		})
+	}
+
+	// Parse the report templates now so a broken template fails startup
+	reports, err := report.New(report.Options{
+		TemplateDir: cfg.Reports.TemplateDir,
+		Sections:    cfg.Reports.Sections,
+		Branding: report.Branding{
+			Title:        cfg.Reports.Title,
+			Organization: cfg.Reports.Organization,
+			LogoURL:      cfg.Reports.LogoURL,
+		},
+		PoolUtilizationPercent: cfg.Reports.PoolUtilizationPercent,
+	})
+	if err != nil {
+		logger.Fatal("Failed to load report templates", zap.Error(err))
+	}
+
+	// Report schedules run in the monitor and are shared through the state file
+	var reportSchedules *scheduler.Store
+	if cfg.Reports.ScheduleStateFile != "" {
+		reportSchedules, err = scheduler.NewStore(cfg.Reports.ScheduleStateFile)
+		if err != nil {
+			logger.Fatal("Failed to load report schedule state", zap.Error(err))
+		}
+	}
+
+	// Reports generated through the API are kept for download and pruned
+	// by age and total size
+	var artifactStore *artifacts.Store
+	if cfg.Reports.Artifacts.Dir != "" {
+		var onPruned func(int)
+		var onBytes func(int64)
+		if metricsExporter != nil {
+			onPruned = metricsExporter.AddArtifactsPruned
+			onBytes = metricsExporter.SetArtifactsBytes
+		}
+		artifactStore, err = artifacts.New(artifacts.Config{
+			Options: artifacts.Options{
+				Dir:       cfg.Reports.Artifacts.Dir,
+				Retention: cfg.Reports.Artifacts.Retention,
+				MaxBytes:  cfg.Reports.Artifacts.MaxBytes,
+			},
+			OnPruned: onPruned,
+			OnBytes:  onBytes,
+			Logger:   logging.FromZap(logger).Component("artifacts"),
+		})
+		if err != nil {
+			logger.Fatal("Failed to open report artifact store", zap.Error(err))
+		}
+	}
+
+	// The state store is checked by GET /ready
+	var stateStore store.Store
+	if cfg.Store.Enabled() {
+		stateStore, err = startup.OpenStore(cfg.Store)
+		if err != nil {
+			logger.Fatal("Failed to open state store", zap.Error(err))
+		}
+	}
+
+	// Reports record the settings they ran under
+	scanConfig := cfg.Effective()
 
 	// Initialize API server
 	apiServer, err := api.NewServer(api.Config{
-		Port:              *port,
+		Address:           cfg.API.Address,
+		Port:              cfg.API.Port,
 		K8sClient:         k8sClient,
 		TruenasClient:     truenasClient,
 		Logger:            logger,
+		AccessLog: api.AccessLogConfig{
+			SkipPaths:         cfg.Logging.AccessLog.SkipPaths,
+			SuccessSampleRate: cfg.Logging.AccessLog.SuccessSampleRate,
+		},
 		OrphanThreshold:   cfg.Monitor.OrphanThreshold,
 		SnapshotRetention: cfg.Monitor.SnapshotRetention,
+		OrphanThresholds:  cfg.Monitor.OrphanThresholds.AgeThresholds(),
+		SnapshotSchedules: cfg.Monitor.SchedulePolicies(),
+		BackupCoverage:    cfg.Monitor.BackupCoverage.Options(),
+		Exclusions:        cfg.Monitor.Exclusions.Exclusions(),
+		StrictSnapshots:   cfg.Monitor.StrictSnapshots,
+		OrphanGroupWindow: cfg.Monitor.OrphanGroupWindow,
+		ScanConfig:        &scanConfig,
+		IOStats:           cfg.Monitor.IOStats.Options(),
+		ISCSISessions: analysis.ISCSISessionOptions{
+			Enabled:        cfg.Monitor.ISCSISessions.Enabled,
+			NodeInitiators: cfg.Monitor.ISCSISessions.NodeInitiators,
+		},
+		Quotas: analysis.QuotaOptions{
+			Enabled:      cfg.Monitor.Quotas.Enabled,
+			SlackPercent: cfg.Monitor.Quotas.SlackPercent,
+		},
+		QuotaRemediation:   cfg.Monitor.Quotas.Remediation,
+		AbandonedDatasets: analysis.AbandonedDatasetOptions{
+			MinAge:        cfg.Monitor.AbandonedDatasets.MinAge,
+			SnapshotShare: cfg.Monitor.AbandonedDatasets.SnapshotShare,
+		},
+		ReadOnly:           cfg.ReadOnly,
+		Scope:              cfg.TrueNAS.Scope(),
+		SnapshotAgeBuckets: cfg.Monitor.SnapshotAges.Buckets,
+		SnapshotHeavy: analysis.SnapshotHeavyOptions{
+			Ratio: cfg.Monitor.SnapshotHeavy.Ratio,
+			TopN:  cfg.Monitor.SnapshotHeavy.TopN,
+		},
+		AlertRouter:            alerts.NewRouter(cfg.Alerts.RouterConfig()),
+		AlertStore:             alertStore,
+		AlertDispatcher:        alertDispatcher,
+		AlertsRequired:         cfg.Alerts.Required,
+		AlertDestinationChecks: alertChecks,
+		Features:               cfg.Features(),
+		AdminToken:             cfg.Security.AdminToken,
+		ScanStateFile:          cfg.Monitor.ScanStateFile,
+		Limits: api.RequestLimits{
+			ReadTimeout:    cfg.API.ReadTimeout,
+			ReportTimeout:  cfg.API.ReportTimeout,
+			MaxBodyBytes:   cfg.API.MaxBodyBytes,
+			BackendTimeout: cfg.API.BackendTimeout,
+			MaxScanAge:     cfg.API.MaxScanAge,
+			MaxListItems:   cfg.API.MaxListItems,
+		},
+		V1Deprecation: api.V1Deprecation{
+			DeprecatedAt: cfg.API.V1Deprecation.DeprecatedAt,
+			SunsetAt:     cfg.API.V1Deprecation.SunsetAt,
+			Link:         cfg.API.V1Deprecation.Link,
+		},
+		MetricsExporter: metricsExporter,
+		MetricsPath:     cfg.Metrics.Path,
+		Tracer:          tracer,
+		CleanupEngine:   cleanupEngine,
+		Confirmation: api.ConfirmationConfig{
+			TTL:  cfg.Security.ConfirmationTTL,
+			Skip: cfg.Security.SkipConfirmation,
+		},
+		Reports:         reports,
+		ReportSchedules: reportSchedules,
+		Artifacts:       artifactStore,
+		Store:           stateStore,
+		UI:              cfg.API.UI.Enabled,
 	})
 	if err != nil {
 		logger.Fatal("Failed to initialize API server", zap.Error(err))
@@ -99,12 +363,15 @@ func main() {
 	if err := apiServer.Start(ctx); err != nil {
 		logger.Fatal("Failed to start API server", zap.Error(err))
 	}
+	go alertDispatcher.RunDigests(ctx)
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	logger.Info("API server started successfully", zap.Int("port", *port))
+	logger.Info("API server started successfully",
+		zap.String("address", cfg.API.Address),
+		zap.Int("port", cfg.API.Port))
 	<-sigChan
 
 	logger.Info("Shutting down API server...")
@@ -118,6 +385,23 @@ func main() {
 		logger.Error("Error during shutdown", zap.Error(err))
 		os.Exit(1)
 	}
+	if cleanupEngine != nil {
+		cleanupEngine.Close()
+	}
+	if artifactStore != nil {
+		artifactStore.Close()
+	}
+	if err := alertDispatcher.FlushDigests(shutdownCtx, true); err != nil {
+		logger.Warn("Failed to send pending alert digests", zap.Error(err))
+	}
+	if stateStore != nil {
+		if err := stateStore.Close(); err != nil {
+			logger.Warn("Failed to close state store", zap.Error(err))
+		}
+	}
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Failed to export remaining spans", zap.Error(err))
+	}
 
 	logger.Info("API server stopped successfully")
 }
@@ -155,4 +439,22 @@ func healthCheck() int {
 
 	logger.Info("Health check passed")
 	return 0
-}
\ No newline at end of file
+}
+
+// applyPortFlag sets api.port from the -port flag when the flag was given or
+// api.port is unset, and checks it against metrics.port again.
+func applyPortFlag(cfg *config.Config) error {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == "port" })
+	if !set {
+		if cfg.API.Port == 0 {
+			cfg.API.Port = *port
+		}
+		return nil
+	}
+	cfg.API.Port = *port
+	if err := cfg.CheckListeners(); err != nil {
+		return fmt.Errorf("-port: %w", err)
+	}
+	return nil
+}
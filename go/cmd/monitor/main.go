@@ -9,12 +9,24 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/canary"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/config"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/readonly"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/startup"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/version"
 	"go.uber.org/zap"
 )
 
@@ -22,6 +34,11 @@ var (
 	configPath = flag.String("config", "/app/config.yaml", "Path to configuration file")
 	logLevel   = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	healthCmd  = flag.Bool("health", false, "Run health check and exit")
+
+	kubeContext = flag.String("kube-context", "", "Kubeconfig context to use (overrides kubernetes.context)")
+	asUser      = flag.String("as", "", "User to impersonate for Kubernetes requests (overrides kubernetes.impersonate.user)")
+	asGroups    = flag.String("as-group", "", "Comma-separated groups to impersonate (overrides kubernetes.impersonate.groups)")
+	asUID       = flag.String("as-uid", "", "UID to impersonate (overrides kubernetes.impersonate.uid)")
 )
 
 func main() {
@@ -41,7 +58,9 @@ func main() {
 	defer func() { _ = logger.Sync() }()
 
 	logger.Info("Starting TrueNAS Monitor Service",
-		zap.String("version", "0.1.0"),
+		zap.String("version", version.Version),
+		zap.String("git_commit", version.GitCommit),
+		zap.String("build_date", version.BuildDate),
 		zap.String("config", *configPath),
 	)
 
@@ -50,17 +69,38 @@ func main() {
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to load configuration")
 	}
+	cfg.Kubernetes.ApplyOverrides(*kubeContext, *asUser, *asGroups, *asUID)
+	logger.Info("Configuration loaded", zap.Any("features", cfg.Features()))
+	for _, warning := range cfg.Warnings {
+		logger.Warn("Configuration: " + warning)
+	}
 
 	// Initialize Kubernetes client
 	k8sClient, err := k8s.NewClient(k8s.Config{
-		Kubeconfig: cfg.Kubernetes.Kubeconfig,
-		Namespace:  cfg.Kubernetes.Namespace,
-		InCluster:  cfg.Kubernetes.InCluster,
+		Kubeconfig:        cfg.Kubernetes.Kubeconfig,
+		Context:           cfg.Kubernetes.Context,
+		Namespace:         cfg.Kubernetes.Namespace,
+		InCluster:         cfg.Kubernetes.InCluster,
+		CSIPodSelector:    cfg.Kubernetes.CSIPodSelector,
+		PageSize:          cfg.Kubernetes.ListPageSize,
+		ImpersonateUser:   cfg.Kubernetes.Impersonate.User,
+		ImpersonateGroups: cfg.Kubernetes.Impersonate.Groups,
+		ImpersonateUID:    cfg.Kubernetes.Impersonate.UID,
+		Logger:         logger,
 	})
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to initialize Kubernetes client")
 	}
 
+	// Initialize metrics exporter
+	metricsExporter := metrics.NewExporter(metrics.Config{
+		Enabled: cfg.Metrics.Enabled,
+		Address: cfg.Metrics.Address,
+		Port:    cfg.Metrics.Port,
+		Path:    cfg.Metrics.Path,
+		Logger:  logger.Logger,
+	})
+
 	// Initialize TrueNAS client
 	timeout, err := time.ParseDuration(cfg.TrueNAS.Timeout)
 	if err != nil {
@@ -68,26 +108,101 @@ func main() {
 	}
 	
 	truenasClient, err := truenas.NewClient(truenas.Config{
-		URL:      cfg.TrueNAS.URL,
-		Username: cfg.TrueNAS.Username,
-		Password: cfg.TrueNAS.Password,
-		Timeout:  timeout,
-		Insecure: cfg.TrueNAS.Insecure,
-		CAFile:   cfg.TrueNAS.CAFile,
+		URL:             cfg.TrueNAS.URL,
+		Username:        cfg.TrueNAS.Username,
+		Password:        cfg.TrueNAS.Password,
+		Timeout:         timeout,
+		Insecure:        cfg.TrueNAS.Insecure,
+		CAFile:          cfg.TrueNAS.CAFile,
+		ProxyURL:        cfg.TrueNAS.ProxyURL,
+		ResolveOverride: cfg.TrueNAS.ResolveOverride,
+		JobTimeout:      cfg.TrueNAS.JobTimeout,
+		Logger:          logger,
+		StrictParsing:   cfg.TrueNAS.StrictParsing,
+		OnParseAnomaly:  metricsExporter.IncParseAnomaly,
+		OnReauth:        metricsExporter.IncTrueNASReauth,
 	})
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to initialize TrueNAS client")
 	}
+	if err := startup.CheckScope(truenasClient, cfg.TrueNAS.Scope(), logger.Logger); err != nil {
+		logger.WithError(err).Fatal("Configured TrueNAS pool or parent dataset is missing (truenas.missing_pool: fail)")
+	}
+	if cfg.ReadOnly {
+		logger.Warn("Read-only mode: Kubernetes and TrueNAS writes are refused; orphan Events are disabled")
+		k8sClient = readonly.NewK8sClient(k8sClient)
+		truenasClient = readonly.NewTrueNASClient(truenasClient)
+	}
 
-	// Initialize metrics exporter
-	metricsExporter := metrics.NewExporter(metrics.Config{
-		Enabled: cfg.Metrics.Enabled,
-		Port:    cfg.Metrics.Port,
-		Path:    cfg.Metrics.Path,
+	// Initialize tracing; a nil tracer records nothing
+	tracer, err := tracing.NewTracer(tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "truenas-monitor",
+		Logger:      logger.Logger,
 	})
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize tracing")
+	}
+
+	// Initialize alert dispatcher
+	alertDispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router:  alerts.NewRouter(cfg.Alerts.RouterConfig()),
+		Senders: alerts.DefaultSenders(cfg.Alerts.Slack.Webhook),
+		Logger:  logger,
+		Digest: alerts.DigestConfig{
+			Window: cfg.Alerts.Digest.Window,
+			TopN:   cfg.Alerts.Digest.TopN,
+			APIURL: cfg.Alerts.Digest.APIURL,
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create alert dispatcher")
+	}
+	if _, err := startup.VerifyAlertDestinations(alertDispatcher, "truenas-monitor", cfg.Alerts.Required, metricsExporter, logger.Logger); err != nil {
+		logger.WithError(err).Fatal("Alert destination failed the startup test notification (alerts.required: true)")
+	}
+
+	alertStore, err := alerts.NewStore(alerts.StoreConfig{
+		Path:             cfg.Alerts.StateFile,
+		RenotifyInterval: cfg.Alerts.RenotifyInterval,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load alert state")
+	}
+
+	// Scheduled reports use the API server's report pipeline, with the
+	// flapping PVs of the latest scan
+	var monitorService *monitor.Service
+	flapping := func() []analysis.FlappingVolume {
+		if monitorService == nil {
+			return nil
+		}
+		return monitorService.FlappingVolumes()
+	}
+	var reportScheduler *scheduler.Scheduler
+	if len(cfg.Reports.Schedules) > 0 {
+		reportScheduler, err = newReportScheduler(cfg, k8sClient, truenasClient, flapping, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create report scheduler")
+		}
+	}
+
+	// The state store is checked by the readiness probe
+	var stateStore store.Store
+	if cfg.Store.Enabled() {
+		stateStore, err = startup.OpenStore(cfg.Store)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to open state store")
+		}
+	}
+
+	// Scans and reports record the settings they ran under
+	scanConfig := cfg.Effective()
 
 	// Initialize monitor service
-	monitorService, err := monitor.NewService(monitor.Config{
+	monitorService, err = monitor.NewService(monitor.Config{
 		K8sClient:         k8sClient,
 		TruenasClient:     truenasClient,
 		MetricsExporter:   metricsExporter,
@@ -95,10 +210,88 @@ func main() {
 		ScanInterval:      cfg.Monitor.ScanInterval,
 		OrphanThreshold:   cfg.Monitor.OrphanThreshold,
 		SnapshotRetention: cfg.Monitor.SnapshotRetention,
+		OrphanThresholds:  cfg.Monitor.OrphanThresholds.AgeThresholds(),
+		StartupJitter:     cfg.Monitor.StartupJitter,
+		PhaseTimeouts: orphan.PhaseTimeouts{
+			K8sList:     cfg.Monitor.PhaseTimeouts.K8sList,
+			TrueNASList: cfg.Monitor.PhaseTimeouts.TrueNASList,
+			Correlation: cfg.Monitor.PhaseTimeouts.Correlation,
+		},
+		Exclusions:              cfg.Monitor.Exclusions.Exclusions(),
+		StrictSnapshots:         cfg.Monitor.StrictSnapshots,
+		OrphanGroupWindow:       cfg.Monitor.OrphanGroupWindow,
+		ScanConfig:              &scanConfig,
+		RequestBudget: map[string]int64{
+			apiusage.BackendKubernetes: cfg.Monitor.RequestBudget.Kubernetes,
+			apiusage.BackendTrueNAS:    cfg.Monitor.RequestBudget.TrueNAS,
+		},
+		SnapshotSchedules:       cfg.Monitor.SchedulePolicies(),
+		BackupCoverage:          cfg.Monitor.BackupCoverage.Options(),
+		IncrementalSnapshots:    cfg.Monitor.IncrementalSnapshots.Enabled,
+		SnapshotFullRelistEvery: cfg.Monitor.IncrementalSnapshots.FullRelistEvery,
+		NamespacePriority: orphan.NamespacePriority{
+			Enabled:        cfg.Monitor.NamespacePriority.Enabled,
+			TopK:           cfg.Monitor.NamespacePriority.TopK,
+			CoveragePeriod: cfg.Monitor.NamespacePriority.CoveragePeriod,
+		},
+		NFSDeepCheck:            cfg.Monitor.NFSDeepCheck.Enabled,
+		NFSDeepCheckSampleRate:  cfg.Monitor.NFSDeepCheck.SampleRate,
+		IOStats:                 cfg.Monitor.IOStats.Options(),
+		IOStatsTopN:             cfg.Monitor.IOStats.TopN,
+		SnapshotAges:            cfg.Monitor.SnapshotAges.Enabled,
+		SnapshotAgeBuckets:      cfg.Monitor.SnapshotAges.Buckets,
+		ProvisioningLatency:     cfg.Monitor.ProvisioningLatency.Enabled,
+		ProvisioningWindow:      cfg.Monitor.ProvisioningLatency.Window,
+		AlertDispatcher:         alertDispatcher,
+		AlertStore:              alertStore,
+		TrueNASAlerts:           cfg.Alerts.TrueNAS.Enabled,
+		ForwardTrueNASAlerts:    cfg.Alerts.TrueNAS.Forward,
+		MaintenanceGrace:        cfg.TrueNAS.MaintenanceGrace,
+		ScanStateFile:           cfg.Monitor.ScanStateFile,
+		Tracer:                  tracer,
+		ReportScheduler:         reportScheduler,
+		Store:                   stateStore,
+		ISCSISessions: analysis.ISCSISessionOptions{
+			Enabled:        cfg.Monitor.ISCSISessions.Enabled,
+			NodeInitiators: cfg.Monitor.ISCSISessions.NodeInitiators,
+		},
+		OrphanEvents: monitor.OrphanEventOptions{
+			Enabled:      cfg.Monitor.OrphanEvents.Enabled && !cfg.ReadOnly,
+			OpsPerSecond: cfg.Monitor.OrphanEvents.OpsPerSecond,
+			Burst:        cfg.Monitor.OrphanEvents.Burst,
+			Workers:      cfg.Monitor.OrphanEvents.Workers,
+		},
+		InventoryDrift: monitor.InventoryDriftThresholds{
+			MaxUnmatched: cfg.Monitor.InventoryDrift.MaxUnmatched,
+			MaxPercent:   cfg.Monitor.InventoryDrift.MaxPercent,
+		},
+		PhaseFlapping: analysis.PhaseFlappingOptions{
+			Window:         cfg.Monitor.PhaseFlapping.Window,
+			MaxTransitions: cfg.Monitor.PhaseFlapping.MaxTransitions,
+		},
+		AbandonedDatasets: monitor.AbandonedDatasetOptions{
+			Enabled: cfg.Monitor.AbandonedDatasets.Enabled,
+			TopN:    cfg.Monitor.AbandonedDatasets.TopN,
+			Options: analysis.AbandonedDatasetOptions{
+				MinAge:        cfg.Monitor.AbandonedDatasets.MinAge,
+				SnapshotShare: cfg.Monitor.AbandonedDatasets.SnapshotShare,
+			},
+		},
+		Scope: cfg.TrueNAS.Scope(),
+		RestoreCanary: monitor.RestoreCanaryOptions{
+			Enabled:  cfg.Monitor.RestoreCanary.Enabled && !cfg.ReadOnly,
+			Interval: cfg.Monitor.RestoreCanary.Interval,
+			Options: canary.Options{
+				Dataset:         cfg.Monitor.RestoreCanary.Dataset,
+				AllowedDatasets: cfg.Monitor.RestoreCanary.AllowedDatasets,
+			},
+		},
 	})
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to create monitor service")
 	}
+	metricsExporter.Handle("/ready", monitorService.ReadyHandler())
+	metricsExporter.Handle("POST /admin/scan-loop/restart", monitorService.RestartScanLoopHandler(cfg.Security.AdminToken))
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -108,6 +301,7 @@ func main() {
 	if err := monitorService.Start(ctx); err != nil {
 		logger.WithError(err).Fatal("Failed to start monitor service")
 	}
+	go alertDispatcher.RunDigests(ctx)
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
@@ -132,6 +326,17 @@ func main() {
 		logger.WithError(err).Error("Error during shutdown")
 		os.Exit(1)
 	}
+	if err := alertDispatcher.FlushDigests(shutdownCtx, true); err != nil {
+		logger.WithError(err).Warn("Failed to send pending alert digests")
+	}
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Warn("Failed to export remaining spans")
+	}
+	if stateStore != nil {
+		if err := stateStore.Close(); err != nil {
+			logger.WithError(err).Warn("Failed to close state store")
+		}
+	}
 
 	logger.Info("Monitor service stopped successfully")
 }
@@ -157,4 +362,110 @@ func healthCheck() int {
 
 	logger.Info("Health check passed")
 	return 0
-}
\ No newline at end of file
+}
+
+// newReportScheduler builds the report generator the API server uses and a
+// scheduler running the configured report schedules with it. The report
+// templates are checked here, so a broken template stops the monitor.
+func newReportScheduler(cfg *config.Config, k8sClient k8s.Client, truenasClient truenas.Client, flapping func() []analysis.FlappingVolume, logger *logging.Logger) (*scheduler.Scheduler, error) {
+	renderer, err := report.New(report.Options{
+		TemplateDir: cfg.Reports.TemplateDir,
+		Sections:    cfg.Reports.Sections,
+		Branding: report.Branding{
+			Title:        cfg.Reports.Title,
+			Organization: cfg.Reports.Organization,
+			LogoURL:      cfg.Reports.LogoURL,
+		},
+		PoolUtilizationPercent: cfg.Reports.PoolUtilizationPercent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	detector, err := orphan.NewDetector(k8sClient, truenasClient, orphan.Config{
+		AgeThreshold:      cfg.Monitor.OrphanThreshold,
+		SnapshotRetention: cfg.Monitor.SnapshotRetention,
+		Thresholds:        cfg.Monitor.OrphanThresholds.AgeThresholds(),
+		DryRun:            true,
+		Exclusions:        cfg.Monitor.Exclusions.Exclusions(),
+		StrictSnapshots:   cfg.Monitor.StrictSnapshots,
+		Logger:            logger.Component("reports"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	orphanThreshold, snapshotRetention := detector.Thresholds()
+	scanConfig := cfg.Effective()
+	generator := &report.Generator{
+		Analyzer: analysis.NewAnalyzer(k8sClient, truenasClient, analysis.Options{
+			IOStats:            cfg.Monitor.IOStats.Options(),
+			Quota:              analysis.QuotaOptions{Enabled: cfg.Monitor.Quotas.Enabled, SlackPercent: cfg.Monitor.Quotas.SlackPercent},
+			SnapshotAgeBuckets: cfg.Monitor.SnapshotAges.Buckets,
+			SnapshotHeavy:      analysis.SnapshotHeavyOptions{Ratio: cfg.Monitor.SnapshotHeavy.Ratio, TopN: cfg.Monitor.SnapshotHeavy.TopN},
+		}),
+		Detector: detector,
+		Renderer: renderer,
+		Thresholds: report.Thresholds{
+			OrphanAge:         orphanThreshold,
+			SnapshotRetention: snapshotRetention,
+		},
+		GroupWindow:     cfg.Monitor.OrphanGroupWindow,
+		Config:          &scanConfig,
+		FlappingVolumes: flapping,
+	}
+
+	schedules := make([]scheduler.Schedule, 0, len(cfg.Reports.Schedules))
+	for _, schedule := range cfg.Reports.Schedules {
+		cron, err := scheduler.ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, err
+		}
+		targets := make([]scheduler.Target, 0, len(schedule.Targets))
+		for _, target := range schedule.Targets {
+			targets = append(targets, scheduler.Target{
+				Type:    target.Type,
+				Channel: target.Channel,
+				URL:     target.URL,
+				To:      target.To,
+				Bucket:  target.Bucket,
+				Prefix:  target.Prefix,
+			})
+		}
+		schedules = append(schedules, scheduler.Schedule{
+			Name:    schedule.Name,
+			Cron:    cron,
+			Kind:    schedule.Type,
+			Format:  schedule.Format,
+			Targets: targets,
+		})
+	}
+
+	store, err := scheduler.NewStore(cfg.Reports.ScheduleStateFile)
+	if err != nil {
+		return nil, err
+	}
+	smtpConfig := cfg.Reports.SMTP
+	s3Config := cfg.Reports.S3
+	return scheduler.New(scheduler.Config{
+		Schedules: schedules,
+		Generator: generator,
+		Deliverers: map[string]scheduler.Deliverer{
+			scheduler.TargetSlack: &scheduler.SlackDeliverer{Webhook: cfg.Alerts.Slack.Webhook},
+			scheduler.TargetEmail: &scheduler.EmailDeliverer{SMTP: scheduler.SMTPConfig{
+				Host:     smtpConfig.Host,
+				Port:     smtpConfig.Port,
+				Username: smtpConfig.Username,
+				Password: smtpConfig.Password,
+				From:     smtpConfig.From,
+			}},
+			scheduler.TargetS3: &scheduler.S3Deliverer{S3: scheduler.S3Config{
+				Endpoint:        s3Config.Endpoint,
+				Region:          s3Config.Region,
+				AccessKeyID:     s3Config.AccessKeyID,
+				SecretAccessKey: s3Config.SecretAccessKey,
+			}},
+		},
+		Store:    store,
+		Backfill: cfg.Reports.Backfill,
+		Logger:   logger.Component("reports"),
+	})
+}
@@ -0,0 +1,101 @@
+// Package alerts routes monitoring alerts to notification destinations.
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Alert levels, from least to most severe.
+const (
+	LevelInfo     = "info"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// Alert sources.
+const (
+	SourceMonitor = "monitor"
+	SourceTrueNAS = "truenas"
+	SourceCleanup = "cleanup"
+)
+
+// Destination types.
+const (
+	DestinationSlack   = "slack"
+	DestinationWebhook = "webhook"
+	DestinationEmail   = "email"
+)
+
+// Alert is a single notification produced by a monitoring check.
+type Alert struct {
+	Source    string            `json:"source"`
+	Level     string            `json:"level"`
+	Category  string            `json:"category"`
+	Namespace string            `json:"namespace,omitempty"`
+	Pool      string            `json:"pool,omitempty"`
+	Resource  string            `json:"resource,omitempty"`
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	// Resolved marks a notification that the condition has cleared.
+	Resolved bool `json:"resolved,omitempty"`
+	// Digest is set on a notification summarizing a batch of alerts.
+	Digest *Digest `json:"digest,omitempty"`
+}
+
+// Destination is where a routed alert is delivered.
+type Destination struct {
+	Type string `json:"type"`
+	// Channel overrides the Slack webhook's default channel.
+	Channel string `json:"channel,omitempty"`
+	// URL is the webhook URL. For Slack it overrides the default webhook.
+	// Webhook URLs embed credentials, so only the host is marshaled.
+	URL string `json:"-"`
+	// To lists email recipients.
+	To []string `json:"to,omitempty"`
+}
+
+// MarshalJSON encodes the destination with its URL reduced to the host.
+func (d Destination) MarshalJSON() ([]byte, error) {
+	type plain Destination
+	out := struct {
+		plain
+		Host string `json:"host,omitempty"`
+	}{plain: plain(d)}
+	if u, err := url.Parse(d.URL); err == nil {
+		out.Host = u.Host
+	}
+	return json.Marshal(out)
+}
+
+// String identifies the destination in logs without exposing webhook URLs.
+func (d Destination) String() string {
+	switch d.Type {
+	case DestinationSlack:
+		if d.Channel != "" {
+			return "slack:" + d.Channel
+		}
+		return "slack"
+	case DestinationEmail:
+		return fmt.Sprintf("email:%d recipients", len(d.To))
+	case DestinationWebhook:
+		if u, err := url.Parse(d.URL); err == nil && u.Host != "" {
+			return "webhook:" + u.Host
+		}
+		return d.Type
+	default:
+		return d.Type
+	}
+}
+
+// ValidLevel reports whether level is a known alert level.
+func ValidLevel(level string) bool {
+	switch level {
+	case LevelInfo, LevelWarning, LevelCritical:
+		return true
+	}
+	return false
+}
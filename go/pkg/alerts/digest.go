@@ -0,0 +1,234 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDigestTopN is how many resources a digest lists when
+// DigestConfig.TopN is zero.
+const DefaultDigestTopN = 10
+
+// digestTick is how often RunDigests looks for digests to send.
+const digestTick = time.Second
+
+// DigestConfig batches alerts into digests. Critical alerts are always sent
+// at once; other alerts of one category taking one route are collected for
+// the route's digest window and sent as one notification.
+type DigestConfig struct {
+	// Window is the digest window of routes without their own; zero sends
+	// alerts at once.
+	Window time.Duration
+	// TopN bounds the resources named in a digest (0 = DefaultDigestTopN).
+	TopN int
+	// APIURL is the API server base URL, used to link a digest to
+	// GET /api/v1/alerts; empty omits the link.
+	APIURL string
+}
+
+// Digest summarizes the alerts batched into one notification.
+type Digest struct {
+	Window   string `json:"window"`
+	Count    int    `json:"count"`
+	Firing   int    `json:"firing"`
+	Resolved int    `json:"resolved"`
+	// New counts the resources that were not in the previous digest of the
+	// route and category.
+	New int `json:"new"`
+	// Resources are the most frequent resources, at most TopN of them;
+	// MoreResources counts the rest.
+	Resources     []string `json:"resources,omitempty"`
+	MoreResources int      `json:"more_resources,omitempty"`
+	DetailsURL    string   `json:"details_url,omitempty"`
+}
+
+// digestBatch collects the alerts of one route and category.
+type digestBatch struct {
+	key          string
+	route        string
+	destinations []Destination
+	window       time.Duration
+	opened       time.Time
+	alerts       []Alert
+}
+
+// digestWindow returns the digest window of the decision's route, or zero
+// when its alerts are sent at once.
+func (d *Dispatcher) digestWindow(decision Decision) time.Duration {
+	if decision.DigestWindow > 0 {
+		return decision.DigestWindow
+	}
+	return d.digest.Window
+}
+
+// buffer adds the alert to the digest of its route and category.
+func (d *Dispatcher) buffer(decision Decision, alert Alert, window time.Duration) {
+	key := decision.Route + "\x00" + alert.Category
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	batch, ok := d.batches[key]
+	if !ok {
+		batch = &digestBatch{
+			key:          key,
+			route:        decision.Route,
+			destinations: decision.Destinations,
+			window:       window,
+			opened:       d.clock.Now(),
+		}
+		d.batches[key] = batch
+	}
+	batch.alerts = append(batch.alerts, alert)
+}
+
+// FlushDigests sends the digests whose window has elapsed, or every
+// pending digest when all is set. Delivery errors are joined.
+func (d *Dispatcher) FlushDigests(ctx context.Context, all bool) error {
+	now := d.clock.Now()
+	d.mu.Lock()
+	var due []*digestBatch
+	for key, batch := range d.batches {
+		if all || !now.Before(batch.opened.Add(batch.window)) {
+			due = append(due, batch)
+			delete(d.batches, key)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].key < due[j].key })
+	notifications := make([]Alert, len(due))
+	for i, batch := range due {
+		notifications[i] = d.summarize(batch)
+	}
+	d.mu.Unlock()
+
+	var errs []error
+	for i, batch := range due {
+		if err := d.deliver(ctx, batch.route, batch.destinations, notifications[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunDigests sends digests as their windows elapse until ctx is done. It
+// returns at once when no route digests alerts. Call FlushDigests on
+// shutdown to send the pending ones.
+func (d *Dispatcher) RunDigests(ctx context.Context) {
+	if !d.digesting {
+		return
+	}
+	ticker := time.NewTicker(digestTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failures are logged per destination by deliver.
+			_ = d.FlushDigests(ctx, false)
+		}
+	}
+}
+
+// summarize turns a batch into the notification to send: the alert itself
+// when it is alone, otherwise a digest alert. d.mu must be held; it
+// remembers the resources of the digest for the next one.
+func (d *Dispatcher) summarize(batch *digestBatch) Alert {
+	counts := make(map[string]int)
+	for _, alert := range batch.alerts {
+		if alert.Resource != "" {
+			counts[alert.Resource]++
+		}
+	}
+	previous := d.digested[batch.key]
+	d.digested[batch.key] = counts
+	if len(batch.alerts) == 1 {
+		return batch.alerts[0]
+	}
+
+	first := batch.alerts[0]
+	notification := Alert{
+		Source:    first.Source,
+		Level:     LevelInfo,
+		Category:  first.Category,
+		Namespace: first.Namespace,
+		Pool:      first.Pool,
+		Timestamp: d.clock.Now(),
+		Digest:    &Digest{Window: batch.window.String(), Count: len(batch.alerts)},
+	}
+	digest := notification.Digest
+	for _, alert := range batch.alerts {
+		if alert.Resolved {
+			digest.Resolved++
+		} else {
+			digest.Firing++
+			if alert.Level == LevelWarning {
+				notification.Level = LevelWarning
+			}
+		}
+		if alert.Source != notification.Source {
+			notification.Source = ""
+		}
+		if alert.Namespace != notification.Namespace {
+			notification.Namespace = ""
+		}
+		if alert.Pool != notification.Pool {
+			notification.Pool = ""
+		}
+	}
+
+	resources := make([]string, 0, len(counts))
+	for resource := range counts {
+		resources = append(resources, resource)
+		if _, seen := previous[resource]; !seen {
+			digest.New++
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if counts[resources[i]] != counts[resources[j]] {
+			return counts[resources[i]] > counts[resources[j]]
+		}
+		return resources[i] < resources[j]
+	})
+	topN := d.digest.TopN
+	if topN <= 0 {
+		topN = DefaultDigestTopN
+	}
+	if len(resources) > topN {
+		digest.MoreResources = len(resources) - topN
+		resources = resources[:topN]
+	}
+	digest.Resources = resources
+	if d.digest.APIURL != "" {
+		digest.DetailsURL = strings.TrimSuffix(d.digest.APIURL, "/") + "/api/v1/alerts?category=" + url.QueryEscape(first.Category)
+	}
+	notification.Message = digestMessage(digest, counts)
+	return notification
+}
+
+// digestMessage renders a digest as one line, e.g. "12 alerts in 5m0s: 10
+// firing (3 new resources), 2 resolved; pvc-a (4), pvc-b and 6 more".
+func digestMessage(digest *Digest, counts map[string]int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d alerts in %s: %d firing (%d new resources), %d resolved", digest.Count, digest.Window, digest.Firing, digest.New, digest.Resolved)
+	if len(digest.Resources) > 0 {
+		names := make([]string, len(digest.Resources))
+		for i, resource := range digest.Resources {
+			names[i] = resource
+			if counts[resource] > 1 {
+				names[i] = fmt.Sprintf("%s (%d)", resource, counts[resource])
+			}
+		}
+		b.WriteString("; " + strings.Join(names, ", "))
+		if digest.MoreResources > 0 {
+			fmt.Fprintf(&b, " and %d more", digest.MoreResources)
+		}
+	}
+	if digest.DetailsURL != "" {
+		b.WriteString("; details: " + digest.DetailsURL)
+	}
+	return b.String()
+}
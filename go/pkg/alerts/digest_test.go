@@ -0,0 +1,162 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+// alertRecorder records the alerts it is sent.
+type alertRecorder struct {
+	mu   sync.Mutex
+	sent []Alert
+}
+
+func (r *alertRecorder) Send(_ context.Context, _ Destination, alert Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, alert)
+	return nil
+}
+
+func (r *alertRecorder) take() []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sent := r.sent
+	r.sent = nil
+	return sent
+}
+
+func newDigestDispatcher(t *testing.T, fake *clock.Fake, routes []Route, digest DigestConfig) (*Dispatcher, *alertRecorder) {
+	t.Helper()
+	slack := &alertRecorder{}
+	dispatcher, err := NewDispatcher(DispatcherConfig{
+		Router: NewRouter(RouterConfig{
+			Routes:  routes,
+			Default: Route{Destinations: []Destination{{Type: DestinationSlack, Channel: "#storage-alerts"}}},
+			Clock:   fake,
+		}),
+		Senders: map[string]Sender{DestinationSlack: slack},
+		Logger:  testLogger(t),
+		Digest:  digest,
+		Clock:   fake,
+	})
+	require.NoError(t, err)
+	return dispatcher, slack
+}
+
+func TestDispatcher_DigestsBursts(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	dispatcher, slack := newDigestDispatcher(t, fake, nil, DigestConfig{
+		Window: 5 * time.Minute, TopN: 3, APIURL: "https://truenas-tool.example.com/",
+	})
+
+	// A pool incident: 200 warnings about 50 volumes within the window, and
+	// one critical alert.
+	for i := 0; i < 200; i++ {
+		decision, err := dispatcher.Dispatch(ctx, Alert{
+			Source: SourceMonitor, Level: LevelWarning, Category: "orphaned_resource", Pool: "tank",
+			Resource: fmt.Sprintf("pvc-%02d", i%50), Message: "volume is orphaned",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Digested)
+		fake.Advance(time.Second)
+	}
+	_, err := dispatcher.Dispatch(ctx, Alert{Level: LevelCritical, Category: "pool_health", Resource: "tank"})
+	require.NoError(t, err)
+	sent := slack.take()
+	require.Len(t, sent, 1, "critical alerts are sent at once")
+	assert.Equal(t, "pool_health", sent[0].Category)
+
+	require.NoError(t, dispatcher.FlushDigests(ctx, false))
+	assert.Empty(t, slack.take(), "the window has not elapsed")
+
+	fake.Advance(2 * time.Minute)
+	require.NoError(t, dispatcher.FlushDigests(ctx, false))
+	sent = slack.take()
+	require.Len(t, sent, 1)
+	digest := sent[0].Digest
+	require.NotNil(t, digest)
+	assert.Equal(t, LevelWarning, sent[0].Level)
+	assert.Equal(t, "tank", sent[0].Pool)
+	assert.Equal(t, 200, digest.Count)
+	assert.Equal(t, 200, digest.Firing)
+	assert.Equal(t, 50, digest.New)
+	assert.Equal(t, []string{"pvc-00", "pvc-01", "pvc-02"}, digest.Resources)
+	assert.Equal(t, 47, digest.MoreResources)
+	assert.Equal(t, "https://truenas-tool.example.com/api/v1/alerts?category=orphaned_resource", digest.DetailsURL)
+	assert.Equal(t, "200 alerts in 5m0s: 200 firing (50 new resources), 0 resolved; pvc-00 (4), pvc-01 (4), pvc-02 (4) and 47 more; details: https://truenas-tool.example.com/api/v1/alerts?category=orphaned_resource", sent[0].Message)
+
+	// The next digest counts only resources the previous one did not name.
+	for _, resource := range []string{"pvc-00", "pvc-77"} {
+		_, err := dispatcher.Dispatch(ctx, Alert{Level: LevelWarning, Category: "orphaned_resource", Resource: resource})
+		require.NoError(t, err)
+	}
+	_, err = dispatcher.Dispatch(ctx, Alert{Level: LevelWarning, Category: "orphaned_resource", Resource: "pvc-01", Resolved: true})
+	require.NoError(t, err)
+	fake.Advance(5 * time.Minute)
+	require.NoError(t, dispatcher.FlushDigests(ctx, false))
+	sent = slack.take()
+	require.Len(t, sent, 1)
+	assert.Equal(t, 3, sent[0].Digest.Count)
+	assert.Equal(t, 1, sent[0].Digest.Resolved)
+	assert.Equal(t, 1, sent[0].Digest.New)
+}
+
+func TestDispatcher_DigestsPerCategoryAndRoute(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	dispatcher, slack := newDigestDispatcher(t, fake, []Route{{
+		Name:         "capacity",
+		Match:        Match{Categories: []string{"capacity"}},
+		Destinations: []Destination{{Type: DestinationSlack, Channel: "#capacity"}},
+		DigestWindow: time.Minute,
+	}}, DigestConfig{})
+
+	// Only the capacity route digests.
+	decision, err := dispatcher.Dispatch(ctx, Alert{Level: LevelWarning, Category: "orphaned_resource", Resource: "pvc-a"})
+	require.NoError(t, err)
+	assert.False(t, decision.Digested)
+	require.Len(t, slack.take(), 1)
+
+	for _, pool := range []string{"tank", "backup"} {
+		decision, err := dispatcher.Dispatch(ctx, Alert{Level: LevelWarning, Category: "capacity", Pool: pool, Resource: pool})
+		require.NoError(t, err)
+		assert.True(t, decision.Digested)
+	}
+	_, err = dispatcher.Dispatch(ctx, Alert{Level: LevelInfo, Category: "capacity", Resource: "tank", Resolved: true})
+	require.NoError(t, err)
+	fake.Advance(time.Minute)
+
+	decision, err = dispatcher.Dispatch(ctx, Alert{Level: LevelWarning, Category: "capacity_forecast", Resource: "tank"})
+	require.NoError(t, err)
+	assert.False(t, decision.Digested, "capacity_forecast takes the default route")
+
+	require.NoError(t, dispatcher.FlushDigests(ctx, false))
+	sent := slack.take()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "capacity_forecast", sent[0].Category)
+	digest := sent[1].Digest
+	require.NotNil(t, digest)
+	assert.Equal(t, "", sent[1].Pool, "alerts of several pools")
+	assert.Equal(t, 3, digest.Count)
+	assert.Equal(t, []string{"tank", "backup"}, digest.Resources)
+	assert.Empty(t, digest.DetailsURL)
+	assert.Equal(t, "3 alerts in 1m0s: 2 firing (2 new resources), 1 resolved; tank (2), backup", sent[1].Message)
+
+	// A digest of a single alert is sent as that alert.
+	_, err = dispatcher.Dispatch(ctx, Alert{Level: LevelWarning, Category: "capacity", Resource: "tank"})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.FlushDigests(ctx, true), "shutdown sends pending digests")
+	sent = slack.take()
+	require.Len(t, sent, 1)
+	assert.Nil(t, sent[0].Digest)
+}
@@ -0,0 +1,203 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/webhook"
+)
+
+// DefaultSendTimeout bounds a single delivery when the HTTP client has none.
+const DefaultSendTimeout = 10 * time.Second
+
+// Sender delivers an alert to one destination.
+type Sender interface {
+	Send(ctx context.Context, destination Destination, alert Alert) error
+}
+
+// SenderFunc adapts a function to Sender.
+type SenderFunc func(ctx context.Context, destination Destination, alert Alert) error
+
+// Send calls f.
+func (f SenderFunc) Send(ctx context.Context, destination Destination, alert Alert) error {
+	return f(ctx, destination, alert)
+}
+
+// DispatcherConfig configures a Dispatcher.
+type DispatcherConfig struct {
+	Router *Router
+	// Senders deliver alerts by destination type. Destinations without a
+	// sender fail delivery; no email sender ships yet.
+	Senders map[string]Sender
+	Logger  *logging.Logger
+	// Digest batches non-critical alerts; the zero value sends them at once
+	// unless a route has a digest window.
+	Digest DigestConfig
+	// Clock timestamps test notifications and digests. Nil uses the real
+	// clock.
+	Clock clock.Clock
+}
+
+// Dispatcher routes alerts and delivers them to the chosen destinations.
+type Dispatcher struct {
+	router    *Router
+	senders   map[string]Sender
+	logger    *logging.Logger
+	clock     clock.Clock
+	digest    DigestConfig
+	digesting bool
+
+	mu      sync.Mutex
+	batches map[string]*digestBatch
+	// digested holds the resource counts of the last digest per route and
+	// category, to count new resources.
+	digested map[string]map[string]int
+}
+
+// NewDispatcher creates a dispatcher.
+func NewDispatcher(config DispatcherConfig) (*Dispatcher, error) {
+	if config.Router == nil {
+		return nil, fmt.Errorf("alert router is required")
+	}
+	if config.Logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	digesting := config.Digest.Window > 0
+	for _, route := range config.Router.Routes() {
+		digesting = digesting || route.DigestWindow > 0
+	}
+	return &Dispatcher{
+		router:    config.Router,
+		senders:   config.Senders,
+		logger:    config.Logger,
+		clock:     clock.OrReal(config.Clock),
+		digest:    config.Digest,
+		digesting: digesting,
+		batches:   make(map[string]*digestBatch),
+		digested:  make(map[string]map[string]int),
+	}, nil
+}
+
+// Router returns the dispatcher's router.
+func (d *Dispatcher) Router() *Router {
+	return d.router
+}
+
+// Dispatch routes the alert and sends it to every destination of the chosen
+// route. Silenced alerts are not sent, and non-critical alerts on a route
+// with a digest window are held for its digest. Delivery errors are joined;
+// a failing destination does not stop delivery to the others.
+func (d *Dispatcher) Dispatch(ctx context.Context, alert Alert) (Decision, error) {
+	decision := d.router.Route(alert)
+	if decision.Silenced {
+		d.logger.Debug("Alert silenced",
+			zap.String("category", alert.Category),
+			zap.String("resource", alert.Resource),
+			zap.String("route", decision.Route),
+			zap.Time("silence_expires", decision.Silence.Expires))
+		return decision, nil
+	}
+	if window := d.digestWindow(decision); window > 0 && alert.Level != LevelCritical {
+		d.buffer(decision, alert, window)
+		decision.Digested = true
+		return decision, nil
+	}
+	return decision, d.deliver(ctx, decision.Route, decision.Destinations, alert)
+}
+
+// deliver sends the alert to each destination and joins the errors.
+func (d *Dispatcher) deliver(ctx context.Context, route string, destinations []Destination, alert Alert) error {
+	var errs []error
+	for _, destination := range destinations {
+		if err := d.send(ctx, destination, alert); err != nil {
+			d.logger.Warn("Failed to deliver alert",
+				zap.String("destination", destination.String()),
+				zap.String("route", route),
+				zap.String("category", alert.Category),
+				logging.RedactedError(err))
+			errs = append(errs, fmt.Errorf("%s: %w", destination, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send delivers the alert with the sender of the destination type.
+func (d *Dispatcher) send(ctx context.Context, destination Destination, alert Alert) error {
+	sender, ok := d.senders[destination.Type]
+	if !ok {
+		return fmt.Errorf("no sender for %s destination", destination.Type)
+	}
+	return sender.Send(ctx, destination, alert)
+}
+
+// SlackSender posts alerts to a Slack incoming webhook.
+type SlackSender struct {
+	// Webhook is used when the destination has no URL of its own.
+	Webhook string
+	Client  *http.Client
+}
+
+// Send posts the alert as a Slack message.
+func (s *SlackSender) Send(ctx context.Context, destination Destination, alert Alert) error {
+	target := destination.URL
+	if target == "" {
+		target = s.Webhook
+	}
+	if target == "" {
+		return fmt.Errorf("slack webhook is not configured")
+	}
+	status := alert.Level
+	if alert.Resolved {
+		status = "resolved"
+	}
+	if alert.Digest != nil {
+		status += " digest"
+	}
+	payload := map[string]string{
+		"text": fmt.Sprintf("[%s] %s: %s", status, alert.Category, alert.Message),
+	}
+	if destination.Channel != "" {
+		payload["channel"] = destination.Channel
+	}
+	return webhook.PostJSON(ctx, httpClient(s.Client), target, payload)
+}
+
+// WebhookSender posts alerts as JSON to a generic webhook.
+type WebhookSender struct {
+	Client *http.Client
+}
+
+// Send posts the alert JSON to the destination URL.
+func (s *WebhookSender) Send(ctx context.Context, destination Destination, alert Alert) error {
+	if destination.URL == "" {
+		return fmt.Errorf("webhook url is not configured")
+	}
+	return webhook.PostJSON(ctx, httpClient(s.Client), destination.URL, alert)
+}
+
+// httpClient returns client, or one bounded by DefaultSendTimeout when it
+// is nil.
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: DefaultSendTimeout}
+	}
+	return client
+}
+
+// DefaultSenders returns the Slack and generic webhook senders. slackWebhook
+// is used for Slack destinations without a URL of their own.
+func DefaultSenders(slackWebhook string) map[string]Sender {
+	client := &http.Client{Timeout: DefaultSendTimeout}
+	return map[string]Sender{
+		DestinationSlack:   &SlackSender{Webhook: slackWebhook, Client: client},
+		DestinationWebhook: &WebhookSender{Client: client},
+	}
+}
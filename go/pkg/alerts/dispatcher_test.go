@@ -0,0 +1,109 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+func testLogger(t *testing.T) *logging.Logger {
+	t.Helper()
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	require.NoError(t, err)
+	return logger
+}
+
+type recordingSender struct {
+	sent []Destination
+	err  error
+}
+
+func (r *recordingSender) Send(_ context.Context, destination Destination, _ Alert) error {
+	r.sent = append(r.sent, destination)
+	return r.err
+}
+
+func TestDispatcher_SendsToRouteDestinations(t *testing.T) {
+	slack := &recordingSender{}
+	webhook := &recordingSender{err: errors.New("boom")}
+	dispatcher, err := NewDispatcher(DispatcherConfig{
+		Router: testRouter(clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))),
+		Senders: map[string]Sender{
+			DestinationSlack:   slack,
+			DestinationWebhook: webhook,
+		},
+		Logger: testLogger(t),
+	})
+	require.NoError(t, err)
+
+	decision, err := dispatcher.Dispatch(context.Background(), Alert{Level: LevelCritical, Category: "duplicate_volume_handle"})
+	require.NoError(t, err)
+	assert.Equal(t, "critical", decision.Route)
+	require.Len(t, slack.sent, 1)
+	assert.Equal(t, "#storage-critical", slack.sent[0].Channel)
+
+	_, err = dispatcher.Dispatch(context.Background(), Alert{Level: LevelWarning, Category: "orphaned_resource", Namespace: "team-a-x"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+
+	_, err = dispatcher.Dispatch(context.Background(), Alert{Level: LevelWarning, Category: "capacity", Pool: "backup"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no sender for email destination")
+}
+
+func TestDispatcher_SkipsSilencedAlerts(t *testing.T) {
+	slack := &recordingSender{}
+	dispatcher, err := NewDispatcher(DispatcherConfig{
+		Router:  testRouter(clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))),
+		Senders: map[string]Sender{DestinationSlack: slack},
+		Logger:  testLogger(t),
+	})
+	require.NoError(t, err)
+
+	decision, err := dispatcher.Dispatch(context.Background(), Alert{Level: LevelWarning, Category: "snapshot_schedule", Namespace: "legacy"})
+	require.NoError(t, err)
+	assert.True(t, decision.Silenced)
+	assert.Empty(t, slack.sent)
+}
+
+func TestSlackSender_PostsChannelAndText(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	sender := &SlackSender{Webhook: server.URL}
+	err := sender.Send(context.Background(), Destination{Type: DestinationSlack, Channel: "#ops"},
+		Alert{Level: LevelWarning, Category: "capacity", Message: "pool tank at 91%"})
+	require.NoError(t, err)
+	assert.Equal(t, "#ops", payload["channel"])
+	assert.Equal(t, "[warning] capacity: pool tank at 91%", payload["text"])
+
+	err = sender.Send(context.Background(), Destination{Type: DestinationSlack},
+		Alert{Level: LevelWarning, Category: "capacity", Message: "3 alerts in 5m0s", Digest: &Digest{Count: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, "[warning digest] capacity: 3 alerts in 5m0s", payload["text"])
+}
+
+func TestWebhookSender_ReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := (&WebhookSender{}).Send(context.Background(), Destination{Type: DestinationWebhook, URL: server.URL}, Alert{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 502")
+}
@@ -0,0 +1,156 @@
+package alerts
+
+import (
+	"path"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+// DefaultRouteName names the route used when no rule matches.
+const DefaultRouteName = "default"
+
+// Match selects alerts by field. Each non-empty list must contain a value
+// matching the alert; empty lists match anything. Namespace and pool entries
+// may be shell globs such as "prod-*".
+type Match struct {
+	Sources    []string `json:"sources,omitempty"`
+	Levels     []string `json:"levels,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Pools      []string `json:"pools,omitempty"`
+}
+
+// Matches reports whether the alert satisfies every condition.
+func (m Match) Matches(alert Alert) bool {
+	return matchesExact(m.Sources, alert.Source) &&
+		matchesExact(m.Levels, alert.Level) &&
+		matchesExact(m.Categories, alert.Category) &&
+		matchesGlob(m.Namespaces, alert.Namespace) &&
+		matchesGlob(m.Pools, alert.Pool)
+}
+
+func matchesExact(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesGlob(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Route sends matching alerts to its destinations.
+type Route struct {
+	Name         string        `json:"name"`
+	Match        Match         `json:"match"`
+	Destinations []Destination `json:"destinations"`
+	// DigestWindow batches the route's non-critical alerts into digests;
+	// zero uses the dispatcher's DigestConfig.Window.
+	DigestWindow time.Duration `json:"-"`
+}
+
+// Silence suppresses matching alerts until Expires.
+type Silence struct {
+	Match   Match     `json:"match"`
+	Expires time.Time `json:"expires"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// Active reports whether the silence is in effect at now.
+func (s Silence) Active(now time.Time) bool {
+	return now.Before(s.Expires)
+}
+
+// RouterConfig configures a Router.
+type RouterConfig struct {
+	// Routes are evaluated in order; the first match wins.
+	Routes []Route
+	// Default receives alerts no route matches.
+	Default  Route
+	Silences []Silence
+	// Clock decides whether silences have expired. Nil uses the real clock.
+	Clock clock.Clock
+}
+
+// Decision is the outcome of routing one alert.
+type Decision struct {
+	Route        string        `json:"route"`
+	Destinations []Destination `json:"destinations"`
+	Silenced     bool          `json:"silenced"`
+	Silence      *Silence      `json:"silence,omitempty"`
+	// DigestWindow is the route's own digest window.
+	DigestWindow time.Duration `json:"-"`
+	// Digested is set by Dispatch when the alert was held for a digest.
+	Digested bool `json:"digested,omitempty"`
+}
+
+// Router picks destinations for alerts.
+type Router struct {
+	routes       []Route
+	defaultRoute Route
+	silences     []Silence
+	clock        clock.Clock
+}
+
+// NewRouter creates a router from config.
+func NewRouter(config RouterConfig) *Router {
+	defaultRoute := config.Default
+	if defaultRoute.Name == "" {
+		defaultRoute.Name = DefaultRouteName
+	}
+	return &Router{
+		routes:       append([]Route(nil), config.Routes...),
+		defaultRoute: defaultRoute,
+		silences:     append([]Silence(nil), config.Silences...),
+		clock:        clock.OrReal(config.Clock),
+	}
+}
+
+// Route returns the route the alert takes and whether an active silence
+// suppresses it. Silenced decisions still name the route that would apply.
+func (r *Router) Route(alert Alert) Decision {
+	route := r.defaultRoute
+	for _, candidate := range r.routes {
+		if candidate.Match.Matches(alert) {
+			route = candidate
+			break
+		}
+	}
+
+	decision := Decision{
+		Route:        route.Name,
+		Destinations: append([]Destination{}, route.Destinations...),
+		DigestWindow: route.DigestWindow,
+	}
+
+	now := r.clock.Now()
+	for i := range r.silences {
+		silence := r.silences[i]
+		if silence.Active(now) && silence.Match.Matches(alert) {
+			decision.Silenced = true
+			decision.Silence = &silence
+			break
+		}
+	}
+	return decision
+}
+
+// Routes returns the configured routes followed by the default route.
+func (r *Router) Routes() []Route {
+	return append(append([]Route{}, r.routes...), r.defaultRoute)
+}
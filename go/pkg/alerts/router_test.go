@@ -0,0 +1,98 @@
+package alerts
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+func testRouter(fake *clock.Fake) *Router {
+	return NewRouter(RouterConfig{
+		Routes: []Route{
+			{
+				Name:         "critical",
+				Match:        Match{Levels: []string{LevelCritical}},
+				Destinations: []Destination{{Type: DestinationSlack, Channel: "#storage-critical"}},
+			},
+			{
+				Name:         "team-a",
+				Match:        Match{Namespaces: []string{"team-a-*"}, Categories: []string{"orphaned_resource"}},
+				Destinations: []Destination{{Type: DestinationWebhook, URL: "https://hooks.example.com/a"}},
+			},
+			{
+				Name:         "truenas",
+				Match:        Match{Sources: []string{SourceTrueNAS}},
+				Destinations: []Destination{{Type: DestinationSlack, Channel: "#nas"}},
+			},
+			{
+				Name:         "backup-pool",
+				Match:        Match{Pools: []string{"backup"}},
+				Destinations: []Destination{{Type: DestinationEmail, To: []string{"storage@example.com"}}},
+			},
+		},
+		Default: Route{Destinations: []Destination{{Type: DestinationSlack, Channel: "#storage-alerts"}}},
+		Silences: []Silence{{
+			Match:   Match{Categories: []string{"snapshot_schedule"}, Namespaces: []string{"legacy"}},
+			Expires: fake.Now().Add(time.Hour),
+			Comment: "legacy app migrating",
+		}},
+		Clock: fake,
+	})
+}
+
+func TestRouter_FirstMatchingRouteWins(t *testing.T) {
+	router := testRouter(clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	tests := []struct {
+		name  string
+		alert Alert
+		route string
+	}{
+		{"critical beats namespace", Alert{Level: LevelCritical, Category: "orphaned_resource", Namespace: "team-a-prod"}, "critical"},
+		{"namespace glob", Alert{Level: LevelWarning, Category: "orphaned_resource", Namespace: "team-a-prod"}, "team-a"},
+		{"category must also match", Alert{Level: LevelWarning, Category: "snapshot_schedule", Namespace: "team-a-prod"}, DefaultRouteName},
+		{"pool", Alert{Level: LevelWarning, Category: "capacity", Pool: "backup"}, "backup-pool"},
+		{"default", Alert{Level: LevelInfo, Category: "capacity", Pool: "tank"}, DefaultRouteName},
+		{"source", Alert{Source: SourceTrueNAS, Level: LevelWarning, Category: TrueNASCategory}, "truenas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := router.Route(tt.alert)
+			assert.Equal(t, tt.route, decision.Route)
+			assert.False(t, decision.Silenced)
+			assert.NotEmpty(t, decision.Destinations)
+		})
+	}
+}
+
+func TestRouter_SilenceUntilExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	router := testRouter(fake)
+	alert := Alert{Level: LevelWarning, Category: "snapshot_schedule", Namespace: "legacy"}
+
+	decision := router.Route(alert)
+	require.True(t, decision.Silenced)
+	require.NotNil(t, decision.Silence)
+	assert.Equal(t, "legacy app migrating", decision.Silence.Comment)
+	assert.Equal(t, DefaultRouteName, decision.Route, "silenced decisions still name the route")
+
+	fake.Advance(time.Hour)
+	assert.False(t, router.Route(alert).Silenced, "silence must lapse at expiry")
+}
+
+func TestRouter_RoutesEndsWithDefault(t *testing.T) {
+	routes := testRouter(clock.NewFake(time.Unix(0, 0))).Routes()
+	require.Len(t, routes, 5)
+	assert.Equal(t, DefaultRouteName, routes[4].Name)
+}
+
+func TestDestination_MarshalJSONHidesWebhookPath(t *testing.T) {
+	data, err := json.Marshal(Destination{Type: DestinationSlack, Channel: "#ops", URL: "https://hooks.slack.com/services/T000/B000/secret"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"slack","channel":"#ops","host":"hooks.slack.com"}`, string(data))
+}
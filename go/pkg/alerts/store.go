@@ -0,0 +1,256 @@
+package alerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+// Active alert states.
+const (
+	StateFiring       = "firing"
+	StateAcknowledged = "acknowledged"
+)
+
+// DefaultRenotifyInterval is how often an unacknowledged alert is re-sent.
+const DefaultRenotifyInterval = 4 * time.Hour
+
+// ErrAlertNotFound is returned for unknown alert IDs.
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ActiveAlert is an alert condition that is still present.
+type ActiveAlert struct {
+	Alert
+	ID             string     `json:"id"`
+	State          string     `json:"state"`
+	FirstSeen      time.Time  `json:"first_seen"`
+	LastSeen       time.Time  `json:"last_seen"`
+	LastNotified   time.Time  `json:"last_notified"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+}
+
+// AlertID derives a stable ID from the alert's category, namespace and
+// resource, falling back to the message when no resource is set.
+func AlertID(alert Alert) string {
+	subject := alert.Resource
+	if subject == "" {
+		subject = alert.Message
+	}
+	sum := sha256.Sum256([]byte(alert.Category + "\x00" + alert.Namespace + "\x00" + subject))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StoreConfig configures a Store.
+type StoreConfig struct {
+	// Path persists the store as JSON. Processes sharing the file see each
+	// other's changes; empty keeps the store in memory.
+	Path string
+	// RenotifyInterval re-sends unacknowledged alerts. Zero uses
+	// DefaultRenotifyInterval; negative disables re-notification.
+	RenotifyInterval time.Duration
+	// Clock stamps alert transitions. Nil uses the real clock.
+	Clock clock.Clock
+}
+
+// Reconciliation is the outcome of Store.Reconcile.
+type Reconciliation struct {
+	// Notify holds new alerts and unacknowledged alerts due for re-notification.
+	Notify []ActiveAlert
+	// Resolved holds alerts whose condition cleared; they are removed.
+	Resolved []ActiveAlert
+}
+
+// Store tracks active alerts across scans.
+type Store struct {
+	path     string
+	renotify time.Duration
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	alerts map[string]*ActiveAlert
+}
+
+// NewStore creates a store, loading existing alerts from config.Path.
+func NewStore(config StoreConfig) (*Store, error) {
+	renotify := config.RenotifyInterval
+	if renotify == 0 {
+		renotify = DefaultRenotifyInterval
+	}
+	s := &Store{
+		path:     config.Path,
+		renotify: renotify,
+		clock:    clock.OrReal(config.Clock),
+		alerts:   make(map[string]*ActiveAlert),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reconcile records the alerts raised by a check run. Active alerts in the
+// covered categories that were not raised again are resolved and removed;
+// alerts in other categories are left alone, so a check that could not run
+// does not clear its alerts.
+func (s *Store) Reconcile(current []Alert, covered []string) (Reconciliation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return Reconciliation{}, err
+	}
+
+	now := s.clock.Now()
+	var result Reconciliation
+	seen := make(map[string]bool, len(current))
+	for _, alert := range current {
+		id := AlertID(alert)
+		seen[id] = true
+		active, ok := s.alerts[id]
+		if !ok {
+			active = &ActiveAlert{ID: id, State: StateFiring, FirstSeen: now}
+			s.alerts[id] = active
+		}
+		active.Alert = alert
+		active.LastSeen = now
+		if active.State == StateFiring && s.due(active, now) {
+			active.LastNotified = now
+			result.Notify = append(result.Notify, *active)
+		}
+	}
+
+	coveredSet := make(map[string]bool, len(covered))
+	for _, category := range covered {
+		coveredSet[category] = true
+	}
+	for id, active := range s.alerts {
+		if !seen[id] && coveredSet[active.Category] {
+			result.Resolved = append(result.Resolved, *active)
+			delete(s.alerts, id)
+		}
+	}
+
+	sortActive(result.Notify)
+	sortActive(result.Resolved)
+	return result, s.save()
+}
+
+func (s *Store) due(active *ActiveAlert, now time.Time) bool {
+	if active.LastNotified.IsZero() {
+		return true
+	}
+	return s.renotify > 0 && !now.Before(active.LastNotified.Add(s.renotify))
+}
+
+// Acknowledge marks an alert acknowledged. It stays listed but is no longer
+// re-notified.
+func (s *Store) Acknowledge(id, by string) (ActiveAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return ActiveAlert{}, err
+	}
+
+	active, ok := s.alerts[id]
+	if !ok {
+		return ActiveAlert{}, ErrAlertNotFound
+	}
+	if active.State != StateAcknowledged {
+		now := s.clock.Now()
+		active.State = StateAcknowledged
+		active.AcknowledgedAt = &now
+		active.AcknowledgedBy = by
+	}
+	return *active, s.save()
+}
+
+// List returns active alerts ordered by first seen, then ID.
+func (s *Store) List() ([]ActiveAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]ActiveAlert, 0, len(s.alerts))
+	for _, active := range s.alerts {
+		list = append(list, *active)
+	}
+	sortActive(list)
+	return list, nil
+}
+
+func sortActive(list []ActiveAlert) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].FirstSeen.Equal(list[j].FirstSeen) {
+			return list[i].FirstSeen.Before(list[j].FirstSeen)
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+// load replaces the in-memory alerts with the persisted ones. A missing file
+// leaves the store as is.
+func (s *Store) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read alert state: %w", err)
+	}
+	var list []ActiveAlert
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse alert state %s: %w", s.path, err)
+	}
+	s.alerts = make(map[string]*ActiveAlert, len(list))
+	for i := range list {
+		s.alerts[list[i].ID] = &list[i]
+	}
+	return nil
+}
+
+// save writes the alerts atomically through a temporary file.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]ActiveAlert, 0, len(s.alerts))
+	for _, active := range s.alerts {
+		list = append(list, *active)
+	}
+	sortActive(list)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode alert state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".alerts-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	return nil
+}
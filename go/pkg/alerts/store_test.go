@@ -0,0 +1,124 @@
+package alerts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+var (
+	orphanAlert    = Alert{Level: LevelWarning, Category: "orphaned_resource", Resource: "PersistentVolume/pv-1", Message: "orphaned"}
+	duplicateAlert = Alert{Level: LevelCritical, Category: "duplicate_volume_handle", Resource: "pvc-1111", Message: "shared"}
+	scheduleAlert  = Alert{Level: LevelWarning, Category: "snapshot_schedule", Resource: "pv-2", Message: "stale"}
+)
+
+func TestStore_ReconcileNotifiesOnceAndRenotifies(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store, err := NewStore(StoreConfig{RenotifyInterval: time.Hour, Clock: fake})
+	require.NoError(t, err)
+
+	result, err := store.Reconcile([]Alert{orphanAlert, duplicateAlert}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Notify, 2)
+	assert.Empty(t, result.Resolved)
+
+	fake.Advance(30 * time.Minute)
+	result, err = store.Reconcile([]Alert{orphanAlert, duplicateAlert}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Notify, "alerts must not re-notify within the interval")
+
+	fake.Advance(30 * time.Minute)
+	result, err = store.Reconcile([]Alert{orphanAlert, duplicateAlert}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Notify, 2)
+
+	list, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), list[0].FirstSeen)
+	assert.Equal(t, fake.Now(), list[0].LastSeen)
+	assert.Equal(t, StateFiring, list[0].State)
+}
+
+func TestStore_AcknowledgeSuppressesRenotification(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store, err := NewStore(StoreConfig{RenotifyInterval: time.Minute, Clock: fake})
+	require.NoError(t, err)
+
+	_, err = store.Reconcile([]Alert{duplicateAlert}, nil)
+	require.NoError(t, err)
+
+	acked, err := store.Acknowledge(AlertID(duplicateAlert), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, StateAcknowledged, acked.State)
+	assert.Equal(t, "alice", acked.AcknowledgedBy)
+	require.NotNil(t, acked.AcknowledgedAt)
+
+	fake.Advance(time.Hour)
+	result, err := store.Reconcile([]Alert{duplicateAlert}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Notify)
+
+	list, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1, "acknowledged alerts stay visible")
+
+	_, err = store.Acknowledge("missing", "alice")
+	assert.ErrorIs(t, err, ErrAlertNotFound)
+}
+
+func TestStore_ResolvesOnlyCoveredCategories(t *testing.T) {
+	store, err := NewStore(StoreConfig{Clock: clock.NewFake(time.Unix(0, 0))})
+	require.NoError(t, err)
+
+	_, err = store.Reconcile([]Alert{orphanAlert, scheduleAlert}, nil)
+	require.NoError(t, err)
+
+	// The schedule check did not run, so its alert must survive.
+	result, err := store.Reconcile(nil, []string{"orphaned_resource"})
+	require.NoError(t, err)
+	require.Len(t, result.Resolved, 1)
+	assert.Equal(t, orphanAlert.Resource, result.Resolved[0].Resource)
+
+	list, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "snapshot_schedule", list[0].Category)
+}
+
+func TestStore_PersistsAcrossInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	monitor, err := NewStore(StoreConfig{Path: path, Clock: fake})
+	require.NoError(t, err)
+	_, err = monitor.Reconcile([]Alert{duplicateAlert}, nil)
+	require.NoError(t, err)
+
+	// A second process sharing the file acknowledges the alert.
+	api, err := NewStore(StoreConfig{Path: path, Clock: fake})
+	require.NoError(t, err)
+	_, err = api.Acknowledge(AlertID(duplicateAlert), "bob")
+	require.NoError(t, err)
+
+	fake.Advance(24 * time.Hour)
+	result, err := monitor.Reconcile([]Alert{duplicateAlert}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Notify, "acknowledgement from the other process must be honoured")
+
+	list, err := api.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, StateAcknowledged, list[0].State)
+}
+
+func TestAlertID_StableAndDistinct(t *testing.T) {
+	assert.Equal(t, AlertID(orphanAlert), AlertID(Alert{Category: orphanAlert.Category, Resource: orphanAlert.Resource, Message: "changed"}))
+	assert.NotEqual(t, AlertID(orphanAlert), AlertID(duplicateAlert))
+	assert.Len(t, AlertID(orphanAlert), 16)
+}
@@ -0,0 +1,45 @@
+package alerts
+
+import (
+	"strings"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// TrueNASCategory is the category of alerts pulled from TrueNAS.
+const TrueNASCategory = "truenas_alert"
+
+// TrueNASLevel maps a TrueNAS alert level to an alert level. INFO and NOTICE
+// are info, WARNING is warning, and ERROR and above are critical.
+func TrueNASLevel(level string) string {
+	switch strings.ToUpper(level) {
+	case "INFO", "NOTICE":
+		return LevelInfo
+	case "WARNING":
+		return LevelWarning
+	default:
+		return LevelCritical
+	}
+}
+
+// FromTrueNAS converts a TrueNAS alert. The TrueNAS UUID is the resource, so
+// the alert keeps one ID however often it is polled.
+func FromTrueNAS(alert truenas.Alert) Alert {
+	labels := map[string]string{
+		"klass":         alert.Klass,
+		"truenas_level": alert.Level,
+	}
+	if alert.Node != "" {
+		labels["node"] = alert.Node
+	}
+	return Alert{
+		Source:    SourceTrueNAS,
+		Level:     TrueNASLevel(alert.Level),
+		Category:  TrueNASCategory,
+		Pool:      alert.Pool,
+		Resource:  alert.UUID,
+		Message:   alert.Message,
+		Labels:    labels,
+		Timestamp: alert.LastOccurrence,
+	}
+}
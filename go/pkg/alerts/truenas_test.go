@@ -0,0 +1,48 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestTrueNASLevel(t *testing.T) {
+	for level, want := range map[string]string{
+		"INFO":      LevelInfo,
+		"NOTICE":    LevelInfo,
+		"WARNING":   LevelWarning,
+		"ERROR":     LevelCritical,
+		"CRITICAL":  LevelCritical,
+		"ALERT":     LevelCritical,
+		"EMERGENCY": LevelCritical,
+		"warning":   LevelWarning,
+	} {
+		assert.Equal(t, want, TrueNASLevel(level), level)
+	}
+}
+
+func TestFromTrueNAS_KeyedByUUID(t *testing.T) {
+	first := truenas.Alert{
+		UUID:           "6a9e1d27",
+		Klass:          "VolumeStatus",
+		Level:          "CRITICAL",
+		Node:           "Controller A",
+		Pool:           "backup",
+		Message:        "Pool backup state is DEGRADED",
+		LastOccurrence: time.Unix(100, 0),
+	}
+	repeated := first
+	repeated.Message = "Pool backup state is DEGRADED: disk removed"
+	repeated.LastOccurrence = time.Unix(200, 0)
+
+	alert := FromTrueNAS(first)
+	assert.Equal(t, SourceTrueNAS, alert.Source)
+	assert.Equal(t, LevelCritical, alert.Level)
+	assert.Equal(t, TrueNASCategory, alert.Category)
+	assert.Equal(t, "backup", alert.Pool)
+	assert.Equal(t, "VolumeStatus", alert.Labels["klass"])
+	assert.Equal(t, AlertID(alert), AlertID(FromTrueNAS(repeated)))
+}
@@ -0,0 +1,72 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// CategoryDestinationTest is the category of the notifications Verify sends.
+const CategoryDestinationTest = "destination_test"
+
+// DestinationCheck is the outcome of sending a test notification to one
+// configured destination.
+type DestinationCheck struct {
+	Destination Destination `json:"destination"`
+	// Routes names the routes that deliver to the destination.
+	Routes  []string `json:"routes"`
+	Healthy bool     `json:"healthy"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Verify sends a test notification, marked "[TEST]" and labeled test=true,
+// to every distinct destination of the configured routes, including the
+// default route. origin names the sending service in the message. Silences
+// do not apply. A failing destination does not stop the others.
+func (d *Dispatcher) Verify(ctx context.Context, origin string) []DestinationCheck {
+	var checks []DestinationCheck
+	for _, route := range d.router.Routes() {
+		for _, destination := range route.Destinations {
+			known := false
+			for i := range checks {
+				if reflect.DeepEqual(checks[i].Destination, destination) {
+					checks[i].Routes = append(checks[i].Routes, route.Name)
+					known = true
+					break
+				}
+			}
+			if !known {
+				checks = append(checks, DestinationCheck{Destination: destination, Routes: []string{route.Name}})
+			}
+		}
+	}
+
+	alert := Alert{
+		Source:    SourceMonitor,
+		Level:     LevelInfo,
+		Category:  CategoryDestinationTest,
+		Message:   fmt.Sprintf("[TEST] Alert destination check from %s; no action required", origin),
+		Labels:    map[string]string{"test": "true"},
+		Timestamp: d.clock.Now().UTC(),
+	}
+	for i := range checks {
+		err := d.send(ctx, checks[i].Destination, alert)
+		checks[i].Healthy = err == nil
+		if err != nil {
+			checks[i].Error = err.Error()
+		}
+	}
+	return checks
+}
+
+// DestinationHealth returns whether every checked destination with the same
+// name (Destination.String) is healthy, keyed by that name.
+func DestinationHealth(checks []DestinationCheck) map[string]bool {
+	health := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		name := check.Destination.String()
+		healthy, seen := health[name]
+		health[name] = check.Healthy && (healthy || !seen)
+	}
+	return health
+}
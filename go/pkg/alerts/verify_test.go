@@ -0,0 +1,73 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+func TestDispatcher_VerifySendsOneTestPerDestination(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	router := NewRouter(RouterConfig{
+		Routes: []Route{
+			{Name: "critical", Destinations: []Destination{{Type: DestinationSlack, Channel: "#storage"}}},
+			{Name: "team-a", Destinations: []Destination{
+				{Type: DestinationWebhook, URL: "https://hooks.example.com/a"},
+				{Type: DestinationSlack, Channel: "#storage"},
+			}},
+			{Name: "backup-pool", Destinations: []Destination{{Type: DestinationEmail, To: []string{"storage@example.com"}}}},
+		},
+		Default: Route{Destinations: []Destination{{Type: DestinationSlack, Channel: "#storage"}}},
+		// Silences do not suppress test notifications.
+		Silences: []Silence{{Match: Match{}, Expires: fake.Now().Add(time.Hour)}},
+		Clock:    fake,
+	})
+
+	var alerts []Alert
+	slack := SenderFunc(func(_ context.Context, _ Destination, alert Alert) error {
+		alerts = append(alerts, alert)
+		return nil
+	})
+	webhook := SenderFunc(func(context.Context, Destination, Alert) error { return errors.New("destination returned status 404") })
+	dispatcher, err := NewDispatcher(DispatcherConfig{
+		Router:  router,
+		Senders: map[string]Sender{DestinationSlack: slack, DestinationWebhook: webhook},
+		Logger:  testLogger(t),
+		Clock:   fake,
+	})
+	require.NoError(t, err)
+
+	checks := dispatcher.Verify(context.Background(), "truenas-monitor")
+	require.Len(t, checks, 3)
+	assert.Equal(t, []string{"critical", "team-a", DefaultRouteName}, checks[0].Routes)
+	assert.True(t, checks[0].Healthy)
+	assert.False(t, checks[1].Healthy)
+	assert.Equal(t, "destination returned status 404", checks[1].Error)
+	assert.Equal(t, "no sender for email destination", checks[2].Error)
+
+	require.Len(t, alerts, 1)
+	assert.Equal(t, CategoryDestinationTest, alerts[0].Category)
+	assert.Contains(t, alerts[0].Message, "[TEST]")
+	assert.Contains(t, alerts[0].Message, "truenas-monitor")
+	assert.Equal(t, "true", alerts[0].Labels["test"])
+	assert.Equal(t, fake.Now(), alerts[0].Timestamp)
+
+	assert.Equal(t, map[string]bool{
+		"slack:#storage":            true,
+		"webhook:hooks.example.com": false,
+		"email:1 recipients":        false,
+	}, DestinationHealth(checks))
+}
+
+func TestWebhookSender_ErrorsOmitTheURL(t *testing.T) {
+	err := (&WebhookSender{}).Send(context.Background(),
+		Destination{Type: DestinationWebhook, URL: "http://127.0.0.1:1/services/T000/B000/secret"}, Alert{})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
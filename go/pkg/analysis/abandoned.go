@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Default abandoned dataset settings.
+const (
+	DefaultAbandonedMinAge        = 30 * 24 * time.Hour
+	DefaultAbandonedSnapshotShare = 0.9
+)
+
+// AbandonedDatasetOptions tune FindAbandonedDatasets.
+type AbandonedDatasetOptions struct {
+	// MinAge is how long a dataset must have gone without a new snapshot;
+	// zero uses DefaultAbandonedMinAge.
+	MinAge time.Duration
+	// SnapshotShare is the share (0-1] of a dataset's used bytes its
+	// snapshots must hold; zero uses DefaultAbandonedSnapshotShare.
+	SnapshotShare float64
+}
+
+func (o AbandonedDatasetOptions) withDefaults() AbandonedDatasetOptions {
+	if o.MinAge <= 0 {
+		o.MinAge = DefaultAbandonedMinAge
+	}
+	if o.SnapshotShare <= 0 {
+		o.SnapshotShare = DefaultAbandonedSnapshotShare
+	}
+	return o
+}
+
+// AbandonedDataset is a managed dataset without a PV that lingers because
+// its snapshots hold data. Deleting Snapshots, oldest first, and then the
+// dataset reclaims ReclaimableBytes. Blockers say why it cannot be deleted
+// that way: a snapshot that is the origin of a clone, or child datasets,
+// which a non-recursive delete refuses.
+type AbandonedDataset struct {
+	Dataset           string    `json:"dataset"`
+	UsedBytes         int64     `json:"used_bytes"`
+	SnapshotUsedBytes int64     `json:"snapshot_used_bytes"`
+	ReclaimableBytes  int64     `json:"reclaimable_bytes"`
+	Snapshots         []string  `json:"snapshots"`
+	NewestSnapshotAt  time.Time `json:"newest_snapshot_at"`
+	Clones            []string  `json:"clones"`
+	Blockers          []string  `json:"blockers"`
+}
+
+// AbandonedDatasetReport lists abandoned datasets by reclaimable bytes,
+// largest first. ReclaimableBytes sums the datasets without blockers.
+type AbandonedDatasetReport struct {
+	Datasets         []AbandonedDataset `json:"datasets"`
+	ReclaimableBytes int64              `json:"reclaimable_bytes"`
+	Blocked          int                `json:"blocked"`
+}
+
+// Deletable returns the datasets without blockers.
+func (r *AbandonedDatasetReport) Deletable() []AbandonedDataset {
+	var deletable []AbandonedDataset
+	for _, dataset := range r.Datasets {
+		if len(dataset.Blockers) == 0 {
+			deletable = append(deletable, dataset)
+		}
+	}
+	return deletable
+}
+
+// Top returns a copy of the report listing only its first n datasets; the
+// totals still cover every dataset.
+func (r *AbandonedDatasetReport) Top(n int) *AbandonedDatasetReport {
+	top := *r
+	top.Datasets = r.Datasets[:min(n, len(r.Datasets))]
+	return &top
+}
+
+// FindAbandonedDatasets reports the direct children of the managed parent
+// datasets prefixes that no PV uses, whose snapshots hold at least the
+// configured share of their used bytes, and whose newest snapshot is at
+// least MinAge old. Snapshot usage is the dataset's usedbysnapshots, or the
+// sum of its snapshots' used bytes when TrueNAS did not report it, which
+// undercounts blocks several snapshots share. Datasets without a snapshot
+// creation time are skipped, since their age is unknown.
+func FindAbandonedDatasets(in Inputs, prefixes []string, now time.Time, opts AbandonedDatasetOptions) *AbandonedDatasetReport {
+	opts = opts.withDefaults()
+	report := &AbandonedDatasetReport{Datasets: []AbandonedDataset{}}
+
+	managed := make(map[string]bool, len(prefixes))
+	for _, prefix := range prefixes {
+		managed[strings.Trim(prefix, "/")] = true
+	}
+	volumesByName := make(map[string]truenas.Volume, len(in.Volumes))
+	for _, volume := range in.Volumes {
+		volumesByName[volume.Name] = volume
+	}
+	// A dataset is in use when orphan correlation matches a PV to it, or
+	// matchVolume does for volumes listed without an ID.
+	used := orphan.MatchedVolumeNames(in.PersistentVolumes, in.Volumes)
+	for _, pv := range in.PersistentVolumes {
+		if volume, ok := matchVolume(pv, in.Volumes, volumesByName); ok {
+			used[volume.Name] = true
+		}
+	}
+	// clones maps snapshots to the datasets cloned from them; children maps
+	// datasets to their child datasets.
+	clones := map[string][]string{}
+	children := map[string][]string{}
+	for _, volume := range in.Volumes {
+		if origin := volume.Properties[truenas.PropertyOrigin]; origin != "" {
+			clones[origin] = append(clones[origin], volume.Name)
+		}
+		children[path.Dir(volume.Name)] = append(children[path.Dir(volume.Name)], volume.Name)
+	}
+	snapshots := map[string][]truenas.Snapshot{}
+	for _, snapshot := range in.Snapshots {
+		dataset := snapshot.Dataset
+		if dataset == "" {
+			dataset, _, _ = strings.Cut(snapshot.Name, "@")
+		}
+		snapshots[dataset] = append(snapshots[dataset], snapshot)
+	}
+
+	for _, volume := range in.Volumes {
+		if !managed[path.Dir(volume.Name)] || used[volume.Name] || volume.Used <= 0 {
+			continue
+		}
+		owned := snapshots[volume.Name]
+		if len(owned) == 0 {
+			continue
+		}
+		sort.Slice(owned, func(i, j int) bool { return owned[i].CreatedAt.Before(owned[j].CreatedAt) })
+		newest := owned[len(owned)-1].CreatedAt
+		if newest.IsZero() || now.Sub(newest) < opts.MinAge {
+			continue
+		}
+		snapshotUsed := volume.UsedBySnapshots
+		if snapshotUsed <= 0 {
+			for _, snapshot := range owned {
+				snapshotUsed += snapshot.Used
+			}
+		}
+		if float64(snapshotUsed) < opts.SnapshotShare*float64(volume.Used) {
+			continue
+		}
+
+		dataset := AbandonedDataset{
+			Dataset:           volume.Name,
+			UsedBytes:         volume.Used,
+			SnapshotUsedBytes: snapshotUsed,
+			ReclaimableBytes:  volume.Used,
+			Snapshots:         make([]string, 0, len(owned)),
+			NewestSnapshotAt:  newest,
+			Clones:            []string{},
+			Blockers:          []string{},
+		}
+		for _, snapshot := range owned {
+			dataset.Snapshots = append(dataset.Snapshots, snapshot.Name)
+			for _, clone := range clones[snapshot.Name] {
+				dataset.Clones = append(dataset.Clones, clone)
+				dataset.Blockers = append(dataset.Blockers, fmt.Sprintf("snapshot %s is the origin of clone %s", snapshot.Name, clone))
+			}
+		}
+		if n := len(children[volume.Name]); n > 0 {
+			dataset.Blockers = append(dataset.Blockers, fmt.Sprintf("has %d child datasets", n))
+		}
+
+		report.Datasets = append(report.Datasets, dataset)
+		if len(dataset.Blockers) > 0 {
+			report.Blocked++
+		} else {
+			report.ReclaimableBytes += dataset.ReclaimableBytes
+		}
+	}
+	sort.Slice(report.Datasets, func(i, j int) bool {
+		a, b := report.Datasets[i], report.Datasets[j]
+		if a.ReclaimableBytes != b.ReclaimableBytes {
+			return a.ReclaimableBytes > b.ReclaimableBytes
+		}
+		return a.Dataset < b.Dataset
+	})
+	return report
+}
@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestFindAbandonedDatasets(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-90 * 24 * time.Hour)
+	snapshot := func(dataset, name string, created time.Time, used int64) truenas.Snapshot {
+		return truenas.Snapshot{Name: dataset + "@" + name, Dataset: dataset, CreatedAt: created, Used: used}
+	}
+	in := Inputs{
+		PersistentVolumes: []corev1.PersistentVolume{{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-live"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: "pvc-live"},
+			}},
+		}},
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/nfs/pvc-live", Used: 10 << 30, UsedBySnapshots: 10 << 30},
+			{Name: "tank/k8s/nfs/pvc-big", Used: 20 << 30, UsedBySnapshots: 19 << 30},
+			{Name: "tank/k8s/nfs/pvc-small", Used: 2 << 30},
+			{Name: "tank/k8s/nfs/pvc-data", Used: 8 << 30, UsedBySnapshots: 1 << 30},
+			{Name: "tank/k8s/nfs/pvc-recent", Used: 4 << 30, UsedBySnapshots: 4 << 30},
+			{Name: "tank/k8s/nfs/pvc-cloned", Used: 6 << 30, UsedBySnapshots: 6 << 30},
+			{Name: "tank/k8s/nfs/pvc-copy", Used: 1 << 20, Properties: map[string]string{truenas.PropertyOrigin: "tank/k8s/nfs/pvc-cloned@base"}},
+			{Name: "tank/home", Used: 50 << 30, UsedBySnapshots: 50 << 30},
+		},
+		Snapshots: []truenas.Snapshot{
+			snapshot("tank/k8s/nfs/pvc-live", "a", old, 0),
+			snapshot("tank/k8s/nfs/pvc-big", "b", old.Add(time.Hour), 0),
+			snapshot("tank/k8s/nfs/pvc-big", "a", old, 0),
+			// Without usedbysnapshots the snapshots' used bytes are summed.
+			snapshot("tank/k8s/nfs/pvc-small", "a", old, 1<<30),
+			snapshot("tank/k8s/nfs/pvc-small", "b", old, 1<<30),
+			snapshot("tank/k8s/nfs/pvc-data", "a", old, 0),
+			snapshot("tank/k8s/nfs/pvc-recent", "a", now.Add(-24*time.Hour), 0),
+			snapshot("tank/k8s/nfs/pvc-cloned", "base", old, 0),
+			snapshot("tank/home", "a", old, 0),
+		},
+	}
+
+	report := FindAbandonedDatasets(in, []string{"tank/k8s/nfs"}, now, AbandonedDatasetOptions{})
+	var names []string
+	for _, dataset := range report.Datasets {
+		names = append(names, dataset.Dataset)
+	}
+	if got, want := strings.Join(names, ","), "tank/k8s/nfs/pvc-big,tank/k8s/nfs/pvc-cloned,tank/k8s/nfs/pvc-small"; got != want {
+		t.Fatalf("abandoned datasets = %s, want %s", got, want)
+	}
+	big := report.Datasets[0]
+	if big.ReclaimableBytes != 20<<30 || strings.Join(big.Snapshots, ",") != "tank/k8s/nfs/pvc-big@a,tank/k8s/nfs/pvc-big@b" || len(big.Blockers) != 0 {
+		t.Fatalf("pvc-big = %+v, want its snapshots oldest first and no blockers", big)
+	}
+	cloned := report.Datasets[1]
+	if len(cloned.Clones) != 1 || cloned.Clones[0] != "tank/k8s/nfs/pvc-copy" || len(cloned.Blockers) != 1 {
+		t.Fatalf("pvc-cloned = %+v, want blocked by its clone", cloned)
+	}
+	if report.Blocked != 1 || report.ReclaimableBytes != 22<<30 {
+		t.Fatalf("blocked = %d, reclaimable = %d, want 1 and the unblocked 22GiB", report.Blocked, report.ReclaimableBytes)
+	}
+	if deletable := report.Deletable(); len(deletable) != 2 {
+		t.Fatalf("deletable = %+v, want pvc-big and pvc-small", deletable)
+	}
+	if top := report.Top(1); len(top.Datasets) != 1 || top.ReclaimableBytes != report.ReclaimableBytes || len(report.Datasets) != 3 {
+		t.Fatalf("Top(1) = %+v", top)
+	}
+}
+
+func TestFindAbandonedDatasets_MatchesIQNAndFullPathHandles(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-90 * 24 * time.Hour)
+	pv := func(name, driver, handle string) corev1.PersistentVolume {
+		return corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: handle},
+			}},
+		}
+	}
+	in := Inputs{
+		PersistentVolumes: []corev1.PersistentVolume{
+			pv("pvc-iscsi", "org.democratic-csi.iscsi", "iqn.2005-10.org.freenas.ctl:pvc-iscsi"),
+			pv("pvc-path", "org.democratic-csi.nfs", "/mnt/tank/k8s/pvc-path"),
+		},
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/pvc-iscsi", ID: "tank/k8s/pvc-iscsi", Used: 10 << 30, UsedBySnapshots: 10 << 30},
+			{Name: "tank/k8s/pvc-path", ID: "tank/k8s/pvc-path", Path: "/mnt/tank/k8s/pvc-path", Used: 10 << 30, UsedBySnapshots: 10 << 30},
+			{Name: "tank/k8s/pvc-gone", ID: "tank/k8s/pvc-gone", Used: 10 << 30, UsedBySnapshots: 10 << 30},
+		},
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pvc-iscsi@a", Dataset: "tank/k8s/pvc-iscsi", CreatedAt: old},
+			{Name: "tank/k8s/pvc-path@a", Dataset: "tank/k8s/pvc-path", CreatedAt: old},
+			{Name: "tank/k8s/pvc-gone@a", Dataset: "tank/k8s/pvc-gone", CreatedAt: old},
+		},
+	}
+
+	report := FindAbandonedDatasets(in, []string{"tank/k8s"}, now, AbandonedDatasetOptions{})
+	if len(report.Datasets) != 1 || report.Datasets[0].Dataset != "tank/k8s/pvc-gone" {
+		t.Fatalf("abandoned datasets = %+v, want only tank/k8s/pvc-gone; the IQN and full-path PVs use theirs", report.Datasets)
+	}
+}
@@ -0,0 +1,397 @@
+// Package analysis computes storage utilization and efficiency figures from
+// Kubernetes and TrueNAS inventories.
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Thresholds above which Compute adds a recommendation.
+const (
+	PoolUtilizationWarnPercent  = 80.0
+	ThinProvisioningWarnRatio   = 2.0
+	SnapshotOverheadWarnPercent = 30.0
+	LowCompressionRatio         = 1.1
+)
+
+// DefaultCacheTTL is how long an Analyzer reuses a computed analysis.
+const DefaultCacheTTL = 30 * time.Second
+
+// PoolUsage describes capacity usage of a single TrueNAS pool.
+type PoolUsage struct {
+	Name               string  `json:"name"`
+	Status             string  `json:"status"`
+	Health             string  `json:"health"`
+	Size               int64   `json:"size"`
+	Used               int64   `json:"used"`
+	Available          int64   `json:"available"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+// StorageAnalysis is the result of a storage analysis run.
+type StorageAnalysis struct {
+	// SchemaVersion is set by the API, which serves the analysis as
+	// schemas.StorageAnalysis; it is omitted inside reports.
+	SchemaVersion           int         `json:"schema_version,omitempty"`
+	Timestamp               time.Time   `json:"timestamp"`
+	Pools                   []PoolUsage `json:"pools"`
+	TotalRequestedBytes     int64       `json:"total_requested_bytes"`
+	TotalAllocatedBytes     int64       `json:"total_allocated_bytes"`
+	ThinProvisioningRatio   float64     `json:"thin_provisioning_ratio"`
+	CompressionRatio        float64     `json:"compression_ratio"`
+	SnapshotOverheadBytes   int64       `json:"snapshot_overhead_bytes"`
+	SnapshotOverheadPercent float64     `json:"snapshot_overhead_percent"`
+	// StorageEfficiency compares the used and requested capacity of the
+	// PVs with a correlated dataset.
+	StorageEfficiency StorageEfficiency `json:"storage_efficiency"`
+	// SnapshotAges counts TrueNAS snapshots per age bucket.
+	SnapshotAges    []SnapshotAgeCount `json:"snapshot_ages"`
+	Recommendations []string           `json:"recommendations"`
+	// Volumes lists PV datasets with their snapshot totals. I/O rates are
+	// only set when I/O statistics are enabled.
+	Volumes      []VolumeStats `json:"volumes,omitempty"`
+	IOStatsError string        `json:"io_stats_error,omitempty"`
+	// QuotaRecommendations is set when quota recommendations are enabled.
+	QuotaRecommendations []Recommendation `json:"quota_recommendations,omitempty"`
+	// SnapshotPolicies counts VolumeSnapshotContents by deletion policy.
+	// SnapshotPoliciesError is set when they could not be listed.
+	SnapshotPolicies      *SnapshotPolicyReport `json:"snapshot_policies,omitempty"`
+	SnapshotPoliciesError string                `json:"snapshot_policies_error,omitempty"`
+}
+
+// Inputs holds the inventories an analysis is computed from.
+type Inputs struct {
+	PersistentVolumes []corev1.PersistentVolume
+	Volumes           []truenas.Volume
+	Snapshots         []truenas.Snapshot
+	Pools             []truenas.Pool
+}
+
+// Compute derives a StorageAnalysis from the given inventories. Ratios that
+// cannot be computed from the inputs are reported as 0.
+func Compute(in Inputs, now time.Time) *StorageAnalysis {
+	return compute(in, now, SnapshotHeavyOptions{})
+}
+
+func compute(in Inputs, now time.Time, snapshotHeavy SnapshotHeavyOptions) *StorageAnalysis {
+	result := &StorageAnalysis{
+		Timestamp:       now,
+		Pools:           make([]PoolUsage, 0, len(in.Pools)),
+		Recommendations: []string{},
+	}
+
+	var poolUsed int64
+	for _, pool := range in.Pools {
+		poolUsed += pool.Used
+	}
+	result.Pools = append(result.Pools, PoolUsages(in.Pools)...)
+
+	volumesByName := make(map[string]truenas.Volume, len(in.Volumes))
+	for _, volume := range in.Volumes {
+		volumesByName[volume.Name] = volume
+	}
+
+	var compressedUsed int64
+	var weightedCompression float64
+	for _, pv := range in.PersistentVolumes {
+		if storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+			result.TotalRequestedBytes += storage.Value()
+		}
+		volume, ok := matchVolume(pv, in.Volumes, volumesByName)
+		if !ok {
+			continue
+		}
+		result.TotalAllocatedBytes += volume.Used
+		if ratio, ok := parseCompressRatio(volume.Properties["compressratio"]); ok && volume.Used > 0 {
+			compressedUsed += volume.Used
+			weightedCompression += ratio * float64(volume.Used)
+		}
+	}
+	if result.TotalAllocatedBytes > 0 {
+		result.ThinProvisioningRatio = float64(result.TotalRequestedBytes) / float64(result.TotalAllocatedBytes)
+	}
+	if compressedUsed > 0 {
+		result.CompressionRatio = weightedCompression / float64(compressedUsed)
+	}
+	result.StorageEfficiency = ComputeStorageEfficiency(in.PersistentVolumes, in.Volumes)
+
+	for _, snapshot := range in.Snapshots {
+		result.SnapshotOverheadBytes += snapshot.Used
+	}
+	totalUsed := poolUsed
+	if totalUsed == 0 {
+		totalUsed = rootDatasetUsage(in.Volumes)
+	}
+	if totalUsed > 0 {
+		result.SnapshotOverheadPercent = percent(result.SnapshotOverheadBytes, totalUsed)
+	}
+	result.SnapshotAges = SnapshotAgeDistribution(in.Snapshots, now, nil)
+	result.Volumes = VolumeIO(in, nil, IOThresholds{})
+
+	result.Recommendations = recommendations(result)
+	if rec, ok := snapshotHeavyRecommendation(result.Volumes, snapshotHeavy); ok {
+		result.Recommendations = append(result.Recommendations, rec)
+	}
+	return result
+}
+
+// PoolUsages converts TrueNAS pools to usage figures sorted by name. A pool
+// whose size is zero or was not reported has no utilization.
+func PoolUsages(pools []truenas.Pool) []PoolUsage {
+	usages := make([]PoolUsage, 0, len(pools))
+	for _, pool := range pools {
+		usage := PoolUsage{
+			Name:      pool.Name,
+			Status:    pool.Status,
+			Health:    pool.Health,
+			Size:      pool.Size,
+			Used:      pool.Used,
+			Available: pool.Available,
+		}
+		if pool.Size > 0 {
+			usage.UtilizationPercent = percent(pool.Used, pool.Size)
+		}
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Name < usages[j].Name })
+	return usages
+}
+
+func recommendations(result *StorageAnalysis) []string {
+	recs := []string{}
+	for _, pool := range result.Pools {
+		if pool.UtilizationPercent >= PoolUtilizationWarnPercent {
+			recs = append(recs, fmt.Sprintf(
+				"Pool %s is %s full; expand capacity or free space", pool.Name, humanize.Percent(pool.UtilizationPercent)))
+		}
+	}
+	if result.ThinProvisioningRatio >= ThinProvisioningWarnRatio {
+		recs = append(recs, fmt.Sprintf(
+			"Requested capacity is %.1fx the allocated space; watch for overcommit", result.ThinProvisioningRatio))
+	}
+	if result.SnapshotOverheadPercent >= SnapshotOverheadWarnPercent {
+		recs = append(recs, fmt.Sprintf(
+			"Snapshots consume %s of used space; review snapshot retention", humanize.Percent(result.SnapshotOverheadPercent)))
+	}
+	if result.CompressionRatio > 0 && result.CompressionRatio < LowCompressionRatio {
+		recs = append(recs, fmt.Sprintf(
+			"Compression ratio is %.2fx; check that compression is enabled on CSI datasets", result.CompressionRatio))
+	}
+	return recs
+}
+
+// matchVolume finds the TrueNAS dataset backing a democratic-csi PV.
+func matchVolume(pv corev1.PersistentVolume, volumes []truenas.Volume, byName map[string]truenas.Volume) (truenas.Volume, bool) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle == "" {
+		return truenas.Volume{}, false
+	}
+	handle := pv.Spec.CSI.VolumeHandle
+	if volume, ok := byName[handle]; ok {
+		return volume, true
+	}
+	for _, volume := range volumes {
+		if strings.HasSuffix(volume.Name, "/"+handle) {
+			return volume, true
+		}
+	}
+	return truenas.Volume{}, false
+}
+
+// rootDatasetUsage sums usage of top-level datasets, which already include
+// their children, so nested datasets are not counted twice.
+func rootDatasetUsage(volumes []truenas.Volume) int64 {
+	var total int64
+	for _, volume := range volumes {
+		if !strings.Contains(volume.Name, "/") {
+			total += volume.Used
+		}
+	}
+	return total
+}
+
+// parseCompressRatio parses ZFS compressratio values such as "1.52x" or "1.52".
+func parseCompressRatio(raw string) (float64, bool) {
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "x")
+	if raw == "" {
+		return 0, false
+	}
+	ratio, err := strconv.ParseFloat(raw, 64)
+	if err != nil || ratio <= 0 {
+		return 0, false
+	}
+	return ratio, true
+}
+
+func percent(part, whole int64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+// Analyzer gathers inventories from the clients and caches the computed
+// analysis for a short TTL so repeated API calls do not hit both backends.
+type Analyzer struct {
+	k8sClient     k8s.Client
+	truenasClient truenas.Client
+	ttl           time.Duration
+	ioStats       IOStatsOptions
+	quota         QuotaOptions
+	snapshotHeavy SnapshotHeavyOptions
+	ageBuckets    []time.Duration
+	clock         clock.Clock
+
+	mu       sync.Mutex
+	cached   *StorageAnalysis
+	cachedAt time.Time
+}
+
+// Options configures an Analyzer.
+type Options struct {
+	// CacheTTL defaults to DefaultCacheTTL. A negative value disables caching.
+	CacheTTL time.Duration
+	// IOStats adds per-volume I/O rates and temperatures to the analysis.
+	IOStats IOStatsOptions
+	// Quota adds refquota recommendations for PV datasets.
+	Quota QuotaOptions
+	// SnapshotHeavy tunes the snapshot-heavy volumes recommendation.
+	SnapshotHeavy SnapshotHeavyOptions
+	// SnapshotAgeBuckets are the ascending upper bounds of the snapshot age
+	// buckets. Nil uses DefaultSnapshotAgeBuckets.
+	SnapshotAgeBuckets []time.Duration
+	Clock              clock.Clock
+}
+
+// NewAnalyzer creates an Analyzer backed by the given clients.
+func NewAnalyzer(k8sClient k8s.Client, truenasClient truenas.Client, opts Options) *Analyzer {
+	ttl := opts.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Analyzer{
+		k8sClient:     k8sClient,
+		truenasClient: truenasClient,
+		ttl:           ttl,
+		ioStats:       opts.IOStats,
+		quota:         opts.Quota,
+		snapshotHeavy: opts.SnapshotHeavy,
+		ageBuckets:    opts.SnapshotAgeBuckets,
+		clock:         clock.OrReal(opts.Clock),
+	}
+}
+
+// Analyze returns a cached analysis when it is younger than the TTL and
+// otherwise gathers fresh inventories and recomputes it.
+func (a *Analyzer) Analyze(ctx context.Context) (*StorageAnalysis, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	if a.cached != nil && a.ttl > 0 && now.Sub(a.cachedAt) < a.ttl {
+		return a.cached, nil
+	}
+
+	in, err := Gather(ctx, a.k8sClient, a.truenasClient)
+	if err != nil {
+		return nil, err
+	}
+
+	a.cached = compute(in, now, a.snapshotHeavy)
+	if a.ageBuckets != nil {
+		a.cached.SnapshotAges = SnapshotAgeDistribution(in.Snapshots, now, a.ageBuckets)
+	}
+	if a.ioStats.Enabled {
+		a.attachIOStats(ctx, a.cached, in)
+	}
+	a.attachSnapshotPolicies(ctx, a.cached, in)
+	if a.quota.Enabled {
+		a.cached.QuotaRecommendations = QuotaRecommendations(in, a.quota)
+		a.cached.Recommendations = append(a.cached.Recommendations, poolQuotaRecommendations(a.cached.QuotaRecommendations)...)
+	}
+	a.cachedAt = now
+	return a.cached, nil
+}
+
+// attachIOStats adds volume I/O classification to result. A failure to
+// fetch statistics is reported in IOStatsError and leaves volumes unknown.
+func (a *Analyzer) attachIOStats(ctx context.Context, result *StorageAnalysis, in Inputs) {
+	window := a.ioStats.Window
+	if window <= 0 {
+		window = DefaultIOStatsWindow
+	}
+	stats, err := GatherIOStats(ctx, a.truenasClient, in, window)
+	if err != nil {
+		result.IOStatsError = err.Error()
+	}
+	result.Volumes = VolumeIO(in, stats, a.ioStats.Thresholds)
+	if rec, ok := unusedVolumesRecommendation(result.Volumes, window); ok {
+		result.Recommendations = append(result.Recommendations, rec)
+	}
+}
+
+// attachSnapshotPolicies adds the VolumeSnapshotContent deletion policy
+// report and its recommendations to result. A listing failure is reported
+// in SnapshotPoliciesError.
+func (a *Analyzer) attachSnapshotPolicies(ctx context.Context, result *StorageAnalysis, in Inputs) {
+	contents, err := a.k8sClient.ListVolumeSnapshotContents(ctx)
+	if err != nil {
+		result.SnapshotPoliciesError = err.Error()
+		return
+	}
+	classes, err := a.k8sClient.ListVolumeSnapshotClasses(ctx)
+	if err != nil {
+		result.SnapshotPoliciesError = err.Error()
+		return
+	}
+	result.SnapshotPolicies = CheckSnapshotPolicies(contents, classes, in.Snapshots)
+	result.Recommendations = append(result.Recommendations, result.SnapshotPolicies.Recommendations()...)
+}
+
+// Invalidate drops the cached analysis so the next Analyze recomputes it.
+func (a *Analyzer) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cached = nil
+	a.cachedAt = time.Time{}
+}
+
+// CachedAt returns when the cached analysis was computed, or the zero time
+// when nothing is cached.
+func (a *Analyzer) CachedAt() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cachedAt
+}
+
+// Gather lists the inventories an analysis is computed from.
+func Gather(ctx context.Context, k8sClient k8s.Client, truenasClient truenas.Client) (Inputs, error) {
+	var in Inputs
+	var err error
+
+	if in.PersistentVolumes, err = k8sClient.ListDemocraticCSIPersistentVolumes(ctx); err != nil {
+		return in, fmt.Errorf("failed to list democratic-csi PVs: %w", err)
+	}
+	if in.Volumes, err = truenasClient.ListVolumes(ctx); err != nil {
+		return in, fmt.Errorf("failed to list TrueNAS volumes: %w", err)
+	}
+	if in.Snapshots, err = truenasClient.ListSnapshots(ctx); err != nil {
+		return in, fmt.Errorf("failed to list TrueNAS snapshots: %w", err)
+	}
+	if in.Pools, err = truenasClient.ListPools(ctx); err != nil {
+		return in, fmt.Errorf("failed to list TrueNAS pools: %w", err)
+	}
+	return in, nil
+}
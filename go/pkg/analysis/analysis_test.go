@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+const gib = int64(1 << 30)
+
+func testPV(name, capacity string) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "org.democratic-csi.nfs",
+					VolumeHandle: name,
+				},
+			},
+		},
+	}
+}
+
+type pvLister struct {
+	k8s.Client
+	pvs             []corev1.PersistentVolume
+	contents        []snapshotv1.VolumeSnapshotContent
+	snapshotClasses []snapshotv1.VolumeSnapshotClass
+	err             error
+	calls           int
+}
+
+func (p *pvLister) ListDemocraticCSIPersistentVolumes(context.Context) ([]corev1.PersistentVolume, error) {
+	p.calls++
+	return p.pvs, p.err
+}
+
+func (p *pvLister) ListVolumeSnapshotContents(context.Context) ([]snapshotv1.VolumeSnapshotContent, error) {
+	return p.contents, nil
+}
+
+func (p *pvLister) ListVolumeSnapshotClasses(context.Context) ([]snapshotv1.VolumeSnapshotClass, error) {
+	return p.snapshotClasses, nil
+}
+
+func TestCompute(t *testing.T) {
+	in := Inputs{
+		PersistentVolumes: []corev1.PersistentVolume{
+			testPV("pvc-a", "100Gi"),
+			testPV("pvc-b", "100Gi"),
+			testPV("pvc-unmatched", "50Gi"),
+		},
+		Volumes: []truenas.Volume{
+			{Name: "tank", Used: 100 * gib},
+			{Name: "tank/k8s/pvc-a", Used: 30 * gib, Properties: map[string]string{"compressratio": "2.00x"}},
+			{Name: "tank/k8s/pvc-b", Used: 10 * gib, Properties: map[string]string{"compressratio": "1.00"}},
+		},
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pvc-a@daily", Used: 20 * gib},
+			{Name: "tank/k8s/pvc-b@daily", Used: 20 * gib},
+		},
+		Pools: []truenas.Pool{
+			{Name: "tank", Size: 100 * gib, Used: 90 * gib, Available: 10 * gib, Health: "ONLINE"},
+		},
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	result := Compute(in, now)
+
+	if len(result.Pools) != 1 || result.Pools[0].UtilizationPercent != 90 {
+		t.Fatalf("unexpected pools: %+v", result.Pools)
+	}
+	if result.TotalRequestedBytes != 250*gib {
+		t.Fatalf("requested = %d, want %d", result.TotalRequestedBytes, 250*gib)
+	}
+	if result.TotalAllocatedBytes != 40*gib {
+		t.Fatalf("allocated = %d, want %d", result.TotalAllocatedBytes, 40*gib)
+	}
+	if result.ThinProvisioningRatio != 6.25 {
+		t.Fatalf("thin provisioning ratio = %v, want 6.25", result.ThinProvisioningRatio)
+	}
+	if result.CompressionRatio != 1.75 {
+		t.Fatalf("compression ratio = %v, want 1.75", result.CompressionRatio)
+	}
+	if result.SnapshotOverheadBytes != 40*gib {
+		t.Fatalf("snapshot overhead = %d, want %d", result.SnapshotOverheadBytes, 40*gib)
+	}
+	if got := result.SnapshotOverheadPercent; got < 44.4 || got > 44.5 {
+		t.Fatalf("snapshot overhead percent = %v, want ~44.4", got)
+	}
+	if len(result.Recommendations) != 4 {
+		t.Fatalf("expected pool, thin-provisioning, snapshot and snapshot-heavy recommendations, got %v", result.Recommendations)
+	}
+	if len(result.Volumes) != 2 || result.Volumes[0].SnapshotCount != 1 {
+		t.Fatalf("expected two volumes with snapshot totals, got %+v", result.Volumes)
+	}
+	if !result.Timestamp.Equal(now) {
+		t.Fatalf("timestamp = %v, want %v", result.Timestamp, now)
+	}
+}
+
+func TestCompute_EmptyInputsHaveZeroRatios(t *testing.T) {
+	result := Compute(Inputs{}, time.Now())
+	if result.ThinProvisioningRatio != 0 || result.CompressionRatio != 0 || result.SnapshotOverheadPercent != 0 {
+		t.Fatalf("expected zero ratios for empty inputs, got %+v", result)
+	}
+	if result.Recommendations == nil || len(result.Recommendations) != 0 {
+		t.Fatalf("expected empty, non-nil recommendations, got %v", result.Recommendations)
+	}
+}
+
+func TestParseCompressRatio(t *testing.T) {
+	cases := map[string]float64{"1.52x": 1.52, "2.00": 2, " 1.10x ": 1.1}
+	for raw, want := range cases {
+		got, ok := parseCompressRatio(raw)
+		if !ok || got != want {
+			t.Fatalf("parseCompressRatio(%q) = %v, %v; want %v", raw, got, ok, want)
+		}
+	}
+	for _, raw := range []string{"", "x", "n/a", "0"} {
+		if _, ok := parseCompressRatio(raw); ok {
+			t.Fatalf("parseCompressRatio(%q) should fail", raw)
+		}
+	}
+}
+
+func TestAnalyzer_CachesWithinTTL(t *testing.T) {
+	k8sClient := &pvLister{pvs: []corev1.PersistentVolume{testPV("pvc-a", "1Gi")}}
+	truenasClient := &truenastest.Client{}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	analyzer := NewAnalyzer(k8sClient, truenasClient, Options{CacheTTL: time.Minute, Clock: fake})
+
+	if _, err := analyzer.Analyze(context.Background()); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	fake.Advance(30 * time.Second)
+	if _, err := analyzer.Analyze(context.Background()); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if k8sClient.calls != 1 || truenasClient.Calls("ListPools") != 1 {
+		t.Fatalf("expected cached result within TTL, got %d k8s / %d pool calls",
+			k8sClient.calls, truenasClient.Calls("ListPools"))
+	}
+
+	fake.Advance(time.Minute)
+	if _, err := analyzer.Analyze(context.Background()); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if k8sClient.calls != 2 {
+		t.Fatalf("expected refresh after TTL, got %d k8s calls", k8sClient.calls)
+	}
+}
+
+func TestAnalyzer_InvalidateForcesRecompute(t *testing.T) {
+	k8sClient := &pvLister{pvs: []corev1.PersistentVolume{testPV("pvc-a", "1Gi")}}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	analyzer := NewAnalyzer(k8sClient, &truenastest.Client{}, Options{CacheTTL: time.Minute, Clock: fake})
+
+	if _, err := analyzer.Analyze(context.Background()); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if !analyzer.CachedAt().Equal(fake.Now()) {
+		t.Fatalf("CachedAt = %v, want %v", analyzer.CachedAt(), fake.Now())
+	}
+
+	analyzer.Invalidate()
+	if !analyzer.CachedAt().IsZero() {
+		t.Fatalf("CachedAt after Invalidate = %v, want zero", analyzer.CachedAt())
+	}
+	if _, err := analyzer.Analyze(context.Background()); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if k8sClient.calls != 2 {
+		t.Fatalf("expected recompute after Invalidate, got %d k8s calls", k8sClient.calls)
+	}
+}
+
+func TestAnalyzer_PropagatesClientErrors(t *testing.T) {
+	analyzer := NewAnalyzer(
+		&pvLister{},
+		&truenastest.Client{ListPoolsErr: errors.New("pool query failed")},
+		Options{},
+	)
+
+	if _, err := analyzer.Analyze(context.Background()); err == nil {
+		t.Fatal("expected error when TrueNAS pool listing fails")
+	}
+}
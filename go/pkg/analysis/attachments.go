@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+)
+
+// Volume attachment finding kinds.
+const (
+	// AttachmentMultiAttached is a PV with more than one VolumeAttachment.
+	AttachmentMultiAttached = "multi_attached"
+	// AttachmentStale is a VolumeAttachment to a NotReady or missing node.
+	AttachmentStale = "stale_attachment"
+)
+
+// VolumeAttachmentInfo is one VolumeAttachment with its PV and node.
+type VolumeAttachmentInfo struct {
+	Name             string `json:"name"`
+	Attacher         string `json:"attacher"`
+	PersistentVolume string `json:"persistent_volume,omitempty"`
+	Node             string `json:"node"`
+	// NodeReady is false for NotReady nodes and nodes that no longer exist.
+	NodeReady   bool          `json:"node_ready"`
+	NodeMissing bool          `json:"node_missing,omitempty"`
+	Attached    bool          `json:"attached"`
+	AttachError string        `json:"attach_error,omitempty"`
+	DetachError string        `json:"detach_error,omitempty"`
+	Deleting    bool          `json:"deleting,omitempty"`
+	Age         time.Duration `json:"age"`
+}
+
+// AttachmentFinding is a PV attached to several nodes or an attachment to
+// a node that is NotReady or gone, the usual causes of Multi-Attach errors.
+type AttachmentFinding struct {
+	Kind             string `json:"kind"`
+	PersistentVolume string `json:"persistent_volume"`
+	// Attachments are the VolumeAttachment names involved.
+	Attachments []string `json:"attachments"`
+	Nodes       []string `json:"nodes"`
+	Message     string   `json:"message"`
+	// Remediation is what to do on the Kubernetes side.
+	Remediation string `json:"remediation"`
+}
+
+// VolumeAttachmentReport lists VolumeAttachments and the stuck ones.
+type VolumeAttachmentReport struct {
+	Attachments []VolumeAttachmentInfo `json:"attachments"`
+	Findings    []AttachmentFinding    `json:"findings"`
+	// MultiAttached and Stale count the findings of each kind.
+	MultiAttached int `json:"multi_attached"`
+	Stale         int `json:"stale"`
+}
+
+// CheckVolumeAttachments lists what BuildVolumeAttachmentReport needs and
+// builds the report.
+func CheckVolumeAttachments(ctx context.Context, k8sClient k8s.Client, now time.Time) (*VolumeAttachmentReport, error) {
+	attachments, err := k8sClient.ListVolumeAttachments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume attachments: %w", err)
+	}
+	nodes, err := k8sClient.ListNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return BuildVolumeAttachmentReport(attachments, nodes, now), nil
+}
+
+// BuildVolumeAttachmentReport lists every VolumeAttachment with its PV, node
+// and attach status, and flags PVs with more than one attachment and
+// attachments to nodes that are NotReady or no longer exist. Attachments and
+// findings are sorted by PV, then by name.
+func BuildVolumeAttachmentReport(attachments []storagev1.VolumeAttachment, nodes []corev1.Node, now time.Time) *VolumeAttachmentReport {
+	report := &VolumeAttachmentReport{Attachments: []VolumeAttachmentInfo{}, Findings: []AttachmentFinding{}}
+
+	ready := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		ready[node.Name] = nodeReady(node)
+	}
+
+	byPV := make(map[string][]VolumeAttachmentInfo)
+	for _, attachment := range attachments {
+		nodeIsReady, nodeExists := ready[attachment.Spec.NodeName]
+		info := VolumeAttachmentInfo{
+			Name:        attachment.Name,
+			Attacher:    attachment.Spec.Attacher,
+			Node:        attachment.Spec.NodeName,
+			NodeReady:   nodeIsReady,
+			NodeMissing: !nodeExists,
+			Attached:    attachment.Status.Attached,
+			Deleting:    attachment.DeletionTimestamp != nil,
+			Age:         now.Sub(attachment.CreationTimestamp.Time),
+		}
+		if source := attachment.Spec.Source.PersistentVolumeName; source != nil {
+			info.PersistentVolume = *source
+		}
+		if attachErr := attachment.Status.AttachError; attachErr != nil {
+			info.AttachError = attachErr.Message
+		}
+		if detachErr := attachment.Status.DetachError; detachErr != nil {
+			info.DetachError = detachErr.Message
+		}
+		report.Attachments = append(report.Attachments, info)
+		if info.PersistentVolume != "" {
+			byPV[info.PersistentVolume] = append(byPV[info.PersistentVolume], info)
+		}
+	}
+	sort.Slice(report.Attachments, func(i, j int) bool {
+		a, b := report.Attachments[i], report.Attachments[j]
+		if a.PersistentVolume != b.PersistentVolume {
+			return a.PersistentVolume < b.PersistentVolume
+		}
+		return a.Name < b.Name
+	})
+
+	pvNames := make([]string, 0, len(byPV))
+	for pv := range byPV {
+		pvNames = append(pvNames, pv)
+	}
+	sort.Strings(pvNames)
+
+	for _, pv := range pvNames {
+		infos := byPV[pv]
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+		if len(infos) > 1 {
+			finding := AttachmentFinding{Kind: AttachmentMultiAttached, PersistentVolume: pv}
+			for _, info := range infos {
+				finding.Attachments = append(finding.Attachments, info.Name)
+				finding.Nodes = append(finding.Nodes, info.Node)
+			}
+			finding.Message = fmt.Sprintf("PV %s has %d VolumeAttachments, to nodes %v; a ReadWriteOnce volume fails to attach elsewhere with a Multi-Attach error", pv, len(infos), finding.Nodes)
+			finding.Remediation = "Find the attachment whose node no longer runs a pod using the PV (kubectl get volumeattachment); after confirming that node is gone or the volume is unmounted there, delete that VolumeAttachment"
+			report.Findings = append(report.Findings, finding)
+			report.MultiAttached++
+		}
+
+		for _, info := range infos {
+			if info.NodeReady {
+				continue
+			}
+			state := "NotReady"
+			if info.NodeMissing {
+				state = "missing"
+			}
+			report.Findings = append(report.Findings, AttachmentFinding{
+				Kind:             AttachmentStale,
+				PersistentVolume: pv,
+				Attachments:      []string{info.Name},
+				Nodes:            []string{info.Node},
+				Message:          fmt.Sprintf("VolumeAttachment %s attaches PV %s to node %s, which is %s", info.Name, pv, info.Node, state),
+				Remediation:      fmt.Sprintf("Confirm node %s is gone or powered off (kubectl get node %s), then delete VolumeAttachment %s so the volume can attach to another node", info.Node, info.Node, info.Name),
+			})
+			report.Stale++
+		}
+	}
+	return report
+}
+
+// nodeReady reports whether the node's Ready condition is True.
+func nodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
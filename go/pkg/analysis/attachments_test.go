@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+)
+
+func readyNode(name string, ready corev1.ConditionStatus) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: ready},
+		}},
+	}
+}
+
+func TestCheckVolumeAttachments_FlagsMultiAttachedAndStale(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	moved := attachment("pv-a", "worker-2", false)
+	moved.Name = "csi-pv-a-2"
+	moved.Status.AttachError = &storagev1.VolumeError{Message: "Multi-Attach error"}
+	old := attachment("pv-a", "worker-1", true)
+	old.CreationTimestamp = metav1.NewTime(now.Add(-2 * time.Hour))
+	k8sClient := &k8stest.Client{
+		VolumeAttachments: []storagev1.VolumeAttachment{
+			moved,
+			old,
+			attachment("pv-b", "worker-2", true),
+			attachment("pv-c", "worker-gone", true),
+		},
+		Nodes: []corev1.Node{
+			readyNode("worker-1", corev1.ConditionFalse),
+			readyNode("worker-2", corev1.ConditionTrue),
+		},
+	}
+
+	report, err := CheckVolumeAttachments(context.Background(), k8sClient, now)
+	if err != nil {
+		t.Fatalf("CheckVolumeAttachments: %v", err)
+	}
+
+	if len(report.Attachments) != 4 {
+		t.Fatalf("attachments = %+v, want 4", report.Attachments)
+	}
+	first := report.Attachments[0]
+	if first.Name != "csi-pv-a" || first.Node != "worker-1" || first.NodeReady || !first.Attached || first.Age != 2*time.Hour {
+		t.Fatalf("first attachment = %+v, want csi-pv-a on NotReady worker-1, attached 2h ago", first)
+	}
+	if report.Attachments[1].AttachError != "Multi-Attach error" {
+		t.Fatalf("attach error = %q, want the VolumeAttachment status message", report.Attachments[1].AttachError)
+	}
+	if !report.Attachments[3].NodeMissing {
+		t.Fatalf("attachment to worker-gone = %+v, want node_missing", report.Attachments[3])
+	}
+
+	if report.MultiAttached != 1 || report.Stale != 2 {
+		t.Fatalf("multi-attached = %d, stale = %d, want 1 and 2", report.MultiAttached, report.Stale)
+	}
+	want := []struct{ kind, pv, node string }{
+		{AttachmentMultiAttached, "pv-a", "worker-1"},
+		{AttachmentStale, "pv-a", "worker-1"},
+		{AttachmentStale, "pv-c", "worker-gone"},
+	}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("findings = %+v, want %d", report.Findings, len(want))
+	}
+	for i, w := range want {
+		finding := report.Findings[i]
+		if finding.Kind != w.kind || finding.PersistentVolume != w.pv || finding.Nodes[0] != w.node || finding.Remediation == "" {
+			t.Fatalf("finding %d = %+v, want %s of %s on %s with a remediation", i, finding, w.kind, w.pv, w.node)
+		}
+	}
+	if got := report.Findings[0].Attachments; len(got) != 2 {
+		t.Fatalf("multi-attach attachments = %v, want both", got)
+	}
+}
+
+func TestCheckVolumeAttachments_NodeListError(t *testing.T) {
+	k8sClient := &k8stest.Client{ListNodesErr: context.DeadlineExceeded}
+	if _, err := CheckVolumeAttachments(context.Background(), k8sClient, time.Now()); err == nil {
+		t.Fatal("CheckVolumeAttachments succeeded, want the node list error")
+	}
+}
@@ -0,0 +1,319 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// BackupCoverageAlertCategory is the alert category used for namespaces
+// whose backup coverage is below the configured floor.
+const BackupCoverageAlertCategory = "backup_coverage"
+
+// DefaultBackupMaxAge is how old the newest VolumeSnapshot of a covered
+// claim may be when a policy sets no MaxAge.
+const DefaultBackupMaxAge = 24 * time.Hour
+
+// BackupCoveragePolicy selects claims that must have a recent VolumeSnapshot.
+type BackupCoveragePolicy struct {
+	// Namespaces are path.Match patterns; empty selects every namespace.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Labels select claims carrying all of them; empty selects every claim.
+	Labels map[string]string `json:"labels,omitempty"`
+	// MaxAge is how old the newest ready VolumeSnapshot may be; zero uses
+	// DefaultBackupMaxAge.
+	MaxAge time.Duration `json:"max_age"`
+}
+
+func (p BackupCoveragePolicy) selects(pvc corev1.PersistentVolumeClaim) bool {
+	if len(p.Namespaces) > 0 {
+		matched := false
+		for _, pattern := range p.Namespaces {
+			if ok, _ := path.Match(pattern, pvc.Namespace); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for key, value := range p.Labels {
+		if pvc.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// BackupCoverageOptions configure CheckBackupCoverage.
+type BackupCoverageOptions struct {
+	Policies []BackupCoveragePolicy
+	// FloorPercent marks namespaces whose coverage is below it; zero marks
+	// none.
+	FloorPercent float64
+}
+
+// BackupCoverageInputs holds the inventories backup coverage is checked
+// against.
+type BackupCoverageInputs struct {
+	Claims                 []corev1.PersistentVolumeClaim
+	PersistentVolumes      []corev1.PersistentVolume
+	VolumeSnapshots        []snapshotv1.VolumeSnapshot
+	VolumeSnapshotContents []snapshotv1.VolumeSnapshotContent
+	Volumes                []truenas.Volume
+	Snapshots              []truenas.Snapshot
+}
+
+// GatherBackupCoverage lists the inventories CheckBackupCoverage needs.
+func GatherBackupCoverage(ctx context.Context, k8sClient k8s.Client, truenasClient truenas.Client) (BackupCoverageInputs, error) {
+	var in BackupCoverageInputs
+	var err error
+
+	if in.Claims, err = k8sClient.ListPersistentVolumeClaims(ctx, ""); err != nil {
+		return in, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	if in.PersistentVolumes, err = k8sClient.ListDemocraticCSIPersistentVolumes(ctx); err != nil {
+		return in, fmt.Errorf("failed to list democratic-csi PVs: %w", err)
+	}
+	if in.VolumeSnapshots, err = k8sClient.ListVolumeSnapshots(ctx, ""); err != nil {
+		return in, fmt.Errorf("failed to list volume snapshots: %w", err)
+	}
+	if in.VolumeSnapshotContents, err = k8sClient.ListVolumeSnapshotContents(ctx); err != nil {
+		return in, fmt.Errorf("failed to list volume snapshot contents: %w", err)
+	}
+	if in.Volumes, err = truenasClient.ListVolumes(ctx); err != nil {
+		return in, fmt.Errorf("failed to list TrueNAS volumes: %w", err)
+	}
+	if in.Snapshots, err = truenasClient.ListSnapshots(ctx); err != nil {
+		return in, fmt.Errorf("failed to list TrueNAS snapshots: %w", err)
+	}
+	return in, nil
+}
+
+// NamespaceBackupCoverage is the share of a namespace's selected claims that
+// have a recent VolumeSnapshot.
+type NamespaceBackupCoverage struct {
+	Namespace  string  `json:"namespace"`
+	Claims     int     `json:"claims"`
+	Covered    int     `json:"covered"`
+	Percent    float64 `json:"percent"`
+	BelowFloor bool    `json:"below_floor"`
+}
+
+// UncoveredClaim is a selected claim without a recent ready VolumeSnapshot.
+type UncoveredClaim struct {
+	Namespace        string        `json:"namespace"`
+	Claim            string        `json:"claim"`
+	PersistentVolume string        `json:"persistent_volume"`
+	MaxAge           time.Duration `json:"max_age"`
+	NewestSnapshot   *time.Time    `json:"newest_snapshot,omitempty"`
+	Reason           string        `json:"reason"`
+}
+
+// CSIBypassDataset is the dataset of a selected claim that has ZFS snapshots
+// but no snapshot Kubernetes knows of: backups taken on TrueNAS, bypassing
+// the CSI driver, that cannot be restored through a VolumeSnapshot.
+type CSIBypassDataset struct {
+	Namespace         string     `json:"namespace"`
+	Claim             string     `json:"claim"`
+	PersistentVolume  string     `json:"persistent_volume"`
+	Dataset           string     `json:"dataset"`
+	ZFSSnapshots      int        `json:"zfs_snapshots"`
+	NewestZFSSnapshot *time.Time `json:"newest_zfs_snapshot,omitempty"`
+}
+
+// BackupCoverageReport is the result of checking backup coverage.
+type BackupCoverageReport struct {
+	Timestamp    time.Time                 `json:"timestamp"`
+	FloorPercent float64                   `json:"floor_percent"`
+	Namespaces   []NamespaceBackupCoverage `json:"namespaces"`
+	Uncovered    []UncoveredClaim          `json:"uncovered"`
+	CSIBypass    []CSIBypassDataset        `json:"csi_bypass"`
+}
+
+// BelowFloor returns the namespaces whose coverage is below the floor.
+func (r *BackupCoverageReport) BelowFloor() []NamespaceBackupCoverage {
+	var below []NamespaceBackupCoverage
+	for _, namespace := range r.Namespaces {
+		if namespace.BelowFloor {
+			below = append(below, namespace)
+		}
+	}
+	return below
+}
+
+// CheckBackupCoverage reports, per namespace, the share of the claims bound
+// to democratic-csi PVs that a policy selects and whose newest ready
+// VolumeSnapshot is within the policy's MaxAge; a claim several policies
+// select must meet the smallest MaxAge. It separately lists the selected
+// claims whose dataset has ZFS snapshots but which neither have a
+// VolumeSnapshot nor a VolumeSnapshotContent on the dataset. Claims whose
+// PV is not managed by democratic-csi are not checked.
+func CheckBackupCoverage(in BackupCoverageInputs, now time.Time, opts BackupCoverageOptions) *BackupCoverageReport {
+	report := &BackupCoverageReport{
+		Timestamp:    now,
+		FloorPercent: opts.FloorPercent,
+		Namespaces:   []NamespaceBackupCoverage{},
+		Uncovered:    []UncoveredClaim{},
+		CSIBypass:    []CSIBypassDataset{},
+	}
+
+	pvs := make(map[string]corev1.PersistentVolume, len(in.PersistentVolumes))
+	for _, pv := range in.PersistentVolumes {
+		pvs[pv.Name] = pv
+	}
+	volumesByName := make(map[string]truenas.Volume, len(in.Volumes))
+	for _, volume := range in.Volumes {
+		volumesByName[volume.Name] = volume
+	}
+	// snapshotted counts the VolumeSnapshots of each claim and newest holds
+	// the creation time of its newest ready one.
+	snapshotted := map[string]int{}
+	newest := map[string]time.Time{}
+	for _, snapshot := range in.VolumeSnapshots {
+		claim := snapshot.Spec.Source.PersistentVolumeClaimName
+		if claim == nil {
+			continue
+		}
+		key := snapshot.Namespace + "/" + *claim
+		snapshotted[key]++
+		status := snapshot.Status
+		if status == nil || status.ReadyToUse == nil || !*status.ReadyToUse {
+			continue
+		}
+		created := snapshot.CreationTimestamp.Time
+		if status.CreationTime != nil {
+			created = status.CreationTime.Time
+		}
+		if created.After(newest[key]) {
+			newest[key] = created
+		}
+	}
+	contentDatasets := map[string]bool{}
+	for _, content := range in.VolumeSnapshotContents {
+		if dataset, _, ok := strings.Cut(snapshotContentHandle(content), "@"); ok {
+			contentDatasets[dataset] = true
+		}
+	}
+	zfsSnapshots := map[string][]truenas.Snapshot{}
+	for _, snapshot := range in.Snapshots {
+		dataset := snapshot.Dataset
+		if dataset == "" {
+			dataset, _, _ = strings.Cut(snapshot.Name, "@")
+		}
+		zfsSnapshots[dataset] = append(zfsSnapshots[dataset], snapshot)
+	}
+
+	byNamespace := map[string]*NamespaceBackupCoverage{}
+	for _, pvc := range in.Claims {
+		pv, ok := pvs[pvc.Spec.VolumeName]
+		if !ok {
+			continue
+		}
+		maxAge := time.Duration(0)
+		for _, policy := range opts.Policies {
+			if !policy.selects(pvc) {
+				continue
+			}
+			policyMaxAge := policy.MaxAge
+			if policyMaxAge <= 0 {
+				policyMaxAge = DefaultBackupMaxAge
+			}
+			if maxAge == 0 || policyMaxAge < maxAge {
+				maxAge = policyMaxAge
+			}
+		}
+		if maxAge == 0 {
+			continue
+		}
+
+		namespace := byNamespace[pvc.Namespace]
+		if namespace == nil {
+			namespace = &NamespaceBackupCoverage{Namespace: pvc.Namespace}
+			byNamespace[pvc.Namespace] = namespace
+		}
+		namespace.Claims++
+
+		key := pvc.Namespace + "/" + pvc.Name
+		switch newestAt, ready := newest[key]; {
+		case ready && now.Sub(newestAt) <= maxAge:
+			namespace.Covered++
+		case ready:
+			report.Uncovered = append(report.Uncovered, UncoveredClaim{
+				Namespace:        pvc.Namespace,
+				Claim:            pvc.Name,
+				PersistentVolume: pv.Name,
+				MaxAge:           maxAge,
+				NewestSnapshot:   &newestAt,
+				Reason: fmt.Sprintf("newest ready VolumeSnapshot is %s old, more than %s",
+					humanize.Duration(now.Sub(newestAt)), humanize.Duration(maxAge)),
+			})
+		default:
+			reason := "no VolumeSnapshot"
+			if snapshotted[key] > 0 {
+				reason = fmt.Sprintf("none of its %d VolumeSnapshots is ready", snapshotted[key])
+			}
+			report.Uncovered = append(report.Uncovered, UncoveredClaim{
+				Namespace:        pvc.Namespace,
+				Claim:            pvc.Name,
+				PersistentVolume: pv.Name,
+				MaxAge:           maxAge,
+				Reason:           reason,
+			})
+		}
+
+		volume, ok := matchVolume(pv, in.Volumes, volumesByName)
+		if !ok || snapshotted[key] > 0 || contentDatasets[volume.Name] || len(zfsSnapshots[volume.Name]) == 0 {
+			continue
+		}
+		bypass := CSIBypassDataset{
+			Namespace:        pvc.Namespace,
+			Claim:            pvc.Name,
+			PersistentVolume: pv.Name,
+			Dataset:          volume.Name,
+			ZFSSnapshots:     len(zfsSnapshots[volume.Name]),
+		}
+		for _, snapshot := range zfsSnapshots[volume.Name] {
+			if !snapshot.CreatedAt.IsZero() && (bypass.NewestZFSSnapshot == nil || snapshot.CreatedAt.After(*bypass.NewestZFSSnapshot)) {
+				createdAt := snapshot.CreatedAt
+				bypass.NewestZFSSnapshot = &createdAt
+			}
+		}
+		report.CSIBypass = append(report.CSIBypass, bypass)
+	}
+
+	for _, namespace := range byNamespace {
+		namespace.Percent = float64(namespace.Covered) / float64(namespace.Claims) * 100
+		namespace.BelowFloor = namespace.Percent < opts.FloorPercent
+		report.Namespaces = append(report.Namespaces, *namespace)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+	sort.Slice(report.Uncovered, func(i, j int) bool {
+		a, b := report.Uncovered[i], report.Uncovered[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Claim < b.Claim
+	})
+	sort.Slice(report.CSIBypass, func(i, j int) bool {
+		a, b := report.CSIBypass[i], report.CSIBypass[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Claim < b.Claim
+	})
+	return report
+}
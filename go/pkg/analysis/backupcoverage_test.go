@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestCheckBackupCoverage(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	ready, notReady := true, false
+	claim := func(namespace, name string, labels map[string]string) corev1.PersistentVolumeClaim {
+		return corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-" + name},
+		}
+	}
+	pv := func(name string) corev1.PersistentVolume {
+		return corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + name},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: "pv-" + name},
+			}},
+		}
+	}
+	volumeSnapshot := func(namespace, claim string, created time.Time, readyToUse *bool) snapshotv1.VolumeSnapshot {
+		return snapshotv1.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: claim + "-snap"},
+			Spec:       snapshotv1.VolumeSnapshotSpec{Source: snapshotv1.VolumeSnapshotSource{PersistentVolumeClaimName: &claim}},
+			Status:     &snapshotv1.VolumeSnapshotStatus{ReadyToUse: readyToUse, CreationTime: &metav1.Time{Time: created}},
+		}
+	}
+	handle := "tank/k8s/pv-tracked@snapshot-1"
+
+	in := BackupCoverageInputs{
+		Claims: []corev1.PersistentVolumeClaim{
+			claim("prod-a", "fresh", nil),
+			claim("prod-a", "stale", nil),
+			claim("prod-a", "unready", nil),
+			claim("prod-a", "bypassed", nil),
+			claim("prod-a", "tracked", nil),
+			claim("prod-a", "unbound", nil),
+			claim("dev", "labeled", map[string]string{"backup": "required"}),
+			claim("dev", "unlabeled", nil),
+		},
+		PersistentVolumes: []corev1.PersistentVolume{
+			pv("fresh"), pv("stale"), pv("unready"), pv("bypassed"), pv("tracked"), pv("labeled"), pv("unlabeled"),
+		},
+		VolumeSnapshots: []snapshotv1.VolumeSnapshot{
+			volumeSnapshot("prod-a", "fresh", now.Add(-time.Hour), &ready),
+			volumeSnapshot("prod-a", "stale", now.Add(-30*time.Hour), &ready),
+			volumeSnapshot("prod-a", "unready", now.Add(-time.Hour), &notReady),
+			volumeSnapshot("dev", "labeled", now.Add(-2*time.Hour), &ready),
+		},
+		VolumeSnapshotContents: []snapshotv1.VolumeSnapshotContent{{
+			ObjectMeta: metav1.ObjectMeta{Name: "imported"},
+			Spec:       snapshotv1.VolumeSnapshotContentSpec{Source: snapshotv1.VolumeSnapshotContentSource{SnapshotHandle: &handle}},
+		}},
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/pv-fresh"}, {Name: "tank/k8s/pv-stale"}, {Name: "tank/k8s/pv-unready"},
+			{Name: "tank/k8s/pv-bypassed"}, {Name: "tank/k8s/pv-tracked"}, {Name: "tank/k8s/pv-labeled"},
+		},
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pv-fresh@snapshot-1", Dataset: "tank/k8s/pv-fresh", CreatedAt: now.Add(-time.Hour)},
+			{Name: "tank/k8s/pv-bypassed@auto-1", Dataset: "tank/k8s/pv-bypassed", CreatedAt: now.Add(-48 * time.Hour)},
+			{Name: "tank/k8s/pv-bypassed@auto-2", Dataset: "tank/k8s/pv-bypassed", CreatedAt: now.Add(-24 * time.Hour)},
+			{Name: "tank/k8s/pv-tracked@snapshot-1", Dataset: "tank/k8s/pv-tracked", CreatedAt: now.Add(-time.Hour)},
+		},
+	}
+	report := CheckBackupCoverage(in, now, BackupCoverageOptions{
+		Policies: []BackupCoveragePolicy{
+			{Namespaces: []string{"prod-*"}},
+			{Labels: map[string]string{"backup": "required"}, MaxAge: time.Hour},
+		},
+		FloorPercent: 50,
+	})
+
+	if len(report.Namespaces) != 2 {
+		t.Fatalf("namespaces = %+v, want dev and prod-a", report.Namespaces)
+	}
+	dev, prod := report.Namespaces[0], report.Namespaces[1]
+	// The labeled claim's snapshot is older than its policy's 1h.
+	if dev.Namespace != "dev" || dev.Claims != 1 || dev.Covered != 0 || !dev.BelowFloor {
+		t.Fatalf("dev coverage = %+v", dev)
+	}
+	if prod.Namespace != "prod-a" || prod.Claims != 5 || prod.Covered != 1 || prod.Percent != 20 || !prod.BelowFloor {
+		t.Fatalf("prod-a coverage = %+v", prod)
+	}
+	if got := len(report.BelowFloor()); got != 2 {
+		t.Fatalf("below floor = %d, want 2", got)
+	}
+
+	reasons := map[string]string{}
+	for _, uncovered := range report.Uncovered {
+		reasons[uncovered.Claim] = uncovered.Reason
+	}
+	if len(reasons) != 5 {
+		t.Fatalf("uncovered = %+v, want labeled, stale, unready, bypassed and tracked", report.Uncovered)
+	}
+	if reasons["bypassed"] != "no VolumeSnapshot" || !strings.Contains(reasons["unready"], "is ready") ||
+		!strings.Contains(reasons["stale"], "more than") || !strings.Contains(reasons["labeled"], "more than") {
+		t.Fatalf("uncovered reasons = %v", reasons)
+	}
+
+	// The tracked dataset has a VolumeSnapshotContent and the fresh one a
+	// VolumeSnapshot; only the bypassed dataset is invisible to Kubernetes.
+	if len(report.CSIBypass) != 1 {
+		t.Fatalf("CSI bypass = %+v, want only the bypassed claim", report.CSIBypass)
+	}
+	bypass := report.CSIBypass[0]
+	if bypass.Dataset != "tank/k8s/pv-bypassed" || bypass.ZFSSnapshots != 2 || !bypass.NewestZFSSnapshot.Equal(now.Add(-24*time.Hour)) {
+		t.Fatalf("CSI bypass = %+v", bypass)
+	}
+}
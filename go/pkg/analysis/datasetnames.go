@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// DatasetNameCaseMismatch is the problem of a dataset whose path matches a
+// parent dataset only when case is ignored; correlation is case-sensitive,
+// so its volumes are never matched.
+const DatasetNameCaseMismatch = "case_mismatch"
+
+// DatasetNameIssue is a dataset or snapshot below a democratic-csi parent
+// whose name is not safe for CSI volume handles.
+type DatasetNameIssue struct {
+	Name string `json:"name"`
+	// Kind is "dataset" or "snapshot".
+	Kind   string `json:"kind"`
+	Parent string `json:"parent"`
+	// Problems are truenas.IdentifierProblems of the part below Parent, or
+	// DatasetNameCaseMismatch.
+	Problems []string `json:"problems"`
+}
+
+// CheckDatasetNames lists the datasets and snapshots below the parent
+// datasets of democratic-csi StorageClasses whose names have whitespace,
+// uppercase letters, characters outside a-z, 0-9, "_", "-", "." and ":", or
+// empty components, and the datasets that only match a parent when case is
+// ignored. Only the part below the parent is checked, so an administrator's
+// choice of parent name is not reported.
+func CheckDatasetNames(classes []storagev1.StorageClass, volumes []truenas.Volume, snapshots []truenas.Snapshot) []DatasetNameIssue {
+	parents := make([]string, 0)
+	for parent := range parentDatasetClasses(classes) {
+		parents = append(parents, parent)
+	}
+	// Longest first, so a nested parent owns its descendants.
+	sort.Slice(parents, func(i, j int) bool {
+		if len(parents[i]) != len(parents[j]) {
+			return len(parents[i]) > len(parents[j])
+		}
+		return parents[i] < parents[j]
+	})
+
+	issues := []DatasetNameIssue{}
+	check := func(name, kind string) {
+		for _, parent := range parents {
+			if rel, ok := strings.CutPrefix(name, parent+"/"); ok {
+				if problems := truenas.IdentifierProblems(rel); problems != nil {
+					issues = append(issues, DatasetNameIssue{Name: name, Kind: kind, Parent: parent, Problems: problems})
+				}
+				return
+			}
+		}
+		if kind != "dataset" {
+			return
+		}
+		for _, parent := range parents {
+			if prefix := parent + "/"; len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				issues = append(issues, DatasetNameIssue{Name: name, Kind: kind, Parent: parent, Problems: []string{DatasetNameCaseMismatch}})
+				return
+			}
+		}
+	}
+	for _, volume := range volumes {
+		check(volume.Name, "dataset")
+	}
+	for _, snapshot := range snapshots {
+		check(snapshot.Name, "snapshot")
+	}
+
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Name < issues[j].Name })
+	return issues
+}
@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestCheckDatasetNames_FlagsUnsafeNamesBelowParents(t *testing.T) {
+	classes := []storagev1.StorageClass{
+		democraticClass("nfs", map[string]string{"datasetParentName": "Tank/K8s"}),
+		democraticClass("nfs-snaps", map[string]string{"datasetParentName": "Tank/K8s/snaps"}),
+	}
+	volumes := []truenas.Volume{
+		{Name: "Tank/K8s"},
+		{Name: "Tank/K8s/pvc-1"},
+		{Name: "Tank/K8s/pvc-2 "},
+		{Name: "Tank/K8s/snaps/Restore Me"},
+		{Name: "tank/k8s/pvc-3"},
+		{Name: "Tank/other/Data Set"},
+	}
+	snapshots := []truenas.Snapshot{
+		{Name: "Tank/K8s/pvc-1@auto-2026-10-16_12:00"},
+		{Name: "Tank/K8s/pvc-1@before#upgrade"},
+	}
+
+	issues := CheckDatasetNames(classes, volumes, snapshots)
+
+	got := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		got = append(got, issue.Kind+" "+issue.Name+" "+issue.Parent+" "+strings.Join(issue.Problems, ","))
+	}
+	want := []string{
+		"snapshot Tank/K8s/pvc-1@before#upgrade Tank/K8s unsafe_character",
+		"dataset Tank/K8s/pvc-2  Tank/K8s whitespace",
+		"dataset Tank/K8s/snaps/Restore Me Tank/K8s/snaps uppercase,whitespace",
+		"dataset tank/k8s/pvc-3 Tank/K8s case_mismatch",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("issues:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Dataset layout issue severities.
+const (
+	LayoutSeverityError   = "error"
+	LayoutSeverityWarning = "warning"
+)
+
+// Roles of a democratic-csi parent dataset.
+const (
+	DatasetRoleVolumes           = "volumes"
+	DatasetRoleDetachedSnapshots = "detached_snapshots"
+)
+
+// parentDatasetParameters are the StorageClass parameters holding the
+// democratic-csi parent datasets, with and without the driver's "zfs." prefix.
+var parentDatasetParameters = map[string][]string{
+	DatasetRoleVolumes:           {"datasetParentName", "zfs.datasetParentName"},
+	DatasetRoleDetachedSnapshots: {"detachedSnapshotsDatasetParentName", "zfs.detachedSnapshotsDatasetParentName"},
+}
+
+// ParentDataset is a parent dataset configured on a StorageClass.
+type ParentDataset struct {
+	StorageClass string `json:"storage_class"`
+	Role         string `json:"role"`
+	Dataset      string `json:"dataset"`
+	Exists       bool   `json:"exists"`
+}
+
+// LayoutIssue is a problem with the configured parent datasets.
+type LayoutIssue struct {
+	Severity     string `json:"severity"`
+	StorageClass string `json:"storage_class,omitempty"`
+	Dataset      string `json:"dataset,omitempty"`
+	Message      string `json:"message"`
+}
+
+// DatasetLayoutReport is the result of CheckDatasetLayout.
+type DatasetLayoutReport struct {
+	Parents []ParentDataset `json:"parents"`
+	Issues  []LayoutIssue   `json:"issues"`
+}
+
+// HasErrors reports whether any issue has error severity.
+func (r *DatasetLayoutReport) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == LayoutSeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDatasetLayout validates the parent datasets that democratic-csi
+// StorageClasses declare in their parameters. Parents must exist on TrueNAS,
+// be distinct and not nest inside one another, otherwise orphan attribution
+// is ambiguous (errors). PVs whose correlated dataset is not a direct child
+// of their class's parent are reported as warnings, since correlation then
+// relies on a volume handle suffix that may match another class's dataset.
+// Classes without parent parameters are not checked.
+func CheckDatasetLayout(classes []storagev1.StorageClass, pvs []corev1.PersistentVolume, volumes []truenas.Volume) *DatasetLayoutReport {
+	report := &DatasetLayoutReport{
+		Parents: []ParentDataset{},
+		Issues:  []LayoutIssue{},
+	}
+
+	volumesByName := make(map[string]truenas.Volume, len(volumes))
+	for _, volume := range volumes {
+		volumesByName[volume.Name] = volume
+	}
+
+	volumeParents := make(map[string]string)
+	for _, class := range classes {
+		if !strings.Contains(class.Provisioner, "democratic-csi") {
+			continue
+		}
+		for _, role := range []string{DatasetRoleVolumes, DatasetRoleDetachedSnapshots} {
+			dataset := classParameter(class, parentDatasetParameters[role])
+			if dataset == "" {
+				continue
+			}
+			_, exists := volumesByName[dataset]
+			report.Parents = append(report.Parents, ParentDataset{
+				StorageClass: class.Name,
+				Role:         role,
+				Dataset:      dataset,
+				Exists:       exists,
+			})
+			if role == DatasetRoleVolumes {
+				volumeParents[class.Name] = dataset
+			}
+		}
+	}
+	sort.Slice(report.Parents, func(i, j int) bool {
+		if report.Parents[i].StorageClass != report.Parents[j].StorageClass {
+			return report.Parents[i].StorageClass < report.Parents[j].StorageClass
+		}
+		return report.Parents[i].Role > report.Parents[j].Role
+	})
+
+	for i, parent := range report.Parents {
+		if !parent.Exists {
+			report.addIssue(LayoutSeverityError, parent.StorageClass, parent.Dataset,
+				fmt.Sprintf("%s parent dataset %s does not exist on TrueNAS", parent.Role, parent.Dataset))
+		}
+		for _, other := range report.Parents[i+1:] {
+			switch {
+			case parent.Dataset == other.Dataset:
+				report.addIssue(LayoutSeverityError, parent.StorageClass, parent.Dataset,
+					fmt.Sprintf("%s parent dataset %s is also the %s parent of StorageClass %s",
+						parent.Role, parent.Dataset, other.Role, other.StorageClass))
+			case strings.HasPrefix(other.Dataset, parent.Dataset+"/"):
+				report.addIssue(LayoutSeverityError, other.StorageClass, other.Dataset,
+					fmt.Sprintf("%s parent dataset %s is nested inside %s (%s parent of StorageClass %s)",
+						other.Role, other.Dataset, parent.Dataset, parent.Role, parent.StorageClass))
+			case strings.HasPrefix(parent.Dataset, other.Dataset+"/"):
+				report.addIssue(LayoutSeverityError, parent.StorageClass, parent.Dataset,
+					fmt.Sprintf("%s parent dataset %s is nested inside %s (%s parent of StorageClass %s)",
+						parent.Role, parent.Dataset, other.Dataset, other.Role, other.StorageClass))
+			}
+		}
+	}
+
+	for _, pv := range pvs {
+		parent, ok := volumeParents[pv.Spec.StorageClassName]
+		if !ok {
+			continue
+		}
+		volume, ok := matchVolume(pv, volumes, volumesByName)
+		if !ok || path.Dir(volume.Name) == parent {
+			continue
+		}
+		report.addIssue(LayoutSeverityWarning, pv.Spec.StorageClassName, volume.Name,
+			fmt.Sprintf("PersistentVolume %s correlates to dataset %s, which is not a child of parent dataset %s",
+				pv.Name, volume.Name, parent))
+	}
+	return report
+}
+
+func (r *DatasetLayoutReport) addIssue(severity, storageClass, dataset, message string) {
+	r.Issues = append(r.Issues, LayoutIssue{
+		Severity:     severity,
+		StorageClass: storageClass,
+		Dataset:      dataset,
+		Message:      message,
+	})
+}
+
+func classParameter(class storagev1.StorageClass, keys []string) string {
+	for _, key := range keys {
+		if value := strings.Trim(strings.TrimSpace(class.Parameters[key]), "/"); value != "" {
+			return value
+		}
+	}
+	return ""
+}
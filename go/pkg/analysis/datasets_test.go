@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func democraticClass(name string, parameters map[string]string) storagev1.StorageClass {
+	return storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Provisioner: "org.democratic-csi.nfs",
+		Parameters:  parameters,
+	}
+}
+
+func TestCheckDatasetLayout_DistinctParentsPass(t *testing.T) {
+	classes := []storagev1.StorageClass{
+		democraticClass("nfs", map[string]string{
+			"datasetParentName":                  "tank/k8s/nfs/vols",
+			"detachedSnapshotsDatasetParentName": "tank/k8s/nfs/snaps",
+		}),
+		democraticClass("iscsi", map[string]string{"zfs.datasetParentName": "tank/k8s/iscsi/vols"}),
+		{ObjectMeta: metav1.ObjectMeta{Name: "local"}, Provisioner: "rancher.io/local-path"},
+	}
+	volumes := []truenas.Volume{
+		{Name: "tank/k8s/nfs/vols"}, {Name: "tank/k8s/nfs/snaps"}, {Name: "tank/k8s/iscsi/vols"},
+		{Name: "tank/k8s/nfs/vols/pvc-a"},
+	}
+	pv := testPV("pvc-a", "1Gi")
+	pv.Spec.StorageClassName = "nfs"
+
+	report := CheckDatasetLayout(classes, []corev1.PersistentVolume{pv}, volumes)
+	if len(report.Issues) != 0 {
+		t.Fatalf("unexpected issues: %+v", report.Issues)
+	}
+	if len(report.Parents) != 3 || report.Parents[0].StorageClass != "iscsi" || !report.Parents[1].Exists {
+		t.Fatalf("parents = %+v", report.Parents)
+	}
+}
+
+func TestCheckDatasetLayout_ReportsOverlapsAndMismatches(t *testing.T) {
+	classes := []storagev1.StorageClass{
+		democraticClass("nfs", map[string]string{"datasetParentName": "tank/k8s"}),
+		democraticClass("nfs-fast", map[string]string{"datasetParentName": "tank/k8s/nfs"}),
+		democraticClass("iscsi", map[string]string{
+			"datasetParentName":                  "tank/iscsi",
+			"detachedSnapshotsDatasetParentName": "tank/iscsi",
+		}),
+		democraticClass("missing", map[string]string{"datasetParentName": "ssd/k8s"}),
+	}
+	volumes := []truenas.Volume{
+		{Name: "tank/k8s"}, {Name: "tank/k8s/nfs"}, {Name: "tank/iscsi"},
+		{Name: "tank/k8s/nfs/pvc-a"},
+	}
+	pv := testPV("pvc-a", "1Gi")
+	pv.Spec.StorageClassName = "nfs"
+
+	report := CheckDatasetLayout(classes, []corev1.PersistentVolume{pv}, volumes)
+	if !report.HasErrors() {
+		t.Fatal("expected errors")
+	}
+
+	var messages []string
+	warnings := 0
+	for _, issue := range report.Issues {
+		messages = append(messages, issue.Message)
+		if issue.Severity == LayoutSeverityWarning {
+			warnings++
+		}
+	}
+	joined := strings.Join(messages, "\n")
+	for _, fragment := range []string{
+		"ssd/k8s does not exist",
+		"tank/k8s/nfs is nested inside tank/k8s",
+		"tank/iscsi is also the detached_snapshots parent",
+		"correlates to dataset tank/k8s/nfs/pvc-a, which is not a child of parent dataset tank/k8s",
+	} {
+		if !strings.Contains(joined, fragment) {
+			t.Fatalf("issues missing %q:\n%s", fragment, joined)
+		}
+	}
+	if warnings != 1 || len(report.Issues) != 4 {
+		t.Fatalf("got %d issues (%d warnings), want 4 (1 warning):\n%s", len(report.Issues), warnings, joined)
+	}
+}
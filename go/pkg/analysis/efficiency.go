@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// StorageEfficiency is how much of the capacity PVs request is actually
+// used on TrueNAS: the used bytes of the datasets backing PVs divided by the
+// requested capacity of those PVs, as a percent. PVs without a requested
+// capacity or without a correlated dataset are excluded; Coverage says how
+// many PVs the figure covers.
+type StorageEfficiency struct {
+	Percent        float64 `json:"percent"`
+	UsedBytes      int64   `json:"used_bytes"`
+	RequestedBytes int64   `json:"requested_bytes"`
+	// CorrelatedPVs of TotalPVs were included.
+	CorrelatedPVs   int     `json:"correlated_pvs"`
+	TotalPVs        int     `json:"total_pvs"`
+	CoveragePercent float64 `json:"coverage_percent"`
+}
+
+// NewStorageEfficiency computes the percentages from used and requested
+// bytes of the correlated PVs out of total PVs. Percent is 0 when nothing is
+// requested, and CoveragePercent is 0 without PVs.
+func NewStorageEfficiency(usedBytes, requestedBytes int64, correlatedPVs, totalPVs int) StorageEfficiency {
+	return StorageEfficiency{
+		Percent:         percent(usedBytes, requestedBytes),
+		UsedBytes:       usedBytes,
+		RequestedBytes:  requestedBytes,
+		CorrelatedPVs:   correlatedPVs,
+		TotalPVs:        totalPVs,
+		CoveragePercent: percent(int64(correlatedPVs), int64(totalPVs)),
+	}
+}
+
+// ComputeStorageEfficiency computes the storage efficiency of the given PVs.
+func ComputeStorageEfficiency(pvs []corev1.PersistentVolume, volumes []truenas.Volume) StorageEfficiency {
+	volumesByName := make(map[string]truenas.Volume, len(volumes))
+	for _, volume := range volumes {
+		volumesByName[volume.Name] = volume
+	}
+
+	var used, requested int64
+	correlated := 0
+	for _, pv := range pvs {
+		storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]
+		if !ok || storage.Value() <= 0 {
+			continue
+		}
+		volume, ok := matchVolume(pv, volumes, volumesByName)
+		if !ok {
+			continue
+		}
+		correlated++
+		requested += storage.Value()
+		used += volume.Used
+	}
+	return NewStorageEfficiency(used, requested, correlated, len(pvs))
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestComputeStorageEfficiency(t *testing.T) {
+	zeroCapacity := testPV("pvc-empty", "0")
+	noCapacity := testPV("pvc-nocap", "1Gi")
+	noCapacity.Spec.Capacity = nil
+	pvs := []corev1.PersistentVolume{
+		testPV("pvc-a", "100Gi"),
+		testPV("pvc-b", "100Gi"),
+		testPV("pvc-unmatched", "50Gi"),
+		zeroCapacity,
+		noCapacity,
+	}
+	volumes := []truenas.Volume{
+		{Name: "tank/k8s/pvc-a", Used: 30 * gib},
+		{Name: "tank/k8s/pvc-b", Used: 10 * gib},
+		{Name: "tank/k8s/pvc-empty", Used: gib},
+		{Name: "tank/k8s/pvc-nocap", Used: gib},
+	}
+
+	got := ComputeStorageEfficiency(pvs, volumes)
+	want := StorageEfficiency{
+		Percent:         20,
+		UsedBytes:       40 * gib,
+		RequestedBytes:  200 * gib,
+		CorrelatedPVs:   2,
+		TotalPVs:        5,
+		CoveragePercent: 40,
+	}
+	if got != want {
+		t.Fatalf("efficiency = %+v, want %+v", got, want)
+	}
+
+	if got := ComputeStorageEfficiency(nil, volumes); got != (StorageEfficiency{}) {
+		t.Fatalf("efficiency without PVs = %+v, want zero", got)
+	}
+	if got := ComputeStorageEfficiency([]corev1.PersistentVolume{zeroCapacity}, volumes); got.Percent != 0 || got.CoveragePercent != 0 {
+		t.Fatalf("efficiency of a zero-capacity PV = %+v, want 0%% at 0%% coverage", got)
+	}
+}
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+)
+
+// Defaults of PhaseFlappingOptions.
+const (
+	DefaultFlappingWindow         = 24 * time.Hour
+	DefaultFlappingMaxTransitions = 3
+)
+
+// PhaseFlappingOptions bound how often a PV may change phase: more than
+// MaxTransitions changes within Window make it flapping.
+type PhaseFlappingOptions struct {
+	// Window is the rolling window transitions are counted in (0 =
+	// DefaultFlappingWindow).
+	Window time.Duration
+	// MaxTransitions is the most transitions allowed within Window (0 =
+	// DefaultFlappingMaxTransitions).
+	MaxTransitions int
+}
+
+func (o PhaseFlappingOptions) withDefaults() PhaseFlappingOptions {
+	if o.Window <= 0 {
+		o.Window = DefaultFlappingWindow
+	}
+	if o.MaxTransitions <= 0 {
+		o.MaxTransitions = DefaultFlappingMaxTransitions
+	}
+	return o
+}
+
+// PVPhaseTransition is a change of a PV's phase between two consecutive
+// scans, dated by the scan that saw the new phase.
+type PVPhaseTransition struct {
+	PersistentVolume string    `json:"persistent_volume"`
+	From             string    `json:"from"`
+	To               string    `json:"to"`
+	At               time.Time `json:"at"`
+}
+
+// FlappingVolume is a PV that changed phase more often than allowed within
+// the window, with those transitions, oldest first.
+type FlappingVolume struct {
+	PersistentVolume string              `json:"persistent_volume"`
+	Phase            string              `json:"phase"`
+	Transitions      []PVPhaseTransition `json:"transitions"`
+}
+
+// PVPhaseHistory is the tracked state of one PV: its phase in the last
+// scan and its transitions within the window.
+type PVPhaseHistory struct {
+	Phase       string              `json:"phase"`
+	Transitions []PVPhaseTransition `json:"transitions,omitempty"`
+}
+
+// TrackPVPhases records in history the phases of the PVs listed by a scan
+// at now, keyed by PV name. It returns the transitions since the previous
+// scan and the flapping PVs, both sorted by PV name. Transitions older than
+// the window are dropped, and so are PVs missing from phases.
+func TrackPVPhases(history map[string]PVPhaseHistory, phases map[string]string, now time.Time, opts PhaseFlappingOptions) ([]PVPhaseTransition, []FlappingVolume) {
+	opts = opts.withDefaults()
+	cutoff := now.Add(-opts.Window)
+
+	for name := range history {
+		if _, ok := phases[name]; !ok {
+			delete(history, name)
+		}
+	}
+
+	var transitions []PVPhaseTransition
+	var flapping []FlappingVolume
+	for name, phase := range phases {
+		entry, known := history[name]
+		if known && entry.Phase != phase {
+			transition := PVPhaseTransition{PersistentVolume: name, From: entry.Phase, To: phase, At: now}
+			entry.Transitions = append(entry.Transitions, transition)
+			transitions = append(transitions, transition)
+		}
+		entry.Phase = phase
+		kept := entry.Transitions[:0]
+		for _, transition := range entry.Transitions {
+			if transition.At.After(cutoff) {
+				kept = append(kept, transition)
+			}
+		}
+		entry.Transitions = kept
+		history[name] = entry
+
+		if len(entry.Transitions) > opts.MaxTransitions {
+			flapping = append(flapping, FlappingVolume{
+				PersistentVolume: name,
+				Phase:            phase,
+				Transitions:      append([]PVPhaseTransition(nil), entry.Transitions...),
+			})
+		}
+	}
+	sort.Slice(transitions, func(i, j int) bool { return transitions[i].PersistentVolume < transitions[j].PersistentVolume })
+	sort.Slice(flapping, func(i, j int) bool { return flapping[i].PersistentVolume < flapping[j].PersistentVolume })
+	return transitions, flapping
+}
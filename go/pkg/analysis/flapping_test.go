@@ -0,0 +1,44 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackPVPhases_FlagsFlappingVolumes(t *testing.T) {
+	start := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	opts := PhaseFlappingOptions{Window: 12 * time.Hour, MaxTransitions: 2}
+	history := map[string]PVPhaseHistory{}
+
+	// pv-flap alternates every 3 hours; pv-stable stays Bound.
+	var transitions []PVPhaseTransition
+	var flapping []FlappingVolume
+	for i := 0; i < 5; i++ {
+		phase := "Bound"
+		if i%2 == 1 {
+			phase = "Released"
+		}
+		transitions, flapping = TrackPVPhases(history, map[string]string{"pv-flap": phase, "pv-stable": "Bound"}, start.Add(time.Duration(i)*3*time.Hour), opts)
+		if i == 0 && len(transitions) != 0 {
+			t.Fatalf("first scan transitions = %v, want none", transitions)
+		}
+		if i == 2 && len(flapping) != 0 {
+			t.Fatalf("flapping after 2 transitions = %v, want none", flapping)
+		}
+	}
+	if len(transitions) != 1 || transitions[0] != (PVPhaseTransition{PersistentVolume: "pv-flap", From: "Released", To: "Bound", At: start.Add(12 * time.Hour)}) {
+		t.Fatalf("last transitions = %v, want pv-flap Released -> Bound", transitions)
+	}
+	if len(flapping) != 1 || flapping[0].PersistentVolume != "pv-flap" || flapping[0].Phase != "Bound" || len(flapping[0].Transitions) != 4 {
+		t.Fatalf("flapping = %+v, want pv-flap with 4 transitions", flapping)
+	}
+
+	// Twelve quiet hours later the transitions have left the window.
+	_, flapping = TrackPVPhases(history, map[string]string{"pv-flap": "Bound"}, start.Add(24*time.Hour), opts)
+	if len(flapping) != 0 || len(history["pv-flap"].Transitions) != 0 {
+		t.Fatalf("flapping = %v, history %+v; want the old transitions dropped", flapping, history["pv-flap"])
+	}
+	if _, ok := history["pv-stable"]; ok {
+		t.Fatal("history kept a PV that is no longer listed")
+	}
+}
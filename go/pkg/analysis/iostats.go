@@ -0,0 +1,192 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Volume temperatures derived from I/O throughput.
+const (
+	TemperatureHot     = "hot"
+	TemperatureWarm    = "warm"
+	TemperatureCold    = "cold"
+	TemperatureUnknown = "unknown"
+)
+
+// Default I/O classification settings.
+const (
+	DefaultIOStatsWindow      = 24 * time.Hour
+	DefaultHotBytesPerSecond  = 1 << 20 // 1MiB/s
+	DefaultColdBytesPerSecond = 1 << 10 // 1KiB/s
+)
+
+// IOThresholds classify volumes by combined read and write throughput:
+// hot at or above HotBytesPerSecond, cold below ColdBytesPerSecond and warm
+// in between. Zero values use the defaults.
+type IOThresholds struct {
+	HotBytesPerSecond  float64
+	ColdBytesPerSecond float64
+}
+
+func (t IOThresholds) withDefaults() IOThresholds {
+	if t.HotBytesPerSecond <= 0 {
+		t.HotBytesPerSecond = DefaultHotBytesPerSecond
+	}
+	if t.ColdBytesPerSecond <= 0 {
+		t.ColdBytesPerSecond = DefaultColdBytesPerSecond
+	}
+	return t
+}
+
+// IOStatsOptions enables I/O statistics collection for the analysis.
+type IOStatsOptions struct {
+	Enabled bool
+	// Window is the averaging period; zero uses DefaultIOStatsWindow.
+	Window     time.Duration
+	Thresholds IOThresholds
+}
+
+// VolumeStats describes a democratic-csi volume, its backing dataset, the
+// snapshots of that dataset and, when I/O statistics were collected, its I/O
+// rates and temperature.
+type VolumeStats struct {
+	PersistentVolume  string  `json:"persistent_volume"`
+	ClaimNamespace    string  `json:"claim_namespace,omitempty"`
+	ClaimName         string  `json:"claim_name,omitempty"`
+	Dataset           string  `json:"dataset"`
+	RequestedBytes    int64   `json:"requested_bytes"`
+	UsedBytes         int64   `json:"used_bytes"`
+	SnapshotCount     int     `json:"snapshot_count"`
+	SnapshotUsedBytes int64   `json:"snapshot_used_bytes"`
+	ReadOpsRate       float64 `json:"read_ops_rate"`
+	WriteOpsRate      float64 `json:"write_ops_rate"`
+	ReadBytesRate     float64 `json:"read_bytes_rate"`
+	WriteBytesRate    float64 `json:"write_bytes_rate"`
+	Temperature       string  `json:"temperature"`
+}
+
+// Classify returns the temperature of a dataset's I/O rates.
+func Classify(stats truenas.DatasetIOStats, thresholds IOThresholds) string {
+	thresholds = thresholds.withDefaults()
+	switch rate := stats.TotalBytesRate(); {
+	case rate >= thresholds.HotBytesPerSecond:
+		return TemperatureHot
+	case rate < thresholds.ColdBytesPerSecond:
+		return TemperatureCold
+	default:
+		return TemperatureWarm
+	}
+}
+
+// GatherIOStats fetches I/O rates of the datasets backing the PVs in in,
+// keyed by dataset name.
+func GatherIOStats(ctx context.Context, truenasClient truenas.Client, in Inputs, window time.Duration) (map[string]truenas.DatasetIOStats, error) {
+	if window <= 0 {
+		window = DefaultIOStatsWindow
+	}
+	byName := volumesByName(in.Volumes)
+	var datasets []string
+	for _, pv := range in.PersistentVolumes {
+		if volume, ok := matchVolume(pv, in.Volumes, byName); ok {
+			datasets = append(datasets, volume.Name)
+		}
+	}
+	stats, err := truenasClient.GetDatasetIOStats(ctx, datasets, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset I/O statistics: %w", err)
+	}
+	byDataset := make(map[string]truenas.DatasetIOStats, len(stats))
+	for _, s := range stats {
+		byDataset[s.Dataset] = s
+	}
+	return byDataset, nil
+}
+
+// VolumeIO lists the PVs backed by a TrueNAS dataset with their snapshot
+// totals and their I/O rates from stats, classified with thresholds, sorted
+// by combined throughput. Volumes without statistics are TemperatureUnknown.
+func VolumeIO(in Inputs, stats map[string]truenas.DatasetIOStats, thresholds IOThresholds) []VolumeStats {
+	byName := volumesByName(in.Volumes)
+	snapshots := SnapshotsByDataset(in.Snapshots)
+	volumes := []VolumeStats{}
+	for _, pv := range in.PersistentVolumes {
+		volume, ok := matchVolume(pv, in.Volumes, byName)
+		if !ok {
+			continue
+		}
+		entry := VolumeStats{
+			PersistentVolume: pv.Name,
+			Dataset:          volume.Name,
+			UsedBytes:        volume.Used,
+			Temperature:      TemperatureUnknown,
+		}
+		if ref := pv.Spec.ClaimRef; ref != nil {
+			entry.ClaimNamespace, entry.ClaimName = ref.Namespace, ref.Name
+		}
+		if totals, ok := snapshots[volume.Name]; ok {
+			entry.SnapshotCount, entry.SnapshotUsedBytes = totals.Count, totals.UsedBytes
+		}
+		if storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+			entry.RequestedBytes = storage.Value()
+		}
+		if s, ok := stats[volume.Name]; ok {
+			entry.ReadOpsRate, entry.WriteOpsRate = s.ReadOpsRate, s.WriteOpsRate
+			entry.ReadBytesRate, entry.WriteBytesRate = s.ReadBytesRate, s.WriteBytesRate
+			entry.Temperature = Classify(s, thresholds)
+		}
+		volumes = append(volumes, entry)
+	}
+	sort.SliceStable(volumes, func(i, j int) bool {
+		ri := volumes[i].ReadBytesRate + volumes[i].WriteBytesRate
+		rj := volumes[j].ReadBytesRate + volumes[j].WriteBytesRate
+		if ri != rj {
+			return ri > rj
+		}
+		return volumes[i].PersistentVolume < volumes[j].PersistentVolume
+	})
+	return volumes
+}
+
+// unusedVolumesRecommendation suggests reclaiming cold volumes.
+func unusedVolumesRecommendation(volumes []VolumeStats, window time.Duration) (string, bool) {
+	var cold []string
+	for _, volume := range volumes {
+		if volume.Temperature != TemperatureCold {
+			continue
+		}
+		name := volume.PersistentVolume
+		if volume.ClaimName != "" {
+			name = volume.ClaimNamespace + "/" + volume.ClaimName
+		}
+		cold = append(cold, name)
+	}
+	if len(cold) == 0 {
+		return "", false
+	}
+	sort.Strings(cold)
+	const listed = 5
+	names := strings.Join(cold[:min(listed, len(cold))], ", ")
+	if len(cold) > listed {
+		names += fmt.Sprintf(" and %d more", len(cold)-listed)
+	}
+	period := window.String()
+	if window%time.Hour == 0 {
+		period = fmt.Sprintf("%dh", window/time.Hour)
+	}
+	return fmt.Sprintf("Volumes with almost no I/O over the last %s: %s; consider reclaiming them", period, names), true
+}
+
+func volumesByName(volumes []truenas.Volume) map[string]truenas.Volume {
+	byName := make(map[string]truenas.Volume, len(volumes))
+	for _, volume := range volumes {
+		byName[volume.Name] = volume
+	}
+	return byName
+}
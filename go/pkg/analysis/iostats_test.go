@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestClassify(t *testing.T) {
+	thresholds := IOThresholds{HotBytesPerSecond: 1000, ColdBytesPerSecond: 10}
+	tests := []struct {
+		read, write float64
+		want        string
+	}{
+		{read: 600, write: 400, want: TemperatureHot},
+		{read: 500, write: 0, want: TemperatureWarm},
+		{read: 10, want: TemperatureWarm},
+		{read: 9.9, want: TemperatureCold},
+		{want: TemperatureCold},
+	}
+	for _, tt := range tests {
+		got := Classify(truenas.DatasetIOStats{ReadBytesRate: tt.read, WriteBytesRate: tt.write}, thresholds)
+		if got != tt.want {
+			t.Fatalf("Classify(%v read, %v write) = %s, want %s", tt.read, tt.write, got, tt.want)
+		}
+	}
+
+	if got := Classify(truenas.DatasetIOStats{ReadBytesRate: 2 << 20}, IOThresholds{}); got != TemperatureHot {
+		t.Fatalf("default thresholds: got %s, want hot", got)
+	}
+}
+
+func TestAnalyzer_IOStatsClassifiesVolumes(t *testing.T) {
+	claimed := testPV("pvc-idle", "10Gi")
+	claimed.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	lister := &pvLister{pvs: []corev1.PersistentVolume{
+		testPV("pvc-busy", "10Gi"), claimed, testPV("pvc-nostats", "10Gi"),
+	}}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/pvc-busy"}, {Name: "tank/k8s/pvc-idle"}, {Name: "tank/k8s/pvc-nostats"},
+		},
+		IOStats: []truenas.DatasetIOStats{
+			{Dataset: "tank/k8s/pvc-busy", ReadBytesRate: 4 << 20, WriteBytesRate: 1 << 20},
+			{Dataset: "tank/k8s/pvc-idle", ReadBytesRate: 1},
+		},
+	}
+	analyzer := NewAnalyzer(lister, truenasClient, Options{
+		CacheTTL: -1,
+		IOStats:  IOStatsOptions{Enabled: true},
+	})
+
+	result, err := analyzer.Analyze(context.Background())
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if len(result.Volumes) != 3 {
+		t.Fatalf("expected 3 volumes, got %+v", result.Volumes)
+	}
+	want := map[string]string{
+		"pvc-busy":    TemperatureHot,
+		"pvc-idle":    TemperatureCold,
+		"pvc-nostats": TemperatureUnknown,
+	}
+	for _, volume := range result.Volumes {
+		if volume.Temperature != want[volume.PersistentVolume] {
+			t.Fatalf("%s temperature = %s, want %s", volume.PersistentVolume, volume.Temperature, want[volume.PersistentVolume])
+		}
+	}
+	if result.Volumes[0].PersistentVolume != "pvc-busy" {
+		t.Fatalf("volumes should be sorted by throughput, got %s first", result.Volumes[0].PersistentVolume)
+	}
+
+	var recommendation string
+	for _, rec := range result.Recommendations {
+		if strings.Contains(rec, "consider reclaiming") {
+			recommendation = rec
+		}
+	}
+	if recommendation != "Volumes with almost no I/O over the last 24h: apps/data; consider reclaiming them" {
+		t.Fatalf("unexpected unused volumes recommendation %q in %v", recommendation, result.Recommendations)
+	}
+}
+
+func TestAnalyzer_IOStatsErrorKeepsAnalysis(t *testing.T) {
+	lister := &pvLister{pvs: []corev1.PersistentVolume{testPV("pvc-a", "10Gi")}}
+	truenasClient := &truenastest.Client{
+		Volumes:    []truenas.Volume{{Name: "tank/k8s/pvc-a"}},
+		IOStatsErr: errors.New("reporting unavailable"),
+	}
+	analyzer := NewAnalyzer(lister, truenasClient, Options{CacheTTL: -1, IOStats: IOStatsOptions{Enabled: true}})
+
+	result, err := analyzer.Analyze(context.Background())
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if !strings.Contains(result.IOStatsError, "reporting unavailable") {
+		t.Fatalf("IOStatsError = %q", result.IOStatsError)
+	}
+	if len(result.Volumes) != 1 || result.Volumes[0].Temperature != TemperatureUnknown {
+		t.Fatalf("expected one unknown volume, got %+v", result.Volumes)
+	}
+}
@@ -0,0 +1,216 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// ISCSISessionAlertCategory is the alert category used for nodes and volumes
+// whose iSCSI sessions are missing or not allowed.
+const ISCSISessionAlertCategory = "iscsi_session"
+
+// iSCSI session violation kinds.
+const (
+	// ISCSIMissingSession is a node with attached iSCSI PVs and no session.
+	ISCSIMissingSession = "missing_session"
+	// ISCSIInitiatorNotAllowed is a PV attached to a node whose initiator
+	// is in no initiator group.
+	ISCSIInitiatorNotAllowed = "initiator_not_allowed"
+)
+
+// ISCSISessionOptions configure the iSCSI session check.
+type ISCSISessionOptions struct {
+	Enabled bool
+	// NodeInitiators maps node names to their initiator IQN. Nodes not
+	// listed are matched to sessions by their addresses.
+	NodeInitiators map[string]string
+}
+
+// ISCSINode is a node with attached iSCSI PVs.
+type ISCSINode struct {
+	Node string `json:"node"`
+	// Initiator is the configured IQN of the node, or the IQN of a session
+	// from one of its addresses; empty when neither is known.
+	Initiator string   `json:"initiator,omitempty"`
+	Sessions  int      `json:"sessions"`
+	Volumes   []string `json:"volumes"`
+}
+
+// ISCSIViolation is a node without an iSCSI session or a PV attached to a
+// node whose initiator is not allowed.
+type ISCSIViolation struct {
+	Category         string `json:"category"`
+	Node             string `json:"node"`
+	Initiator        string `json:"initiator,omitempty"`
+	PersistentVolume string `json:"persistent_volume,omitempty"`
+	// Claim is the bound PVC as namespace/name, if any.
+	Claim     string `json:"claim,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// ISCSISessionReport correlates attached iSCSI PVs with TrueNAS sessions.
+type ISCSISessionReport struct {
+	Nodes      []ISCSINode      `json:"nodes"`
+	Violations []ISCSIViolation `json:"violations"`
+}
+
+// CheckISCSISessions lists what BuildISCSISessionReport needs and builds the
+// report.
+func CheckISCSISessions(ctx context.Context, k8sClient k8s.Client, truenasClient truenas.Client, opts ISCSISessionOptions) (*ISCSISessionReport, error) {
+	attachments, err := k8sClient.ListVolumeAttachments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume attachments: %w", err)
+	}
+	pvs, err := k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+	nodes, err := k8sClient.ListNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	sessions, err := truenasClient.ListISCSISessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list iSCSI sessions: %w", err)
+	}
+	groups, err := truenasClient.ListISCSIInitiatorGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list iSCSI initiator groups: %w", err)
+	}
+	return BuildISCSISessionReport(attachments, pvs, nodes, sessions, groups, opts.NodeInitiators), nil
+}
+
+// BuildISCSISessionReport flags nodes that have attached democratic-csi iSCSI
+// PVs but no session from their initiator, and PVs attached to nodes whose
+// initiator is in none of the initiator groups. A node's sessions are those
+// from its configured IQN or from one of its addresses. Initiator groups are
+// checked as one allow-list, which no group or a group without initiators
+// disables.
+func BuildISCSISessionReport(attachments []storagev1.VolumeAttachment, pvs []corev1.PersistentVolume, nodes []corev1.Node, sessions []truenas.ISCSISession, groups []truenas.ISCSIInitiatorGroup, nodeInitiators map[string]string) *ISCSISessionReport {
+	report := &ISCSISessionReport{Nodes: []ISCSINode{}, Violations: []ISCSIViolation{}}
+
+	iscsiPVs := make(map[string]corev1.PersistentVolume)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && strings.Contains(pv.Spec.CSI.Driver, "iscsi") {
+			iscsiPVs[pv.Name] = pv
+		}
+	}
+	attached := make(map[string][]string)
+	for _, attachment := range attachments {
+		source := attachment.Spec.Source.PersistentVolumeName
+		if !attachment.Status.Attached || source == nil {
+			continue
+		}
+		if _, ok := iscsiPVs[*source]; ok {
+			attached[attachment.Spec.NodeName] = append(attached[attachment.Spec.NodeName], *source)
+		}
+	}
+
+	addresses := make(map[string][]string, len(nodes))
+	for _, node := range nodes {
+		for _, address := range node.Status.Addresses {
+			addresses[node.Name] = append(addresses[node.Name], address.Address)
+		}
+	}
+	allowed, allowAll := allowedInitiators(groups)
+
+	for nodeName, volumes := range attached {
+		sort.Strings(volumes)
+		node := ISCSINode{Node: nodeName, Initiator: nodeInitiators[nodeName], Volumes: volumes}
+		for _, session := range sessions {
+			if !sessionFromNode(session, node.Initiator, addresses[nodeName]) {
+				continue
+			}
+			node.Sessions++
+			if node.Initiator == "" {
+				node.Initiator = session.Initiator
+			}
+		}
+		report.Nodes = append(report.Nodes, node)
+
+		if node.Sessions == 0 {
+			report.Violations = append(report.Violations, ISCSIViolation{
+				Category:  ISCSIMissingSession,
+				Node:      nodeName,
+				Initiator: node.Initiator,
+				Reason:    fmt.Sprintf("no iSCSI session from node %s, which has %d attached iSCSI volumes (%s)", nodeName, len(volumes), strings.Join(volumes, ", ")),
+			})
+		}
+		if allowAll || node.Initiator == "" || allowed[node.Initiator] {
+			continue
+		}
+		for _, volume := range volumes {
+			violation := ISCSIViolation{
+				Category:         ISCSIInitiatorNotAllowed,
+				Node:             nodeName,
+				Initiator:        node.Initiator,
+				PersistentVolume: volume,
+				Reason:           fmt.Sprintf("initiator %s of node %s is in no iSCSI initiator group", node.Initiator, nodeName),
+			}
+			if ref := iscsiPVs[volume].Spec.ClaimRef; ref != nil {
+				violation.Namespace = ref.Namespace
+				violation.Claim = ref.Namespace + "/" + ref.Name
+			}
+			report.Violations = append(report.Violations, violation)
+		}
+	}
+
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Node < report.Nodes[j].Node })
+	sort.Slice(report.Violations, func(i, j int) bool {
+		a, b := report.Violations[i], report.Violations[j]
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.PersistentVolume < b.PersistentVolume
+	})
+	return report
+}
+
+// allowedInitiators merges the initiator groups into one allow-list. It
+// allows every initiator when there are no groups or one group lists none.
+func allowedInitiators(groups []truenas.ISCSIInitiatorGroup) (map[string]bool, bool) {
+	if len(groups) == 0 {
+		return nil, true
+	}
+	allowed := make(map[string]bool)
+	for _, group := range groups {
+		if len(group.Initiators) == 0 {
+			return nil, true
+		}
+		for _, initiator := range group.Initiators {
+			allowed[initiator] = true
+		}
+	}
+	return allowed, false
+}
+
+// sessionFromNode reports whether a session comes from the node's initiator
+// or from one of its addresses.
+func sessionFromNode(session truenas.ISCSISession, initiator string, addresses []string) bool {
+	if initiator != "" && session.Initiator == initiator {
+		return true
+	}
+	addr := session.InitiatorAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	for _, address := range addresses {
+		if addr != "" && addr == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func iscsiPV(name string) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			ClaimRef: &corev1.ObjectReference{Namespace: "apps", Name: "data-" + name},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.iscsi", VolumeHandle: name},
+			},
+		},
+	}
+}
+
+func attachment(pv, node string, attached bool) storagev1.VolumeAttachment {
+	return storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-" + pv},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: "org.democratic-csi.iscsi",
+			NodeName: node,
+			Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pv},
+		},
+		Status: storagev1.VolumeAttachmentStatus{Attached: attached},
+	}
+}
+
+func addressedNode(name, address string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: address},
+		}},
+	}
+}
+
+func TestCheckISCSISessions_FlagsMissingSessionsAndDisallowedInitiators(t *testing.T) {
+	nfs := nfsPV("pv-nfs", "/mnt/tank/k8s/pv-nfs")
+	k8sClient := &k8stest.Client{
+		PersistentVolumes: []corev1.PersistentVolume{iscsiPV("pv-a"), iscsiPV("pv-b"), iscsiPV("pv-c"), iscsiPV("pv-d"), nfs},
+		VolumeAttachments: []storagev1.VolumeAttachment{
+			attachment("pv-a", "worker-1", true),
+			attachment("pv-b", "worker-2", true),
+			attachment("pv-c", "worker-3", true),
+			attachment("pv-d", "worker-4", false),
+			attachment("pv-nfs", "worker-4", true),
+		},
+		Nodes: []corev1.Node{
+			addressedNode("worker-1", "10.0.0.11"),
+			addressedNode("worker-2", "10.0.0.12"),
+			addressedNode("worker-3", "10.0.0.13"),
+			addressedNode("worker-4", "10.0.0.14"),
+		},
+	}
+	truenasClient := &truenastest.Client{
+		ISCSISessions: []truenas.ISCSISession{
+			{Initiator: "iqn.2024-01.lab:worker-1", InitiatorAddr: "10.0.0.11"},
+			{Initiator: "iqn.2024-01.lab:rogue", InitiatorAddr: "10.0.0.13:51234"},
+		},
+		ISCSIInitiatorGroups: []truenas.ISCSIInitiatorGroup{
+			{ID: 1, Initiators: []string{"iqn.2024-01.lab:worker-1", "iqn.2024-01.lab:worker-2"}},
+		},
+	}
+
+	report, err := CheckISCSISessions(context.Background(), k8sClient, truenasClient, ISCSISessionOptions{
+		Enabled:        true,
+		NodeInitiators: map[string]string{"worker-2": "iqn.2024-01.lab:worker-2"},
+	})
+	if err != nil {
+		t.Fatalf("CheckISCSISessions: %v", err)
+	}
+
+	if len(report.Nodes) != 3 {
+		t.Fatalf("nodes = %+v, want worker-1..3", report.Nodes)
+	}
+	if node := report.Nodes[0]; node.Node != "worker-1" || node.Sessions != 1 || node.Initiator != "iqn.2024-01.lab:worker-1" {
+		t.Fatalf("worker-1 = %+v", node)
+	}
+	if len(report.Violations) != 2 {
+		t.Fatalf("violations = %+v", report.Violations)
+	}
+	missing := report.Violations[0]
+	if missing.Category != ISCSIMissingSession || missing.Node != "worker-2" || missing.Initiator != "iqn.2024-01.lab:worker-2" {
+		t.Fatalf("missing session = %+v", missing)
+	}
+	notAllowed := report.Violations[1]
+	if notAllowed.Category != ISCSIInitiatorNotAllowed || notAllowed.Node != "worker-3" ||
+		notAllowed.PersistentVolume != "pv-c" || notAllowed.Claim != "apps/data-pv-c" {
+		t.Fatalf("not allowed = %+v", notAllowed)
+	}
+}
+
+func TestBuildISCSISessionReport_OpenInitiatorGroupAllowsAll(t *testing.T) {
+	report := BuildISCSISessionReport(
+		[]storagev1.VolumeAttachment{attachment("pv-a", "worker-1", true)},
+		[]corev1.PersistentVolume{iscsiPV("pv-a")},
+		[]corev1.Node{addressedNode("worker-1", "10.0.0.11")},
+		[]truenas.ISCSISession{{Initiator: "iqn.2024-01.lab:worker-1", InitiatorAddr: "10.0.0.11"}},
+		[]truenas.ISCSIInitiatorGroup{{ID: 1, Initiators: []string{"iqn.2024-01.lab:other"}}, {ID: 2}},
+		nil,
+	)
+	if len(report.Violations) != 0 {
+		t.Fatalf("violations = %+v, want none", report.Violations)
+	}
+}
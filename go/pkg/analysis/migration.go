@@ -0,0 +1,222 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// MigrationInputs holds the inventories a StorageClass migration report is
+// built from.
+type MigrationInputs struct {
+	StorageClasses    []storagev1.StorageClass
+	Claims            []corev1.PersistentVolumeClaim
+	PersistentVolumes []corev1.PersistentVolume
+	VolumeSnapshots   []snapshotv1.VolumeSnapshot
+	Pods              []corev1.Pod
+	Volumes           []truenas.Volume
+	Snapshots         []truenas.Snapshot
+	Pools             []truenas.Pool
+}
+
+// MigrationReport lists what is left on the source StorageClass of a
+// migration and what the target needs to take it.
+type MigrationReport struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// TargetReadWriteMany is whether the target class's driver can serve
+	// ReadWriteMany claims; block drivers such as iSCSI cannot.
+	TargetReadWriteMany bool                 `json:"target_read_write_many"`
+	Claims              int                  `json:"claims"`
+	Blocked             int                  `json:"blocked"`
+	RequestedBytes      int64                `json:"requested_bytes"`
+	UsedBytes           int64                `json:"used_bytes"`
+	Capacity            MigrationCapacity    `json:"capacity"`
+	Namespaces          []MigrationNamespace `json:"namespaces"`
+	Notes               []string             `json:"notes"`
+}
+
+// MigrationCapacity estimates the TrueNAS capacity the migrated claims
+// need on the target pool. RequiredBytes is the data to copy: the used
+// bytes of each source dataset, or the request when the dataset is not on
+// TrueNAS. Fits is nil when the target pool is unknown.
+type MigrationCapacity struct {
+	TargetPool     string `json:"target_pool,omitempty"`
+	AvailableBytes int64  `json:"available_bytes"`
+	RequiredBytes  int64  `json:"required_bytes"`
+	Fits           *bool  `json:"fits"`
+}
+
+// MigrationNamespace is the claims of one namespace left on the source
+// class.
+type MigrationNamespace struct {
+	Namespace      string           `json:"namespace"`
+	RequestedBytes int64            `json:"requested_bytes"`
+	UsedBytes      int64            `json:"used_bytes"`
+	Claims         []MigrationClaim `json:"claims"`
+}
+
+// MigrationClaim is a claim left on the source class. UsedBytes is 0 and
+// Dataset empty when no TrueNAS dataset backs its volume. Blockers say why
+// it cannot be migrated automatically.
+type MigrationClaim struct {
+	Name             string     `json:"name"`
+	PersistentVolume string     `json:"persistent_volume,omitempty"`
+	Dataset          string     `json:"dataset,omitempty"`
+	AccessModes      []string   `json:"access_modes"`
+	RequestedBytes   int64      `json:"requested_bytes"`
+	UsedBytes        int64      `json:"used_bytes"`
+	VolumeSnapshots  int        `json:"volume_snapshots"`
+	TrueNASSnapshots int        `json:"truenas_snapshots"`
+	Workloads        []Workload `json:"workloads"`
+	Blockers         []string   `json:"blockers"`
+}
+
+// ClassSupportsReadWriteMany reports whether the driver of a StorageClass
+// can serve ReadWriteMany claims: file drivers (NFS, SMB) can, block and
+// node-local drivers cannot.
+func ClassSupportsReadWriteMany(class storagev1.StorageClass) bool {
+	provisioner := strings.ToLower(class.Provisioner)
+	return strings.Contains(provisioner, "nfs") || strings.Contains(provisioner, "smb")
+}
+
+// BuildMigrationReport reports the claims of StorageClass from that would
+// move to StorageClass to. A claim is on from when its spec names it, or,
+// without a class in the spec, when its bound PV does. The target class
+// must be in in.StorageClasses; the source may already be deleted.
+func BuildMigrationReport(in MigrationInputs, from, to string) (*MigrationReport, error) {
+	classes := make(map[string]storagev1.StorageClass, len(in.StorageClasses))
+	for _, class := range in.StorageClasses {
+		classes[class.Name] = class
+	}
+	target, ok := classes[to]
+	if !ok {
+		return nil, fmt.Errorf("StorageClass %q not found", to)
+	}
+
+	report := &MigrationReport{
+		From:                from,
+		To:                  to,
+		TargetReadWriteMany: ClassSupportsReadWriteMany(target),
+		Namespaces:          []MigrationNamespace{},
+		Notes: []string{
+			"required bytes count the data on the source datasets without their snapshots, which are not migrated",
+			"a thick-provisioned target reserves the requested bytes instead",
+		},
+	}
+	if _, ok := classes[from]; !ok {
+		report.Notes = append(report.Notes, fmt.Sprintf("StorageClass %s no longer exists; its claims are listed from their specs", from))
+	}
+
+	pvs := make(map[string]corev1.PersistentVolume, len(in.PersistentVolumes))
+	for _, pv := range in.PersistentVolumes {
+		pvs[pv.Name] = pv
+	}
+	volumesByName := make(map[string]truenas.Volume, len(in.Volumes))
+	for _, volume := range in.Volumes {
+		volumesByName[volume.Name] = volume
+	}
+	snapshots := SnapshotsByDataset(in.Snapshots)
+	volumeSnapshots := map[string]int{}
+	for _, snapshot := range in.VolumeSnapshots {
+		if claim := snapshot.Spec.Source.PersistentVolumeClaimName; claim != nil {
+			volumeSnapshots[snapshot.Namespace+"/"+*claim]++
+		}
+	}
+
+	byNamespace := map[string]*MigrationNamespace{}
+	for _, pvc := range in.Claims {
+		pv, bound := pvs[pvc.Spec.VolumeName]
+		if claimStorageClass(pvc, pv) != from {
+			continue
+		}
+
+		claim := MigrationClaim{
+			Name:            pvc.Name,
+			AccessModes:     []string{},
+			VolumeSnapshots: volumeSnapshots[pvc.Namespace+"/"+pvc.Name],
+			Workloads:       ClaimWorkloads(pvc.Namespace, pvc.Name, in.Pods),
+			Blockers:        []string{},
+		}
+		for _, mode := range pvc.Spec.AccessModes {
+			claim.AccessModes = append(claim.AccessModes, string(mode))
+			if mode == corev1.ReadWriteMany && !report.TargetReadWriteMany {
+				claim.Blockers = append(claim.Blockers, fmt.Sprintf(
+					"ReadWriteMany claim; the %s driver of StorageClass %s serves ReadWriteOnce volumes only", target.Provisioner, to))
+			}
+		}
+		if storage, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			claim.RequestedBytes = storage.Value()
+		}
+		required := claim.RequestedBytes
+		if bound {
+			claim.PersistentVolume = pv.Name
+			if volume, ok := matchVolume(pv, in.Volumes, volumesByName); ok {
+				claim.Dataset = volume.Name
+				claim.UsedBytes = volume.Used
+				claim.TrueNASSnapshots = snapshots[volume.Name].Count
+				required = volume.Used
+			}
+		}
+
+		namespace, ok := byNamespace[pvc.Namespace]
+		if !ok {
+			namespace = &MigrationNamespace{Namespace: pvc.Namespace}
+			byNamespace[pvc.Namespace] = namespace
+		}
+		namespace.Claims = append(namespace.Claims, claim)
+		namespace.RequestedBytes += claim.RequestedBytes
+		namespace.UsedBytes += claim.UsedBytes
+		report.Claims++
+		report.RequestedBytes += claim.RequestedBytes
+		report.UsedBytes += claim.UsedBytes
+		report.Capacity.RequiredBytes += required
+		if len(claim.Blockers) > 0 {
+			report.Blocked++
+		}
+	}
+	for _, namespace := range byNamespace {
+		sort.Slice(namespace.Claims, func(i, j int) bool { return namespace.Claims[i].Name < namespace.Claims[j].Name })
+		report.Namespaces = append(report.Namespaces, *namespace)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool { return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace })
+
+	report.Capacity.TargetPool = targetPool(target)
+	if report.Capacity.TargetPool == "" {
+		report.Notes = append(report.Notes, fmt.Sprintf("StorageClass %s names no parent dataset, so its pool is unknown", to))
+		return report, nil
+	}
+	for _, pool := range in.Pools {
+		if pool.Name == report.Capacity.TargetPool {
+			fits := pool.Available >= report.Capacity.RequiredBytes
+			report.Capacity.AvailableBytes = pool.Available
+			report.Capacity.Fits = &fits
+		}
+	}
+	if report.Capacity.Fits == nil {
+		report.Notes = append(report.Notes, fmt.Sprintf("pool %s of StorageClass %s was not found on TrueNAS", report.Capacity.TargetPool, to))
+	}
+	return report, nil
+}
+
+// claimStorageClass is the class a claim's spec names, or that of its
+// bound PV when the spec names none.
+func claimStorageClass(pvc corev1.PersistentVolumeClaim, pv corev1.PersistentVolume) string {
+	if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+		return *pvc.Spec.StorageClassName
+	}
+	return pv.Spec.StorageClassName
+}
+
+// targetPool is the pool of a StorageClass's volume parent dataset.
+func targetPool(class storagev1.StorageClass) string {
+	parent := strings.Trim(classParameter(class, parentDatasetParameters[DatasetRoleVolumes]), "/")
+	pool, _, _ := strings.Cut(parent, "/")
+	return pool
+}
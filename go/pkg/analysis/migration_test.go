@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func migrationClaim(namespace, name, class, volume string, modes ...corev1.PersistentVolumeAccessMode) corev1.PersistentVolumeClaim {
+	pvc := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: modes,
+			VolumeName:  volume,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			},
+		},
+	}
+	if class != "" {
+		pvc.Spec.StorageClassName = &class
+	}
+	return pvc
+}
+
+func migrationPV(name, class string) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			StorageClassName: class,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: name},
+			},
+		},
+	}
+}
+
+func TestBuildMigrationReport(t *testing.T) {
+	claimName := "data"
+	in := MigrationInputs{
+		StorageClasses: []storagev1.StorageClass{
+			democraticClass("old-nfs", map[string]string{"datasetParentName": "tank/k8s/nfs"}),
+			{
+				ObjectMeta:  metav1.ObjectMeta{Name: "new-iscsi"},
+				Provisioner: "org.democratic-csi.iscsi",
+				Parameters:  map[string]string{"zfs.datasetParentName": "fast/k8s/iscsi"},
+			},
+		},
+		Claims: []corev1.PersistentVolumeClaim{
+			migrationClaim("apps", "data", "old-nfs", "pv-data", corev1.ReadWriteOnce),
+			migrationClaim("apps", "shared", "", "pv-shared", corev1.ReadWriteMany),
+			migrationClaim("web", "pending", "old-nfs", ""),
+			migrationClaim("web", "moved", "new-iscsi", "pv-moved", corev1.ReadWriteOnce),
+		},
+		PersistentVolumes: []corev1.PersistentVolume{
+			migrationPV("pv-data", "old-nfs"),
+			migrationPV("pv-shared", "old-nfs"),
+			migrationPV("pv-moved", "new-iscsi"),
+		},
+		VolumeSnapshots: []snapshotv1.VolumeSnapshot{{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "apps"},
+			Spec:       snapshotv1.VolumeSnapshotSpec{Source: snapshotv1.VolumeSnapshotSource{PersistentVolumeClaimName: &claimName}},
+		}},
+		Pods: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "apps"},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}},
+			}}},
+		}},
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/nfs/pv-data", Used: 3 << 30},
+			{Name: "tank/k8s/nfs/pv-shared", Used: 1 << 30},
+		},
+		Snapshots: []truenas.Snapshot{{Name: "tank/k8s/nfs/pv-data@nightly", Dataset: "tank/k8s/nfs/pv-data"}},
+		Pools:     []truenas.Pool{{Name: "fast", Available: 20 << 30}},
+	}
+
+	report, err := BuildMigrationReport(in, "old-nfs", "new-iscsi")
+	if err != nil {
+		t.Fatalf("BuildMigrationReport: %v", err)
+	}
+	if report.TargetReadWriteMany {
+		t.Fatal("an iSCSI target cannot serve ReadWriteMany")
+	}
+	if report.Claims != 3 || report.Blocked != 1 || len(report.Namespaces) != 2 {
+		t.Fatalf("claims = %d, blocked = %d, namespaces = %d, want 3, 1 and 2", report.Claims, report.Blocked, len(report.Namespaces))
+	}
+
+	apps := report.Namespaces[0]
+	if apps.Namespace != "apps" || len(apps.Claims) != 2 || apps.UsedBytes != 4<<30 {
+		t.Fatalf("apps = %+v", apps)
+	}
+	data, shared := apps.Claims[0], apps.Claims[1]
+	if data.Dataset != "tank/k8s/nfs/pv-data" || data.VolumeSnapshots != 1 || data.TrueNASSnapshots != 1 || len(data.Blockers) != 0 {
+		t.Fatalf("data = %+v", data)
+	}
+	if len(data.Workloads) != 1 || data.Workloads[0].Name != "db-0" {
+		t.Fatalf("data workloads = %+v", data.Workloads)
+	}
+	if len(shared.Blockers) != 1 || !strings.Contains(shared.Blockers[0], "ReadWriteMany") {
+		t.Fatalf("shared blockers = %v, want the ReadWriteMany blocker", shared.Blockers)
+	}
+
+	// The pending claim has no dataset, so its request counts.
+	if want := int64(3<<30 + 1<<30 + 10<<30); report.Capacity.RequiredBytes != want {
+		t.Fatalf("required = %d, want %d", report.Capacity.RequiredBytes, want)
+	}
+	if report.Capacity.TargetPool != "fast" || report.Capacity.Fits == nil || !*report.Capacity.Fits {
+		t.Fatalf("capacity = %+v, want fitting on fast", report.Capacity)
+	}
+}
+
+func TestBuildMigrationReport_UnknownTarget(t *testing.T) {
+	if _, err := BuildMigrationReport(MigrationInputs{}, "old", "missing"); err == nil {
+		t.Fatal("expected an error for a missing target class")
+	}
+}
@@ -0,0 +1,196 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// NFSMountAlertCategory is the alert category used for NFS PVs whose share is
+// not exportable.
+const NFSMountAlertCategory = "nfs_mountpoint"
+
+// NFSMountViolation describes an NFS-backed PV whose share path is not a
+// dataset mountpoint or is not covered by an enabled NFS share.
+type NFSMountViolation struct {
+	PersistentVolume string `json:"persistent_volume"`
+	// Claim is the bound PVC as namespace/name, if any.
+	Claim     string `json:"claim,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Dataset   string `json:"dataset"`
+	SharePath string `json:"share_path"`
+	Reason    string `json:"reason"`
+	Category  string `json:"category"`
+}
+
+// NFSMountReport is the result of one sampled NFS deep check. Checked lists
+// the PVs verified in this run; PVs not listed keep their previous status.
+type NFSMountReport struct {
+	Timestamp  time.Time           `json:"timestamp"`
+	Total      int                 `json:"total"`
+	Checked    []string            `json:"checked"`
+	Violations []NFSMountViolation `json:"violations"`
+}
+
+// NFSMountChecker verifies that NFS-backed PVs point at a mounted dataset
+// exported by an enabled NFS share. The first Check covers every NFS PV;
+// later checks cover a rotating sample of the NFS PVs plus every PV that
+// failed the previous check, so failures are re-verified on every run.
+type NFSMountChecker struct {
+	client     truenas.Client
+	sampleRate float64
+
+	mu      sync.Mutex
+	primed  bool
+	offset  int
+	failing map[string]bool
+}
+
+// NewNFSMountChecker creates a checker sampling sampleRate (0 < rate <= 1) of
+// the NFS PVs per run.
+func NewNFSMountChecker(client truenas.Client, sampleRate float64) *NFSMountChecker {
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+	return &NFSMountChecker{
+		client:     client,
+		sampleRate: sampleRate,
+		failing:    make(map[string]bool),
+	}
+}
+
+// Check verifies the next sample of NFS-backed PVs in pvs.
+func (c *NFSMountChecker) Check(ctx context.Context, pvs []corev1.PersistentVolume, now time.Time) (*NFSMountReport, error) {
+	nfsPVs := make([]corev1.PersistentVolume, 0, len(pvs))
+	for _, pv := range pvs {
+		if nfsSharePath(pv) != "" {
+			nfsPVs = append(nfsPVs, pv)
+		}
+	}
+	sort.Slice(nfsPVs, func(i, j int) bool { return nfsPVs[i].Name < nfsPVs[j].Name })
+
+	report := &NFSMountReport{
+		Timestamp:  now,
+		Total:      len(nfsPVs),
+		Checked:    []string{},
+		Violations: []NFSMountViolation{},
+	}
+	if len(nfsPVs) == 0 {
+		return report, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sample := c.sample(nfsPVs)
+	shares, err := c.client.GetNFSShares(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NFS shares: %w", err)
+	}
+
+	failing := make(map[string]bool)
+	for _, pv := range sample {
+		violation, err := c.checkPV(ctx, pv, shares)
+		if err != nil {
+			return nil, err
+		}
+		report.Checked = append(report.Checked, pv.Name)
+		if violation != nil {
+			failing[pv.Name] = true
+			report.Violations = append(report.Violations, *violation)
+		}
+	}
+	c.failing = failing
+	c.primed = true
+	return report, nil
+}
+
+// sample returns the next rotating slice of pvs plus previously failing PVs.
+func (c *NFSMountChecker) sample(pvs []corev1.PersistentVolume) []corev1.PersistentVolume {
+	if !c.primed {
+		return pvs
+	}
+
+	size := int(math.Ceil(c.sampleRate * float64(len(pvs))))
+	selected := make(map[string]bool, size)
+	if c.offset >= len(pvs) {
+		c.offset = 0
+	}
+	for i := 0; i < size; i++ {
+		selected[pvs[(c.offset+i)%len(pvs)].Name] = true
+	}
+	c.offset = (c.offset + size) % len(pvs)
+
+	var sample []corev1.PersistentVolume
+	for _, pv := range pvs {
+		if selected[pv.Name] || c.failing[pv.Name] {
+			sample = append(sample, pv)
+		}
+	}
+	return sample
+}
+
+func (c *NFSMountChecker) checkPV(ctx context.Context, pv corev1.PersistentVolume, shares []truenas.NFSShare) (*NFSMountViolation, error) {
+	sharePath := nfsSharePath(pv)
+	violation := &NFSMountViolation{
+		PersistentVolume: pv.Name,
+		Dataset:          strings.TrimPrefix(sharePath, "/mnt/"),
+		SharePath:        sharePath,
+		Category:         NFSMountAlertCategory,
+	}
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		violation.Claim = ref.Namespace + "/" + ref.Name
+		violation.Namespace = ref.Namespace
+	}
+
+	dataset, err := c.client.GetDataset(ctx, violation.Dataset)
+	switch {
+	case errors.Is(err, truenas.ErrDatasetNotFound):
+		violation.Reason = fmt.Sprintf("dataset %s does not exist", violation.Dataset)
+		return violation, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get dataset %s: %w", violation.Dataset, err)
+	case dataset.Path == "":
+		violation.Reason = fmt.Sprintf("dataset %s exists but is not mounted", violation.Dataset)
+		return violation, nil
+	case strings.TrimRight(dataset.Path, "/") != strings.TrimRight(sharePath, "/"):
+		violation.Reason = fmt.Sprintf("dataset is mounted at %q, not at the share path", dataset.Path)
+		return violation, nil
+	}
+
+	covered := false
+	for _, share := range shares {
+		if !share.Covers(sharePath) {
+			continue
+		}
+		if share.Enabled {
+			return nil, nil
+		}
+		covered = true
+	}
+	if covered {
+		violation.Reason = "NFS share covering the path is disabled"
+	} else {
+		violation.Reason = "no NFS share exports the path"
+	}
+	return violation, nil
+}
+
+// nfsSharePath returns the exported path of an NFS-backed democratic-csi PV,
+// or "" for other PVs.
+func nfsSharePath(pv corev1.PersistentVolume) string {
+	if pv.Spec.CSI == nil {
+		return ""
+	}
+	return k8s.NFSSharePath(pv.Spec.CSI.Driver, pv.Spec.CSI.VolumeAttributes)
+}
@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func nfsPV(name, share string) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			ClaimRef: &corev1.ObjectReference{Namespace: "apps", Name: "data-" + name},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:           "org.democratic-csi.nfs",
+					VolumeHandle:     name,
+					VolumeAttributes: map[string]string{"server": "truenas", "share": share},
+				},
+			},
+		},
+	}
+}
+
+func TestNFSMountChecker_ReportsUnexportableShares(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	client := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{ID: "tank/k8s/ok", Name: "tank/k8s/ok", Path: "/mnt/tank/k8s/ok"},
+			{ID: "tank/k8s/disabled", Name: "tank/k8s/disabled", Path: "/mnt/tank/k8s/disabled"},
+			{ID: "tank/k8s/moved", Name: "tank/k8s/moved", Path: "/mnt/tank/k8s/elsewhere"},
+		},
+		NFSShares: []truenas.NFSShare{
+			{ID: 1, Path: "/mnt/tank/k8s/ok", Enabled: true},
+			{ID: 2, Path: "/mnt/tank/k8s/disabled", Enabled: false},
+		},
+	}
+	pvs := []corev1.PersistentVolume{
+		nfsPV("pv-ok", "/mnt/tank/k8s/ok"),
+		nfsPV("pv-disabled", "/mnt/tank/k8s/disabled"),
+		nfsPV("pv-moved", "/mnt/tank/k8s/moved"),
+		nfsPV("pv-renamed", "/mnt/tank/k8s/renamed"),
+		testPV("pv-iscsi", "10Gi"),
+	}
+
+	report, err := NewNFSMountChecker(client, 0).Check(context.Background(), pvs, now)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if report.Total != 4 || len(report.Checked) != 4 {
+		t.Fatalf("total=%d checked=%v, want 4 NFS PVs checked", report.Total, report.Checked)
+	}
+
+	reasons := make(map[string]string)
+	for _, violation := range report.Violations {
+		if violation.Claim != "apps/data-"+violation.PersistentVolume {
+			t.Fatalf("violation %s has claim %q", violation.PersistentVolume, violation.Claim)
+		}
+		reasons[violation.PersistentVolume] = violation.Reason
+	}
+	want := map[string]string{
+		"pv-disabled": "disabled",
+		"pv-moved":    "mounted at",
+		"pv-renamed":  "does not exist",
+	}
+	if len(reasons) != len(want) {
+		t.Fatalf("violations = %v, want %v", reasons, want)
+	}
+	for pv, fragment := range want {
+		if !strings.Contains(reasons[pv], fragment) {
+			t.Fatalf("%s reason = %q, want it to mention %q", pv, reasons[pv], fragment)
+		}
+	}
+}
+
+func TestNFSMountChecker_SamplesAndRechecksFailures(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	client := &truenastest.Client{}
+	var pvs []corev1.PersistentVolume
+	for _, name := range []string{"pv-a", "pv-b", "pv-c", "pv-d"} {
+		share := "/mnt/tank/k8s/" + name
+		pvs = append(pvs, nfsPV(name, share))
+		client.Volumes = append(client.Volumes, truenas.Volume{ID: "tank/k8s/" + name, Path: share})
+		client.NFSShares = append(client.NFSShares, truenas.NFSShare{Path: share, Enabled: name != "pv-d"})
+	}
+	checker := NewNFSMountChecker(client, 0.25)
+
+	checked := func() []string {
+		t.Helper()
+		report, err := checker.Check(context.Background(), pvs, now)
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		return report.Checked
+	}
+
+	if got := checked(); len(got) != 4 {
+		t.Fatalf("first check = %v, want every PV", got)
+	}
+	if got := strings.Join(checked(), ","); got != "pv-a,pv-d" {
+		t.Fatalf("second check = %s, want pv-a plus failing pv-d", got)
+	}
+	if got := strings.Join(checked(), ","); got != "pv-b,pv-d" {
+		t.Fatalf("third check = %s, want pv-b plus failing pv-d", got)
+	}
+}
@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+// Workload is a controller whose pods mount a volume. Pods without a
+// controller are reported with kind Pod.
+type Workload struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Pods []string `json:"pods"`
+}
+
+// DatasetOwner is the Kubernetes side of a TrueNAS dataset.
+type DatasetOwner struct {
+	Dataset               string     `json:"dataset"`
+	PersistentVolume      string     `json:"persistent_volume"`
+	StorageClass          string     `json:"storage_class,omitempty"`
+	VolumeHandle          string     `json:"volume_handle"`
+	Namespace             string     `json:"namespace,omitempty"`
+	PersistentVolumeClaim string     `json:"persistent_volume_claim,omitempty"`
+	Workloads             []Workload `json:"workloads"`
+}
+
+// ManagedDatasetPrefixes returns the distinct volume parent datasets of the
+// democratic-csi StorageClasses, sorted.
+func ManagedDatasetPrefixes(classes []storagev1.StorageClass) []string {
+	seen := map[string]bool{}
+	prefixes := []string{}
+	for _, class := range classes {
+		if !strings.Contains(class.Provisioner, "democratic-csi") {
+			continue
+		}
+		parent := classParameter(class, parentDatasetParameters[DatasetRoleVolumes])
+		if parent != "" && !seen[parent] {
+			seen[parent] = true
+			prefixes = append(prefixes, parent)
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// UnderPrefixes reports whether dataset is one of prefixes or nested in one.
+func UnderPrefixes(dataset string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if dataset == prefix || strings.HasPrefix(dataset, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FindDatasetOwner resolves a dataset to the PV whose volume handle
+// correlates with it. When the PV's StorageClass names a parent dataset, the
+// dataset must be the handle's child of that parent; otherwise the handle
+// suffix match used for correlation applies. Workloads are left empty; see
+// ClaimWorkloads.
+func FindDatasetOwner(dataset string, pvs []corev1.PersistentVolume, classes []storagev1.StorageClass) (*DatasetOwner, bool) {
+	dataset = strings.Trim(dataset, "/")
+	parents := make(map[string]string, len(classes))
+	for _, class := range classes {
+		if parent := classParameter(class, parentDatasetParameters[DatasetRoleVolumes]); parent != "" {
+			parents[class.Name] = parent
+		}
+	}
+
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle == "" {
+			continue
+		}
+		handle := pv.Spec.CSI.VolumeHandle
+		if parent, ok := parents[pv.Spec.StorageClassName]; ok {
+			if dataset != parent+"/"+handle {
+				continue
+			}
+		} else if dataset != handle && !strings.HasSuffix(dataset, "/"+handle) {
+			continue
+		}
+
+		owner := &DatasetOwner{
+			Dataset:          dataset,
+			PersistentVolume: pv.Name,
+			StorageClass:     pv.Spec.StorageClassName,
+			VolumeHandle:     handle,
+			Workloads:        []Workload{},
+		}
+		if ref := pv.Spec.ClaimRef; ref != nil && ref.Name != "" {
+			owner.Namespace = ref.Namespace
+			owner.PersistentVolumeClaim = ref.Name
+		}
+		return owner, true
+	}
+	return nil, false
+}
+
+// ClaimWorkloads groups the pods mounting a claim by controller. Pods are
+// matched by their persistentVolumeClaim volumes; finished pods are ignored.
+func ClaimWorkloads(namespace, claim string, pods []corev1.Pod) []Workload {
+	byKey := map[string]*Workload{}
+	var keys []string
+	for _, pod := range pods {
+		if pod.Namespace != namespace || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if !podMountsClaim(pod, claim) {
+			continue
+		}
+		kind, name := podWorkload(pod)
+		key := kind + "/" + name
+		workload, ok := byKey[key]
+		if !ok {
+			workload = &Workload{Kind: kind, Name: name}
+			byKey[key] = workload
+			keys = append(keys, key)
+		}
+		workload.Pods = append(workload.Pods, pod.Name)
+	}
+	sort.Strings(keys)
+
+	workloads := make([]Workload, 0, len(keys))
+	for _, key := range keys {
+		workload := byKey[key]
+		sort.Strings(workload.Pods)
+		workloads = append(workloads, *workload)
+	}
+	return workloads
+}
+
+func podMountsClaim(pod corev1.Pod, claim string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claim {
+			return true
+		}
+	}
+	return false
+}
+
+// podWorkload names the controller of a pod. ReplicaSets created by a
+// Deployment are reported as the Deployment.
+func podWorkload(pod corev1.Pod) (string, string) {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "ReplicaSet" {
+			if hash := pod.Labels["pod-template-hash"]; hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+				return "Deployment", strings.TrimSuffix(ref.Name, "-"+hash)
+			}
+		}
+		return ref.Kind, ref.Name
+	}
+	return "Pod", pod.Name
+}
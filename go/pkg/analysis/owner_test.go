@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func claimPod(name, claim string, phase corev1.PodPhase, owner *metav1.OwnerReference, labels map[string]string) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", Labels: labels},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			Name:         "data",
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+		}}},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func TestFindDatasetOwner(t *testing.T) {
+	controller := true
+	classes := []storagev1.StorageClass{
+		democraticClass("nfs", map[string]string{"datasetParentName": "tank/k8s/nfs/vols"}),
+		democraticClass("iscsi", map[string]string{"zfs.datasetParentName": "/fast/k8s/iscsi/"}),
+		democraticClass("nfs-copy", map[string]string{"datasetParentName": "tank/k8s/nfs/vols"}),
+	}
+	bound := testPV("pvc-a", "1Gi")
+	bound.Spec.StorageClassName = "nfs"
+	bound.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	legacy := testPV("pvc-b", "1Gi")
+	pvs := []corev1.PersistentVolume{bound, legacy}
+
+	pods := []corev1.Pod{
+		claimPod("web-7d9f-abcde", "data", corev1.PodRunning,
+			&metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-7d9f", Controller: &controller},
+			map[string]string{"pod-template-hash": "7d9f"}),
+		claimPod("web-7d9f-fghij", "data", corev1.PodRunning,
+			&metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-7d9f", Controller: &controller},
+			map[string]string{"pod-template-hash": "7d9f"}),
+		claimPod("db-0", "data", corev1.PodRunning,
+			&metav1.OwnerReference{Kind: "StatefulSet", Name: "db", Controller: &controller}, nil),
+		claimPod("debug", "data", corev1.PodPending, nil, nil),
+		claimPod("migrate-xyz", "data", corev1.PodSucceeded,
+			&metav1.OwnerReference{Kind: "Job", Name: "migrate", Controller: &controller}, nil),
+		claimPod("other", "logs", corev1.PodRunning, nil, nil),
+	}
+
+	owner, ok := FindDatasetOwner("tank/k8s/nfs/vols/pvc-a", pvs, classes)
+	if !ok {
+		t.Fatal("expected an owner for pvc-a")
+	}
+	if owner.PersistentVolume != "pvc-a" || owner.Namespace != "apps" || owner.PersistentVolumeClaim != "data" {
+		t.Fatalf("unexpected owner: %+v", owner)
+	}
+	workloads := ClaimWorkloads("apps", "data", pods)
+	want := []Workload{
+		{Kind: "Deployment", Name: "web", Pods: []string{"web-7d9f-abcde", "web-7d9f-fghij"}},
+		{Kind: "Pod", Name: "debug", Pods: []string{"debug"}},
+		{Kind: "StatefulSet", Name: "db", Pods: []string{"db-0"}},
+	}
+	if len(workloads) != len(want) {
+		t.Fatalf("workloads = %+v, want %+v", workloads, want)
+	}
+	for i := range want {
+		got := workloads[i]
+		if got.Kind != want[i].Kind || got.Name != want[i].Name || len(got.Pods) != len(want[i].Pods) || got.Pods[0] != want[i].Pods[0] {
+			t.Fatalf("workloads[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// A matching handle outside the class's parent dataset is not the PV's.
+	if _, ok := FindDatasetOwner("fast/k8s/pvc-a", pvs, classes); ok {
+		t.Fatal("dataset outside the class parent should not match")
+	}
+
+	// Without a class parent the handle suffix is enough.
+	owner, ok = FindDatasetOwner("fast/legacy/pvc-b", pvs, classes)
+	if !ok || owner.PersistentVolume != "pvc-b" || owner.PersistentVolumeClaim != "" {
+		t.Fatalf("unexpected owner for pvc-b: %+v", owner)
+	}
+
+	prefixes := ManagedDatasetPrefixes(classes)
+	if len(prefixes) != 2 || prefixes[0] != "fast/k8s/iscsi" || prefixes[1] != "tank/k8s/nfs/vols" {
+		t.Fatalf("prefixes = %v", prefixes)
+	}
+	if !UnderPrefixes("tank/k8s/nfs/vols/pvc-x", prefixes) || UnderPrefixes("tank/k8s/nfs/volsx", prefixes) {
+		t.Fatal("UnderPrefixes must match whole path components")
+	}
+}
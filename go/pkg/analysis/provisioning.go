@@ -0,0 +1,169 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+// DefaultProvisioningWindow is how far back bound PVCs are measured when
+// no window is configured.
+const DefaultProvisioningWindow = 24 * time.Hour
+
+// ProvisioningSample is how long one PVC took to be provisioned and bound.
+type ProvisioningSample struct {
+	Namespace    string        `json:"namespace"`
+	Claim        string        `json:"claim"`
+	UID          string        `json:"uid"`
+	StorageClass string        `json:"storage_class"`
+	BoundAt      time.Time     `json:"bound_at"`
+	Duration     time.Duration `json:"duration"`
+	// FromFirstConsumer is set for WaitForFirstConsumer claims, which are
+	// measured from the creation of their first pod instead of their own.
+	FromFirstConsumer bool `json:"from_first_consumer,omitempty"`
+}
+
+// ProvisioningLatency summarizes the provisioning durations of one storage
+// class, or of all classes when StorageClass is empty.
+type ProvisioningLatency struct {
+	StorageClass string  `json:"storage_class,omitempty"`
+	Count        int     `json:"count"`
+	P50Seconds   float64 `json:"p50_seconds"`
+	P95Seconds   float64 `json:"p95_seconds"`
+}
+
+// ProvisioningReport is the provisioning latency over a window.
+type ProvisioningReport struct {
+	Window  time.Duration         `json:"window"`
+	Overall ProvisioningLatency   `json:"overall"`
+	Classes []ProvisioningLatency `json:"classes"`
+}
+
+// ProvisioningSamples measures the PVCs bound since the given time. A PVC is
+// bound when its PV is created, so the PV creation time is the bind time;
+// PVCs bound to a PV that predates them were not provisioned and are
+// skipped. WaitForFirstConsumer PVCs start when the first pod using them was
+// created, since the scheduler only then selects a node; without such a pod
+// they are skipped rather than counted from the PVC's creation.
+func ProvisioningSamples(pvcs []corev1.PersistentVolumeClaim, pvs []corev1.PersistentVolume, classes []storagev1.StorageClass, pods []corev1.Pod, since time.Time) []ProvisioningSample {
+	pvsByName := make(map[string]corev1.PersistentVolume, len(pvs))
+	for _, pv := range pvs {
+		pvsByName[pv.Name] = pv
+	}
+	waitForFirstConsumer := make(map[string]bool)
+	for _, class := range classes {
+		if class.VolumeBindingMode != nil && *class.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+			waitForFirstConsumer[class.Name] = true
+		}
+	}
+	firstConsumers := firstConsumerCreation(pods)
+
+	var samples []ProvisioningSample
+	for _, pvc := range pvcs {
+		if pvc.Status.Phase != corev1.ClaimBound || pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, ok := pvsByName[pvc.Spec.VolumeName]
+		if !ok {
+			continue
+		}
+		boundAt := pv.CreationTimestamp.Time
+		if boundAt.Before(since) {
+			continue
+		}
+
+		sample := ProvisioningSample{
+			Namespace: pvc.Namespace,
+			Claim:     pvc.Name,
+			UID:       string(pvc.UID),
+			BoundAt:   boundAt,
+		}
+		if pvc.Spec.StorageClassName != nil {
+			sample.StorageClass = *pvc.Spec.StorageClassName
+		}
+
+		start := pvc.CreationTimestamp.Time
+		if waitForFirstConsumer[sample.StorageClass] {
+			created, ok := firstConsumers[pvc.Namespace+"/"+pvc.Name]
+			if !ok {
+				continue
+			}
+			if created.After(start) {
+				start = created
+			}
+			sample.FromFirstConsumer = true
+		}
+		if boundAt.Before(start) {
+			continue
+		}
+		sample.Duration = boundAt.Sub(start)
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// firstConsumerCreation returns, per "namespace/claim", when the oldest pod
+// mounting the claim was created.
+func firstConsumerCreation(pods []corev1.Pod) map[string]time.Time {
+	first := make(map[string]time.Time)
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			key := pod.Namespace + "/" + volume.PersistentVolumeClaim.ClaimName
+			created := pod.CreationTimestamp.Time
+			if current, ok := first[key]; !ok || created.Before(current) {
+				first[key] = created
+			}
+		}
+	}
+	return first
+}
+
+// SummarizeProvisioning computes p50 and p95 provisioning durations overall
+// and per storage class.
+func SummarizeProvisioning(samples []ProvisioningSample, window time.Duration) *ProvisioningReport {
+	byClass := make(map[string][]time.Duration)
+	all := make([]time.Duration, 0, len(samples))
+	for _, sample := range samples {
+		byClass[sample.StorageClass] = append(byClass[sample.StorageClass], sample.Duration)
+		all = append(all, sample.Duration)
+	}
+
+	report := &ProvisioningReport{
+		Window:  window,
+		Overall: provisioningLatency("", all),
+		Classes: make([]ProvisioningLatency, 0, len(byClass)),
+	}
+	for class, durations := range byClass {
+		report.Classes = append(report.Classes, provisioningLatency(class, durations))
+	}
+	sort.Slice(report.Classes, func(i, j int) bool {
+		return report.Classes[i].StorageClass < report.Classes[j].StorageClass
+	})
+	return report
+}
+
+func provisioningLatency(class string, durations []time.Duration) ProvisioningLatency {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return ProvisioningLatency{
+		StorageClass: class,
+		Count:        len(durations),
+		P50Seconds:   percentile(durations, 0.50).Seconds(),
+		P95Seconds:   percentile(durations, 0.95).Seconds(),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations, or 0
+// when there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,89 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func boundPVC(name, class string, created time.Time) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", UID: types.UID("uid-" + name), CreationTimestamp: metav1.NewTime(created)},
+		Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &class, VolumeName: "pv-" + name},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+}
+
+func provisionedPV(claim string, created time.Time) corev1.PersistentVolume {
+	return corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-" + claim, CreationTimestamp: metav1.NewTime(created)}}
+}
+
+func TestProvisioningSamples(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	wffc := storagev1.VolumeBindingWaitForFirstConsumer
+	classes := []storagev1.StorageClass{{ObjectMeta: metav1.ObjectMeta{Name: "local"}, VolumeBindingMode: &wffc}}
+
+	pvcs := []corev1.PersistentVolumeClaim{
+		boundPVC("fast", "nfs", now.Add(-time.Hour)),
+		boundPVC("old", "nfs", now.Add(-48*time.Hour)),
+		boundPVC("static", "nfs", now.Add(-time.Hour)),
+		boundPVC("deferred", "local", now.Add(-3*time.Hour)),
+		boundPVC("no-pod", "local", now.Add(-time.Hour)),
+	}
+	pvs := []corev1.PersistentVolume{
+		provisionedPV("fast", now.Add(-time.Hour+5*time.Second)),
+		provisionedPV("old", now.Add(-48*time.Hour+time.Second)),
+		provisionedPV("static", now.Add(-2*time.Hour)),
+		provisionedPV("deferred", now.Add(-time.Hour+20*time.Second)),
+		provisionedPV("no-pod", now.Add(-time.Hour+time.Second)),
+	}
+	pods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "apps", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "deferred"},
+		}}}},
+	}}
+
+	samples := ProvisioningSamples(pvcs, pvs, classes, pods, now.Add(-24*time.Hour))
+	got := make(map[string]ProvisioningSample)
+	for _, sample := range samples {
+		got[sample.Claim] = sample
+	}
+	if len(got) != 2 {
+		t.Fatalf("samples = %+v, want fast and deferred", samples)
+	}
+	if got["fast"].Duration != 5*time.Second || got["fast"].FromFirstConsumer {
+		t.Fatalf("fast = %+v", got["fast"])
+	}
+	if got["deferred"].Duration != 20*time.Second || !got["deferred"].FromFirstConsumer {
+		t.Fatalf("deferred = %+v, want 20s from its pod's creation", got["deferred"])
+	}
+}
+
+func TestSummarizeProvisioning(t *testing.T) {
+	var samples []ProvisioningSample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, ProvisioningSample{StorageClass: "nfs", Duration: time.Duration(i) * time.Second})
+	}
+	samples = append(samples, ProvisioningSample{StorageClass: "iscsi", Duration: time.Minute})
+
+	report := SummarizeProvisioning(samples, 24*time.Hour)
+	if report.Overall.Count != 21 || report.Overall.P50Seconds != 11 || report.Overall.P95Seconds != 20 {
+		t.Fatalf("overall = %+v", report.Overall)
+	}
+	want := []ProvisioningLatency{
+		{StorageClass: "iscsi", Count: 1, P50Seconds: 60, P95Seconds: 60},
+		{StorageClass: "nfs", Count: 20, P50Seconds: 10, P95Seconds: 19},
+	}
+	if len(report.Classes) != 2 || report.Classes[0] != want[0] || report.Classes[1] != want[1] {
+		t.Fatalf("classes = %+v, want %+v", report.Classes, want)
+	}
+
+	if empty := SummarizeProvisioning(nil, time.Hour); empty.Overall.Count != 0 || len(empty.Classes) != 0 {
+		t.Fatalf("empty = %+v", empty)
+	}
+}
@@ -0,0 +1,247 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Recommendation types and severities, as in the recommendation definition
+// of shared/schemas/storage-analysis.json.
+const (
+	RecommendationTypeQuota = "quota"
+
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// DefaultQuotaSlackPercent is the headroom added to the PV capacity when
+// suggesting a refquota.
+const DefaultQuotaSlackPercent = 10.0
+
+// Recommendation is an actionable finding about a single resource.
+type Recommendation struct {
+	Type        string `json:"type"`
+	Severity    string `json:"severity"`
+	Resource    string `json:"resource"`
+	Description string `json:"description"`
+	Action      string `json:"action"`
+	Impact      string `json:"impact,omitempty"`
+	// SuggestedRefquotaBytes is the refquota a quota recommendation proposes;
+	// ApplyRefquotas sets it.
+	SuggestedRefquotaBytes int64 `json:"suggested_refquota_bytes,omitempty"`
+	// BlastRadiusReductionBytes is how much less pool space the dataset could
+	// consume with the suggested refquota.
+	BlastRadiusReductionBytes int64 `json:"blast_radius_reduction_bytes,omitempty"`
+}
+
+// QuotaOptions enables refquota recommendations for PV datasets.
+type QuotaOptions struct {
+	Enabled bool
+	// SlackPercent is added to the PV capacity for the suggested refquota;
+	// zero uses DefaultQuotaSlackPercent.
+	SlackPercent float64
+}
+
+// QuotaRecommendations inspects the datasets backing PVs. Filesystem datasets
+// without a refquota can grow into all free pool space, so a refquota of the
+// PV capacity plus slack is suggested; datasets already using more than
+// their PV capacity are flagged instead, since that refquota would make
+// them read-only. Zvols are bounded by their volsize and only flagged.
+func QuotaRecommendations(in Inputs, opts QuotaOptions) []Recommendation {
+	slack := opts.SlackPercent
+	if slack <= 0 {
+		slack = DefaultQuotaSlackPercent
+	}
+
+	byName := volumesByName(in.Volumes)
+	recs := []Recommendation{}
+	for _, pv := range in.PersistentVolumes {
+		volume, ok := matchVolume(pv, in.Volumes, byName)
+		if !ok {
+			continue
+		}
+		storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]
+		if !ok || storage.Value() <= 0 {
+			continue
+		}
+		capacity := storage.Value()
+		refquota := parseRefquota(volume.Properties["refquota"])
+		owner := pvDescription(pv)
+
+		if volume.Used > capacity {
+			rec := Recommendation{
+				Type:     RecommendationTypeQuota,
+				Severity: SeverityHigh,
+				Resource: volume.Name,
+				Description: fmt.Sprintf("Dataset %s uses %s, more than the %s capacity of %s",
+					volume.Name, humanize.Bytes(volume.Used), humanize.Bytes(capacity), owner),
+				Action: fmt.Sprintf("Expand the claim to at least %s or free space in the volume", humanize.Bytes(volume.Used)),
+			}
+			if refquota == 0 && volume.Type != truenas.VolumeTypeZvol {
+				rec.Impact = fmt.Sprintf("Without a refquota it can grow by another %s of pool space", humanize.Bytes(volume.Available))
+			}
+			recs = append(recs, rec)
+			continue
+		}
+		if refquota > 0 || volume.Type == truenas.VolumeTypeZvol || volume.Type == truenas.VolumeTypeSMB {
+			continue
+		}
+
+		suggested := int64(math.Ceil(float64(capacity) * (1 + slack/100)))
+		growthLimit := volume.Used + volume.Available
+		rec := Recommendation{
+			Type:        RecommendationTypeQuota,
+			Severity:    SeverityMedium,
+			Resource:    volume.Name,
+			Description: fmt.Sprintf("Dataset %s backing %s has no refquota", volume.Name, owner),
+			Action: fmt.Sprintf("Set refquota to %s (capacity %s plus %g%% slack)",
+				humanize.Bytes(suggested), humanize.Bytes(capacity), slack),
+			SuggestedRefquotaBytes: suggested,
+		}
+		if reduction := growthLimit - suggested; reduction > 0 {
+			rec.BlastRadiusReductionBytes = reduction
+			rec.Impact = fmt.Sprintf("Limits the space the dataset can consume from %s to %s",
+				humanize.Bytes(growthLimit), humanize.Bytes(suggested))
+		} else {
+			rec.Severity = SeverityLow
+			rec.Impact = "The pool has less free space than the suggested refquota; the quota guards against future pool growth"
+		}
+		recs = append(recs, rec)
+	}
+
+	rank := map[string]int{SeverityHigh: 0, SeverityMedium: 1, SeverityLow: 2}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if rank[recs[i].Severity] != rank[recs[j].Severity] {
+			return rank[recs[i].Severity] < rank[recs[j].Severity]
+		}
+		if recs[i].BlastRadiusReductionBytes != recs[j].BlastRadiusReductionBytes {
+			return recs[i].BlastRadiusReductionBytes > recs[j].BlastRadiusReductionBytes
+		}
+		return recs[i].Resource < recs[j].Resource
+	})
+	return recs
+}
+
+// poolQuotaRecommendations summarizes quota recommendations per pool.
+func poolQuotaRecommendations(recs []Recommendation) []string {
+	type poolSummary struct {
+		unquoted     int
+		overCapacity int
+		reduction    int64
+	}
+	pools := map[string]*poolSummary{}
+	var names []string
+	for _, rec := range recs {
+		pool, _, _ := strings.Cut(rec.Resource, "/")
+		summary, ok := pools[pool]
+		if !ok {
+			summary = &poolSummary{}
+			pools[pool] = summary
+			names = append(names, pool)
+		}
+		if rec.SuggestedRefquotaBytes > 0 {
+			summary.unquoted++
+			summary.reduction += rec.BlastRadiusReductionBytes
+		} else {
+			summary.overCapacity++
+		}
+	}
+	sort.Strings(names)
+
+	out := []string{}
+	for _, name := range names {
+		summary := pools[name]
+		if summary.unquoted > 0 {
+			out = append(out, fmt.Sprintf(
+				"Pool %s has %d PV datasets without a refquota; the suggested quotas cut their worst-case growth by %s",
+				name, summary.unquoted, humanize.Bytes(summary.reduction)))
+		}
+		if summary.overCapacity > 0 {
+			out = append(out, fmt.Sprintf(
+				"Pool %s has %d PV datasets using more than their PV capacity; expand the claims or free space",
+				name, summary.overCapacity))
+		}
+	}
+	return out
+}
+
+// RefquotaChange reports a refquota set, or planned in a dry run, by
+// ApplyRefquotas.
+type RefquotaChange struct {
+	Dataset       string `json:"dataset"`
+	RefquotaBytes int64  `json:"refquota_bytes"`
+	Applied       bool   `json:"applied"`
+	Skipped       string `json:"skipped,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ApplyRefquotas sets the suggested refquota of each quota recommendation
+// whose dataset is in datasets, or of all of them when datasets is empty.
+// Each dataset is re-read first and skipped when it gained a refquota or
+// outgrew the suggestion since the analysis. A dry run only reports what
+// would be set.
+func ApplyRefquotas(ctx context.Context, truenasClient truenas.Client, recs []Recommendation, datasets []string, dryRun bool) []RefquotaChange {
+	wanted := make(map[string]bool, len(datasets))
+	for _, dataset := range datasets {
+		wanted[dataset] = true
+	}
+
+	changes := []RefquotaChange{}
+	for _, rec := range recs {
+		if rec.Type != RecommendationTypeQuota || rec.SuggestedRefquotaBytes <= 0 {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[rec.Resource] {
+			continue
+		}
+		change := RefquotaChange{Dataset: rec.Resource, RefquotaBytes: rec.SuggestedRefquotaBytes}
+
+		current, err := truenasClient.GetDataset(ctx, rec.Resource)
+		switch {
+		case err != nil:
+			change.Error = err.Error()
+		case parseRefquota(current.Properties["refquota"]) > 0:
+			change.Skipped = "dataset already has a refquota"
+		case current.Used >= rec.SuggestedRefquotaBytes:
+			change.Skipped = "dataset grew beyond the suggested refquota"
+		case dryRun:
+			// Report the planned change only.
+		default:
+			if err := truenasClient.SetDatasetRefquota(ctx, rec.Resource, rec.SuggestedRefquotaBytes); err != nil {
+				change.Error = err.Error()
+			} else {
+				change.Applied = true
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// parseRefquota parses a refquota raw value; "0", "none" and empty mean no
+// refquota.
+func parseRefquota(raw string) int64 {
+	value, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// pvDescription names a PV and its claim for messages.
+func pvDescription(pv corev1.PersistentVolume) string {
+	if ref := pv.Spec.ClaimRef; ref != nil && ref.Name != "" {
+		return fmt.Sprintf("PV %s (%s/%s)", pv.Name, ref.Namespace, ref.Name)
+	}
+	return "PV " + pv.Name
+}
@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func quotaTestInputs() Inputs {
+	claimed := testPV("pvc-open", "10Gi")
+	claimed.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	return Inputs{
+		PersistentVolumes: []corev1.PersistentVolume{
+			claimed,
+			testPV("pvc-quoted", "10Gi"),
+			testPV("pvc-over", "10Gi"),
+			testPV("pvc-zvol", "10Gi"),
+			testPV("pvc-full-pool", "10Gi"),
+		},
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/pvc-open", Type: truenas.VolumeTypeFilesystem, Used: 2 * gib, Available: 500 * gib,
+				Properties: map[string]string{"refquota": "0"}},
+			{Name: "tank/k8s/pvc-quoted", Type: truenas.VolumeTypeFilesystem, Used: 2 * gib, Available: 8 * gib,
+				Properties: map[string]string{"refquota": "10737418240"}},
+			{Name: "tank/k8s/pvc-over", Type: truenas.VolumeTypeFilesystem, Used: 12 * gib, Available: 100 * gib},
+			{Name: "tank/k8s/pvc-zvol", Type: truenas.VolumeTypeZvol, Used: 2 * gib, Available: 500 * gib},
+			{Name: "fast/k8s/pvc-full-pool", Type: truenas.VolumeTypeFilesystem, Used: 1 * gib, Available: 5 * gib},
+		},
+	}
+}
+
+func TestQuotaRecommendations(t *testing.T) {
+	recs := QuotaRecommendations(quotaTestInputs(), QuotaOptions{Enabled: true, SlackPercent: 20})
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 recommendations, got %+v", recs)
+	}
+
+	over, open, fullPool := recs[0], recs[1], recs[2]
+	if over.Resource != "tank/k8s/pvc-over" || over.Severity != SeverityHigh || over.SuggestedRefquotaBytes != 0 {
+		t.Fatalf("over-capacity dataset should be flagged without a refquota: %+v", over)
+	}
+	if !strings.Contains(over.Description, "12.0GiB") || !strings.Contains(over.Impact, "100.0GiB") {
+		t.Fatalf("unexpected over-capacity wording: %+v", over)
+	}
+
+	wantQuota := int64(12 * gib)
+	if open.Resource != "tank/k8s/pvc-open" || open.Severity != SeverityMedium || open.SuggestedRefquotaBytes != wantQuota {
+		t.Fatalf("unexpected refquota recommendation: %+v", open)
+	}
+	if open.BlastRadiusReductionBytes != 502*gib-wantQuota {
+		t.Fatalf("BlastRadiusReductionBytes = %d, want %d", open.BlastRadiusReductionBytes, 502*gib-wantQuota)
+	}
+	if !strings.Contains(open.Description, "apps/data") || open.Type != RecommendationTypeQuota {
+		t.Fatalf("unexpected description: %+v", open)
+	}
+
+	if fullPool.Resource != "fast/k8s/pvc-full-pool" || fullPool.Severity != SeverityLow || fullPool.BlastRadiusReductionBytes != 0 {
+		t.Fatalf("dataset on a nearly full pool should be low severity: %+v", fullPool)
+	}
+
+	summary := poolQuotaRecommendations(recs)
+	if len(summary) != 3 || !strings.HasPrefix(summary[0], "Pool fast has 1 PV datasets without a refquota") ||
+		!strings.Contains(summary[2], "using more than their PV capacity") {
+		t.Fatalf("unexpected pool summary: %v", summary)
+	}
+}
+
+func TestApplyRefquotas(t *testing.T) {
+	in := quotaTestInputs()
+	recs := QuotaRecommendations(in, QuotaOptions{Enabled: true})
+
+	truenasClient := &truenastest.Client{Volumes: in.Volumes}
+	changes := ApplyRefquotas(context.Background(), truenasClient, recs, nil, true)
+	if len(changes) != 2 || changes[0].Applied || changes[0].Skipped != "" || changes[0].Error != "" {
+		t.Fatalf("dry run should plan both refquotas: %+v", changes)
+	}
+	if truenasClient.Calls("SetDatasetRefquota") != 0 {
+		t.Fatal("dry run must not change datasets")
+	}
+
+	// The dataset on the fast pool outgrew the suggestion since the analysis.
+	truenasClient.Volumes[4].Used = 20 * gib
+	changes = ApplyRefquotas(context.Background(), truenasClient, recs, nil, false)
+	if !changes[0].Applied || changes[1].Applied || changes[1].Skipped == "" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if got := truenasClient.Volumes[0].Properties["refquota"]; got != "11811160064" {
+		t.Fatalf("refquota = %q, want 11811160064", got)
+	}
+
+	// Applying again skips the dataset that now has a refquota.
+	changes = ApplyRefquotas(context.Background(), truenasClient, recs, []string{"tank/k8s/pvc-open"}, false)
+	if len(changes) != 1 || changes[0].Skipped != "dataset already has a refquota" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+
+	truenasClient.SetRefquotaErr = errors.New("permission denied")
+	truenasClient.Volumes[4].Used = gib
+	changes = ApplyRefquotas(context.Background(), truenasClient, recs, []string{"fast/k8s/pvc-full-pool"}, false)
+	if len(changes) != 1 || changes[0].Applied || changes[0].Error != "permission denied" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+}
@@ -0,0 +1,145 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// ScheduleAlertCategory is the alert category used for snapshot schedule violations.
+const ScheduleAlertCategory = "snapshot_schedule"
+
+// SchedulePolicy is the expected snapshot cadence for datasets provisioned
+// through one StorageClass.
+type SchedulePolicy struct {
+	StorageClass string        `json:"storage_class"`
+	Cadence      time.Duration `json:"cadence"`
+	MinCount     int           `json:"min_count"`
+}
+
+// ScheduleViolation describes a dataset that does not meet its class policy.
+type ScheduleViolation struct {
+	StorageClass     string     `json:"storage_class"`
+	PersistentVolume string     `json:"persistent_volume"`
+	Dataset          string     `json:"dataset"`
+	NewestSnapshot   *time.Time `json:"newest_snapshot,omitempty"`
+	SnapshotCount    int        `json:"snapshot_count"`
+	Reason           string     `json:"reason"`
+	Category         string     `json:"category"`
+}
+
+// ClassCompliance is the schedule compliance of a single StorageClass.
+type ClassCompliance struct {
+	StorageClass string              `json:"storage_class"`
+	Datasets     int                 `json:"datasets"`
+	Compliant    bool                `json:"compliant"`
+	Violations   []ScheduleViolation `json:"violations"`
+}
+
+// ScheduleReport is the result of checking all configured schedule policies.
+type ScheduleReport struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Compliant bool              `json:"compliant"`
+	Classes   []ClassCompliance `json:"classes"`
+}
+
+// Violations returns the violations of all classes in class order.
+func (r *ScheduleReport) Violations() []ScheduleViolation {
+	var violations []ScheduleViolation
+	for _, class := range r.Classes {
+		violations = append(violations, class.Violations...)
+	}
+	return violations
+}
+
+// CheckSnapshotSchedules flags managed datasets whose newest TrueNAS snapshot
+// is older than the class cadence or which retain fewer than MinCount
+// snapshots. PVs without a policy for their StorageClass and PVs whose
+// dataset cannot be found are not checked.
+func CheckSnapshotSchedules(policies []SchedulePolicy, in Inputs, now time.Time) *ScheduleReport {
+	report := &ScheduleReport{
+		Timestamp: now,
+		Compliant: true,
+		Classes:   make([]ClassCompliance, 0, len(policies)),
+	}
+
+	volumesByName := make(map[string]truenas.Volume, len(in.Volumes))
+	for _, volume := range in.Volumes {
+		volumesByName[volume.Name] = volume
+	}
+	snapshotsByDataset := make(map[string][]truenas.Snapshot)
+	for _, snapshot := range in.Snapshots {
+		snapshotsByDataset[snapshot.Dataset] = append(snapshotsByDataset[snapshot.Dataset], snapshot)
+	}
+
+	for _, policy := range policies {
+		class := ClassCompliance{
+			StorageClass: policy.StorageClass,
+			Compliant:    true,
+			Violations:   []ScheduleViolation{},
+		}
+
+		for _, pv := range in.PersistentVolumes {
+			if pv.Spec.StorageClassName != policy.StorageClass {
+				continue
+			}
+			volume, ok := matchVolume(pv, in.Volumes, volumesByName)
+			if !ok {
+				continue
+			}
+			class.Datasets++
+
+			snapshots := snapshotsByDataset[volume.Name]
+			var newest *time.Time
+			for i := range snapshots {
+				if snapshots[i].CreatedAt.IsZero() {
+					continue
+				}
+				if newest == nil || snapshots[i].CreatedAt.After(*newest) {
+					created := snapshots[i].CreatedAt
+					newest = &created
+				}
+			}
+
+			violation := ScheduleViolation{
+				StorageClass:     policy.StorageClass,
+				PersistentVolume: pv.Name,
+				Dataset:          volume.Name,
+				NewestSnapshot:   newest,
+				SnapshotCount:    len(snapshots),
+				Category:         ScheduleAlertCategory,
+			}
+			switch {
+			case newest == nil:
+				violation.Reason = "dataset has no snapshots"
+			case now.Sub(*newest) > policy.Cadence:
+				violation.Reason = fmt.Sprintf("newest snapshot is %s old, expected every %s",
+					humanize.Duration(now.Sub(*newest)), humanize.Duration(policy.Cadence))
+			case len(snapshots) < policy.MinCount:
+				violation.Reason = fmt.Sprintf("dataset retains %d snapshots, expected at least %d",
+					len(snapshots), policy.MinCount)
+			default:
+				continue
+			}
+
+			class.Compliant = false
+			class.Violations = append(class.Violations, violation)
+		}
+
+		sort.Slice(class.Violations, func(i, j int) bool {
+			return class.Violations[i].Dataset < class.Violations[j].Dataset
+		})
+		if !class.Compliant {
+			report.Compliant = false
+		}
+		report.Classes = append(report.Classes, class)
+	}
+
+	sort.Slice(report.Classes, func(i, j int) bool {
+		return report.Classes[i].StorageClass < report.Classes[j].StorageClass
+	})
+	return report
+}
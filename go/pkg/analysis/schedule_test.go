@@ -0,0 +1,117 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func classPV(name, storageClass string) corev1.PersistentVolume {
+	pv := testPV(name, "10Gi")
+	pv.Spec.StorageClassName = storageClass
+	return pv
+}
+
+func TestCheckSnapshotSchedules(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	hourly := func(dataset string, count int, newestAge time.Duration) []truenas.Snapshot {
+		snapshots := make([]truenas.Snapshot, 0, count)
+		for i := 0; i < count; i++ {
+			snapshots = append(snapshots, truenas.Snapshot{
+				Name:      dataset + "@auto",
+				Dataset:   dataset,
+				CreatedAt: now.Add(-newestAge - time.Duration(i)*time.Hour),
+			})
+		}
+		return snapshots
+	}
+
+	in := Inputs{
+		PersistentVolumes: []corev1.PersistentVolume{
+			classPV("pvc-ok", "prod"),
+			classPV("pvc-stale", "prod"),
+			classPV("pvc-few", "prod"),
+			classPV("pvc-none", "prod"),
+			classPV("pvc-dev", "dev"),
+			classPV("pvc-unmanaged", "other"),
+		},
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/pvc-ok"},
+			{Name: "tank/k8s/pvc-stale"},
+			{Name: "tank/k8s/pvc-few"},
+			{Name: "tank/k8s/pvc-none"},
+			{Name: "tank/k8s/pvc-dev"},
+			{Name: "tank/k8s/pvc-unmanaged"},
+		},
+	}
+	in.Snapshots = append(in.Snapshots, hourly("tank/k8s/pvc-ok", 3, 30*time.Minute)...)
+	in.Snapshots = append(in.Snapshots, hourly("tank/k8s/pvc-stale", 3, 3*time.Hour)...)
+	in.Snapshots = append(in.Snapshots, hourly("tank/k8s/pvc-few", 1, 10*time.Minute)...)
+	in.Snapshots = append(in.Snapshots, hourly("tank/k8s/pvc-dev", 1, 20*time.Hour)...)
+
+	policies := []SchedulePolicy{
+		{StorageClass: "prod", Cadence: time.Hour, MinCount: 3},
+		{StorageClass: "dev", Cadence: 24 * time.Hour},
+	}
+
+	report := CheckSnapshotSchedules(policies, in, now)
+
+	if report.Compliant {
+		t.Fatal("expected report to be non-compliant")
+	}
+	if len(report.Classes) != 2 || report.Classes[0].StorageClass != "dev" || report.Classes[1].StorageClass != "prod" {
+		t.Fatalf("unexpected classes: %+v", report.Classes)
+	}
+
+	dev := report.Classes[0]
+	if !dev.Compliant || dev.Datasets != 1 || len(dev.Violations) != 0 {
+		t.Fatalf("dev class = %+v, want compliant with 1 dataset", dev)
+	}
+
+	prod := report.Classes[1]
+	if prod.Compliant || prod.Datasets != 4 {
+		t.Fatalf("prod class = %+v, want non-compliant with 4 datasets", prod)
+	}
+	reasons := make(map[string]string)
+	for _, violation := range prod.Violations {
+		if violation.Category != ScheduleAlertCategory {
+			t.Fatalf("category = %q, want %q", violation.Category, ScheduleAlertCategory)
+		}
+		reasons[violation.PersistentVolume] = violation.Reason
+	}
+	if len(reasons) != 3 {
+		t.Fatalf("violations = %+v, want pvc-stale, pvc-few and pvc-none", prod.Violations)
+	}
+	if !strings.Contains(reasons["pvc-stale"], "3h old") {
+		t.Fatalf("pvc-stale reason = %q", reasons["pvc-stale"])
+	}
+	if !strings.Contains(reasons["pvc-few"], "retains 1 snapshots") {
+		t.Fatalf("pvc-few reason = %q", reasons["pvc-few"])
+	}
+	if reasons["pvc-none"] != "dataset has no snapshots" {
+		t.Fatalf("pvc-none reason = %q", reasons["pvc-none"])
+	}
+	if got := len(report.Violations()); got != 3 {
+		t.Fatalf("Violations() returned %d entries, want 3", got)
+	}
+}
+
+func TestCheckSnapshotSchedulesCadenceBoundary(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	in := Inputs{
+		PersistentVolumes: []corev1.PersistentVolume{classPV("pvc-a", "prod")},
+		Volumes:           []truenas.Volume{{Name: "tank/k8s/pvc-a"}},
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pvc-a@auto", Dataset: "tank/k8s/pvc-a", CreatedAt: now.Add(-time.Hour)},
+		},
+	}
+
+	report := CheckSnapshotSchedules([]SchedulePolicy{{StorageClass: "prod", Cadence: time.Hour}}, in, now)
+	if !report.Compliant {
+		t.Fatalf("snapshot exactly one cadence old should be compliant: %+v", report.Violations())
+	}
+}
@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// ScopeAlertCategory is the alert category for a configured pool or parent
+// dataset missing on TrueNAS.
+const ScopeAlertCategory = "truenas_scope"
+
+// ScopeOptions names the TrueNAS pool and parent dataset democratic-csi is
+// configured to provision from. Both are optional; a parent dataset without
+// a pool implies its pool.
+type ScopeOptions struct {
+	Pool          string
+	ParentDataset string
+	// Strict makes a missing pool or parent dataset fatal at startup and a
+	// failed check in GET /api/v1/validate; otherwise it is a warning.
+	Strict bool
+}
+
+// Enabled reports whether a pool or parent dataset is configured.
+func (o ScopeOptions) Enabled() bool {
+	return o.Pool != "" || o.ParentDataset != ""
+}
+
+func (o ScopeOptions) pool() string {
+	if o.Pool != "" {
+		return o.Pool
+	}
+	return strings.SplitN(o.ParentDataset, "/", 2)[0]
+}
+
+// ScopeReport is the result of CheckScope.
+type ScopeReport struct {
+	Pool               string `json:"pool"`
+	ParentDataset      string `json:"parent_dataset,omitempty"`
+	PoolFound          bool   `json:"pool_found"`
+	ParentDatasetFound bool   `json:"parent_dataset_found,omitempty"`
+	// AvailablePools lists every pool on TrueNAS, sorted, so a typo is easy
+	// to spot.
+	AvailablePools []string `json:"available_pools"`
+	Problems       []string `json:"problems"`
+}
+
+// Err returns the problems as one error, or nil when there are none.
+func (r *ScopeReport) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(r.Problems, "; "))
+}
+
+// CheckScope verifies that the configured pool exists and, when it does,
+// that the parent dataset exists too.
+func CheckScope(ctx context.Context, truenasClient truenas.Client, options ScopeOptions) (*ScopeReport, error) {
+	report := &ScopeReport{
+		Pool:           options.pool(),
+		ParentDataset:  options.ParentDataset,
+		AvailablePools: []string{},
+		Problems:       []string{},
+	}
+	pools, err := truenasClient.ListPools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+	for _, pool := range pools {
+		report.AvailablePools = append(report.AvailablePools, pool.Name)
+		if pool.Name == report.Pool {
+			report.PoolFound = true
+		}
+	}
+	sort.Strings(report.AvailablePools)
+
+	if !report.PoolFound {
+		available := strings.Join(report.AvailablePools, ", ")
+		if available == "" {
+			available = "none"
+		}
+		report.Problems = append(report.Problems, fmt.Sprintf("pool %q does not exist on TrueNAS (available pools: %s)", report.Pool, available))
+		return report, nil
+	}
+	if options.ParentDataset == "" {
+		return report, nil
+	}
+	_, err = truenasClient.GetDataset(ctx, options.ParentDataset)
+	switch {
+	case errors.Is(err, truenas.ErrDatasetNotFound):
+		report.Problems = append(report.Problems, fmt.Sprintf("parent dataset %q does not exist in pool %q", options.ParentDataset, report.Pool))
+	case err != nil:
+		return nil, fmt.Errorf("failed to get parent dataset %s: %w", options.ParentDataset, err)
+	default:
+		report.ParentDatasetFound = true
+	}
+	return report, nil
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestCheckScope(t *testing.T) {
+	truenasClient := &truenastest.Client{
+		Pools:   []truenas.Pool{{Name: "tank"}, {Name: "fast"}},
+		Volumes: []truenas.Volume{{ID: "tank/k8s", Name: "tank/k8s"}},
+	}
+
+	tests := []struct {
+		name        string
+		options     ScopeOptions
+		wantPool    string
+		wantProblem string
+	}{
+		{"pool and dataset exist", ScopeOptions{Pool: "tank", ParentDataset: "tank/k8s"}, "tank", ""},
+		{"dataset implies pool", ScopeOptions{ParentDataset: "tank/k8s"}, "tank", ""},
+		{"pool typo lists pools", ScopeOptions{Pool: "tnak"}, "tnak", `pool "tnak" does not exist on TrueNAS (available pools: fast, tank)`},
+		{"missing dataset", ScopeOptions{Pool: "tank", ParentDataset: "tank/k8s-old"}, "tank", `parent dataset "tank/k8s-old" does not exist in pool "tank"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CheckScope(context.Background(), truenasClient, tt.options)
+			if err != nil {
+				t.Fatalf("CheckScope: %v", err)
+			}
+			if report.Pool != tt.wantPool {
+				t.Fatalf("pool = %q, want %q", report.Pool, tt.wantPool)
+			}
+			if strings.Join(report.AvailablePools, ",") != "fast,tank" {
+				t.Fatalf("available pools = %v, want sorted fast,tank", report.AvailablePools)
+			}
+			if tt.wantProblem == "" {
+				if report.Err() != nil {
+					t.Fatalf("unexpected problems: %v", report.Problems)
+				}
+				return
+			}
+			if report.Err() == nil || report.Err().Error() != tt.wantProblem {
+				t.Fatalf("problems = %v, want %q", report.Problems, tt.wantProblem)
+			}
+		})
+	}
+}
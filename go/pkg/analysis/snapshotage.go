@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// DefaultSnapshotAgeBuckets are the upper bounds of the snapshot age
+// buckets: 1, 7, 30, 90 and 365 days.
+var DefaultSnapshotAgeBuckets = []time.Duration{
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+	365 * 24 * time.Hour,
+}
+
+// Snapshot age buckets besides the configured bounds.
+const (
+	// SnapshotAgeOlder holds snapshots older than the largest bound.
+	SnapshotAgeOlder = "older"
+	// SnapshotAgeUnknown holds snapshots without a creation time.
+	SnapshotAgeUnknown = "unknown"
+)
+
+// SnapshotAgeCount is the number of snapshots in one age bucket.
+type SnapshotAgeCount struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// SnapshotAgeBucketName names the bucket bounded by bound: whole days as
+// "7d", anything else in time.Duration notation.
+func SnapshotAgeBucketName(bound time.Duration) string {
+	if bound > 0 && bound%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", bound/(24*time.Hour))
+	}
+	return bound.String()
+}
+
+// SnapshotAgeBucket returns the bucket of a snapshot created at created as
+// seen at now. A snapshot falls in the first bucket whose bound is at least
+// its age, so the bounds are inclusive and must be ascending. Ages are
+// elapsed time rather than calendar days, so the time zones of created and
+// now do not matter; creation times in the future count as age 0.
+func SnapshotAgeBucket(created, now time.Time, bounds []time.Duration) string {
+	if created.IsZero() {
+		return SnapshotAgeUnknown
+	}
+	age := now.Sub(created)
+	if age < 0 {
+		age = 0
+	}
+	for _, bound := range bounds {
+		if age <= bound {
+			return SnapshotAgeBucketName(bound)
+		}
+	}
+	return SnapshotAgeOlder
+}
+
+// SnapshotAgeDistribution counts snapshots per age bucket. Every bucket is
+// reported, in bound order followed by older and unknown, so gauges built
+// from it drop to 0 instead of disappearing. Nil bounds use
+// DefaultSnapshotAgeBuckets.
+func SnapshotAgeDistribution(snapshots []truenas.Snapshot, now time.Time, bounds []time.Duration) []SnapshotAgeCount {
+	if bounds == nil {
+		bounds = DefaultSnapshotAgeBuckets
+	}
+	counts := make([]SnapshotAgeCount, 0, len(bounds)+2)
+	index := make(map[string]int, len(bounds)+2)
+	for _, bound := range bounds {
+		index[SnapshotAgeBucketName(bound)] = len(counts)
+		counts = append(counts, SnapshotAgeCount{Bucket: SnapshotAgeBucketName(bound)})
+	}
+	for _, bucket := range []string{SnapshotAgeOlder, SnapshotAgeUnknown} {
+		index[bucket] = len(counts)
+		counts = append(counts, SnapshotAgeCount{Bucket: bucket})
+	}
+
+	for _, snapshot := range snapshots {
+		counts[index[SnapshotAgeBucket(snapshot.CreatedAt, now, bounds)]].Count++
+	}
+	return counts
+}
@@ -0,0 +1,78 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestSnapshotAgeBucket_Boundaries(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		created time.Time
+		want    string
+	}{
+		{"zero creation time", time.Time{}, SnapshotAgeUnknown},
+		{"created in the future", now.Add(time.Hour), "1d"},
+		{"just created", now, "1d"},
+		{"23 hours", now.Add(-23 * time.Hour), "1d"},
+		{"exactly one day", now.Add(-day), "1d"},
+		{"one day and a second", now.Add(-day - time.Second), "7d"},
+		{"exactly seven days", now.Add(-7 * day), "7d"},
+		{"30 days", now.Add(-30 * day), "30d"},
+		{"31 days", now.Add(-31 * day), "90d"},
+		{"exactly 365 days", now.Add(-365 * day), "365d"},
+		{"two years", now.Add(-730 * day), SnapshotAgeOlder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SnapshotAgeBucket(tt.created, now, DefaultSnapshotAgeBuckets); got != tt.want {
+				t.Fatalf("SnapshotAgeBucket() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotAgeBucket_IgnoresTimeZones(t *testing.T) {
+	now := time.Date(2024, 3, 10, 1, 0, 0, 0, time.UTC)
+	// 23 hours ago, which is the previous calendar day in UTC and Honolulu.
+	tokyo := time.FixedZone("JST", 9*3600)
+	honolulu := time.FixedZone("HST", -10*3600)
+	created := now.Add(-23 * time.Hour)
+
+	for _, loc := range []*time.Location{time.UTC, tokyo, honolulu} {
+		if got := SnapshotAgeBucket(created.In(loc), now.In(tokyo), DefaultSnapshotAgeBuckets); got != "1d" {
+			t.Fatalf("bucket in %s = %q, want 1d", loc, got)
+		}
+	}
+}
+
+func TestSnapshotAgeDistribution(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	snapshots := []truenas.Snapshot{
+		{Name: "a", CreatedAt: now.Add(-time.Hour)},
+		{Name: "b", CreatedAt: now.Add(-2 * time.Hour)},
+		{Name: "c", CreatedAt: now.Add(-10 * 24 * time.Hour)},
+		{Name: "d"},
+	}
+	bounds := []time.Duration{12 * time.Hour, 7 * 24 * time.Hour}
+
+	got := SnapshotAgeDistribution(snapshots, now, bounds)
+	want := []SnapshotAgeCount{{"12h0m0s", 2}, {"7d", 0}, {SnapshotAgeOlder, 1}, {SnapshotAgeUnknown, 1}}
+	if len(got) != len(want) {
+		t.Fatalf("SnapshotAgeDistribution() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("SnapshotAgeDistribution()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if defaults := SnapshotAgeDistribution(nil, now, nil); len(defaults) != len(DefaultSnapshotAgeBuckets)+2 {
+		t.Fatalf("default buckets: %+v", defaults)
+	}
+}
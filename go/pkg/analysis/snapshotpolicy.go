@@ -0,0 +1,170 @@
+package analysis
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// SnapshotPolicyCount counts the VolumeSnapshotContents of one namespace and
+// VolumeSnapshotClass by deletion policy.
+type SnapshotPolicyCount struct {
+	Namespace     string `json:"namespace"`
+	SnapshotClass string `json:"snapshot_class"`
+	Delete        int    `json:"delete"`
+	Retain        int    `json:"retain"`
+}
+
+// SnapshotContentIssue is a VolumeSnapshotContent whose deletion policy needs
+// attention.
+type SnapshotContentIssue struct {
+	Content        string `json:"content"`
+	Namespace      string `json:"namespace,omitempty"`
+	VolumeSnapshot string `json:"volume_snapshot,omitempty"`
+	SnapshotClass  string `json:"snapshot_class,omitempty"`
+	Policy         string `json:"policy"`
+	ClassPolicy    string `json:"class_policy,omitempty"`
+	SnapshotHandle string `json:"snapshot_handle,omitempty"`
+}
+
+// SnapshotPolicyReport is the result of CheckSnapshotPolicies.
+type SnapshotPolicyReport struct {
+	Counts []SnapshotPolicyCount `json:"counts"`
+	// Overridden contents have a policy other than their class default,
+	// usually because someone edited the content.
+	Overridden []SnapshotContentIssue `json:"overridden"`
+	// MissingRetained contents have policy Retain but reference a ZFS
+	// snapshot that no longer exists on TrueNAS.
+	MissingRetained []SnapshotContentIssue `json:"missing_retained"`
+}
+
+// HasIssues reports whether any content was flagged.
+func (r *SnapshotPolicyReport) HasIssues() bool {
+	return len(r.Overridden) > 0 || len(r.MissingRetained) > 0
+}
+
+// CheckSnapshotPolicies counts snapshot contents by deletion policy and flags
+// contents that override their class default or retain a ZFS snapshot that
+// is gone. democratic-csi snapshot handles are the full ZFS name or
+// "volume@snapshot" relative to the parent dataset, so both are matched;
+// detached snapshots are datasets and are not checked.
+func CheckSnapshotPolicies(contents []snapshotv1.VolumeSnapshotContent, classes []snapshotv1.VolumeSnapshotClass, snapshots []truenas.Snapshot) *SnapshotPolicyReport {
+	report := &SnapshotPolicyReport{
+		Counts:          []SnapshotPolicyCount{},
+		Overridden:      []SnapshotContentIssue{},
+		MissingRetained: []SnapshotContentIssue{},
+	}
+
+	classPolicies := make(map[string]snapshotv1.DeletionPolicy, len(classes))
+	for _, class := range classes {
+		classPolicies[class.Name] = class.DeletionPolicy
+	}
+	existing := make(map[string]bool, 2*len(snapshots))
+	for _, snapshot := range snapshots {
+		name := truenasSnapshotName(snapshot)
+		existing[name] = true
+		existing[path.Base(name)] = true
+	}
+
+	counts := make(map[[2]string]*SnapshotPolicyCount)
+	for _, content := range contents {
+		issue := SnapshotContentIssue{
+			Content:        content.Name,
+			Namespace:      content.Spec.VolumeSnapshotRef.Namespace,
+			VolumeSnapshot: content.Spec.VolumeSnapshotRef.Name,
+			Policy:         string(content.Spec.DeletionPolicy),
+			SnapshotHandle: snapshotContentHandle(content),
+		}
+		if content.Spec.VolumeSnapshotClassName != nil {
+			issue.SnapshotClass = *content.Spec.VolumeSnapshotClassName
+		}
+
+		key := [2]string{issue.Namespace, issue.SnapshotClass}
+		count, ok := counts[key]
+		if !ok {
+			count = &SnapshotPolicyCount{Namespace: issue.Namespace, SnapshotClass: issue.SnapshotClass}
+			counts[key] = count
+		}
+		switch content.Spec.DeletionPolicy {
+		case snapshotv1.VolumeSnapshotContentDelete:
+			count.Delete++
+		case snapshotv1.VolumeSnapshotContentRetain:
+			count.Retain++
+		}
+
+		if classPolicy, ok := classPolicies[issue.SnapshotClass]; ok && classPolicy != content.Spec.DeletionPolicy {
+			overridden := issue
+			overridden.ClassPolicy = string(classPolicy)
+			report.Overridden = append(report.Overridden, overridden)
+		}
+		if content.Spec.DeletionPolicy == snapshotv1.VolumeSnapshotContentRetain &&
+			strings.Contains(issue.SnapshotHandle, "@") && !existing[issue.SnapshotHandle] {
+			report.MissingRetained = append(report.MissingRetained, issue)
+		}
+	}
+
+	for _, count := range counts {
+		report.Counts = append(report.Counts, *count)
+	}
+	sort.Slice(report.Counts, func(i, j int) bool {
+		if report.Counts[i].Namespace != report.Counts[j].Namespace {
+			return report.Counts[i].Namespace < report.Counts[j].Namespace
+		}
+		return report.Counts[i].SnapshotClass < report.Counts[j].SnapshotClass
+	})
+	return report
+}
+
+// Recommendations suggests fixes for the flagged contents.
+func (r *SnapshotPolicyReport) Recommendations() []string {
+	var recs []string
+	if len(r.Overridden) > 0 {
+		recs = append(recs, fmt.Sprintf(
+			"%d VolumeSnapshotContents have a deletionPolicy other than their VolumeSnapshotClass default (%s); check that the edit was intended",
+			len(r.Overridden), contentNames(r.Overridden)))
+	}
+	if len(r.MissingRetained) > 0 {
+		recs = append(recs, fmt.Sprintf(
+			"%d Retain-policy VolumeSnapshotContents reference ZFS snapshots that no longer exist (%s); delete the contents",
+			len(r.MissingRetained), contentNames(r.MissingRetained)))
+	}
+	return recs
+}
+
+// snapshotContentHandle returns the CSI snapshot handle of a content, from
+// its status once provisioned or from the spec when pre-provisioned.
+func snapshotContentHandle(content snapshotv1.VolumeSnapshotContent) string {
+	if content.Status != nil && content.Status.SnapshotHandle != nil {
+		return *content.Status.SnapshotHandle
+	}
+	if content.Spec.Source.SnapshotHandle != nil {
+		return *content.Spec.Source.SnapshotHandle
+	}
+	return ""
+}
+
+func truenasSnapshotName(snapshot truenas.Snapshot) string {
+	if strings.Contains(snapshot.Name, "@") || snapshot.Dataset == "" {
+		return snapshot.Name
+	}
+	return snapshot.Dataset + "@" + snapshot.Name
+}
+
+func contentNames(issues []SnapshotContentIssue) string {
+	names := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		names = append(names, issue.Content)
+	}
+	sort.Strings(names)
+	const listed = 5
+	out := strings.Join(names[:min(listed, len(names))], ", ")
+	if len(names) > listed {
+		out += fmt.Sprintf(" and %d more", len(names)-listed)
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func snapshotContent(name, namespace, class string, policy snapshotv1.DeletionPolicy, handle string) snapshotv1.VolumeSnapshotContent {
+	return snapshotv1.VolumeSnapshotContent{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: snapshotv1.VolumeSnapshotContentSpec{
+			VolumeSnapshotRef:       corev1.ObjectReference{Namespace: namespace, Name: "snap-" + name},
+			DeletionPolicy:          policy,
+			VolumeSnapshotClassName: &class,
+		},
+		Status: &snapshotv1.VolumeSnapshotContentStatus{SnapshotHandle: &handle},
+	}
+}
+
+func TestCheckSnapshotPolicies(t *testing.T) {
+	classes := []snapshotv1.VolumeSnapshotClass{
+		{ObjectMeta: metav1.ObjectMeta{Name: "zfs"}, DeletionPolicy: snapshotv1.VolumeSnapshotContentDelete},
+		{ObjectMeta: metav1.ObjectMeta{Name: "zfs-keep"}, DeletionPolicy: snapshotv1.VolumeSnapshotContentRetain},
+	}
+	contents := []snapshotv1.VolumeSnapshotContent{
+		snapshotContent("a", "apps", "zfs", snapshotv1.VolumeSnapshotContentDelete, "pvc-a@snap-a"),
+		snapshotContent("edited", "apps", "zfs", snapshotv1.VolumeSnapshotContentRetain, "tank/k8s/pvc-b@snap-b"),
+		snapshotContent("kept", "db", "zfs-keep", snapshotv1.VolumeSnapshotContentRetain, "pvc-c@snap-c"),
+		snapshotContent("gone", "db", "zfs-keep", snapshotv1.VolumeSnapshotContentRetain, "pvc-d@snap-d"),
+		snapshotContent("detached", "db", "zfs-keep", snapshotv1.VolumeSnapshotContentRetain, "tank/snaps/pvc-e/snap-e"),
+	}
+	snapshots := []truenas.Snapshot{
+		{Name: "snap-a", Dataset: "tank/k8s/pvc-a"},
+		{Name: "tank/k8s/pvc-b@snap-b"},
+		{Name: "snap-c", Dataset: "tank/k8s/pvc-c"},
+	}
+
+	report := CheckSnapshotPolicies(contents, classes, snapshots)
+
+	want := []SnapshotPolicyCount{
+		{Namespace: "apps", SnapshotClass: "zfs", Delete: 1, Retain: 1},
+		{Namespace: "db", SnapshotClass: "zfs-keep", Retain: 3},
+	}
+	if len(report.Counts) != len(want) {
+		t.Fatalf("counts = %+v", report.Counts)
+	}
+	for i := range want {
+		if report.Counts[i] != want[i] {
+			t.Fatalf("counts[%d] = %+v, want %+v", i, report.Counts[i], want[i])
+		}
+	}
+	if len(report.Overridden) != 1 || report.Overridden[0].Content != "edited" || report.Overridden[0].ClassPolicy != "Delete" {
+		t.Fatalf("overridden = %+v", report.Overridden)
+	}
+	if len(report.MissingRetained) != 1 || report.MissingRetained[0].Content != "gone" {
+		t.Fatalf("missing retained = %+v", report.MissingRetained)
+	}
+
+	recs := report.Recommendations()
+	if len(recs) != 2 || !strings.Contains(recs[0], "(edited)") || !strings.Contains(recs[1], "(gone)") {
+		t.Fatalf("recommendations = %q", recs)
+	}
+}
+
+func TestCheckSnapshotPolicies_NoContents(t *testing.T) {
+	report := CheckSnapshotPolicies(nil, nil, nil)
+	if report.HasIssues() || len(report.Counts) != 0 || report.Recommendations() != nil {
+		t.Fatalf("report = %+v", report)
+	}
+}
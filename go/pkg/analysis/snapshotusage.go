@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Default snapshot-heavy volume settings.
+const (
+	DefaultSnapshotHeavyRatio = 0.5
+	DefaultSnapshotHeavyTopN  = 5
+)
+
+// SnapshotHeavyOptions flag volumes whose snapshots use a large share of
+// space compared to their live data.
+type SnapshotHeavyOptions struct {
+	// Ratio of snapshot used bytes to dataset used bytes above which a
+	// volume is listed; zero uses DefaultSnapshotHeavyRatio.
+	Ratio float64
+	// TopN limits the volumes named in the recommendation; zero uses
+	// DefaultSnapshotHeavyTopN.
+	TopN int
+}
+
+func (o SnapshotHeavyOptions) withDefaults() SnapshotHeavyOptions {
+	if o.Ratio <= 0 {
+		o.Ratio = DefaultSnapshotHeavyRatio
+	}
+	if o.TopN <= 0 {
+		o.TopN = DefaultSnapshotHeavyTopN
+	}
+	return o
+}
+
+// DatasetSnapshots sums the snapshots taken of one dataset.
+type DatasetSnapshots struct {
+	Count     int
+	UsedBytes int64
+}
+
+// SnapshotsByDataset groups snapshots by the dataset they were taken of.
+// Snapshots without a dataset fall back to the part of the name before "@".
+func SnapshotsByDataset(snapshots []truenas.Snapshot) map[string]DatasetSnapshots {
+	byDataset := make(map[string]DatasetSnapshots)
+	for _, snapshot := range snapshots {
+		dataset := snapshot.Dataset
+		if dataset == "" {
+			dataset, _, _ = strings.Cut(snapshot.Name, "@")
+		}
+		totals := byDataset[dataset]
+		totals.Count++
+		totals.UsedBytes += snapshot.Used
+		byDataset[dataset] = totals
+	}
+	return byDataset
+}
+
+// snapshotHeavyRecommendation names the volumes with the highest snapshot
+// overhead among those above the configured ratio of their used size.
+func snapshotHeavyRecommendation(volumes []VolumeStats, opts SnapshotHeavyOptions) (string, bool) {
+	opts = opts.withDefaults()
+	type heavy struct {
+		name  string
+		ratio float64
+	}
+	var found []heavy
+	for _, volume := range volumes {
+		if volume.UsedBytes <= 0 || volume.SnapshotUsedBytes <= 0 {
+			continue
+		}
+		ratio := float64(volume.SnapshotUsedBytes) / float64(volume.UsedBytes)
+		if ratio <= opts.Ratio {
+			continue
+		}
+		name := volume.PersistentVolume
+		if volume.ClaimName != "" {
+			name = volume.ClaimNamespace + "/" + volume.ClaimName
+		}
+		found = append(found, heavy{name: name, ratio: ratio})
+	}
+	if len(found) == 0 {
+		return "", false
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].ratio != found[j].ratio {
+			return found[i].ratio > found[j].ratio
+		}
+		return found[i].name < found[j].name
+	})
+
+	names := make([]string, 0, opts.TopN)
+	for _, volume := range found[:min(opts.TopN, len(found))] {
+		names = append(names, fmt.Sprintf("%s (%.1fx)", volume.name, volume.ratio))
+	}
+	list := strings.Join(names, ", ")
+	if len(found) > opts.TopN {
+		list += fmt.Sprintf(" and %d more", len(found)-opts.TopN)
+	}
+	return fmt.Sprintf("Snapshots use more than %s of the used size of %d volumes: %s; review their snapshot retention",
+		humanize.Percent(opts.Ratio*100), len(found), list), true
+}
@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestSnapshotsByDataset(t *testing.T) {
+	got := SnapshotsByDataset([]truenas.Snapshot{
+		{Name: "tank/k8s/pvc-a@daily-1", Dataset: "tank/k8s/pvc-a", Used: 2 * gib},
+		{Name: "tank/k8s/pvc-a@daily-2", Dataset: "tank/k8s/pvc-a", Used: gib},
+		{Name: "tank/k8s/pvc-b@manual", Used: gib},
+	})
+	if a := got["tank/k8s/pvc-a"]; a.Count != 2 || a.UsedBytes != 3*gib {
+		t.Fatalf("pvc-a = %+v, want 2 snapshots using 3GiB", a)
+	}
+	if b := got["tank/k8s/pvc-b"]; b.Count != 1 || b.UsedBytes != gib {
+		t.Fatalf("pvc-b from snapshot name = %+v", b)
+	}
+}
+
+func TestSnapshotHeavyRecommendation(t *testing.T) {
+	volumes := []VolumeStats{
+		{PersistentVolume: "pv-light", UsedBytes: 10 * gib, SnapshotUsedBytes: gib},
+		{PersistentVolume: "pv-a", ClaimNamespace: "apps", ClaimName: "db", UsedBytes: 10 * gib, SnapshotUsedBytes: 30 * gib},
+		{PersistentVolume: "pv-b", UsedBytes: 10 * gib, SnapshotUsedBytes: 8 * gib},
+		{PersistentVolume: "pv-c", UsedBytes: 10 * gib, SnapshotUsedBytes: 6 * gib},
+		{PersistentVolume: "pv-empty", SnapshotUsedBytes: gib},
+	}
+
+	rec, ok := snapshotHeavyRecommendation(volumes, SnapshotHeavyOptions{TopN: 2})
+	want := "Snapshots use more than 50.0% of the used size of 3 volumes: apps/db (3.0x), pv-b (0.8x) and 1 more; review their snapshot retention"
+	if !ok || rec != want {
+		t.Fatalf("recommendation = %q, want %q", rec, want)
+	}
+
+	if _, ok := snapshotHeavyRecommendation(volumes, SnapshotHeavyOptions{Ratio: 5}); ok {
+		t.Fatal("expected no recommendation above a 5x ratio")
+	}
+}
+
+func TestAnalyzer_SnapshotHeavyOptions(t *testing.T) {
+	pv := testPV("pvc-a", "10Gi")
+	pv.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	truenasClient := &truenastest.Client{
+		Volumes:   []truenas.Volume{{Name: "tank/k8s/pvc-a", Used: 10 * gib}},
+		Snapshots: []truenas.Snapshot{{Name: "tank/k8s/pvc-a@daily", Dataset: "tank/k8s/pvc-a", Used: 4 * gib}},
+	}
+	lister := &pvLister{pvs: []corev1.PersistentVolume{pv}}
+
+	result, err := NewAnalyzer(lister, truenasClient, Options{}).Analyze(context.Background())
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if len(result.Volumes) != 1 || result.Volumes[0].SnapshotUsedBytes != 4*gib {
+		t.Fatalf("volumes = %+v", result.Volumes)
+	}
+	for _, rec := range result.Recommendations {
+		t.Fatalf("unexpected recommendation at the default ratio: %s", rec)
+	}
+
+	analyzer := NewAnalyzer(lister, truenasClient, Options{SnapshotHeavy: SnapshotHeavyOptions{Ratio: 0.25}, CacheTTL: -1})
+	result, err = analyzer.Analyze(context.Background())
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if len(result.Recommendations) != 1 {
+		t.Fatalf("expected a snapshot-heavy recommendation at 25%%, got %v", result.Recommendations)
+	}
+}
@@ -0,0 +1,234 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// ZFSReadinessAlertCategory is the alert category used for parent datasets
+// and pools that block democratic-csi operations.
+const ZFSReadinessAlertCategory = "zfs_readiness"
+
+// ZFS readiness problem kinds.
+const (
+	// ZFSDatasetLocked is an encrypted parent dataset whose key is not
+	// loaded, so no volume can be created below it.
+	ZFSDatasetLocked = "dataset_locked"
+	// ZFSDatasetReadonly is a parent dataset with readonly=on.
+	ZFSDatasetReadonly = "dataset_readonly"
+	// ZFSPoolUnhealthy is a pool that is not ONLINE and healthy.
+	ZFSPoolUnhealthy = "pool_unhealthy"
+	// ZFSPoolFeatureDisabled is a pool with a required feature disabled.
+	ZFSPoolFeatureDisabled = "pool_feature_disabled"
+)
+
+// RequiredPoolFeatures are the pool features democratic-csi create, clone
+// and destroy operations rely on.
+var RequiredPoolFeatures = []string{"async_destroy", "empty_bpobj", "extensible_dataset"}
+
+// ZFSReadinessProblem is a parent dataset or pool state that makes
+// democratic-csi operations fail. All problems are critical.
+type ZFSReadinessProblem struct {
+	Kind    string `json:"kind"`
+	Pool    string `json:"pool"`
+	Dataset string `json:"dataset,omitempty"`
+	// StorageClasses are the classes whose parent dataset is affected.
+	StorageClasses []string `json:"storage_classes,omitempty"`
+	Message        string   `json:"message"`
+	// Remediation is what to do on the TrueNAS side.
+	Remediation string `json:"remediation"`
+}
+
+// ZFSReadinessReport is the result of BuildZFSReadinessReport.
+type ZFSReadinessReport struct {
+	// Datasets are the parent datasets checked; missing ones are left to
+	// the dataset layout check.
+	Datasets []string              `json:"datasets"`
+	Pools    []string              `json:"pools"`
+	Problems []ZFSReadinessProblem `json:"problems"`
+}
+
+// LockedDatasets returns the parent datasets reported as locked.
+func (r *ZFSReadinessReport) LockedDatasets() []string {
+	var locked []string
+	for _, problem := range r.Problems {
+		if problem.Kind == ZFSDatasetLocked {
+			locked = append(locked, problem.Dataset)
+		}
+	}
+	return locked
+}
+
+// CheckZFSReadiness looks up the democratic-csi parent datasets of the
+// StorageClasses and the TrueNAS pools, and builds the report.
+func CheckZFSReadiness(ctx context.Context, k8sClient k8s.Client, truenasClient truenas.Client) (*ZFSReadinessReport, error) {
+	classes, err := k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	parents := parentDatasetClasses(classes)
+	datasets := make(map[string]truenas.Volume, len(parents))
+	for name := range parents {
+		dataset, err := truenasClient.GetDataset(ctx, name)
+		if errors.Is(err, truenas.ErrDatasetNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent dataset %s: %w", name, err)
+		}
+		datasets[name] = *dataset
+	}
+	pools, err := truenasClient.ListPools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+	return BuildZFSReadinessReport(parents, datasets, pools), nil
+}
+
+// parentDatasetClasses maps every parent dataset of the democratic-csi
+// StorageClasses to the classes declaring it.
+func parentDatasetClasses(classes []storagev1.StorageClass) map[string][]string {
+	parents := make(map[string][]string)
+	for _, class := range classes {
+		if !strings.Contains(class.Provisioner, "democratic-csi") {
+			continue
+		}
+		for _, role := range []string{DatasetRoleVolumes, DatasetRoleDetachedSnapshots} {
+			if dataset := classParameter(class, parentDatasetParameters[role]); dataset != "" {
+				parents[dataset] = appendUnique(parents[dataset], class.Name)
+			}
+		}
+	}
+	return parents
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// BuildZFSReadinessReport flags parent datasets that are locked or
+// read-only, and the pools holding them that are not ONLINE and healthy or
+// have a RequiredPoolFeatures entry disabled. parents maps parent datasets to
+// their StorageClasses and datasets holds those found on TrueNAS. When a
+// pool lists no features, an un-upgraded pool is flagged instead.
+func BuildZFSReadinessReport(parents map[string][]string, datasets map[string]truenas.Volume, pools []truenas.Pool) *ZFSReadinessReport {
+	report := &ZFSReadinessReport{Datasets: []string{}, Pools: []string{}, Problems: []ZFSReadinessProblem{}}
+
+	poolClasses := make(map[string][]string)
+	for name, classes := range parents {
+		pool := strings.SplitN(name, "/", 2)[0]
+		for _, class := range classes {
+			poolClasses[pool] = appendUnique(poolClasses[pool], class)
+		}
+		dataset, ok := datasets[name]
+		if !ok {
+			continue
+		}
+		report.Datasets = append(report.Datasets, name)
+		problem := ZFSReadinessProblem{Pool: pool, Dataset: name, StorageClasses: sortedCopy(classes)}
+
+		if datasetLocked(dataset) {
+			root := dataset.Properties[truenas.PropertyEncryptionRoot]
+			if root == "" {
+				root = name
+			}
+			problem.Kind = ZFSDatasetLocked
+			problem.Message = fmt.Sprintf("parent dataset %s is locked: the encryption key of %s is not loaded, so volumes cannot be provisioned", name, root)
+			problem.Remediation = fmt.Sprintf("Unlock %s in Datasets (Unlock, or pool.dataset.unlock) and, for passphrase-encrypted datasets, unlock it again after every reboot", root)
+			report.Problems = append(report.Problems, problem)
+		}
+		if strings.EqualFold(dataset.Properties[truenas.PropertyReadonly], "on") {
+			problem.Kind = ZFSDatasetReadonly
+			problem.Message = fmt.Sprintf("parent dataset %s is read-only, so volumes and snapshots cannot be created", name)
+			problem.Remediation = fmt.Sprintf("Set Read-only to Off on %s or the ancestor it inherits from (Datasets, Edit, Advanced Options); a read-only pool import needs an export and a read-write import", name)
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	for _, pool := range pools {
+		classes, ok := poolClasses[pool.Name]
+		if !ok {
+			continue
+		}
+		report.Pools = append(report.Pools, pool.Name)
+		problem := ZFSReadinessProblem{Pool: pool.Name, StorageClasses: sortedCopy(classes)}
+
+		if status := strings.ToUpper(pool.Status); (status != "" && status != "ONLINE") || (pool.Healthy != nil && !*pool.Healthy) {
+			problem.Kind = ZFSPoolUnhealthy
+			problem.Message = fmt.Sprintf("pool %s is %s", pool.Name, poolStatus(pool))
+			problem.Remediation = fmt.Sprintf("Check Storage, %s, Manage Devices: replace faulted disks and clear errors, or export and re-import the pool if it was imported degraded or read-only", pool.Name)
+			report.Problems = append(report.Problems, problem)
+		}
+
+		var disabled []string
+		if len(pool.Features) > 0 {
+			states := make(map[string]string, len(pool.Features))
+			for _, feature := range pool.Features {
+				states[feature.Name] = strings.ToUpper(feature.State)
+			}
+			for _, feature := range RequiredPoolFeatures {
+				if state := states[feature]; state != "ENABLED" && state != "ACTIVE" {
+					disabled = append(disabled, feature)
+				}
+			}
+		} else if pool.IsUpgraded != nil && !*pool.IsUpgraded {
+			disabled = []string{"unknown (pool not upgraded)"}
+		}
+		if len(disabled) > 0 {
+			problem.Kind = ZFSPoolFeatureDisabled
+			problem.Message = fmt.Sprintf("pool %s has features disabled that democratic-csi needs: %s", pool.Name, strings.Join(disabled, ", "))
+			problem.Remediation = fmt.Sprintf("Upgrade pool %s in Storage (Upgrade, or pool.upgrade); upgraded pools cannot be imported by older ZFS versions", pool.Name)
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	sort.Strings(report.Datasets)
+	sort.Strings(report.Pools)
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		a, b := report.Problems[i], report.Problems[j]
+		if a.Pool != b.Pool {
+			return a.Pool < b.Pool
+		}
+		return a.Dataset < b.Dataset
+	})
+	return report
+}
+
+// datasetLocked reports whether an encrypted dataset has no key loaded.
+func datasetLocked(dataset truenas.Volume) bool {
+	if dataset.Properties[truenas.PropertyLocked] == "true" {
+		return true
+	}
+	return dataset.Properties[truenas.PropertyEncrypted] == "true" &&
+		dataset.Properties[truenas.PropertyKeyLoaded] == "false"
+}
+
+func poolStatus(pool truenas.Pool) string {
+	status := pool.Status
+	if status == "" || strings.EqualFold(status, "ONLINE") {
+		status = "unhealthy"
+	}
+	if pool.StatusDetail != "" {
+		status += " (" + pool.StatusDetail + ")"
+	}
+	return status
+}
+
+func sortedCopy(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
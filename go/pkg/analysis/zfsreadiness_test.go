@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestCheckZFSReadiness_FlagsLockedReadonlyAndUnhealthyPools(t *testing.T) {
+	k8sClient := &k8stest.Client{StorageClasses: []storagev1.StorageClass{
+		democraticClass("nfs", map[string]string{
+			"datasetParentName":                  "tank/k8s/vols",
+			"detachedSnapshotsDatasetParentName": "tank/k8s/snaps",
+		}),
+		democraticClass("iscsi", map[string]string{"datasetParentName": "fast/k8s/vols"}),
+		democraticClass("gone", map[string]string{"datasetParentName": "tank/k8s/missing"}),
+	}}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{ID: "tank/k8s/vols", Name: "tank/k8s/vols", Properties: map[string]string{
+				truenas.PropertyEncrypted: "true", truenas.PropertyKeyLoaded: "false", truenas.PropertyEncryptionRoot: "tank/k8s",
+			}},
+			{ID: "tank/k8s/snaps", Name: "tank/k8s/snaps", Properties: map[string]string{truenas.PropertyReadonly: "ON"}},
+			{ID: "fast/k8s/vols", Name: "fast/k8s/vols", Properties: map[string]string{
+				truenas.PropertyEncrypted: "true", truenas.PropertyKeyLoaded: "true", truenas.PropertyReadonly: "OFF",
+			}},
+		},
+		Pools: []truenas.Pool{
+			{Name: "tank", Status: "DEGRADED", Healthy: boolPtr(false), StatusDetail: "One or more devices are faulted"},
+			{Name: "fast", Status: "ONLINE", Healthy: boolPtr(true), Features: []truenas.PoolFeature{
+				{Name: "async_destroy", State: "ENABLED"}, {Name: "empty_bpobj", State: "ACTIVE"}, {Name: "extensible_dataset", State: "DISABLED"},
+			}},
+			{Name: "boot-pool", Status: "OFFLINE"},
+		},
+	}
+
+	report, err := CheckZFSReadiness(context.Background(), k8sClient, truenasClient)
+	if err != nil {
+		t.Fatalf("CheckZFSReadiness: %v", err)
+	}
+
+	if strings.Join(report.Datasets, ",") != "fast/k8s/vols,tank/k8s/snaps,tank/k8s/vols" {
+		t.Fatalf("datasets = %v, want the three existing parents", report.Datasets)
+	}
+	if strings.Join(report.Pools, ",") != "fast,tank" {
+		t.Fatalf("pools = %v, want only pools holding parents", report.Pools)
+	}
+	kinds := make(map[string]ZFSReadinessProblem)
+	for _, problem := range report.Problems {
+		kinds[problem.Kind] = problem
+	}
+	if len(report.Problems) != 4 {
+		t.Fatalf("problems = %+v", report.Problems)
+	}
+	locked := kinds[ZFSDatasetLocked]
+	if locked.Dataset != "tank/k8s/vols" || !strings.Contains(locked.Remediation, "Unlock tank/k8s") ||
+		strings.Join(locked.StorageClasses, ",") != "nfs" {
+		t.Fatalf("locked = %+v", locked)
+	}
+	if readonly := kinds[ZFSDatasetReadonly]; readonly.Dataset != "tank/k8s/snaps" {
+		t.Fatalf("readonly = %+v", readonly)
+	}
+	if unhealthy := kinds[ZFSPoolUnhealthy]; unhealthy.Pool != "tank" || !strings.Contains(unhealthy.Message, "DEGRADED (One or more devices are faulted)") {
+		t.Fatalf("unhealthy = %+v", unhealthy)
+	}
+	if feature := kinds[ZFSPoolFeatureDisabled]; feature.Pool != "fast" || !strings.Contains(feature.Message, "extensible_dataset") {
+		t.Fatalf("feature = %+v", feature)
+	}
+	if got := report.LockedDatasets(); len(got) != 1 || got[0] != "tank/k8s/vols" {
+		t.Fatalf("locked datasets = %v", got)
+	}
+}
+
+func TestBuildZFSReadinessReport_UnupgradedPoolWithoutFeatureList(t *testing.T) {
+	report := BuildZFSReadinessReport(
+		map[string][]string{"tank/k8s": {"nfs"}},
+		map[string]truenas.Volume{"tank/k8s": {Name: "tank/k8s"}},
+		[]truenas.Pool{{Name: "tank", Status: "ONLINE", IsUpgraded: boolPtr(false)}},
+	)
+	if len(report.Problems) != 1 || report.Problems[0].Kind != ZFSPoolFeatureDisabled {
+		t.Fatalf("problems = %+v", report.Problems)
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
+)
+
+// findAbandonedDatasets lists the inventories and reports the abandoned
+// datasets under the parent datasets of the democratic-csi StorageClasses.
+func (s *Server) findAbandonedDatasets(ctx context.Context) (*analysis.AbandonedDatasetReport, error) {
+	classes, err := s.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	in, err := analysis.Gather(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := analysis.ManagedDatasetPrefixes(classes)
+	return analysis.FindAbandonedDatasets(in, prefixes, time.Now(), s.abandonedDatasets), nil
+}
+
+// abandonedDatasetsHandler reports the managed datasets without a PV whose
+// space is held by old snapshots, largest reclaimable first, with the
+// deletion plan of each and what blocks it.
+func (s *Server) abandonedDatasetsHandler(c *gin.Context) {
+	report, err := s.findAbandonedDatasets(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to find abandoned datasets", zap.Error(err))
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "failed to list storage inventories", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":         time.Now().UTC(),
+		"datasets":          report.Datasets,
+		"reclaimable_bytes": report.ReclaimableBytes,
+		"blocked":           report.Blocked,
+	})
+}
+
+// cleanupDatasetsHandler deletes abandoned datasets in a background job,
+// each after its snapshots. The JSON body {"datasets": [...], "dry_run":
+// bool, "confirmation_token": string} limits the datasets (every abandoned
+// dataset without blockers when empty); names that are not currently
+// reported as abandoned, or that are blocked, are refused. It defaults to a
+// dry run, which lists the deletion plan with a confirmation token without
+// starting a job; the job only starts for the token of an unchanged plan.
+func (s *Server) cleanupDatasetsHandler(c *gin.Context) {
+	if s.cleanupEngine == nil {
+		writeError(c, http.StatusForbidden, ErrorCodeForbidden, "dataset cleanup is disabled; set cleanup.enabled to enable it", nil)
+		return
+	}
+
+	var body struct {
+		Datasets          []string `json:"datasets"`
+		DryRun            *bool    `json:"dry_run"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid request body", nil)
+			return
+		}
+	}
+	dryRun := body.DryRun == nil || *body.DryRun
+
+	report, err := s.findAbandonedDatasets(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to find abandoned datasets", zap.Error(err))
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "failed to list storage inventories", nil)
+		return
+	}
+
+	deletable := map[string]analysis.AbandonedDataset{}
+	selected := report.Deletable()
+	for _, dataset := range selected {
+		deletable[dataset.Dataset] = dataset
+	}
+	if len(body.Datasets) > 0 {
+		var refused []string
+		selected = selected[:0:0]
+		for _, name := range body.Datasets {
+			dataset, ok := deletable[name]
+			if !ok {
+				refused = append(refused, name)
+				continue
+			}
+			selected = append(selected, dataset)
+		}
+		if len(refused) > 0 {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "datasets are not abandoned or are blocked",
+				map[string]interface{}{"datasets": refused})
+			return
+		}
+	}
+
+	deletions := make([]cleanup.DatasetDeletion, 0, len(selected))
+	plan := []string{}
+	var reclaimable int64
+	for _, dataset := range selected {
+		deletions = append(deletions, cleanup.DatasetDeletion{Dataset: dataset.Dataset, Snapshots: dataset.Snapshots})
+		plan = append(plan, dataset.Snapshots...)
+		plan = append(plan, dataset.Dataset)
+		reclaimable += dataset.ReclaimableBytes
+	}
+
+	s.logger.Info("Dataset cleanup",
+		zap.Bool("dry_run", dryRun),
+		zap.Int("datasets", len(deletions)),
+		zap.Int64("reclaimable_bytes", reclaimable),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", c.GetString("request_id")),
+	)
+
+	if dryRun {
+		c.JSON(http.StatusOK, s.previewConfirmation(gin.H{
+			"timestamp":         time.Now().UTC(),
+			"dry_run":           true,
+			"plan":              plan,
+			"reclaimable_bytes": reclaimable,
+		}, actionCleanupDatasets, plan))
+		return
+	}
+	if !s.confirmed(c, actionCleanupDatasets, plan, body.ConfirmationToken) {
+		return
+	}
+
+	job := s.cleanupEngine.DeleteDatasets(deletions)
+	s.analyzer.Invalidate()
+	c.JSON(http.StatusAccepted, gin.H{
+		"timestamp": time.Now().UTC(),
+		"dry_run":   false,
+		"job":       job,
+	})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// AccessLogConfig tunes the HTTP access log. The zero value logs every
+// request.
+type AccessLogConfig struct {
+	// SkipPaths are path prefixes, such as probe endpoints, whose
+	// successful requests are not logged.
+	SkipPaths []string
+	// SuccessSampleRate is the fraction of the remaining successful
+	// requests that are logged (0 = all). Requests answered 4xx or 5xx are
+	// always logged.
+	SuccessSampleRate float64
+}
+
+// skips reports whether successful requests for path are not logged.
+func (c AccessLogConfig) skips(path string) bool {
+	for _, prefix := range c.SkipPaths {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// successSampler logs an exact fraction of successful requests by counting
+// them, so a rate of 0.1 logs every tenth one.
+type successSampler struct {
+	rate  float64
+	count atomic.Uint64
+}
+
+func (s *successSampler) sample() bool {
+	if s.rate <= 0 || s.rate >= 1 {
+		return true
+	}
+	n := float64(s.count.Add(1))
+	return math.Floor(n*s.rate) > math.Floor((n-1)*s.rate)
+}
+
+// loggingMiddleware logs HTTP requests. Failed requests are always logged;
+// successful ones are dropped for skipped paths and sampled otherwise.
+func loggingMiddleware(logger *zap.Logger, config AccessLogConfig) gin.HandlerFunc {
+	sampler := &successSampler{rate: config.SuccessSampleRate}
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < 400 && (config.skips(path) || !sampler.sample()) {
+			return
+		}
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path += "?" + raw
+		}
+		logger.Info("HTTP request",
+			zap.String("method", c.Request.Method),
+			zap.String("path", logging.RedactPath(path)),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+		)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggingMiddleware_SkipsProbesAndSamplesSuccesses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.New(core),
+		AccessLog:     AccessLogConfig{SkipPaths: []string{"/health", "/ready"}, SuccessSampleRate: 0.25},
+	})
+	require.NoError(t, err)
+	router := server.server.Handler.(*gin.Engine)
+	router.GET("/ready/broken", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, performRequest(server, http.MethodGet, "/health").Code)
+	}
+	require.Zero(t, logs.FilterMessage("HTTP request").Len(), "probe requests were logged")
+
+	for i := 0; i < 8; i++ {
+		require.Equal(t, http.StatusOK, performRequest(server, http.MethodGet, "/api/v1/truenas/volumes").Code)
+	}
+	require.Equal(t, 2, logs.FilterMessage("HTTP request").Len(), "want every fourth success logged")
+
+	// Failures are logged even on skipped paths and are never sampled.
+	performRequest(server, http.MethodGet, "/ready/broken")
+	for i := 0; i < 3; i++ {
+		performRequest(server, http.MethodGet, "/api/v1/no-such-route")
+	}
+	failures := logs.FilterMessage("HTTP request").FilterFieldKey("status").All()[2:]
+	require.Len(t, failures, 4)
+	require.EqualValues(t, http.StatusServiceUnavailable, failures[0].ContextMap()["status"])
+}
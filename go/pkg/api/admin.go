@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"go.uber.org/zap"
+)
+
+// Cache scopes accepted by POST /api/v1/admin/cache/invalidate.
+const (
+	CacheScopeK8s         = "k8s"
+	CacheScopeTrueNAS     = "truenas"
+	CacheScopeCorrelation = "correlation"
+	CacheScopeAll         = "all"
+)
+
+// adminCache is a cache the admin endpoints report on and invalidate.
+type adminCache struct {
+	scope      string
+	name       string
+	entries    func() int
+	builtAt    func() time.Time
+	invalidate func()
+	rebuild    func(ctx context.Context) error
+}
+
+// adminCaches lists the caches held by the server. The Kubernetes scope has
+// no caches yet and is accepted so callers can flush "everything" uniformly.
+func (s *Server) adminCaches() []adminCache {
+	caches := []adminCache{{
+		scope: CacheScopeCorrelation,
+		name:  "storage_analysis",
+		entries: func() int {
+			if s.analyzer.CachedAt().IsZero() {
+				return 0
+			}
+			return 1
+		},
+		builtAt:    s.analyzer.CachedAt,
+		invalidate: s.analyzer.Invalidate,
+		rebuild: func(ctx context.Context) error {
+			_, err := s.analyzer.Analyze(ctx)
+			return err
+		},
+	}}
+
+	if snapshots, ok := s.truenasClient.(*truenas.IncrementalSnapshotClient); ok {
+		caches = append(caches, adminCache{
+			scope:      CacheScopeTrueNAS,
+			name:       "snapshots",
+			entries:    func() int { return snapshots.Stats().Size },
+			builtAt:    func() time.Time { return snapshots.Stats().LastFullList },
+			invalidate: snapshots.Invalidate,
+			rebuild: func(ctx context.Context) error {
+				_, err := snapshots.ListSnapshots(ctx)
+				return err
+			},
+		})
+	}
+	return caches
+}
+
+// adminAuthMiddleware requires "Authorization: Bearer <token>" on admin
+// routes and audit-logs every admin request. Admin routes are disabled when
+// no token is configured.
+func adminAuthMiddleware(token string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("request_id", c.GetString("request_id")),
+		}
+
+		if token == "" {
+			logger.Warn("Admin request rejected: admin endpoints disabled", fields...)
+			writeError(c, http.StatusForbidden, ErrorCodeForbidden, "admin endpoints are disabled; set security.admin_token to enable them", nil)
+			return
+		}
+
+		presented, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			logger.Warn("Admin request rejected: invalid credentials", fields...)
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(c, http.StatusUnauthorized, ErrorCodeUnauthorized, "missing or invalid admin token", nil)
+			return
+		}
+
+		c.Next()
+		logger.Info("Admin request", append(fields, zap.Int("status", c.Writer.Status()))...)
+	}
+}
+
+// cacheStatusHandler reports the age and entry count of each cache.
+func (s *Server) cacheStatusHandler(c *gin.Context) {
+	now := time.Now().UTC()
+	items := make([]gin.H, 0, len(s.caches))
+	for _, cache := range s.caches {
+		item := gin.H{
+			"scope":   cache.scope,
+			"name":    cache.name,
+			"entries": cache.entries(),
+		}
+		if builtAt := cache.builtAt(); !builtAt.IsZero() {
+			item["built_at"] = builtAt.UTC()
+			item["age"] = now.Sub(builtAt).Round(time.Millisecond).String()
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": now,
+		"caches":    items,
+	})
+}
+
+// invalidateCacheHandler clears the caches of the requested scope and
+// rebuilds them. The JSON body {"scope": "..."} defaults to "all". Rebuild
+// failures are reported but leave the cache empty, so the next access
+// retries.
+func (s *Server) invalidateCacheHandler(c *gin.Context) {
+	var body struct {
+		Scope string `json:"scope"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid request body", nil)
+			return
+		}
+	}
+	scope := body.Scope
+	if scope == "" {
+		scope = CacheScopeAll
+	}
+	switch scope {
+	case CacheScopeK8s, CacheScopeTrueNAS, CacheScopeCorrelation, CacheScopeAll:
+	default:
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "scope must be one of: k8s, truenas, correlation, all", nil)
+		return
+	}
+
+	var selected []adminCache
+	for _, cache := range s.caches {
+		if scope == CacheScopeAll || cache.scope == scope {
+			selected = append(selected, cache)
+		}
+	}
+
+	cleared := make([]gin.H, 0, len(selected))
+	names := make([]string, 0, len(selected))
+	for _, cache := range selected {
+		cleared = append(cleared, gin.H{
+			"scope":   cache.scope,
+			"name":    cache.name,
+			"entries": cache.entries(),
+		})
+		names = append(names, cache.name)
+		cache.invalidate()
+	}
+
+	started := time.Now()
+	rebuildErrors := make(map[string]string)
+	for _, cache := range selected {
+		if err := cache.rebuild(c.Request.Context()); err != nil {
+			s.logger.Warn("Cache rebuild failed", zap.String("cache", cache.name), zap.Error(err))
+			rebuildErrors[cache.name] = err.Error()
+		}
+	}
+	rebuildDuration := time.Since(started)
+
+	s.logger.Info("Caches invalidated",
+		zap.String("scope", scope),
+		zap.Strings("cleared", names),
+		zap.Duration("rebuild_duration", rebuildDuration),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", c.GetString("request_id")),
+	)
+
+	response := gin.H{
+		"timestamp":        time.Now().UTC(),
+		"scope":            scope,
+		"cleared":          cleared,
+		"rebuild_duration": rebuildDuration.String(),
+	}
+	if len(rebuildErrors) > 0 {
+		response["rebuild_errors"] = rebuildErrors
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+)
+
+// alertCheckOrigin names the API server in test notifications.
+const alertCheckOrigin = "truenas-api-server"
+
+// alertChecks holds the latest alert destination test, from startup or from
+// POST /api/v1/admin/alerts/test.
+type alertChecks struct {
+	mu        sync.Mutex
+	checks    []alerts.DestinationCheck
+	checkedAt time.Time
+}
+
+func (a *alertChecks) set(checks []alerts.DestinationCheck, checkedAt time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.checks = checks
+	a.checkedAt = checkedAt
+}
+
+func (a *alertChecks) get() ([]alerts.DestinationCheck, time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.checks, a.checkedAt
+}
+
+// testAlertDestinationsHandler sends a test notification to every
+// configured alert destination and reports per-destination delivery. It
+// answers 200 even when destinations fail; the body says which.
+func (s *Server) testAlertDestinationsHandler(c *gin.Context) {
+	if s.alertDispatcher == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "alert delivery is not configured", nil)
+		return
+	}
+
+	checks := s.alertDispatcher.Verify(c.Request.Context(), alertCheckOrigin)
+	checkedAt := s.clock.Now().UTC()
+	s.recordAlertChecks(checks, checkedAt)
+
+	result := s.alertDestinationsCheck()
+	result["timestamp"] = checkedAt
+	c.JSON(http.StatusOK, result)
+}
+
+// recordAlertChecks stores a destination test, exports it and logs every
+// failing destination.
+func (s *Server) recordAlertChecks(checks []alerts.DestinationCheck, checkedAt time.Time) {
+	s.alertChecks.set(checks, checkedAt)
+	if s.metricsExporter != nil {
+		s.metricsExporter.SetAlertDestinationHealth(alerts.DestinationHealth(checks))
+	}
+	for _, check := range checks {
+		if !check.Healthy {
+			s.logger.Error("Alert destination failed the test notification",
+				zap.String("destination", check.Destination.String()),
+				zap.Strings("routes", check.Routes),
+				zap.String("error", check.Error))
+		}
+	}
+}
+
+// alertDestinationsCheck reports the latest destination test for GET
+// /api/v1/validate. Failing destinations fail the check when alerts are
+// required and warn otherwise.
+func (s *Server) alertDestinationsCheck() gin.H {
+	checks, checkedAt := s.alertChecks.get()
+	if checks == nil {
+		checks = []alerts.DestinationCheck{}
+	}
+	status := "passed"
+	for _, check := range checks {
+		if !check.Healthy {
+			status = "warning"
+			if s.alertsRequired {
+				status = "failed"
+			}
+			break
+		}
+	}
+	result := gin.H{
+		"status":       status,
+		"required":     s.alertsRequired,
+		"destinations": checks,
+	}
+	if !checkedAt.IsZero() {
+		result["checked_at"] = checkedAt
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+func TestTestAlertDestinationsHandler(t *testing.T) {
+	webhookErr := errors.New("destination returned status 404")
+	var sent []alerts.Alert
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: alerts.NewRouter(alerts.RouterConfig{
+			Routes:  []alerts.Route{{Name: "team-a", Destinations: []alerts.Destination{{Type: alerts.DestinationWebhook, URL: "https://hooks.example.com/a"}}}},
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationSlack, Channel: "#storage"}}},
+		}),
+		Senders: map[string]alerts.Sender{
+			alerts.DestinationSlack: alerts.SenderFunc(func(_ context.Context, _ alerts.Destination, alert alerts.Alert) error {
+				sent = append(sent, alert)
+				return nil
+			}),
+			alerts.DestinationWebhook: alerts.SenderFunc(func(context.Context, alerts.Destination, alerts.Alert) error {
+				return webhookErr
+			}),
+		},
+		Logger: logging.FromZap(zap.NewNop()),
+	})
+	require.NoError(t, err)
+
+	server, err := NewServer(Config{
+		K8sClient:       &stubK8sClient{},
+		TruenasClient:   &stubTruenasClient{},
+		Logger:          zap.NewNop(),
+		AdminToken:      "s3cret",
+		AlertDispatcher: dispatcher,
+		AlertsRequired:  true,
+		AlertDestinationChecks: []alerts.DestinationCheck{
+			{Destination: alerts.Destination{Type: alerts.DestinationSlack, Channel: "#storage"}, Routes: []string{"default"}, Healthy: true},
+		},
+	})
+	require.NoError(t, err)
+
+	type checkBody struct {
+		Status       string                    `json:"status"`
+		Destinations []alerts.DestinationCheck `json:"destinations"`
+	}
+	validate := func() checkBody {
+		t.Helper()
+		var body struct {
+			Checks struct {
+				AlertDestinations checkBody `json:"alert_destinations"`
+			} `json:"checks"`
+		}
+		rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Checks.AlertDestinations
+	}
+
+	// The startup test is reported until the admin endpoint repeats it.
+	check := validate()
+	require.Equal(t, "passed", check.Status)
+	require.Len(t, check.Destinations, 1)
+
+	require.Equal(t, http.StatusUnauthorized, performRequest(server, http.MethodPost, "/api/v1/admin/alerts/test").Code)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/alerts/test", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var tested checkBody
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tested))
+	require.Equal(t, "failed", tested.Status)
+	require.Len(t, tested.Destinations, 2)
+	require.False(t, tested.Destinations[0].Healthy)
+	require.Equal(t, webhookErr.Error(), tested.Destinations[0].Error)
+	require.True(t, tested.Destinations[1].Healthy)
+	require.Len(t, sent, 1)
+	require.Contains(t, sent[0].Message, "[TEST]")
+
+	require.Equal(t, tested, validate())
+
+	// Without a dispatcher the endpoint and the check are absent.
+	server = newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+	require.NotContains(t, performRequest(server, http.MethodGet, "/api/v1/validate").Body.String(), "alert_destinations")
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+)
+
+// trueNASSnapshotType is the orphan type of TrueNAS snapshots.
+const trueNASSnapshotType = "TrueNASSnapshot"
+
+// cleanupSnapshotsHandler deletes orphaned TrueNAS snapshots in a background
+// job. The JSON body {"snapshots": [...], "dry_run": bool,
+// "confirmation_token": string} limits the snapshots (every orphaned TrueNAS
+// snapshot when empty); names that are not currently reported as orphaned
+// are refused. It defaults to a dry run, which lists the snapshots with a
+// confirmation token without starting a job; the job only starts for the
+// token of an unchanged list.
+func (s *Server) cleanupSnapshotsHandler(c *gin.Context) {
+	if s.cleanupEngine == nil {
+		writeError(c, http.StatusForbidden, ErrorCodeForbidden, "snapshot cleanup is disabled; set cleanup.enabled to enable it", nil)
+		return
+	}
+
+	var body struct {
+		Snapshots         []string `json:"snapshots"`
+		DryRun            *bool    `json:"dry_run"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid request body", nil)
+			return
+		}
+	}
+	dryRun := body.DryRun == nil || *body.DryRun
+
+	result, err := s.runOrphanDetection(c.Request.Context(), "", s.defaultOrphanThreshold)
+	if err != nil {
+		s.logger.Error("Failed to detect orphaned resources", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "orphan detection failed", nil)
+		return
+	}
+	if result.Partial {
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "orphan detection was partial; refusing to delete",
+			map[string]interface{}{"phase_errors": result.PhaseErrors})
+		return
+	}
+
+	orphaned := map[string]bool{}
+	var snapshots []string
+	for _, resource := range result.OrphanedSnapshots {
+		if resource.Type == trueNASSnapshotType {
+			orphaned[resource.Name] = true
+			snapshots = append(snapshots, resource.Name)
+		}
+	}
+	if len(body.Snapshots) > 0 {
+		var notOrphaned []string
+		for _, name := range body.Snapshots {
+			if !orphaned[name] {
+				notOrphaned = append(notOrphaned, name)
+			}
+		}
+		if len(notOrphaned) > 0 {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "snapshots are not orphaned TrueNAS snapshots",
+				map[string]interface{}{"snapshots": notOrphaned})
+			return
+		}
+		snapshots = body.Snapshots
+	}
+	if snapshots == nil {
+		snapshots = []string{}
+	}
+
+	s.logger.Info("Snapshot cleanup",
+		zap.Bool("dry_run", dryRun),
+		zap.Int("snapshots", len(snapshots)),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", c.GetString("request_id")),
+	)
+
+	if dryRun {
+		c.JSON(http.StatusOK, s.previewConfirmation(gin.H{
+			"timestamp": time.Now().UTC(),
+			"dry_run":   true,
+			"snapshots": snapshots,
+		}, actionCleanupSnapshots, snapshots))
+		return
+	}
+	if !s.confirmed(c, actionCleanupSnapshots, snapshots, body.ConfirmationToken) {
+		return
+	}
+
+	job := s.cleanupEngine.DeleteSnapshots(snapshots)
+	s.analyzer.Invalidate()
+	c.JSON(http.StatusAccepted, gin.H{
+		"timestamp": time.Now().UTC(),
+		"dry_run":   false,
+		"job":       job,
+	})
+}
+
+// cleanupSnapshotContentsHandler deletes dangling VolumeSnapshotContents in
+// a background job. The JSON body {"contents": [...], "dry_run": bool,
+// "force": bool, "confirmation_token": string} limits the contents (every
+// dangling content when empty); names that are not currently reported as
+// dangling are refused, and so are contents with deletionPolicy Retain
+// unless force is set. It defaults to a dry run, which lists the contents
+// with a confirmation token without starting a job; the job only starts for
+// the token of an unchanged list.
+func (s *Server) cleanupSnapshotContentsHandler(c *gin.Context) {
+	if s.cleanupEngine == nil {
+		writeError(c, http.StatusForbidden, ErrorCodeForbidden, "snapshot cleanup is disabled; set cleanup.enabled to enable it", nil)
+		return
+	}
+
+	var body struct {
+		Contents          []string `json:"contents"`
+		DryRun            *bool    `json:"dry_run"`
+		Force             bool     `json:"force"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid request body", nil)
+			return
+		}
+	}
+	dryRun := body.DryRun == nil || *body.DryRun
+
+	result, err := s.runOrphanDetection(c.Request.Context(), "", s.defaultOrphanThreshold)
+	if err != nil {
+		s.logger.Error("Failed to detect orphaned resources", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "orphan detection failed", nil)
+		return
+	}
+	if result.Partial {
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "orphan detection was partial; refusing to delete",
+			map[string]interface{}{"phase_errors": result.PhaseErrors})
+		return
+	}
+
+	policies := map[string]string{}
+	var contents []string
+	for _, resource := range result.OrphanedSnapshots {
+		if resource.Type == orphan.SnapshotContentType {
+			policies[resource.Name] = resource.Details["deletion_policy"]
+			contents = append(contents, resource.Name)
+		}
+	}
+	if len(body.Contents) > 0 {
+		var notDangling []string
+		for _, name := range body.Contents {
+			if _, ok := policies[name]; !ok {
+				notDangling = append(notDangling, name)
+			}
+		}
+		if len(notDangling) > 0 {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "contents are not dangling VolumeSnapshotContents",
+				map[string]interface{}{"contents": notDangling})
+			return
+		}
+		contents = body.Contents
+	}
+	if contents == nil {
+		contents = []string{}
+	}
+	if !body.Force {
+		var retained []string
+		for _, name := range contents {
+			if policies[name] == string(snapshotv1.VolumeSnapshotContentRetain) {
+				retained = append(retained, name)
+			}
+		}
+		if len(retained) > 0 {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "contents have deletionPolicy Retain; set force to delete them",
+				map[string]interface{}{"contents": retained})
+			return
+		}
+	}
+
+	s.logger.Info("VolumeSnapshotContent cleanup",
+		zap.Bool("dry_run", dryRun),
+		zap.Bool("force", body.Force),
+		zap.Int("contents", len(contents)),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", c.GetString("request_id")),
+	)
+
+	if dryRun {
+		c.JSON(http.StatusOK, s.previewConfirmation(gin.H{
+			"timestamp": time.Now().UTC(),
+			"dry_run":   true,
+			"contents":  contents,
+		}, actionCleanupContents, contents))
+		return
+	}
+	if !s.confirmed(c, actionCleanupContents, contents, body.ConfirmationToken) {
+		return
+	}
+
+	job := s.cleanupEngine.DeleteVolumeSnapshotContents(contents)
+	s.analyzer.Invalidate()
+	c.JSON(http.StatusAccepted, gin.H{
+		"timestamp": time.Now().UTC(),
+		"dry_run":   false,
+		"job":       job,
+	})
+}
+
+// listCleanupJobsHandler lists cleanup jobs, newest first.
+func (s *Server) listCleanupJobsHandler(c *gin.Context) {
+	if s.cleanupEngine == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "snapshot cleanup is not enabled", nil)
+		return
+	}
+	jobs := s.cleanupEngine.Jobs()
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"count":     len(jobs),
+		"jobs":      jobs,
+	})
+}
+
+// getCleanupJobHandler reports the progress of a cleanup job.
+func (s *Server) getCleanupJobHandler(c *gin.Context) {
+	s.cleanupJobAction(c, func(id string) (cleanup.Job, error) { return s.cleanupEngine.Job(id) })
+}
+
+// pauseCleanupJobHandler pauses a running cleanup job before its next
+// deletion.
+func (s *Server) pauseCleanupJobHandler(c *gin.Context) {
+	s.cleanupJobAction(c, func(id string) (cleanup.Job, error) { return s.cleanupEngine.Pause(id) })
+}
+
+// resumeCleanupJobHandler resumes a paused cleanup job.
+func (s *Server) resumeCleanupJobHandler(c *gin.Context) {
+	s.cleanupJobAction(c, func(id string) (cleanup.Job, error) { return s.cleanupEngine.Resume(id) })
+}
+
+// cleanupJobAction runs action on the job named by the :id parameter and
+// writes the job or the matching error.
+func (s *Server) cleanupJobAction(c *gin.Context, action func(id string) (cleanup.Job, error)) {
+	if s.cleanupEngine == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "snapshot cleanup is not enabled", nil)
+		return
+	}
+	job, err := action(c.Param("id"))
+	switch {
+	case errors.Is(err, cleanup.ErrJobNotFound):
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "cleanup job not found", nil)
+		return
+	case errors.Is(err, cleanup.ErrInvalidState):
+		writeError(c, http.StatusConflict, ErrorCodeConflict, err.Error(), nil)
+		return
+	case err != nil:
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "cleanup job action failed", nil)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestCleanupHandlers(t *testing.T) {
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	truenasClient := &truenastest.Client{Snapshots: []truenas.Snapshot{
+		{ID: "tank/k8s/pvc-a@old-1", Name: "tank/k8s/pvc-a@old-1", Dataset: "tank/k8s/pvc-a", CreatedAt: old},
+		{ID: "tank/k8s/pvc-a@old-2", Name: "tank/k8s/pvc-a@old-2", Dataset: "tank/k8s/pvc-a", CreatedAt: old},
+		{ID: "tank/k8s/pvc-a@new", Name: "tank/k8s/pvc-a@new", Dataset: "tank/k8s/pvc-a", CreatedAt: time.Now()},
+	}}
+	engine := cleanup.NewEngine(truenasClient, cleanup.Config{Options: cleanup.Options{
+		BatchDelay: time.Millisecond, MaxOpsPerMinute: 600000,
+	}})
+	defer engine.Close()
+
+	newServer := func(engine *cleanup.Engine) *Server {
+		server, err := NewServer(Config{
+			K8sClient:     &stubK8sClient{},
+			TruenasClient: truenasClient,
+			Logger:        zap.NewNop(),
+			AdminToken:    "s3cret",
+			CleanupEngine: engine,
+		})
+		require.NoError(t, err)
+		return server
+	}
+	request := func(server *Server, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(newServer(nil), http.MethodPost, "/api/v1/admin/cleanup/snapshots", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	server := newServer(engine)
+	rec = request(server, http.MethodPost, "/api/v1/admin/cleanup/snapshots", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var dryRun struct {
+		DryRun            bool     `json:"dry_run"`
+		Snapshots         []string `json:"snapshots"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dryRun))
+	require.True(t, dryRun.DryRun)
+	require.Equal(t, []string{"tank/k8s/pvc-a@old-1", "tank/k8s/pvc-a@old-2"}, dryRun.Snapshots)
+	require.NotEmpty(t, dryRun.ConfirmationToken)
+	require.Zero(t, truenasClient.Calls("DeleteSnapshot"))
+
+	rec = request(server, http.MethodPost, "/api/v1/admin/cleanup/snapshots",
+		`{"dry_run": false, "snapshots": ["tank/k8s/pvc-a@new"]}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "tank/k8s/pvc-a@new")
+
+	rec = request(server, http.MethodPost, "/api/v1/admin/cleanup/snapshots", `{"dry_run": false}`)
+	require.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	require.Contains(t, rec.Body.String(), `"reason":"missing"`)
+	require.Empty(t, engine.Jobs())
+
+	rec = request(server, http.MethodPost, "/api/v1/admin/cleanup/snapshots",
+		`{"dry_run": false, "confirmation_token": "`+dryRun.ConfirmationToken+`"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var started struct {
+		Job cleanup.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &started))
+	require.Equal(t, 2, started.Job.Total)
+
+	var job cleanup.Job
+	require.Eventually(t, func() bool {
+		rec := request(server, http.MethodGet, "/api/v1/admin/cleanup/jobs/"+started.Job.ID, "")
+		return rec.Code == http.StatusOK && json.Unmarshal(rec.Body.Bytes(), &job) == nil &&
+			job.Status == cleanup.StatusCompleted
+	}, 5*time.Second, 5*time.Millisecond)
+	require.Equal(t, "2/2", job.Progress)
+	require.Len(t, truenasClient.Snapshots, 1)
+
+	rec = request(server, http.MethodPost, "/api/v1/admin/cleanup/jobs/"+started.Job.ID+"/pause", "")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	rec = request(server, http.MethodPost, "/api/v1/admin/cleanup/jobs/unknown/resume", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = request(server, http.MethodGet, "/api/v1/admin/cleanup/jobs", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"count":1`)
+}
+
+func TestCleanupSnapshotContentsHandler_RetainRequiresForce(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-60 * 24 * time.Hour))
+	content := func(name string, policy snapshotv1.DeletionPolicy) snapshotv1.VolumeSnapshotContent {
+		handle := "tank/k8s/pvc-gone@" + name
+		return snapshotv1.VolumeSnapshotContent{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: old},
+			Spec: snapshotv1.VolumeSnapshotContentSpec{
+				VolumeSnapshotRef: corev1.ObjectReference{Namespace: "apps", Name: "snap-" + name},
+				DeletionPolicy:    policy,
+			},
+			Status: &snapshotv1.VolumeSnapshotContentStatus{SnapshotHandle: &handle},
+		}
+	}
+	k8sClient := &k8stest.Client{VolumeSnapshotContents: []snapshotv1.VolumeSnapshotContent{
+		content("content-delete", snapshotv1.VolumeSnapshotContentDelete),
+		content("content-retain", snapshotv1.VolumeSnapshotContentRetain),
+	}}
+	engine := cleanup.NewEngine(&truenastest.Client{}, cleanup.Config{
+		Options:   cleanup.Options{BatchDelay: time.Millisecond, MaxOpsPerMinute: 600000},
+		K8sClient: k8sClient,
+	})
+	defer engine.Close()
+	server, err := NewServer(Config{
+		K8sClient:     k8sClient,
+		TruenasClient: &truenastest.Client{},
+		Logger:        zap.NewNop(),
+		AdminToken:    "s3cret",
+		CleanupEngine: engine,
+	})
+	require.NoError(t, err)
+	request := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/cleanup/volumesnapshotcontents", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(`{"dry_run": false}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "content-retain")
+	require.Empty(t, k8sClient.DeletedSnapshotContents())
+
+	rec = request(`{"contents": ["content-delete"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"contents":["content-delete"]`)
+
+	rec = request(`{"contents": ["unknown"]}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = request(`{"force": true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var preview struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+
+	rec = request(`{"dry_run": false, "force": true, "confirmation_token": "` + preview.ConfirmationToken + `"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var started struct {
+		Job cleanup.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &started))
+	require.Equal(t, cleanup.TypeVolumeSnapshotContent, started.Job.Type)
+	require.Eventually(t, func() bool {
+		job, err := engine.Job(started.Job.ID)
+		return err == nil && job.Status == cleanup.StatusCompleted
+	}, 5*time.Second, 5*time.Millisecond)
+	require.ElementsMatch(t, []string{"content-delete", "content-retain"}, k8sClient.DeletedSnapshotContents())
+}
+
+func TestCleanupDatasetsHandler(t *testing.T) {
+	old := time.Now().Add(-90 * 24 * time.Hour)
+	k8sClient := &k8stest.Client{StorageClasses: []storagev1.StorageClass{{
+		ObjectMeta:  metav1.ObjectMeta{Name: "nfs"},
+		Provisioner: "org.democratic-csi.nfs",
+		Parameters:  map[string]string{"datasetParentName": "tank/k8s"},
+	}}}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a", Used: 10 << 30, UsedBySnapshots: 10 << 30},
+			{ID: "tank/k8s/pvc-b", Name: "tank/k8s/pvc-b", Used: 4 << 30, UsedBySnapshots: 4 << 30},
+			{ID: "tank/k8s/pvc-clone", Name: "tank/k8s/pvc-clone", Used: 1 << 20,
+				Properties: map[string]string{truenas.PropertyOrigin: "tank/k8s/pvc-b@base"}},
+		},
+		Snapshots: []truenas.Snapshot{
+			{ID: "tank/k8s/pvc-a@1", Name: "tank/k8s/pvc-a@1", Dataset: "tank/k8s/pvc-a", CreatedAt: old},
+			{ID: "tank/k8s/pvc-b@base", Name: "tank/k8s/pvc-b@base", Dataset: "tank/k8s/pvc-b", CreatedAt: old},
+		},
+	}
+	engine := cleanup.NewEngine(truenasClient, cleanup.Config{Options: cleanup.Options{
+		BatchDelay: time.Millisecond, MaxOpsPerMinute: 600000,
+	}})
+	defer engine.Close()
+	server, err := NewServer(Config{
+		K8sClient:     k8sClient,
+		TruenasClient: truenasClient,
+		Logger:        zap.NewNop(),
+		AdminToken:    "s3cret",
+		CleanupEngine: engine,
+	})
+	require.NoError(t, err)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/api/v1/analysis/abandoned-datasets", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report struct {
+		Datasets []struct {
+			Dataset  string   `json:"dataset"`
+			Clones   []string `json:"clones"`
+			Blockers []string `json:"blockers"`
+		} `json:"datasets"`
+		ReclaimableBytes int64 `json:"reclaimable_bytes"`
+		Blocked          int   `json:"blocked"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Len(t, report.Datasets, 2)
+	require.Equal(t, "tank/k8s/pvc-a", report.Datasets[0].Dataset)
+	require.Equal(t, []string{"tank/k8s/pvc-clone"}, report.Datasets[1].Clones)
+	require.Equal(t, int64(10<<30), report.ReclaimableBytes)
+	require.Equal(t, 1, report.Blocked)
+
+	rec = request(http.MethodPost, "/api/v1/admin/cleanup/datasets", `{"datasets": ["tank/k8s/pvc-b"]}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "tank/k8s/pvc-b")
+
+	rec = request(http.MethodPost, "/api/v1/admin/cleanup/datasets", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var dryRun struct {
+		Plan              []string `json:"plan"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dryRun))
+	require.Equal(t, []string{"tank/k8s/pvc-a@1", "tank/k8s/pvc-a"}, dryRun.Plan)
+	require.Empty(t, truenasClient.Mutations())
+
+	rec = request(http.MethodPost, "/api/v1/admin/cleanup/datasets",
+		`{"dry_run": false, "confirmation_token": "`+dryRun.ConfirmationToken+`"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var started struct {
+		Job cleanup.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &started))
+	require.Equal(t, cleanup.TypeTrueNASDataset, started.Job.Type)
+	require.Eventually(t, func() bool {
+		job, err := engine.Job(started.Job.ID)
+		return err == nil && job.Status == cleanup.StatusCompleted
+	}, 5*time.Second, 5*time.Millisecond)
+	require.Equal(t, 1, truenasClient.Calls("DeleteDataset"))
+	require.Len(t, truenasClient.Volumes, 2)
+}
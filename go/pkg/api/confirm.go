@@ -0,0 +1,179 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+// DefaultConfirmationTTL is how long a confirmation token stays valid when
+// ConfirmationConfig.TTL is zero.
+const DefaultConfirmationTTL = 5 * time.Minute
+
+// Destructive actions gated by a confirmation token. A token confirms one
+// action only.
+const (
+	actionCleanupSnapshots = "cleanup_snapshots"
+	actionCleanupContents  = "cleanup_volumesnapshotcontents"
+	actionCleanupDatasets  = "cleanup_datasets"
+	actionApplyQuotas      = "apply_quotas"
+)
+
+// Reasons a destructive request was not confirmed, in
+// APIError.Details["reason"].
+const (
+	confirmationMissing     = "missing"
+	confirmationInvalid     = "invalid"
+	confirmationExpired     = "expired"
+	confirmationUsed        = "used"
+	confirmationPlanChanged = "plan_changed"
+)
+
+// ConfirmationConfig configures the confirmation round trip of destructive
+// admin requests: a dry run returns the plan and a token, and only a
+// request presenting the token executes, provided the plan is unchanged.
+type ConfirmationConfig struct {
+	TTL  time.Duration // zero uses DefaultConfirmationTTL
+	Skip bool          // execute dry_run false requests without a token
+}
+
+// confirmer issues and redeems confirmation tokens. A token is
+// "<expiry>.<plan hash>.<signature>", signed with HMAC-SHA256 over the
+// action, plan hash and expiry under a key generated per process, so a
+// token only confirms on the replica that issued it.
+type confirmer struct {
+	key   []byte
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu sync.Mutex
+	// used maps redeemed tokens to their expiry, after which they are
+	// rejected as expired anyway and forgotten.
+	used map[string]time.Time
+}
+
+func newConfirmer(ttl time.Duration, c clock.Clock) (*confirmer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate confirmation key: %w", err)
+	}
+	if ttl <= 0 {
+		ttl = DefaultConfirmationTTL
+	}
+	return &confirmer{key: key, ttl: ttl, clock: c, used: make(map[string]time.Time)}, nil
+}
+
+// planHash identifies a plan by its items, in any order.
+func planHash(plan []string) string {
+	sorted := append([]string(nil), plan...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (cf *confirmer) sign(action, hash string, expiry int64) string {
+	mac := hmac.New(sha256.New, cf.key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", action, hash, expiry)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue returns a token confirming action on plan and its expiry.
+func (cf *confirmer) issue(action string, plan []string) (string, time.Time) {
+	expires := cf.clock.Now().Add(cf.ttl).Truncate(time.Second)
+	hash := planHash(plan)
+	expiry := expires.Unix()
+	return fmt.Sprintf("%d.%s.%s", expiry, hash, cf.sign(action, hash, expiry)), expires.UTC()
+}
+
+// redeem checks token against action and plan and uses it up. It returns ""
+// when the request is confirmed and the rejection reason otherwise.
+func (cf *confirmer) redeem(action string, plan []string, token string) string {
+	if token == "" {
+		return confirmationMissing
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return confirmationInvalid
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || !hmac.Equal([]byte(parts[2]), []byte(cf.sign(action, parts[1], expiry))) {
+		return confirmationInvalid
+	}
+
+	now := cf.clock.Now()
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	for used, expires := range cf.used {
+		if !now.Before(expires) {
+			delete(cf.used, used)
+		}
+	}
+	if !now.Before(time.Unix(expiry, 0)) {
+		return confirmationExpired
+	}
+	if parts[1] != planHash(plan) {
+		return confirmationPlanChanged
+	}
+	if _, ok := cf.used[token]; ok {
+		return confirmationUsed
+	}
+	cf.used[token] = time.Unix(expiry, 0)
+	return ""
+}
+
+// previewConfirmation adds a confirmation token for action on plan to the
+// body of a dry run, unless confirmation is skipped.
+func (s *Server) previewConfirmation(body gin.H, action string, plan []string) gin.H {
+	if s.confirmer == nil {
+		return body
+	}
+	token, expires := s.confirmer.issue(action, plan)
+	body["confirmation_token"] = token
+	body["confirmation_expires_at"] = expires
+	return body
+}
+
+// confirmed reports whether a dry_run false request for action on plan may
+// execute. When it may not, it has answered 428 with the plan, the reason
+// and a fresh token to confirm the plan with.
+func (s *Server) confirmed(c *gin.Context, action string, plan []string, token string) bool {
+	if s.confirmer == nil {
+		return true
+	}
+	reason := s.confirmer.redeem(action, plan, token)
+	if reason == "" {
+		return true
+	}
+	message := "confirm the plan by repeating the request with its confirmation_token"
+	switch reason {
+	case confirmationExpired:
+		message = "the confirmation token has expired; " + message
+	case confirmationUsed:
+		message = "the confirmation token was already used; " + message
+	case confirmationPlanChanged:
+		message = "the plan changed since it was previewed; review it and " + message
+	case confirmationInvalid:
+		message = "the confirmation token is invalid; " + message
+	}
+	fresh, expires := s.confirmer.issue(action, plan)
+	writeError(c, http.StatusPreconditionRequired, ErrorCodeConfirmationRequired, message, map[string]interface{}{
+		"reason":                  reason,
+		"plan":                    plan,
+		"confirmation_token":      fresh,
+		"confirmation_expires_at": expires,
+	})
+	return false
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestConfirmer(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	cf, err := newConfirmer(0, fake)
+	require.NoError(t, err)
+	plan := []string{"tank/k8s/pvc-a@old", "tank/k8s/pvc-b@old"}
+
+	token, expires := cf.issue(actionCleanupSnapshots, plan)
+	require.Equal(t, fake.Now().Add(DefaultConfirmationTTL), expires)
+	require.Equal(t, confirmationMissing, cf.redeem(actionCleanupSnapshots, plan, ""))
+	require.Equal(t, confirmationInvalid, cf.redeem(actionCleanupContents, plan, token))
+	require.Equal(t, confirmationInvalid, cf.redeem(actionCleanupSnapshots, plan, token+"x"))
+	require.Equal(t, confirmationPlanChanged, cf.redeem(actionCleanupSnapshots, plan[:1], token))
+	// The plan is compared regardless of order, and a token is single-use.
+	require.Empty(t, cf.redeem(actionCleanupSnapshots, []string{plan[1], plan[0]}, token))
+	require.Equal(t, confirmationUsed, cf.redeem(actionCleanupSnapshots, plan, token))
+
+	token, _ = cf.issue(actionCleanupSnapshots, plan)
+	fake.Advance(DefaultConfirmationTTL)
+	require.Equal(t, confirmationExpired, cf.redeem(actionCleanupSnapshots, plan, token))
+	require.Empty(t, cf.used, "expired tokens are forgotten")
+
+	// Another process signs with another key.
+	other, err := newConfirmer(time.Minute, fake)
+	require.NoError(t, err)
+	token, _ = other.issue(actionCleanupSnapshots, plan)
+	require.Equal(t, confirmationInvalid, cf.redeem(actionCleanupSnapshots, plan, token))
+}
+
+func TestCleanupSnapshotsHandler_Confirmation(t *testing.T) {
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	newServer := func(confirmation ConfirmationConfig) (*Server, *truenastest.Client) {
+		truenasClient := &truenastest.Client{Snapshots: []truenas.Snapshot{
+			{ID: "tank/k8s/pvc-a@old-1", Name: "tank/k8s/pvc-a@old-1", Dataset: "tank/k8s/pvc-a", CreatedAt: old},
+			{ID: "tank/k8s/pvc-a@old-2", Name: "tank/k8s/pvc-a@old-2", Dataset: "tank/k8s/pvc-a", CreatedAt: old},
+		}}
+		engine := cleanup.NewEngine(truenasClient, cleanup.Config{Options: cleanup.Options{
+			BatchDelay: time.Millisecond, MaxOpsPerMinute: 600000,
+		}})
+		t.Cleanup(engine.Close)
+		server, err := NewServer(Config{
+			K8sClient:     &stubK8sClient{},
+			TruenasClient: truenasClient,
+			Logger:        zap.NewNop(),
+			AdminToken:    "s3cret",
+			CleanupEngine: engine,
+			Confirmation:  confirmation,
+		})
+		require.NoError(t, err)
+		return server, truenasClient
+	}
+	request := func(server *Server, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/cleanup/snapshots", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	type preview struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+
+	server, _ := newServer(ConfirmationConfig{})
+	rec := request(server, `{"snapshots": ["tank/k8s/pvc-a@old-1"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var one preview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &one))
+
+	// A token previewed for one snapshot does not delete every orphan.
+	rec = request(server, `{"dry_run": false, "confirmation_token": "`+one.ConfirmationToken+`"}`)
+	require.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	var apiErr APIError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &apiErr))
+	require.Equal(t, ErrorCodeConfirmationRequired, apiErr.Code)
+	require.Equal(t, confirmationPlanChanged, apiErr.Details["reason"])
+	require.Len(t, apiErr.Details["plan"], 2)
+	fresh, _ := apiErr.Details["confirmation_token"].(string)
+	require.NotEmpty(t, fresh)
+
+	rec = request(server, `{"dry_run": false, "confirmation_token": "`+fresh+`"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	rec = request(server, `{"dry_run": false, "confirmation_token": "`+fresh+`"}`)
+	require.Equal(t, http.StatusPreconditionRequired, rec.Code)
+
+	server, truenasClient := newServer(ConfirmationConfig{Skip: true})
+	rec = request(server, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), "confirmation_token")
+	rec = request(server, `{"dry_run": false}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Eventually(t, func() bool { return truenasClient.Calls("DeleteSnapshot") == 2 }, 5*time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Connectivity check statuses, aggregated worst-first into the overall
+// status of GET /api/v1/validate/connectivity.
+const (
+	connectivityOK   = "ok"
+	connectivityWarn = "warn"
+	connectivityFail = "fail"
+)
+
+const (
+	// connectivityCacheTTL is how long a connectivity report is served from
+	// cache, so polling dashboards do not hit the backends on every request.
+	connectivityCacheTTL = 30 * time.Second
+	// connectivitySlowRTT warns about a backend slower than this to answer.
+	connectivitySlowRTT = 2 * time.Second
+	// certificateWarnDays warns about a TrueNAS certificate expiring within
+	// this many days.
+	certificateWarnDays = 30
+)
+
+// connectivityCheck is the result of probing one backend. Fields that do not
+// apply to the backend, or were not learned because the probe failed, are
+// omitted.
+type connectivityCheck struct {
+	Status   string   `json:"status"`
+	RTTMs    int64    `json:"rtt_ms"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Kubernetes
+	ServerVersion string `json:"server_version,omitempty"`
+	Platform      string `json:"platform,omitempty"`
+	SnapshotCRDs  *bool  `json:"snapshot_crds_reachable,omitempty"`
+
+	// TrueNAS
+	Product              string     `json:"product,omitempty"`
+	Version              string     `json:"version,omitempty"`
+	Hostname             string     `json:"hostname,omitempty"`
+	AuthMethod           string     `json:"auth_method,omitempty"`
+	CertificateExpiresAt *time.Time `json:"tls_certificate_expires_at,omitempty"`
+	CertificateDaysLeft  *int       `json:"tls_certificate_days_remaining,omitempty"`
+}
+
+func (c *connectivityCheck) warn(message string) {
+	c.Warnings = append(c.Warnings, message)
+	if c.Status == connectivityOK {
+		c.Status = connectivityWarn
+	}
+}
+
+// connectivityReport is the body of GET /api/v1/validate/connectivity
+// without its request-specific fields.
+type connectivityReport struct {
+	Status    string                       `json:"status"`
+	CheckedAt time.Time                    `json:"checked_at"`
+	Checks    map[string]connectivityCheck `json:"checks"`
+}
+
+// connectivityCache holds the last connectivity report.
+type connectivityCache struct {
+	mu     sync.Mutex
+	report *connectivityReport
+}
+
+// validateConnectivityHandler probes both backends and reports per-backend
+// checks with an overall status: ok, warn (degraded but usable) or fail
+// (503). Reports younger than connectivityCacheTTL are served from cache
+// unless refresh=true.
+func (s *Server) validateConnectivityHandler(c *gin.Context) {
+	refresh, _ := strconv.ParseBool(c.Query("refresh"))
+	now := s.clock.Now()
+
+	s.connectivity.mu.Lock()
+	report := s.connectivity.report
+	s.connectivity.mu.Unlock()
+	cached := report != nil && !refresh && now.Sub(report.CheckedAt) < connectivityCacheTTL
+	if !cached {
+		ctx, cancel := s.backendContext(c)
+		report = s.checkConnectivity(ctx)
+		cancel()
+		s.connectivity.mu.Lock()
+		s.connectivity.report = report
+		s.connectivity.mu.Unlock()
+	}
+
+	status := http.StatusOK
+	if report.Status == connectivityFail {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"timestamp":  now.UTC(),
+		"status":     report.Status,
+		"checked_at": report.CheckedAt,
+		"cached":     cached,
+		"checks":     report.Checks,
+	})
+}
+
+// checkConnectivity probes both backends concurrently.
+func (s *Server) checkConnectivity(ctx context.Context) *connectivityReport {
+	var k8sCheck connectivityCheck
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		k8sCheck = s.checkKubernetesConnectivity(ctx)
+	}()
+	truenasCheck := s.checkTrueNASConnectivity(ctx)
+	<-done
+
+	report := &connectivityReport{
+		Status:    connectivityOK,
+		CheckedAt: s.clock.Now().UTC(),
+		Checks:    map[string]connectivityCheck{"kubernetes": k8sCheck, "truenas": truenasCheck},
+	}
+	for _, check := range report.Checks {
+		switch {
+		case check.Status == connectivityFail:
+			report.Status = connectivityFail
+		case check.Status == connectivityWarn && report.Status == connectivityOK:
+			report.Status = connectivityWarn
+		}
+	}
+	return report
+}
+
+// checkKubernetesConnectivity times a server version request and checks
+// that the VolumeSnapshot CRDs answer.
+func (s *Server) checkKubernetesConnectivity(ctx context.Context) connectivityCheck {
+	check := connectivityCheck{Status: connectivityOK}
+	start := time.Now()
+	info, err := s.k8sClient.GetClusterInfo(ctx)
+	rtt := time.Since(start)
+	check.RTTMs = rtt.Milliseconds()
+	if err != nil {
+		check.Status = connectivityFail
+		check.Error = err.Error()
+		return check
+	}
+	if info != nil {
+		check.ServerVersion = info.Version
+		check.Platform = info.Platform
+	}
+	if rtt > connectivitySlowRTT {
+		check.warn(fmt.Sprintf("the API server took %s to answer", rtt.Round(time.Millisecond)))
+	}
+
+	_, err = s.k8sClient.ListVolumeSnapshotClasses(ctx)
+	reachable := err == nil
+	check.SnapshotCRDs = &reachable
+	if !reachable {
+		check.warn(fmt.Sprintf("VolumeSnapshot CRDs are not reachable: %v", err))
+	}
+	return check
+}
+
+// checkTrueNASConnectivity times a system info request and reports the
+// product, version, authentication and certificate it was answered with.
+func (s *Server) checkTrueNASConnectivity(ctx context.Context) connectivityCheck {
+	check := connectivityCheck{Status: connectivityOK}
+	start := time.Now()
+	info, err := s.truenasClient.GetSystemInfo(ctx)
+	rtt := time.Since(start)
+	check.RTTMs = rtt.Milliseconds()
+	if err != nil {
+		check.Status = connectivityFail
+		check.Error = err.Error()
+		return check
+	}
+	if info == nil {
+		return check
+	}
+	check.Product, check.Version = info.Product()
+	check.Hostname = info.Hostname
+	check.AuthMethod = info.AuthMethod
+	if rtt > connectivitySlowRTT {
+		check.warn(fmt.Sprintf("TrueNAS took %s to answer", rtt.Round(time.Millisecond)))
+	}
+
+	if !info.CertificateNotAfter.IsZero() {
+		now := s.clock.Now()
+		expires := info.CertificateNotAfter.UTC()
+		days := int(expires.Sub(now).Hours() / 24)
+		check.CertificateExpiresAt = &expires
+		check.CertificateDaysLeft = &days
+		switch {
+		case expires.Before(now):
+			check.Status = connectivityFail
+			check.Error = "the TrueNAS TLS certificate has expired"
+		case days < certificateWarnDays:
+			check.warn(fmt.Sprintf("the TrueNAS TLS certificate expires in %d days", days))
+		}
+	}
+	return check
+}
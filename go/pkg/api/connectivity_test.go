@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+type connectivityBody struct {
+	Status string                       `json:"status"`
+	Cached bool                         `json:"cached"`
+	Checks map[string]connectivityCheck `json:"checks"`
+}
+
+func getConnectivity(t *testing.T, server *Server, path string) (int, connectivityBody) {
+	t.Helper()
+	rec := performRequest(server, http.MethodGet, path)
+	var body connectivityBody
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+	return rec.Code, body
+}
+
+func TestValidateConnectivityHandler_ReportsBackendsAndCaches(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	k8sClient := &k8stest.Client{
+		ClusterInfo:            &k8s.ClusterInfo{Version: "v1.30.2", Platform: "linux/amd64"},
+		ListSnapshotClassesErr: errors.New("the server could not find the requested resource"),
+	}
+	truenasClient := &truenastest.Client{SystemInfo: &truenas.SystemInfo{
+		Version:             "TrueNAS-SCALE-24.04.2",
+		Hostname:            "nas",
+		AuthMethod:          truenas.AuthMethodBasic,
+		CertificateNotAfter: now.Add(90 * 24 * time.Hour),
+	}}
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{K8sClient: k8sClient, TruenasClient: truenasClient, Logger: zap.NewNop(), Clock: fakeClock})
+	require.NoError(t, err)
+
+	code, body := getConnectivity(t, server, "/api/v1/validate/connectivity")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, connectivityWarn, body.Status)
+	require.False(t, body.Cached)
+
+	kubernetes := body.Checks["kubernetes"]
+	require.Equal(t, connectivityWarn, kubernetes.Status)
+	require.Equal(t, "v1.30.2", kubernetes.ServerVersion)
+	require.NotNil(t, kubernetes.SnapshotCRDs)
+	require.False(t, *kubernetes.SnapshotCRDs)
+	require.Len(t, kubernetes.Warnings, 1)
+
+	nas := body.Checks["truenas"]
+	require.Equal(t, connectivityOK, nas.Status)
+	require.Equal(t, "TrueNAS-SCALE", nas.Product)
+	require.Equal(t, "24.04.2", nas.Version)
+	require.Equal(t, truenas.AuthMethodBasic, nas.AuthMethod)
+	require.Equal(t, 90, *nas.CertificateDaysLeft)
+
+	// A fresh report is served from cache without probing the backends.
+	_, body = getConnectivity(t, server, "/api/v1/validate/connectivity")
+	require.True(t, body.Cached)
+	require.Equal(t, 1, truenasClient.Calls("GetSystemInfo"))
+
+	_, body = getConnectivity(t, server, "/api/v1/validate/connectivity?refresh=true")
+	require.False(t, body.Cached)
+	fakeClock.Advance(connectivityCacheTTL)
+	_, body = getConnectivity(t, server, "/api/v1/validate/connectivity")
+	require.False(t, body.Cached)
+	require.Equal(t, 3, truenasClient.Calls("GetSystemInfo"))
+}
+
+func TestValidateConnectivityHandler_FailsOnUnreachableOrExpired(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient: &k8stest.Client{GetClusterInfoErr: errors.New("connection refused")},
+		TruenasClient: &truenastest.Client{SystemInfo: &truenas.SystemInfo{
+			Version:             "TrueNAS-13.0-U6.1",
+			CertificateNotAfter: now.Add(-time.Hour),
+		}},
+		Logger: zap.NewNop(),
+		Clock:  clock.NewFake(now),
+	})
+	require.NoError(t, err)
+
+	code, body := getConnectivity(t, server, "/api/v1/validate/connectivity")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, connectivityFail, body.Status)
+	require.Equal(t, connectivityFail, body.Checks["kubernetes"].Status)
+	require.Contains(t, body.Checks["kubernetes"].Error, "connection refused")
+	require.Equal(t, connectivityFail, body.Checks["truenas"].Status)
+	require.Contains(t, body.Checks["truenas"].Error, "expired")
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// datasetRouteHandler serves /truenas/datasets/{dataset}/... routes. Dataset
+// names contain slashes, so the route is a wildcard and the action is the
+// last path element.
+func (s *Server) datasetRouteHandler(c *gin.Context) {
+	path := strings.Trim(c.Param("path"), "/")
+	if dataset, ok := strings.CutSuffix(path, "/owner"); ok && dataset != "" {
+		s.datasetOwnerHandler(c, dataset)
+		return
+	}
+	writeError(c, http.StatusNotFound, ErrorCodeNotFound, "route not found", nil)
+}
+
+// datasetOwnerHandler resolves a dataset to the PV, PVC and workloads using
+// it. Datasets without a PV are 404; the details say whether the dataset
+// lies under a parent dataset of the democratic-csi StorageClasses.
+func (s *Server) datasetOwnerHandler(c *gin.Context, dataset string) {
+	ctx := c.Request.Context()
+
+	pvs, err := s.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list persistent volumes", zap.Error(err))
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "failed to list persistent volumes", nil)
+		return
+	}
+	classes, err := s.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list storage classes", zap.Error(err))
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "failed to list storage classes", nil)
+		return
+	}
+
+	owner, ok := analysis.FindDatasetOwner(dataset, pvs, classes)
+	if !ok {
+		prefixes := analysis.ManagedDatasetPrefixes(classes)
+		details := map[string]interface{}{"managed_prefixes": prefixes}
+		if !analysis.UnderPrefixes(dataset, prefixes) {
+			details["note"] = "dataset is outside the managed prefixes"
+		}
+		if _, err := s.truenasClient.GetDataset(ctx, dataset); errors.Is(err, truenas.ErrDatasetNotFound) {
+			details["exists_on_truenas"] = false
+		} else if err == nil {
+			details["exists_on_truenas"] = true
+		}
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no persistent volume uses this dataset", details)
+		return
+	}
+
+	if owner.PersistentVolumeClaim != "" {
+		pods, err := s.k8sClient.ListPods(ctx, owner.Namespace)
+		if err != nil {
+			s.logger.Error("Failed to list pods", zap.String("namespace", owner.Namespace), zap.Error(err))
+			writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "failed to list pods", nil)
+			return
+		}
+		owner.Workloads = analysis.ClaimWorkloads(owner.Namespace, owner.PersistentVolumeClaim, pods)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"owner":     owner,
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Stable error codes returned in APIError.Code. Clients should branch on the
+// code rather than the message, which may change.
+const (
+	ErrorCodeInvalidParameter   = "invalid_parameter"
+	ErrorCodeBackendUnavailable = "backend_unavailable"
+	ErrorCodeNotFound           = "not_found"
+	ErrorCodeScanInProgress     = "scan_in_progress"
+	ErrorCodeConflict           = "conflict"
+	ErrorCodeUnauthorized       = "unauthorized"
+	ErrorCodeForbidden          = "forbidden"
+	ErrorCodeRateLimited        = "rate_limited"
+	ErrorCodeTimeout            = "timeout"
+	ErrorCodeRequestTooLarge    = "request_too_large"
+	ErrorCodeNotImplemented     = "not_implemented"
+	ErrorCodeInternal           = "internal_error"
+	// ErrorCodeConfirmationRequired answers a destructive request without a
+	// valid confirmation token for its plan.
+	ErrorCodeConfirmationRequired = "confirmation_required"
+)
+
+// APIError is the body of every error response.
+type APIError struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// writeError aborts the request with an APIError carrying the request ID set
+// by requestIDMiddleware.
+func writeError(c *gin.Context, status int, code, message string, details map[string]interface{}) {
+	c.AbortWithStatusJSON(status, APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString("request_id"),
+	})
+}
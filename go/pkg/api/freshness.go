@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+)
+
+// Values of the source query parameter of scan-backed reads.
+const (
+	// sourceAuto serves the default view from a monitor scan younger than
+	// RequestLimits.MaxScanAge and queries the backends otherwise.
+	sourceAuto = "auto"
+	// sourceLive always queries the backends.
+	sourceLive = "live"
+	// sourceScan always serves the monitor's last scan, however old.
+	sourceScan = "scan"
+)
+
+// freshness tells clients where a response's data came from and how old it
+// is: a live query (age 0) or the monitor's last scan.
+type freshness struct {
+	Source string    `json:"source"`
+	AsOf   time.Time `json:"as_of"`
+	Age    string    `json:"age"`
+}
+
+func (s *Server) freshness(source string, asOf time.Time) freshness {
+	age := time.Duration(0)
+	if source == sourceScan {
+		age = s.clock.Now().Sub(asOf).Truncate(time.Second)
+		if age < 0 {
+			age = 0
+		}
+	}
+	return freshness{Source: source, AsOf: asOf, Age: formatDurationForAPI(age)}
+}
+
+// backendContext bounds the backend calls of a request by the backend
+// timeout, ending before the route budget so the handler can still answer.
+func (s *Server) backendContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx := c.Request.Context()
+	timeout := s.limits.BackendTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline) - backendHeadroom; remaining < timeout {
+			timeout = remaining
+		}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dataSource parses the source query parameter, writing a 400 response and
+// returning false when it is invalid.
+func dataSource(c *gin.Context) (string, bool) {
+	switch source := c.DefaultQuery("source", sourceAuto); source {
+	case sourceAuto, sourceLive, sourceScan:
+		return source, true
+	default:
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "source must be auto, live or scan", gin.H{"source": source})
+		return "", false
+	}
+}
+
+// lastScan returns the monitor's last scan, or nil when no scan state file
+// is configured or no scan is recorded. Read errors are logged.
+func (s *Server) lastScan() *monitor.ScanState {
+	if s.scanStateFile == "" {
+		return nil
+	}
+	state, err := monitor.ReadScanState(s.scanStateFile)
+	if err != nil {
+		if !errors.Is(err, monitor.ErrNoScanState) {
+			s.logger.Warn("Failed to read scan state", zap.Error(err))
+		}
+		return nil
+	}
+	return state
+}
+
+// servedScan returns the scan that answers the request instead of the
+// backends: the last scan for source=scan, and for source=auto a scan
+// younger than MaxScanAge when the request asks for the default view the
+// monitor computes. It returns nil otherwise, and writes a 404 and returns
+// false for source=scan without a scan.
+func (s *Server) servedScan(c *gin.Context, source string, defaultView bool) (*monitor.ScanState, bool) {
+	switch source {
+	case sourceLive:
+		return nil, true
+	case sourceScan:
+		state := s.lastScan()
+		if state == nil {
+			writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no monitor scan is available", nil)
+			return nil, false
+		}
+		return state, true
+	}
+	if !defaultView {
+		return nil, true
+	}
+	state := s.lastScan()
+	if state == nil || s.clock.Now().Sub(state.Result.Timestamp) > s.limits.MaxScanAge {
+		return nil, true
+	}
+	return state, true
+}
+
+// writeBackendFailure answers a live query that failed. When the backends
+// ran out of time and a scan is available, it answers 503 with the body
+// stale builds from the last scan, marked stale; otherwise 503 for a
+// timeout and 500 for any other error. stale may return nil when the scan
+// lacks the data.
+func (s *Server) writeBackendFailure(c *gin.Context, err error, message string, stale func(*monitor.ScanState) gin.H) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, message, nil)
+		return
+	}
+	timeoutMessage := fmt.Sprintf("%s: backends did not answer in time", message)
+	var body gin.H
+	if state := s.lastScan(); state != nil {
+		body = stale(state)
+	}
+	if body == nil {
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, timeoutMessage, nil)
+		return
+	}
+	body["stale"] = true
+	body["error"] = APIError{
+		Code:      ErrorCodeBackendUnavailable,
+		Message:   timeoutMessage + "; serving the last monitor scan",
+		RequestID: c.GetString("request_id"),
+	}
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, body)
+}
+
+// scanDetectionResult rebuilds the detection result of a monitor scan.
+// Fields the scan does not record, such as sizes and storage classes of
+// orphans, are left empty.
+func scanDetectionResult(result *monitor.ScanResult) *orphan.DetectionResult {
+	detection := &orphan.DetectionResult{
+		Timestamp:                result.Timestamp,
+		OrphanedPVs:              scanOrphans(result.OrphanedPVs, result.Timestamp),
+		OrphanedPVCs:             scanOrphans(result.OrphanedPVCs, result.Timestamp),
+		OrphanedSnapshots:        scanOrphans(result.OrphanedSnapshots, result.Timestamp),
+		OrphanedTrueNASVolumes:   scanOrphans(result.OrphanedTrueNASVolumes, result.Timestamp),
+		TotalPVs:                 result.TotalPVs,
+		TotalPVCs:                result.TotalPVCs,
+		TotalSnapshots:           result.TotalSnapshots,
+		TotalK8sSnapshots:        result.TotalK8sSnapshots,
+		TotalTrueNASSnapshots:    result.TotalTrueNASSnapshots,
+		OrphanedK8sSnapshots:     result.OrphanedK8sSnapshots,
+		OrphanedTrueNASSnapshots: result.OrphanedTrueNASSnapshots,
+		ManagedByTrueNAS:         result.ManagedByTrueNAS,
+		ScanDuration:             result.ScanDuration,
+		Partial:                  result.Partial,
+		PhaseErrors:              result.PhaseErrors,
+		DuplicateVolumeHandles:   result.DuplicateVolumeHandles,
+		Inventory:                result.Inventory,
+		CorrelationUnknown:       result.CorrelationUnknown,
+		ExportMissing:            result.ExportMissing,
+		ExportsChecked:           result.ExportsChecked,
+		Excluded:                 result.Excluded,
+		SnapshotCorrelatedAt:     result.SnapshotCorrelatedAt,
+		Deprecated:               make(map[string]string, len(orphan.DeprecatedResultFields)),
+	}
+	for _, resource := range detection.OrphanedSnapshots {
+		if resource.Type == orphan.SnapshotContentType {
+			detection.OrphanedSnapshotContents++
+		}
+	}
+	for field, note := range orphan.DeprecatedResultFields {
+		detection.Deprecated[field] = note
+	}
+	return detection
+}
+
+// scanOrphans converts the orphans of a scan taken at scanned, deriving
+// their creation time from their age.
+func scanOrphans(resources []monitor.OrphanedResource, scanned time.Time) []orphan.OrphanedResource {
+	converted := make([]orphan.OrphanedResource, 0, len(resources))
+	for _, resource := range resources {
+		converted = append(converted, orphan.OrphanedResource{
+			Type:        resource.Type,
+			Name:        resource.Name,
+			Namespace:   resource.Namespace,
+			UID:         resource.UID,
+			Age:         resource.Age,
+			Reason:      resource.Reason,
+			Labels:      resource.Labels,
+			Annotations: resource.Annotations,
+			CreatedAt:   scanned.Add(-resource.Age),
+			Details:     resource.Details,
+		})
+	}
+	return converted
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+)
+
+func newFreshnessTestServer(t *testing.T, k8sClient *stubK8sClient, scanned time.Time, now *clock.Fake) *Server {
+	t.Helper()
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	if !scanned.IsZero() {
+		data, err := json.Marshal(monitor.ScanState{Result: &monitor.ScanResult{
+			Timestamp:   scanned,
+			TotalPVs:    3,
+			OrphanedPVs: []monitor.OrphanedResource{{Type: "PersistentVolume", Name: "pv-scanned", Age: 48 * time.Hour, Reason: "dataset missing"}},
+			CSIHealth:   &k8s.CSIDriverHealth{Namespace: "democratic-csi", ControllerVersions: []string{"v1.9.0"}},
+		}})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+	}
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     k8sClient,
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+		Clock:         now,
+		Limits:        RequestLimits{MaxScanAge: 10 * time.Minute},
+	})
+	require.NoError(t, err)
+	return server
+}
+
+type freshnessBody struct {
+	Freshness   freshness `json:"freshness"`
+	Stale       bool      `json:"stale"`
+	TotalPVs    int       `json:"total_pvs"`
+	OrphanedPVs []struct {
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"orphaned_pvs"`
+	Error *APIError `json:"error"`
+}
+
+func decodeFreshness(t *testing.T, body []byte) freshnessBody {
+	t.Helper()
+	var decoded freshnessBody
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	return decoded
+}
+
+func TestOrphanHandlers_ServeFreshScan(t *testing.T) {
+	scanned := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	now := clock.NewFake(scanned.Add(3 * time.Minute))
+	k8sClient := &stubK8sClient{democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("pv-live")}}
+	server := newFreshnessTestServer(t, k8sClient, scanned, now)
+
+	for _, path := range []string{"/api/v1/orphans", "/api/v1/orphans/pvs"} {
+		rec := performRequest(server, http.MethodGet, path)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		body := decodeFreshness(t, rec.Body.Bytes())
+		require.Equal(t, freshness{Source: sourceScan, AsOf: scanned, Age: "3m0s"}, body.Freshness, path)
+		require.Equal(t, 3, body.TotalPVs)
+		require.Len(t, body.OrphanedPVs, 1)
+		require.Equal(t, "pv-scanned", body.OrphanedPVs[0].Name)
+		require.Equal(t, scanned.Add(-48*time.Hour), body.OrphanedPVs[0].CreatedAt)
+	}
+
+	// Requests the monitor did not scan for, and source=live, query the
+	// backends.
+	for _, path := range []string{
+		"/api/v1/orphans?source=live",
+		"/api/v1/orphans?namespace=apps",
+		"/api/v1/orphans/pvs?pv_age_threshold=1h",
+		"/api/v1/orphans/pvs?include_excluded=true",
+	} {
+		rec := performRequest(server, http.MethodGet, path)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.Equal(t, sourceLive, decodeFreshness(t, rec.Body.Bytes()).Freshness.Source, path)
+	}
+
+	// Past MaxScanAge the backends answer, unless source=scan.
+	now.Advance(10 * time.Minute)
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans/pvs")
+	require.Equal(t, sourceLive, decodeFreshness(t, rec.Body.Bytes()).Freshness.Source)
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans/pvs?source=scan")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "13m0s", decodeFreshness(t, rec.Body.Bytes()).Freshness.Age)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/csi/health?source=scan")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"controller_versions":["v1.9.0"]`)
+
+	require.Equal(t, http.StatusBadRequest, performRequest(server, http.MethodGet, "/api/v1/orphans?source=cache").Code)
+}
+
+func TestOrphanHandlers_SlowBackendsServeStaleScan(t *testing.T) {
+	scanned := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	now := clock.NewFake(scanned.Add(time.Hour))
+	k8sClient := &stubK8sClient{democraticPVsErr: fmt.Errorf("list pvs: %w", context.DeadlineExceeded)}
+	server := newFreshnessTestServer(t, k8sClient, scanned, now)
+
+	for _, path := range []string{"/api/v1/orphans", "/api/v1/orphans/pvs"} {
+		rec := performRequest(server, http.MethodGet, path)
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code, path)
+		body := decodeFreshness(t, rec.Body.Bytes())
+		require.True(t, body.Stale)
+		require.Equal(t, sourceScan, body.Freshness.Source)
+		require.Equal(t, "1h", body.Freshness.Age)
+		require.Len(t, body.OrphanedPVs, 1)
+		require.NotNil(t, body.Error)
+		require.Equal(t, ErrorCodeBackendUnavailable, body.Error.Code)
+	}
+
+	// Without a scan, a timeout is still a 503; other errors stay 500.
+	server = newFreshnessTestServer(t, k8sClient, time.Time{}, now)
+	require.Equal(t, http.StatusServiceUnavailable, performRequest(server, http.MethodGet, "/api/v1/orphans/pvs").Code)
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/orphans/pvs?source=scan").Code)
+	k8sClient.democraticPVsErr = errors.New("forbidden")
+	require.Equal(t, http.StatusInternalServerError, performRequest(server, http.MethodGet, "/api/v1/orphans/pvs").Code)
+}
+
+func TestBackendContext_EndsBeforeRouteBudget(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+	server.limits.BackendTimeout = time.Hour
+
+	c, _ := gin.CreateTestContext(nil)
+	routeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.Request, _ = http.NewRequestWithContext(routeCtx, http.MethodGet, "/", nil)
+
+	ctx, cancelBackend := server.backendContext(c)
+	defer cancelBackend()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	routeDeadline, _ := routeCtx.Deadline()
+	require.WithinDuration(t, routeDeadline.Add(-backendHeadroom), deadline, 100*time.Millisecond)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+)
+
+// routeLabel returns the route template of the request, or "unmatched" for
+// requests no route handled, so raw paths never become label values.
+func routeLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// requestMetricsMiddleware counts each request and records its latency by
+// route template. It runs outside the recovery middleware, so a recovered
+// panic is counted with its 500 status.
+func requestMetricsMiddleware(exporter *metrics.Exporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		exporter.ObserveAPIRequest(routeLabel(c), c.Request.Method, c.Writer.Status(), time.Since(start).Seconds())
+	}
+}
+
+// recoveryMiddleware turns a handler panic into a 500 response, logs the
+// panic and its stack with the request ID and counts it when metrics are
+// enabled.
+func recoveryMiddleware(logger *zap.Logger, exporter *metrics.Exporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// The client went away; net/http suppresses this panic
+				// itself and it is not a handler bug.
+				panic(recovered)
+			}
+			logger.Error("Recovered from handler panic",
+				zap.Any("panic", recovered),
+				zap.String("request_id", c.GetString("request_id")),
+				zap.String("route", routeLabel(c)),
+				zap.String("method", c.Request.Method),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			if exporter != nil {
+				exporter.IncAPIPanic()
+			}
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "internal server error", nil)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+)
+
+func TestRequestMetrics_ScrapeShowsRoutesStatusesAndPanics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.ErrorLevel)
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Path: "/metrics"})
+	server, err := NewServer(Config{
+		K8sClient:       &stubK8sClient{},
+		TruenasClient:   &stubTruenasClient{},
+		Logger:          zap.New(core),
+		MetricsExporter: exporter,
+	})
+	require.NoError(t, err)
+	server.server.Handler.(*gin.Engine).GET("/api/v1/boom/:id", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	require.Equal(t, http.StatusOK, performRequest(server, http.MethodGet, "/api/v1/truenas/volumes").Code)
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/no-such-route").Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/boom/42", nil)
+	req.Header.Set("X-Request-ID", "req-panic")
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"internal_error"`)
+
+	panics := logs.FilterMessage("Recovered from handler panic").All()
+	require.Len(t, panics, 1)
+	fields := panics[0].ContextMap()
+	require.Equal(t, "req-panic", fields["request_id"])
+	require.Equal(t, "/api/v1/boom/:id", fields["route"])
+	require.Contains(t, fields["stack"], "runtime/debug.Stack")
+
+	rec = performRequest(server, http.MethodGet, "/metrics")
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	require.Contains(t, body, `truenas_api_requests_total{method="GET",route="/api/v1/truenas/volumes",status="200"} 1`)
+	require.Contains(t, body, `truenas_api_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	require.Contains(t, body, `truenas_api_requests_total{method="GET",route="/api/v1/boom/:id",status="500"} 1`)
+	require.Contains(t, body, `truenas_api_request_duration_seconds_count{route="/api/v1/truenas/volumes"} 1`)
+	require.Contains(t, body, "truenas_api_panics_total 1")
+	require.NotContains(t, body, "/api/v1/boom/42")
+	require.NotContains(t, body, "no-such-route")
+}
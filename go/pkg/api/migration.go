@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+)
+
+// migrationHandler reports what moving the claims of StorageClass from to
+// StorageClass to involves: the claims per namespace with their sizes,
+// snapshots and workloads, the capacity needed on the target pool, and the
+// claims that cannot be migrated automatically. It changes nothing.
+func (s *Server) migrationHandler(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" || to == "" {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "from and to StorageClasses are required", nil)
+		return
+	}
+	if from == to {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "from and to must be different StorageClasses", nil)
+		return
+	}
+	ctx := c.Request.Context()
+	var in analysis.MigrationInputs
+	var err error
+
+	if in.StorageClasses, err = s.k8sClient.ListStorageClasses(ctx); err != nil {
+		s.migrationListFailed(c, "storage classes", err)
+		return
+	}
+	if in.Claims, err = s.k8sClient.ListPersistentVolumeClaims(ctx, ""); err != nil {
+		s.migrationListFailed(c, "persistent volume claims", err)
+		return
+	}
+	if in.PersistentVolumes, err = s.k8sClient.ListPersistentVolumes(ctx); err != nil {
+		s.migrationListFailed(c, "persistent volumes", err)
+		return
+	}
+	if in.VolumeSnapshots, err = s.k8sClient.ListVolumeSnapshots(ctx, ""); err != nil {
+		s.migrationListFailed(c, "volume snapshots", err)
+		return
+	}
+	if in.Pods, err = s.k8sClient.ListPods(ctx, ""); err != nil {
+		s.migrationListFailed(c, "pods", err)
+		return
+	}
+	if in.Volumes, err = s.truenasClient.ListVolumes(ctx); err != nil {
+		s.migrationListFailed(c, "TrueNAS volumes", err)
+		return
+	}
+	if in.Snapshots, err = s.truenasClient.ListSnapshots(ctx); err != nil {
+		s.migrationListFailed(c, "TrueNAS snapshots", err)
+		return
+	}
+	if in.Pools, err = s.truenasClient.ListPools(ctx); err != nil {
+		s.migrationListFailed(c, "TrueNAS pools", err)
+		return
+	}
+
+	report, err := analysis.BuildMigrationReport(in, from, to)
+	if err != nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, err.Error(), nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":              time.Now().UTC(),
+		"from":                   report.From,
+		"to":                     report.To,
+		"target_read_write_many": report.TargetReadWriteMany,
+		"claims":                 report.Claims,
+		"blocked":                report.Blocked,
+		"requested_bytes":        report.RequestedBytes,
+		"used_bytes":             report.UsedBytes,
+		"capacity":               report.Capacity,
+		"namespaces":             report.Namespaces,
+		"notes":                  report.Notes,
+	})
+}
+
+// migrationListFailed answers a migration report whose inventory could not
+// be listed.
+func (s *Server) migrationListFailed(c *gin.Context, what string, err error) {
+	s.logger.Error("Failed to list "+what, zap.Error(err))
+	writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "failed to list "+what, nil)
+}
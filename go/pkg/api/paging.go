@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cursorPrefix marks list cursors, so a cursor from another API is refused
+// instead of read as an offset.
+const cursorPrefix = "offset:"
+
+// listPage is the window of a capped list response: the items from offset,
+// at most limit of them.
+type listPage struct {
+	offset int
+	limit  int
+}
+
+// listPaging parses the limit and cursor parameters of a capped list
+// endpoint. limit defaults to, and may not exceed, RequestLimits.MaxListItems;
+// cursor is the next_cursor of a previous truncated response.
+func (s *Server) listPaging(c *gin.Context) (listPage, bool) {
+	page := listPage{limit: s.limits.MaxListItems}
+	if raw, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > s.limits.MaxListItems {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter,
+				fmt.Sprintf("limit must be an integer from 1 to %d", s.limits.MaxListItems), nil)
+			return listPage{}, false
+		}
+		page.limit = limit
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		offset, err := decodeCursor(raw)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "cursor is not valid", nil)
+			return listPage{}, false
+		}
+		page.offset = offset
+	}
+	return page, true
+}
+
+// next returns the cursor of the page after p.
+func (p listPage) next() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(p.offset+p.limit)))
+}
+
+func decodeCursor(raw string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := strings.CutPrefix(string(decoded), cursorPrefix)
+	if !ok {
+		return 0, fmt.Errorf("unknown cursor %q", decoded)
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor offset %q", value)
+	}
+	return offset, nil
+}
+
+// pageItems returns the items of page and whether items remain after it.
+// A cursor past the end yields an empty list.
+func pageItems[T any](items []T, page listPage) ([]T, bool) {
+	if len(items) == 0 {
+		return items, false
+	}
+	if page.offset >= len(items) {
+		return []T{}, false
+	}
+	end := page.offset + page.limit
+	if end >= len(items) {
+		return items[page.offset:], false
+	}
+	return items[page.offset:end], true
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+)
+
+// applyQuotasHandler sets the refquotas suggested by the storage analysis.
+// The JSON body {"datasets": [...], "dry_run": bool, "confirmation_token":
+// string} limits the datasets (all when empty) and defaults to a dry run,
+// which reports the planned changes with a confirmation token without
+// touching TrueNAS. Refquotas are only set for the token of unchanged
+// planned changes.
+func (s *Server) applyQuotasHandler(c *gin.Context) {
+	if !s.quotaRemediation {
+		writeError(c, http.StatusForbidden, ErrorCodeForbidden, "quota remediation is disabled; set monitor.quotas.remediation to enable it", nil)
+		return
+	}
+
+	var body struct {
+		Datasets          []string `json:"datasets"`
+		DryRun            *bool    `json:"dry_run"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid request body", nil)
+			return
+		}
+	}
+	dryRun := body.DryRun == nil || *body.DryRun
+
+	result, err := s.analyzer.Analyze(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to analyze storage", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "storage analysis failed", nil)
+		return
+	}
+
+	changes := analysis.ApplyRefquotas(c.Request.Context(), s.truenasClient, result.QuotaRecommendations, body.Datasets, true)
+	var planned, plan []string
+	for _, change := range changes {
+		if change.Skipped == "" && change.Error == "" {
+			planned = append(planned, change.Dataset)
+			plan = append(plan, fmt.Sprintf("%s=%d", change.Dataset, change.RefquotaBytes))
+		}
+	}
+
+	s.logger.Info("Quota remediation",
+		zap.Bool("dry_run", dryRun),
+		zap.Int("planned", len(plan)),
+		zap.String("client_ip", c.ClientIP()),
+		zap.String("request_id", c.GetString("request_id")),
+	)
+
+	if dryRun {
+		c.JSON(http.StatusOK, s.previewConfirmation(gin.H{
+			"timestamp": time.Now().UTC(),
+			"dry_run":   true,
+			"changes":   changes,
+		}, actionApplyQuotas, plan))
+		return
+	}
+	if !s.confirmed(c, actionApplyQuotas, plan, body.ConfirmationToken) {
+		return
+	}
+	// Apply only the confirmed changes; no datasets would mean all of them.
+	if len(planned) > 0 {
+		changes = analysis.ApplyRefquotas(c.Request.Context(), s.truenasClient, result.QuotaRecommendations, planned, false)
+	}
+	applied := 0
+	for _, change := range changes {
+		if change.Applied {
+			applied++
+		}
+	}
+	if applied > 0 {
+		s.analyzer.Invalidate()
+	}
+	s.logger.Info("Quota remediation applied",
+		zap.Int("applied", applied),
+		zap.String("request_id", c.GetString("request_id")),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"dry_run":   false,
+		"changes":   changes,
+	})
+}
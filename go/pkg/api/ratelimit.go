@@ -142,11 +142,9 @@ func perClientRateLimitMiddleware(limiter *perClientRateLimiter) gin.HandlerFunc
 				retryAfterSec = 1
 			}
 			c.Header("Retry-After", fmt.Sprintf("%d", retryAfterSec))
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate limit exceeded",
+			writeError(c, http.StatusTooManyRequests, ErrorCodeRateLimited, "rate limit exceeded", gin.H{
 				"retry_after": retryAfter.String(),
 			})
-			c.Abort()
 			return
 		}
 		c.Next()
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/artifacts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/schemas"
+)
+
+// detailedReportHandler runs a storage analysis and orphan detection and
+// returns both. With format=html the report is rendered from the report
+// templates; the default format is JSON. Scheduled reports are built by the
+// same generator.
+func (s *Server) detailedReportHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", report.FormatJSON)
+	if !report.ValidFormat(format) {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "format must be one of: json, html", nil)
+		return
+	}
+	// The generator writes the current version, the only one served so far.
+	if format == report.FormatJSON {
+		if _, ok := negotiateSchema(c, schemas.ReportDocument); !ok {
+			return
+		}
+	}
+
+	out, write, err := s.reportGenerator.Stream(c.Request.Context(), report.KindDetailed, format)
+	if err != nil {
+		s.logger.Error("Failed to generate report", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "report generation failed", nil)
+		return
+	}
+	// The report is encoded straight into the response; once it has
+	// started, a failure can only cut it short.
+	c.Header("Content-Type", out.ContentType)
+	c.Status(http.StatusOK)
+	if err := write(c.Writer); err != nil {
+		s.logger.Error("Failed to write report", zap.Error(err))
+	}
+}
+
+// createReportArtifactHandler generates a report and keeps it in the
+// artifact store for download; type picks the report (detailed by default)
+// and format its encoding (json by default).
+func (s *Server) createReportArtifactHandler(c *gin.Context) {
+	if s.artifacts == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report artifacts are not configured", nil)
+		return
+	}
+	kind := c.DefaultQuery("type", report.KindDetailed)
+	if !report.ValidKind(kind) {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "type must be one of: detailed, orphans", nil)
+		return
+	}
+	format := c.DefaultQuery("format", report.FormatJSON)
+	if !report.ValidFormat(format) {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "format must be one of: json, html", nil)
+		return
+	}
+
+	out, write, err := s.reportGenerator.Stream(c.Request.Context(), kind, format)
+	if err != nil {
+		s.logger.Error("Failed to generate report", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "report generation failed", nil)
+		return
+	}
+	artifact, err := s.artifacts.Create(out.Kind, out.Format, write)
+	if err != nil {
+		s.logger.Error("Failed to store report artifact", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to store report artifact", nil)
+		return
+	}
+
+	c.JSON(http.StatusCreated, artifact)
+}
+
+// listReportArtifactsHandler lists the stored report artifacts, newest
+// first.
+func (s *Server) listReportArtifactsHandler(c *gin.Context) {
+	if s.artifacts == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report artifacts are not configured", nil)
+		return
+	}
+
+	list, err := s.artifacts.List()
+	if err != nil {
+		s.logger.Error("Failed to list report artifacts", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to list report artifacts", nil)
+		return
+	}
+
+	opts := s.artifacts.Options()
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"count":     len(list),
+		"items":     list,
+		"retention": opts.Retention.String(),
+		"max_bytes": opts.MaxBytes,
+	})
+}
+
+// downloadReportArtifactHandler serves a stored report artifact. The
+// download holds the file open, so the janitor keeps it until the response
+// is written.
+func (s *Server) downloadReportArtifactHandler(c *gin.Context) {
+	if s.artifacts == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report artifacts are not configured", nil)
+		return
+	}
+
+	name := c.Param("name")
+	download, err := s.artifacts.Open(name)
+	if errors.Is(err, artifacts.ErrNotFound) {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report artifact not found",
+			map[string]interface{}{"name": name})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to open report artifact", zap.String("name", name), zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to open report artifact", nil)
+		return
+	}
+	defer download.Close()
+
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(c.Writer, c.Request, name, download.CreatedAt, download)
+}
+
+// listReportSchedulesHandler lists the monitor's report schedules with
+// their next and last runs, read from the shared schedule state file.
+func (s *Server) listReportSchedulesHandler(c *gin.Context) {
+	if s.reportSchedules == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report schedule state is not configured", nil)
+		return
+	}
+
+	list, err := s.reportSchedules.List()
+	if err != nil {
+		s.logger.Error("Failed to list report schedules", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to list report schedules", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"count":     len(list),
+		"items":     list,
+	})
+}
+
+// pauseReportScheduleHandler pauses a report schedule; the monitor skips
+// its triggers until it is resumed.
+func (s *Server) pauseReportScheduleHandler(c *gin.Context) {
+	s.setReportSchedulePaused(c, true)
+}
+
+// resumeReportScheduleHandler resumes a paused report schedule.
+func (s *Server) resumeReportScheduleHandler(c *gin.Context) {
+	s.setReportSchedulePaused(c, false)
+}
+
+func (s *Server) setReportSchedulePaused(c *gin.Context, paused bool) {
+	if s.reportSchedules == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report schedule state is not configured", nil)
+		return
+	}
+
+	state, err := s.reportSchedules.SetPaused(c.Param("name"), paused)
+	if errors.Is(err, scheduler.ErrScheduleNotFound) {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "report schedule not found",
+			map[string]interface{}{"name": c.Param("name")})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to update report schedule", zap.String("name", c.Param("name")), zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to update report schedule", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/schemas"
+)
+
+// schemaHandler lists the versioned response documents with their current
+// and still supported versions.
+func (s *Server) schemaHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"schemas": schemas.All(),
+	})
+}
+
+// negotiateSchema resolves the schema_version query parameter for the named
+// document. An unsupported version aborts the request with 400 and the
+// supported versions.
+func negotiateSchema(c *gin.Context, name string) (int, bool) {
+	schema, _ := schemas.Get(name)
+	version, err := schema.Negotiate(c.Query("schema_version"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "unsupported schema_version", map[string]interface{}{
+			"schema":             name,
+			"supported_versions": schema.Supported,
+		})
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/schemas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the schema golden files in testdata/schemas")
+
+// schemaRequests are the requests whose responses are checked against
+// testdata/schemas/<name>.v<version>.json.
+var schemaRequests = map[string]string{
+	schemas.OrphanReport:     "/api/v1/orphans",
+	schemas.OrphanedPVs:      "/api/v1/orphans/pvs",
+	schemas.StorageAnalysis:  "/api/v1/analysis",
+	schemas.ReportDocument:   "/api/v1/reports/detailed?format=json",
+	schemas.SummaryReport:    "/api/v1/reports/summary",
+	schemas.ValidationReport: "/api/v1/validate",
+	schemas.ScanDiff:         "/api/v1/scan/diff",
+	schemas.ScanStatus:       "/api/v1/status",
+}
+
+// schemaRequestsV2 are the /api/v2 requests whose responses are checked
+// against testdata/schemas/v2/<name>.v<version>.json.
+var schemaRequestsV2 = map[string]string{
+	schemas.SummaryReport: "/api/v2/reports/summary",
+	schemas.ScanDiff:      "/api/v2/scan/diff",
+	schemas.ScanStatus:    "/api/v2/status",
+}
+
+// TestResponseSchemas_MatchGoldenFiles enforces the schema versioning
+// contract of both API versions: a field removed or retyped without a
+// version bump fails, and new fields must be recorded with -update.
+func TestResponseSchemas_MatchGoldenFiles(t *testing.T) {
+	server := newSchemaTestServer(t)
+
+	for _, schema := range schemas.All() {
+		path, ok := schemaRequests[schema.Name]
+		require.True(t, ok, "no golden request for schema %s", schema.Name)
+		v2Path, ok := schemaRequestsV2[schema.Name]
+		require.Equal(t, ok, containsString(schema.Endpoints, "GET "+v2Path), "v2 golden request and endpoints of schema %s disagree", schema.Name)
+
+		for _, version := range schema.Supported {
+			checkSchemaGolden(t, server, schema.Name, version, path, filepath.Join("testdata", "schemas"))
+			if v2Path != "" {
+				checkSchemaGolden(t, server, schema.Name, version, v2Path, filepath.Join("testdata", "schemas", "v2"))
+			}
+		}
+	}
+}
+
+// checkSchemaGolden compares the shape of the response to path at version
+// with the golden file of the document in dir, or rewrites it with -update.
+func checkSchemaGolden(t *testing.T, server *Server, name string, version int, path, dir string) {
+	t.Helper()
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	rec := performRequest(server, http.MethodGet, fmt.Sprintf("%s%sschema_version=%d", path, sep, version))
+	require.Contains(t, []int{http.StatusOK, http.StatusServiceUnavailable}, rec.Code, "%s: %s", path, rec.Body.String())
+
+	var body interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.EqualValues(t, version, body.(map[string]interface{})["schema_version"], name)
+	got := make(map[string]string)
+	jsonShape(body, "$", got)
+
+	golden := filepath.Join(dir, fmt.Sprintf("%s.v%d.json", name, version))
+	if *updateGolden {
+		data, err := json.MarshalIndent(got, "", "  ")
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+		require.NoError(t, os.WriteFile(golden, append(data, '\n'), 0o644))
+		return
+	}
+	data, err := os.ReadFile(golden)
+	require.NoError(t, err, "missing golden file; run go test ./pkg/api -run TestResponseSchemas -update")
+	var want map[string]string
+	require.NoError(t, json.Unmarshal(data, &want))
+	compareShapes(t, golden, want, got)
+}
+
+// TestResponseSchemas_V2MatchesV1 checks that each v2 document carries the
+// values of its v1 counterpart, since both are built by the same function.
+func TestResponseSchemas_V2MatchesV1(t *testing.T) {
+	server := newSchemaTestServer(t)
+
+	for name, v2Path := range schemaRequestsV2 {
+		bodies := make([]map[string]interface{}, 2)
+		for i, path := range []string{schemaRequests[name], v2Path} {
+			rec := performRequest(server, http.MethodGet, path)
+			require.Equal(t, http.StatusOK, rec.Code, "%s: %s", path, rec.Body.String())
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &bodies[i]))
+			delete(bodies[i], "timestamp")
+		}
+		require.Equal(t, bodies[0], bodies[1], name)
+	}
+}
+
+func TestSchemaVersion_UnsupportedVersionReturns400(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans?schema_version=99")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var body APIError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, ErrorCodeInvalidParameter, body.Code)
+	require.Equal(t, schemas.OrphanReport, body.Details["schema"])
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/schema")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Schemas []schemas.Schema `json:"schemas"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Schemas, len(schemaRequests))
+	require.Equal(t, schemas.OrphanReport, list.Schemas[0].Name)
+	require.Equal(t, []int{1}, list.Schemas[0].Supported)
+}
+
+func newSchemaTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	previous := &monitor.ScanResult{
+		OrphanedPVs: []monitor.OrphanedResource{{Type: "PersistentVolume", Name: "pv-old"}},
+	}
+	transition := analysis.PVPhaseTransition{PersistentVolume: "pv-a", From: "Bound", To: "Released", At: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	current := &monitor.ScanResult{
+		Timestamp:         time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		TotalPVs:          2,
+		OrphanedPVs:       []monitor.OrphanedResource{{Type: "PersistentVolume", Name: "pv-new", Reason: "dataset missing"}},
+		ScanDuration:      time.Second,
+		PhaseErrors:       map[string]string{"truenas_snapshots": "timeout"},
+		Pools:             []analysis.PoolUsage{{Name: "tank", Size: 100, Used: 50}},
+		StorageEfficiency: &analysis.StorageEfficiency{Percent: 25, UsedBytes: 1, RequestedBytes: 4, CorrelatedPVs: 1, TotalPVs: 2, CoveragePercent: 50},
+		Phases:            map[string]monitor.PhaseStats{"k8s_pvs": {Duration: time.Second, Items: 2}},
+		Inventory:         &orphan.InventoryCounts{K8sManagedPVs: 2, TrueNASManagedVolumes: 1, UnmatchedK8s: 1, Drift: 1, DriftPercent: 50},
+		Scope:             &analysis.ScopeReport{Pool: "tank", PoolFound: true, AvailablePools: []string{"tank"}, Problems: []string{}},
+		StorageClasses:    []orphan.StorageClassUsage{{StorageClass: "nfs", Volumes: 2, ProvisionedBytes: 4, UsedBytes: 1, Orphans: 1}},
+		PhaseTransitions:  []analysis.PVPhaseTransition{transition},
+		FlappingVolumes:   []analysis.FlappingVolume{{PersistentVolume: "pv-a", Phase: "Released", Transitions: []analysis.PVPhaseTransition{transition}}},
+		ProvisioningLatency: &analysis.ProvisioningReport{
+			Window:  24 * time.Hour,
+			Overall: analysis.ProvisioningLatency{Count: 1, P50Seconds: 4, P95Seconds: 4},
+		},
+		AbandonedDatasets: &analysis.AbandonedDatasetReport{
+			Datasets: []analysis.AbandonedDataset{{
+				Dataset: "tank/k8s/pvc-old", UsedBytes: 10, SnapshotUsedBytes: 10, ReclaimableBytes: 10,
+				Snapshots: []string{"tank/k8s/pvc-old@a"}, NewestSnapshotAt: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+				Clones: []string{}, Blockers: []string{},
+			}},
+			ReclaimableBytes: 10,
+		},
+	}
+	diff := monitor.DiffScans(previous, current)
+	changes := diff.Changes()
+	current.Changes = &changes
+	data, err := json.Marshal(monitor.ScanState{Result: current, Diff: diff})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient: &stubK8sClient{
+			democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("pv-gone")},
+		},
+		TruenasClient: &stubTruenasClient{
+			volumes: []truenas.Volume{},
+			pools:   []truenas.Pool{{Name: "tank", Size: 100, Used: 85, Available: 15}},
+		},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+	})
+	require.NoError(t, err)
+	return server
+}
+
+// jsonShape records the JSON type of every path in value. Array elements
+// share the path suffix "[]"; differing types at one path are joined by "|".
+func jsonShape(value interface{}, path string, shape map[string]string) {
+	var kind string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		kind = "object"
+		for key, child := range v {
+			jsonShape(child, path+"."+key, shape)
+		}
+	case []interface{}:
+		kind = "array"
+		for _, child := range v {
+			jsonShape(child, path+"[]", shape)
+		}
+	case string:
+		kind = "string"
+	case float64:
+		kind = "number"
+	case bool:
+		kind = "boolean"
+	case nil:
+		kind = "null"
+	}
+	if existing, ok := shape[path]; ok && existing != kind {
+		kinds := strings.Split(existing, "|")
+		if !containsString(kinds, kind) {
+			kinds = append(kinds, kind)
+			sort.Strings(kinds)
+		}
+		kind = strings.Join(kinds, "|")
+	}
+	shape[path] = kind
+}
+
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+func compareShapes(t *testing.T, golden string, want, got map[string]string) {
+	t.Helper()
+	for path, kind := range want {
+		switch gotKind, ok := got[path]; {
+		case !ok:
+			t.Errorf("%s: %s was removed; a breaking change needs a schema version bump", golden, path)
+		case gotKind != kind:
+			t.Errorf("%s: %s changed from %s to %s; a breaking change needs a schema version bump", golden, path, kind, gotKind)
+		}
+	}
+	for path, kind := range got {
+		if _, ok := want[path]; !ok {
+			t.Errorf("%s: new field %s (%s); record it with go test ./pkg/api -run TestResponseSchemas -update", golden, path, kind)
+		}
+	}
+}
+
+func TestV1Deprecation_Headers(t *testing.T) {
+	deprecatedAt := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	sunsetAt := time.Date(2027, 5, 1, 0, 0, 0, 0, time.UTC)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		V1Deprecation: V1Deprecation{DeprecatedAt: deprecatedAt, SunsetAt: sunsetAt, Link: "https://example.com/api-v2"},
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/status")
+	require.Equal(t, "@1793491200", rec.Header().Get("Deprecation"))
+	require.Equal(t, "Sat, 01 May 2027 00:00:00 GMT", rec.Header().Get("Sunset"))
+	require.Equal(t, []string{`<https://example.com/api-v2>; rel="deprecation"`, `</api/v2/status>; rel="successor-version"`}, rec.Header().Values("Link"))
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/version")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Sunset"))
+	require.Equal(t, []string{`<https://example.com/api-v2>; rel="deprecation"`}, rec.Header().Values("Link"), "no v2 successor")
+
+	rec = performRequest(server, http.MethodGet, "/api/v2/status")
+	require.Empty(t, rec.Header().Get("Deprecation"))
+	require.Empty(t, rec.Header().Values("Link"))
+
+	rec = performRequest(newTestServer(t, &stubK8sClient{}, &stubTruenasClient{}), http.MethodGet, "/api/v1/status")
+	require.Empty(t, rec.Header().Get("Deprecation"), "no deprecation configured")
+	require.Empty(t, rec.Header().Get("Sunset"))
+	require.Equal(t, []string{`</api/v2/status>; rel="successor-version"`}, rec.Header().Values("Link"))
+}
@@ -2,15 +2,33 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/artifacts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/schemas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/version"
 	"go.uber.org/zap"
 )
 
@@ -36,19 +54,91 @@ type Server struct {
 	truenasClient           truenas.Client
 	logger                  *zap.Logger
 	orphanDetector          *orphan.Detector
+	analyzer                *analysis.Analyzer
 	defaultOrphanThreshold  time.Duration
 	defaultSnapshotRetention time.Duration
+	orphanGroupWindow        time.Duration
+	snapshotSchedules       []analysis.SchedulePolicy
+	backupCoverage          analysis.BackupCoverageOptions
+	iscsiSessions           analysis.ISCSISessionOptions
+	alertRouter             *alerts.Router
+	alertStore              *alerts.Store
+	alertDispatcher         *alerts.Dispatcher
+	alertsRequired          bool
+	alertChecks             alertChecks
+	scanStateFile           string
+	quotaRemediation        bool
+	abandonedDatasets       analysis.AbandonedDatasetOptions
+	v1Deprecation           V1Deprecation
+	cleanupEngine           *cleanup.Engine
+	reportGenerator         *report.Generator
+	reportSchedules         *scheduler.Store
+	artifacts               *artifacts.Store
+	stateStore              store.Store
+	features                map[string]bool
+	adminToken              string
+	readOnly                bool
+	scope                   analysis.ScopeOptions
+	caches                  []adminCache
+	limits                  RequestLimits
+	metricsExporter         *metrics.Exporter
+	metricsPath             string
+	clock                   clock.Clock
+	connectivity            connectivityCache
+	confirmer               *confirmer // nil when confirmation is skipped
+	ui                      bool
+	startedAt               time.Time
 }
 
 // Config holds the server configuration
 type Config struct {
+	Address                  string // interface to listen on; empty listens on all
 	Port                     int
 	K8sClient                k8s.Client
 	TruenasClient            truenas.Client
 	Logger                   *zap.Logger
+	AccessLog                AccessLogConfig               // zero value logs every request
 	TrustedProxies           []string // empty/nil: do not trust X-Forwarded-For; set for ingress/LB CIDRs
 	OrphanThreshold          time.Duration
 	SnapshotRetention        time.Duration
+	OrphanThresholds         orphan.AgeThresholds          // per-type overrides of OrphanThreshold and SnapshotRetention
+	AnalysisCacheTTL         time.Duration                 // zero uses analysis.DefaultCacheTTL
+	IOStats                  analysis.IOStatsOptions       // adds volume I/O temperatures to /api/v1/analysis
+	Quotas                   analysis.QuotaOptions         // adds refquota recommendations to /api/v1/analysis
+	QuotaRemediation         bool                          // enables POST /api/v1/admin/quotas/apply
+	AbandonedDatasets        analysis.AbandonedDatasetOptions // tunes GET /api/v1/analysis/abandoned-datasets
+	ReadOnly                 bool                          // refuses the admin routes that write with 403
+	Scope                    analysis.ScopeOptions         // configured pool and parent dataset checked by GET /api/v1/validate
+	SnapshotAgeBuckets       []time.Duration               // snapshot_ages bucket bounds; nil uses the defaults
+	SnapshotHeavy            analysis.SnapshotHeavyOptions // tunes the snapshot-heavy volumes recommendation
+	SnapshotSchedules        []analysis.SchedulePolicy
+	BackupCoverage           analysis.BackupCoverageOptions // checked by GET /api/v1/validate when it has policies
+	ISCSISessions            analysis.ISCSISessionOptions  // adds an iscsi_sessions section to GET /api/v1/csi/health
+	Exclusions               orphan.Exclusions
+	StrictSnapshots          bool              // report TrueNAS task-managed snapshots as orphans
+	OrphanGroupWindow        time.Duration     // creation window of ?group_by=auto orphan groups; zero uses orphan.DefaultGroupWindow
+	ScanConfig               *scanconfig.Effective // embedded in detailed reports; nil embeds none
+	AlertRouter              *alerts.Router    // nil disables GET /api/v1/alerts/routes
+	AlertStore               *alerts.Store     // shared with the monitor; nil disables /api/v1/alerts
+	AlertDispatcher          *alerts.Dispatcher // sends test notifications; nil disables POST /api/v1/admin/alerts/test
+	AlertsRequired           bool               // failing alert destinations fail GET /api/v1/validate
+	AlertDestinationChecks   []alerts.DestinationCheck // startup destination test reported by GET /api/v1/validate
+	ScanStateFile            string            // written by the monitor; empty disables GET /api/v1/scan/diff
+	Features                 map[string]bool   // optional features reported by GET /api/v1/version
+	AdminToken               string            // bearer token for /api/v1/admin; empty disables admin routes
+	Limits                   RequestLimits     // per-route timeouts and body size; zero values use defaults
+	V1Deprecation            V1Deprecation     // Deprecation and Sunset headers of /api/v1 responses; zero sends none
+	MetricsExporter          *metrics.Exporter // optional; served at MetricsPath and counts request timeouts
+	MetricsPath              string            // defaults to /metrics
+	Tracer                   *tracing.Tracer   // records a span per request; nil disables tracing
+	CleanupEngine            *cleanup.Engine   // runs snapshot cleanup jobs; nil disables /api/v1/admin/cleanup
+	Confirmation             ConfirmationConfig // token round trip of destructive admin requests
+	Reports                  *report.Renderer  // renders HTML reports; nil uses the default template
+	ReportSchedules          *scheduler.Store  // shared with the monitor; nil disables /api/v1/reports/schedules
+	Artifacts                *artifacts.Store  // keeps generated reports; nil disables /api/v1/reports/artifacts
+	Store                    store.Store       // persistent state store checked by GET /ready; nil when not configured
+	Clock                    clock.Clock       // ages the monitor's scan results; nil uses the wall clock
+	UI                       bool              // serves the web UI at /
 }
 
 // NewServer creates a new API server with comprehensive middleware
@@ -76,8 +166,14 @@ func NewServer(config Config) (*Server, error) {
 		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
 	}
 
+	// Count requests by route template, outside recovery so panics count
+	// as 500s
+	if config.MetricsExporter != nil {
+		router.Use(requestMetricsMiddleware(config.MetricsExporter))
+	}
+
 	// Add recovery middleware
-	router.Use(gin.Recovery())
+	router.Use(recoveryMiddleware(logger, config.MetricsExporter))
 
 	// Add CORS middleware
 	router.Use(corsMiddleware())
@@ -85,8 +181,13 @@ func NewServer(config Config) (*Server, error) {
 	// Add request ID middleware for tracing
 	router.Use(requestIDMiddleware())
 
+	// Add a span per request when tracing is enabled
+	if config.Tracer != nil {
+		router.Use(tracingMiddleware(config.Tracer)...)
+	}
+
 	// Add logging middleware
-	router.Use(loggingMiddleware(logger))
+	router.Use(loggingMiddleware(logger, config.AccessLog))
 
 	// Add per-client rate limiting middleware
 	router.Use(perClientRateLimitMiddleware(nil))
@@ -103,19 +204,93 @@ func NewServer(config Config) (*Server, error) {
 	orphanDetector, err := orphan.NewDetector(config.K8sClient, config.TruenasClient, orphan.Config{
 		AgeThreshold:      orphanThreshold,
 		SnapshotRetention: snapshotRetention,
+		Thresholds:        config.OrphanThresholds,
 		DryRun:            true,
+		Exclusions:        config.Exclusions,
+		StrictSnapshots:   config.StrictSnapshots,
+		Logger:            logging.FromZap(logger),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create orphan detector: %w", err)
 	}
 
+	analyzer := analysis.NewAnalyzer(config.K8sClient, config.TruenasClient, analysis.Options{
+		CacheTTL:           config.AnalysisCacheTTL,
+		IOStats:            config.IOStats,
+		Quota:              config.Quotas,
+		SnapshotAgeBuckets: config.SnapshotAgeBuckets,
+		SnapshotHeavy:      config.SnapshotHeavy,
+	})
+
+	reports := config.Reports
+	if reports == nil {
+		reports, err = report.New(report.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load default report template: %w", err)
+		}
+	}
+
 	server := &Server{
 		k8sClient:                config.K8sClient,
 		truenasClient:            config.TruenasClient,
 		logger:                   logger,
 		orphanDetector:           orphanDetector,
+		analyzer:                 analyzer,
 		defaultOrphanThreshold:   orphanThreshold,
 		defaultSnapshotRetention: snapshotRetention,
+		orphanGroupWindow:        config.OrphanGroupWindow,
+		snapshotSchedules:        config.SnapshotSchedules,
+		backupCoverage:           config.BackupCoverage,
+		iscsiSessions:            config.ISCSISessions,
+		alertRouter:              config.AlertRouter,
+		alertStore:               config.AlertStore,
+		alertDispatcher:          config.AlertDispatcher,
+		alertsRequired:           config.AlertsRequired,
+		scanStateFile:            config.ScanStateFile,
+		reportSchedules:          config.ReportSchedules,
+		artifacts:                config.Artifacts,
+		stateStore:               config.Store,
+		quotaRemediation:         config.QuotaRemediation,
+		abandonedDatasets:        config.AbandonedDatasets,
+		v1Deprecation:            config.V1Deprecation,
+		cleanupEngine:            config.CleanupEngine,
+		reportGenerator: &report.Generator{
+			Analyzer: analyzer,
+			Detector: orphanDetector,
+			Renderer: reports,
+			Thresholds: report.Thresholds{
+				OrphanAge:         orphanThreshold,
+				SnapshotRetention: snapshotRetention,
+			},
+			GroupWindow:     config.OrphanGroupWindow,
+			Config:          config.ScanConfig,
+			FlappingVolumes: scanStateFlapping(config.ScanStateFile),
+		},
+		features:                 config.Features,
+		adminToken:               config.AdminToken,
+		readOnly:                 config.ReadOnly,
+		scope:                    config.Scope,
+		limits:                   config.Limits.withDefaults(),
+		metricsExporter:          config.MetricsExporter,
+		metricsPath:              config.MetricsPath,
+		clock:                    clock.OrReal(config.Clock),
+		startedAt:                time.Now(),
+		ui:                       config.UI,
+	}
+	if server.metricsPath == "" {
+		server.metricsPath = "/metrics"
+	}
+	if config.Confirmation.Skip {
+		logger.Warn("Destructive admin requests execute without confirmation")
+	} else {
+		server.confirmer, err = newConfirmer(config.Confirmation.TTL, server.clock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	server.caches = server.adminCaches()
+	if config.AlertDestinationChecks != nil {
+		server.alertChecks.set(config.AlertDestinationChecks, server.startedAt.UTC())
 	}
 
 	// Setup routes
@@ -123,10 +298,10 @@ func NewServer(config Config) (*Server, error) {
 
 	// Create HTTP server with enhanced configuration
 	server.server = &http.Server{
-		Addr:           fmt.Sprintf(":%d", config.Port),
+		Addr:           net.JoinHostPort(config.Address, strconv.Itoa(config.Port)),
 		Handler:        router,
 		ReadTimeout:    30 * time.Second,
-		WriteTimeout:   30 * time.Second,
+		WriteTimeout:   server.limits.ReportTimeout + 10*time.Second, // route budgets answer first
 		IdleTimeout:    120 * time.Second,
 		MaxHeaderBytes: 1 << 20, // 1MB
 	}
@@ -134,12 +309,23 @@ func NewServer(config Config) (*Server, error) {
 	return server, nil
 }
 
-// Start starts the API server
+// Handler returns the server's HTTP handler, for serving it on a listener
+// other than the configured port (e.g. httptest in integration tests).
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start starts the API server. It binds the address before returning, so a
+// port in use fails startup.
 func (s *Server) Start(ctx context.Context) error {
 	s.logger.Info("Starting API server", zap.String("addr", s.server.Addr))
 
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("API server cannot listen on %s (api.address and api.port or -port): %w", s.server.Addr, err)
+	}
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			s.logger.Error("API server error", zap.Error(err))
 		}
 	}()
@@ -153,46 +339,113 @@ func (s *Server) Stop(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
-// setupRoutes configures all API routes
+// setupRoutes configures all API routes. Every route gets the read or report
+// budget from the server's RequestLimits.
 func (s *Server) setupRoutes(router *gin.Engine) {
+	read := timeoutMiddleware(s.limits.ReadTimeout, s.recordTimeout)
+	report := timeoutMiddleware(s.limits.ReportTimeout, s.recordTimeout)
+
 	// Health check
-	router.GET("/health", s.healthHandler)
-	router.GET("/ready", s.readyHandler)
+	router.GET("/health", read, s.healthHandler)
+	router.GET("/ready", read, s.readyHandler)
+	router.GET("/statusz", read, s.statuszHandler)
+	router.GET("/healthz", read, s.statuszHandler)
+
+	// Metrics, when an exporter is configured
+	if s.metricsExporter != nil {
+		router.GET(s.metricsPath, gin.WrapH(s.metricsExporter.Handler()))
+	}
 
-	// API v1 routes
-	v1 := router.Group("/api/v1")
+	// Web UI
+	if s.ui {
+		s.setupUIRoutes(router)
+	}
+
+	// API v2 routes, then v1 linking to them
+	v2Paths := s.setupV2Routes(router, read, report)
+	v1 := router.Group("/api/v1", bodyLimitMiddleware(s.limits.MaxBodyBytes), deprecationMiddleware(s.v1Deprecation, v2Paths))
 	{
+		v1.GET("/version", read, s.versionHandler)
+		v1.GET("/schema", read, s.schemaHandler)
+
 		// Orphaned resources
-		v1.GET("/orphans", s.listOrphansHandler)
-		v1.GET("/orphans/pvs", s.listOrphanedPVsHandler)
-		v1.GET("/orphans/pvcs", s.listOrphanedPVCsHandler)
-		v1.GET("/orphans/snapshots", s.listOrphanedSnapshotsHandler)
+		v1.GET("/orphans", report, s.listOrphansHandler)
+		v1.GET("/orphans/pvs", report, s.listOrphanedPVsHandler)
+		v1.GET("/orphans/pvcs", report, s.listOrphanedPVCsHandler)
+		v1.GET("/orphans/snapshots", report, s.listOrphanedSnapshotsHandler)
+		v1.GET("/orphans/correlation-unknown", report, s.listCorrelationUnknownPVsHandler)
 
 		// Storage analysis
-		v1.GET("/analysis", s.storageAnalysisHandler)
-		v1.GET("/analysis/usage", s.storageUsageHandler)
-		v1.GET("/analysis/trends", s.storageTrendsHandler)
+		v1.GET("/analysis", report, s.storageAnalysisHandler)
+		v1.GET("/analysis/usage", report, s.storageUsageHandler)
+		v1.GET("/analysis/trends", report, s.storageTrendsHandler)
+		v1.GET("/analysis/simulate", report, s.simulateHandler)
+		v1.GET("/analysis/migration", report, s.migrationHandler)
+		v1.GET("/analysis/abandoned-datasets", report, s.abandonedDatasetsHandler)
+		v1.GET("/analysis/volumes/:pv", report, s.volumeAnalysisHandler)
 
 		// Resources
-		v1.GET("/resources/pvs", s.listPVsHandler)
-		v1.GET("/resources/pvcs", s.listPVCsHandler)
-		v1.GET("/resources/snapshots", s.listSnapshotsHandler)
-		v1.GET("/resources/storageclasses", s.listStorageClassesHandler)
+		v1.GET("/resources/pvs", read, s.listPVsHandler)
+		v1.GET("/resources/attachments", read, s.listAttachmentsHandler)
+		v1.GET("/resources/pvcs", read, s.listPVCsHandler)
+		v1.GET("/resources/snapshots", read, s.listSnapshotsHandler)
+		v1.GET("/resources/storageclasses", read, s.listStorageClassesHandler)
 
 		// TrueNAS resources
-		v1.GET("/truenas/volumes", s.listTrueNASVolumesHandler)
-		v1.GET("/truenas/snapshots", s.listTrueNASSnapshotsHandler)
-		v1.GET("/truenas/pools", s.listTrueNASPoolsHandler)
-		v1.GET("/truenas/info", s.getTrueNASInfoHandler)
+		v1.GET("/truenas/volumes", read, s.listTrueNASVolumesHandler)
+		v1.GET("/truenas/snapshots", read, s.listTrueNASSnapshotsHandler)
+		v1.GET("/truenas/pools", read, s.listTrueNASPoolsHandler)
+		v1.GET("/truenas/info", read, s.getTrueNASInfoHandler)
+		v1.GET("/truenas/datasets/*path", read, s.datasetRouteHandler)
+
+		// CSI driver
+		v1.GET("/csi/health", read, s.csiHealthHandler)
 
 		// Validation
-		v1.GET("/validate", s.validateHandler)
-		v1.GET("/validate/config", s.validateConfigHandler)
-		v1.GET("/validate/connectivity", s.validateConnectivityHandler)
+		v1.GET("/validate", report, s.validateHandler)
+		v1.GET("/validate/config", report, s.validateConfigHandler)
+		v1.GET("/validate/connectivity", read, s.validateConnectivityHandler)
 
 		// Reports
-		v1.GET("/reports/summary", s.summaryReportHandler)
-		v1.GET("/reports/detailed", s.detailedReportHandler)
+		v1.GET("/reports/summary", report, s.summaryReportHandler)
+		v1.GET("/reports/detailed", report, s.detailedReportHandler)
+		v1.GET("/reports/schedules", read, s.listReportSchedulesHandler)
+		v1.POST("/reports/artifacts", report, s.createReportArtifactHandler)
+		v1.GET("/reports/artifacts", read, s.listReportArtifactsHandler)
+		v1.GET("/reports/artifacts/:name", read, s.downloadReportArtifactHandler)
+
+		// Scans
+		v1.GET("/scan/diff", read, s.scanDiffHandler)
+		v1.GET("/status", read, s.scanStatusHandler)
+
+		// Alerts
+		v1.GET("/alerts", read, s.listAlertsHandler)
+		v1.POST("/alerts/:id/ack", read, s.acknowledgeAlertHandler)
+		v1.GET("/alerts/routes", read, s.alertRoutesHandler)
+
+		// Administration
+		admin := v1.Group("/admin", adminAuthMiddleware(s.adminToken, s.logger))
+		admin.GET("/cache", read, s.cacheStatusHandler)
+		admin.POST("/cache/invalidate", report, s.invalidateCacheHandler)
+		admin.POST("/quotas/apply", report, s.mutating(s.applyQuotasHandler))
+		admin.POST("/cleanup/snapshots", report, s.mutating(s.cleanupSnapshotsHandler))
+		admin.POST("/cleanup/volumesnapshotcontents", report, s.mutating(s.cleanupSnapshotContentsHandler))
+		admin.POST("/cleanup/datasets", report, s.mutating(s.cleanupDatasetsHandler))
+		admin.POST("/alerts/test", report, s.testAlertDestinationsHandler)
+		admin.GET("/cleanup/jobs", read, s.listCleanupJobsHandler)
+		admin.GET("/cleanup/jobs/:id", read, s.getCleanupJobHandler)
+		admin.POST("/cleanup/jobs/:id/pause", read, s.pauseCleanupJobHandler)
+		admin.POST("/cleanup/jobs/:id/resume", read, s.resumeCleanupJobHandler)
+		admin.POST("/reports/schedules/:name/pause", read, s.pauseReportScheduleHandler)
+		admin.POST("/reports/schedules/:name/resume", read, s.resumeReportScheduleHandler)
+	}
+}
+
+// recordTimeout logs and counts a request that exceeded its route budget.
+func (s *Server) recordTimeout(route string) {
+	s.logger.Warn("Request exceeded its timeout budget", zap.String("route", route))
+	if s.metricsExporter != nil {
+		s.metricsExporter.IncAPIRequestTimeout(route)
 	}
 }
 
@@ -204,32 +457,75 @@ func (s *Server) parseAgeThreshold(c *gin.Context) (time.Duration, string, bool)
 
 	parsed, err := time.ParseDuration(ageThresholdRaw)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid age_threshold format",
-		})
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid age_threshold format", nil)
 		return 0, ageThresholdRaw, false
 	}
 	if parsed <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "age_threshold must be greater than 0",
-		})
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "age_threshold must be greater than 0", nil)
 		return 0, ageThresholdRaw, false
 	}
 	return parsed, ageThresholdRaw, true
 }
 
-func (s *Server) runOrphanDetection(ctx context.Context, namespace string, ageThreshold time.Duration) (*orphan.DetectionResult, error) {
-	return s.orphanDetector.WithAgeThreshold(ageThreshold).DetectOrphanedResources(ctx, namespace)
+// orphanThresholdParams are the per-type age threshold query parameters.
+var orphanThresholdParams = []struct {
+	name  string
+	field func(*orphan.AgeThresholds) *time.Duration
+}{
+	{"pv_age_threshold", func(t *orphan.AgeThresholds) *time.Duration { return &t.PersistentVolume }},
+	{"pvc_age_threshold", func(t *orphan.AgeThresholds) *time.Duration { return &t.PersistentVolumeClaim }},
+	{"snapshot_age_threshold", func(t *orphan.AgeThresholds) *time.Duration { return &t.VolumeSnapshot }},
+	{"truenas_snapshot_age_threshold", func(t *orphan.AgeThresholds) *time.Duration { return &t.TrueNASSnapshot }},
+	{"truenas_volume_age_threshold", func(t *orphan.AgeThresholds) *time.Duration { return &t.TrueNASVolume }},
+}
+
+// requestOrphanDetector returns the orphan detector with the request's
+// threshold query parameters applied. An explicit age_threshold replaces the
+// configured per-type thresholds except the TrueNAS snapshot one; per-type
+// parameters override both. It writes a 400 response and returns false on
+// an invalid parameter.
+func (s *Server) requestOrphanDetector(c *gin.Context) (*orphan.Detector, string, bool) {
+	ageThreshold, ageThresholdRaw, ok := s.parseAgeThreshold(c)
+	if !ok {
+		return nil, ageThresholdRaw, false
+	}
+
+	thresholds := s.orphanDetector.TypeThresholds()
+	if _, explicit := c.GetQuery("age_threshold"); explicit {
+		thresholds = orphan.AgeThresholds{TrueNASSnapshot: thresholds.TrueNASSnapshot}
+	}
+	for _, param := range orphanThresholdParams {
+		raw, ok := c.GetQuery(param.name)
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, param.name+" must be a duration greater than 0", nil)
+			return nil, ageThresholdRaw, false
+		}
+		*param.field(&thresholds) = parsed
+	}
+	return s.orphanDetector.WithThresholds(ageThreshold, thresholds), ageThresholdRaw, true
 }
 
-func (s *Server) runOrphanPVDetection(ctx context.Context, ageThreshold time.Duration) (*orphan.DetectionResult, error) {
-	return s.orphanDetector.WithAgeThreshold(ageThreshold).DetectOrphanedPVs(ctx)
+// ageThresholdsResponse reports the per-type thresholds a detection used.
+func ageThresholdsResponse(thresholds orphan.AgeThresholds) gin.H {
+	return gin.H{
+		"persistent_volume":       formatDurationForAPI(thresholds.PersistentVolume),
+		"persistent_volume_claim": formatDurationForAPI(thresholds.PersistentVolumeClaim),
+		"volume_snapshot":         formatDurationForAPI(thresholds.VolumeSnapshot),
+		"truenas_snapshot":        formatDurationForAPI(thresholds.TrueNASSnapshot),
+		"truenas_volume":          formatDurationForAPI(thresholds.TrueNASVolume),
+	}
+}
+
+func (s *Server) runOrphanDetection(ctx context.Context, namespace string, ageThreshold time.Duration) (*orphan.DetectionResult, error) {
+	return s.orphanDetector.WithAgeThreshold(ageThreshold).DetectOrphanedResources(ctx, namespace)
 }
 
 func notImplemented(c *gin.Context, endpoint string) {
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error":    "not_implemented",
-		"message":  "endpoint not implemented",
+	writeError(c, http.StatusNotImplemented, ErrorCodeNotImplemented, "endpoint not implemented", gin.H{
 		"endpoint": endpoint,
 	})
 }
@@ -239,19 +535,43 @@ func (s *Server) healthHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "healthy",
 		"timestamp": time.Now().UTC(),
-		"version":   "0.1.0",
+		"version":   version.Version,
 	})
 }
 
+// versionHandler reports build information and the enabled optional features
+func (s *Server) versionHandler(c *gin.Context) {
+	features := s.features
+	if features == nil {
+		features = map[string]bool{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"build":     version.Get(),
+		"features":  features,
+		"read_only": s.readOnly,
+	})
+}
+
+// mutating returns handler, or in read-only mode a handler refusing the
+// request with 403, so routes that write never reach the clients.
+func (s *Server) mutating(handler gin.HandlerFunc) gin.HandlerFunc {
+	if !s.readOnly {
+		return handler
+	}
+	return func(c *gin.Context) {
+		writeError(c, http.StatusForbidden, ErrorCodeForbidden, "the server runs in read-only mode (read_only: true); this endpoint writes to Kubernetes or TrueNAS", nil)
+	}
+}
+
 // readyHandler handles readiness check requests
 func (s *Server) readyHandler(c *gin.Context) {
-	ctx := c.Request.Context()
+	ctx, cancel := s.backendContext(c)
+	defer cancel()
 
 	// Test Kubernetes connection
 	if err := s.k8sClient.TestConnection(ctx); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "kubernetes connection failed", gin.H{
 			"status": "not ready",
-			"reason": "kubernetes connection failed",
 			"error":  err.Error(),
 		})
 		return
@@ -259,14 +579,24 @@ func (s *Server) readyHandler(c *gin.Context) {
 
 	// Test TrueNAS connection
 	if err := s.truenasClient.TestConnection(ctx); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "truenas connection failed", gin.H{
 			"status": "not ready",
-			"reason": "truenas connection failed",
 			"error":  err.Error(),
 		})
 		return
 	}
 
+	// Test the state store
+	if s.stateStore != nil {
+		if err := s.stateStore.Ping(ctx); err != nil {
+			writeError(c, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, "state store unavailable", gin.H{
+				"status": "not ready",
+				"error":  err.Error(),
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "ready",
 		"timestamp": time.Now().UTC(),
@@ -275,64 +605,252 @@ func (s *Server) readyHandler(c *gin.Context) {
 
 // listOrphansHandler handles requests for all orphaned resources
 func (s *Server) listOrphansHandler(c *gin.Context) {
+	schemaVersion, ok := negotiateSchema(c, schemas.OrphanReport)
+	if !ok {
+		return
+	}
 	namespace := c.Query("namespace")
-	ageThreshold, ageThresholdRaw, ok := s.parseAgeThreshold(c)
+	groupWindow, grouped, ok := s.orphanGrouping(c)
+	if !ok {
+		return
+	}
+	detector, ageThresholdRaw, ok := s.requestOrphanDetector(c)
+	if !ok {
+		return
+	}
+	source, ok := dataSource(c)
+	if !ok {
+		return
+	}
+	page, ok := s.listPaging(c)
+	if !ok {
+		return
+	}
+
+	report := func(result *orphan.DetectionResult, source string) gin.H {
+		totalOrphans := len(result.OrphanedPVs) + len(result.OrphanedPVCs) + len(result.OrphanedSnapshots) + len(result.OrphanedTrueNASVolumes)
+		pvs, morePVs := pageItems(result.OrphanedPVs, page)
+		pvcs, morePVCs := pageItems(result.OrphanedPVCs, page)
+		snapshots, moreSnapshots := pageItems(result.OrphanedSnapshots, page)
+		volumes, moreVolumes := pageItems(result.OrphanedTrueNASVolumes, page)
+		truncated := morePVs || morePVCs || moreSnapshots || moreVolumes
+		response := gin.H{
+			"schema_version":             schemaVersion,
+			"timestamp":                  result.Timestamp,
+			"freshness":                  s.freshness(source, result.Timestamp),
+			"namespace":                  namespace,
+			"age_threshold":              ageThresholdRaw,
+			"age_thresholds":             ageThresholdsResponse(detector.TypeThresholds()),
+			"snapshot_retention":         formatDurationForAPI(s.defaultSnapshotRetention),
+			"orphaned_pvs":               pvs,
+			"orphaned_pvcs":              pvcs,
+			"orphaned_snapshots":         snapshots,
+			"orphaned_truenas_volumes":   volumes,
+			"orphan_counts": gin.H{
+				"pvs":             len(result.OrphanedPVs),
+				"pvcs":            len(result.OrphanedPVCs),
+				"snapshots":       len(result.OrphanedSnapshots),
+				"truenas_volumes": len(result.OrphanedTrueNASVolumes),
+			},
+			"limit":                      page.limit,
+			"truncated":                  truncated,
+			"total_pvs":                  result.TotalPVs,
+			"total_pvcs":                 result.TotalPVCs,
+			"total_snapshots":            result.TotalSnapshots,
+			"scan_duration":              result.ScanDuration.String(),
+			"total_orphans":              totalOrphans,
+			"partial":                    result.Partial,
+			"phase_errors":               result.PhaseErrors,
+			"unreadable_namespaces":      result.UnreadableNamespaces,
+			"namespace_coverage_percent": result.NamespaceCoveragePercent,
+			"total_k8s_snapshots":        result.TotalK8sSnapshots,
+			"total_truenas_snapshots":    result.TotalTrueNASSnapshots,
+			"orphaned_k8s_snapshots":     result.OrphanedK8sSnapshots,
+			"orphaned_truenas_snapshots": result.OrphanedTrueNASSnapshots,
+			"orphaned_snapshot_contents": result.OrphanedSnapshotContents,
+			"managed_by_truenas":         result.ManagedByTrueNAS,
+			"deprecated":                 result.Deprecated,
+			"duplicate_volume_handles":   result.DuplicateVolumeHandles,
+			"correlation_unknown":        result.CorrelationUnknown,
+			"export_missing":             result.ExportMissing,
+			"excluded":                   result.Excluded,
+			"excluded_resources":         excludedResources(c, result),
+		}
+		if truncated {
+			response["next_cursor"] = page.next()
+		}
+		if grouped {
+			response["group_window"] = formatDurationForAPI(groupWindow)
+			response["groups"] = result.Groups(groupWindow)
+		}
+		return response
+	}
+	fromScan := func(state *monitor.ScanState) gin.H {
+		return report(scanDetectionResult(state.Result), sourceScan)
+	}
+
+	state, ok := s.servedScan(c, source, namespace == "" && defaultOrphanView(c))
 	if !ok {
 		return
 	}
+	if state != nil {
+		c.JSON(http.StatusOK, fromScan(state))
+		return
+	}
 
-	result, err := s.runOrphanDetection(c.Request.Context(), namespace, ageThreshold)
+	ctx, cancel := s.backendContext(c)
+	defer cancel()
+	result, err := detector.DetectOrphanedResources(ctx, namespace)
 	if err != nil {
 		s.logger.Error("Failed to detect orphaned resources", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "orphan detection failed",
-		})
+		s.writeBackendFailure(c, err, "orphan detection failed", fromScan)
 		return
 	}
+	c.JSON(http.StatusOK, report(result, sourceLive))
+}
 
-	totalOrphans := len(result.OrphanedPVs) + len(result.OrphanedPVCs) + len(result.OrphanedSnapshots)
+// defaultOrphanView reports whether the request leaves the orphan thresholds
+// and exclusions as configured, which is the view the monitor scans.
+func defaultOrphanView(c *gin.Context) bool {
+	if _, ok := c.GetQuery("age_threshold"); ok {
+		return false
+	}
+	for _, param := range orphanThresholdParams {
+		if _, ok := c.GetQuery(param.name); ok {
+			return false
+		}
+	}
+	return c.Query("include_excluded") != "true"
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"timestamp":          result.Timestamp,
-		"namespace":          namespace,
-		"age_threshold":      ageThresholdRaw,
-		"snapshot_retention": formatDurationForAPI(s.defaultSnapshotRetention),
-		"orphaned_pvs":       result.OrphanedPVs,
-		"orphaned_pvcs":      result.OrphanedPVCs,
-		"orphaned_snapshots": result.OrphanedSnapshots,
-		"total_pvs":          result.TotalPVs,
-		"total_pvcs":         result.TotalPVCs,
-		"total_snapshots":    result.TotalSnapshots,
-		"scan_duration":      result.ScanDuration.String(),
-		"total_orphans":      totalOrphans,
-	})
+// orphanGrouping parses the group_by and group_window parameters of
+// GET /api/v1/orphans. group_by=auto adds orphan groups to the response;
+// group_window overrides the configured creation window.
+func (s *Server) orphanGrouping(c *gin.Context) (time.Duration, bool, bool) {
+	window := s.orphanGroupWindow
+	if window <= 0 {
+		window = orphan.DefaultGroupWindow
+	}
+	if raw, ok := c.GetQuery("group_window"); ok {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "group_window must be a duration greater than 0", nil)
+			return 0, false, false
+		}
+		window = parsed
+	}
+	switch groupBy := c.Query("group_by"); groupBy {
+	case "":
+		return window, false, true
+	case "auto":
+		return window, true, true
+	default:
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "group_by must be auto", gin.H{"group_by": groupBy})
+		return 0, false, false
+	}
 }
 
 // listOrphanedPVsHandler handles requests for orphaned PVs
 func (s *Server) listOrphanedPVsHandler(c *gin.Context) {
-	ageThreshold, ageThresholdRaw, ok := s.parseAgeThreshold(c)
+	schemaVersion, ok := negotiateSchema(c, schemas.OrphanedPVs)
+	if !ok {
+		return
+	}
+	detector, ageThresholdRaw, ok := s.requestOrphanDetector(c)
 	if !ok {
 		return
 	}
+	source, ok := dataSource(c)
+	if !ok {
+		return
+	}
+	page, ok := s.listPaging(c)
+	if !ok {
+		return
+	}
+
+	report := func(result *orphan.DetectionResult, source string) gin.H {
+		pvs, truncated := pageItems(result.OrphanedPVs, page)
+		response := gin.H{
+			"schema_version":     schemaVersion,
+			"timestamp":          result.Timestamp,
+			"freshness":          s.freshness(source, result.Timestamp),
+			"age_threshold":      ageThresholdRaw,
+			"pv_age_threshold":   formatDurationForAPI(detector.TypeThresholds().PersistentVolume),
+			"total_pvs":          result.TotalPVs,
+			"orphaned_pvs":       pvs,
+			"total_orphans":      len(result.OrphanedPVs),
+			"limit":              page.limit,
+			"truncated":          truncated,
+			"excluded":           result.Excluded,
+			"excluded_resources": excludedResources(c, result),
+		}
+		if truncated {
+			response["next_cursor"] = page.next()
+		}
+		return response
+	}
+	fromScan := func(state *monitor.ScanState) gin.H {
+		return report(scanDetectionResult(state.Result), sourceScan)
+	}
+
+	state, ok := s.servedScan(c, source, defaultOrphanView(c))
+	if !ok {
+		return
+	}
+	if state != nil {
+		c.JSON(http.StatusOK, fromScan(state))
+		return
+	}
 
-	result, err := s.runOrphanPVDetection(c.Request.Context(), ageThreshold)
+	ctx, cancel := s.backendContext(c)
+	defer cancel()
+	result, err := detector.DetectOrphanedPVs(ctx)
 	if err != nil {
 		s.logger.Error("Failed to detect orphaned PVs", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "orphan detection failed",
-		})
+		s.writeBackendFailure(c, err, "orphan detection failed", fromScan)
+		return
+	}
+	c.JSON(http.StatusOK, report(result, sourceLive))
+}
+
+// listCorrelationUnknownPVsHandler lists the democratic-csi PVs whose volume
+// handle does not parse, such as volumes migrated from in-tree plugins. They
+// are never reported as orphaned.
+func (s *Server) listCorrelationUnknownPVsHandler(c *gin.Context) {
+	detector, _, ok := s.requestOrphanDetector(c)
+	if !ok {
+		return
+	}
+
+	result, err := detector.DetectOrphanedPVs(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to correlate PVs", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "orphan detection failed", nil)
 		return
 	}
 
+	pvs := result.CorrelationUnknown
+	if pvs == nil {
+		pvs = []orphan.OrphanedResource{}
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"timestamp":     result.Timestamp,
-		"age_threshold": ageThresholdRaw,
-		"total_pvs":     result.TotalPVs,
-		"orphaned_pvs":  result.OrphanedPVs,
-		"total_orphans": len(result.OrphanedPVs),
+		"timestamp":          result.Timestamp,
+		"total_pvs":          result.TotalPVs,
+		"count":              len(pvs),
+		"persistent_volumes": pvs,
 	})
 }
 
+// excludedResources returns the orphans hidden by exclusion rules when the
+// include_excluded=true debug flag is set, and nil otherwise.
+func excludedResources(c *gin.Context, result *orphan.DetectionResult) []orphan.OrphanedResource {
+	if c.Query("include_excluded") != "true" {
+		return nil
+	}
+	return result.ExcludedResources
+}
+
 // listPVsHandler handles requests for all PVs
 func (s *Server) listPVsHandler(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -340,9 +858,7 @@ func (s *Server) listPVsHandler(c *gin.Context) {
 	pvs, err := s.k8sClient.ListPersistentVolumes(ctx)
 	if err != nil {
 		s.logger.Error("Failed to list PVs", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to list persistent volumes",
-		})
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "failed to list persistent volumes", nil)
 		return
 	}
 
@@ -353,6 +869,26 @@ func (s *Server) listPVsHandler(c *gin.Context) {
 	})
 }
 
+// listAttachmentsHandler lists VolumeAttachments with their PV, node and
+// attach status, and the PVs attached more than once or to NotReady nodes
+func (s *Server) listAttachmentsHandler(c *gin.Context) {
+	report, err := analysis.CheckVolumeAttachments(c.Request.Context(), s.k8sClient, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to list volume attachments", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "failed to list volume attachments", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":      time.Now().UTC(),
+		"count":          len(report.Attachments),
+		"items":          report.Attachments,
+		"findings":       report.Findings,
+		"multi_attached": report.MultiAttached,
+		"stale":          report.Stale,
+	})
+}
+
 // listTrueNASVolumesHandler handles requests for TrueNAS volumes
 func (s *Server) listTrueNASVolumesHandler(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -360,12 +896,19 @@ func (s *Server) listTrueNASVolumesHandler(c *gin.Context) {
 	volumes, err := s.truenasClient.ListVolumes(ctx)
 	if err != nil {
 		s.logger.Error("Failed to list TrueNAS volumes", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to list truenas volumes",
-		})
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "failed to list truenas volumes", nil)
 		return
 	}
 
+	// SMB shares are listed alongside datasets with type "smb"
+	shares, err := s.truenasClient.GetSMBShares(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to list TrueNAS SMB shares", logging.RedactedError(err))
+	}
+	for _, share := range shares {
+		volumes = append(volumes, share.AsVolume())
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"timestamp": time.Now().UTC(),
 		"count":     len(volumes),
@@ -375,6 +918,10 @@ func (s *Server) listTrueNASVolumesHandler(c *gin.Context) {
 
 // validateHandler handles validation requests
 func (s *Server) validateHandler(c *gin.Context) {
+	schemaVersion, ok := negotiateSchema(c, schemas.ValidationReport)
+	if !ok {
+		return
+	}
 	ctx := c.Request.Context()
 
 	results := make(map[string]interface{})
@@ -386,9 +933,13 @@ func (s *Server) validateHandler(c *gin.Context) {
 			"error":  err.Error(),
 		}
 	} else {
-		results["kubernetes"] = gin.H{
+		kubernetes := gin.H{
 			"status": "passed",
 		}
+		if user, err := s.k8sClient.GetEffectiveUser(ctx); err == nil {
+			kubernetes["user"] = user
+		}
+		results["kubernetes"] = kubernetes
 	}
 
 	// Test TrueNAS connection
@@ -403,10 +954,48 @@ func (s *Server) validateHandler(c *gin.Context) {
 		}
 	}
 
+	// Check that the configured pool and parent dataset exist
+	if s.scope.Enabled() {
+		results["truenas_scope"] = s.scopeCheck(ctx)
+	}
+
+	// Check democratic-csi version skew (warning only)
+	results["csi_driver_versions"] = s.csiDriverVersionCheck(ctx)
+
+	// Check for volume handles shared by several PVs (critical)
+	results["duplicate_volume_handles"] = s.duplicateVolumeHandleCheck(ctx)
+
+	// Check democratic-csi parent datasets for overlap and correlation mismatches
+	results["dataset_layout"] = s.datasetLayoutCheck(ctx)
+
+	// Check dataset and snapshot names below the parents for CSI-unsafe characters (warning only)
+	results["dataset_names"] = s.datasetNamesCheck(ctx)
+
+	// Check parent datasets and pools for locks, read-only and pool health (critical)
+	results["zfs_readiness"] = s.zfsReadinessCheck(ctx)
+
+	// Check VolumeSnapshotContent deletion policies (warning only)
+	results["snapshot_deletion_policy"] = s.snapshotDeletionPolicyCheck(ctx)
+
+	// Check snapshot schedule compliance when policies are configured (warning only)
+	if len(s.snapshotSchedules) > 0 {
+		results["snapshot_schedule"] = s.snapshotScheduleCheck(ctx)
+	}
+
+	// Check that selected PVCs have a recent VolumeSnapshot (warning only)
+	if len(s.backupCoverage.Policies) > 0 {
+		results["backup_coverage"] = s.backupCoverageCheck(ctx)
+	}
+
+	// Report the latest alert destination test
+	if s.alertDispatcher != nil {
+		results["alert_destinations"] = s.alertDestinationsCheck()
+	}
+
 	// Determine overall status
 	allPassed := true
 	for _, result := range results {
-		if result.(gin.H)["status"] != "passed" {
+		if result.(gin.H)["status"] == "failed" {
 			allPassed = false
 			break
 		}
@@ -418,12 +1007,328 @@ func (s *Server) validateHandler(c *gin.Context) {
 	}
 
 	c.JSON(status, gin.H{
+		"schema_version": schemaVersion,
 		"timestamp":      time.Now().UTC(),
 		"overall_status": allPassed,
 		"checks":         results,
 	})
 }
 
+// scopeCheck reports a missing configured pool or parent dataset, with the
+// available pools; it fails with truenas.missing_pool: fail and warns
+// otherwise
+func (s *Server) scopeCheck(ctx context.Context) gin.H {
+	report, err := analysis.CheckScope(ctx, s.truenasClient, s.scope)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	status := "passed"
+	if len(report.Problems) > 0 {
+		status = "warning"
+		if s.scope.Strict {
+			status = "failed"
+		}
+	}
+	return gin.H{
+		"status":          status,
+		"category":        analysis.ScopeAlertCategory,
+		"pool":            report.Pool,
+		"parent_dataset":  report.ParentDataset,
+		"available_pools": report.AvailablePools,
+		"problems":        report.Problems,
+	}
+}
+
+// csiDriverVersionCheck reports democratic-csi version skew as a warning-level check
+func (s *Server) csiDriverVersionCheck(ctx context.Context) gin.H {
+	health, err := s.k8sClient.CheckCSIDriverHealth(ctx, "")
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	if health != nil && health.VersionSkew {
+		return gin.H{
+			"status":              "warning",
+			"warnings":            health.Warnings,
+			"controller_versions": health.ControllerVersions,
+			"node_versions":       health.NodeVersions,
+		}
+	}
+	return gin.H{
+		"status": "passed",
+	}
+}
+
+// duplicateVolumeHandleCheck fails when democratic-csi PVs share a volume handle
+func (s *Server) duplicateVolumeHandleCheck(ctx context.Context) gin.H {
+	pvs, err := s.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	duplicates := orphan.FindDuplicateVolumeHandles(pvs)
+	if len(duplicates) > 0 {
+		return gin.H{
+			"status":     "failed",
+			"severity":   orphan.SeverityCritical,
+			"duplicates": duplicates,
+		}
+	}
+	return gin.H{
+		"status": "passed",
+	}
+}
+
+// zfsReadinessCheck fails when democratic-csi parent datasets are locked or
+// read-only, or their pools are unhealthy or miss required features
+func (s *Server) zfsReadinessCheck(ctx context.Context) gin.H {
+	report, err := analysis.CheckZFSReadiness(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	status := "passed"
+	if len(report.Problems) > 0 {
+		status = "failed"
+	}
+	return gin.H{
+		"status":   status,
+		"category": analysis.ZFSReadinessAlertCategory,
+		"datasets": report.Datasets,
+		"pools":    report.Pools,
+		"problems": report.Problems,
+	}
+}
+
+// datasetLayoutCheck fails when StorageClass parent datasets are missing,
+// shared or nested, and warns when PVs correlate outside their parent
+func (s *Server) datasetLayoutCheck(ctx context.Context) gin.H {
+	classes, err := s.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	in, err := analysis.Gather(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	report := analysis.CheckDatasetLayout(classes, in.PersistentVolumes, in.Volumes)
+	status := "passed"
+	switch {
+	case report.HasErrors():
+		status = "failed"
+	case len(report.Issues) > 0:
+		status = "warning"
+	}
+	return gin.H{
+		"status":  status,
+		"parents": report.Parents,
+		"issues":  report.Issues,
+	}
+}
+
+// datasetNamesCheck warns about datasets and snapshots below democratic-csi
+// parent datasets whose names are not CSI-safe
+func (s *Server) datasetNamesCheck(ctx context.Context) gin.H {
+	classes, err := s.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	volumes, err := s.truenasClient.ListVolumes(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	snapshots, err := s.truenasClient.ListSnapshots(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	issues := analysis.CheckDatasetNames(classes, volumes, snapshots)
+	status := "passed"
+	if len(issues) > 0 {
+		status = "warning"
+	}
+	return gin.H{
+		"status": status,
+		"issues": issues,
+	}
+}
+
+// snapshotDeletionPolicyCheck warns about VolumeSnapshotContents that override
+// their class deletion policy or retain ZFS snapshots that are gone
+func (s *Server) snapshotDeletionPolicyCheck(ctx context.Context) gin.H {
+	contents, err := s.k8sClient.ListVolumeSnapshotContents(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	classes, err := s.k8sClient.ListVolumeSnapshotClasses(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	snapshots, err := s.truenasClient.ListSnapshots(ctx)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	report := analysis.CheckSnapshotPolicies(contents, classes, snapshots)
+	status := "passed"
+	if report.HasIssues() {
+		status = "warning"
+	}
+	return gin.H{
+		"status":           status,
+		"counts":           report.Counts,
+		"overridden":       report.Overridden,
+		"missing_retained": report.MissingRetained,
+	}
+}
+
+// snapshotScheduleCheck reports datasets that miss their snapshot schedule as a warning-level check
+func (s *Server) snapshotScheduleCheck(ctx context.Context) gin.H {
+	in, err := analysis.Gather(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	report := analysis.CheckSnapshotSchedules(s.snapshotSchedules, in, time.Now().UTC())
+	if !report.Compliant {
+		return gin.H{
+			"status":     "warning",
+			"category":   analysis.ScheduleAlertCategory,
+			"violations": report.Violations(),
+			"classes":    report.Classes,
+		}
+	}
+	return gin.H{
+		"status":  "passed",
+		"classes": report.Classes,
+	}
+}
+
+// backupCoverageCheck reports the per-namespace VolumeSnapshot coverage of
+// the claims the backup coverage policies select, the uncovered claims and
+// the datasets snapshotted only on TrueNAS.
+func (s *Server) backupCoverageCheck(ctx context.Context) gin.H {
+	in, err := analysis.GatherBackupCoverage(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		return gin.H{
+			"status": "warning",
+			"error":  err.Error(),
+		}
+	}
+	report := analysis.CheckBackupCoverage(in, time.Now().UTC(), s.backupCoverage)
+	result := gin.H{
+		"status":     "passed",
+		"namespaces": report.Namespaces,
+		"uncovered":  report.Uncovered,
+		"csi_bypass": report.CSIBypass,
+	}
+	if len(report.Uncovered) > 0 || len(report.CSIBypass) > 0 {
+		result["status"] = "warning"
+		result["category"] = analysis.BackupCoverageAlertCategory
+	}
+	if below := report.BelowFloor(); len(below) > 0 {
+		result["below_floor"] = below
+	}
+	return result
+}
+
+// csiHealthHandler reports CSI driver pod health and image versions, plus
+// iSCSI session health when the iSCSI session check is enabled
+func (s *Server) csiHealthHandler(c *gin.Context) {
+	source, ok := dataSource(c)
+	if !ok {
+		return
+	}
+	fromScan := func(state *monitor.ScanState) gin.H {
+		if state.Result.CSIHealth == nil {
+			return nil
+		}
+		response := gin.H{
+			"timestamp": state.Result.Timestamp,
+			"freshness": s.freshness(sourceScan, state.Result.Timestamp),
+			"health":    state.Result.CSIHealth,
+		}
+		if state.Result.ISCSISessions != nil {
+			response["iscsi_sessions"] = state.Result.ISCSISessions
+		}
+		return response
+	}
+
+	state, ok := s.servedScan(c, source, c.Query("namespace") == "")
+	if !ok {
+		return
+	}
+	if state != nil {
+		if response := fromScan(state); response != nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		if source == sourceScan {
+			writeError(c, http.StatusNotFound, ErrorCodeNotFound, "the last monitor scan has no CSI driver health", nil)
+			return
+		}
+	}
+
+	ctx, cancel := s.backendContext(c)
+	defer cancel()
+	health, err := s.k8sClient.CheckCSIDriverHealth(ctx, c.Query("namespace"))
+	if err != nil {
+		s.logger.Error("Failed to check CSI driver health", zap.Error(err))
+		s.writeBackendFailure(c, err, "failed to check CSI driver health", fromScan)
+		return
+	}
+
+	now := time.Now().UTC()
+	response := gin.H{
+		"timestamp": now,
+		"freshness": s.freshness(sourceLive, now),
+		"health":    health,
+	}
+	if s.iscsiSessions.Enabled {
+		report, err := analysis.CheckISCSISessions(ctx, s.k8sClient, s.truenasClient, s.iscsiSessions)
+		if err != nil {
+			s.logger.Warn("Failed to check iSCSI sessions", zap.Error(err))
+			response["iscsi_sessions_error"] = err.Error()
+		} else {
+			response["iscsi_sessions"] = report
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 func (s *Server) listOrphanedPVCsHandler(c *gin.Context) {
 	notImplemented(c, "/api/v1/orphans/pvcs")
 }
@@ -432,8 +1337,46 @@ func (s *Server) listOrphanedSnapshotsHandler(c *gin.Context) {
 	notImplemented(c, "/api/v1/orphans/snapshots")
 }
 
+// storageAnalysisHandler reports pool utilization and storage efficiency
 func (s *Server) storageAnalysisHandler(c *gin.Context) {
-	notImplemented(c, "/api/v1/analysis")
+	schemaVersion, ok := negotiateSchema(c, schemas.StorageAnalysis)
+	if !ok {
+		return
+	}
+	result, err := s.analyzer.Analyze(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to analyze storage", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "storage analysis failed", nil)
+		return
+	}
+
+	// The analyzer caches its result; version a copy.
+	response := *result
+	response.SchemaVersion = schemaVersion
+	c.JSON(http.StatusOK, response)
+}
+
+// volumeAnalysisHandler reports the analysis figures of a single PV
+func (s *Server) volumeAnalysisHandler(c *gin.Context) {
+	result, err := s.analyzer.Analyze(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to analyze storage", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeBackendUnavailable, "storage analysis failed", nil)
+		return
+	}
+
+	name := c.Param("pv")
+	for _, volume := range result.Volumes {
+		if volume.PersistentVolume == name {
+			c.JSON(http.StatusOK, gin.H{
+				"timestamp": result.Timestamp,
+				"volume":    volume,
+			})
+			return
+		}
+	}
+	writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no TrueNAS dataset found for persistent volume",
+		map[string]interface{}{"persistent_volume": name})
 }
 
 func (s *Server) storageUsageHandler(c *gin.Context) {
@@ -472,16 +1415,46 @@ func (s *Server) validateConfigHandler(c *gin.Context) {
 	notImplemented(c, "/api/v1/validate/config")
 }
 
-func (s *Server) validateConnectivityHandler(c *gin.Context) {
-	notImplemented(c, "/api/v1/validate/connectivity")
-}
-
+// summaryReportHandler summarizes the monitor's most recent scan: totals,
+// orphan counts, pool usage, storage efficiency and PVC provisioning latency
 func (s *Server) summaryReportHandler(c *gin.Context) {
-	notImplemented(c, "/api/v1/reports/summary")
-}
+	schemaVersion, ok := negotiateSchema(c, schemas.SummaryReport)
+	if !ok {
+		return
+	}
+	state, ok := s.readScanState(c)
+	if !ok {
+		return
+	}
+	report := buildSummaryReport(schemaVersion, state)
 
-func (s *Server) detailedReportHandler(c *gin.Context) {
-	notImplemented(c, "/api/v1/reports/detailed")
+	c.JSON(http.StatusOK, gin.H{
+		"schema_version":             report.SchemaVersion,
+		"timestamp":                  report.Timestamp,
+		"scan_timestamp":             report.ScanTimestamp,
+		"partial":                    report.Partial,
+		"stale":                      report.Stale,
+		"unreadable_namespaces":      report.UnreadableNamespaces,
+		"namespace_coverage_percent": report.NamespaceCoveragePercent,
+		"totals": gin.H{
+			"pvs":               report.Totals.PVs,
+			"pvcs":              report.Totals.PVCs,
+			"k8s_snapshots":     report.Totals.K8sSnapshots,
+			"truenas_snapshots": report.Totals.TrueNASSnapshots,
+		},
+		"orphans": gin.H{
+			"pvs":               report.Orphans.PVs,
+			"pvcs":              report.Orphans.PVCs,
+			"snapshots":         report.Orphans.Snapshots,
+			"k8s_snapshots":     report.Orphans.K8sSnapshots,
+			"truenas_snapshots": report.Orphans.TrueNASSnapshots,
+		},
+		"pools":                report.Pools,
+		"storage_efficiency":   report.StorageEfficiency,
+		"provisioning_latency": report.ProvisioningLatency,
+		"abandoned_datasets":   report.AbandonedDatasets,
+		"by_storage_class":     report.ByStorageClass,
+	})
 }
 
 // corsMiddleware adds CORS headers
@@ -500,20 +1473,6 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-// loggingMiddleware logs HTTP requests
-func loggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		logger.Info("HTTP request",
-			zap.String("method", param.Method),
-			zap.String("path", param.Path),
-			zap.Int("status", param.StatusCode),
-			zap.Duration("latency", param.Latency),
-			zap.String("client_ip", param.ClientIP),
-		)
-		return ""
-	})
-}
-
 // requestIDMiddleware adds a unique request ID to each request
 func requestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -527,3 +1486,217 @@ func requestIDMiddleware() gin.HandlerFunc {
 	}
 }
 
+
+// alertRoutesHandler dry-runs alert routing for a hypothetical alert described
+// by the level, category, namespace and pool query parameters.
+func (s *Server) alertRoutesHandler(c *gin.Context) {
+	if s.alertRouter == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "alert routing is not configured", nil)
+		return
+	}
+
+	alert := alerts.Alert{
+		Level:     c.DefaultQuery("level", alerts.LevelWarning),
+		Category:  c.Query("category"),
+		Namespace: c.Query("namespace"),
+		Pool:      c.Query("pool"),
+	}
+	if !alerts.ValidLevel(alert.Level) {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "level must be one of: info, warning, critical", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"alert":     alert,
+		"decision":  s.alertRouter.Route(alert),
+		"routes":    s.alertRouter.Routes(),
+	})
+}
+
+// scanStateFlapping returns the report source of the flapping PVs of the
+// monitor's latest scan, read from its scan state file; nil without one.
+func scanStateFlapping(path string) func() []analysis.FlappingVolume {
+	if path == "" {
+		return nil
+	}
+	return func() []analysis.FlappingVolume {
+		state, err := monitor.ReadScanState(path)
+		if err != nil {
+			return nil
+		}
+		return state.Result.FlappingVolumes
+	}
+}
+
+// readScanState reads the monitor's scan state file, writing a 404 when it
+// is not configured or empty and a 500 when it cannot be read.
+func (s *Server) readScanState(c *gin.Context) (*monitor.ScanState, bool) {
+	if s.scanStateFile == "" {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "scan state file is not configured", nil)
+		return nil, false
+	}
+
+	state, err := monitor.ReadScanState(s.scanStateFile)
+	if errors.Is(err, monitor.ErrNoScanState) {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no scan recorded yet", nil)
+		return nil, false
+	}
+	if err != nil {
+		s.logger.Error("Failed to read scan state", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to read scan state", nil)
+		return nil, false
+	}
+	return state, true
+}
+
+// scanDiffHandler returns the diff between the monitor's two most recent
+// scans, read from the shared scan state file.
+func (s *Server) scanDiffHandler(c *gin.Context) {
+	schemaVersion, ok := negotiateSchema(c, schemas.ScanDiff)
+	if !ok {
+		return
+	}
+	state, ok := s.readScanState(c)
+	if !ok {
+		return
+	}
+	diff := buildScanDiff(schemaVersion, state)
+
+	c.JSON(http.StatusOK, gin.H{
+		"schema_version": diff.SchemaVersion,
+		"timestamp":      diff.Timestamp,
+		"scan_timestamp": diff.ScanTimestamp,
+		"changes":        diff.Changes,
+		"diff":           diff.Diff,
+		"warnings":       diff.Warnings,
+	})
+}
+
+// simulateHandler projects the pool usage after the cleanup actions named
+// by the actions query parameter, from the monitor's most recent scan
+// alone. Nothing is deleted.
+func (s *Server) simulateHandler(c *gin.Context) {
+	actions, err := monitor.ParseSimulationActions(c.Query("actions"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, err.Error(), nil)
+		return
+	}
+	state, ok := s.readScanState(c)
+	if !ok {
+		return
+	}
+	sim := monitor.Simulate(state, actions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":       time.Now().UTC(),
+		"simulation":      true,
+		"scan_timestamp":  sim.ScanTimestamp,
+		"partial":         state.Result.Partial,
+		"stale":           state.Result.Stale,
+		"actions":         sim.Actions,
+		"snapshots":       sim.Snapshots,
+		"reclaimed_bytes": sim.ReclaimedBytes,
+		"pools":           sim.Pools,
+		"namespaces":      sim.Namespaces,
+		"notes":           sim.Notes,
+	})
+}
+
+// scanStatusHandler reports the monitor's most recent scan with its
+// per-phase durations and item counts.
+func (s *Server) scanStatusHandler(c *gin.Context) {
+	schemaVersion, ok := negotiateSchema(c, schemas.ScanStatus)
+	if !ok {
+		return
+	}
+	state, ok := s.readScanState(c)
+	if !ok {
+		return
+	}
+	status := buildScanStatus(schemaVersion, state)
+
+	c.JSON(http.StatusOK, gin.H{
+		"schema_version":         status.SchemaVersion,
+		"timestamp":              status.Timestamp,
+		"scan_timestamp":         status.ScanTimestamp,
+		"scan_duration":          status.ScanDuration,
+		"partial":                status.Partial,
+		"stale":                  status.Stale,
+		"phase_errors":           status.PhaseErrors,
+		"phases":                 status.Phases,
+		"inventory":              status.Inventory,
+		"degraded":               status.Degraded,
+		"scope":                  status.Scope,
+		"snapshot_correlated_at": status.SnapshotCorrelatedAt,
+		"stuck_resources":        status.StuckResources,
+		"phase_transitions":      status.PhaseTransitions,
+		"flapping_volumes":       status.FlappingVolumes,
+	})
+}
+
+// listAlertsHandler lists active alerts, optionally filtered by the state,
+// level, category and source query parameters.
+func (s *Server) listAlertsHandler(c *gin.Context) {
+	if s.alertStore == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "alert store is not configured", nil)
+		return
+	}
+
+	list, err := s.alertStore.List()
+	if err != nil {
+		s.logger.Error("Failed to list active alerts", zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to list alerts", nil)
+		return
+	}
+
+	state, level, category, source := c.Query("state"), c.Query("level"), c.Query("category"), c.Query("source")
+	items := make([]alerts.ActiveAlert, 0, len(list))
+	for _, active := range list {
+		if (state != "" && active.State != state) ||
+			(level != "" && active.Level != level) ||
+			(category != "" && active.Category != category) ||
+			(source != "" && active.Source != source) {
+			continue
+		}
+		items = append(items, active)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().UTC(),
+		"count":     len(items),
+		"items":     items,
+	})
+}
+
+// acknowledgeAlertHandler acknowledges an active alert so it is no longer
+// re-notified. The optional JSON body {"by": "..."} records who acknowledged it.
+func (s *Server) acknowledgeAlertHandler(c *gin.Context) {
+	if s.alertStore == nil {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "alert store is not configured", nil)
+		return
+	}
+
+	var body struct {
+		By string `json:"by"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "invalid request body", nil)
+			return
+		}
+	}
+
+	active, err := s.alertStore.Acknowledge(c.Param("id"), body.By)
+	if errors.Is(err, alerts.ErrAlertNotFound) {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "alert not found", nil)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to acknowledge alert", zap.String("id", c.Param("id")), zap.Error(err))
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "failed to acknowledge alert", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, active)
+}
@@ -6,18 +6,38 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	"github.com/stretchr/testify/require"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/artifacts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/cleanup"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/readonly"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/version"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type stubK8sClient struct {
@@ -28,12 +48,26 @@ type stubK8sClient struct {
 	volumeSnapshots    []snapshotv1.VolumeSnapshot
 	listPersistentPVs  []corev1.PersistentVolume
 	testConnectionErr  error
+	effectiveUser      *k8s.UserInfo
+	csiHealth          *k8s.CSIDriverHealth
+	csiHealthErr       error
+	storageClasses     []storagev1.StorageClass
+	pods               []corev1.Pod
+	pvcEvents          []corev1.Event
+	snapshotContents   []snapshotv1.VolumeSnapshotContent
+	snapshotClasses    []snapshotv1.VolumeSnapshotClass
+	volumeAttachments  []storagev1.VolumeAttachment
+	nodes              []corev1.Node
 }
 
 func (s *stubK8sClient) ListPersistentVolumes(context.Context) ([]corev1.PersistentVolume, error) {
 	return s.listPersistentPVs, nil
 }
 
+func (s *stubK8sClient) ListPersistentVolumesWithResourceVersion(context.Context) ([]corev1.PersistentVolume, string, error) {
+	return s.listPersistentPVs, "", nil
+}
+
 func (s *stubK8sClient) ListPersistentVolumeClaims(context.Context, string) ([]corev1.PersistentVolumeClaim, error) {
 	if s.allPVCs == nil {
 		return []corev1.PersistentVolumeClaim{}, nil
@@ -49,11 +83,43 @@ func (s *stubK8sClient) ListVolumeSnapshots(context.Context, string) ([]snapshot
 }
 
 func (s *stubK8sClient) ListStorageClasses(context.Context) ([]storagev1.StorageClass, error) {
-	return nil, nil
+	return s.storageClasses, nil
 }
 
-func (s *stubK8sClient) ListPods(context.Context, string) ([]corev1.Pod, error) {
-	return nil, nil
+func (s *stubK8sClient) ListPods(_ context.Context, namespace string) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	for _, pod := range s.pods {
+		if namespace == "" || pod.Namespace == namespace {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func (s *stubK8sClient) ListVolumeSnapshotContents(context.Context) ([]snapshotv1.VolumeSnapshotContent, error) {
+	return s.snapshotContents, nil
+}
+
+func (s *stubK8sClient) DeleteVolumeSnapshotContent(context.Context, string) error {
+	return nil
+}
+
+func (s *stubK8sClient) ListVolumeSnapshotClasses(context.Context) ([]snapshotv1.VolumeSnapshotClass, error) {
+	return s.snapshotClasses, nil
+}
+
+func (s *stubK8sClient) ListPersistentVolumeClaimEvents(_ context.Context, namespace string) ([]corev1.Event, error) {
+	var events []corev1.Event
+	for _, event := range s.pvcEvents {
+		if namespace == "" || event.Namespace == namespace {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *stubK8sClient) CreateEvent(context.Context, *corev1.Event) error {
+	return nil
 }
 
 func (s *stubK8sClient) ListNamespaces(context.Context) ([]corev1.Namespace, error) {
@@ -93,6 +159,13 @@ func (s *stubK8sClient) TestConnection(context.Context) error {
 	return s.testConnectionErr
 }
 
+func (s *stubK8sClient) GetEffectiveUser(context.Context) (*k8s.UserInfo, error) {
+	if s.effectiveUser == nil {
+		return nil, errors.New("selfsubjectreviews not supported")
+	}
+	return s.effectiveUser, nil
+}
+
 func (s *stubK8sClient) ValidateRBACPermissions(context.Context) (*k8s.RBACValidationResult, error) {
 	return nil, nil
 }
@@ -110,18 +183,36 @@ func (s *stubK8sClient) ListCSIDrivers(context.Context) ([]storagev1.CSIDriver,
 }
 
 func (s *stubK8sClient) ListVolumeAttachments(context.Context) ([]storagev1.VolumeAttachment, error) {
-	return nil, nil
+	return s.volumeAttachments, nil
+}
+
+func (s *stubK8sClient) ListNodes(context.Context) ([]corev1.Node, error) {
+	return s.nodes, nil
 }
 
 func (s *stubK8sClient) GetCSIDriverPods(context.Context, string) ([]corev1.Pod, error) {
 	return nil, nil
 }
 
+func (s *stubK8sClient) CheckCSIDriverHealth(context.Context, string) (*k8s.CSIDriverHealth, error) {
+	if s.csiHealthErr != nil {
+		return nil, s.csiHealthErr
+	}
+	if s.csiHealth == nil {
+		return &k8s.CSIDriverHealth{}, nil
+	}
+	return s.csiHealth, nil
+}
+
 type stubTruenasClient struct {
 	volumes           []truenas.Volume
 	snapshots         []truenas.Snapshot
 	testConnectionErr error
 	listVolumesErr    error
+	pools             []truenas.Pool
+	smbShares         []truenas.SMBShare
+	iscsiSessions     []truenas.ISCSISession
+	initiatorGroups   []truenas.ISCSIInitiatorGroup
 }
 
 func (s *stubTruenasClient) ListVolumes(context.Context) ([]truenas.Volume, error) {
@@ -141,10 +232,75 @@ func (s *stubTruenasClient) ListSnapshots(context.Context) ([]truenas.Snapshot,
 	return s.snapshots, nil
 }
 
+func (s *stubTruenasClient) ListSnapshotsSince(ctx context.Context, _ time.Time) ([]truenas.Snapshot, error) {
+	return s.ListSnapshots(ctx)
+}
+
 func (s *stubTruenasClient) ListPools(context.Context) ([]truenas.Pool, error) {
+	return s.pools, nil
+}
+
+func (s *stubTruenasClient) GetSMBShares(context.Context) ([]truenas.SMBShare, error) {
+	return s.smbShares, nil
+}
+
+func (s *stubTruenasClient) GetNFSShares(context.Context) ([]truenas.NFSShare, error) {
 	return nil, nil
 }
 
+func (s *stubTruenasClient) GetDataset(_ context.Context, name string) (*truenas.Volume, error) {
+	for _, volume := range s.volumes {
+		if volume.Name == name {
+			return &volume, nil
+		}
+	}
+	return nil, truenas.ErrDatasetNotFound
+}
+
+func (s *stubTruenasClient) ListAlerts(context.Context) ([]truenas.Alert, error) {
+	return nil, nil
+}
+
+func (s *stubTruenasClient) ListSnapshotTasks(context.Context) ([]truenas.PeriodicSnapshotTask, error) {
+	return nil, nil
+}
+
+func (s *stubTruenasClient) ListReplicationTasks(context.Context) ([]truenas.ReplicationTask, error) {
+	return nil, nil
+}
+
+func (s *stubTruenasClient) GetDatasetIOStats(context.Context, []string, time.Duration) ([]truenas.DatasetIOStats, error) {
+	return nil, nil
+}
+
+func (s *stubTruenasClient) SetDatasetRefquota(context.Context, string, int64) error {
+	return nil
+}
+
+func (s *stubTruenasClient) DeleteSnapshot(context.Context, string, truenas.DeleteSnapshotOptions) error {
+	return nil
+}
+
+func (s *stubTruenasClient) CreateSnapshot(_ context.Context, dataset, name string) (*truenas.Snapshot, error) {
+	return &truenas.Snapshot{ID: dataset + "@" + name, Name: dataset + "@" + name, Dataset: dataset}, nil
+}
+
+func (s *stubTruenasClient) CloneSnapshot(context.Context, string, string) error {
+	return nil
+}
+
+func (s *stubTruenasClient) DeleteDataset(context.Context, string) error {
+	return nil
+}
+
+func (s *stubTruenasClient) ListISCSISessions(context.Context) ([]truenas.ISCSISession, error) {
+	return s.iscsiSessions, nil
+}
+
+func (s *stubTruenasClient) ListISCSIInitiatorGroups(context.Context) ([]truenas.ISCSIInitiatorGroup, error) {
+	return s.initiatorGroups, nil
+}
+
 func (s *stubTruenasClient) GetSystemInfo(context.Context) (*truenas.SystemInfo, error) {
 	return nil, nil
 }
@@ -214,15 +370,130 @@ func TestListOrphansHandler_ReturnsDetectorResults(t *testing.T) {
 	require.EqualValues(t, 1, body["total_orphans"])
 }
 
+func TestListOrphansHandler_GroupByAuto(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("orphan-a"), orphanedDemocraticPV("orphan-b")},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{volumes: []truenas.Volume{}})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), `"groups"`)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?group_by=auto&group_window=1h")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		GroupWindow string         `json:"group_window"`
+		Groups      []orphan.Group `json:"groups"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "1h", body.GroupWindow)
+	require.Len(t, body.Groups, 1)
+	require.Equal(t, 2, body.Groups[0].Count)
+	require.Equal(t, "democratic-csi-nfs", body.Groups[0].StorageClass)
+	require.Contains(t, body.Groups[0].Hint, "2 PersistentVolumes created within")
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?group_by=namespace")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?group_by=auto&group_window=0")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestListOrphansHandler_CapsListsWithCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("orphan-a"), orphanedDemocraticPV("orphan-b"), orphanedDemocraticPV("orphan-c")},
+	}
+	server, err := NewServer(Config{
+		K8sClient:     k8sStub,
+		TruenasClient: &stubTruenasClient{volumes: []truenas.Volume{}},
+		Logger:        zap.NewNop(),
+		Limits:        RequestLimits{MaxListItems: 2},
+	})
+	require.NoError(t, err)
+
+	type page struct {
+		OrphanedPVs  []orphan.OrphanedResource `json:"orphaned_pvs"`
+		OrphanCounts map[string]int            `json:"orphan_counts"`
+		TotalOrphans int                       `json:"total_orphans"`
+		Truncated    bool                      `json:"truncated"`
+		NextCursor   string                    `json:"next_cursor"`
+	}
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var first page
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &first))
+	require.Len(t, first.OrphanedPVs, 2)
+	require.Equal(t, 3, first.OrphanCounts["pvs"])
+	require.Equal(t, 3, first.TotalOrphans)
+	require.True(t, first.Truncated)
+	require.NotEmpty(t, first.NextCursor)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?cursor="+first.NextCursor)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var second page
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &second))
+	require.Len(t, second.OrphanedPVs, 1)
+	require.False(t, second.Truncated)
+	require.Empty(t, second.NextCursor)
+	require.Equal(t, "orphan-c", second.OrphanedPVs[0].Name)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans/pvs?limit=1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var pvs page
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pvs))
+	require.Len(t, pvs.OrphanedPVs, 1)
+	require.True(t, pvs.Truncated)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?limit=3")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?cursor=bm90LWEtY3Vyc29y")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestListCorrelationUnknownPVsHandler(t *testing.T) {
+	migrated := orphanedDemocraticPV("migrated-pv")
+	migrated.Annotations = map[string]string{orphan.MigratedToAnnotation: "org.democratic-csi.iscsi"}
+	migrated.Spec.CSI.VolumeHandle = "iqn.2005-10.org.freenas.ctl:"
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{migrated, orphanedDemocraticPV("orphan-pv")},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{volumes: []truenas.Volume{}})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans/correlation-unknown")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		TotalPVs int                       `json:"total_pvs"`
+		Count    int                       `json:"count"`
+		PVs      []orphan.OrphanedResource `json:"persistent_volumes"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 2, body.TotalPVs)
+	require.Equal(t, 1, body.Count)
+	require.Equal(t, "migrated-pv", body.PVs[0].Name)
+	require.Equal(t, orphan.CorrelationUnknown, body.PVs[0].Details["status"])
+	require.Equal(t, "org.democratic-csi.iscsi", body.PVs[0].Details["migrated_to"])
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans/pvs")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var pvs struct {
+		OrphanedPVs []orphan.OrphanedResource `json:"orphaned_pvs"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pvs))
+	require.Len(t, pvs.OrphanedPVs, 1)
+	require.Equal(t, "orphan-pv", pvs.OrphanedPVs[0].Name)
+}
+
 func TestListOrphansHandler_InvalidAgeThreshold_Returns400(t *testing.T) {
 	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
 
 	rec := performRequest(server, http.MethodGet, "/api/v1/orphans?age_threshold=not-a-duration")
 	require.Equal(t, http.StatusBadRequest, rec.Code)
 
-	var body map[string]interface{}
+	var body APIError
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
-	require.Equal(t, "invalid age_threshold format", body["error"])
+	require.Equal(t, ErrorCodeInvalidParameter, body.Code)
+	require.Equal(t, "invalid age_threshold format", body.Message)
 }
 
 func TestListOrphansHandler_NonPositiveAgeThreshold_Returns400(t *testing.T) {
@@ -231,9 +502,10 @@ func TestListOrphansHandler_NonPositiveAgeThreshold_Returns400(t *testing.T) {
 	rec := performRequest(server, http.MethodGet, "/api/v1/orphans?age_threshold=0")
 	require.Equal(t, http.StatusBadRequest, rec.Code)
 
-	var body map[string]interface{}
+	var body APIError
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
-	require.Equal(t, "age_threshold must be greater than 0", body["error"])
+	require.Equal(t, ErrorCodeInvalidParameter, body.Code)
+	require.Equal(t, "age_threshold must be greater than 0", body.Message)
 }
 
 func TestListOrphansHandler_DefaultAgeThresholdFromConfig(t *testing.T) {
@@ -258,6 +530,50 @@ func TestListOrphansHandler_DefaultAgeThresholdFromConfig(t *testing.T) {
 	require.Equal(t, "168h", body["snapshot_retention"])
 }
 
+func TestListOrphansHandler_PerTypeAgeThresholds(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("orphan-pv")},
+	}
+	server, err := NewServer(Config{
+		K8sClient:        k8sStub,
+		TruenasClient:    &stubTruenasClient{},
+		Logger:           zap.NewNop(),
+		OrphanThreshold:  24 * time.Hour,
+		OrphanThresholds: orphan.AgeThresholds{PersistentVolume: 72 * time.Hour},
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.EqualValues(t, 0, body["total_orphans"], "48h-old PV is younger than the 72h PV threshold")
+	require.Equal(t, map[string]interface{}{
+		"persistent_volume":       "72h",
+		"persistent_volume_claim": "24h",
+		"volume_snapshot":         "24h",
+		"truenas_snapshot":        "720h",
+		"truenas_volume":          "24h",
+	}, body["age_thresholds"])
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?age_threshold=12h")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.EqualValues(t, 1, body["total_orphans"], "age_threshold replaces the configured PV threshold")
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans/pvs?age_threshold=12h&pv_age_threshold=96h")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.EqualValues(t, 0, body["total_orphans"])
+	require.Equal(t, "96h", body["pv_age_threshold"])
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans?pvc_age_threshold=-1h")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var apiErr APIError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &apiErr))
+	require.Equal(t, "pvc_age_threshold must be a duration greater than 0", apiErr.Message)
+}
+
 func TestListOrphansHandler_DefaultAgeThresholdEchoes24h(t *testing.T) {
 	k8sStub := &stubK8sClient{
 		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("orphan-pv")},
@@ -293,6 +609,34 @@ func TestListOrphanedPVsHandler_ReturnsPVSubsetOnly(t *testing.T) {
 	require.NotContains(t, body, "orphaned_snapshots")
 }
 
+func TestListOrphanedPVsHandler_IncludeExcluded(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("orphan-pv"), orphanedDemocraticPV("dr-seed")},
+	}
+	server, err := NewServer(Config{
+		K8sClient:     k8sStub,
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		Exclusions:    orphan.Exclusions{Names: []string{"dr-seed"}},
+	})
+	require.NoError(t, err)
+
+	var body map[string]interface{}
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans/pvs")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.EqualValues(t, 1, body["total_orphans"])
+	require.EqualValues(t, 1, body["excluded"])
+	require.Nil(t, body["excluded_resources"])
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/orphans/pvs?include_excluded=true")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	excluded, ok := body["excluded_resources"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, excluded, 1)
+}
+
 func TestListOrphansHandler_DetectorError_Returns500(t *testing.T) {
 	k8sStub := &stubK8sClient{
 		democraticPVsErr: errors.New("kubernetes unavailable"),
@@ -302,9 +646,12 @@ func TestListOrphansHandler_DetectorError_Returns500(t *testing.T) {
 	rec := performRequest(server, http.MethodGet, "/api/v1/orphans")
 	require.Equal(t, http.StatusInternalServerError, rec.Code)
 
-	var body map[string]interface{}
+	var body APIError
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
-	require.Equal(t, "orphan detection failed", body["error"])
+	require.Equal(t, ErrorCodeBackendUnavailable, body.Code)
+	require.Equal(t, "orphan detection failed", body.Message)
+	require.NotEmpty(t, body.RequestID)
+	require.Equal(t, rec.Header().Get("X-Request-ID"), body.RequestID)
 }
 
 func TestNotImplementedRoutes_Return501WithStandardEnvelope(t *testing.T) {
@@ -316,7 +663,6 @@ func TestNotImplementedRoutes_Return501WithStandardEnvelope(t *testing.T) {
 	}{
 		{"/api/v1/orphans/pvcs", "/api/v1/orphans/pvcs"},
 		{"/api/v1/orphans/snapshots", "/api/v1/orphans/snapshots"},
-		{"/api/v1/analysis", "/api/v1/analysis"},
 		{"/api/v1/analysis/usage", "/api/v1/analysis/usage"},
 		{"/api/v1/analysis/trends", "/api/v1/analysis/trends"},
 		{"/api/v1/resources/pvcs", "/api/v1/resources/pvcs"},
@@ -326,9 +672,6 @@ func TestNotImplementedRoutes_Return501WithStandardEnvelope(t *testing.T) {
 		{"/api/v1/truenas/pools", "/api/v1/truenas/pools"},
 		{"/api/v1/truenas/info", "/api/v1/truenas/info"},
 		{"/api/v1/validate/config", "/api/v1/validate/config"},
-		{"/api/v1/validate/connectivity", "/api/v1/validate/connectivity"},
-		{"/api/v1/reports/summary", "/api/v1/reports/summary"},
-		{"/api/v1/reports/detailed", "/api/v1/reports/detailed"},
 	}
 
 	for _, route := range routes {
@@ -336,11 +679,1268 @@ func TestNotImplementedRoutes_Return501WithStandardEnvelope(t *testing.T) {
 			rec := performRequest(server, http.MethodGet, route.path)
 			require.Equal(t, http.StatusNotImplemented, rec.Code)
 
-			var body map[string]interface{}
+			var body APIError
 			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
-			require.Equal(t, "not_implemented", body["error"])
-			require.Equal(t, "endpoint not implemented", body["message"])
-			require.Equal(t, route.endpoint, body["endpoint"])
+			require.Equal(t, ErrorCodeNotImplemented, body.Code)
+			require.Equal(t, "endpoint not implemented", body.Message)
+			require.Equal(t, route.endpoint, body.Details["endpoint"])
 		})
 	}
 }
+
+func TestCSIHealthHandler_ReturnsHealth(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		csiHealth: &k8s.CSIDriverHealth{
+			Namespace:          "democratic-csi",
+			ControllerVersions: []string{"v1.8.3"},
+			NodeVersions:       []string{"v1.8.3"},
+		},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/csi/health")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	health, ok := body["health"].(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, "democratic-csi", health["namespace"])
+	require.Equal(t, false, health["version_skew"])
+}
+
+func TestCSIHealthHandler_ReportsISCSISessions(t *testing.T) {
+	pv := orphanedDemocraticPV("pv-block")
+	pv.Spec.CSI.Driver = "org.democratic-csi.iscsi"
+	pvName := pv.Name
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{pv},
+		volumeAttachments: []storagev1.VolumeAttachment{{
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: "worker-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: true},
+		}},
+	}
+	server, err := NewServer(Config{
+		K8sClient:     k8sStub,
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ISCSISessions: analysis.ISCSISessionOptions{Enabled: true},
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/csi/health")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		ISCSISessions analysis.ISCSISessionReport `json:"iscsi_sessions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.ISCSISessions.Violations, 1)
+	require.Equal(t, analysis.ISCSIMissingSession, body.ISCSISessions.Violations[0].Category)
+	require.Equal(t, "worker-1", body.ISCSISessions.Violations[0].Node)
+}
+
+func TestReadyHandler_ChecksStateStore(t *testing.T) {
+	stateStore, err := store.OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		Store:         stateStore,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, performRequest(server, http.MethodGet, "/ready").Code)
+
+	require.NoError(t, stateStore.Close())
+	rec := performRequest(server, http.MethodGet, "/ready")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "state store unavailable")
+}
+
+func TestListAttachmentsHandler_FlagsMultiAttachedPVs(t *testing.T) {
+	pvName := "pv-shared"
+	attach := func(name, node string) storagev1.VolumeAttachment {
+		return storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: node,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: true},
+		}
+	}
+	ready := corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}
+	k8sStub := &stubK8sClient{
+		volumeAttachments: []storagev1.VolumeAttachment{attach("csi-1", "worker-1"), attach("csi-2", "worker-2")},
+		nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}, Status: ready},
+			{ObjectMeta: metav1.ObjectMeta{Name: "worker-2"}, Status: ready},
+		},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/resources/attachments")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Count         int                             `json:"count"`
+		Items         []analysis.VolumeAttachmentInfo `json:"items"`
+		Findings      []analysis.AttachmentFinding    `json:"findings"`
+		MultiAttached int                             `json:"multi_attached"`
+		Stale         int                             `json:"stale"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 2, body.Count)
+	require.Equal(t, "worker-1", body.Items[0].Node)
+	require.True(t, body.Items[0].NodeReady)
+	require.Equal(t, 1, body.MultiAttached)
+	require.Zero(t, body.Stale)
+	require.Len(t, body.Findings, 1)
+	require.Equal(t, analysis.AttachmentMultiAttached, body.Findings[0].Kind)
+	require.Equal(t, []string{"worker-1", "worker-2"}, body.Findings[0].Nodes)
+}
+
+func TestValidateHandler_CSIVersionSkewIsWarning(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		csiHealth: &k8s.CSIDriverHealth{
+			ControllerVersions: []string{"v1.9.0"},
+			NodeVersions:       []string{"v1.8.3"},
+			VersionSkew:        true,
+			Warnings:           []string{"controller version(s) v1.9.0 differ from node version(s) v1.8.3"},
+		},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, true, body["overall_status"])
+	checks := body["checks"].(map[string]interface{})
+	csiCheck := checks["csi_driver_versions"].(map[string]interface{})
+	require.Equal(t, "warning", csiCheck["status"])
+}
+
+func TestValidateHandler_SnapshotScheduleViolationIsWarning(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("stale-pv")},
+	}
+	truenasStub := &stubTruenasClient{
+		volumes: []truenas.Volume{{Name: "tank/k8s/stale-pv"}},
+		snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/stale-pv@auto", Dataset: "tank/k8s/stale-pv", CreatedAt: time.Now().Add(-48 * time.Hour)},
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     k8sStub,
+		TruenasClient: truenasStub,
+		SnapshotSchedules: []analysis.SchedulePolicy{
+			{StorageClass: "democratic-csi-nfs", Cadence: time.Hour},
+		},
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, true, body["overall_status"])
+	checks := body["checks"].(map[string]interface{})
+	scheduleCheck := checks["snapshot_schedule"].(map[string]interface{})
+	require.Equal(t, "warning", scheduleCheck["status"])
+	require.Equal(t, "snapshot_schedule", scheduleCheck["category"])
+	violations := scheduleCheck["violations"].([]interface{})
+	require.Len(t, violations, 1)
+	require.Equal(t, "stale-pv", violations[0].(map[string]interface{})["persistent_volume"])
+}
+
+func TestValidateHandler_BackupCoverageGapIsWarning(t *testing.T) {
+	k8sStub := &stubK8sClient{
+		democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("data-pv")},
+		allPVCs: []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "data"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "data-pv"},
+		}},
+	}
+	truenasStub := &stubTruenasClient{
+		volumes: []truenas.Volume{{Name: "tank/k8s/data-pv"}},
+		snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/data-pv@auto", Dataset: "tank/k8s/data-pv", CreatedAt: time.Now().Add(-time.Hour)},
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     k8sStub,
+		TruenasClient: truenasStub,
+		BackupCoverage: analysis.BackupCoverageOptions{
+			Policies:     []analysis.BackupCoveragePolicy{{Namespaces: []string{"prod"}}},
+			FloorPercent: 100,
+		},
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, true, body["overall_status"])
+	coverageCheck := body["checks"].(map[string]interface{})["backup_coverage"].(map[string]interface{})
+	require.Equal(t, "warning", coverageCheck["status"])
+	require.Equal(t, analysis.BackupCoverageAlertCategory, coverageCheck["category"])
+	uncovered := coverageCheck["uncovered"].([]interface{})
+	require.Len(t, uncovered, 1)
+	require.Equal(t, "data", uncovered[0].(map[string]interface{})["claim"])
+	bypass := coverageCheck["csi_bypass"].([]interface{})
+	require.Len(t, bypass, 1)
+	require.Equal(t, "tank/k8s/data-pv", bypass[0].(map[string]interface{})["dataset"])
+	require.Len(t, coverageCheck["below_floor"], 1)
+}
+
+func TestValidateHandler_ReportsEffectiveKubernetesUser(t *testing.T) {
+	k8sStub := &stubK8sClient{effectiveUser: &k8s.UserInfo{
+		Username: "system:serviceaccount:storage:scanner",
+		Groups:   []string{"system:serviceaccounts", "system:authenticated"},
+	}}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	kubernetes := body["checks"].(map[string]interface{})["kubernetes"].(map[string]interface{})
+	require.Equal(t, "passed", kubernetes["status"])
+	user := kubernetes["user"].(map[string]interface{})
+	require.Equal(t, "system:serviceaccount:storage:scanner", user["username"])
+
+	// Clusters without SelfSubjectReview still pass, without a user
+	server = newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+	rec = performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	kubernetes = body["checks"].(map[string]interface{})["kubernetes"].(map[string]interface{})
+	require.Equal(t, "passed", kubernetes["status"])
+	require.NotContains(t, kubernetes, "user")
+}
+
+func TestValidateHandler_NoSnapshotScheduleCheckWithoutPolicies(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	checks := body["checks"].(map[string]interface{})
+	require.NotContains(t, checks, "snapshot_schedule")
+}
+
+func TestValidateHandler_NestedParentDatasetsFail(t *testing.T) {
+	k8sStub := &stubK8sClient{storageClasses: []storagev1.StorageClass{
+		{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}, Provisioner: "org.democratic-csi.nfs",
+			Parameters: map[string]string{"datasetParentName": "tank/k8s"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "nfs-fast"}, Provisioner: "org.democratic-csi.nfs",
+			Parameters: map[string]string{"datasetParentName": "tank/k8s/nfs"}},
+	}}
+	truenasStub := &stubTruenasClient{volumes: []truenas.Volume{{Name: "tank/k8s"}, {Name: "tank/k8s/nfs"}}}
+	server := newTestServer(t, k8sStub, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	layout := body["checks"].(map[string]interface{})["dataset_layout"].(map[string]interface{})
+	require.Equal(t, "failed", layout["status"])
+	issues := layout["issues"].([]interface{})
+	require.Len(t, issues, 1)
+	require.Contains(t, issues[0].(map[string]interface{})["message"], "nested inside tank/k8s")
+}
+
+func TestValidateHandler_LockedParentDatasetFails(t *testing.T) {
+	k8sStub := &stubK8sClient{storageClasses: []storagev1.StorageClass{
+		{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}, Provisioner: "org.democratic-csi.nfs",
+			Parameters: map[string]string{"datasetParentName": "tank/k8s"}},
+	}}
+	truenasStub := &stubTruenasClient{
+		volumes: []truenas.Volume{{Name: "tank/k8s", Properties: map[string]string{
+			truenas.PropertyEncrypted: "true", truenas.PropertyLocked: "true",
+		}}},
+		pools: []truenas.Pool{{Name: "tank", Status: "ONLINE"}},
+	}
+	server := newTestServer(t, k8sStub, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	readiness := body["checks"].(map[string]interface{})["zfs_readiness"].(map[string]interface{})
+	require.Equal(t, "failed", readiness["status"])
+	problems := readiness["problems"].([]interface{})
+	require.Len(t, problems, 1)
+	problem := problems[0].(map[string]interface{})
+	require.Equal(t, "dataset_locked", problem["kind"])
+	require.Equal(t, "tank/k8s", problem["dataset"])
+	require.Contains(t, problem["remediation"], "Unlock tank/k8s")
+}
+
+func TestValidateHandler_MissingConfiguredPool(t *testing.T) {
+	truenasStub := &stubTruenasClient{pools: []truenas.Pool{{Name: "tank", Status: "ONLINE"}, {Name: "fast", Status: "ONLINE"}}}
+	for _, strict := range []bool{false, true} {
+		server, err := NewServer(Config{
+			K8sClient:     &stubK8sClient{},
+			TruenasClient: truenasStub,
+			Logger:        zap.NewNop(),
+			Scope:         analysis.ScopeOptions{Pool: "tnak", Strict: strict},
+		})
+		require.NoError(t, err)
+
+		rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		check := body["checks"].(map[string]interface{})["truenas_scope"].(map[string]interface{})
+		if strict {
+			require.Equal(t, "failed", check["status"])
+			require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		} else {
+			require.Equal(t, "warning", check["status"])
+		}
+		require.Equal(t, []interface{}{"fast", "tank"}, check["available_pools"])
+		require.Contains(t, check["problems"].([]interface{})[0], `pool "tnak" does not exist`)
+	}
+}
+
+func TestValidateHandler_WarnsOnUnsafeDatasetNames(t *testing.T) {
+	k8sStub := &stubK8sClient{storageClasses: []storagev1.StorageClass{
+		{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}, Provisioner: "org.democratic-csi.nfs",
+			Parameters: map[string]string{"datasetParentName": "tank/k8s"}},
+	}}
+	truenasStub := &stubTruenasClient{
+		volumes: []truenas.Volume{{Name: "tank/k8s"}, {Name: "tank/k8s/pvc-a"}, {Name: "tank/k8s/pvc-b "}},
+		pools:   []truenas.Pool{{Name: "tank", Status: "ONLINE"}},
+	}
+	server := newTestServer(t, k8sStub, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	check := body["checks"].(map[string]interface{})["dataset_names"].(map[string]interface{})
+	require.Equal(t, "warning", check["status"])
+	issues := check["issues"].([]interface{})
+	require.Len(t, issues, 1)
+	issue := issues[0].(map[string]interface{})
+	require.Equal(t, "tank/k8s/pvc-b ", issue["name"])
+	require.Equal(t, []interface{}{"whitespace"}, issue["problems"])
+}
+
+func TestValidateHandler_SnapshotDeletionPolicy(t *testing.T) {
+	class, handle := "zfs", "pvc-a@gone"
+	k8sStub := &stubK8sClient{
+		snapshotClasses: []snapshotv1.VolumeSnapshotClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: class}, DeletionPolicy: snapshotv1.VolumeSnapshotContentDelete},
+		},
+		snapshotContents: []snapshotv1.VolumeSnapshotContent{{
+			ObjectMeta: metav1.ObjectMeta{Name: "content-a"},
+			Spec: snapshotv1.VolumeSnapshotContentSpec{
+				VolumeSnapshotRef:       corev1.ObjectReference{Namespace: "apps", Name: "snap-a"},
+				DeletionPolicy:          snapshotv1.VolumeSnapshotContentRetain,
+				VolumeSnapshotClassName: &class,
+			},
+			Status: &snapshotv1.VolumeSnapshotContentStatus{SnapshotHandle: &handle},
+		}},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	check := body["checks"].(map[string]interface{})["snapshot_deletion_policy"].(map[string]interface{})
+	require.Equal(t, "warning", check["status"])
+	require.Len(t, check["overridden"], 1)
+	require.Len(t, check["missing_retained"], 1)
+	counts := check["counts"].([]interface{})
+	require.Len(t, counts, 1)
+	require.EqualValues(t, 1, counts[0].(map[string]interface{})["retain"])
+}
+
+func TestListOrphansHandler_SplitsSnapshotCounts(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	k8sStub := &stubK8sClient{
+		volumeSnapshots: []snapshotv1.VolumeSnapshot{
+			{ObjectMeta: metav1.ObjectMeta{Name: "k8s-only", Namespace: "apps", CreationTimestamp: old}},
+		},
+	}
+	truenasStub := &stubTruenasClient{
+		snapshots: []truenas.Snapshot{
+			{Name: "truenas-only", Dataset: "tank/k8s/vol-1", CreatedAt: time.Now().Add(-60 * 24 * time.Hour)},
+			{Name: "recent", Dataset: "tank/k8s/vol-1", CreatedAt: time.Now()},
+		},
+	}
+	server := newTestServer(t, k8sStub, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/orphans")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.EqualValues(t, 1, body["total_k8s_snapshots"])
+	require.EqualValues(t, 2, body["total_truenas_snapshots"])
+	require.EqualValues(t, 1, body["orphaned_k8s_snapshots"])
+	require.EqualValues(t, 1, body["orphaned_truenas_snapshots"])
+	require.EqualValues(t, 3, body["total_snapshots"])
+
+	deprecated, ok := body["deprecated"].(map[string]interface{})
+	require.True(t, ok)
+	require.Contains(t, deprecated, "total_snapshots")
+}
+
+func TestStorageAnalysisHandler_ReturnsAnalysis(t *testing.T) {
+	truenasStub := &stubTruenasClient{
+		pools: []truenas.Pool{{Name: "tank", Size: 100, Used: 85, Available: 15}},
+	}
+	server := newTestServer(t, &stubK8sClient{}, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/analysis")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	pools, ok := body["pools"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, pools, 1)
+	require.EqualValues(t, 85, pools[0].(map[string]interface{})["utilization_percent"])
+	recommendations, ok := body["recommendations"].([]interface{})
+	require.True(t, ok)
+	require.NotEmpty(t, recommendations)
+}
+
+func TestVolumeAnalysisHandler(t *testing.T) {
+	k8sStub := &stubK8sClient{democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("pv-a")}}
+	truenasStub := &stubTruenasClient{
+		volumes: []truenas.Volume{{Name: "tank/k8s/pv-a", Used: 100}},
+		snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pv-a@daily-1", Dataset: "tank/k8s/pv-a", Used: 30},
+			{Name: "tank/k8s/pv-a@daily-2", Dataset: "tank/k8s/pv-a", Used: 50},
+		},
+	}
+	server := newTestServer(t, k8sStub, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/analysis/volumes/pv-a")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Volume analysis.VolumeStats `json:"volume"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "tank/k8s/pv-a", body.Volume.Dataset)
+	require.Equal(t, 2, body.Volume.SnapshotCount)
+	require.EqualValues(t, 80, body.Volume.SnapshotUsedBytes)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/analysis/volumes/pv-missing")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDetailedReportHandler_RendersHTMLAndJSON(t *testing.T) {
+	k8sStub := &stubK8sClient{democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("pv-gone")}}
+	truenasStub := &stubTruenasClient{
+		pools: []truenas.Pool{{Name: "tank", Size: 100, Used: 85, Available: 15}},
+	}
+	server := newTestServer(t, k8sStub, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/reports/detailed?format=html")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "<td>tank</td>")
+	require.Contains(t, rec.Body.String(), "<td>pv-gone</td>")
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/reports/detailed")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Analysis analysis.StorageAnalysis `json:"analysis"`
+		Orphans  orphan.DetectionResult   `json:"orphans"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Analysis.Pools, 1)
+	require.Len(t, body.Orphans.OrphanedPVs, 1)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/reports/detailed?format=pdf")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestReportScheduleHandlers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"weekly","cron":"0 8 * * 1","kind":"detailed","format":"html",`+
+		`"targets":["slack:#storage"],"paused":false,"next_run":"2024-05-13T08:00:00Z"}]`), 0o600))
+	store, err := scheduler.NewStore(path)
+	require.NoError(t, err)
+	server, err := NewServer(Config{
+		K8sClient:       &stubK8sClient{},
+		TruenasClient:   &stubTruenasClient{},
+		Logger:          zap.NewNop(),
+		AdminToken:      "s3cret",
+		ReportSchedules: store,
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/reports/schedules")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Items []scheduler.ScheduleState `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Items, 1)
+	require.Equal(t, time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC), list.Items[0].NextRun)
+
+	pause := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reports/schedules/"+name+"/pause", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Equal(t, http.StatusNotFound, pause("monthly").Code)
+	rec = pause("weekly")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	states, err := store.List()
+	require.NoError(t, err)
+	require.True(t, states[0].Paused)
+
+	server = newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/reports/schedules").Code)
+}
+
+func TestReportArtifactHandlers(t *testing.T) {
+	store, err := artifacts.New(artifacts.Config{Options: artifacts.Options{Dir: t.TempDir()}})
+	require.NoError(t, err)
+	defer store.Close()
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{democraticPVs: []corev1.PersistentVolume{orphanedDemocraticPV("pv-gone")}},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		Artifacts:     store,
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodPost, "/api/v1/reports/artifacts?type=orphans&format=html")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created artifacts.Artifact
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.True(t, strings.HasPrefix(created.Name, "orphans-") && strings.HasSuffix(created.Name, ".html"), created.Name)
+	require.Positive(t, created.SizeBytes)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/reports/artifacts")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Items []artifacts.Artifact `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Items, 1)
+	require.Equal(t, created.Name, list.Items[0].Name)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/reports/artifacts/"+created.Name)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "<td>pv-gone</td>")
+	require.EqualValues(t, created.SizeBytes, rec.Body.Len())
+
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/reports/artifacts/missing.json").Code)
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/reports/artifacts/..%2Fschedules.json").Code)
+	require.Equal(t, http.StatusBadRequest, performRequest(server, http.MethodPost, "/api/v1/reports/artifacts?type=summary").Code)
+
+	server = newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/reports/artifacts").Code)
+}
+
+func TestStorageAnalysisHandler_TrueNASError_Returns500(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{listVolumesErr: errors.New("truenas down")})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/analysis")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestLoggingMiddleware_RedactsSensitiveQuery(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.New(core),
+	})
+	require.NoError(t, err)
+
+	performRequest(server, http.MethodGet, "/health?api_key=super-secret&verbose=1")
+
+	entries := logs.FilterMessage("HTTP request").All()
+	require.Len(t, entries, 1)
+	path := entries[0].ContextMap()["path"].(string)
+	require.Equal(t, "/health?api_key=REDACTED&verbose=1", path)
+}
+
+func TestValidateHandler_DuplicateVolumeHandlesFail(t *testing.T) {
+	original := orphanedDemocraticPV("pv-original")
+	restored := orphanedDemocraticPV("pv-restored")
+	restored.Spec.CSI.VolumeHandle = original.Spec.CSI.VolumeHandle
+	restored.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "restore", Name: "data"}
+	server := newTestServer(t, &stubK8sClient{democraticPVs: []corev1.PersistentVolume{original, restored}}, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/validate")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	checks := body["checks"].(map[string]interface{})
+	dupCheck := checks["duplicate_volume_handles"].(map[string]interface{})
+	require.Equal(t, "failed", dupCheck["status"])
+	require.Equal(t, "critical", dupCheck["severity"])
+	duplicates := dupCheck["duplicates"].([]interface{})
+	require.Len(t, duplicates, 1)
+	pvs := duplicates[0].(map[string]interface{})["persistent_volumes"].([]interface{})
+	require.Equal(t, "restore", pvs[1].(map[string]interface{})["claim_namespace"])
+}
+
+func TestListTrueNASVolumesHandler_IncludesSMBShares(t *testing.T) {
+	truenasStub := &stubTruenasClient{
+		volumes:   []truenas.Volume{{ID: "tank/k8s/nfs/v/pvc-1", Name: "tank/k8s/nfs/v/pvc-1", Type: truenas.VolumeTypeFilesystem}},
+		smbShares: []truenas.SMBShare{{ID: 3, Name: "pvc-2", Path: "/mnt/tank/k8s/smb/v/pvc-2", Enabled: true}},
+	}
+	server := newTestServer(t, &stubK8sClient{}, truenasStub)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/truenas/volumes")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Count int              `json:"count"`
+		Items []truenas.Volume `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 2, body.Count)
+	require.Equal(t, truenas.VolumeTypeSMB, body.Items[1].Type)
+	require.Equal(t, "tank/k8s/smb/v/pvc-2", body.Items[1].Name)
+}
+
+func TestDatasetOwnerHandler(t *testing.T) {
+	controller := true
+	k8sStub := &stubK8sClient{
+		storageClasses: []storagev1.StorageClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}, Provisioner: "org.democratic-csi.nfs",
+				Parameters: map[string]string{"datasetParentName": "tank/k8s/nfs/v"}},
+		},
+		democraticPVs: []corev1.PersistentVolume{{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: "nfs",
+				ClaimRef:         &corev1.ObjectReference{Namespace: "apps", Name: "data"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: "pvc-1"},
+				},
+			},
+		}},
+		pods: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "apps",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &controller}}},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}},
+	}
+	server := newTestServer(t, k8sStub, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/truenas/datasets/tank/k8s/nfs/v/pvc-1/owner")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Owner analysis.DatasetOwner `json:"owner"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "pvc-1", body.Owner.PersistentVolume)
+	require.Equal(t, "data", body.Owner.PersistentVolumeClaim)
+	require.Equal(t, []analysis.Workload{{Kind: "StatefulSet", Name: "db", Pods: []string{"db-0"}}}, body.Owner.Workloads)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/truenas/datasets/tank/k8s/nfs/v/pvc-2/owner")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.NotContains(t, rec.Body.String(), "outside the managed prefixes")
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/truenas/datasets/tank/home/owner")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "outside the managed prefixes")
+	require.Contains(t, rec.Body.String(), `"managed_prefixes":["tank/k8s/nfs/v"]`)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/truenas/datasets/tank/k8s/nfs/v/pvc-1")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMigrationHandler(t *testing.T) {
+	oldClass := "old-nfs"
+	claim := func(name string, mode corev1.PersistentVolumeAccessMode) corev1.PersistentVolumeClaim {
+		return corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &oldClass,
+				AccessModes:      []corev1.PersistentVolumeAccessMode{mode},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+				},
+			},
+		}
+	}
+	k8sClient := &k8stest.Client{
+		StorageClasses: []storagev1.StorageClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: oldClass}, Provisioner: "org.democratic-csi.nfs",
+				Parameters: map[string]string{"datasetParentName": "tank/k8s/nfs"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "new-iscsi"}, Provisioner: "org.democratic-csi.iscsi",
+				Parameters: map[string]string{"datasetParentName": "fast/k8s/iscsi"}},
+		},
+		PersistentVolumeClaims: []corev1.PersistentVolumeClaim{
+			claim("data", corev1.ReadWriteOnce),
+			claim("shared", corev1.ReadWriteMany),
+		},
+	}
+	truenasClient := &truenastest.Client{Pools: []truenas.Pool{{Name: "fast", Available: 8 << 30}}}
+	server := newTestServer(t, k8sClient, truenasClient)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/analysis/migration?from=old-nfs&to=new-iscsi")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Claims     int                           `json:"claims"`
+		Blocked    int                           `json:"blocked"`
+		Capacity   analysis.MigrationCapacity    `json:"capacity"`
+		Namespaces []analysis.MigrationNamespace `json:"namespaces"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 2, body.Claims)
+	require.Equal(t, 1, body.Blocked)
+	require.Len(t, body.Namespaces, 1)
+	require.Equal(t, "fast", body.Capacity.TargetPool)
+	require.Equal(t, int64(10<<30), body.Capacity.RequiredBytes)
+	require.NotNil(t, body.Capacity.Fits)
+	require.False(t, *body.Capacity.Fits)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/analysis/migration?from=old-nfs&to=missing")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = performRequest(server, http.MethodGet, "/api/v1/analysis/migration?from=old-nfs")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = performRequest(server, http.MethodGet, "/api/v1/analysis/migration?from=old-nfs&to=old-nfs")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAlertRoutesHandler_DryRunsRouting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		AlertRouter: alerts.NewRouter(alerts.RouterConfig{
+			Routes: []alerts.Route{{
+				Name:         "team-a",
+				Match:        alerts.Match{Namespaces: []string{"team-a-*"}},
+				Destinations: []alerts.Destination{{Type: alerts.DestinationWebhook, URL: "https://hooks.example.com/a?token=secret"}},
+			}},
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationSlack, Channel: "#storage"}}},
+		}),
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/alerts/routes?category=orphaned_resource&namespace=team-a-prod")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), "secret")
+
+	var body struct {
+		Decision alerts.Decision `json:"decision"`
+		Routes   []alerts.Route  `json:"routes"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "team-a", body.Decision.Route)
+	require.False(t, body.Decision.Silenced)
+	require.Len(t, body.Routes, 2)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/alerts/routes?namespace=other")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, alerts.DefaultRouteName, body.Decision.Route)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/alerts/routes?level=fatal")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAlertRoutesHandler_NotConfigured(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/alerts/routes")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAlertsHandlers_ListAndAcknowledge(t *testing.T) {
+	store, err := alerts.NewStore(alerts.StoreConfig{})
+	require.NoError(t, err)
+	critical := alerts.Alert{Level: alerts.LevelCritical, Category: "duplicate_volume_handle", Resource: "pvc-1111"}
+	warning := alerts.Alert{Level: alerts.LevelWarning, Category: "orphaned_resource", Resource: "PersistentVolume/pv-1"}
+	native := alerts.Alert{Source: alerts.SourceTrueNAS, Level: alerts.LevelCritical, Category: alerts.TrueNASCategory, Resource: "6a9e1d27"}
+	_, err = store.Reconcile([]alerts.Alert{critical, warning, native}, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		AlertStore:    store,
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/alerts")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Count int                  `json:"count"`
+		Items []alerts.ActiveAlert `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Equal(t, 3, list.Count)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/alerts?source=truenas")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Count)
+	require.Equal(t, alerts.SourceTrueNAS, list.Items[0].Source)
+
+	id := alerts.AlertID(critical)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/alerts/"+id+"/ack", strings.NewReader(`{"by":"alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var acked alerts.ActiveAlert
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &acked))
+	require.Equal(t, alerts.StateAcknowledged, acked.State)
+	require.Equal(t, "alice", acked.AcknowledgedBy)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/alerts?state=acknowledged")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Count)
+	require.Equal(t, id, list.Items[0].ID)
+
+	rec = performRequest(server, http.MethodPost, "/api/v1/alerts/unknown/ack")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAlertsHandlers_NotConfigured(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/alerts").Code)
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodPost, "/api/v1/alerts/x/ack").Code)
+}
+
+func TestScanDiffHandler(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/scan/diff").Code)
+
+	previous := &monitor.ScanResult{
+		OrphanedPVs: []monitor.OrphanedResource{{Type: "PersistentVolume", Name: "pv-old"}},
+	}
+	current := &monitor.ScanResult{
+		OrphanedPVs: []monitor.OrphanedResource{{Type: "PersistentVolume", Name: "pv-new"}},
+	}
+	diff := monitor.DiffScans(previous, current)
+	changes := diff.Changes()
+	current.Changes = &changes
+	data, err := json.Marshal(monitor.ScanState{Result: current, Diff: diff})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/scan/diff")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Changes monitor.ScanChanges `json:"changes"`
+		Diff    monitor.ScanDiff    `json:"diff"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 1, body.Changes.NewOrphans)
+	require.Equal(t, 1, body.Changes.ResolvedOrphans)
+	require.Equal(t, "pv-new", body.Diff.NewOrphans[0].Name)
+	require.Equal(t, "pv-old", body.Diff.ResolvedOrphans[0].Name)
+}
+
+func TestScanDiffHandler_WarnsOnConfigDrift(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+	})
+	require.NoError(t, err)
+
+	previous := &monitor.ScanResult{Config: &scanconfig.Effective{Hash: "aaaa"}}
+	current := &monitor.ScanResult{Config: &scanconfig.Effective{Hash: "bbbb"}}
+	data, err := json.Marshal(monitor.ScanState{Result: current, Diff: monitor.DiffScans(previous, current)})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/scan/diff")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Diff     monitor.ScanDiff `json:"diff"`
+		Warnings []string         `json:"warnings"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.NotNil(t, body.Diff.ConfigDrift)
+	require.Equal(t, "aaaa", body.Diff.ConfigDrift.PreviousHash)
+	require.Len(t, body.Warnings, 1)
+	require.Contains(t, body.Warnings[0], "different configurations")
+}
+
+func TestSimulateHandler(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+	})
+	require.NoError(t, err)
+
+	scanned := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	result := &monitor.ScanResult{
+		Timestamp: scanned,
+		Pools:     []analysis.PoolUsage{{Name: "tank", Size: 1000, Used: 600, Available: 400, UtilizationPercent: 60}},
+		OrphanedSnapshots: []monitor.OrphanedResource{
+			{Type: "TrueNASSnapshot", Name: "tank/k8s/pvc-a@old", SizeBytes: 100, Details: map[string]string{"claim_namespace": "apps"}},
+		},
+	}
+	data, err := json.Marshal(monitor.ScanState{Result: result})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/analysis/simulate?actions=cleanup_safe_orphans,enforce_retention")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Simulation     bool                       `json:"simulation"`
+		ScanTimestamp  time.Time                  `json:"scan_timestamp"`
+		ReclaimedBytes int64                      `json:"reclaimed_bytes"`
+		Pools          []monitor.SimulatedPool    `json:"pools"`
+		Namespaces     []monitor.NamespaceReclaim `json:"namespaces"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.True(t, body.Simulation)
+	require.True(t, body.ScanTimestamp.Equal(scanned))
+	require.Equal(t, int64(100), body.ReclaimedBytes)
+	require.Len(t, body.Pools, 1)
+	require.Equal(t, int64(500), body.Pools[0].ProjectedUsed)
+	require.Equal(t, []monitor.NamespaceReclaim{{Namespace: "apps", Snapshots: 1, ReclaimedBytes: 100}}, body.Namespaces)
+
+	rec = performRequest(server, http.MethodGet, "/api/v1/analysis/simulate?actions=delete_everything")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestScanDiffHandler_NotConfigured(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/scan/diff").Code)
+}
+
+func TestSummaryReportHandler(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/reports/summary").Code)
+
+	current := &monitor.ScanResult{
+		TotalPVs:     4,
+		OrphanedPVCs: []monitor.OrphanedResource{{Type: "pvc", Name: "data"}},
+		ProvisioningLatency: &analysis.ProvisioningReport{
+			Window:  24 * time.Hour,
+			Overall: analysis.ProvisioningLatency{Count: 3, P50Seconds: 4, P95Seconds: 30},
+			Classes: []analysis.ProvisioningLatency{{StorageClass: "nfs", Count: 3, P50Seconds: 4, P95Seconds: 30}},
+		},
+		StorageClasses: []orphan.StorageClassUsage{
+			{StorageClass: "nfs", Volumes: 4, ProvisionedBytes: 40 << 30, UsedBytes: 12 << 30, Orphans: 1, WastedBytes: 2 << 30},
+		},
+	}
+	data, err := json.Marshal(monitor.ScanState{Result: current})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/reports/summary")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Totals              map[string]int               `json:"totals"`
+		Orphans             map[string]int               `json:"orphans"`
+		ProvisioningLatency *analysis.ProvisioningReport `json:"provisioning_latency"`
+		ByStorageClass      []orphan.StorageClassUsage   `json:"by_storage_class"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, 4, body.Totals["pvs"])
+	require.Equal(t, 1, body.Orphans["pvcs"])
+	require.Equal(t, current.ProvisioningLatency, body.ProvisioningLatency)
+	require.Equal(t, current.StorageClasses, body.ByStorageClass)
+}
+
+func TestScanStatusHandler(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusNotFound, performRequest(server, http.MethodGet, "/api/v1/status").Code)
+
+	current := &monitor.ScanResult{
+		ScanDuration: 3 * time.Second,
+		Partial:      true,
+		PhaseErrors:  map[string]string{"truenas_snapshots": "timeout"},
+		Phases: map[string]monitor.PhaseStats{
+			"k8s_pvs":        {Duration: time.Second, Items: 12},
+			"correlate_pvs":  {Duration: time.Millisecond, Items: 12},
+			"metrics_update": {Duration: time.Millisecond},
+		},
+		Inventory: &orphan.InventoryCounts{K8sManagedPVs: 12, TrueNASManagedVolumes: 11, UnmatchedK8s: 1, Drift: 1, DriftPercent: 100.0 / 12},
+	}
+	data, err := json.Marshal(monitor.ScanState{Result: current})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/status")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		ScanDuration time.Duration                 `json:"scan_duration"`
+		Partial      bool                          `json:"partial"`
+		PhaseErrors  map[string]string             `json:"phase_errors"`
+		Phases       map[string]monitor.PhaseStats `json:"phases"`
+		Inventory    *orphan.InventoryCounts       `json:"inventory"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, current.Inventory, body.Inventory)
+	require.Equal(t, 3*time.Second, body.ScanDuration)
+	require.True(t, body.Partial)
+	require.Equal(t, "timeout", body.PhaseErrors["truenas_snapshots"])
+	require.Equal(t, current.Phases, body.Phases)
+}
+
+func TestVersionHandler_ReportsBuildAndFeatures(t *testing.T) {
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		Features:      map[string]bool{"nfs_deep_check": true, "truenas_alerts": false},
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/version")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Build    version.Info    `json:"build"`
+		Features map[string]bool `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, version.Version, body.Build.Version)
+	require.Equal(t, runtime.Version(), body.Build.GoVersion)
+	require.Equal(t, map[string]bool{"nfs_deep_check": true, "truenas_alerts": false}, body.Features)
+}
+
+func TestReadOnlyMode_RefusesWritingRoutes(t *testing.T) {
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	fake := &truenastest.Client{
+		Snapshots: []truenas.Snapshot{{ID: "tank/k8s/pvc-a@old", Name: "tank/k8s/pvc-a@old", Dataset: "tank/k8s/pvc-a", CreatedAt: old}},
+		Volumes:   []truenas.Volume{{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a", Used: 1 << 30}},
+	}
+	truenasClient := readonly.NewTrueNASClient(fake)
+	engine := cleanup.NewEngine(truenasClient, cleanup.Config{})
+	defer engine.Close()
+	server, err := NewServer(Config{
+		K8sClient:        readonly.NewK8sClient(&stubK8sClient{}),
+		TruenasClient:    truenasClient,
+		Logger:           zap.NewNop(),
+		AdminToken:       "s3cret",
+		QuotaRemediation: true,
+		CleanupEngine:    engine,
+		ReadOnly:         true,
+	})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/api/v1/admin/quotas/apply", "/api/v1/admin/cleanup/snapshots"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"dry_run": false}`))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusForbidden, rec.Code, path)
+		require.Contains(t, rec.Body.String(), "read-only mode", path)
+	}
+	require.Empty(t, fake.Mutations())
+	require.Empty(t, engine.Jobs())
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/version")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		ReadOnly bool `json:"read_only"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.True(t, body.ReadOnly)
+}
+
+func TestAdminCacheHandlers(t *testing.T) {
+	truenasStub := &stubTruenasClient{snapshots: []truenas.Snapshot{{Name: "tank/k8s/pvc-a@daily"}}}
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: truenas.NewIncrementalSnapshotClient(truenasStub, truenas.IncrementalOptions{}),
+		Logger:        zap.NewNop(),
+		AdminToken:    "s3cret",
+	})
+	require.NoError(t, err)
+
+	adminRequest := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusUnauthorized, adminRequest(http.MethodGet, "/api/v1/admin/cache", "", "").Code)
+	require.Equal(t, http.StatusUnauthorized, adminRequest(http.MethodGet, "/api/v1/admin/cache", "wrong", "").Code)
+	require.Equal(t, http.StatusBadRequest,
+		adminRequest(http.MethodPost, "/api/v1/admin/cache/invalidate", "s3cret", `{"scope":"everything"}`).Code)
+
+	rec := adminRequest(http.MethodPost, "/api/v1/admin/cache/invalidate", "s3cret", `{"scope":"truenas"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var invalidated struct {
+		Scope   string `json:"scope"`
+		Cleared []struct {
+			Name string `json:"name"`
+		} `json:"cleared"`
+		RebuildDuration string `json:"rebuild_duration"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &invalidated))
+	require.Equal(t, "truenas", invalidated.Scope)
+	require.Len(t, invalidated.Cleared, 1)
+	require.Equal(t, "snapshots", invalidated.Cleared[0].Name)
+	require.NotEmpty(t, invalidated.RebuildDuration)
+
+	rec = adminRequest(http.MethodGet, "/api/v1/admin/cache", "s3cret", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status struct {
+		Caches []struct {
+			Scope   string `json:"scope"`
+			Name    string `json:"name"`
+			Entries int    `json:"entries"`
+			Age     string `json:"age"`
+		} `json:"caches"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	entries := make(map[string]int)
+	for _, cache := range status.Caches {
+		entries[cache.Scope+"/"+cache.Name] = cache.Entries
+	}
+	require.Equal(t, map[string]int{"correlation/storage_analysis": 0, "truenas/snapshots": 1}, entries)
+}
+
+func TestAdminCacheHandlers_DisabledWithoutToken(t *testing.T) {
+	server := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+
+	require.Equal(t, http.StatusForbidden, performRequest(server, http.MethodGet, "/api/v1/admin/cache").Code)
+	require.Equal(t, http.StatusForbidden, performRequest(server, http.MethodPost, "/api/v1/admin/cache/invalidate").Code)
+}
+
+func TestApplyQuotasHandler(t *testing.T) {
+	pv := orphanedDemocraticPV("pvc-a")
+	pv.Spec.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{Name: "tank/k8s/pvc-a", Type: truenas.VolumeTypeFilesystem, Used: 1 << 30, Available: 100 << 30}},
+		Pools:   []truenas.Pool{{Name: "tank", Size: 200 << 30, Used: 100 << 30}},
+	}
+	newServer := func(remediation bool) *Server {
+		server, err := NewServer(Config{
+			K8sClient:        &stubK8sClient{democraticPVs: []corev1.PersistentVolume{pv}},
+			TruenasClient:    truenasClient,
+			Logger:           zap.NewNop(),
+			AdminToken:       "s3cret",
+			Quotas:           analysis.QuotaOptions{Enabled: true},
+			QuotaRemediation: remediation,
+		})
+		require.NoError(t, err)
+		return server
+	}
+	apply := func(server *Server, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/quotas/apply", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	type response struct {
+		DryRun            bool                      `json:"dry_run"`
+		Changes           []analysis.RefquotaChange `json:"changes"`
+		ConfirmationToken string                    `json:"confirmation_token"`
+	}
+
+	rec := apply(newServer(false), "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	server := newServer(true)
+	rec = performRequest(server, http.MethodGet, "/api/v1/analysis")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result analysis.StorageAnalysis
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Len(t, result.QuotaRecommendations, 1)
+	require.Equal(t, int64(11<<30), result.QuotaRecommendations[0].SuggestedRefquotaBytes)
+
+	rec = apply(server, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var dryRun response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dryRun))
+	require.True(t, dryRun.DryRun)
+	require.Len(t, dryRun.Changes, 1)
+	require.False(t, dryRun.Changes[0].Applied)
+	require.Zero(t, truenasClient.Calls("SetDatasetRefquota"))
+
+	rec = apply(server, `{"dry_run": false}`)
+	require.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	require.Zero(t, truenasClient.Calls("SetDatasetRefquota"))
+
+	rec = apply(server, `{"dry_run": false, "confirmation_token": "`+dryRun.ConfirmationToken+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var applied response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &applied))
+	require.False(t, applied.DryRun)
+	require.True(t, applied.Changes[0].Applied)
+	require.Equal(t, "11811160064", truenasClient.Volumes[0].Properties["refquota"])
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/version"
+	"go.uber.org/zap"
+)
+
+const (
+	// statuszConnectivityTimeout bounds each connectivity check of /statusz.
+	statuszConnectivityTimeout = 3 * time.Second
+	// statuszMaxAlerts caps the alerts listed, keeping the page a few KB.
+	statuszMaxAlerts = 20
+	// statuszMaxLine truncates long alert resources and messages.
+	statuszMaxLine = 100
+)
+
+// statuszHandler renders a plain-text summary for people without JSON
+// tooling: version, uptime, connectivity, the monitor's last scan and the
+// active alerts. It needs no token, so it shows counts, names and states but
+// never error details. ?verbose=1 appends the scan phases and cache ages.
+func (s *Server) statuszHandler(c *gin.Context) {
+	now := time.Now().UTC()
+	verbose := c.Query("verbose") == "1" || c.Query("verbose") == "true"
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	info := version.Get()
+	fmt.Fprintf(w, "truenas-monitor api-server\n\n")
+	fmt.Fprintf(w, "version\t%s (commit %s, built %s, %s)\n", info.Version, info.GitCommit, info.BuildDate, info.GoVersion)
+	fmt.Fprintf(w, "uptime\t%s\n", now.Sub(s.startedAt).Round(time.Second))
+	fmt.Fprintf(w, "read only\t%t\n", s.readOnly)
+	fmt.Fprintf(w, "time\t%s\n", now.Format(time.RFC3339))
+
+	k8sErr, truenasErr := s.statuszConnectivity(c.Request.Context())
+	fmt.Fprintf(w, "\nconnectivity\n")
+	fmt.Fprintf(w, "  kubernetes\t%s\n", connectivityStatus(k8sErr))
+	fmt.Fprintf(w, "  truenas\t%s\n", connectivityStatus(truenasErr))
+
+	state := s.statuszScanState(w)
+	if state != nil {
+		result := state.Result
+		fmt.Fprintf(w, "\nlast scan\t%s (%s ago)\n", result.Timestamp.UTC().Format(time.RFC3339), now.Sub(result.Timestamp).Round(time.Second))
+		fmt.Fprintf(w, "  duration\t%s\n", result.ScanDuration.Round(time.Millisecond))
+		fmt.Fprintf(w, "  partial\t%t\n", result.Partial)
+		if result.Degraded {
+			fmt.Fprintf(w, "  degraded\ttrue (configured pool %s or its parent dataset is missing)\n", result.Scope.Pool)
+		}
+		if result.Stale {
+			fmt.Fprintf(w, "  stale\ttrue\n")
+		}
+		if len(result.PhaseErrors) > 0 {
+			fmt.Fprintf(w, "  failed phases\t%s\n", strings.Join(sortedKeys(result.PhaseErrors), ", "))
+		}
+		fmt.Fprintf(w, "  orphaned pvs\t%d of %d\n", len(result.OrphanedPVs), result.TotalPVs)
+		fmt.Fprintf(w, "  orphaned pvcs\t%d of %d\n", len(result.OrphanedPVCs), result.TotalPVCs)
+		fmt.Fprintf(w, "  orphaned snapshots\t%d of %d\n", len(result.OrphanedSnapshots), result.TotalSnapshots)
+		if inventory := result.Inventory; inventory != nil {
+			fmt.Fprintf(w, "  inventory drift\t%d (%.1f%%)\n", inventory.Drift, inventory.DriftPercent)
+		}
+	}
+
+	s.statuszAlerts(w)
+
+	if verbose {
+		if state != nil && len(state.Result.Phases) > 0 {
+			fmt.Fprintf(w, "\nscan phases\tduration\titems\n")
+			phases := make([]string, 0, len(state.Result.Phases))
+			for phase := range state.Result.Phases {
+				phases = append(phases, phase)
+			}
+			sort.Strings(phases)
+			for _, phase := range phases {
+				stats := state.Result.Phases[phase]
+				fmt.Fprintf(w, "  %s\t%s\t%d\n", phase, stats.Duration.Round(time.Millisecond), stats.Items)
+			}
+		}
+		fmt.Fprintf(w, "\ncaches\tentries\tage\n")
+		for _, cache := range s.caches {
+			age := "empty"
+			if builtAt := cache.builtAt(); !builtAt.IsZero() {
+				age = now.Sub(builtAt).Round(time.Second).String()
+			}
+			fmt.Fprintf(w, "  %s/%s\t%d\t%s\n", cache.scope, cache.name, cache.entries(), age)
+		}
+	}
+
+	w.Flush()
+	c.String(http.StatusOK, b.String())
+}
+
+// statuszConnectivity tests both backends concurrently, each within
+// statuszConnectivityTimeout.
+func (s *Server) statuszConnectivity(ctx context.Context) (k8sErr, truenasErr error) {
+	ctx, cancel := context.WithTimeout(ctx, statuszConnectivityTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		k8sErr = s.k8sClient.TestConnection(ctx)
+	}()
+	truenasErr = s.truenasClient.TestConnection(ctx)
+	<-done
+	return k8sErr, truenasErr
+}
+
+func connectivityStatus(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "failed"
+	}
+}
+
+// statuszScanState returns the monitor's last scan, writing a line instead
+// when there is none to show.
+func (s *Server) statuszScanState(w io.Writer) *monitor.ScanState {
+	if s.scanStateFile == "" {
+		fmt.Fprintf(w, "\nlast scan\tunknown (scan state file is not configured)\n")
+		return nil
+	}
+	state, err := monitor.ReadScanState(s.scanStateFile)
+	if errors.Is(err, monitor.ErrNoScanState) {
+		fmt.Fprintf(w, "\nlast scan\tnone recorded yet\n")
+		return nil
+	}
+	if err != nil {
+		s.logger.Warn("Failed to read scan state for /statusz", zap.Error(err))
+		fmt.Fprintf(w, "\nlast scan\tunreadable\n")
+		return nil
+	}
+	return state
+}
+
+// statuszAlerts lists up to statuszMaxAlerts active alerts, most severe
+// first.
+func (s *Server) statuszAlerts(w io.Writer) {
+	if s.alertStore == nil {
+		return
+	}
+	list, err := s.alertStore.List()
+	if err != nil {
+		s.logger.Warn("Failed to list alerts for /statusz", zap.Error(err))
+		fmt.Fprintf(w, "\nactive alerts\tunavailable\n")
+		return
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return alertLevelRank(list[i].Level) > alertLevelRank(list[j].Level)
+	})
+	fmt.Fprintf(w, "\nactive alerts\t%d\n", len(list))
+	for i, active := range list {
+		if i == statuszMaxAlerts {
+			fmt.Fprintf(w, "  ... and %d more\n", len(list)-statuszMaxAlerts)
+			break
+		}
+		subject := active.Resource
+		if subject == "" {
+			subject = active.Message
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", active.Level, active.State, active.Category, truncate(subject, statuszMaxLine))
+	}
+}
+
+func alertLevelRank(level string) int {
+	switch level {
+	case alerts.LevelCritical:
+		return 2
+	case alerts.LevelWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// truncate shortens s to at most n runes, marking the cut with "...".
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
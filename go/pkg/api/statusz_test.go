@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"go.uber.org/zap"
+)
+
+func TestStatuszHandler(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	store, err := alerts.NewStore(alerts.StoreConfig{})
+	require.NoError(t, err)
+	_, err = store.Reconcile([]alerts.Alert{
+		{Level: alerts.LevelWarning, Category: "pool_usage", Resource: "tank", Message: "Pool tank is 85% full"},
+		{Level: alerts.LevelCritical, Category: "inventory_drift", Resource: "Inventory/democratic-csi", Message: "drift"},
+	}, nil)
+	require.NoError(t, err)
+
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{testConnectionErr: errors.New("dial tcp 10.0.0.5:443: secret detail")},
+		Logger:        zap.NewNop(),
+		ScanStateFile: stateFile,
+		AlertStore:    store,
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/statusz")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	body := rec.Body.String()
+	require.Contains(t, body, "none recorded yet")
+	require.Regexp(t, `kubernetes +ok`, body)
+	require.Regexp(t, `truenas +failed`, body)
+	require.NotContains(t, body, "secret detail")
+
+	result := &monitor.ScanResult{
+		Timestamp:    time.Now().Add(-time.Minute),
+		ScanDuration: 3 * time.Second,
+		OrphanedPVs:  []monitor.OrphanedResource{{Type: "PersistentVolume", Name: "pv-a"}},
+		TotalPVs:     12,
+		PhaseErrors:  map[string]string{"truenas_snapshots": "timeout"},
+		Phases:       map[string]monitor.PhaseStats{"k8s_pvs": {Duration: time.Second, Items: 12}},
+		Inventory:    &orphan.InventoryCounts{Drift: 1, DriftPercent: 8.3},
+	}
+	data, err := json.Marshal(monitor.ScanState{Result: result})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+
+	for _, path := range []string{"/statusz", "/healthz"} {
+		rec = performRequest(server, http.MethodGet, path)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		body = rec.Body.String()
+		require.Regexp(t, `orphaned pvs +1 of 12`, body, path)
+		require.Regexp(t, `failed phases +truenas_snapshots`, body, path)
+		require.Regexp(t, `inventory drift +1 \(8\.3%\)`, body, path)
+		require.Regexp(t, `active alerts +2`, body, path)
+		require.Less(t, strings.Index(body, "inventory_drift"), strings.Index(body, "pool_usage"), "critical alerts come first")
+		require.NotContains(t, body, "scan phases", path)
+		require.Less(t, len(body), 4096, path)
+	}
+
+	rec = performRequest(server, http.MethodGet, "/statusz?verbose=1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	body = rec.Body.String()
+	require.Regexp(t, `k8s_pvs +1s +12`, body)
+	require.Regexp(t, `caches +entries +age`, body)
+}
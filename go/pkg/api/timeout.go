@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default request budgets, body limit, scan freshness and list cap.
+const (
+	DefaultReadTimeout    = 30 * time.Second
+	DefaultReportTimeout  = 5 * time.Minute
+	DefaultMaxBodyBytes   = 1 << 20 // 1MB
+	DefaultBackendTimeout = 2 * time.Minute
+	DefaultMaxScanAge     = 10 * time.Minute
+	DefaultMaxListItems   = 1000
+)
+
+// backendHeadroom is kept between the backend deadline and the route
+// budget, so a handler whose backends timed out can still answer.
+const backendHeadroom = time.Second
+
+// RequestLimits configures per-route request budgets and the maximum
+// request body size. Zero values use the defaults.
+type RequestLimits struct {
+	// ReadTimeout bounds inventory and status reads.
+	ReadTimeout time.Duration
+	// ReportTimeout bounds analysis, report, validation and admin routes
+	// that gather full inventories.
+	ReportTimeout time.Duration
+	// MaxBodyBytes caps request bodies of POST endpoints.
+	MaxBodyBytes int64
+	// BackendTimeout bounds the Kubernetes and TrueNAS calls of one
+	// request; the route budget minus a second bounds them as well.
+	BackendTimeout time.Duration
+	// MaxScanAge is the age up to which the monitor's last scan answers
+	// the default view of orphan and CSI health reads instead of a live
+	// query. It applies only with a scan state file.
+	MaxScanAge time.Duration
+	// MaxListItems caps each orphan list of one response; longer lists
+	// are truncated and paged with a cursor.
+	MaxListItems int
+}
+
+func (l RequestLimits) withDefaults() RequestLimits {
+	if l.ReadTimeout <= 0 {
+		l.ReadTimeout = DefaultReadTimeout
+	}
+	if l.ReportTimeout <= 0 {
+		l.ReportTimeout = DefaultReportTimeout
+	}
+	if l.MaxBodyBytes <= 0 {
+		l.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if l.BackendTimeout <= 0 {
+		l.BackendTimeout = DefaultBackendTimeout
+	}
+	if l.MaxScanAge <= 0 {
+		l.MaxScanAge = DefaultMaxScanAge
+	}
+	if l.MaxListItems <= 0 {
+		l.MaxListItems = DefaultMaxListItems
+	}
+	return l
+}
+
+// timeoutWriter drops writes once the request budget has expired, so the
+// timeout middleware can answer 504 instead of a late handler response.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *timeoutWriter) expired() bool {
+	return errors.Is(w.ctx.Err(), context.DeadlineExceeded)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return 0, context.DeadlineExceeded
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return 0, context.DeadlineExceeded
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// timeoutMiddleware gives the request context a deadline of budget, so
+// backend calls made with c.Request.Context() are cancelled when it expires
+// (or when the client goes away). A handler that has not responded by then
+// gets a structured 504 and onTimeout is called with the route.
+func timeoutMiddleware(budget time.Duration, onTimeout func(route string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+
+		writer := c.Writer
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &timeoutWriter{ResponseWriter: writer, ctx: ctx}
+		c.Next()
+		c.Writer = writer
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) || writer.Written() {
+			return
+		}
+		if onTimeout != nil {
+			onTimeout(c.FullPath())
+		}
+		writeError(c, http.StatusGatewayTimeout, ErrorCodeTimeout, fmt.Sprintf("request exceeded its %s budget", budget), gin.H{
+			"route": c.FullPath(),
+		})
+	}
+}
+
+// bodyLimitMiddleware rejects request bodies larger than limit with 413.
+// Bodies without a Content-Length are cut off at the limit, which makes
+// JSON binding fail with 400.
+func bodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			writeError(c, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit), gin.H{
+				"max_bytes": limit,
+			})
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
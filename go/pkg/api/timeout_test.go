@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"go.uber.org/zap"
+)
+
+// blockingTruenasClient blocks ListVolumes until the request context ends.
+type blockingTruenasClient struct {
+	stubTruenasClient
+	cancelled chan struct{}
+}
+
+func (b *blockingTruenasClient) ListVolumes(ctx context.Context) ([]truenas.Volume, error) {
+	<-ctx.Done()
+	close(b.cancelled)
+	return nil, ctx.Err()
+}
+
+func TestTimeoutMiddleware_SlowHandlerGets504AndIsCancelled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Path: "/metrics"})
+	truenasStub := &blockingTruenasClient{cancelled: make(chan struct{})}
+	server, err := NewServer(Config{
+		K8sClient:       &stubK8sClient{},
+		TruenasClient:   truenasStub,
+		Logger:          zap.NewNop(),
+		Limits:          RequestLimits{ReadTimeout: 20 * time.Millisecond},
+		MetricsExporter: exporter,
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/api/v1/truenas/volumes")
+	require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+
+	var body APIError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, ErrorCodeTimeout, body.Code)
+	require.Equal(t, "/api/v1/truenas/volumes", body.Details["route"])
+
+	select {
+	case <-truenasStub.cancelled:
+	default:
+		t.Fatal("backend call was not cancelled")
+	}
+
+	families, err := exporter.GatherForTest()
+	require.NoError(t, err)
+	var timeouts float64
+	for _, family := range families {
+		if family.GetName() == "truenas_api_request_timeouts_total" {
+			timeouts = family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	require.Equal(t, float64(1), timeouts)
+
+	rec = performRequest(server, http.MethodGet, "/metrics")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "truenas_api_request_timeouts_total")
+}
+
+func TestTimeoutMiddleware_FastHandlerUnaffected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/fast", timeoutMiddleware(time.Second, func(string) { t.Fatal("unexpected timeout") }), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"ok":true}`, rec.Body.String())
+}
+
+func TestBodyLimitMiddleware_RejectsOversizedBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		Limits:        RequestLimits{MaxBodyBytes: 16},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/alerts/x/ack", strings.NewReader(`{"by":"a-very-long-operator-name"}`))
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
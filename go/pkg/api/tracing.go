@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// tracingServerName is the server name otelgin records on request spans.
+const tracingServerName = "truenas-api-server"
+
+// tracingMiddleware starts a server span per request with otelgin,
+// continuing the caller's trace from the traceparent header, and puts it in
+// the request context so the K8s and TrueNAS calls a handler makes become
+// its children. The second handler adds the request ID to the span.
+func tracingMiddleware(tracer *tracing.Tracer) []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		otelgin.Middleware(tracingServerName,
+			otelgin.WithTracerProvider(tracer.TracerProvider()),
+			otelgin.WithPropagators(tracing.Propagator),
+			otelgin.WithSpanNameFormatter(func(c *gin.Context) string {
+				route := c.FullPath()
+				if route == "" {
+					route = "unmatched"
+				}
+				return c.Request.Method + " " + route
+			})),
+		func(c *gin.Context) {
+			tracing.SpanFromContext(c.Request.Context()).SetAttributes(tracing.String("request_id", c.GetString("request_id")))
+			c.Next()
+		},
+	}
+}
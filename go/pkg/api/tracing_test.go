@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+func TestTracingMiddleware_TracesRequestAndDetection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	tracer, err := tracing.NewTracer(tracing.Config{Enabled: true, SampleRatio: 1, Exporter: exporter, BatchTimeout: time.Hour})
+	require.NoError(t, err)
+	defer tracer.Shutdown(context.Background())
+
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		Tracer:        tracer,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orphans", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+		byName[span.Name] = span
+	}
+
+	root, ok := byName["GET /api/v1/orphans"]
+	require.True(t, ok, "missing request span in %v", byName)
+	require.Equal(t, tracing.SpanKindServer, root.SpanKind)
+	require.Equal(t, "00f067aa0ba902b7", root.Parent.SpanID().String())
+	require.Contains(t, root.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	require.Contains(t, root.Attributes, attribute.String("http.route", "/api/v1/orphans"))
+	require.Contains(t, root.Attributes, attribute.String("request_id", rec.Header().Get("X-Request-ID")))
+
+	detect, ok := byName["orphan.detect"]
+	require.True(t, ok, "missing detection span in %v", byName)
+	require.Equal(t, root.SpanContext.SpanID(), detect.Parent.SpanID())
+	require.Equal(t, detect.SpanContext.SpanID(), byName["orphan.k8s_pvs"].Parent.SpanID())
+}
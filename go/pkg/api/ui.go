@@ -0,0 +1,40 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uiAssets is the web UI: one page reading the JSON API. The assets are
+// plain HTML, CSS and JavaScript committed as served, so building the
+// server needs no Node toolchain.
+//
+//go:embed ui
+var uiAssets embed.FS
+
+// uiContentSecurityPolicy keeps the page to its own assets and API.
+const uiContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// setupUIRoutes serves the web UI page at / and its assets under /ui/.
+func (s *Server) setupUIRoutes(router *gin.Engine) {
+	assets, err := fs.Sub(uiAssets, "ui")
+	if err != nil {
+		panic(err) // the embed pattern guarantees the directory
+	}
+	index, err := fs.ReadFile(assets, "index.html")
+	if err != nil {
+		panic(err)
+	}
+
+	headers := func(c *gin.Context) {
+		c.Header("Content-Security-Policy", uiContentSecurityPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+	}
+	router.GET("/", headers, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	})
+	router.Group("/ui", headers).StaticFS("/", http.FS(assets))
+}
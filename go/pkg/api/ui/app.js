@@ -0,0 +1,250 @@
+// Web UI of the API server. It reads the JSON API with relative URLs, so it
+// works behind a path prefix, and refreshes every REFRESH_MS.
+"use strict";
+
+const REFRESH_MS = 30000;
+const ACTIVITY_ITEMS = 50;
+const ORPHAN_TYPES = {
+  orphaned_pvs: "PersistentVolume",
+  orphaned_pvcs: "PersistentVolumeClaim",
+  orphaned_snapshots: "Snapshot",
+  orphaned_truenas_volumes: "TrueNAS volume",
+};
+
+let orphanReport = null;
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+// el builds an element with text content; children are appended as given.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (key === "class") {
+      node.className = value;
+    } else {
+      node.setAttribute(key, value);
+    }
+  }
+  for (const child of children) {
+    node.append(child instanceof Node ? child : String(child ?? ""));
+  }
+  return node;
+}
+
+async function getJSON(path) {
+  const response = await fetch(path, { headers: { Accept: "application/json" } });
+  const body = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    const message = body.message || response.statusText;
+    throw new Error(`${response.status} ${message}`);
+  }
+  return body;
+}
+
+function bytes(value) {
+  if (!value) return "0 B";
+  const units = ["B", "KiB", "MiB", "GiB", "TiB", "PiB"];
+  let i = 0;
+  let n = Math.abs(value);
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${value < 0 ? "-" : ""}${n.toFixed(i ? 1 : 0)} ${units[i]}`;
+}
+
+// age formats a Go duration in nanoseconds.
+function age(nanoseconds) {
+  const minutes = Math.floor(nanoseconds / 6e10);
+  if (minutes < 60) return `${minutes}m`;
+  const hours = Math.floor(minutes / 60);
+  if (hours < 48) return `${hours}h`;
+  return `${Math.floor(hours / 24)}d`;
+}
+
+function when(timestamp) {
+  return timestamp ? new Date(timestamp).toLocaleString() : "";
+}
+
+function failed(target, err) {
+  target.replaceChildren(el("p", { class: "bad" }, err.message));
+}
+
+async function loadSummary() {
+  try {
+    const summary = await getJSON("api/v1/reports/summary");
+    const tiles = [
+      ["PVs", summary.totals.pvs],
+      ["PVCs", summary.totals.pvcs],
+      ["K8s snapshots", summary.totals.k8s_snapshots],
+      ["TrueNAS snapshots", summary.totals.truenas_snapshots],
+      ["Orphaned PVs", summary.orphans.pvs],
+      ["Orphaned PVCs", summary.orphans.pvcs],
+      ["Orphaned snapshots", summary.orphans.snapshots],
+    ];
+    $("summary-body").replaceChildren(
+      ...tiles.map(([label, value]) => el("div", { class: "tile" }, el("b", {}, value ?? 0), label)),
+    );
+    const notes = [`Scan at ${when(summary.scan_timestamp)}`];
+    if (summary.stale) notes.push("stale");
+    if (summary.partial) notes.push("partial");
+    if (summary.namespace_coverage_percent != null) {
+      notes.push(`${summary.namespace_coverage_percent}% of namespaces readable`);
+    }
+    $("summary-note").textContent = notes.join(" · ");
+    renderPools(summary.pools || []);
+  } catch (err) {
+    failed($("summary-body"), err);
+    $("summary-note").textContent = "";
+    failed($("pools-body"), err);
+  }
+}
+
+function renderPools(pools) {
+  if (pools.length === 0) {
+    $("pools-body").replaceChildren(el("p", { class: "muted" }, "No pool usage in the last scan."));
+    return;
+  }
+  $("pools-body").replaceChildren(
+    ...pools.map((pool) => {
+      const percent = Math.min(100, pool.utilization_percent || 0);
+      const level = percent >= 90 ? "bad" : percent >= 80 ? "warn" : "";
+      const bar = el("span", { class: level });
+      // Set through the CSSOM: the page's CSP forbids inline style attributes.
+      bar.style.width = `${percent}%`;
+      const health = pool.health && pool.health !== "ONLINE" ? ` · ${pool.health}` : "";
+      return el(
+        "div",
+        { class: "pool" },
+        el(
+          "div",
+          { class: "pool-head" },
+          el("span", {}, `${pool.name}${health}`),
+          el("span", { class: "muted" }, `${bytes(pool.used)} / ${bytes(pool.size)} (${percent.toFixed(1)}%)`),
+        ),
+        el("div", { class: "bar" }, bar),
+      );
+    }),
+  );
+}
+
+async function loadCSI() {
+  try {
+    const { health } = await getJSON("api/v1/csi/health");
+    const pods = health.pods || [];
+    const ready = pods.filter((pod) => pod.ready).length;
+    const rows = [
+      el("p", { class: ready === pods.length ? "ok" : "bad" }, `${ready} of ${pods.length} pods ready in ${health.namespace}`),
+    ];
+    if (health.version_skew) {
+      rows.push(el("p", { class: "warn" }, "Controller and node driver versions differ"));
+    }
+    for (const warning of health.warnings || []) {
+      rows.push(el("p", { class: "warn" }, warning));
+    }
+    const notReady = pods.filter((pod) => !pod.ready);
+    if (notReady.length > 0) {
+      rows.push(el("ul", {}, ...notReady.map((pod) => el("li", {}, `${pod.name} (${pod.role}, ${pod.phase}) on ${pod.node || "no node"}`))));
+    }
+    $("csi-body").replaceChildren(...rows);
+  } catch (err) {
+    failed($("csi-body"), err);
+  }
+}
+
+// loadActivity lists active alerts and the changes of the last scan, newest
+// first.
+async function loadActivity() {
+  const [alerts, diff] = await Promise.allSettled([getJSON("api/v1/alerts"), getJSON("api/v1/scan/diff")]);
+  const entries = [];
+  if (alerts.status === "fulfilled") {
+    for (const alert of alerts.value.items || []) {
+      const subject = [alert.namespace, alert.resource].filter(Boolean).join("/");
+      entries.push({
+        at: alert.last_seen,
+        level: alert.level === "critical" ? "bad" : alert.level === "warning" ? "warn" : "",
+        text: `${alert.category}${subject ? ` ${subject}` : ""}: ${alert.message}${alert.state === "acknowledged" ? " (acknowledged)" : ""}`,
+      });
+    }
+  }
+  if (diff.status === "fulfilled" && diff.value.changes) {
+    const changes = diff.value.changes;
+    entries.push({
+      at: diff.value.scan_timestamp,
+      level: "",
+      text: `Scan: ${changes.new_orphans} new and ${changes.resolved_orphans} resolved orphans, ${bytes(changes.used_bytes_delta)} used bytes change`,
+    });
+  }
+  entries.sort((a, b) => new Date(b.at) - new Date(a.at));
+  const items = entries.slice(0, ACTIVITY_ITEMS).map((entry) =>
+    el("li", { class: entry.level }, el("time", {}, when(entry.at)), entry.text),
+  );
+  if (items.length === 0) {
+    const reason = alerts.status === "rejected" ? alerts.reason.message : "No recent activity.";
+    items.push(el("li", { class: "muted" }, reason));
+  }
+  $("activity-body").replaceChildren(...items);
+}
+
+async function loadOrphans() {
+  const namespace = $("orphan-filters").elements.namespace.value.trim();
+  const query = namespace ? `?namespace=${encodeURIComponent(namespace)}` : "";
+  try {
+    orphanReport = await getJSON(`api/v1/orphans${query}`);
+    renderOrphans();
+  } catch (err) {
+    orphanReport = null;
+    $("orphans-body").replaceChildren();
+    $("orphans-note").textContent = err.message;
+  }
+}
+
+function renderOrphans() {
+  if (!orphanReport) return;
+  const form = $("orphan-filters").elements;
+  const type = form.type.value;
+  const search = form.q.value.trim().toLowerCase();
+  const rows = [];
+  for (const [key, label] of Object.entries(ORPHAN_TYPES)) {
+    if (type && type !== key) continue;
+    for (const orphan of orphanReport[key] || []) {
+      const text = `${orphan.namespace || ""}/${orphan.name} ${orphan.reason}`.toLowerCase();
+      if (search && !text.includes(search)) continue;
+      rows.push(
+        el(
+          "tr",
+          {},
+          el("td", {}, label),
+          el("td", {}, orphan.namespace || ""),
+          el("td", {}, orphan.name),
+          el("td", {}, age(orphan.age)),
+          el("td", {}, orphan.size || ""),
+          el("td", {}, orphan.storage_class || ""),
+          el("td", {}, orphan.reason),
+        ),
+      );
+    }
+  }
+  $("orphans-body").replaceChildren(...rows);
+  const notes = [`${rows.length} shown`];
+  if (orphanReport.truncated) notes.push(`lists capped at ${orphanReport.limit} per type`);
+  if (orphanReport.partial) notes.push("partial scan");
+  $("orphans-note").textContent = notes.join(" · ");
+}
+
+async function refresh() {
+  await Promise.all([loadSummary(), loadCSI(), loadActivity(), loadOrphans()]);
+  $("updated").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  const form = $("orphan-filters");
+  form.addEventListener("submit", (event) => event.preventDefault());
+  form.elements.type.addEventListener("change", renderOrphans);
+  form.elements.q.addEventListener("input", renderOrphans);
+  form.elements.namespace.addEventListener("change", loadOrphans);
+  refresh();
+  setInterval(refresh, REFRESH_MS);
+});
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestServer_UI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(Config{
+		K8sClient:     &stubK8sClient{},
+		TruenasClient: &stubTruenasClient{},
+		Logger:        zap.NewNop(),
+		UI:            true,
+	})
+	require.NoError(t, err)
+
+	rec := performRequest(server, http.MethodGet, "/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Header().Get("Content-Security-Policy"), "default-src 'none'")
+	assert.Contains(t, rec.Body.String(), `src="ui/app.js"`)
+
+	rec = performRequest(server, http.MethodGet, "/ui/app.js")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "api/v1/reports/summary")
+
+	disabled := newTestServer(t, &stubK8sClient{}, &stubTruenasClient{})
+	assert.Equal(t, http.StatusNotFound, performRequest(disabled, http.MethodGet, "/").Code)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/schemas"
+)
+
+// The /api/v2 documents are typed: each is a struct built once by a
+// build function that the v1 handler renders into its unchanged map shape
+// and the v2 handler serves as is. Breaking changes to a document go to v2
+// only; v1 stays byte-compatible until its sunset.
+
+// SummaryReport is the summary of the monitor's most recent scan.
+type SummaryReport struct {
+	SchemaVersion            int                              `json:"schema_version"`
+	Timestamp                time.Time                        `json:"timestamp"`
+	ScanTimestamp            time.Time                        `json:"scan_timestamp"`
+	Partial                  bool                             `json:"partial"`
+	Stale                    bool                             `json:"stale"`
+	UnreadableNamespaces     []orphan.UnreadableNamespace     `json:"unreadable_namespaces"`
+	NamespaceCoveragePercent *float64                         `json:"namespace_coverage_percent"`
+	Totals                   SummaryTotals                    `json:"totals"`
+	Orphans                  SummaryOrphans                   `json:"orphans"`
+	Pools                    []analysis.PoolUsage             `json:"pools"`
+	StorageEfficiency        *analysis.StorageEfficiency      `json:"storage_efficiency"`
+	ProvisioningLatency      *analysis.ProvisioningReport     `json:"provisioning_latency"`
+	AbandonedDatasets        *analysis.AbandonedDatasetReport `json:"abandoned_datasets"`
+	ByStorageClass           []orphan.StorageClassUsage       `json:"by_storage_class"`
+}
+
+// SummaryTotals counts the resources a scan saw.
+type SummaryTotals struct {
+	PVs              int `json:"pvs"`
+	PVCs             int `json:"pvcs"`
+	K8sSnapshots     int `json:"k8s_snapshots"`
+	TrueNASSnapshots int `json:"truenas_snapshots"`
+}
+
+// SummaryOrphans counts the orphans a scan found.
+type SummaryOrphans struct {
+	PVs              int `json:"pvs"`
+	PVCs             int `json:"pvcs"`
+	Snapshots        int `json:"snapshots"`
+	K8sSnapshots     int `json:"k8s_snapshots"`
+	TrueNASSnapshots int `json:"truenas_snapshots"`
+}
+
+// ScanStatus is the monitor's most recent scan with its per-phase
+// durations and item counts.
+type ScanStatus struct {
+	SchemaVersion        int                           `json:"schema_version"`
+	Timestamp            time.Time                     `json:"timestamp"`
+	ScanTimestamp        time.Time                     `json:"scan_timestamp"`
+	ScanDuration         time.Duration                 `json:"scan_duration"`
+	Partial              bool                          `json:"partial"`
+	Stale                bool                          `json:"stale"`
+	PhaseErrors          map[string]string             `json:"phase_errors"`
+	Phases               map[string]monitor.PhaseStats `json:"phases"`
+	Inventory            *orphan.InventoryCounts       `json:"inventory"`
+	Degraded             bool                          `json:"degraded"`
+	Scope                *analysis.ScopeReport         `json:"scope"`
+	SnapshotCorrelatedAt map[string]time.Time          `json:"snapshot_correlated_at"`
+	StuckResources       *monitor.StuckResources       `json:"stuck_resources"`
+	PhaseTransitions     []analysis.PVPhaseTransition  `json:"phase_transitions"`
+	FlappingVolumes      []analysis.FlappingVolume     `json:"flapping_volumes"`
+}
+
+// ScanDiff is the diff between the monitor's two most recent scans.
+type ScanDiff struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Timestamp     time.Time            `json:"timestamp"`
+	ScanTimestamp time.Time            `json:"scan_timestamp"`
+	Changes       *monitor.ScanChanges `json:"changes"`
+	Diff          *monitor.ScanDiff    `json:"diff"`
+	Warnings      []string             `json:"warnings"`
+}
+
+func buildSummaryReport(schemaVersion int, state *monitor.ScanState) SummaryReport {
+	result := state.Result
+	return SummaryReport{
+		SchemaVersion:            schemaVersion,
+		Timestamp:                time.Now().UTC(),
+		ScanTimestamp:            result.Timestamp,
+		Partial:                  result.Partial,
+		Stale:                    result.Stale,
+		UnreadableNamespaces:     result.UnreadableNamespaces,
+		NamespaceCoveragePercent: result.NamespaceCoveragePercent,
+		Totals: SummaryTotals{
+			PVs:              result.TotalPVs,
+			PVCs:             result.TotalPVCs,
+			K8sSnapshots:     result.TotalK8sSnapshots,
+			TrueNASSnapshots: result.TotalTrueNASSnapshots,
+		},
+		Orphans: SummaryOrphans{
+			PVs:              len(result.OrphanedPVs),
+			PVCs:             len(result.OrphanedPVCs),
+			Snapshots:        len(result.OrphanedSnapshots),
+			K8sSnapshots:     result.OrphanedK8sSnapshots,
+			TrueNASSnapshots: result.OrphanedTrueNASSnapshots,
+		},
+		Pools:               result.Pools,
+		StorageEfficiency:   result.StorageEfficiency,
+		ProvisioningLatency: result.ProvisioningLatency,
+		AbandonedDatasets:   result.AbandonedDatasets,
+		ByStorageClass:      result.StorageClasses,
+	}
+}
+
+func buildScanStatus(schemaVersion int, state *monitor.ScanState) ScanStatus {
+	result := state.Result
+	return ScanStatus{
+		SchemaVersion:        schemaVersion,
+		Timestamp:            time.Now().UTC(),
+		ScanTimestamp:        result.Timestamp,
+		ScanDuration:         result.ScanDuration,
+		Partial:              result.Partial,
+		Stale:                result.Stale,
+		PhaseErrors:          result.PhaseErrors,
+		Phases:               result.Phases,
+		Inventory:            result.Inventory,
+		Degraded:             result.Degraded,
+		Scope:                result.Scope,
+		SnapshotCorrelatedAt: result.SnapshotCorrelatedAt,
+		StuckResources:       result.StuckResources,
+		PhaseTransitions:     result.PhaseTransitions,
+		FlappingVolumes:      result.FlappingVolumes,
+	}
+}
+
+func buildScanDiff(schemaVersion int, state *monitor.ScanState) ScanDiff {
+	warnings := []string{}
+	if state.Diff != nil && state.Diff.ConfigDrift != nil {
+		drift := state.Diff.ConfigDrift
+		warnings = append(warnings, fmt.Sprintf("the scans ran under different configurations (%s, then %s); changes may come from the settings rather than the cluster",
+			drift.PreviousHash, drift.Hash))
+	}
+	return ScanDiff{
+		SchemaVersion: schemaVersion,
+		Timestamp:     time.Now().UTC(),
+		ScanTimestamp: state.Result.Timestamp,
+		Changes:       state.Result.Changes,
+		Diff:          state.Diff,
+		Warnings:      warnings,
+	}
+}
+
+// scanDocumentV2 serves the typed document build makes of the monitor's
+// most recent scan.
+func scanDocumentV2[T any](s *Server, name string, build func(int, *monitor.ScanState) T) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schemaVersion, ok := negotiateSchema(c, name)
+		if !ok {
+			return
+		}
+		state, ok := s.readScanState(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, build(schemaVersion, state))
+	}
+}
+
+// setupV2Routes registers the /api/v2 routes on router and returns their
+// paths, which deprecationMiddleware links v1 responses to.
+func (s *Server) setupV2Routes(router *gin.Engine, read, report gin.HandlerFunc) map[string]bool {
+	v2 := router.Group("/api/v2", bodyLimitMiddleware(s.limits.MaxBodyBytes))
+	v2.GET("/reports/summary", report, scanDocumentV2(s, schemas.SummaryReport, buildSummaryReport))
+	v2.GET("/scan/diff", read, scanDocumentV2(s, schemas.ScanDiff, buildScanDiff))
+	v2.GET("/status", read, scanDocumentV2(s, schemas.ScanStatus, buildScanStatus))
+
+	paths := map[string]bool{}
+	for _, route := range router.Routes() {
+		if strings.HasPrefix(route.Path, "/api/v2/") {
+			paths[route.Path] = true
+		}
+	}
+	return paths
+}
+
+// V1Deprecation announces the retirement of /api/v1 in the headers of its
+// responses. Zero times send no Deprecation or Sunset header.
+type V1Deprecation struct {
+	// DeprecatedAt is sent as the Deprecation header (RFC 9745).
+	DeprecatedAt time.Time
+	// SunsetAt is sent as the Sunset header (RFC 8594): when v1 stops
+	// being served.
+	SunsetAt time.Time
+	// Link documents the migration, sent as a Link with rel="deprecation".
+	Link string
+}
+
+// deprecationMiddleware adds the v1 deprecation headers and, for routes
+// with a /api/v2 counterpart in v2Paths, a Link to it with
+// rel="successor-version".
+func deprecationMiddleware(deprecation V1Deprecation, v2Paths map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !deprecation.DeprecatedAt.IsZero() {
+			c.Header("Deprecation", fmt.Sprintf("@%d", deprecation.DeprecatedAt.Unix()))
+		}
+		if !deprecation.SunsetAt.IsZero() {
+			c.Header("Sunset", deprecation.SunsetAt.UTC().Format(http.TimeFormat))
+		}
+		if deprecation.Link != "" {
+			c.Writer.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", deprecation.Link))
+		}
+		if path, ok := strings.CutPrefix(c.FullPath(), "/api/v1/"); ok && v2Paths["/api/v2/"+path] {
+			c.Writer.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", "/api/v2/"+path))
+		}
+		c.Next()
+	}
+}
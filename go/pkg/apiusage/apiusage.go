@@ -0,0 +1,78 @@
+// Package apiusage counts the requests the backend clients send on behalf
+// of one scan. A Counter travels in the request context, so the clients
+// count without knowing about scans and unrelated requests are not counted.
+package apiusage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Backends counted by the clients.
+const (
+	BackendKubernetes = "kubernetes"
+	BackendTrueNAS    = "truenas"
+)
+
+// Counter counts requests by backend. A child counter also counts into
+// its parent.
+type Counter struct {
+	parent *Counter
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying a new counter, which also counts into the
+// counter ctx already carries.
+func NewContext(ctx context.Context) (context.Context, *Counter) {
+	counter := &Counter{parent: FromContext(ctx), counts: make(map[string]int64)}
+	return context.WithValue(ctx, contextKey{}, counter), counter
+}
+
+// FromContext returns the counter ctx carries, or nil.
+func FromContext(ctx context.Context) *Counter {
+	counter, _ := ctx.Value(contextKey{}).(*Counter)
+	return counter
+}
+
+// Add counts one request to backend on the counter ctx carries, if any.
+func Add(ctx context.Context, backend string) {
+	for counter := FromContext(ctx); counter != nil; counter = counter.parent {
+		counter.mu.Lock()
+		counter.counts[backend]++
+		counter.mu.Unlock()
+	}
+}
+
+// Counts returns the requests counted so far by backend. A nil counter has
+// counted none.
+func (c *Counter) Counts() map[string]int64 {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for backend, count := range c.counts {
+		counts[backend] = count
+	}
+	return counts
+}
+
+// Transport counts each request it sends to backend on the counter of the
+// request context.
+func Transport(backend string, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		Add(req.Context(), backend)
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,50 @@
+package apiusage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewContext_childCountsIntoParent(t *testing.T) {
+	ctx, scan := NewContext(context.Background())
+	phaseCtx, phase := NewContext(ctx)
+
+	Add(phaseCtx, BackendTrueNAS)
+	Add(ctx, BackendKubernetes)
+	Add(context.Background(), BackendKubernetes)
+
+	if got := phase.Counts(); len(got) != 1 || got[BackendTrueNAS] != 1 {
+		t.Fatalf("phase counts = %v, want one TrueNAS request", got)
+	}
+	if got := scan.Counts(); got[BackendTrueNAS] != 1 || got[BackendKubernetes] != 1 {
+		t.Fatalf("scan counts = %v, want one request per backend", got)
+	}
+	if got := FromContext(context.Background()).Counts(); got != nil {
+		t.Fatalf("counts without a counter = %v, want nil", got)
+	}
+}
+
+func TestTransport_countsEachRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{Transport: Transport(BackendKubernetes, http.DefaultTransport)}
+
+	ctx, counter := NewContext(context.Background())
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if got := counter.Counts()[BackendKubernetes]; got != 3 {
+		t.Fatalf("kubernetes requests = %d, want 3", got)
+	}
+}
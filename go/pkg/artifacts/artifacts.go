@@ -0,0 +1,364 @@
+// Package artifacts keeps generated report files on disk for download and
+// prunes them by age and total size. Downloads hold a reference on their
+// file, and the janitor never removes a file that is being streamed.
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// Default retention settings.
+const (
+	DefaultRetention = 7 * 24 * time.Hour
+	DefaultMaxBytes  = 1 << 30
+)
+
+// janitorInterval is how often the store prunes artifacts.
+const janitorInterval = 10 * time.Minute
+
+// tempPrefix marks files still being written; they are not artifacts.
+const tempPrefix = ".tmp-"
+
+// ErrNotFound is returned by Open for a name that is not an artifact.
+var ErrNotFound = errors.New("artifact not found")
+
+// Options configure a Store.
+type Options struct {
+	// Dir holds the artifacts, typically on a PVC.
+	Dir string
+	// Retention is how long an artifact is kept.
+	Retention time.Duration
+	// MaxBytes caps the total size of the artifacts; the oldest are
+	// pruned first.
+	MaxBytes int64
+}
+
+func (o Options) withDefaults() Options {
+	if o.Retention <= 0 {
+		o.Retention = DefaultRetention
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultMaxBytes
+	}
+	return o
+}
+
+// Config configures a Store.
+type Config struct {
+	Options
+	Clock  clock.Clock
+	Logger *logging.Logger
+	// OnPruned, when set, is called with the number of artifacts each
+	// pruning removed.
+	OnPruned func(n int)
+	// OnBytes, when set, is called with the total size of the artifacts
+	// after each change.
+	OnBytes func(bytes int64)
+}
+
+// Artifact is one stored file.
+type Artifact struct {
+	Name      string    `json:"name"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store writes, lists and serves artifacts and prunes them every
+// janitorInterval until Close.
+type Store struct {
+	opts     Options
+	clock    clock.Clock
+	logger   *logging.Logger
+	onPruned func(n int)
+	onBytes  func(bytes int64)
+
+	// mu guards refs, and is held while pruning so a download cannot
+	// start on a file being removed.
+	mu   sync.Mutex
+	refs map[string]int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates the directory, removes files left half-written by a previous
+// process and starts the janitor.
+func New(config Config) (*Store, error) {
+	opts := config.Options.withDefaults()
+	if opts.Dir == "" {
+		return nil, errors.New("the artifact store needs a directory")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	temps, _ := filepath.Glob(filepath.Join(opts.Dir, tempPrefix+"*"))
+	for _, temp := range temps {
+		os.Remove(temp)
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Store{
+		opts:     opts,
+		clock:    clock.OrReal(config.Clock),
+		logger:   logger,
+		onPruned: config.OnPruned,
+		onBytes:  config.OnBytes,
+		refs:     make(map[string]int),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.Prune()
+	s.wg.Add(1)
+	go s.runJanitor()
+	return s, nil
+}
+
+// Options returns the effective options.
+func (s *Store) Options() Options {
+	return s.opts
+}
+
+// Create stores what write produces as a new artifact named
+// <kind>-<timestamp>-<id>.<ext>. The file only appears under its name once
+// complete, so a listing or download never sees part of it.
+func (s *Store) Create(kind, ext string, write func(w io.Writer) error) (Artifact, error) {
+	tmp, err := os.CreateTemp(s.opts.Dir, tempPrefix+"*")
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return Artifact{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return Artifact{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Artifact{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+
+	now := s.clock.Now().UTC()
+	name := fmt.Sprintf("%s-%s-%s.%s", kind, now.Format("20060102T150405Z"), uuid.NewString()[:8], ext)
+	path := filepath.Join(s.opts.Dir, name)
+	if err := os.Chtimes(tmp.Name(), now, now); err != nil {
+		return Artifact{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Artifact{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	s.reportBytes()
+	return Artifact{Name: name, SizeBytes: info.Size(), CreatedAt: now}, nil
+}
+
+// List returns the artifacts, newest first.
+func (s *Store) List() ([]Artifact, error) {
+	artifacts, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		if !artifacts[i].CreatedAt.Equal(artifacts[j].CreatedAt) {
+			return artifacts[i].CreatedAt.After(artifacts[j].CreatedAt)
+		}
+		return artifacts[i].Name > artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+// Download is an open artifact. It holds a reference that keeps the janitor
+// from removing the file until Close.
+type Download struct {
+	*os.File
+	Artifact
+	release func()
+}
+
+// Close closes the file and drops the reference.
+func (d *Download) Close() error {
+	err := d.File.Close()
+	d.release()
+	return err
+}
+
+// Open opens the artifact name for reading; it returns ErrNotFound for a
+// name that is not a stored artifact.
+func (s *Store) Open(name string) (*Download, error) {
+	if !validName(name) {
+		return nil, ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(filepath.Join(s.opts.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	s.refs[name]++
+	var once sync.Once
+	return &Download{
+		File:     file,
+		Artifact: Artifact{Name: name, SizeBytes: info.Size(), CreatedAt: info.ModTime().UTC()},
+		release: func() {
+			once.Do(func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				if s.refs[name]--; s.refs[name] <= 0 {
+					delete(s.refs, name)
+				}
+			})
+		},
+	}, nil
+}
+
+// Prune removes the artifacts older than Retention, then the oldest ones
+// while the total exceeds MaxBytes, and returns how many it removed.
+// Artifacts being downloaded are skipped, and still count toward the cap.
+func (s *Store) Prune() int {
+	s.mu.Lock()
+	artifacts, err := s.scan()
+	if err != nil {
+		s.mu.Unlock()
+		s.logger.Warn("Failed to list report artifacts", zap.Error(err))
+		return 0
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].CreatedAt.Before(artifacts[j].CreatedAt) })
+
+	now := s.clock.Now()
+	var total int64
+	for _, artifact := range artifacts {
+		total += artifact.SizeBytes
+	}
+	var pruned, inUse []string
+	for _, artifact := range artifacts {
+		expired := now.Sub(artifact.CreatedAt) > s.opts.Retention
+		if !expired && total <= s.opts.MaxBytes {
+			continue
+		}
+		if s.refs[artifact.Name] > 0 {
+			inUse = append(inUse, artifact.Name)
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.opts.Dir, artifact.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn("Failed to prune report artifact", zap.String("name", artifact.Name), zap.Error(err))
+			continue
+		}
+		total -= artifact.SizeBytes
+		pruned = append(pruned, artifact.Name)
+	}
+	s.mu.Unlock()
+
+	if s.onBytes != nil {
+		s.onBytes(total)
+	}
+	if len(inUse) > 0 {
+		s.logger.Info("Kept report artifacts due for pruning while they are downloaded", zap.Strings("names", inUse))
+	}
+	if len(pruned) == 0 {
+		return 0
+	}
+	s.logger.Info("Pruned report artifacts",
+		zap.Strings("names", pruned),
+		zap.Duration("retention", s.opts.Retention),
+		zap.Int64("max_bytes", s.opts.MaxBytes),
+		zap.Int64("total_bytes", total))
+	if s.onPruned != nil {
+		s.onPruned(len(pruned))
+	}
+	return len(pruned)
+}
+
+// Close stops the janitor.
+func (s *Store) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// runJanitor prunes every janitorInterval until Close.
+func (s *Store) runJanitor() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.Prune()
+		}
+	}
+}
+
+// reportBytes passes the total size of the artifacts to OnBytes.
+func (s *Store) reportBytes() {
+	if s.onBytes == nil {
+		return
+	}
+	artifacts, err := s.scan()
+	if err != nil {
+		return
+	}
+	var total int64
+	for _, artifact := range artifacts {
+		total += artifact.SizeBytes
+	}
+	s.onBytes(total)
+}
+
+// scan lists the artifact files of the directory.
+func (s *Store) scan() ([]Artifact, error) {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	artifacts := make([]Artifact, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !validName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Name: entry.Name(), SizeBytes: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	return artifacts, nil
+}
+
+// validName reports whether name can be an artifact: a plain file name that
+// is not hidden, so neither temporary files nor paths outside the
+// directory are served.
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
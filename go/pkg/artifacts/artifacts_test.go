@@ -0,0 +1,128 @@
+package artifacts
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+func newTestStore(t *testing.T, opts Options, fake *clock.Fake) (*Store, *int, *int64) {
+	t.Helper()
+	pruned, bytes := new(int), new(int64)
+	opts.Dir = t.TempDir()
+	s, err := New(Config{
+		Options:  opts,
+		Clock:    fake,
+		OnPruned: func(n int) { *pruned += n },
+		OnBytes:  func(b int64) { *bytes = b },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s, pruned, bytes
+}
+
+func create(t *testing.T, s *Store, body string) Artifact {
+	t.Helper()
+	artifact, err := s.Create("detailed", "html", func(w io.Writer) error {
+		_, err := io.WriteString(w, body)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return artifact
+}
+
+func TestStore_CreateListOpen(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	s, _, bytes := newTestStore(t, Options{}, fake)
+
+	first := create(t, s, "first")
+	fake.Advance(time.Minute)
+	second := create(t, s, "second!")
+	if !strings.HasPrefix(first.Name, "detailed-20260601T120000Z-") || !strings.HasSuffix(first.Name, ".html") {
+		t.Fatalf("name = %s", first.Name)
+	}
+	if *bytes != 12 {
+		t.Fatalf("artifact bytes = %d, want 12", *bytes)
+	}
+
+	// A file being written is not listed.
+	if err := os.WriteFile(filepath.Join(s.opts.Dir, tempPrefix+"partial"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List()
+	if err != nil || len(list) != 2 || list[0].Name != second.Name || list[1].SizeBytes != 5 {
+		t.Fatalf("List = %+v, %v, want second then first", list, err)
+	}
+
+	download, err := s.Open(second.Name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	body, _ := io.ReadAll(download)
+	download.Close()
+	if string(body) != "second!" {
+		t.Fatalf("downloaded %q", body)
+	}
+	for _, name := range []string{"../etc/passwd", tempPrefix + "partial", "missing.html"} {
+		if _, err := s.Open(name); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Open(%q) = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestStore_PrunesByAgeThenSize(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	s, pruned, bytes := newTestStore(t, Options{Retention: 24 * time.Hour, MaxBytes: 10}, fake)
+
+	expired := create(t, s, "aaaa")
+	fake.Advance(24*time.Hour + time.Second)
+	oldest := create(t, s, "bbbb")
+	fake.Advance(time.Minute)
+	middle := create(t, s, "cccc")
+	fake.Advance(time.Minute)
+	newest := create(t, s, "dddd")
+
+	// The expired artifact goes by age; the rest are 12 bytes, so the
+	// oldest goes by size.
+	if n := s.Prune(); n != 2 || *pruned != 2 || *bytes != 8 {
+		t.Fatalf("Prune = %d (counted %d), bytes = %d, want 2 and 8", n, *pruned, *bytes)
+	}
+	list, _ := s.List()
+	if len(list) != 2 || list[0].Name != newest.Name || list[1].Name != middle.Name {
+		t.Fatalf("left %+v, want %s and %s (pruned %s and %s)", list, newest.Name, middle.Name, expired.Name, oldest.Name)
+	}
+}
+
+func TestStore_KeepsArtifactsWhileDownloading(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	s, _, _ := newTestStore(t, Options{Retention: time.Hour}, fake)
+	artifact := create(t, s, "report")
+
+	download, err := s.Open(artifact.Name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	fake.Advance(2 * time.Hour)
+	if n := s.Prune(); n != 0 {
+		t.Fatalf("Prune removed %d artifacts during a download", n)
+	}
+	if body, _ := io.ReadAll(download); string(body) != "report" {
+		t.Fatalf("downloaded %q", body)
+	}
+	download.Close()
+	download.Close()
+
+	if n := s.Prune(); n != 1 {
+		t.Fatalf("Prune after the download = %d, want 1", n)
+	}
+}
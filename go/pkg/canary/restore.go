@@ -0,0 +1,186 @@
+// Package canary runs the restore canary: a periodic snapshot, clone,
+// verify and destroy cycle on a test dataset that proves TrueNAS snapshots
+// can actually be restored.
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// AlertCategory is the alert category of a failed restore canary.
+const AlertCategory = "restore_canary"
+
+// DefaultInterval is how often the canary runs when no interval is set.
+const DefaultInterval = 24 * time.Hour
+
+// Canary steps, in the order they run.
+const (
+	// StepPreflight checks that the test dataset exists and backs no PV.
+	StepPreflight       = "preflight"
+	StepSnapshot        = "snapshot"
+	StepClone           = "clone"
+	StepVerify          = "verify"
+	StepDestroyClone    = "destroy_clone"
+	StepDestroySnapshot = "destroy_snapshot"
+)
+
+// ErrProtectedDataset is returned by the preflight step for a dataset that
+// backs a PersistentVolume and is not allow-listed.
+var ErrProtectedDataset = errors.New("dataset backs a PersistentVolume")
+
+// Options selects the canary's test dataset.
+type Options struct {
+	// Dataset is snapshotted and cloned; the clone is created next to it.
+	Dataset string
+	// AllowedDatasets may be used even though they back a PV. Production
+	// PVC datasets are refused unless listed here.
+	AllowedDatasets []string
+}
+
+// StepResult is the outcome of one canary step.
+type StepResult struct {
+	Step     string        `json:"step"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Result is the outcome of one canary run.
+type Result struct {
+	Dataset   string    `json:"dataset"`
+	Snapshot  string    `json:"snapshot,omitempty"`
+	Clone     string    `json:"clone,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// Duration is the time of the whole run, cleanup included.
+	Duration time.Duration `json:"duration"`
+	Success  bool          `json:"success"`
+	// FailedStep is the first step that failed; cleanup steps run and are
+	// recorded after it.
+	FailedStep string       `json:"failed_step,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Steps      []StepResult `json:"steps"`
+}
+
+// Run performs one canary cycle: it snapshots the test dataset, clones the
+// snapshot, verifies the clone is mounted with readable stats, and destroys
+// the clone and the snapshot. Cleanup runs even when an earlier step
+// failed, so a failed run leaves nothing behind unless cleanup fails too.
+func Run(ctx context.Context, truenasClient truenas.Client, k8sClient k8s.Client, options Options, now time.Time) *Result {
+	suffix := "restore-canary-" + strconv.FormatInt(now.Unix(), 10)
+	result := &Result{Dataset: options.Dataset, StartedAt: now, Steps: []StepResult{}}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	step := func(name string, fn func() error) bool {
+		stepStart := time.Now()
+		err := fn()
+		stepResult := StepResult{Step: name, Duration: time.Since(stepStart)}
+		if err != nil {
+			stepResult.Error = err.Error()
+			if result.FailedStep == "" {
+				result.FailedStep = name
+				result.Error = err.Error()
+			}
+		}
+		result.Steps = append(result.Steps, stepResult)
+		return err == nil
+	}
+
+	if !step(StepPreflight, func() error { return preflight(ctx, truenasClient, k8sClient, options) }) {
+		return result
+	}
+
+	snapshot := options.Dataset + "@" + suffix
+	if !step(StepSnapshot, func() error {
+		created, err := truenasClient.CreateSnapshot(ctx, options.Dataset, suffix)
+		if err == nil && created.Name != "" && strings.Contains(created.Name, "@") {
+			snapshot = created.Name
+		}
+		return err
+	}) {
+		return result
+	}
+	result.Snapshot = snapshot
+
+	clone := options.Dataset + "-" + suffix
+	cloned := step(StepClone, func() error { return truenasClient.CloneSnapshot(ctx, snapshot, clone) })
+	if cloned {
+		result.Clone = clone
+		step(StepVerify, func() error { return verifyClone(ctx, truenasClient, clone) })
+		step(StepDestroyClone, func() error { return truenasClient.DeleteDataset(ctx, clone) })
+	}
+	step(StepDestroySnapshot, func() error {
+		return truenasClient.DeleteSnapshot(ctx, snapshot, truenas.DeleteSnapshotOptions{})
+	})
+
+	result.Success = result.FailedStep == ""
+	return result
+}
+
+// preflight checks that the dataset exists and backs no PV unless it is
+// allow-listed.
+func preflight(ctx context.Context, truenasClient truenas.Client, k8sClient k8s.Client, options Options) error {
+	if _, err := truenasClient.GetDataset(ctx, options.Dataset); err != nil {
+		return err
+	}
+	for _, allowed := range options.AllowedDatasets {
+		if allowed == options.Dataset {
+			return nil
+		}
+	}
+	pvs, err := k8sClient.ListPersistentVolumes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list PVs to protect their datasets: %w", err)
+	}
+	for _, pv := range pvs {
+		if backsPV(pv, options.Dataset) {
+			return fmt.Errorf("%w: %s backs %s; add it to allowed_datasets to use it anyway", ErrProtectedDataset, options.Dataset, pv.Name)
+		}
+	}
+	return nil
+}
+
+// backsPV reports whether dataset is the dataset of pv: its CSI volume
+// handle names it, its last path component is the PV name, or the PV's NFS
+// export is its mountpoint.
+func backsPV(pv corev1.PersistentVolume, dataset string) bool {
+	if path.Base(dataset) == pv.Name {
+		return true
+	}
+	if csi := pv.Spec.CSI; csi != nil && csi.VolumeHandle != "" {
+		handle := strings.Trim(csi.VolumeHandle, "/")
+		if handle == dataset || strings.HasSuffix(dataset, "/"+handle) {
+			return true
+		}
+	}
+	if nfs := pv.Spec.NFS; nfs != nil && strings.Trim(nfs.Path, "/") == "mnt/"+dataset {
+		return true
+	}
+	return false
+}
+
+// verifyClone checks that the clone exists, that a filesystem clone is
+// mounted and that its space stats are readable.
+func verifyClone(ctx context.Context, truenasClient truenas.Client, clone string) error {
+	volume, err := truenasClient.GetDataset(ctx, clone)
+	if err != nil {
+		return err
+	}
+	if volume.Type != truenas.VolumeTypeZvol && volume.Path == "" {
+		return fmt.Errorf("clone %s is not mounted", clone)
+	}
+	if volume.Available <= 0 {
+		return fmt.Errorf("clone %s reports no available space", clone)
+	}
+	return nil
+}
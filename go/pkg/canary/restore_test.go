@@ -0,0 +1,106 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+var canaryNow = time.Unix(1700000000, 0).UTC()
+
+func canaryPV(name, handle string) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: handle},
+			},
+		},
+	}
+}
+
+func methods(mutations []truenastest.Mutation) []string {
+	out := make([]string, 0, len(mutations))
+	for _, mutation := range mutations {
+		out = append(out, mutation.Method+" "+mutation.Name)
+	}
+	return out
+}
+
+func TestRun_SnapshotCloneVerifyDestroy(t *testing.T) {
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{ID: "tank/canary", Name: "tank/canary", Path: "/mnt/tank/canary", Type: truenas.VolumeTypeFilesystem, Available: 1 << 30}},
+	}
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{canaryPV("pvc-a", "pvc-a")}}
+
+	result := Run(context.Background(), truenasClient, k8sClient, Options{Dataset: "tank/canary"}, canaryNow)
+	if !result.Success || result.FailedStep != "" {
+		t.Fatalf("canary failed: %+v", result)
+	}
+	want := []string{
+		"CreateSnapshot tank/canary@restore-canary-1700000000",
+		"CloneSnapshot tank/canary-restore-canary-1700000000",
+		"DeleteDataset tank/canary-restore-canary-1700000000",
+		"DeleteSnapshot tank/canary@restore-canary-1700000000",
+	}
+	if got := methods(truenasClient.Mutations()); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("mutations = %v, want %v", got, want)
+	}
+	var steps []string
+	for _, step := range result.Steps {
+		steps = append(steps, step.Step)
+	}
+	if len(steps) != 6 || steps[0] != StepPreflight || steps[3] != StepVerify || steps[5] != StepDestroySnapshot {
+		t.Fatalf("steps = %v", steps)
+	}
+	if len(truenasClient.Volumes) != 1 || len(truenasClient.Snapshots) != 0 {
+		t.Fatalf("canary left resources behind: volumes %+v, snapshots %+v", truenasClient.Volumes, truenasClient.Snapshots)
+	}
+}
+
+func TestRun_CloneFailureStillDestroysSnapshot(t *testing.T) {
+	truenasClient := &truenastest.Client{
+		Volumes:          []truenas.Volume{{ID: "tank/canary", Name: "tank/canary", Available: 1 << 30}},
+		CloneSnapshotErr: errors.New("[EFAULT] pool is out of space"),
+	}
+
+	result := Run(context.Background(), truenasClient, &k8stest.Client{}, Options{Dataset: "tank/canary"}, canaryNow)
+	if result.Success || result.FailedStep != StepClone || result.Error != "[EFAULT] pool is out of space" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	last := result.Steps[len(result.Steps)-1]
+	if last.Step != StepDestroySnapshot || last.Error != "" {
+		t.Fatalf("snapshot was not cleaned up: %+v", result.Steps)
+	}
+	if len(truenasClient.Snapshots) != 0 {
+		t.Fatalf("snapshots left: %+v", truenasClient.Snapshots)
+	}
+}
+
+func TestRun_RefusesPVDatasetsUnlessAllowed(t *testing.T) {
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a", Path: "/mnt/tank/k8s/pvc-a", Available: 1 << 30}},
+	}
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{canaryPV("pvc-a", "pvc-a")}}
+
+	result := Run(context.Background(), truenasClient, k8sClient, Options{Dataset: "tank/k8s/pvc-a"}, canaryNow)
+	if result.Success || result.FailedStep != StepPreflight {
+		t.Fatalf("PV dataset should be refused: %+v", result)
+	}
+	if len(truenasClient.Mutations()) != 0 {
+		t.Fatalf("refused canary must not write: %+v", truenasClient.Mutations())
+	}
+
+	result = Run(context.Background(), truenasClient, k8sClient, Options{Dataset: "tank/k8s/pvc-a", AllowedDatasets: []string{"tank/k8s/pvc-a"}}, canaryNow)
+	if !result.Success {
+		t.Fatalf("allow-listed dataset should pass: %+v", result)
+	}
+}
@@ -0,0 +1,155 @@
+// Package chaos wraps Kubernetes and TrueNAS clients to fail calls on a
+// seeded schedule, for tests of how scans degrade when backends are flaky.
+// The same seed injects the same faults into the same calls.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// Fault is a failure injected into one call.
+type Fault string
+
+// Faults a Rule injects.
+const (
+	// FaultError fails the call as a 500 response would.
+	FaultError Fault = "error"
+	// FaultUnavailable fails the call as TrueNAS does during maintenance
+	// (503) or the apiserver when overloaded.
+	FaultUnavailable Fault = "unavailable"
+	// FaultHang blocks the call until its context is done, as a page the
+	// apiserver never answers. The caller must bound the context, e.g.
+	// with a phase timeout.
+	FaultHang Fault = "hang"
+	// FaultTruncate cuts a list in half mid-stream: the call returns the
+	// first half with an error wrapping io.ErrUnexpectedEOF. Calls that do
+	// not return a list fail with the error alone.
+	FaultTruncate Fault = "truncate"
+)
+
+// ErrInjected is wrapped by the errors of FaultError and FaultTruncate.
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Rule fails calls of Method, or of every wrapped method when Method is
+// empty, with Fault. A call fails when its 1-based number among the calls
+// Rule matches is in Calls, or otherwise with probability Rate.
+type Rule struct {
+	Method string
+	Fault  Fault
+	Rate   float64
+	Calls  []int
+}
+
+// Injection records a fault injected into a call.
+type Injection struct {
+	Method string
+	// Call is the 1-based number of the call among the calls of Method.
+	Call  int
+	Fault Fault
+}
+
+// Schedule decides which calls fail. The first matching rule that fires
+// wins. It is safe for concurrent use; concurrent calls draw from the
+// seeded source in the order they arrive.
+type Schedule struct {
+	mu        sync.Mutex
+	rand      *rand.Rand
+	rules     []Rule
+	calls     map[string]int
+	ruleCalls []int
+	injected  []Injection
+}
+
+// NewSchedule returns a schedule applying rules with randomness from seed.
+func NewSchedule(seed int64, rules ...Rule) *Schedule {
+	return &Schedule{
+		rand:      rand.New(rand.NewSource(seed)),
+		rules:     rules,
+		calls:     make(map[string]int),
+		ruleCalls: make([]int, len(rules)),
+	}
+}
+
+// Injected returns the faults injected so far, in call order.
+func (s *Schedule) Injected() []Injection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Injection(nil), s.injected...)
+}
+
+// Calls returns how many calls of method the wrappers saw.
+func (s *Schedule) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// next returns the fault for the next call of method, or "" for none.
+func (s *Schedule) next(method string) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+	var fault Fault
+	for i, rule := range s.rules {
+		if rule.Method != "" && rule.Method != method {
+			continue
+		}
+		s.ruleCalls[i]++
+		// Every matching rule draws, so adding a rule does not shift
+		// the draws of the rules before it.
+		fires := s.rand.Float64() < rule.Rate
+		for _, call := range rule.Calls {
+			fires = fires || call == s.ruleCalls[i]
+		}
+		if fires && fault == "" {
+			fault = rule.Fault
+		}
+	}
+	if fault != "" {
+		s.injected = append(s.injected, Injection{Method: method, Call: s.calls[method], Fault: fault})
+	}
+	return fault
+}
+
+// list calls fn unless the schedule fails the call. unavailable builds the
+// backend's error for FaultUnavailable and failure the one for FaultError.
+func list[T any](ctx context.Context, s *Schedule, method string, failure, unavailable func(method string) error, fn func(context.Context) ([]T, error)) ([]T, error) {
+	switch s.next(method) {
+	case FaultError:
+		return nil, failure(method)
+	case FaultUnavailable:
+		return nil, unavailable(method)
+	case FaultHang:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case FaultTruncate:
+		items, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return items[:len(items)/2], fmt.Errorf("%s: %w: %w", method, ErrInjected, io.ErrUnexpectedEOF)
+	}
+	return fn(ctx)
+}
+
+// call is list for calls that do not return a list.
+func call[T any](ctx context.Context, s *Schedule, method string, failure, unavailable func(method string) error, fn func(context.Context) (T, error)) (T, error) {
+	var zero T
+	switch s.next(method) {
+	case FaultError:
+		return zero, failure(method)
+	case FaultUnavailable:
+		return zero, unavailable(method)
+	case FaultHang:
+		<-ctx.Done()
+		return zero, ctx.Err()
+	case FaultTruncate:
+		return zero, fmt.Errorf("%s: %w: %w", method, ErrInjected, io.ErrUnexpectedEOF)
+	}
+	return fn(ctx)
+}
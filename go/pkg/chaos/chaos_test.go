@@ -0,0 +1,102 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestSchedule_SameSeedInjectsSameFaults(t *testing.T) {
+	run := func(seed int64) []Injection {
+		schedule := NewSchedule(seed, Rule{Fault: FaultError, Rate: 0.2})
+		client := NewTrueNASClient(&truenastest.Client{}, schedule)
+		for i := 0; i < 100; i++ {
+			_, _ = client.ListVolumes(context.Background())
+			_, _ = client.ListSnapshots(context.Background())
+		}
+		return schedule.Injected()
+	}
+
+	first := run(42)
+	if len(first) == 0 || len(first) > 80 {
+		t.Fatalf("injected %d faults into 200 calls at rate 0.2", len(first))
+	}
+	if again := run(42); !reflect.DeepEqual(first, again) {
+		t.Fatalf("same seed injected %v, then %v", first, again)
+	}
+	if other := run(43); reflect.DeepEqual(first, other) {
+		t.Fatal("different seeds injected the same faults")
+	}
+}
+
+func TestSchedule_FailsNumberedCallsOfMethod(t *testing.T) {
+	schedule := NewSchedule(1, Rule{Method: "ListSnapshots", Fault: FaultError, Calls: []int{2}})
+	client := NewTrueNASClient(&truenastest.Client{}, schedule)
+
+	for i := 1; i <= 3; i++ {
+		if _, err := client.ListVolumes(context.Background()); err != nil {
+			t.Fatalf("ListVolumes call %d: %v", i, err)
+		}
+		_, err := client.ListSnapshots(context.Background())
+		if (err != nil) != (i == 2) {
+			t.Fatalf("ListSnapshots call %d error = %v, want a failure of call 2 only", i, err)
+		}
+		if err != nil && !errors.Is(err, ErrInjected) {
+			t.Fatalf("error %v does not wrap ErrInjected", err)
+		}
+	}
+	want := []Injection{{Method: "ListSnapshots", Call: 2, Fault: FaultError}}
+	if got := schedule.Injected(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Injected() = %v, want %v", got, want)
+	}
+}
+
+func TestTrueNASClient_Faults(t *testing.T) {
+	snapshots := []truenas.Snapshot{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+
+	unavailable := NewTrueNASClient(&truenastest.Client{Snapshots: snapshots}, NewSchedule(1, Rule{Fault: FaultUnavailable, Rate: 1}))
+	if _, err := unavailable.ListSnapshots(context.Background()); err == nil {
+		t.Fatal("expected a 503")
+	} else if _, ok := truenas.IsUnavailable(err); !ok {
+		t.Fatalf("error %v is not a TrueNAS unavailable error", err)
+	}
+
+	truncated := NewTrueNASClient(&truenastest.Client{Snapshots: snapshots}, NewSchedule(1, Rule{Fault: FaultTruncate, Rate: 1}))
+	listed, err := truncated.ListSnapshots(context.Background())
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if len(listed) != 2 {
+		t.Fatalf("truncated list has %d snapshots, want 2", len(listed))
+	}
+}
+
+func TestK8sClient_Faults(t *testing.T) {
+	pvs := []corev1.PersistentVolume{{ObjectMeta: metav1.ObjectMeta{Name: "pv-1"}}}
+
+	failing := NewK8sClient(&k8stest.Client{PersistentVolumes: pvs}, NewSchedule(1, Rule{Method: "ListPersistentVolumes", Fault: FaultError, Rate: 1}))
+	if _, err := failing.ListPersistentVolumes(context.Background()); !apierrors.IsInternalError(err) {
+		t.Fatalf("error = %v, want an internal error", err)
+	}
+	if _, err := failing.ListNodes(context.Background()); err != nil {
+		t.Fatalf("ListNodes matched no rule but failed: %v", err)
+	}
+
+	hanging := NewK8sClient(&k8stest.Client{PersistentVolumes: pvs}, NewSchedule(1, Rule{Fault: FaultHang, Rate: 1}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := hanging.ListPersistentVolumes(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the context deadline", err)
+	}
+}
@@ -0,0 +1,111 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+)
+
+// K8sClient injects Schedule's faults into the read calls of a
+// k8s.Client. Other calls go straight to the wrapped client.
+type K8sClient struct {
+	k8s.Client
+	Schedule *Schedule
+}
+
+var _ k8s.Client = (*K8sClient)(nil)
+
+// NewK8sClient wraps client with schedule.
+func NewK8sClient(client k8s.Client, schedule *Schedule) *K8sClient {
+	return &K8sClient{Client: client, Schedule: schedule}
+}
+
+// k8sFailure is the apiserver's answer to a failed call.
+func k8sFailure(method string) error {
+	return apierrors.NewInternalError(fmt.Errorf("%s: %w", method, ErrInjected))
+}
+
+// k8sUnavailable is the apiserver's answer when it sheds load.
+func k8sUnavailable(method string) error {
+	return apierrors.NewServiceUnavailable(fmt.Sprintf("%s: %v", method, ErrInjected))
+}
+
+func k8sList[T any](ctx context.Context, c *K8sClient, method string, fn func(context.Context) ([]T, error)) ([]T, error) {
+	return list(ctx, c.Schedule, method, k8sFailure, k8sUnavailable, fn)
+}
+
+func (c *K8sClient) ListPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	return k8sList(ctx, c, "ListPersistentVolumes", c.Client.ListPersistentVolumes)
+}
+
+func (c *K8sClient) ListDemocraticCSIPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	return k8sList(ctx, c, "ListDemocraticCSIPersistentVolumes", c.Client.ListDemocraticCSIPersistentVolumes)
+}
+
+func (c *K8sClient) ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	return k8sList(ctx, c, "ListPersistentVolumeClaims", func(ctx context.Context) ([]corev1.PersistentVolumeClaim, error) {
+		return c.Client.ListPersistentVolumeClaims(ctx, namespace)
+	})
+}
+
+func (c *K8sClient) ListUnboundPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	return k8sList(ctx, c, "ListUnboundPersistentVolumeClaims", func(ctx context.Context) ([]corev1.PersistentVolumeClaim, error) {
+		return c.Client.ListUnboundPersistentVolumeClaims(ctx, namespace)
+	})
+}
+
+func (c *K8sClient) ListVolumeSnapshots(ctx context.Context, namespace string) ([]snapshotv1.VolumeSnapshot, error) {
+	return k8sList(ctx, c, "ListVolumeSnapshots", func(ctx context.Context) ([]snapshotv1.VolumeSnapshot, error) {
+		return c.Client.ListVolumeSnapshots(ctx, namespace)
+	})
+}
+
+func (c *K8sClient) ListVolumeSnapshotContents(ctx context.Context) ([]snapshotv1.VolumeSnapshotContent, error) {
+	return k8sList(ctx, c, "ListVolumeSnapshotContents", c.Client.ListVolumeSnapshotContents)
+}
+
+func (c *K8sClient) ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
+	return k8sList(ctx, c, "ListStorageClasses", c.Client.ListStorageClasses)
+}
+
+func (c *K8sClient) ListPods(ctx context.Context, namespace string) ([]corev1.Pod, error) {
+	return k8sList(ctx, c, "ListPods", func(ctx context.Context) ([]corev1.Pod, error) {
+		return c.Client.ListPods(ctx, namespace)
+	})
+}
+
+func (c *K8sClient) ListPersistentVolumeClaimEvents(ctx context.Context, namespace string) ([]corev1.Event, error) {
+	return k8sList(ctx, c, "ListPersistentVolumeClaimEvents", func(ctx context.Context) ([]corev1.Event, error) {
+		return c.Client.ListPersistentVolumeClaimEvents(ctx, namespace)
+	})
+}
+
+func (c *K8sClient) ListNamespaces(ctx context.Context) ([]corev1.Namespace, error) {
+	return k8sList(ctx, c, "ListNamespaces", c.Client.ListNamespaces)
+}
+
+func (c *K8sClient) ListVolumeAttachments(ctx context.Context) ([]storagev1.VolumeAttachment, error) {
+	return k8sList(ctx, c, "ListVolumeAttachments", c.Client.ListVolumeAttachments)
+}
+
+func (c *K8sClient) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	return k8sList(ctx, c, "ListNodes", c.Client.ListNodes)
+}
+
+func (c *K8sClient) GetCSIDriverPods(ctx context.Context, namespace string) ([]corev1.Pod, error) {
+	return k8sList(ctx, c, "GetCSIDriverPods", func(ctx context.Context) ([]corev1.Pod, error) {
+		return c.Client.GetCSIDriverPods(ctx, namespace)
+	})
+}
+
+func (c *K8sClient) CheckCSIDriverHealth(ctx context.Context, namespace string) (*k8s.CSIDriverHealth, error) {
+	return call(ctx, c.Schedule, "CheckCSIDriverHealth", k8sFailure, k8sUnavailable, func(ctx context.Context) (*k8s.CSIDriverHealth, error) {
+		return c.Client.CheckCSIDriverHealth(ctx, namespace)
+	})
+}
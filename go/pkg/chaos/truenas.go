@@ -0,0 +1,101 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// TrueNASClient injects Schedule's faults into the read calls of a
+// truenas.Client. Calls that change TrueNAS go straight to the wrapped
+// client.
+type TrueNASClient struct {
+	truenas.Client
+	Schedule *Schedule
+}
+
+var _ truenas.Client = (*TrueNASClient)(nil)
+
+// NewTrueNASClient wraps client with schedule.
+func NewTrueNASClient(client truenas.Client, schedule *Schedule) *TrueNASClient {
+	return &TrueNASClient{Client: client, Schedule: schedule}
+}
+
+// truenasFailure is the error the client returns for a 500 response.
+func truenasFailure(method string) error {
+	return fmt.Errorf("TrueNAS API returned status %d: %s: %w", http.StatusInternalServerError, method, ErrInjected)
+}
+
+// truenasUnavailable is the error the client returns for a 503 response.
+func truenasUnavailable(string) error {
+	return &truenas.UnavailableError{StatusCode: http.StatusServiceUnavailable}
+}
+
+func truenasList[T any](ctx context.Context, c *TrueNASClient, method string, fn func(context.Context) ([]T, error)) ([]T, error) {
+	return list(ctx, c.Schedule, method, truenasFailure, truenasUnavailable, fn)
+}
+
+func (c *TrueNASClient) ListVolumes(ctx context.Context) ([]truenas.Volume, error) {
+	return truenasList(ctx, c, "ListVolumes", c.Client.ListVolumes)
+}
+
+func (c *TrueNASClient) ListSnapshots(ctx context.Context) ([]truenas.Snapshot, error) {
+	return truenasList(ctx, c, "ListSnapshots", c.Client.ListSnapshots)
+}
+
+func (c *TrueNASClient) ListSnapshotsSince(ctx context.Context, since time.Time) ([]truenas.Snapshot, error) {
+	return truenasList(ctx, c, "ListSnapshotsSince", func(ctx context.Context) ([]truenas.Snapshot, error) {
+		return c.Client.ListSnapshotsSince(ctx, since)
+	})
+}
+
+func (c *TrueNASClient) ListPools(ctx context.Context) ([]truenas.Pool, error) {
+	return truenasList(ctx, c, "ListPools", c.Client.ListPools)
+}
+
+func (c *TrueNASClient) GetSMBShares(ctx context.Context) ([]truenas.SMBShare, error) {
+	return truenasList(ctx, c, "GetSMBShares", c.Client.GetSMBShares)
+}
+
+func (c *TrueNASClient) GetNFSShares(ctx context.Context) ([]truenas.NFSShare, error) {
+	return truenasList(ctx, c, "GetNFSShares", c.Client.GetNFSShares)
+}
+
+func (c *TrueNASClient) GetDataset(ctx context.Context, name string) (*truenas.Volume, error) {
+	return call(ctx, c.Schedule, "GetDataset", truenasFailure, truenasUnavailable, func(ctx context.Context) (*truenas.Volume, error) {
+		return c.Client.GetDataset(ctx, name)
+	})
+}
+
+func (c *TrueNASClient) ListAlerts(ctx context.Context) ([]truenas.Alert, error) {
+	return truenasList(ctx, c, "ListAlerts", c.Client.ListAlerts)
+}
+
+func (c *TrueNASClient) ListSnapshotTasks(ctx context.Context) ([]truenas.PeriodicSnapshotTask, error) {
+	return truenasList(ctx, c, "ListSnapshotTasks", c.Client.ListSnapshotTasks)
+}
+
+func (c *TrueNASClient) ListReplicationTasks(ctx context.Context) ([]truenas.ReplicationTask, error) {
+	return truenasList(ctx, c, "ListReplicationTasks", c.Client.ListReplicationTasks)
+}
+
+func (c *TrueNASClient) GetDatasetIOStats(ctx context.Context, datasets []string, window time.Duration) ([]truenas.DatasetIOStats, error) {
+	return truenasList(ctx, c, "GetDatasetIOStats", func(ctx context.Context) ([]truenas.DatasetIOStats, error) {
+		return c.Client.GetDatasetIOStats(ctx, datasets, window)
+	})
+}
+
+func (c *TrueNASClient) ListISCSISessions(ctx context.Context) ([]truenas.ISCSISession, error) {
+	return truenasList(ctx, c, "ListISCSISessions", c.Client.ListISCSISessions)
+}
+
+func (c *TrueNASClient) ListISCSIInitiatorGroups(ctx context.Context) ([]truenas.ISCSIInitiatorGroup, error) {
+	return truenasList(ctx, c, "ListISCSIInitiatorGroups", c.Client.ListISCSIInitiatorGroups)
+}
+
+func (c *TrueNASClient) GetSystemInfo(ctx context.Context) (*truenas.SystemInfo, error) {
+	return call(ctx, c.Schedule, "GetSystemInfo", truenasFailure, truenasUnavailable, c.Client.GetSystemInfo)
+}
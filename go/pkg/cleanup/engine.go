@@ -0,0 +1,655 @@
+// Package cleanup deletes orphaned TrueNAS snapshots, abandoned datasets and
+// dangling VolumeSnapshotContents as background jobs. Deletions run in
+// batches under an operations-per-minute cap so a large cleanup does not
+// starve the TrueNAS middleware of capacity for CSI operations.
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Defaults for zero Options fields.
+const (
+	DefaultBatchSize        = 25
+	DefaultBatchDelay       = 5 * time.Second
+	DefaultMaxOpsPerMinute  = 60
+	DefaultFailureThreshold = 0.2
+	DefaultHandsOffWindow   = 10 * time.Minute
+	DefaultVerifyTimeout    = 30 * time.Second
+	DefaultJobRetention     = 7 * 24 * time.Hour
+	DefaultMaxFinishedJobs  = 100
+)
+
+// janitorInterval is how often the engine prunes finished job records.
+const janitorInterval = 10 * time.Minute
+
+// AlertCategoryJobPaused is the category of the alert raised when a job is
+// paused for exceeding the failure threshold.
+const AlertCategoryJobPaused = "cleanup_job_paused"
+
+// Job types: the kind of resource a job deletes.
+const (
+	TypeTrueNASSnapshot       = "truenassnapshot"
+	TypeTrueNASDataset        = "truenasdataset"
+	TypeVolumeSnapshotContent = "volumesnapshotcontent"
+)
+
+// Job states.
+const (
+	StatusRunning   = "running"
+	StatusPaused    = "paused"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
+// Item states.
+const (
+	ItemPending = "pending"
+	ItemDeleted = "deleted"
+	// ItemSkipped marks a resource that was already gone.
+	ItemSkipped = "skipped"
+	// ItemDeferred marks a snapshot marked for deferred destroy that still
+	// exists because of holds or clones.
+	ItemDeferred = "deferred"
+	// ItemHandsOff marks a resource left alone because democratic-csi or
+	// the snapshot controller is still working on it.
+	ItemHandsOff = "hands_off"
+	ItemFailed   = "failed"
+)
+
+var (
+	// ErrJobNotFound is returned for an unknown job ID.
+	ErrJobNotFound = errors.New("cleanup job not found")
+	// ErrInvalidState is returned when a job cannot be paused or resumed in
+	// its current state.
+	ErrInvalidState = errors.New("invalid cleanup job state")
+)
+
+// Options controls the pace of cleanup jobs.
+type Options struct {
+	// BatchSize is the number of deletions between pauses of BatchDelay.
+	BatchSize int
+	// BatchDelay is the pause between batches.
+	BatchDelay time.Duration
+	// MaxOpsPerMinute caps deletions across all jobs of the engine.
+	MaxOpsPerMinute int
+	// FailureThreshold is the fraction (0-1] of failed deletions in a batch
+	// above which the job pauses and an alert is raised; 1 never pauses.
+	FailureThreshold float64
+	// DeferDestroy deletes with the ZFS defer option, so snapshots with
+	// holds or clones are destroyed once those are released instead of
+	// failing.
+	DeferDestroy bool
+	// HandsOffWindow is how long after democratic-csi starts deleting a PV
+	// the snapshots of its dataset are left alone.
+	HandsOffWindow time.Duration
+	// VerifyTimeout is how long a VolumeSnapshotContent job waits for its
+	// deletions to complete before failing those wedged on finalizers.
+	VerifyTimeout time.Duration
+	// JobRetention is how long a finished job stays listed.
+	JobRetention time.Duration
+	// MaxFinishedJobs caps the finished jobs kept; the oldest are pruned
+	// first. Running and paused jobs are never pruned.
+	MaxFinishedJobs int
+}
+
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.BatchDelay <= 0 {
+		o.BatchDelay = DefaultBatchDelay
+	}
+	if o.MaxOpsPerMinute <= 0 {
+		o.MaxOpsPerMinute = DefaultMaxOpsPerMinute
+	}
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = DefaultFailureThreshold
+	}
+	if o.HandsOffWindow <= 0 {
+		o.HandsOffWindow = DefaultHandsOffWindow
+	}
+	if o.VerifyTimeout <= 0 {
+		o.VerifyTimeout = DefaultVerifyTimeout
+	}
+	if o.JobRetention <= 0 {
+		o.JobRetention = DefaultJobRetention
+	}
+	if o.MaxFinishedJobs <= 0 {
+		o.MaxFinishedJobs = DefaultMaxFinishedJobs
+	}
+	return o
+}
+
+// Config configures an Engine.
+type Config struct {
+	Options
+	// AlertDispatcher delivers the alert raised when a job auto-pauses;
+	// nil only logs it.
+	AlertDispatcher *alerts.Dispatcher
+	// K8sClient deletes VolumeSnapshotContents and shows what
+	// democratic-csi is deleting; nil makes DeleteVolumeSnapshotContents
+	// jobs fail every item and deletes TrueNAS snapshots unguarded.
+	K8sClient k8s.Client
+	// OnJobsPruned, when set, is called with the number of finished jobs
+	// each prune removed.
+	OnJobsPruned func(n int)
+	Logger       *logging.Logger
+	Clock        clock.Clock
+}
+
+// Item is the outcome of one deletion of a job.
+type Item struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Reason explains a hands_off item.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Job reports the progress of a cleanup job.
+type Job struct {
+	ID string `json:"id"`
+	// Type is TypeTrueNASSnapshot, TypeTrueNASDataset or
+	// TypeVolumeSnapshotContent.
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	// Progress is "processed/total", e.g. "120/500".
+	Progress    string     `json:"progress"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Deleted     int        `json:"deleted"`
+	Skipped     int        `json:"skipped"`
+	Deferred    int        `json:"deferred"`
+	HandsOff    int        `json:"hands_off"`
+	Failed      int        `json:"failed"`
+	PauseReason string     `json:"pause_reason,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Items       []Item     `json:"items"`
+}
+
+// job is the engine's state of a Job, guarded by Engine.mu.
+type job struct {
+	Job
+	// resume is non-nil while the job is paused and closed to resume it.
+	resume chan struct{}
+	// remove deletes one item.
+	remove func(ctx context.Context, name string) error
+	// handsOff reports why an item must be left alone, or "".
+	handsOff func(state *csiState, name string) string
+}
+
+func (j *job) view() Job {
+	out := j.Job
+	out.Progress = fmt.Sprintf("%d/%d", j.Processed, j.Total)
+	out.Items = append([]Item{}, j.Items...)
+	return out
+}
+
+// Engine runs cleanup jobs.
+type Engine struct {
+	truenasClient truenas.Client
+	k8sClient     k8s.Client
+	opts          Options
+	dispatcher    *alerts.Dispatcher
+	logger        *logging.Logger
+	clock         clock.Clock
+	limiter       *rate.Limiter
+	onJobsPruned  func(n int)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	// pvDeletions maps dataset leaves to the deletion time of their PV,
+	// as observed by handsOffSnapshot.
+	pvDeletions map[string]time.Time
+}
+
+// NewEngine creates an engine deleting through truenasClient.
+func NewEngine(truenasClient truenas.Client, config Config) *Engine {
+	opts := config.Options.withDefaults()
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Engine{
+		truenasClient: truenasClient,
+		k8sClient:     config.K8sClient,
+		opts:          opts,
+		dispatcher:    config.AlertDispatcher,
+		logger:        logger,
+		clock:         clock.OrReal(config.Clock),
+		limiter:       rate.NewLimiter(rate.Limit(float64(opts.MaxOpsPerMinute)/60), 1),
+		onJobsPruned:  config.OnJobsPruned,
+		ctx:           ctx,
+		cancel:        cancel,
+		jobs:          make(map[string]*job),
+		pvDeletions:   make(map[string]time.Time),
+	}
+	e.wg.Add(1)
+	go e.runJanitor()
+	return e
+}
+
+// Options returns the effective options.
+func (e *Engine) Options() Options {
+	return e.opts
+}
+
+// DeleteSnapshots starts a job deleting the named TrueNAS snapshots and
+// returns it.
+func (e *Engine) DeleteSnapshots(snapshots []string) Job {
+	return e.start(TypeTrueNASSnapshot, snapshots, e.handsOffSnapshot, func(ctx context.Context, name string) error {
+		err := e.truenasClient.DeleteSnapshot(ctx, name, truenas.DeleteSnapshotOptions{Defer: e.opts.DeferDestroy})
+		if errors.Is(err, truenas.ErrSnapshotNotFound) {
+			return errAlreadyGone
+		}
+		return err
+	})
+}
+
+// DatasetDeletion is a dataset to delete together with its snapshots.
+type DatasetDeletion struct {
+	Dataset   string
+	Snapshots []string
+}
+
+// DeleteDatasets starts a job deleting each dataset after its snapshots,
+// in the order given, and returns it. The dataset deletion is not
+// recursive, so a dataset whose snapshots were not all destroyed fails
+// instead of taking them along. Datasets a PV or VolumeAttachment still
+// references are left alone, snapshots included.
+func (e *Engine) DeleteDatasets(deletions []DatasetDeletion) Job {
+	var names []string
+	for _, deletion := range deletions {
+		names = append(names, deletion.Snapshots...)
+		names = append(names, deletion.Dataset)
+	}
+	return e.start(TypeTrueNASDataset, names, e.handsOffDataset, func(ctx context.Context, name string) error {
+		var err error
+		if strings.Contains(name, "@") {
+			err = e.truenasClient.DeleteSnapshot(ctx, name, truenas.DeleteSnapshotOptions{Defer: e.opts.DeferDestroy})
+		} else {
+			err = e.truenasClient.DeleteDataset(ctx, name)
+		}
+		if errors.Is(err, truenas.ErrSnapshotNotFound) || errors.Is(err, truenas.ErrDatasetNotFound) {
+			return errAlreadyGone
+		}
+		return err
+	})
+}
+
+// DeleteVolumeSnapshotContents starts a job deleting the named
+// VolumeSnapshotContents and returns it.
+func (e *Engine) DeleteVolumeSnapshotContents(contents []string) Job {
+	return e.start(TypeVolumeSnapshotContent, contents, e.handsOffContent, func(ctx context.Context, name string) error {
+		if e.k8sClient == nil {
+			return errors.New("no Kubernetes client configured")
+		}
+		err := e.k8sClient.DeleteVolumeSnapshotContent(ctx, name)
+		if apierrors.IsNotFound(err) {
+			return errAlreadyGone
+		}
+		return err
+	})
+}
+
+// errAlreadyGone is returned by a job's remove function for a resource that
+// no longer exists.
+var errAlreadyGone = errors.New("already gone")
+
+func (e *Engine) start(kind string, names []string, handsOff func(*csiState, string) string, remove func(ctx context.Context, name string) error) Job {
+	now := e.clock.Now()
+	j := &job{Job: Job{
+		ID:        uuid.NewString(),
+		Type:      kind,
+		Status:    StatusRunning,
+		Total:     len(names),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Items:     make([]Item, len(names)),
+	}, remove: remove, handsOff: handsOff}
+	for i, name := range names {
+		j.Items[i] = Item{Name: name, Status: ItemPending}
+	}
+
+	e.mu.Lock()
+	e.jobs[j.ID] = j
+	view := j.view()
+	e.mu.Unlock()
+
+	e.logger.Info("Cleanup job started", zap.String("job_id", j.ID), zap.String("type", kind), zap.Int("items", len(names)))
+	e.wg.Add(1)
+	go e.run(j)
+	return view
+}
+
+// Job returns the job with the given ID.
+func (e *Engine) Job(id string) (Job, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	j, ok := e.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j.view(), nil
+}
+
+// Jobs returns all jobs, newest first.
+func (e *Engine) Jobs() []Job {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Job, 0, len(e.jobs))
+	for _, j := range e.jobs {
+		out = append(out, j.view())
+	}
+	sort.Slice(out, func(i, k int) bool {
+		if !out[i].CreatedAt.Equal(out[k].CreatedAt) {
+			return out[i].CreatedAt.After(out[k].CreatedAt)
+		}
+		return out[i].ID < out[k].ID
+	})
+	return out
+}
+
+// Pause stops a running job before its next deletion.
+func (e *Engine) Pause(id string) (Job, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	j, ok := e.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if j.Status != StatusRunning {
+		return Job{}, fmt.Errorf("%w: job %s is %s", ErrInvalidState, id, j.Status)
+	}
+	e.pauseLocked(j, "paused by request")
+	return j.view(), nil
+}
+
+// Resume continues a paused job.
+func (e *Engine) Resume(id string) (Job, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	j, ok := e.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if j.Status != StatusPaused {
+		return Job{}, fmt.Errorf("%w: job %s is %s", ErrInvalidState, id, j.Status)
+	}
+	j.Status = StatusRunning
+	j.PauseReason = ""
+	j.UpdatedAt = e.clock.Now()
+	close(j.resume)
+	j.resume = nil
+	return j.view(), nil
+}
+
+// PruneJobs removes the finished jobs older than JobRetention, then the
+// oldest finished jobs beyond MaxFinishedJobs, and returns how many it
+// removed. Job and Jobs return copies, so a job being read is unaffected.
+func (e *Engine) PruneJobs() int {
+	now := e.clock.Now()
+	e.mu.Lock()
+	var finished []*job
+	var pruned []string
+	for id, j := range e.jobs {
+		switch {
+		case j.FinishedAt == nil:
+		case now.Sub(*j.FinishedAt) > e.opts.JobRetention:
+			delete(e.jobs, id)
+			pruned = append(pruned, id)
+		default:
+			finished = append(finished, j)
+		}
+	}
+	if excess := len(finished) - e.opts.MaxFinishedJobs; excess > 0 {
+		sort.Slice(finished, func(i, k int) bool {
+			if !finished[i].FinishedAt.Equal(*finished[k].FinishedAt) {
+				return finished[i].FinishedAt.Before(*finished[k].FinishedAt)
+			}
+			return finished[i].ID < finished[k].ID
+		})
+		for _, j := range finished[:excess] {
+			delete(e.jobs, j.ID)
+			pruned = append(pruned, j.ID)
+		}
+	}
+	e.mu.Unlock()
+
+	if len(pruned) == 0 {
+		return 0
+	}
+	sort.Strings(pruned)
+	e.logger.Info("Pruned finished cleanup jobs",
+		zap.Strings("job_ids", pruned),
+		zap.Duration("retention", e.opts.JobRetention),
+		zap.Int("max_finished_jobs", e.opts.MaxFinishedJobs))
+	if e.onJobsPruned != nil {
+		e.onJobsPruned(len(pruned))
+	}
+	return len(pruned)
+}
+
+// runJanitor prunes finished jobs every janitorInterval until Close.
+func (e *Engine) runJanitor() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+			e.PruneJobs()
+		}
+	}
+}
+
+// Close cancels unfinished jobs and waits for them to stop.
+func (e *Engine) Close() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+func (e *Engine) pauseLocked(j *job, reason string) {
+	j.Status = StatusPaused
+	j.PauseReason = reason
+	j.UpdatedAt = e.clock.Now()
+	j.resume = make(chan struct{})
+}
+
+// run deletes the job's items batch by batch.
+func (e *Engine) run(j *job) {
+	defer e.wg.Done()
+	ctx := e.ctx
+	total := len(j.Items)
+
+	for start := 0; start < total; start += e.opts.BatchSize {
+		if start > 0 && !sleep(ctx, e.opts.BatchDelay) {
+			e.finish(j, StatusCancelled)
+			return
+		}
+		end := start + e.opts.BatchSize
+		if end > total {
+			end = total
+		}
+
+		var state *csiState
+		var stateErr error
+		if e.k8sClient != nil {
+			state, stateErr = e.loadCSIState(ctx, j.Type)
+		}
+
+		failed := 0
+		for i := start; i < end; i++ {
+			if !e.waitWhilePaused(ctx, j) || e.limiter.Wait(ctx) != nil {
+				e.finish(j, StatusCancelled)
+				return
+			}
+			if !e.deleteItem(ctx, j, i, state, stateErr) {
+				failed++
+			}
+		}
+
+		ratio := float64(failed) / float64(end-start)
+		if end < total && ratio > e.opts.FailureThreshold {
+			e.autoPause(ctx, j, failed, end-start)
+		}
+	}
+	if j.Type == TypeVolumeSnapshotContent {
+		e.verifyContents(ctx, j)
+	}
+	e.finish(j, StatusCompleted)
+}
+
+// deleteItem deletes one item unless the batch's csiState says to leave it
+// alone, and records the outcome. It reports false when the deletion failed;
+// an item is failed unchecked when the state could not be listed.
+func (e *Engine) deleteItem(ctx context.Context, j *job, i int, state *csiState, stateErr error) bool {
+	e.mu.Lock()
+	name := j.Items[i].Name
+	e.mu.Unlock()
+
+	var reason string
+	var err error
+	switch {
+	case stateErr != nil:
+		err = fmt.Errorf("cannot check democratic-csi state: %w", stateErr)
+	case state != nil:
+		reason = j.handsOff(state, name)
+	}
+	if err == nil && reason == "" {
+		err = j.remove(ctx, name)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	item := &j.Items[i]
+	switch {
+	case reason != "":
+		item.Status = ItemHandsOff
+		item.Reason = reason
+		j.HandsOff++
+		e.logger.Info("Cleanup left resource to the CSI driver", zap.String("job_id", j.ID), zap.String("type", j.Type), zap.String("name", name), zap.String("reason", reason))
+	case err == nil:
+		item.Status = ItemDeleted
+		j.Deleted++
+	case errors.Is(err, errAlreadyGone):
+		item.Status = ItemSkipped
+		j.Skipped++
+	case e.opts.DeferDestroy && errors.Is(err, truenas.ErrNotDeleted):
+		item.Status = ItemDeferred
+		item.Error = err.Error()
+		j.Deferred++
+	default:
+		item.Status = ItemFailed
+		item.Error = err.Error()
+		j.Failed++
+		e.logger.Warn("Cleanup deletion failed", zap.String("job_id", j.ID), zap.String("type", j.Type), zap.String("name", name), logging.RedactedError(err))
+	}
+	j.Processed++
+	j.UpdatedAt = e.clock.Now()
+	return item.Status != ItemFailed
+}
+
+// autoPause pauses a job whose last batch failed too often and raises an
+// alert.
+func (e *Engine) autoPause(ctx context.Context, j *job, failed, batch int) {
+	e.mu.Lock()
+	if j.Status == StatusRunning {
+		e.pauseLocked(j, fmt.Sprintf("%d of %d deletions in the last batch failed, above the %.0f%% failure threshold",
+			failed, batch, e.opts.FailureThreshold*100))
+	}
+	reason := j.PauseReason
+	progress := fmt.Sprintf("%d/%d", j.Processed, j.Total)
+	e.mu.Unlock()
+
+	e.logger.Warn("Cleanup job paused", zap.String("job_id", j.ID), zap.String("reason", reason), zap.String("progress", progress))
+	if e.dispatcher == nil {
+		return
+	}
+	alert := alerts.Alert{
+		Source:    alerts.SourceCleanup,
+		Level:     alerts.LevelCritical,
+		Category:  AlertCategoryJobPaused,
+		Resource:  "cleanup-job/" + j.ID,
+		Message:   fmt.Sprintf("Cleanup job %s paused at %s: %s", j.ID, progress, reason),
+		Timestamp: e.clock.Now(),
+	}
+	if _, err := e.dispatcher.Dispatch(ctx, alert); err != nil {
+		e.logger.Warn("Failed to send cleanup alert", zap.String("job_id", j.ID), logging.RedactedError(err))
+	}
+}
+
+// waitWhilePaused blocks while the job is paused. It reports false when ctx
+// ends first.
+func (e *Engine) waitWhilePaused(ctx context.Context, j *job) bool {
+	for {
+		e.mu.Lock()
+		resume := j.resume
+		e.mu.Unlock()
+		if resume == nil {
+			return true
+		}
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (e *Engine) finish(j *job, status string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.clock.Now()
+	j.Status = status
+	j.PauseReason = ""
+	j.resume = nil
+	j.UpdatedAt = now
+	j.FinishedAt = &now
+	e.logger.Info("Cleanup job finished",
+		zap.String("job_id", j.ID),
+		zap.String("status", status),
+		zap.Int("deleted", j.Deleted),
+		zap.Int("skipped", j.Skipped),
+		zap.Int("hands_off", j.HandsOff),
+		zap.Int("failed", j.Failed))
+}
+
+// sleep waits for d and reports false when ctx ends first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,476 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+// fastOptions paces jobs quickly enough for tests.
+var fastOptions = Options{BatchSize: 2, BatchDelay: time.Millisecond, MaxOpsPerMinute: 600000, FailureThreshold: 0.5}
+
+func testSnapshots(names ...string) []truenas.Snapshot {
+	snapshots := make([]truenas.Snapshot, 0, len(names))
+	for _, name := range names {
+		snapshots = append(snapshots, truenas.Snapshot{ID: name, Name: name})
+	}
+	return snapshots
+}
+
+// waitForStatus polls the job until it reaches status.
+func waitForStatus(t *testing.T, engine *Engine, id, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := engine.Job(id)
+		if err != nil {
+			t.Fatalf("Job(%s): %v", id, err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not reach %s: %+v", status, job)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEngine_DeletesInBatches(t *testing.T) {
+	client := &truenastest.Client{Snapshots: testSnapshots("tank/a@1", "tank/a@2", "tank/a@3", "tank/a@4")}
+	engine := NewEngine(client, Config{Options: fastOptions})
+	defer engine.Close()
+
+	started := engine.DeleteSnapshots([]string{"tank/a@1", "tank/a@2", "tank/a@gone", "tank/a@3", "tank/a@4"})
+	if started.Status != StatusRunning || started.Progress != "0/5" {
+		t.Fatalf("unexpected started job: %+v", started)
+	}
+
+	job := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if job.Progress != "5/5" || job.Deleted != 4 || job.Skipped != 1 || job.Failed != 0 || job.FinishedAt == nil {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	if job.Items[2].Status != ItemSkipped {
+		t.Fatalf("missing snapshot should be skipped: %+v", job.Items[2])
+	}
+	if len(client.Snapshots) != 0 {
+		t.Fatalf("snapshots left: %+v", client.Snapshots)
+	}
+	if mutations := client.Mutations(); len(mutations) != 5 || mutations[2] != (truenastest.Mutation{Method: "DeleteSnapshot", Name: "tank/a@gone"}) {
+		t.Fatalf("unexpected mutations: %+v", mutations)
+	}
+	if jobs := engine.Jobs(); len(jobs) != 1 || jobs[0].ID != started.ID {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+}
+
+func TestEngine_DeletesVolumeSnapshotContents(t *testing.T) {
+	k8sClient := &k8stest.Client{VolumeSnapshotContents: []snapshotv1.VolumeSnapshotContent{
+		{ObjectMeta: metav1.ObjectMeta{Name: "content-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "content-b"}},
+	}}
+	client := &truenastest.Client{}
+	engine := NewEngine(client, Config{Options: fastOptions, K8sClient: k8sClient})
+	defer engine.Close()
+
+	started := engine.DeleteVolumeSnapshotContents([]string{"content-a", "content-gone", "content-b"})
+	if started.Type != TypeVolumeSnapshotContent {
+		t.Fatalf("job type = %q, want %q", started.Type, TypeVolumeSnapshotContent)
+	}
+	job := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if job.Deleted != 2 || job.Skipped != 1 || job.Failed != 0 || job.Items[1].Status != ItemSkipped {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	if deleted := k8sClient.DeletedSnapshotContents(); len(deleted) != 2 || len(k8sClient.VolumeSnapshotContents) != 0 {
+		t.Fatalf("deleted = %v, left = %+v", deleted, k8sClient.VolumeSnapshotContents)
+	}
+	if mutations := client.Mutations(); len(mutations) != 0 {
+		t.Fatalf("content job touched TrueNAS: %+v", mutations)
+	}
+}
+
+func TestEngine_DeletesDatasetsAfterTheirSnapshots(t *testing.T) {
+	client := &truenastest.Client{
+		Volumes:   []truenas.Volume{{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a"}},
+		Snapshots: testSnapshots("tank/k8s/pvc-a@1", "tank/k8s/pvc-a@2"),
+	}
+	engine := NewEngine(client, Config{Options: fastOptions})
+	defer engine.Close()
+
+	started := engine.DeleteDatasets([]DatasetDeletion{
+		{Dataset: "tank/k8s/pvc-a", Snapshots: []string{"tank/k8s/pvc-a@1", "tank/k8s/pvc-a@2"}},
+		{Dataset: "tank/k8s/pvc-gone"},
+	})
+	if started.Type != TypeTrueNASDataset || started.Total != 4 {
+		t.Fatalf("unexpected started job: %+v", started)
+	}
+	job := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if job.Deleted != 3 || job.Skipped != 1 || job.Failed != 0 || job.Items[3].Status != ItemSkipped {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	var methods []string
+	for _, mutation := range client.Mutations() {
+		methods = append(methods, mutation.Method+" "+mutation.Name)
+	}
+	want := "DeleteSnapshot tank/k8s/pvc-a@1,DeleteSnapshot tank/k8s/pvc-a@2,DeleteDataset tank/k8s/pvc-a,DeleteDataset tank/k8s/pvc-gone"
+	if got := strings.Join(methods, ","); got != want {
+		t.Fatalf("mutations = %s, want %s", got, want)
+	}
+	if len(client.Volumes) != 0 || len(client.Snapshots) != 0 {
+		t.Fatalf("left volumes %+v and snapshots %+v", client.Volumes, client.Snapshots)
+	}
+}
+
+func TestEngine_DeferDestroyCountsDeferredSnapshots(t *testing.T) {
+	held := fmt.Errorf("%w: tank/a@held", truenas.ErrNotDeleted)
+	client := &truenastest.Client{
+		Snapshots:          testSnapshots("tank/a@1", "tank/a@held"),
+		DeleteSnapshotErrs: map[string]error{"tank/a@held": held},
+	}
+	options := fastOptions
+	options.DeferDestroy = true
+	engine := NewEngine(client, Config{Options: options})
+	defer engine.Close()
+
+	started := engine.DeleteSnapshots([]string{"tank/a@1", "tank/a@held"})
+	job := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if job.Deleted != 1 || job.Deferred != 1 || job.Failed != 0 || job.Items[1].Status != ItemDeferred {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	for _, mutation := range client.Mutations() {
+		if !mutation.DeleteOptions.Defer {
+			t.Fatalf("delete without defer: %+v", mutation)
+		}
+	}
+}
+
+func TestEngine_AutoPausesAboveFailureThreshold(t *testing.T) {
+	client := &truenastest.Client{
+		Snapshots: testSnapshots("tank/a@1", "tank/a@2", "tank/a@3", "tank/a@4"),
+		DeleteSnapshotErrs: map[string]error{
+			"tank/a@1": errors.New("snapshot has dependent clones"),
+			"tank/a@2": errors.New("snapshot has dependent clones"),
+		},
+	}
+
+	var mu sync.Mutex
+	var sent []alerts.Alert
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: alerts.NewRouter(alerts.RouterConfig{
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationWebhook, URL: "http://hooks.local"}}},
+		}),
+		Senders: map[string]alerts.Sender{
+			alerts.DestinationWebhook: alerts.SenderFunc(func(_ context.Context, _ alerts.Destination, alert alerts.Alert) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sent = append(sent, alert)
+				return nil
+			}),
+		},
+		Logger: logging.NewNop(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine(client, Config{Options: fastOptions, AlertDispatcher: dispatcher})
+	defer engine.Close()
+
+	started := engine.DeleteSnapshots([]string{"tank/a@1", "tank/a@2", "tank/a@3", "tank/a@4"})
+	paused := waitForStatus(t, engine, started.ID, StatusPaused)
+	if paused.Progress != "2/4" || paused.Failed != 2 || paused.PauseReason == "" {
+		t.Fatalf("job should pause after the failing batch: %+v", paused)
+	}
+
+	mu.Lock()
+	if len(sent) != 1 || sent[0].Category != AlertCategoryJobPaused || sent[0].Source != alerts.SourceCleanup {
+		t.Fatalf("unexpected alerts: %+v", sent)
+	}
+	mu.Unlock()
+
+	if _, err := engine.Pause(started.ID); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("pausing a paused job: got %v", err)
+	}
+	if _, err := engine.Resume(started.ID); err != nil {
+		t.Fatal(err)
+	}
+	done := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if done.Deleted != 2 || done.Failed != 2 {
+		t.Fatalf("unexpected finished job: %+v", done)
+	}
+	if _, err := engine.Resume(started.ID); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("resuming a completed job: got %v", err)
+	}
+	if _, err := engine.Job("unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("unknown job: got %v", err)
+	}
+}
+
+// gatedClient announces each deletion on entered and blocks it until the
+// test releases gate.
+type gatedClient struct {
+	*truenastest.Client
+	entered chan string
+	gate    chan struct{}
+}
+
+func newGatedClient(snapshots ...string) *gatedClient {
+	return &gatedClient{
+		Client:  &truenastest.Client{Snapshots: testSnapshots(snapshots...)},
+		entered: make(chan string, len(snapshots)),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (c *gatedClient) DeleteSnapshot(ctx context.Context, name string, opts truenas.DeleteSnapshotOptions) error {
+	c.entered <- name
+	<-c.gate
+	return c.Client.DeleteSnapshot(ctx, name, opts)
+}
+
+func TestEngine_PauseAndResume(t *testing.T) {
+	client := newGatedClient("tank/a@1", "tank/a@2", "tank/a@3")
+	engine := NewEngine(client, Config{Options: fastOptions})
+	defer engine.Close()
+
+	started := engine.DeleteSnapshots([]string{"tank/a@1", "tank/a@2", "tank/a@3"})
+	<-client.entered
+	if _, err := engine.Pause(started.ID); err != nil {
+		t.Fatal(err)
+	}
+	// The deletion in flight when the job was paused still completes.
+	client.gate <- struct{}{}
+
+	time.Sleep(20 * time.Millisecond)
+	paused, _ := engine.Job(started.ID)
+	if paused.Status != StatusPaused || paused.Processed != 1 {
+		t.Fatalf("paused job kept deleting: %+v", paused)
+	}
+
+	if _, err := engine.Resume(started.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(client.gate)
+	done := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if done.Deleted != 3 {
+		t.Fatalf("unexpected finished job: %+v", done)
+	}
+}
+
+func TestEngine_CloseCancelsPausedJobs(t *testing.T) {
+	client := newGatedClient("tank/a@1", "tank/a@2")
+	engine := NewEngine(client, Config{Options: fastOptions})
+
+	started := engine.DeleteSnapshots([]string{"tank/a@1", "tank/a@2"})
+	<-client.entered
+	if _, err := engine.Pause(started.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(client.gate)
+	engine.Close()
+
+	job, _ := engine.Job(started.ID)
+	if job.Status != StatusCancelled || job.Processed != 1 || job.FinishedAt == nil {
+		t.Fatalf("unexpected job after Close: %+v", job)
+	}
+}
+
+func csiPV(name string, deleting *metav1.Time) corev1.PersistentVolume {
+	pv := corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name, DeletionTimestamp: deleting},
+		Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+			CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: name},
+		}},
+	}
+	if deleting != nil {
+		pv.Finalizers = []string{"kubernetes.io/pv-protection"}
+	}
+	return pv
+}
+
+func TestEngine_LeavesVolumesBeingDeletedToTheDriver(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	deleting := metav1.NewTime(now.Add(-time.Minute))
+	gonePV := "pvc-c"
+	k8sClient := &k8stest.Client{
+		PersistentVolumes: []corev1.PersistentVolume{csiPV("pvc-a", &deleting), csiPV("pvc-b", nil)},
+		VolumeAttachments: []storagev1.VolumeAttachment{{
+			ObjectMeta: metav1.ObjectMeta{Name: "csi-c"},
+			Spec:       storagev1.VolumeAttachmentSpec{NodeName: "node-1", Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: &gonePV}},
+		}},
+	}
+	client := &truenastest.Client{Snapshots: testSnapshots("tank/k8s/pvc-a@1", "tank/k8s/pvc-b@1", "tank/k8s/pvc-c@1", "tank/k8s/pvc-a@2")}
+	engine := NewEngine(client, Config{Options: fastOptions, K8sClient: k8sClient, Clock: fakeClock})
+	defer engine.Close()
+
+	started := engine.DeleteSnapshots([]string{"tank/k8s/pvc-a@1", "tank/k8s/pvc-b@1", "tank/k8s/pvc-c@1"})
+	job := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if job.Deleted != 1 || job.HandsOff != 2 || job.Failed != 0 {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	if job.Items[0].Status != ItemHandsOff || !strings.Contains(job.Items[0].Reason, "being deleted") {
+		t.Fatalf("snapshot of a deleting PV: %+v", job.Items[0])
+	}
+	if job.Items[2].Status != ItemHandsOff || !strings.Contains(job.Items[2].Reason, "node-1") {
+		t.Fatalf("snapshot of an attached volume: %+v", job.Items[2])
+	}
+
+	// The PV is gone, but the hands-off window runs from its deletion.
+	k8sClient.PersistentVolumes = []corev1.PersistentVolume{csiPV("pvc-b", nil)}
+	fakeClock.Advance(5 * time.Minute)
+	within := waitForStatus(t, engine, engine.DeleteSnapshots([]string{"tank/k8s/pvc-a@2"}).ID, StatusCompleted)
+	if within.HandsOff != 1 || !strings.Contains(within.Items[0].Reason, "hands-off window") {
+		t.Fatalf("snapshot within the hands-off window: %+v", within)
+	}
+
+	fakeClock.Advance(DefaultHandsOffWindow)
+	after := waitForStatus(t, engine, engine.DeleteSnapshots([]string{"tank/k8s/pvc-a@2"}).ID, StatusCompleted)
+	if after.Deleted != 1 || after.HandsOff != 0 {
+		t.Fatalf("snapshot after the hands-off window: %+v", after)
+	}
+}
+
+func TestEngine_RefusesDatasetsPVsStillReference(t *testing.T) {
+	bound := csiPV("pvc-a", nil)
+	bound.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	released := csiPV("pv-b", nil)
+	released.Spec.CSI.VolumeHandle = "tank/k8s/pvc-b"
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{bound, released}}
+	client := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a"},
+			{ID: "tank/k8s/pvc-b", Name: "tank/k8s/pvc-b"},
+			{ID: "tank/k8s/pvc-c", Name: "tank/k8s/pvc-c"},
+		},
+		Snapshots: testSnapshots("tank/k8s/pvc-a@1"),
+	}
+	engine := NewEngine(client, Config{Options: fastOptions, K8sClient: k8sClient})
+	defer engine.Close()
+
+	job := waitForStatus(t, engine, engine.DeleteDatasets([]DatasetDeletion{
+		{Dataset: "tank/k8s/pvc-a", Snapshots: []string{"tank/k8s/pvc-a@1"}},
+		{Dataset: "tank/k8s/pvc-b"},
+		{Dataset: "tank/k8s/pvc-c"},
+	}).ID, StatusCompleted)
+	if job.Deleted != 1 || job.HandsOff != 3 || job.Items[3].Status != ItemDeleted {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	for _, item := range job.Items[:2] {
+		if item.Status != ItemHandsOff || !strings.Contains(item.Reason, "bound to apps/data") {
+			t.Fatalf("dataset of a bound PV: %+v", item)
+		}
+	}
+	if !strings.Contains(job.Items[2].Reason, "PV pv-b references dataset tank/k8s/pvc-b") {
+		t.Fatalf("dataset a released PV names by full path: %+v", job.Items[2])
+	}
+	if mutations := client.Mutations(); len(mutations) != 1 || mutations[0].Name != "tank/k8s/pvc-c" {
+		t.Fatalf("mutations = %+v, want only tank/k8s/pvc-c deleted", mutations)
+	}
+}
+
+func TestEngine_FailsItemsWhenCSIStateIsUnavailable(t *testing.T) {
+	k8sClient := &k8stest.Client{ListPersistentVolumesErr: errors.New("forbidden")}
+	client := &truenastest.Client{Snapshots: testSnapshots("tank/a@1")}
+	engine := NewEngine(client, Config{Options: fastOptions, K8sClient: k8sClient})
+	defer engine.Close()
+
+	job := waitForStatus(t, engine, engine.DeleteSnapshots([]string{"tank/a@1"}).ID, StatusCompleted)
+	if job.Failed != 1 || !strings.Contains(job.Items[0].Error, "democratic-csi state") || len(client.Mutations()) != 0 {
+		t.Fatalf("unguarded deletion: %+v, mutations %+v", job, client.Mutations())
+	}
+}
+
+// finalizingClient marks contents with finalizers as deleting instead of
+// removing them, as the API server does.
+type finalizingClient struct {
+	*k8stest.Client
+}
+
+func (c *finalizingClient) DeleteVolumeSnapshotContent(ctx context.Context, name string) error {
+	for i := range c.VolumeSnapshotContents {
+		content := &c.VolumeSnapshotContents[i]
+		if content.Name == name && len(content.Finalizers) > 0 {
+			deleting := metav1.Now()
+			content.DeletionTimestamp = &deleting
+			return nil
+		}
+	}
+	return c.Client.DeleteVolumeSnapshotContent(ctx, name)
+}
+
+func TestEngine_FailsWedgedVolumeSnapshotContents(t *testing.T) {
+	deleting := metav1.Now()
+	finalizer := []string{"snapshot.storage.kubernetes.io/volumesnapshotcontent-bound-protection"}
+	k8sClient := &finalizingClient{Client: &k8stest.Client{VolumeSnapshotContents: []snapshotv1.VolumeSnapshotContent{
+		{ObjectMeta: metav1.ObjectMeta{Name: "content-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "content-wedged", Finalizers: finalizer}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "content-deleting", Finalizers: finalizer, DeletionTimestamp: &deleting}},
+	}}}
+	options := fastOptions
+	options.VerifyTimeout = 20 * time.Millisecond
+	engine := NewEngine(&truenastest.Client{}, Config{Options: options, K8sClient: k8sClient})
+	defer engine.Close()
+
+	started := engine.DeleteVolumeSnapshotContents([]string{"content-a", "content-wedged", "content-deleting"})
+	job := waitForStatus(t, engine, started.ID, StatusCompleted)
+	if job.Deleted != 1 || job.Failed != 1 || job.HandsOff != 1 {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+	if job.Items[1].Status != ItemFailed || !strings.Contains(job.Items[1].Error, "did not progress") {
+		t.Fatalf("wedged content: %+v", job.Items[1])
+	}
+	if job.Items[2].Status != ItemHandsOff {
+		t.Fatalf("content already being deleted: %+v", job.Items[2])
+	}
+}
+
+func TestEngine_PrunesFinishedJobs(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	options := fastOptions
+	options.JobRetention = time.Hour
+	options.MaxFinishedJobs = 2
+	var pruned []int
+	engine := NewEngine(&truenastest.Client{}, Config{Options: options, Clock: fakeClock, OnJobsPruned: func(n int) { pruned = append(pruned, n) }})
+	defer engine.Close()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		ids = append(ids, waitForStatus(t, engine, engine.DeleteSnapshots([]string{"tank/a@gone"}).ID, StatusCompleted).ID)
+		fakeClock.Advance(time.Minute)
+	}
+
+	if n := engine.PruneJobs(); n != 1 {
+		t.Fatalf("pruned %d jobs over the cap, want 1", n)
+	}
+	if _, err := engine.Job(ids[0]); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("oldest job should be pruned, got err %v", err)
+	}
+	if n := engine.PruneJobs(); n != 0 {
+		t.Fatalf("pruned %d jobs within retention, want 0", n)
+	}
+
+	fakeClock.Advance(time.Hour)
+	if n := engine.PruneJobs(); n != 2 || len(engine.Jobs()) != 0 {
+		t.Fatalf("pruned %d jobs past retention, %d left; want 2 and none", n, len(engine.Jobs()))
+	}
+	if fmt.Sprint(pruned) != "[1 2]" {
+		t.Fatalf("OnJobsPruned calls = %v, want [1 2]", pruned)
+	}
+}
@@ -0,0 +1,265 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// csiState is what democratic-csi is doing to the volumes a batch touches,
+// listed once per batch to bound API calls.
+type csiState struct {
+	// pvs maps the leaf of a volume handle, which democratic-csi names
+	// after the dataset, to its PV.
+	pvs map[string]*corev1.PersistentVolume
+	// volumes lists every PV, live or terminating, for the dataset guard.
+	volumes []*corev1.PersistentVolume
+	// attachments maps PV names to the node of a VolumeAttachment that is
+	// not being deleted.
+	attachments map[string]string
+	// inlineAttachments maps the CSI handles of inline volumes to the node
+	// of a VolumeAttachment that is not being deleted.
+	inlineAttachments map[string]string
+	// contents maps VolumeSnapshotContent names to the content.
+	contents map[string]*snapshotv1.VolumeSnapshotContent
+}
+
+// loadCSIState lists the objects the guard of kind needs.
+func (e *Engine) loadCSIState(ctx context.Context, kind string) (*csiState, error) {
+	state := &csiState{
+		pvs:               make(map[string]*corev1.PersistentVolume),
+		attachments:       make(map[string]string),
+		inlineAttachments: make(map[string]string),
+		contents:          make(map[string]*snapshotv1.VolumeSnapshotContent),
+	}
+	if kind == TypeVolumeSnapshotContent {
+		contents, err := e.k8sClient.ListVolumeSnapshotContents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list VolumeSnapshotContents: %w", err)
+		}
+		for i := range contents {
+			state.contents[contents[i].Name] = &contents[i]
+		}
+		return state, nil
+	}
+
+	pvs, err := e.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PersistentVolumes: %w", err)
+	}
+	for i := range pvs {
+		state.volumes = append(state.volumes, &pvs[i])
+		if pvs[i].Spec.CSI != nil && pvs[i].Spec.CSI.VolumeHandle != "" {
+			state.pvs[path.Base(pvs[i].Spec.CSI.VolumeHandle)] = &pvs[i]
+		}
+	}
+	attachments, err := e.k8sClient.ListVolumeAttachments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VolumeAttachments: %w", err)
+	}
+	for _, attachment := range attachments {
+		if attachment.DeletionTimestamp != nil {
+			continue
+		}
+		source := attachment.Spec.Source
+		if source.PersistentVolumeName != nil {
+			state.attachments[*source.PersistentVolumeName] = attachment.Spec.NodeName
+		}
+		if source.InlineVolumeSpec != nil && source.InlineVolumeSpec.CSI != nil {
+			state.inlineAttachments[source.InlineVolumeSpec.CSI.VolumeHandle] = attachment.Spec.NodeName
+		}
+	}
+	return state, nil
+}
+
+// handsOffSnapshot reports why the TrueNAS snapshot or dataset name must be
+// left to democratic-csi, or "" when the engine may delete it. It records PV
+// deletions it observes so the hands-off window outlives the PV.
+func (e *Engine) handsOffSnapshot(state *csiState, name string) string {
+	dataset, _, _ := strings.Cut(name, "@")
+	leaf := path.Base(dataset)
+	now := e.clock.Now()
+
+	pvName := leaf
+	if pv, ok := state.pvs[leaf]; ok {
+		pvName = pv.Name
+		if pv.DeletionTimestamp != nil {
+			e.mu.Lock()
+			e.pvDeletions[leaf] = pv.DeletionTimestamp.Time
+			e.mu.Unlock()
+			return fmt.Sprintf("PV %s is being deleted by the CSI driver (finalizers: %s)", pv.Name, strings.Join(pv.Finalizers, ", "))
+		}
+	}
+	if node, ok := state.attachments[pvName]; ok {
+		if _, live := state.pvs[leaf]; !live {
+			return fmt.Sprintf("PV %s is gone but still attached to node %s", pvName, node)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	deletedAt, ok := e.pvDeletions[leaf]
+	if !ok {
+		return ""
+	}
+	if since := now.Sub(deletedAt); since < e.opts.HandsOffWindow {
+		return fmt.Sprintf("PV %s was deleted %s ago, within the %s hands-off window", pvName, since.Round(time.Second), e.opts.HandsOffWindow)
+	}
+	delete(e.pvDeletions, leaf)
+	return ""
+}
+
+// handsOffDataset reports why the TrueNAS dataset or snapshot name must be
+// left alone, or "" when the engine may delete it. On top of the
+// handsOffSnapshot checks, it refuses while any PV, live or terminating, or
+// any VolumeAttachment references the dataset, snapshots included, since
+// the job goes on to delete the dataset of a volume Kubernetes still uses.
+func (e *Engine) handsOffDataset(state *csiState, name string) string {
+	if reason := e.handsOffSnapshot(state, name); reason != "" {
+		return reason
+	}
+	dataset, _, _ := strings.Cut(name, "@")
+	dataset = strings.Trim(dataset, "/")
+	for _, pv := range state.volumes {
+		if !pvReferencesDataset(pv, dataset) {
+			continue
+		}
+		if node, ok := state.attachments[pv.Name]; ok {
+			return fmt.Sprintf("PV %s references dataset %s and is attached to node %s", pv.Name, dataset, node)
+		}
+		if pv.Spec.ClaimRef != nil {
+			return fmt.Sprintf("PV %s references dataset %s and is bound to %s/%s", pv.Name, dataset, pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
+		}
+		return fmt.Sprintf("PV %s references dataset %s", pv.Name, dataset)
+	}
+	for handle, node := range state.inlineAttachments {
+		if handleReferencesDataset(handle, dataset) {
+			return fmt.Sprintf("inline volume %s references dataset %s and is attached to node %s", handle, dataset, node)
+		}
+	}
+	return ""
+}
+
+// pvReferencesDataset reports whether the PV's CSI volume handle or one of
+// its volume attributes, such as an NFS share path, names dataset.
+func pvReferencesDataset(pv *corev1.PersistentVolume, dataset string) bool {
+	csi := pv.Spec.CSI
+	if csi == nil {
+		return false
+	}
+	if handleReferencesDataset(csi.VolumeHandle, dataset) {
+		return true
+	}
+	for _, value := range csi.VolumeAttributes {
+		value = strings.TrimRight(value, "/")
+		if value == dataset || strings.HasSuffix(value, "/"+dataset) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReferencesDataset reports whether a volume handle names dataset: as
+// the full dataset path or a mount path ending in it, or, for the bare names
+// and iSCSI IQNs democratic-csi uses, as the dataset's last component.
+// Matching bare names on the leaf errs on the side of refusing.
+func handleReferencesDataset(handle, dataset string) bool {
+	handle = strings.TrimRight(strings.TrimSpace(handle), "/")
+	if handle == "" {
+		return false
+	}
+	if handle == dataset || strings.HasSuffix(handle, "/"+dataset) {
+		return true
+	}
+	if strings.Contains(handle, "/") {
+		return false
+	}
+	if idx := strings.LastIndex(handle, ":"); idx >= 0 {
+		handle = handle[idx+1:]
+	}
+	return handle == path.Base(dataset)
+}
+
+// handsOffContent reports why the VolumeSnapshotContent name must be left
+// to the snapshot controller, or "" when the engine may delete it.
+func (e *Engine) handsOffContent(state *csiState, name string) string {
+	content, ok := state.contents[name]
+	if !ok || content.DeletionTimestamp == nil {
+		return ""
+	}
+	return fmt.Sprintf("already being deleted (finalizers: %s)", strings.Join(content.Finalizers, ", "))
+}
+
+// verifyContents waits up to VerifyTimeout for the VolumeSnapshotContents
+// the job deleted to disappear, and fails those still wedged on finalizers.
+func (e *Engine) verifyContents(ctx context.Context, j *job) {
+	e.mu.Lock()
+	var pending []int
+	for i, item := range j.Items {
+		if item.Status == ItemDeleted {
+			pending = append(pending, i)
+		}
+	}
+	e.mu.Unlock()
+	if len(pending) == 0 || e.k8sClient == nil {
+		return
+	}
+
+	deadline := time.Now().Add(e.opts.VerifyTimeout)
+	var remaining map[string]*snapshotv1.VolumeSnapshotContent
+	for {
+		contents, err := e.k8sClient.ListVolumeSnapshotContents(ctx)
+		if err != nil {
+			e.logger.Warn("Failed to verify VolumeSnapshotContent deletions", zap.String("job_id", j.ID), logging.RedactedError(err))
+			return
+		}
+		remaining = make(map[string]*snapshotv1.VolumeSnapshotContent)
+		for i := range contents {
+			remaining[contents[i].Name] = &contents[i]
+		}
+		left := pending[:0]
+		e.mu.Lock()
+		for _, i := range pending {
+			if _, ok := remaining[j.Items[i].Name]; ok {
+				left = append(left, i)
+			}
+		}
+		e.mu.Unlock()
+		pending = left
+		if len(pending) == 0 || !time.Now().Before(deadline) || !sleep(ctx, verifyInterval(e.opts.VerifyTimeout)) {
+			break
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, i := range pending {
+		item := &j.Items[i]
+		content := remaining[item.Name]
+		if content == nil {
+			continue
+		}
+		item.Status = ItemFailed
+		item.Error = fmt.Sprintf("deletion did not progress within %s (finalizers: %s)", e.opts.VerifyTimeout, strings.Join(content.Finalizers, ", "))
+		j.Deleted--
+		j.Failed++
+		e.logger.Warn("Cleanup deletion is wedged", zap.String("job_id", j.ID), zap.String("type", j.Type), zap.String("name", item.Name), zap.Strings("finalizers", content.Finalizers))
+	}
+}
+
+// verifyInterval polls ten times within timeout, at most once a second.
+func verifyInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 10
+	if interval > time.Second {
+		interval = time.Second
+	}
+	return interval
+}
@@ -0,0 +1,36 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_AdvanceAndSet(t *testing.T) {
+	start := time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC)
+	fake := NewFake(start)
+
+	if got := fake.Now(); !got.Equal(start) {
+		t.Fatalf("Now() = %v, want %v", got, start)
+	}
+
+	fake.Advance(time.Hour)
+	if got := fake.Now(); !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("after Advance, Now() = %v", got)
+	}
+
+	later := start.Add(24 * time.Hour)
+	fake.Set(later)
+	if got := fake.Now(); !got.Equal(later) {
+		t.Fatalf("after Set, Now() = %v, want %v", got, later)
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	if _, ok := OrReal(nil).(realClock); !ok {
+		t.Fatal("OrReal(nil) should return the real clock")
+	}
+	fake := NewFake(time.Unix(0, 0))
+	if OrReal(fake) != Clock(fake) {
+		t.Fatal("OrReal should keep a non-nil clock")
+	}
+}
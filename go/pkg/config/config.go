@@ -2,12 +2,22 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
 )
 
 // Config represents the application configuration
@@ -19,13 +29,42 @@ type Config struct {
 	Alerts     AlertsConfig     `yaml:"alerts"`
 	Logging    LoggingConfig    `yaml:"logging"`
 	Security   SecurityConfig   `yaml:"security"`
+	API        APIConfig        `yaml:"api"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Cleanup    CleanupConfig    `yaml:"cleanup"`
+	Reports    ReportsConfig    `yaml:"reports"`
+	Store      StoreConfig      `yaml:"store"`
+	// ReadOnly wraps the Kubernetes and TrueNAS clients in guards that
+	// refuse every write, and turns off the features that write: snapshot
+	// cleanup, quota remediation and orphan Events.
+	ReadOnly bool `yaml:"read_only"`
+	// Warnings lists the deprecated keys Load mapped and the unknown keys
+	// it ignored, for the caller to log.
+	Warnings []string `yaml:"-"`
 }
 
 // KubernetesConfig holds Kubernetes connection settings
 type KubernetesConfig struct {
 	Kubeconfig string `yaml:"kubeconfig"`
-	Namespace  string `yaml:"namespace"`
-	InCluster  bool   `yaml:"in_cluster"`
+	// Context selects a kubeconfig context instead of its current-context.
+	Context   string `yaml:"context"`
+	Namespace string `yaml:"namespace"`
+	InCluster bool   `yaml:"in_cluster"`
+	// Impersonate makes every Kubernetes request act as another identity.
+	Impersonate ImpersonationConfig `yaml:"impersonate"`
+	// CSIPodSelector is the label selector used to find democratic-csi pods.
+	CSIPodSelector string `yaml:"csi_pod_selector"`
+	// ListPageSize is the number of objects requested per list call (0 = 500).
+	ListPageSize int64 `yaml:"list_page_size"`
+}
+
+// ImpersonationConfig is the identity Kubernetes requests impersonate, such
+// as system:serviceaccount:<namespace>:<name> for read-only scans. Groups
+// and UID require a user.
+type ImpersonationConfig struct {
+	User   string   `yaml:"user"`
+	Groups []string `yaml:"groups"`
+	UID    string   `yaml:"uid"`
 }
 
 // TrueNASConfig holds TrueNAS connection settings
@@ -36,18 +75,335 @@ type TrueNASConfig struct {
 	Timeout  string `yaml:"timeout"`
 	Insecure bool   `yaml:"insecure"`
 	CAFile   string `yaml:"ca_file"`
+	// MaintenanceGrace is how long 503 responses or refused connections are
+	// treated as maintenance (HA failover) before scans fail (0 = 5m).
+	MaintenanceGrace time.Duration `yaml:"maintenance_grace"`
+	// JobTimeout bounds the wait for long-running TrueNAS jobs, such as a
+	// snapshot delete run as a job, before they are reported as failed
+	// (0 = 5m).
+	JobTimeout time.Duration `yaml:"job_timeout"`
+	// ProxyURL is an HTTP(S) CONNECT proxy for TrueNAS requests. Empty
+	// honors HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+	ProxyURL string `yaml:"proxy_url"`
+	// ResolveOverride maps host names to the IP addresses dialed in their
+	// place; TLS still verifies the host name.
+	ResolveOverride map[string]string `yaml:"resolve_override"`
+	// Pool and ParentDataset name where democratic-csi provisions. When
+	// set they are checked at startup, on every scan and by
+	// GET /api/v1/validate; a parent dataset alone implies its pool.
+	Pool          string `yaml:"pool"`
+	ParentDataset string `yaml:"parent_dataset"`
+	// MissingPool is what startup does when the pool or parent dataset does
+	// not exist: "warn" (default) logs and marks scans degraded, "fail"
+	// exits.
+	MissingPool string `yaml:"missing_pool"`
+	// StrictParsing logs a warning with a payload excerpt when a pool,
+	// dataset or snapshot returned by TrueNAS lacks an expected field.
+	// Such items are counted in truenas_api_parse_anomalies_total either way.
+	StrictParsing bool `yaml:"strict_parsing"`
 }
 
+// TrueNASConfig.MissingPool values.
+const (
+	MissingPoolWarn = "warn"
+	MissingPoolFail = "fail"
+)
+
 // MonitorConfig holds monitoring settings
 type MonitorConfig struct {
-	ScanInterval     time.Duration `yaml:"scan_interval"`
-	OrphanThreshold  time.Duration `yaml:"orphan_threshold"`
-	SnapshotRetention time.Duration `yaml:"snapshot_retention"`
+	ScanInterval         time.Duration              `yaml:"scan_interval"`
+	OrphanThreshold      time.Duration              `yaml:"orphan_threshold"`
+	SnapshotRetention    time.Duration              `yaml:"snapshot_retention"`
+	OrphanThresholds     OrphanThresholdsConfig     `yaml:"orphan_thresholds"`
+	StartupJitter        float64                    `yaml:"startup_jitter"`
+	PhaseTimeouts        PhaseTimeoutsConfig        `yaml:"phase_timeouts"`
+	SnapshotSchedules    []SnapshotScheduleConfig   `yaml:"snapshot_schedules"`
+	IncrementalSnapshots IncrementalSnapshotsConfig `yaml:"incremental_snapshots"`
+	NamespacePriority    NamespacePriorityConfig    `yaml:"namespace_priority"`
+	Exclusions           ExclusionsConfig           `yaml:"exclusions"`
+	NFSDeepCheck         NFSDeepCheckConfig         `yaml:"nfs_deep_check"`
+	ISCSISessions        ISCSISessionsConfig        `yaml:"iscsi_sessions"`
+	IOStats              IOStatsConfig              `yaml:"io_stats"`
+	Quotas               QuotasConfig               `yaml:"quotas"`
+	SnapshotAges         SnapshotAgesConfig         `yaml:"snapshot_ages"`
+	SnapshotHeavy        SnapshotHeavyConfig        `yaml:"snapshot_heavy"`
+	ProvisioningLatency  ProvisioningLatencyConfig  `yaml:"provisioning_latency"`
+	OrphanEvents         OrphanEventsConfig         `yaml:"orphan_events"`
+	InventoryDrift       InventoryDriftConfig       `yaml:"inventory_drift"`
+	RestoreCanary        RestoreCanaryConfig        `yaml:"restore_canary"`
+	PhaseFlapping        PhaseFlappingConfig        `yaml:"phase_flapping"`
+	AbandonedDatasets    AbandonedDatasetsConfig    `yaml:"abandoned_datasets"`
+	BackupCoverage       BackupCoverageConfig       `yaml:"backup_coverage"`
+	// ScanStateFile persists the latest scan and its diff against the
+	// previous one. The API server reads it for GET /api/v1/scan/diff.
+	ScanStateFile string `yaml:"scan_state_file"`
+	// StrictSnapshots reports TrueNAS snapshots created by periodic snapshot
+	// tasks or received by replication tasks as orphans too.
+	StrictSnapshots bool `yaml:"strict_snapshots"`
+	// OrphanGroupWindow is the creation window within which orphans of the
+	// same type, namespace, storage class and cause are grouped into one
+	// incident (0 = 10m). Alerts fire per group.
+	OrphanGroupWindow time.Duration `yaml:"orphan_group_window"`
+	// RequestBudget warns about scans sending more requests to a backend.
+	RequestBudget RequestBudgetConfig `yaml:"request_budget"`
+}
+
+// IOStatsConfig controls hot/warm/cold classification of PV datasets from
+// TrueNAS reporting data
+type IOStatsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Window is the averaging period (0 = 24h).
+	Window time.Duration `yaml:"window"`
+	// Datasets at or above HotBytesPerSecond are hot, below
+	// ColdBytesPerSecond cold (0 = 1MiB/s and 1KiB/s).
+	HotBytesPerSecond  float64 `yaml:"hot_bytes_per_second"`
+	ColdBytesPerSecond float64 `yaml:"cold_bytes_per_second"`
+	// TopN limits throughput gauges to the busiest datasets (0 = 20).
+	TopN int `yaml:"top_n"`
+}
+
+// QuotasConfig controls refquota recommendations for PV datasets
+type QuotasConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SlackPercent is added to the PV capacity for suggested refquotas (0 = 10).
+	SlackPercent float64 `yaml:"slack_percent"`
+	// Remediation lets POST /api/v1/admin/quotas/apply set the suggested
+	// refquotas on TrueNAS.
+	Remediation bool `yaml:"remediation"`
+}
+
+// SnapshotAgesConfig controls the snapshot age distribution
+type SnapshotAgesConfig struct {
+	// Enabled exports snapshot counts per age bucket on every scan.
+	Enabled bool `yaml:"enabled"`
+	// Buckets are ascending, inclusive upper bounds of the age buckets
+	// (empty = 24h, 168h, 720h, 2160h, 8760h). They also apply to the
+	// snapshot_ages of the storage analysis.
+	Buckets []time.Duration `yaml:"buckets"`
+}
+
+// OrphanThresholdsConfig overrides the orphan age threshold per resource
+// type. Unset types use orphan_threshold, and TrueNAS snapshots
+// snapshot_retention. A resource exactly as old as its threshold is reported.
+type OrphanThresholdsConfig struct {
+	PersistentVolume      time.Duration `yaml:"persistent_volume"`
+	PersistentVolumeClaim time.Duration `yaml:"persistent_volume_claim"`
+	VolumeSnapshot        time.Duration `yaml:"volume_snapshot"`
+	TrueNASSnapshot       time.Duration `yaml:"truenas_snapshot"`
+	TrueNASVolume         time.Duration `yaml:"truenas_volume"`
+}
+
+// AgeThresholds converts the overrides for orphan.Config.
+func (o OrphanThresholdsConfig) AgeThresholds() orphan.AgeThresholds {
+	return orphan.AgeThresholds{
+		PersistentVolume:      o.PersistentVolume,
+		PersistentVolumeClaim: o.PersistentVolumeClaim,
+		VolumeSnapshot:        o.VolumeSnapshot,
+		TrueNASSnapshot:       o.TrueNASSnapshot,
+		TrueNASVolume:         o.TrueNASVolume,
+	}
+}
+
+// validate rejects overrides below orphan.MinAgeThreshold.
+func (o OrphanThresholdsConfig) validate() error {
+	thresholds := []struct {
+		name      string
+		threshold time.Duration
+	}{
+		{"persistent_volume", o.PersistentVolume},
+		{"persistent_volume_claim", o.PersistentVolumeClaim},
+		{"volume_snapshot", o.VolumeSnapshot},
+		{"truenas_snapshot", o.TrueNASSnapshot},
+		{"truenas_volume", o.TrueNASVolume},
+	}
+	for _, t := range thresholds {
+		if t.threshold != 0 && t.threshold < orphan.MinAgeThreshold {
+			return fmt.Errorf("monitor.orphan_thresholds.%s must be 0 or at least %s", t.name, orphan.MinAgeThreshold)
+		}
+	}
+	return nil
+}
+
+// SnapshotHeavyConfig controls the snapshot-heavy volumes recommendation of
+// the storage analysis
+type SnapshotHeavyConfig struct {
+	// Ratio of snapshot to used bytes above which a volume is listed (0 = 0.5).
+	Ratio float64 `yaml:"ratio"`
+	// TopN limits the volumes named in the recommendation (0 = 5).
+	TopN int `yaml:"top_n"`
+}
+
+// ProvisioningLatencyConfig controls the PVC provisioning latency histogram
+type ProvisioningLatencyConfig struct {
+	// Enabled measures PVCs bound within Window on every scan.
+	Enabled bool `yaml:"enabled"`
+	// Window is how far back bound PVCs are included in the p50/p95
+	// summary (0 = 24h).
+	Window time.Duration `yaml:"window"`
+}
+
+// InventoryDriftConfig alerts when the democratic-csi PVs and the managed
+// TrueNAS volumes drift apart, which usually means the CSI driver or volume
+// handle correlation is broken. Zero disables a threshold.
+type InventoryDriftConfig struct {
+	// MaxUnmatched is the most unmatched PVs and volumes, together, allowed.
+	MaxUnmatched int `yaml:"max_unmatched"`
+	// MaxPercent is the most drift allowed as a percentage (0-100) of the
+	// larger inventory.
+	MaxPercent float64 `yaml:"max_percent"`
+}
+
+// PhaseFlappingConfig flags PVs whose phase changes more than
+// MaxTransitions times within Window across scans, such as a PV
+// oscillating between Bound and Released.
+type PhaseFlappingConfig struct {
+	// Window is the rolling window transitions are counted in (0 = 24h).
+	Window time.Duration `yaml:"window"`
+	// MaxTransitions is the most transitions allowed within Window (0 = 3).
+	MaxTransitions int `yaml:"max_transitions"`
+}
+
+// AbandonedDatasetsConfig flags managed datasets without a PV that linger
+// because their snapshots hold their data.
+type AbandonedDatasetsConfig struct {
+	// Enabled checks for abandoned datasets on every scan.
+	Enabled bool `yaml:"enabled"`
+	// MinAge is how long a dataset must have gone without a new snapshot
+	// (0 = 720h).
+	MinAge time.Duration `yaml:"min_age"`
+	// SnapshotShare is the share (0-1] of a dataset's used bytes its
+	// snapshots must hold (0 = 0.9).
+	SnapshotShare float64 `yaml:"snapshot_share"`
+	// TopN limits the datasets listed in the summary report (0 = 10).
+	TopN int `yaml:"top_n"`
+}
+
+// BackupCoverageConfig requires the PVCs its policies select to have a
+// recent ready VolumeSnapshot and reports datasets with ZFS snapshots but no
+// VolumeSnapshot. The check runs when at least one policy is configured.
+type BackupCoverageConfig struct {
+	// MaxAge is how old a selected PVC's newest VolumeSnapshot may be
+	// (0 = 24h); a policy's own max_age overrides it.
+	MaxAge time.Duration `yaml:"max_age"`
+	// FloorPercent raises a warning alert for every namespace whose coverage
+	// is below it (0 = no alerts).
+	FloorPercent float64                      `yaml:"floor_percent"`
+	Policies     []BackupCoveragePolicyConfig `yaml:"policies"`
+}
+
+// BackupCoveragePolicyConfig selects the PVCs in matching namespaces that
+// carry all Labels. Empty Namespaces or Labels select everything.
+type BackupCoveragePolicyConfig struct {
+	// Namespaces are path.Match patterns, e.g. prod-*.
+	Namespaces []string          `yaml:"namespaces"`
+	Labels     map[string]string `yaml:"labels"`
+	// MaxAge overrides monitor.backup_coverage.max_age for these PVCs.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// RequestBudgetConfig is the number of requests one scan may send to each
+// backend before the monitor logs a warning (0 = unlimited). Retries count.
+type RequestBudgetConfig struct {
+	Kubernetes int64 `yaml:"kubernetes"`
+	TrueNAS    int64 `yaml:"truenas"`
 }
 
-// MetricsConfig holds metrics export settings
+// RestoreCanaryConfig controls the restore canary: a periodic snapshot,
+// clone, verify and destroy cycle on a test dataset proving that snapshots
+// can be restored.
+type RestoreCanaryConfig struct {
+	// Enabled runs the canary in the monitor. It writes to TrueNAS, so
+	// read_only disables it.
+	Enabled bool `yaml:"enabled"`
+	// Dataset is the test dataset, e.g. tank/restore-canary. Clones are
+	// created next to it.
+	Dataset string `yaml:"dataset"`
+	// Interval is the time between runs (0 = 24h, at least 1m).
+	Interval time.Duration `yaml:"interval"`
+	// AllowedDatasets may be used as Dataset even though they back a PV.
+	AllowedDatasets []string `yaml:"allowed_datasets"`
+}
+
+// OrphanEventsConfig controls the Warning Events posted on newly detected
+// orphans. Writes are deduplicated per resource and rate-limited so a large
+// scan does not trip apiserver priority and fairness.
+type OrphanEventsConfig struct {
+	// Enabled posts one Event per new orphaned PV, PVC or VolumeSnapshot.
+	// It needs the create verb on events.
+	Enabled bool `yaml:"enabled"`
+	// OpsPerSecond and Burst size the write token bucket (0 = 5/s and a
+	// burst of OpsPerSecond, at least 1).
+	OpsPerSecond float64 `yaml:"ops_per_second"`
+	Burst        int     `yaml:"burst"`
+	// Workers is how many goroutines drain the write queue (0 = 2).
+	Workers int `yaml:"workers"`
+}
+
+// NFSDeepCheckConfig controls the sampled NFS share mountpoint check
+type NFSDeepCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SampleRate is the fraction of NFS PVs checked per scan (0 = all).
+	SampleRate float64 `yaml:"sample_rate"`
+}
+
+// ISCSISessionsConfig controls the iSCSI session check of attached PVs
+type ISCSISessionsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// NodeInitiators maps node names to their initiator IQN; other nodes
+	// are matched to sessions by their addresses.
+	NodeInitiators map[string]string `yaml:"node_initiators"`
+}
+
+// ExclusionsConfig lists resources left out of orphan reports
+type ExclusionsConfig struct {
+	Names       []string          `yaml:"names"`
+	Patterns    []string          `yaml:"patterns"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// IncrementalSnapshotsConfig controls incremental TrueNAS snapshot listing
+type IncrementalSnapshotsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// FullRelistEvery forces a full listing every N scans (0 = 12).
+	FullRelistEvery int `yaml:"full_relist_every"`
+}
+
+// NamespacePriorityConfig limits VolumeSnapshot correlation on clusters with
+// many namespaces to the most active ones and a rotating share of the rest
+type NamespacePriorityConfig struct {
+	// Enabled turns prioritization on; off (the default), every namespace
+	// is correlated on every scan.
+	Enabled bool `yaml:"enabled"`
+	// TopK namespaces with the most PVC and VolumeSnapshot churn are
+	// correlated on every scan (0 = 20).
+	TopK int `yaml:"top_k"`
+	// CoveragePeriod bounds the time between two correlations of any
+	// namespace (0 = 1h).
+	CoveragePeriod time.Duration `yaml:"coverage_period"`
+}
+
+// SnapshotScheduleConfig is the expected snapshot cadence for one StorageClass
+type SnapshotScheduleConfig struct {
+	StorageClass string        `yaml:"storage_class"`
+	Cadence      time.Duration `yaml:"cadence"`
+	MinCount     int           `yaml:"min_count"`
+}
+
+// PhaseTimeoutsConfig bounds individual scan phases. Zero disables a bound.
+type PhaseTimeoutsConfig struct {
+	K8sList     time.Duration `yaml:"k8s_list"`
+	TrueNASList time.Duration `yaml:"truenas_list"`
+	Correlation time.Duration `yaml:"correlation"`
+}
+
+// MetricsConfig holds metrics export settings. The monitor's HTTP server
+// listens on Address and Port even when Enabled is false, for /ready.
 type MetricsConfig struct {
-	Enabled bool   `yaml:"enabled"`
+	Enabled bool `yaml:"enabled"`
+	// Address is the interface to listen on, e.g. 127.0.0.1 when a sidecar
+	// scrapes the metrics; empty listens on all interfaces.
+	Address string `yaml:"address"`
 	Port    int    `yaml:"port"`
 	Path    string `yaml:"path"`
 }
@@ -55,6 +411,76 @@ type MetricsConfig struct {
 // AlertsConfig holds alerting settings
 type AlertsConfig struct {
 	Slack SlackConfig `yaml:"slack"`
+	// Routes are evaluated in order; the first match wins and unmatched
+	// alerts go to DefaultRoute (the Slack channel when it has no destinations).
+	Routes       []AlertRouteConfig   `yaml:"routes"`
+	DefaultRoute AlertRouteConfig     `yaml:"default_route"`
+	Silences     []AlertSilenceConfig `yaml:"silences"`
+	// StateFile persists active alerts and acknowledgements. The monitor and
+	// API server must share it for GET /api/v1/alerts; empty keeps alerts in
+	// monitor memory only.
+	StateFile string `yaml:"state_file"`
+	// RenotifyInterval re-sends unacknowledged alerts (0 = 4h).
+	RenotifyInterval time.Duration `yaml:"renotify_interval"`
+	// TrueNAS pulls alerts from the TrueNAS alert subsystem.
+	TrueNAS TrueNASAlertsConfig `yaml:"truenas"`
+	// Required fails startup when a destination does not accept the test
+	// notification sent at startup; otherwise failures are only logged.
+	Required bool `yaml:"required"`
+	// Digest batches non-critical alerts of one category into one message.
+	Digest AlertDigestConfig `yaml:"digest"`
+}
+
+// AlertDigestConfig batches bursts of alerts into digests
+type AlertDigestConfig struct {
+	// Window is the aggregation window of routes without their own
+	// digest_window; 0 sends every alert at once.
+	Window time.Duration `yaml:"window"`
+	// TopN bounds the resources named in a digest (0 = 10).
+	TopN int `yaml:"top_n"`
+	// APIURL is the API server base URL linked from digests for details.
+	APIURL string `yaml:"api_url"`
+}
+
+// TrueNASAlertsConfig controls importing TrueNAS native alerts
+type TrueNASAlertsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Forward sends TrueNAS alerts through the alert routes; otherwise they
+	// are only listed by GET /api/v1/alerts.
+	Forward bool `yaml:"forward"`
+}
+
+// AlertMatchConfig selects alerts; empty lists match anything
+type AlertMatchConfig struct {
+	Sources    []string `yaml:"sources"`
+	Levels     []string `yaml:"levels"`
+	Categories []string `yaml:"categories"`
+	Namespaces []string `yaml:"namespaces"`
+	Pools      []string `yaml:"pools"`
+}
+
+// AlertDestinationConfig is a Slack channel, webhook or email list
+type AlertDestinationConfig struct {
+	Type    string   `yaml:"type"`
+	Channel string   `yaml:"channel"`
+	URL     string   `yaml:"url"`
+	To      []string `yaml:"to"`
+}
+
+// AlertRouteConfig maps matching alerts to destinations
+type AlertRouteConfig struct {
+	Name         string                   `yaml:"name"`
+	Match        AlertMatchConfig         `yaml:"match"`
+	Destinations []AlertDestinationConfig `yaml:"destinations"`
+	// DigestWindow overrides alerts.digest.window for this route.
+	DigestWindow time.Duration `yaml:"digest_window"`
+}
+
+// AlertSilenceConfig suppresses matching alerts until Expires
+type AlertSilenceConfig struct {
+	Match   AlertMatchConfig `yaml:"match"`
+	Expires time.Time        `yaml:"expires"`
+	Comment string           `yaml:"comment"`
 }
 
 // SlackConfig holds Slack webhook settings
@@ -68,6 +494,198 @@ type LoggingConfig struct {
 	Level       string `yaml:"level"`
 	Development bool   `yaml:"development"`
 	Encoding    string `yaml:"encoding"`
+	// AccessLog tunes the API server's HTTP access log.
+	AccessLog AccessLogConfig `yaml:"access_log"`
+}
+
+// AccessLogConfig tunes the HTTP access log. Requests answered 4xx or 5xx
+// are always logged.
+type AccessLogConfig struct {
+	// SkipPaths are path prefixes whose successful requests are not logged
+	// (default /health, /ready and /metrics; [] logs every path).
+	SkipPaths []string `yaml:"skip_paths"`
+	// SuccessSampleRate is the fraction of other successful requests
+	// logged (0 = all).
+	SuccessSampleRate float64 `yaml:"success_sample_rate"`
+}
+
+// APIConfig holds API server request limits. Zero values use the API
+// server defaults (30s reads, 5m reports, 1MB bodies, 2m backend calls,
+// 10m scan age, 1,000 list items).
+type APIConfig struct {
+	// Address is the interface the API server listens on; empty listens on
+	// all interfaces.
+	Address string `yaml:"address"`
+	// Port is the API server port. 0 uses the -port flag (default 8080),
+	// which also overrides a set port.
+	Port          int           `yaml:"port"`
+	ReadTimeout   time.Duration `yaml:"read_timeout"`
+	ReportTimeout time.Duration `yaml:"report_timeout"`
+	MaxBodyBytes  int64         `yaml:"max_body_bytes"`
+	// BackendTimeout bounds the Kubernetes and TrueNAS calls of a request.
+	BackendTimeout time.Duration `yaml:"backend_timeout"`
+	// MaxScanAge is the age up to which the monitor's last scan (from
+	// monitor.scan_state_file) answers orphan and CSI health reads.
+	MaxScanAge time.Duration `yaml:"max_scan_age"`
+	// MaxListItems caps each orphan list of an API response; the rest is
+	// paged with a cursor.
+	MaxListItems int `yaml:"max_list_items"`
+	// UI serves the web UI at / of the API server.
+	UI APIUIConfig `yaml:"ui"`
+	// V1Deprecation announces the retirement of /api/v1 in its response
+	// headers.
+	V1Deprecation APIV1DeprecationConfig `yaml:"v1_deprecation"`
+}
+
+// APIV1DeprecationConfig is the deprecation timeline of /api/v1. Unset
+// times send no Deprecation or Sunset header.
+type APIV1DeprecationConfig struct {
+	// DeprecatedAt is sent as the Deprecation header.
+	DeprecatedAt time.Time `yaml:"deprecated_at"`
+	// SunsetAt is sent as the Sunset header: when /api/v1 stops being
+	// served.
+	SunsetAt time.Time `yaml:"sunset_at"`
+	// Link is a page documenting the migration, sent as a Link header with
+	// rel="deprecation".
+	Link string `yaml:"link"`
+}
+
+// APIUIConfig toggles the web UI embedded in the API server.
+type APIUIConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// TracingConfig holds trace export settings. Spans are sent to an
+// OpenTelemetry collector such as Tempo over OTLP/HTTP.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the collector base URL, e.g. http://tempo:4318.
+	Endpoint string `yaml:"endpoint"`
+	// SampleRatio is the fraction of scans and requests traced (0-1).
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// CleanupConfig enables snapshot cleanup jobs on the API server and sets
+// their pace. Zero values use the cleanup package defaults.
+type CleanupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// BatchSize deletions run between pauses of BatchDelay.
+	BatchSize  int           `yaml:"batch_size"`
+	BatchDelay time.Duration `yaml:"batch_delay"`
+	// MaxOpsPerMinute caps deletions across all jobs.
+	MaxOpsPerMinute int `yaml:"max_ops_per_minute"`
+	// FailureThreshold is the fraction of failed deletions in a batch above
+	// which a job pauses and raises an alert.
+	FailureThreshold float64 `yaml:"failure_threshold"`
+	// DeferDestroy deletes snapshots with the ZFS defer option: snapshots
+	// with holds or clones are marked for destroy and reported as deferred
+	// instead of failing.
+	DeferDestroy bool `yaml:"defer_destroy"`
+	// HandsOffWindow is how long after democratic-csi starts deleting a PV
+	// the snapshots of its dataset are left alone.
+	HandsOffWindow time.Duration `yaml:"hands_off_window"`
+	// JobRetention is how long a finished job stays listed.
+	JobRetention time.Duration `yaml:"job_retention"`
+	// MaxFinishedJobs caps the finished jobs kept, oldest pruned first.
+	MaxFinishedJobs int `yaml:"max_finished_jobs"`
+}
+
+// ReportsConfig customizes the HTML reports of the API server. Empty
+// values use the embedded default template and its sections.
+type ReportsConfig struct {
+	// TemplateDir holds *.html.tmpl files that override or add report
+	// sections. They are checked at startup.
+	TemplateDir string `yaml:"template_dir"`
+	// Sections lists the sections rendered, in order.
+	Sections     []string `yaml:"sections"`
+	Title        string   `yaml:"title"`
+	Organization string   `yaml:"organization"`
+	LogoURL      string   `yaml:"logo_url"`
+	// PoolUtilizationPercent is highlighted in the threshold table
+	// (default 80).
+	PoolUtilizationPercent float64 `yaml:"pool_utilization_percent"`
+	// Schedules generate and deliver reports from the monitor.
+	Schedules []ReportScheduleConfig `yaml:"schedules"`
+	// ScheduleStateFile keeps schedule run times and pause flags. Point the
+	// monitor and API server at the same file to serve
+	// GET /api/v1/reports/schedules.
+	ScheduleStateFile string `yaml:"schedule_state_file"`
+	// Backfill runs a schedule once at startup when it missed a trigger
+	// while the monitor was down.
+	Backfill bool             `yaml:"backfill"`
+	SMTP     ReportSMTPConfig `yaml:"smtp"`
+	S3       ReportS3Config   `yaml:"s3"`
+	// Artifacts keeps reports generated through the API server for
+	// download.
+	Artifacts ReportArtifactsConfig `yaml:"artifacts"`
+}
+
+// ReportArtifactsConfig is where the API server stores generated report
+// files and how long it keeps them. An empty dir disables artifacts.
+type ReportArtifactsConfig struct {
+	// Dir holds the files, typically on a PVC.
+	Dir string `yaml:"dir"`
+	// Retention is how long a file is kept (default 168h).
+	Retention time.Duration `yaml:"retention"`
+	// MaxBytes caps the total size of the files, oldest pruned first
+	// (default 1 GiB).
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+// ReportScheduleConfig is one scheduled report.
+type ReportScheduleConfig struct {
+	Name string `yaml:"name"`
+	// Cron is a five-field cron expression in the monitor's time zone.
+	Cron    string               `yaml:"cron"`
+	Type    string               `yaml:"type"`
+	Format  string               `yaml:"format"`
+	Targets []ReportTargetConfig `yaml:"targets"`
+}
+
+// ReportTargetConfig is where a scheduled report is delivered: slack
+// (channel, optional url), email (to) or s3 (bucket, prefix).
+type ReportTargetConfig struct {
+	Type    string   `yaml:"type"`
+	Channel string   `yaml:"channel"`
+	URL     string   `yaml:"url"`
+	To      []string `yaml:"to"`
+	Bucket  string   `yaml:"bucket"`
+	Prefix  string   `yaml:"prefix"`
+}
+
+// ReportSMTPConfig is the mail server for email report targets.
+type ReportSMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// ReportS3Config is the S3-compatible store for s3 report targets.
+type ReportS3Config struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+// StoreConfig selects the persistence backend for state kept across
+// restarts and shared by replicas. The store is disabled unless a backend
+// or path is set.
+type StoreConfig struct {
+	// Backend is bolt (one embedded file, typically on a PVC; the default
+	// when path is set) or postgres (shared by several replicas).
+	Backend  string              `yaml:"backend"`
+	Path     string              `yaml:"path"`
+	Postgres PostgresStoreConfig `yaml:"postgres"`
+}
+
+// PostgresStoreConfig is the database of the postgres store backend.
+type PostgresStoreConfig struct {
+	// DSN is the connection string; use ${VAR} to keep the password out of
+	// the file.
+	DSN string `yaml:"dsn"`
 }
 
 // SecurityConfig holds security settings
@@ -77,6 +695,15 @@ type SecurityConfig struct {
 	AllowedOrigins   []string `yaml:"allowed_origins"`
 	RateLimitRPS     int    `yaml:"rate_limit_rps"`
 	SessionTimeout   time.Duration `yaml:"session_timeout"`
+	// AdminToken is the bearer token for the API server's /api/v1/admin
+	// endpoints; they are disabled when it is empty.
+	AdminToken       string `yaml:"admin_token"`
+	// ConfirmationTTL is how long the confirmation token returned by the
+	// dry run of a destructive admin endpoint stays valid (0 = 5m).
+	ConfirmationTTL time.Duration `yaml:"confirmation_ttl"`
+	// SkipConfirmation lets destructive admin endpoints execute on the
+	// first dry_run false request, without a confirmation token.
+	SkipConfirmation bool `yaml:"skip_confirmation"`
 }
 
 // Load reads and parses the configuration file
@@ -104,13 +731,23 @@ func Load(path string) (*Config, error) {
 			Level:       "info",
 			Development: false,
 			Encoding:    "json",
+			AccessLog: AccessLogConfig{
+				SkipPaths: []string{"/health", "/ready", "/metrics"},
+			},
 		},
 		Security: SecurityConfig{
-			TLSMinVersion:  "1.3",
-			RequireAuth:    true,
-			AllowedOrigins: []string{"*"},
-			RateLimitRPS:   100,
-			SessionTimeout: 24 * time.Hour,
+			TLSMinVersion:   "1.3",
+			RequireAuth:     true,
+			AllowedOrigins:  []string{"*"},
+			RateLimitRPS:    100,
+			SessionTimeout:  24 * time.Hour,
+			ConfirmationTTL: 5 * time.Minute,
+		},
+		API: APIConfig{
+			UI: APIUIConfig{Enabled: true},
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
 		},
 	}
 
@@ -126,9 +763,16 @@ func Load(path string) (*Config, error) {
 		// Expand environment variables with enhanced substitution
 		expanded := expandEnvVars(string(data))
 
-		if err := yaml.Unmarshal([]byte(expanded), config); err != nil {
+		// Map the legacy (Python CLI) schema and record unknown keys
+		// instead of dropping them silently
+		migrated, warnings, err := Migrate([]byte(expanded))
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(migrated, config); err != nil {
 			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
+		config.Warnings = warnings
 	}
 
 	// Validate configuration only if file exists
@@ -170,10 +814,24 @@ func expandEnvVars(input string) string {
 
 // validate checks if the configuration is valid
 func (c *Config) validate() error {
+	// Kubernetes validation
+	if c.Kubernetes.ListPageSize < 0 {
+		return fmt.Errorf("kubernetes.list_page_size must not be negative")
+	}
+	if c.Kubernetes.InCluster && c.Kubernetes.Context != "" {
+		return fmt.Errorf("kubernetes.context cannot be used with kubernetes.in_cluster")
+	}
+	if impersonate := c.Kubernetes.Impersonate; impersonate.User == "" && (len(impersonate.Groups) > 0 || impersonate.UID != "") {
+		return fmt.Errorf("kubernetes.impersonate.groups and uid require kubernetes.impersonate.user")
+	}
+
 	// TrueNAS validation
 	if c.TrueNAS.URL == "" {
 		return fmt.Errorf("truenas.url is required")
 	}
+	if _, err := truenas.NormalizeURL(c.TrueNAS.URL); err != nil {
+		return fmt.Errorf("truenas.url: %w", err)
+	}
 
 	if c.TrueNAS.Username == "" {
 		return fmt.Errorf("truenas.username is required")
@@ -198,6 +856,39 @@ func (c *Config) validate() error {
 		}
 	}
 
+	if c.TrueNAS.MaintenanceGrace < 0 {
+		return fmt.Errorf("truenas.maintenance_grace must not be negative")
+	}
+
+	if c.TrueNAS.JobTimeout < 0 {
+		return fmt.Errorf("truenas.job_timeout must not be negative")
+	}
+
+	if c.TrueNAS.ProxyURL != "" {
+		proxyURL, err := url.Parse(c.TrueNAS.ProxyURL)
+		if err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+			return fmt.Errorf("truenas.proxy_url must be an http or https URL")
+		}
+	}
+
+	for host, ip := range c.TrueNAS.ResolveOverride {
+		if host == "" || net.ParseIP(ip) == nil {
+			return fmt.Errorf("truenas.resolve_override[%q] must map a host name to an IP address", host)
+		}
+	}
+
+	if pool, parent := c.TrueNAS.Pool, c.TrueNAS.ParentDataset; pool != "" && parent != "" && !strings.HasPrefix(parent, pool+"/") {
+		return fmt.Errorf("truenas.parent_dataset %q is not in truenas.pool %q", parent, pool)
+	}
+	if c.TrueNAS.Pool != "" && strings.Contains(c.TrueNAS.Pool, "/") {
+		return fmt.Errorf("truenas.pool must be a pool name without \"/\"")
+	}
+	switch c.TrueNAS.MissingPool {
+	case "", MissingPoolWarn, MissingPoolFail:
+	default:
+		return fmt.Errorf("truenas.missing_pool must be %q or %q", MissingPoolWarn, MissingPoolFail)
+	}
+
 	// Monitor validation
 	if c.Monitor.ScanInterval < time.Minute {
 		return fmt.Errorf("monitor.scan_interval must be at least 1 minute")
@@ -211,6 +902,155 @@ func (c *Config) validate() error {
 		return fmt.Errorf("monitor.orphan_threshold must be at least 1 hour")
 	}
 
+	if err := c.Monitor.OrphanThresholds.validate(); err != nil {
+		return err
+	}
+
+	if c.Monitor.OrphanGroupWindow < 0 {
+		return fmt.Errorf("monitor.orphan_group_window must not be negative")
+	}
+
+	if c.Monitor.StartupJitter < 0 || c.Monitor.StartupJitter > 1 {
+		return fmt.Errorf("monitor.startup_jitter must be between 0 and 1")
+	}
+
+	phaseTimeouts := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"k8s_list", c.Monitor.PhaseTimeouts.K8sList},
+		{"truenas_list", c.Monitor.PhaseTimeouts.TrueNASList},
+		{"correlation", c.Monitor.PhaseTimeouts.Correlation},
+	}
+	for _, phase := range phaseTimeouts {
+		if phase.timeout < 0 {
+			return fmt.Errorf("monitor.phase_timeouts.%s must not be negative", phase.name)
+		}
+		if phase.timeout > c.Monitor.ScanInterval {
+			return fmt.Errorf("monitor.phase_timeouts.%s must not exceed monitor.scan_interval", phase.name)
+		}
+	}
+
+	scheduledClasses := make(map[string]bool)
+	for i, schedule := range c.Monitor.SnapshotSchedules {
+		if schedule.StorageClass == "" {
+			return fmt.Errorf("monitor.snapshot_schedules[%d].storage_class is required", i)
+		}
+		if scheduledClasses[schedule.StorageClass] {
+			return fmt.Errorf("monitor.snapshot_schedules: duplicate storage_class %q", schedule.StorageClass)
+		}
+		scheduledClasses[schedule.StorageClass] = true
+		if schedule.Cadence <= 0 {
+			return fmt.Errorf("monitor.snapshot_schedules[%d].cadence must be greater than 0", i)
+		}
+		if schedule.MinCount < 0 {
+			return fmt.Errorf("monitor.snapshot_schedules[%d].min_count must not be negative", i)
+		}
+	}
+
+	if c.Monitor.IncrementalSnapshots.FullRelistEvery < 0 {
+		return fmt.Errorf("monitor.incremental_snapshots.full_relist_every must not be negative")
+	}
+
+	if c.Monitor.NamespacePriority.TopK < 0 || c.Monitor.NamespacePriority.CoveragePeriod < 0 {
+		return fmt.Errorf("monitor.namespace_priority.top_k and coverage_period must not be negative")
+	}
+
+	if c.Monitor.NFSDeepCheck.SampleRate < 0 || c.Monitor.NFSDeepCheck.SampleRate > 1 {
+		return fmt.Errorf("monitor.nfs_deep_check.sample_rate must be between 0 and 1")
+	}
+
+	for node, initiator := range c.Monitor.ISCSISessions.NodeInitiators {
+		if strings.TrimSpace(initiator) == "" {
+			return fmt.Errorf("monitor.iscsi_sessions.node_initiators[%s] must not be empty", node)
+		}
+	}
+
+	if err := c.Monitor.IOStats.validate(); err != nil {
+		return err
+	}
+
+	for i, bound := range c.Monitor.SnapshotAges.Buckets {
+		if bound <= 0 {
+			return fmt.Errorf("monitor.snapshot_ages.buckets[%d] must be greater than 0", i)
+		}
+		if i > 0 && bound <= c.Monitor.SnapshotAges.Buckets[i-1] {
+			return fmt.Errorf("monitor.snapshot_ages.buckets must be in ascending order")
+		}
+	}
+
+	if c.Monitor.SnapshotHeavy.Ratio < 0 {
+		return fmt.Errorf("monitor.snapshot_heavy.ratio must not be negative")
+	}
+	if c.Monitor.SnapshotHeavy.TopN < 0 {
+		return fmt.Errorf("monitor.snapshot_heavy.top_n must not be negative")
+	}
+
+	if c.Monitor.ProvisioningLatency.Window < 0 {
+		return fmt.Errorf("monitor.provisioning_latency.window must not be negative")
+	}
+
+	if c.Monitor.OrphanEvents.OpsPerSecond < 0 {
+		return fmt.Errorf("monitor.orphan_events.ops_per_second must not be negative")
+	}
+	if c.Monitor.OrphanEvents.Burst < 0 {
+		return fmt.Errorf("monitor.orphan_events.burst must not be negative")
+	}
+	if c.Monitor.OrphanEvents.Workers < 0 {
+		return fmt.Errorf("monitor.orphan_events.workers must not be negative")
+	}
+
+	if c.Monitor.InventoryDrift.MaxUnmatched < 0 {
+		return fmt.Errorf("monitor.inventory_drift.max_unmatched must not be negative")
+	}
+	if c.Monitor.InventoryDrift.MaxPercent < 0 || c.Monitor.InventoryDrift.MaxPercent > 100 {
+		return fmt.Errorf("monitor.inventory_drift.max_percent must be between 0 and 100")
+	}
+	if c.Monitor.PhaseFlapping.Window < 0 || c.Monitor.PhaseFlapping.MaxTransitions < 0 {
+		return fmt.Errorf("monitor.phase_flapping.window and monitor.phase_flapping.max_transitions must not be negative")
+	}
+	if c.Monitor.AbandonedDatasets.MinAge < 0 || c.Monitor.AbandonedDatasets.TopN < 0 {
+		return fmt.Errorf("monitor.abandoned_datasets.min_age and monitor.abandoned_datasets.top_n must not be negative")
+	}
+	if share := c.Monitor.AbandonedDatasets.SnapshotShare; share < 0 || share > 1 {
+		return fmt.Errorf("monitor.abandoned_datasets.snapshot_share must be between 0 and 1")
+	}
+	if err := c.Monitor.BackupCoverage.validate(); err != nil {
+		return err
+	}
+	if c.Monitor.RequestBudget.Kubernetes < 0 || c.Monitor.RequestBudget.TrueNAS < 0 {
+		return fmt.Errorf("monitor.request_budget values must not be negative")
+	}
+
+	if canary := c.Monitor.RestoreCanary; canary.Enabled {
+		if canary.Dataset == "" {
+			return fmt.Errorf("monitor.restore_canary.dataset is required when monitor.restore_canary.enabled is set")
+		}
+		if err := truenas.ValidateIdentifier(canary.Dataset); err != nil || strings.Contains(canary.Dataset, "@") || !strings.Contains(canary.Dataset, "/") {
+			return fmt.Errorf("monitor.restore_canary.dataset %q must be a dataset below a pool, e.g. tank/restore-canary", canary.Dataset)
+		}
+		if canary.Interval != 0 && canary.Interval < time.Minute {
+			return fmt.Errorf("monitor.restore_canary.interval must be at least 1m")
+		}
+	}
+
+	if c.Monitor.Quotas.SlackPercent < 0 {
+		return fmt.Errorf("monitor.quotas.slack_percent must not be negative")
+	}
+	if c.Monitor.Quotas.Remediation && !c.Monitor.Quotas.Enabled {
+		return fmt.Errorf("monitor.quotas.remediation requires monitor.quotas.enabled")
+	}
+
+	for i, pattern := range c.Monitor.Exclusions.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("monitor.exclusions.patterns[%d] %q: %w", i, pattern, err)
+		}
+	}
+
+	if err := c.Alerts.validate(); err != nil {
+		return err
+	}
+
 	// Metrics validation
 	if c.Metrics.Port < 1 || c.Metrics.Port > 65535 {
 		return fmt.Errorf("metrics.port must be between 1 and 65535")
@@ -219,6 +1059,77 @@ func (c *Config) validate() error {
 	if c.Metrics.Path == "" {
 		return fmt.Errorf("metrics.path cannot be empty")
 	}
+	if !validListenAddress(c.Metrics.Address) {
+		return fmt.Errorf("metrics.address %q must be an IP address or localhost", c.Metrics.Address)
+	}
+
+	// API validation
+	if c.API.Port < 0 || c.API.Port > 65535 {
+		return fmt.Errorf("api.port must be between 1 and 65535")
+	}
+	if !validListenAddress(c.API.Address) {
+		return fmt.Errorf("api.address %q must be an IP address or localhost", c.API.Address)
+	}
+	if err := c.CheckListeners(); err != nil {
+		return err
+	}
+	if c.API.ReadTimeout < 0 || c.API.ReportTimeout < 0 {
+		return fmt.Errorf("api.read_timeout and api.report_timeout must not be negative")
+	}
+	if c.API.MaxBodyBytes < 0 {
+		return fmt.Errorf("api.max_body_bytes must not be negative")
+	}
+	if c.API.BackendTimeout < 0 || c.API.MaxScanAge < 0 {
+		return fmt.Errorf("api.backend_timeout and api.max_scan_age must not be negative")
+	}
+	if c.API.MaxListItems < 0 {
+		return fmt.Errorf("api.max_list_items must not be negative")
+	}
+	if deprecation := c.API.V1Deprecation; !deprecation.SunsetAt.IsZero() && deprecation.SunsetAt.Before(deprecation.DeprecatedAt) {
+		return fmt.Errorf("api.v1_deprecation.sunset_at must not be before api.v1_deprecation.deprecated_at")
+	}
+
+	// Tracing validation
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	if c.Tracing.Enabled && !strings.HasPrefix(c.Tracing.Endpoint, "http://") && !strings.HasPrefix(c.Tracing.Endpoint, "https://") {
+		return fmt.Errorf("tracing.endpoint must be an http or https URL when tracing is enabled")
+	}
+
+	// Cleanup validation
+	if c.Cleanup.BatchSize < 0 || c.Cleanup.BatchDelay < 0 || c.Cleanup.MaxOpsPerMinute < 0 || c.Cleanup.HandsOffWindow < 0 {
+		return fmt.Errorf("cleanup.batch_size, cleanup.batch_delay, cleanup.max_ops_per_minute and cleanup.hands_off_window must not be negative")
+	}
+	if c.Cleanup.JobRetention < 0 || c.Cleanup.MaxFinishedJobs < 0 {
+		return fmt.Errorf("cleanup.job_retention and cleanup.max_finished_jobs must not be negative")
+	}
+	if c.Cleanup.FailureThreshold < 0 || c.Cleanup.FailureThreshold > 1 {
+		return fmt.Errorf("cleanup.failure_threshold must be between 0 and 1")
+	}
+	if c.Cleanup.Enabled && c.Security.AdminToken == "" {
+		return fmt.Errorf("cleanup.enabled requires security.admin_token")
+	}
+
+	// Reports validation
+	if err := c.Reports.validate(c.Alerts.Slack.Webhook); err != nil {
+		return err
+	}
+
+	// Store validation
+	switch c.Store.Backend {
+	case "":
+	case "bolt":
+		if c.Store.Path == "" {
+			return fmt.Errorf("store.path is required with store.backend: bolt")
+		}
+	case "postgres":
+		if c.Store.Postgres.DSN == "" {
+			return fmt.Errorf("store.postgres.dsn is required with store.backend: postgres")
+		}
+	default:
+		return fmt.Errorf("store.backend must be bolt or postgres")
+	}
 
 	// Logging validation
 	validLogLevels := []string{"debug", "info", "warn", "error", "fatal"}
@@ -230,6 +1141,9 @@ func (c *Config) validate() error {
 	if !contains(validEncodings, c.Logging.Encoding) {
 		return fmt.Errorf("logging.encoding must be one of: %s", strings.Join(validEncodings, ", "))
 	}
+	if rate := c.Logging.AccessLog.SuccessSampleRate; rate < 0 || rate > 1 {
+		return fmt.Errorf("logging.access_log.success_sample_rate must be between 0 and 1")
+	}
 
 	// Security validation
 	validTLSVersions := []string{"1.2", "1.3"}
@@ -245,9 +1159,353 @@ func (c *Config) validate() error {
 		return fmt.Errorf("security.session_timeout must be at least 1 minute")
 	}
 
+	if c.Security.ConfirmationTTL < 0 {
+		return fmt.Errorf("security.confirmation_ttl must not be negative")
+	}
+
 	return nil
 }
 
+// CheckListeners reports a metrics.port and api.port the monitor and API
+// server could not both listen on when they share a pod: the same port on
+// overlapping addresses. An unset api.port (the -port flag) is not checked.
+func (c *Config) CheckListeners() error {
+	if c.API.Port == 0 || c.API.Port != c.Metrics.Port {
+		return nil
+	}
+	if !listenAddressesOverlap(c.Metrics.Address, c.API.Address) {
+		return nil
+	}
+	return fmt.Errorf("metrics.port and api.port are both %d on overlapping addresses (metrics.address %q, api.address %q); "+
+		"the monitor and API server cannot both listen when they share a pod: change one port or bind them to different addresses",
+		c.API.Port, c.Metrics.Address, c.API.Address)
+}
+
+// validListenAddress accepts an empty address, localhost and IP addresses.
+func validListenAddress(address string) bool {
+	return address == "" || address == "localhost" || net.ParseIP(address) != nil
+}
+
+// listenAddressesOverlap reports whether listeners on the two addresses
+// would share a port. Empty and unspecified addresses cover every interface.
+func listenAddressesOverlap(a, b string) bool {
+	ipA, ipB := listenIP(a), listenIP(b)
+	if ipA == nil || ipB == nil || ipA.IsUnspecified() || ipB.IsUnspecified() {
+		return true
+	}
+	return ipA.Equal(ipB)
+}
+
+func listenIP(address string) net.IP {
+	if address == "localhost" {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	return net.ParseIP(address)
+}
+
+// Effective returns the settings that shape scan results, for reports and
+// scans to record. It holds no secrets.
+func (c *Config) Effective() scanconfig.Effective {
+	m := c.Monitor
+	effective := scanconfig.Effective{
+		ScanInterval:        durationString(m.ScanInterval),
+		OrphanThreshold:     m.OrphanThreshold.String(),
+		SnapshotRetention:   m.SnapshotRetention.String(),
+		OrphanGroupWindow:   durationString(m.OrphanGroupWindow),
+		StrictSnapshots:     m.StrictSnapshots,
+		Namespace:           c.Kubernetes.Namespace,
+		NamespacePriority:   m.NamespacePriority.Enabled,
+		CSIPodSelector:      c.Kubernetes.CSIPodSelector,
+		DriverPatterns:      k8s.DemocraticCSIDrivers,
+		ExcludedNames:       m.Exclusions.Names,
+		ExcludedPatterns:    m.Exclusions.Patterns,
+		ExcludedLabels:      m.Exclusions.Labels,
+		ExcludedAnnotations: m.Exclusions.Annotations,
+		TrueNASURL:          scanconfig.RedactURL(c.TrueNAS.URL),
+		Pool:                c.TrueNAS.Pool,
+		ParentDataset:       c.TrueNAS.ParentDataset,
+	}
+	for name, threshold := range map[string]time.Duration{
+		"persistent_volume":       m.OrphanThresholds.PersistentVolume,
+		"persistent_volume_claim": m.OrphanThresholds.PersistentVolumeClaim,
+		"volume_snapshot":         m.OrphanThresholds.VolumeSnapshot,
+		"truenas_snapshot":        m.OrphanThresholds.TrueNASSnapshot,
+		"truenas_volume":          m.OrphanThresholds.TrueNASVolume,
+	} {
+		if threshold > 0 {
+			if effective.OrphanThresholds == nil {
+				effective.OrphanThresholds = make(map[string]string)
+			}
+			effective.OrphanThresholds[name] = threshold.String()
+		}
+	}
+	return effective.WithHash()
+}
+
+// durationString formats d, or "" for an unset duration.
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// Features reports which optional features the configuration enables. It is
+// logged at startup and served by GET /api/v1/version.
+func (c *Config) Features() map[string]bool {
+	exclusions := c.Monitor.Exclusions
+	return map[string]bool{
+		"metrics":               c.Metrics.Enabled,
+		"read_only":             c.ReadOnly,
+		"pool_check":            c.TrueNAS.Pool != "" || c.TrueNAS.ParentDataset != "",
+		"k8s_impersonation":     c.Kubernetes.Impersonate.User != "",
+		"snapshot_schedules":    len(c.Monitor.SnapshotSchedules) > 0,
+		"backup_coverage":       len(c.Monitor.BackupCoverage.Policies) > 0,
+		"incremental_snapshots": c.Monitor.IncrementalSnapshots.Enabled,
+		"namespace_priority":    c.Monitor.NamespacePriority.Enabled,
+		"nfs_deep_check":        c.Monitor.NFSDeepCheck.Enabled,
+		"iscsi_sessions":        c.Monitor.ISCSISessions.Enabled,
+		"io_stats":              c.Monitor.IOStats.Enabled,
+		"quota_recommendations": c.Monitor.Quotas.Enabled,
+		"quota_remediation":     c.Monitor.Quotas.Remediation && !c.ReadOnly,
+		"snapshot_age_metrics":  c.Monitor.SnapshotAges.Enabled,
+		"provisioning_latency":  c.Monitor.ProvisioningLatency.Enabled,
+		"orphan_events":         c.Monitor.OrphanEvents.Enabled && !c.ReadOnly,
+		"inventory_drift":       c.Monitor.InventoryDrift != (InventoryDriftConfig{}),
+		"restore_canary":        c.Monitor.RestoreCanary.Enabled && !c.ReadOnly,
+		"scan_state_file":       c.Monitor.ScanStateFile != "",
+		"strict_snapshots":      c.Monitor.StrictSnapshots,
+		"orphan_thresholds":     c.Monitor.OrphanThresholds != (OrphanThresholdsConfig{}),
+		"orphan_exclusions": len(exclusions.Names) > 0 || len(exclusions.Patterns) > 0 ||
+			len(exclusions.Labels) > 0 || len(exclusions.Annotations) > 0,
+		"alert_routing":     len(c.Alerts.Routes) > 0 || len(c.Alerts.DefaultRoute.Destinations) > 0 || c.Alerts.Slack.Webhook != "",
+		"alert_silences":    len(c.Alerts.Silences) > 0,
+		"alert_state_file":  c.Alerts.StateFile != "",
+		"truenas_alerts":    c.Alerts.TrueNAS.Enabled,
+		"truenas_forwarded": c.Alerts.TrueNAS.Enabled && c.Alerts.TrueNAS.Forward,
+		"admin_api":         c.Security.AdminToken != "",
+		"tracing":           c.Tracing.Enabled,
+		"snapshot_cleanup":  c.Cleanup.Enabled && !c.ReadOnly,
+		"report_templates":  c.Reports.TemplateDir != "",
+		"report_schedules":  len(c.Reports.Schedules) > 0,
+		"report_artifacts":  c.Reports.Artifacts.Dir != "",
+		"store":             c.Store.Enabled(),
+	}
+}
+
+// validate checks the report sections, thresholds and schedules. Slack
+// targets without a URL of their own need slackWebhook.
+func (r *ReportsConfig) validate(slackWebhook string) error {
+	seen := make(map[string]bool, len(r.Sections))
+	for i, section := range r.Sections {
+		if section == "" {
+			return fmt.Errorf("reports.sections[%d] must not be empty", i)
+		}
+		if seen[section] {
+			return fmt.Errorf("reports.sections lists %q more than once", section)
+		}
+		seen[section] = true
+	}
+	if r.PoolUtilizationPercent < 0 || r.PoolUtilizationPercent > 100 {
+		return fmt.Errorf("reports.pool_utilization_percent must be between 0 and 100")
+	}
+	if r.Artifacts.Retention < 0 || r.Artifacts.MaxBytes < 0 {
+		return fmt.Errorf("reports.artifacts.retention and reports.artifacts.max_bytes must not be negative")
+	}
+
+	names := make(map[string]bool, len(r.Schedules))
+	for i, schedule := range r.Schedules {
+		field := fmt.Sprintf("reports.schedules[%d]", i)
+		if schedule.Name == "" {
+			return fmt.Errorf("%s.name is required", field)
+		}
+		if names[schedule.Name] {
+			return fmt.Errorf("%s.name %q is used more than once", field, schedule.Name)
+		}
+		names[schedule.Name] = true
+		if _, err := scheduler.ParseCron(schedule.Cron); err != nil {
+			return fmt.Errorf("%s.cron: %w", field, err)
+		}
+		if !report.ValidKind(schedule.Type) {
+			return fmt.Errorf("%s.type must be one of: %s, %s", field, report.KindDetailed, report.KindOrphans)
+		}
+		if !report.ValidFormat(schedule.Format) {
+			return fmt.Errorf("%s.format must be one of: %s, %s", field, report.FormatJSON, report.FormatHTML)
+		}
+		if len(schedule.Targets) == 0 {
+			return fmt.Errorf("%s.targets must not be empty", field)
+		}
+		for j, target := range schedule.Targets {
+			targetField := fmt.Sprintf("%s.targets[%d]", field, j)
+			switch target.Type {
+			case scheduler.TargetSlack:
+				if target.URL == "" && slackWebhook == "" {
+					return fmt.Errorf("%s: slack targets need a url or alerts.slack.webhook", targetField)
+				}
+			case scheduler.TargetEmail:
+				if len(target.To) == 0 {
+					return fmt.Errorf("%s.to must not be empty", targetField)
+				}
+				if r.SMTP.Host == "" || r.SMTP.From == "" {
+					return fmt.Errorf("%s: email targets need reports.smtp.host and reports.smtp.from", targetField)
+				}
+			case scheduler.TargetS3:
+				if target.Bucket == "" {
+					return fmt.Errorf("%s.bucket is required", targetField)
+				}
+				if r.S3.Region == "" || r.S3.AccessKeyID == "" || r.S3.SecretAccessKey == "" {
+					return fmt.Errorf("%s: s3 targets need reports.s3.region, access_key_id and secret_access_key", targetField)
+				}
+			default:
+				return fmt.Errorf("%s.type must be one of: slack, email, s3", targetField)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the I/O classification settings
+func (s *IOStatsConfig) validate() error {
+	if s.Window < 0 {
+		return fmt.Errorf("monitor.io_stats.window must not be negative")
+	}
+	if s.HotBytesPerSecond < 0 || s.ColdBytesPerSecond < 0 {
+		return fmt.Errorf("monitor.io_stats thresholds must not be negative")
+	}
+	if s.HotBytesPerSecond > 0 && s.ColdBytesPerSecond > s.HotBytesPerSecond {
+		return fmt.Errorf("monitor.io_stats.cold_bytes_per_second must not exceed hot_bytes_per_second")
+	}
+	if s.TopN < 0 {
+		return fmt.Errorf("monitor.io_stats.top_n must not be negative")
+	}
+	return nil
+}
+
+// validate checks the backup coverage floor and policies
+func (b *BackupCoverageConfig) validate() error {
+	if b.MaxAge < 0 {
+		return fmt.Errorf("monitor.backup_coverage.max_age must not be negative")
+	}
+	if b.FloorPercent < 0 || b.FloorPercent > 100 {
+		return fmt.Errorf("monitor.backup_coverage.floor_percent must be between 0 and 100")
+	}
+	for i, policy := range b.Policies {
+		for _, pattern := range policy.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("monitor.backup_coverage.policies[%d].namespaces %q: %w", i, pattern, err)
+			}
+		}
+		if policy.MaxAge < 0 {
+			return fmt.Errorf("monitor.backup_coverage.policies[%d].max_age must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// validate checks alert routes and silences
+func (a *AlertsConfig) validate() error {
+	if a.RenotifyInterval < 0 {
+		return fmt.Errorf("alerts.renotify_interval must not be negative")
+	}
+	if a.Digest.Window < 0 {
+		return fmt.Errorf("alerts.digest.window must not be negative")
+	}
+	if a.Digest.TopN < 0 {
+		return fmt.Errorf("alerts.digest.top_n must not be negative")
+	}
+	if a.Digest.APIURL != "" {
+		if u, err := url.Parse(a.Digest.APIURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("alerts.digest.api_url must be an absolute URL")
+		}
+	}
+
+	routeNames := make(map[string]bool)
+	for i, route := range a.Routes {
+		field := fmt.Sprintf("alerts.routes[%d]", i)
+		if route.Name == "" {
+			return fmt.Errorf("%s.name is required", field)
+		}
+		if routeNames[route.Name] {
+			return fmt.Errorf("alerts.routes: duplicate name %q", route.Name)
+		}
+		routeNames[route.Name] = true
+		if len(route.Destinations) == 0 {
+			return fmt.Errorf("%s.destinations must not be empty", field)
+		}
+		if err := a.validateRoute(field, route); err != nil {
+			return err
+		}
+	}
+
+	if err := a.validateRoute("alerts.default_route", a.DefaultRoute); err != nil {
+		return err
+	}
+
+	for i, silence := range a.Silences {
+		field := fmt.Sprintf("alerts.silences[%d]", i)
+		if silence.Expires.IsZero() {
+			return fmt.Errorf("%s.expires is required", field)
+		}
+		if isEmptyAlertMatch(silence.Match) {
+			return fmt.Errorf("%s.match must have at least one condition", field)
+		}
+		if err := validateAlertMatch(field+".match", silence.Match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AlertsConfig) validateRoute(field string, route AlertRouteConfig) error {
+	if err := validateAlertMatch(field+".match", route.Match); err != nil {
+		return err
+	}
+	if route.DigestWindow < 0 {
+		return fmt.Errorf("%s.digest_window must not be negative", field)
+	}
+	for j, destination := range route.Destinations {
+		destField := fmt.Sprintf("%s.destinations[%d]", field, j)
+		switch destination.Type {
+		case "slack":
+			if destination.URL == "" && a.Slack.Webhook == "" {
+				return fmt.Errorf("%s: slack destination needs url or alerts.slack.webhook", destField)
+			}
+		case "webhook":
+			if destination.URL == "" {
+				return fmt.Errorf("%s.url is required for webhook destinations", destField)
+			}
+		case "email":
+			if len(destination.To) == 0 {
+				return fmt.Errorf("%s.to is required for email destinations", destField)
+			}
+		default:
+			return fmt.Errorf("%s.type must be one of: slack, webhook, email", destField)
+		}
+	}
+	return nil
+}
+
+func validateAlertMatch(field string, match AlertMatchConfig) error {
+	validSources := []string{"monitor", "truenas", "cleanup"}
+	for _, source := range match.Sources {
+		if !contains(validSources, source) {
+			return fmt.Errorf("%s.sources must be one of: %s", field, strings.Join(validSources, ", "))
+		}
+	}
+	validLevels := []string{"info", "warning", "critical"}
+	for _, level := range match.Levels {
+		if !contains(validLevels, level) {
+			return fmt.Errorf("%s.levels must be one of: %s", field, strings.Join(validLevels, ", "))
+		}
+	}
+	return nil
+}
+
+func isEmptyAlertMatch(match AlertMatchConfig) bool {
+	return len(match.Sources) == 0 && len(match.Levels) == 0 && len(match.Categories) == 0 &&
+		len(match.Namespaces) == 0 && len(match.Pools) == 0
+}
+
 // contains checks if a slice contains a string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
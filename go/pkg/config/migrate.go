@@ -0,0 +1,296 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats recognized by DetectFormat.
+const (
+	// FormatGo is the schema of this package: kubernetes:, monitor:.
+	FormatGo = "go"
+	// FormatLegacy is the schema of the Python CLI: openshift:, monitoring:.
+	FormatLegacy = "legacy"
+)
+
+// legacyKey maps a key of the legacy format to its equivalent. Keys are
+// dotted paths; convert, when set, rewrites the value.
+type legacyKey struct {
+	from, to string
+	convert  func(interface{}) (interface{}, error)
+}
+
+// legacyKeys are the legacy keys with an equivalent. Legacy keys under
+// truenas, metrics and logging that are not listed keep their name.
+var legacyKeys = []legacyKey{
+	{from: "openshift.kubeconfig", to: "kubernetes.kubeconfig"},
+	{from: "openshift.context", to: "kubernetes.context"},
+	{from: "openshift.namespace", to: "kubernetes.namespace"},
+	{from: "openshift.in_cluster", to: "kubernetes.in_cluster"},
+	{from: "openshift.impersonate", to: "kubernetes.impersonate"},
+	{from: "monitoring.orphan_check_interval", to: "monitor.scan_interval", convert: legacyDuration},
+	{from: "monitoring.orphan_threshold", to: "monitor.orphan_threshold", convert: legacyDuration},
+	{from: "monitoring.snapshot.max_age", to: "monitor.snapshot_retention", convert: legacyDuration},
+	{from: "monitoring.orphan_thresholds.persistent_volume", to: "monitor.orphan_thresholds.persistent_volume", convert: legacyDuration},
+	{from: "monitoring.orphan_thresholds.persistent_volume_claim", to: "monitor.orphan_thresholds.persistent_volume_claim", convert: legacyDuration},
+	{from: "monitoring.orphan_thresholds.volume_snapshot", to: "monitor.orphan_thresholds.volume_snapshot", convert: legacyDuration},
+	{from: "monitoring.orphan_thresholds.truenas_snapshot", to: "monitor.orphan_thresholds.truenas_snapshot", convert: legacyDuration},
+	{from: "monitoring.orphan_thresholds.truenas_volume", to: "monitor.orphan_thresholds.truenas_volume", convert: legacyDuration},
+	{from: "truenas.timeout", to: "truenas.timeout", convert: legacySeconds},
+	{from: "alerts.slack.webhook_url", to: "alerts.slack.webhook"},
+	{from: "logging.format", to: "logging.encoding"},
+}
+
+// DetectFormat reports the format of a parsed configuration document: legacy
+// when it has an openshift or monitoring section and neither a kubernetes
+// nor a monitor section.
+func DetectFormat(doc map[string]interface{}) string {
+	_, kubernetes := doc["kubernetes"]
+	_, monitor := doc["monitor"]
+	_, openshift := doc["openshift"]
+	_, monitoring := doc["monitoring"]
+	if (openshift || monitoring) && !kubernetes && !monitor {
+		return FormatLegacy
+	}
+	return FormatGo
+}
+
+// MigrateLegacy rewrites a legacy document into this package's format. It
+// returns one warning per mapped key; legacy keys without an equivalent are
+// left in place for UnknownKeys to report.
+func MigrateLegacy(doc map[string]interface{}) (map[string]interface{}, []string, error) {
+	var warnings []string
+	for _, key := range legacyKeys {
+		value, ok := lookupPath(doc, key.from)
+		if !ok {
+			continue
+		}
+		if key.convert != nil {
+			converted, err := key.convert(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", key.from, err)
+			}
+			value = converted
+		}
+		deletePath(doc, key.from)
+		setPath(doc, key.to, value)
+		if key.from == key.to {
+			warnings = append(warnings, fmt.Sprintf("deprecated value of %s converted to %v", key.from, value))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("deprecated key %s mapped to %s", key.from, key.to))
+		}
+	}
+	for _, section := range []string{"openshift", "monitoring"} {
+		if value, ok := doc[section].(map[string]interface{}); ok && len(value) == 0 {
+			delete(doc, section)
+		}
+	}
+	return doc, warnings, nil
+}
+
+// Migrate rewrites a configuration file of either format into this
+// package's format. Comments are not preserved. The warnings list the mapped
+// keys and, as "unknown key" warnings, the keys the Go services ignore,
+// which are kept in the output for the operator to review.
+func Migrate(data []byte) ([]byte, []string, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	var warnings []string
+	if DetectFormat(doc) == FormatLegacy {
+		migrated, mapped, err := MigrateLegacy(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc, warnings = migrated, mapped
+	}
+	warnings = append(warnings, UnknownKeys(doc)...)
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return out, warnings, nil
+}
+
+// UnknownKeys returns an "unknown key" warning for each key of doc that no
+// Config field reads, sorted by path.
+func UnknownKeys(doc map[string]interface{}) []string {
+	var paths []string
+	unknownKeys(reflect.TypeOf(Config{}), doc, "", &paths)
+	sort.Strings(paths)
+	warnings := make([]string, len(paths))
+	for i, path := range paths {
+		warnings[i] = fmt.Sprintf("unknown key %s is ignored", path)
+	}
+	return warnings
+}
+
+func unknownKeys(t reflect.Type, value interface{}, prefix string, paths *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := yamlFields(t)
+		for key, child := range object {
+			path := joinPath(prefix, key)
+			field, ok := fields[key]
+			if !ok {
+				leafPaths(child, path, paths)
+				continue
+			}
+			unknownKeys(field, child, path, paths)
+		}
+	case reflect.Map:
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, child := range object {
+				unknownKeys(t.Elem(), child, joinPath(prefix, key), paths)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				unknownKeys(t.Elem(), item, fmt.Sprintf("%s[%d]", prefix, i), paths)
+			}
+		}
+	}
+}
+
+// leafPaths appends the path of every leaf below an unknown key, so each
+// ignored setting is named.
+func leafPaths(value interface{}, prefix string, paths *[]string) {
+	object, ok := value.(map[string]interface{})
+	if !ok || len(object) == 0 {
+		*paths = append(*paths, prefix)
+		return
+	}
+	for key, child := range object {
+		leafPaths(child, joinPath(prefix, key), paths)
+	}
+}
+
+// yamlFields returns the field types of t by YAML key.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-" || !field.IsExported():
+			continue
+		case name == "":
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func lookupPath(doc map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	current := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	value, ok := current[keys[len(keys)-1]]
+	return value, ok
+}
+
+// deletePath removes the key at path and any sections it leaves empty
+// below the top level.
+func deletePath(doc map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	parents := []map[string]interface{}{doc}
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := parents[len(parents)-1][key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		parents = append(parents, next)
+	}
+	delete(parents[len(parents)-1], keys[len(keys)-1])
+	for i := len(parents) - 1; i > 1 && len(parents[i]) == 0; i-- {
+		delete(parents[i-1], keys[i-1])
+	}
+}
+
+func setPath(doc map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	current := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
+
+var legacyDurationPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)([smhdw])$`)
+
+// legacyDuration converts a legacy duration such as "30d" or "2w", which
+// time.ParseDuration rejects, into a Go duration string.
+func legacyDuration(value interface{}) (interface{}, error) {
+	raw, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("duration must be a string with a unit, got %v", value)
+	}
+	match := legacyDurationPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(raw)))
+	if match == nil {
+		return nil, fmt.Errorf("invalid duration %q", raw)
+	}
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", raw)
+	}
+	unit := map[string]time.Duration{
+		"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour,
+	}[match[2]]
+	return time.Duration(amount * float64(unit)).String(), nil
+}
+
+// legacySeconds converts a legacy timeout in whole seconds, such as 30 or
+// "30", into a Go duration string.
+func legacySeconds(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return (time.Duration(v) * time.Second).String(), nil
+	case string:
+		if seconds, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return (time.Duration(seconds) * time.Second).String(), nil
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid timeout %v", value)
+}
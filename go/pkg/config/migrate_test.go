@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const legacyConfigYAML = `
+openshift:
+  kubeconfig: /etc/kubeconfig
+  namespace: legacy-csi
+truenas:
+  url: https://truenas.example.com
+  username: admin
+  password: secret
+  timeout: 45
+  api_key: unused
+monitoring:
+  orphan_check_interval: 2h
+  orphan_threshold: 2d
+  snapshot:
+    max_age: 2w
+    max_count: 50
+alerts:
+  slack:
+    webhook_url: https://hooks.slack.com/services/x
+logging:
+  format: console
+`
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, FormatLegacy, DetectFormat(map[string]interface{}{"openshift": nil}))
+	assert.Equal(t, FormatLegacy, DetectFormat(map[string]interface{}{"monitoring": nil, "truenas": nil}))
+	assert.Equal(t, FormatGo, DetectFormat(map[string]interface{}{"kubernetes": nil, "monitoring": nil}))
+	assert.Equal(t, FormatGo, DetectFormat(map[string]interface{}{"truenas": nil}))
+}
+
+func TestLoad_LegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(legacyConfigYAML), 0o600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/etc/kubeconfig", cfg.Kubernetes.Kubeconfig)
+	assert.Equal(t, "legacy-csi", cfg.Kubernetes.Namespace)
+	assert.Equal(t, "45s", cfg.TrueNAS.Timeout)
+	assert.Equal(t, 2*time.Hour, cfg.Monitor.ScanInterval)
+	assert.Equal(t, 48*time.Hour, cfg.Monitor.OrphanThreshold)
+	assert.Equal(t, 14*24*time.Hour, cfg.Monitor.SnapshotRetention)
+	assert.Equal(t, "https://hooks.slack.com/services/x", cfg.Alerts.Slack.Webhook)
+	assert.Equal(t, "console", cfg.Logging.Encoding)
+
+	assert.Equal(t, []string{
+		"deprecated key openshift.kubeconfig mapped to kubernetes.kubeconfig",
+		"deprecated key openshift.namespace mapped to kubernetes.namespace",
+		"deprecated key monitoring.orphan_check_interval mapped to monitor.scan_interval",
+		"deprecated key monitoring.orphan_threshold mapped to monitor.orphan_threshold",
+		"deprecated key monitoring.snapshot.max_age mapped to monitor.snapshot_retention",
+		"deprecated value of truenas.timeout converted to 45s",
+		"deprecated key alerts.slack.webhook_url mapped to alerts.slack.webhook",
+		"deprecated key logging.format mapped to logging.encoding",
+		"unknown key monitoring.snapshot.max_count is ignored",
+		"unknown key truenas.api_key is ignored",
+	}, cfg.Warnings)
+}
+
+func TestLoad_UnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+kubernetes:
+  namespace: democratic-csi
+  namepsace: typo
+truenas:
+  url: https://truenas.example.com
+  username: admin
+  password: secret
+alerts:
+  routes:
+    - name: storage
+      destinations:
+        - type: webhook
+          url: https://alerts.example.com
+          chanel: "#storage"
+reporting:
+  output_dir: /tmp
+`), 0o600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"unknown key alerts.routes[0].destinations[0].chanel is ignored",
+		"unknown key kubernetes.namepsace is ignored",
+		"unknown key reporting.output_dir is ignored",
+	}, cfg.Warnings)
+}
+
+func TestMigrate(t *testing.T) {
+	out, warnings, err := Migrate([]byte(legacyConfigYAML))
+	require.NoError(t, err)
+	assert.Len(t, warnings, 10)
+
+	var doc map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(out, &doc))
+	assert.NotContains(t, doc, "openshift")
+	assert.Equal(t, map[string]interface{}{
+		"scan_interval":      "2h0m0s",
+		"orphan_threshold":   "48h0m0s",
+		"snapshot_retention": "336h0m0s",
+	}, doc["monitor"])
+	// Keys without an equivalent are kept for the operator to review.
+	assert.Equal(t, map[string]interface{}{"snapshot": map[string]interface{}{"max_count": 50}}, doc["monitoring"])
+
+	_, _, err = Migrate([]byte("monitoring:\n  orphan_threshold: 24\n"))
+	assert.ErrorContains(t, err, "monitoring.orphan_threshold")
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+)
+
+// ApplyOverrides replaces the kubeconfig context and impersonation settings
+// with the non-empty arguments, as given by the -kube-context, -as,
+// -as-group and -as-uid flags. groups is comma-separated.
+func (k *KubernetesConfig) ApplyOverrides(kubeContext, user, groups, uid string) {
+	if kubeContext != "" {
+		k.Context = kubeContext
+	}
+	if user != "" {
+		k.Impersonate.User = user
+	}
+	if groups != "" {
+		k.Impersonate.Groups = nil
+		for _, group := range strings.Split(groups, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				k.Impersonate.Groups = append(k.Impersonate.Groups, group)
+			}
+		}
+	}
+	if uid != "" {
+		k.Impersonate.UID = uid
+	}
+}
+
+// Scope returns the configured TrueNAS pool and parent dataset.
+func (t TrueNASConfig) Scope() analysis.ScopeOptions {
+	return analysis.ScopeOptions{
+		Pool:          t.Pool,
+		ParentDataset: t.ParentDataset,
+		Strict:        t.MissingPool == MissingPoolFail,
+	}
+}
+
+// SchedulePolicies returns the configured snapshot schedules.
+func (m MonitorConfig) SchedulePolicies() []analysis.SchedulePolicy {
+	policies := make([]analysis.SchedulePolicy, 0, len(m.SnapshotSchedules))
+	for _, schedule := range m.SnapshotSchedules {
+		policies = append(policies, analysis.SchedulePolicy{
+			StorageClass: schedule.StorageClass,
+			Cadence:      schedule.Cadence,
+			MinCount:     schedule.MinCount,
+		})
+	}
+	return policies
+}
+
+// Options returns the backup coverage settings; policies without their own
+// max_age get the section's.
+func (b BackupCoverageConfig) Options() analysis.BackupCoverageOptions {
+	opts := analysis.BackupCoverageOptions{
+		Policies:     make([]analysis.BackupCoveragePolicy, 0, len(b.Policies)),
+		FloorPercent: b.FloorPercent,
+	}
+	for _, policy := range b.Policies {
+		maxAge := policy.MaxAge
+		if maxAge == 0 {
+			maxAge = b.MaxAge
+		}
+		opts.Policies = append(opts.Policies, analysis.BackupCoveragePolicy{
+			Namespaces: policy.Namespaces,
+			Labels:     policy.Labels,
+			MaxAge:     maxAge,
+		})
+	}
+	return opts
+}
+
+// Options returns the volume I/O classification settings.
+func (s IOStatsConfig) Options() analysis.IOStatsOptions {
+	return analysis.IOStatsOptions{
+		Enabled: s.Enabled,
+		Window:  s.Window,
+		Thresholds: analysis.IOThresholds{
+			HotBytesPerSecond:  s.HotBytesPerSecond,
+			ColdBytesPerSecond: s.ColdBytesPerSecond,
+		},
+	}
+}
+
+// Exclusions returns the orphan exclusion rules.
+func (e ExclusionsConfig) Exclusions() orphan.Exclusions {
+	return orphan.Exclusions{
+		Names:       e.Names,
+		Patterns:    e.Patterns,
+		Labels:      e.Labels,
+		Annotations: e.Annotations,
+	}
+}
+
+// RouterConfig returns the alert routes and silences. Without an explicit
+// default route, unmatched alerts go to the configured Slack channel.
+func (a AlertsConfig) RouterConfig() alerts.RouterConfig {
+	routes := make([]alerts.Route, 0, len(a.Routes))
+	for _, route := range a.Routes {
+		routes = append(routes, route.route())
+	}
+
+	defaultRoute := a.DefaultRoute.route()
+	if len(defaultRoute.Destinations) == 0 && a.Slack.Webhook != "" {
+		defaultRoute.Destinations = []alerts.Destination{{Type: alerts.DestinationSlack, Channel: a.Slack.Channel}}
+	}
+
+	silences := make([]alerts.Silence, 0, len(a.Silences))
+	for _, silence := range a.Silences {
+		silences = append(silences, alerts.Silence{
+			Match:   silence.Match.match(),
+			Expires: silence.Expires,
+			Comment: silence.Comment,
+		})
+	}
+
+	return alerts.RouterConfig{Routes: routes, Default: defaultRoute, Silences: silences}
+}
+
+func (r AlertRouteConfig) route() alerts.Route {
+	destinations := make([]alerts.Destination, 0, len(r.Destinations))
+	for _, destination := range r.Destinations {
+		destinations = append(destinations, alerts.Destination{
+			Type:    destination.Type,
+			Channel: destination.Channel,
+			URL:     destination.URL,
+			To:      destination.To,
+		})
+	}
+	return alerts.Route{Name: r.Name, Match: r.Match.match(), Destinations: destinations, DigestWindow: r.DigestWindow}
+}
+
+func (m AlertMatchConfig) match() alerts.Match {
+	return alerts.Match{
+		Sources:    m.Sources,
+		Levels:     m.Levels,
+		Categories: m.Categories,
+		Namespaces: m.Namespaces,
+		Pools:      m.Pools,
+	}
+}
+
+// Enabled reports whether a state store is configured.
+func (s StoreConfig) Enabled() bool {
+	return s.Backend != "" || s.Path != ""
+}
+
+// Options returns the state store settings.
+func (s StoreConfig) Options() store.Options {
+	return store.Options{
+		Backend: s.Backend,
+		Path:    s.Path,
+		DSN:     s.Postgres.DSN,
+	}
+}
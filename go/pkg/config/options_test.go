@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+)
+
+func TestKubernetesConfig_ApplyOverrides(t *testing.T) {
+	cfg := KubernetesConfig{Context: "prod", Impersonate: ImpersonationConfig{User: "viewer", Groups: []string{"ops"}}}
+
+	cfg.ApplyOverrides("", "", "", "")
+	assert.Equal(t, "prod", cfg.Context)
+	assert.Equal(t, []string{"ops"}, cfg.Impersonate.Groups)
+
+	cfg.ApplyOverrides("staging", "auditor", " storage, ,readers ", "1000")
+	assert.Equal(t, "staging", cfg.Context)
+	assert.Equal(t, "auditor", cfg.Impersonate.User)
+	assert.Equal(t, []string{"storage", "readers"}, cfg.Impersonate.Groups)
+	assert.Equal(t, "1000", cfg.Impersonate.UID)
+}
+
+func TestBackupCoverageConfig_Options(t *testing.T) {
+	opts := BackupCoverageConfig{
+		MaxAge:       24 * time.Hour,
+		FloorPercent: 80,
+		Policies: []BackupCoveragePolicyConfig{
+			{Namespaces: []string{"prod-*"}},
+			{Labels: map[string]string{"backup": "required"}, MaxAge: time.Hour},
+		},
+	}.Options()
+
+	assert.Equal(t, 80.0, opts.FloorPercent)
+	assert.Equal(t, 24*time.Hour, opts.Policies[0].MaxAge)
+	assert.Equal(t, time.Hour, opts.Policies[1].MaxAge)
+}
+
+func TestAlertsConfig_RouterConfig(t *testing.T) {
+	cfg := AlertsConfig{
+		Slack: SlackConfig{Webhook: "https://hooks.slack.com/services/T/B/X", Channel: "#storage"},
+		Routes: []AlertRouteConfig{{
+			Name:         "critical",
+			Match:        AlertMatchConfig{Levels: []string{"critical"}},
+			Destinations: []AlertDestinationConfig{{Type: alerts.DestinationWebhook, URL: "https://hooks.example.com/a"}},
+		}},
+		Silences: []AlertSilenceConfig{{Match: AlertMatchConfig{Pools: []string{"backup"}}, Comment: "migration"}},
+	}
+
+	router := cfg.RouterConfig()
+	assert.Equal(t, []string{"critical"}, router.Routes[0].Match.Levels)
+	assert.Equal(t, "https://hooks.example.com/a", router.Routes[0].Destinations[0].URL)
+	assert.Equal(t, []alerts.Destination{{Type: alerts.DestinationSlack, Channel: "#storage"}}, router.Default.Destinations,
+		"unmatched alerts go to the Slack channel")
+	assert.Equal(t, []string{"backup"}, router.Silences[0].Match.Pools)
+
+	cfg.Slack.Webhook = ""
+	assert.Empty(t, cfg.RouterConfig().Default.Destinations)
+}
@@ -0,0 +1,86 @@
+// Package humanize renders sizes, durations and percentages in human-facing
+// text such as alert messages, orphan reasons and recommendations. API
+// responses keep raw numbers.
+package humanize
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Bytes renders a byte count with binary units and one decimal, e.g.
+// "512B", "1.5KiB" or "10.0GiB".
+func Bytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit && bytes > -unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	value := float64(bytes)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	i := -1
+	for (value >= unit || value <= -unit) && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
+
+// Duration renders d with its two largest non-zero units out of days,
+// hours, minutes and seconds, e.g. "2d", "3d4h", "1h30m" or "45s".
+// Sub-second remainders are dropped, so anything under a second is "0s".
+func Duration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	parts := []struct {
+		size   time.Duration
+		suffix string
+	}{
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+		{time.Minute, "m"},
+		{time.Second, "s"},
+	}
+	out := ""
+	used := 0
+	for _, part := range parts {
+		if used == 2 {
+			break
+		}
+		n := d / part.size
+		d -= n * part.size
+		if n == 0 {
+			if used > 0 {
+				// Stop at a zero unit so "2d0h5m" reads as "2d".
+				break
+			}
+			continue
+		}
+		out += strconv.FormatInt(int64(n), 10) + part.suffix
+		used++
+	}
+	if out == "" {
+		return "0s"
+	}
+	return sign + out
+}
+
+// Percent renders a percentage with one decimal, e.g. "12.5%".
+func Percent(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64) + "%"
+}
+
+// Count renders a count with thousands separators, e.g. "5,012".
+func Count(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return sign + digits
+}
@@ -0,0 +1,64 @@
+package humanize
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{10 << 30, "10.0GiB"},
+		{3 << 40, "3.0TiB"},
+		{-2048, "-2.0KiB"},
+	}
+	for _, tt := range tests {
+		if got := Bytes(tt.bytes); got != tt.want {
+			t.Fatalf("Bytes(%d) = %q, want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{500 * time.Millisecond, "0s"},
+		{45 * time.Second, "45s"},
+		{90 * time.Minute, "1h30m"},
+		{48 * time.Hour, "2d"},
+		{76*time.Hour + 10*time.Minute, "3d4h"},
+		{48*time.Hour + 5*time.Minute, "2d"},
+		{-2 * time.Hour, "-2h"},
+	}
+	for _, tt := range tests {
+		if got := Duration(tt.d); got != tt.want {
+			t.Fatalf("Duration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	if got := Percent(44.444); got != "44.4%" {
+		t.Fatalf("Percent(44.444) = %q, want 44.4%%", got)
+	}
+	if got := Percent(90); got != "90.0%" {
+		t.Fatalf("Percent(90) = %q, want 90.0%%", got)
+	}
+}
+
+func TestCount(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 5012: "5,012", 1234567: "1,234,567", -5012: "-5,012"} {
+		if got := Count(n); got != want {
+			t.Errorf("Count(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
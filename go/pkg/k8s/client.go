@@ -2,13 +2,20 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -18,6 +25,7 @@ import (
 	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	snapshotclient "github.com/kubernetes-csi/external-snapshotter/client/v6/clientset/versioned"
 
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
 	"go.uber.org/zap"
 )
@@ -29,9 +37,15 @@ type RBACValidationResult struct {
 	PermissionChecks       map[string]bool         `json:"permission_checks"`
 	ServiceAccount         string                  `json:"service_account"`
 	Namespace              string                  `json:"namespace"`
+	// UnreadableNamespaces maps the namespaces the scan cannot read, when
+	// listing across all namespaces is denied, to the list permissions
+	// missing there. Scans skip them and report partial results.
+	UnreadableNamespaces map[string][]string `json:"unreadable_namespaces,omitempty"`
 }
 
-// ClusterInfo holds cluster information
+// ClusterInfo holds cluster information. GetClusterInfo fills in Version
+// and Platform only; the counts are zero and the lists and Capabilities are
+// empty.
 type ClusterInfo struct {
 	Version           string            `json:"version"`
 	Platform          string            `json:"platform"`
@@ -43,14 +57,40 @@ type ClusterInfo struct {
 	Capabilities      map[string]bool   `json:"capabilities"`
 }
 
-// Client represents a Kubernetes client
+// UserInfo is the identity the API server authenticated a request as
+type UserInfo struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Client represents a Kubernetes client.
+//
+// Listed objects belong to the caller and are never shared with other
+// callers: the client decodes a fresh response per list, and an
+// implementation backed by a shared store returns DeepCopyItems of it.
 type Client interface {
 	// Core resource listing
 	ListPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error)
+	// ListPersistentVolumesWithResourceVersion also returns the resourceVersion
+	// of the final list page for cache coherence.
+	ListPersistentVolumesWithResourceVersion(ctx context.Context) ([]corev1.PersistentVolume, string, error)
 	ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error)
 	ListVolumeSnapshots(ctx context.Context, namespace string) ([]snapshotv1.VolumeSnapshot, error)
+	ListVolumeSnapshotContents(ctx context.Context) ([]snapshotv1.VolumeSnapshotContent, error)
+	ListVolumeSnapshotClasses(ctx context.Context) ([]snapshotv1.VolumeSnapshotClass, error)
 	ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error)
 	ListPods(ctx context.Context, namespace string) ([]corev1.Pod, error)
+	// ListPersistentVolumeClaimEvents lists the Events whose involved object
+	// is a PersistentVolumeClaim in namespace.
+	ListPersistentVolumeClaimEvents(ctx context.Context, namespace string) ([]corev1.Event, error)
+	// CreateEvent posts event in its namespace. It and
+	// DeleteVolumeSnapshotContent are the only writes the tool makes to the
+	// cluster.
+	CreateEvent(ctx context.Context, event *corev1.Event) error
+	// DeleteVolumeSnapshotContent deletes a VolumeSnapshotContent. Only the
+	// cleanup API calls it, for contents reported as dangling.
+	DeleteVolumeSnapshotContent(ctx context.Context, name string) error
 	ListNamespaces(ctx context.Context) ([]corev1.Namespace, error)
 	GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error)
 	
@@ -62,6 +102,9 @@ type Client interface {
 	
 	// Health and validation
 	TestConnection(ctx context.Context) error
+	// GetEffectiveUser returns the identity the API server authenticates the
+	// client as, after impersonation.
+	GetEffectiveUser(ctx context.Context) (*UserInfo, error)
 	ValidateRBACPermissions(ctx context.Context) (*RBACValidationResult, error)
 	GetClusterInfo(ctx context.Context) (*ClusterInfo, error)
 	
@@ -69,7 +112,9 @@ type Client interface {
 	ListCSINodes(ctx context.Context) ([]storagev1.CSINode, error)
 	ListCSIDrivers(ctx context.Context) ([]storagev1.CSIDriver, error)
 	ListVolumeAttachments(ctx context.Context) ([]storagev1.VolumeAttachment, error)
+	ListNodes(ctx context.Context) ([]corev1.Node, error)
 	GetCSIDriverPods(ctx context.Context, namespace string) ([]corev1.Pod, error)
+	CheckCSIDriverHealth(ctx context.Context, namespace string) (*CSIDriverHealth, error)
 }
 
 // client implements the Client interface
@@ -82,15 +127,36 @@ type client struct {
 
 // Config holds Kubernetes client configuration
 type Config struct {
-	Kubeconfig    string
+	Kubeconfig string
+	// Context selects a kubeconfig context instead of its current-context.
+	// It cannot be combined with InCluster.
+	Context       string
 	InCluster     bool
 	Namespace     string
 	Timeout       time.Duration
 	RetryAttempts int
 	QPS           float32
 	Burst         int
+	// CSIPodSelector narrows CSI driver pod listing server-side. Empty uses
+	// DefaultCSIPodSelector.
+	CSIPodSelector string
+	// PageSize is the number of objects requested per list call. Zero uses
+	// DefaultListPageSize.
+	PageSize int64
+	// ImpersonateUser, ImpersonateGroups and ImpersonateUID make every
+	// request act as another identity, such as a restricted service account
+	// (system:serviceaccount:<namespace>:<name>). Groups and UID require a
+	// user.
+	ImpersonateUser   string
+	ImpersonateGroups []string
+	ImpersonateUID    string
+	// Logger receives client logs tagged component=k8s. Nil discards them.
+	Logger *logging.Logger
 }
 
+// DefaultCSIPodSelector matches pods deployed by the democratic-csi chart.
+const DefaultCSIPodSelector = "app.kubernetes.io/name=democratic-csi"
+
 // NewClient creates a new Kubernetes client
 func NewClient(config Config) (Client, error) {
 	// Set defaults
@@ -106,29 +172,22 @@ func NewClient(config Config) (Client, error) {
 	if config.Burst == 0 {
 		config.Burst = 100
 	}
+	if config.CSIPodSelector == "" {
+		config.CSIPodSelector = DefaultCSIPodSelector
+	}
+	if config.PageSize == 0 {
+		config.PageSize = DefaultListPageSize
+	}
+	if config.PageSize < 0 {
+		return nil, fmt.Errorf("invalid list page size %d: must be positive", config.PageSize)
+	}
+	if _, err := labels.Parse(config.CSIPodSelector); err != nil {
+		return nil, fmt.Errorf("invalid CSI pod selector %q: %w", config.CSIPodSelector, err)
+	}
 
-	var restConfig *rest.Config
-	var err error
-
-	if config.InCluster {
-		// Use in-cluster configuration
-		restConfig, err = rest.InClusterConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create in-cluster config: %w", err)
-		}
-	} else {
-		// Use kubeconfig file
-		kubeconfigPath := config.Kubeconfig
-		if kubeconfigPath == "" {
-			if home := homedir.HomeDir(); home != "" {
-				kubeconfigPath = filepath.Join(home, ".kube", "config")
-			}
-		}
-
-		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create config from kubeconfig: %w", err)
-		}
+	restConfig, err := buildRESTConfig(config)
+	if err != nil {
+		return nil, err
 	}
 
 	// Configure connection settings
@@ -136,6 +195,11 @@ func NewClient(config Config) (Client, error) {
 	restConfig.QPS = config.QPS
 	restConfig.Burst = config.Burst
 
+	// Count requests on the per-scan counter of their context
+	restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return apiusage.Transport(apiusage.BackendKubernetes, rt)
+	})
+
 	// Create clientset
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
@@ -148,14 +212,9 @@ func NewClient(config Config) (Client, error) {
 		return nil, fmt.Errorf("failed to create snapshot client: %w", err)
 	}
 
-	// Initialize logger
-	logger, err := logging.NewLogger(logging.Config{
-		Level:       "info",
-		Encoding:    "json",
-		Development: false,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create logger: %w", err)
+	logger := logging.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger.Component("k8s")
 	}
 
 	return &client{
@@ -166,52 +225,110 @@ func NewClient(config Config) (Client, error) {
 	}, nil
 }
 
+// buildRESTConfig loads the in-cluster config or the selected kubeconfig
+// context and applies the impersonation settings
+func buildRESTConfig(config Config) (*rest.Config, error) {
+	if config.InCluster && config.Context != "" {
+		return nil, fmt.Errorf("kubeconfig context %q cannot be used with in-cluster config", config.Context)
+	}
+	if config.ImpersonateUser == "" && (len(config.ImpersonateGroups) > 0 || config.ImpersonateUID != "") {
+		return nil, fmt.Errorf("impersonated groups and UID require an impersonated user")
+	}
+
+	var restConfig *rest.Config
+	var err error
+
+	if config.InCluster {
+		// Use in-cluster configuration
+		restConfig, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create in-cluster config: %w", err)
+		}
+	} else {
+		// Use kubeconfig file
+		kubeconfigPath := config.Kubeconfig
+		if kubeconfigPath == "" {
+			if home := homedir.HomeDir(); home != "" {
+				kubeconfigPath = filepath.Join(home, ".kube", "config")
+			}
+		}
+
+		restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+			&clientcmd.ConfigOverrides{CurrentContext: config.Context},
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create config from kubeconfig: %w", err)
+		}
+	}
+
+	// Impersonation replaces any impersonation set in the kubeconfig
+	if config.ImpersonateUser != "" {
+		restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: config.ImpersonateUser,
+			UID:      config.ImpersonateUID,
+			Groups:   config.ImpersonateGroups,
+		}
+	}
+	return restConfig, nil
+}
+
 // ListPersistentVolumes lists all persistent volumes with retry logic
 func (c *client) ListPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
-	var pvList *corev1.PersistentVolumeList
-	
-	err := retry.OnError(
-		retry.DefaultRetry,
-		isTransientK8sError,
-		func() error {
-			var err error
-			pvList, err = c.clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
-			return err
-		},
-	)
+	pvs, _, err := c.ListPersistentVolumesWithResourceVersion(ctx)
+	return pvs, err
+}
+
+// ListPersistentVolumesWithResourceVersion lists all persistent volumes page by
+// page and returns the resourceVersion of the final page
+func (c *client) ListPersistentVolumesWithResourceVersion(ctx context.Context) ([]corev1.PersistentVolume, string, error) {
+	pvs, resourceVersion, err := listAllPages(ctx, c, "persistentvolumes", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]corev1.PersistentVolume, metav1.ListMeta, error) {
+			list, err := c.clientset.CoreV1().PersistentVolumes().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
 	
 	if err != nil {
 		c.logger.Error("Failed to list persistent volumes after retries", zap.Error(err))
-		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+		return nil, "", fmt.Errorf("failed to list persistent volumes: %w", err)
 	}
 
 	c.logger.LogK8sOperation("list", "persistentvolumes", "", "", nil)
 	c.logger.Debug("Kubernetes operation completed",
 		zap.String("operation", "list"),
 		zap.String("resource", "persistentvolumes"),
-		zap.Int("count", len(pvList.Items)))
+		zap.Int("count", len(pvs)),
+		zap.String("resource_version", resourceVersion))
 	
-	return pvList.Items, nil
+	return pvs, resourceVersion, nil
 }
 
-// ListPersistentVolumeClaims lists persistent volume claims in a namespace with retry logic
+// ListPersistentVolumeClaims lists persistent volume claims in a namespace with retry logic.
+// When listing all namespaces is forbidden the claims of the readable
+// namespaces are returned with an *UnreadableNamespacesError.
 func (c *client) ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
 	if namespace == "" {
 		namespace = metav1.NamespaceAll
 	}
 
-	var pvcList *corev1.PersistentVolumeClaimList
-	
-	err := retry.OnError(
-		retry.DefaultRetry,
-		isTransientK8sError,
-		func() error {
-			var err error
-			pvcList, err = c.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
-			return err
-		},
-	)
-	
+	pvcs, err := listNamespaced(ctx, c, "persistentvolumeclaims", namespace, metav1.ListOptions{},
+		func(namespace string) listPageFunc[corev1.PersistentVolumeClaim] {
+			return func(ctx context.Context, opts metav1.ListOptions) ([]corev1.PersistentVolumeClaim, metav1.ListMeta, error) {
+				list, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, metav1.ListMeta{}, err
+				}
+				return list.Items, list.ListMeta, nil
+			}
+		})
+
+	var unreadable *UnreadableNamespacesError
+	if errors.As(err, &unreadable) {
+		return pvcs, err
+	}
 	if err != nil {
 		c.logger.Error("Failed to list persistent volume claims after retries",
 			zap.Error(err),
@@ -221,27 +338,32 @@ func (c *client) ListPersistentVolumeClaims(ctx context.Context, namespace strin
 
 	c.logger.LogK8sOperation("list", "persistentvolumeclaims", namespace, "", nil)
 	
-	return pvcList.Items, nil
+	return pvcs, nil
 }
 
-// ListVolumeSnapshots lists volume snapshots in a namespace with retry logic
+// ListVolumeSnapshots lists volume snapshots in a namespace with retry logic.
+// When listing all namespaces is forbidden the snapshots of the readable
+// namespaces are returned with an *UnreadableNamespacesError.
 func (c *client) ListVolumeSnapshots(ctx context.Context, namespace string) ([]snapshotv1.VolumeSnapshot, error) {
 	if namespace == "" {
 		namespace = metav1.NamespaceAll
 	}
 
-	var snapshotList *snapshotv1.VolumeSnapshotList
-	
-	err := retry.OnError(
-		retry.DefaultRetry,
-		isTransientK8sError,
-		func() error {
-			var err error
-			snapshotList, err = c.snapshotClient.SnapshotV1().VolumeSnapshots(namespace).List(ctx, metav1.ListOptions{})
-			return err
-		},
-	)
-	
+	snapshots, err := listNamespaced(ctx, c, "volumesnapshots", namespace, metav1.ListOptions{},
+		func(namespace string) listPageFunc[snapshotv1.VolumeSnapshot] {
+			return func(ctx context.Context, opts metav1.ListOptions) ([]snapshotv1.VolumeSnapshot, metav1.ListMeta, error) {
+				list, err := c.snapshotClient.SnapshotV1().VolumeSnapshots(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, metav1.ListMeta{}, err
+				}
+				return list.Items, list.ListMeta, nil
+			}
+		})
+
+	var unreadable *UnreadableNamespacesError
+	if errors.As(err, &unreadable) {
+		return snapshots, err
+	}
 	if err != nil {
 		c.logger.Error("Failed to list volume snapshots after retries",
 			zap.Error(err),
@@ -251,22 +373,59 @@ func (c *client) ListVolumeSnapshots(ctx context.Context, namespace string) ([]s
 
 	c.logger.LogK8sOperation("list", "volumesnapshots", namespace, "", nil)
 	
-	return snapshotList.Items, nil
+	return snapshots, nil
+}
+
+// ListVolumeSnapshotContents lists all volume snapshot contents with retry logic
+func (c *client) ListVolumeSnapshotContents(ctx context.Context) ([]snapshotv1.VolumeSnapshotContent, error) {
+	contents, _, err := listAllPages(ctx, c, "volumesnapshotcontents", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]snapshotv1.VolumeSnapshotContent, metav1.ListMeta, error) {
+			list, err := c.snapshotClient.SnapshotV1().VolumeSnapshotContents().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
+	if err != nil {
+		c.logger.Error("Failed to list volume snapshot contents after retries", zap.Error(err))
+		return nil, fmt.Errorf("failed to list volume snapshot contents: %w", err)
+	}
+
+	c.logger.LogK8sOperation("list", "volumesnapshotcontents", "", "", nil)
+
+	return contents, nil
+}
+
+// ListVolumeSnapshotClasses lists all volume snapshot classes with retry logic
+func (c *client) ListVolumeSnapshotClasses(ctx context.Context) ([]snapshotv1.VolumeSnapshotClass, error) {
+	classes, _, err := listAllPages(ctx, c, "volumesnapshotclasses", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]snapshotv1.VolumeSnapshotClass, metav1.ListMeta, error) {
+			list, err := c.snapshotClient.SnapshotV1().VolumeSnapshotClasses().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
+	if err != nil {
+		c.logger.Error("Failed to list volume snapshot classes after retries", zap.Error(err))
+		return nil, fmt.Errorf("failed to list volume snapshot classes: %w", err)
+	}
+
+	c.logger.LogK8sOperation("list", "volumesnapshotclasses", "", "", nil)
+
+	return classes, nil
 }
 
 // ListStorageClasses lists all storage classes with retry logic
 func (c *client) ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
-	var scList *storagev1.StorageClassList
-	
-	err := retry.OnError(
-		retry.DefaultRetry,
-		isTransientK8sError,
-		func() error {
-			var err error
-			scList, err = c.clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
-			return err
-		},
-	)
+	storageClasses, _, err := listAllPages(ctx, c, "storageclasses", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]storagev1.StorageClass, metav1.ListMeta, error) {
+			list, err := c.clientset.StorageV1().StorageClasses().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
 	
 	if err != nil {
 		c.logger.Error("Failed to list storage classes after retries", zap.Error(err))
@@ -275,37 +434,99 @@ func (c *client) ListStorageClasses(ctx context.Context) ([]storagev1.StorageCla
 
 	c.logger.LogK8sOperation("list", "storageclasses", "", "", nil)
 	
-	return scList.Items, nil
+	return storageClasses, nil
+}
+
+// ListPersistentVolumeClaimEvents lists PVC events in a namespace with retry
+// logic. The field selector keeps unrelated events off the wire.
+func (c *client) ListPersistentVolumeClaimEvents(ctx context.Context, namespace string) ([]corev1.Event, error) {
+	if namespace == "" {
+		namespace = metav1.NamespaceAll
+	}
+
+	opts := metav1.ListOptions{FieldSelector: "involvedObject.kind=PersistentVolumeClaim"}
+	events, _, err := listAllPages(ctx, c, "events", opts,
+		func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Event, metav1.ListMeta, error) {
+			list, err := c.clientset.CoreV1().Events(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
+	if err != nil {
+		c.logger.Error("Failed to list PVC events after retries",
+			zap.Error(err),
+			zap.String("namespace", namespace))
+		return nil, fmt.Errorf("failed to list PVC events: %w", err)
+	}
+
+	c.logger.LogK8sOperation("list", "events", namespace, "", nil)
+
+	return events, nil
+}
+
+// CreateEvent posts event without retrying: callers rate-limit writes and a
+// lost event is reported again on a later scan.
+func (c *client) CreateEvent(ctx context.Context, event *corev1.Event) error {
+	_, err := c.clientset.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	c.logger.LogK8sOperation("create", "events", event.Namespace, event.Name, err)
+	if err != nil {
+		return fmt.Errorf("failed to create event %s/%s: %w", event.Namespace, event.Name, err)
+	}
+	return nil
+}
+
+// DeleteVolumeSnapshotContent deletes a VolumeSnapshotContent without
+// retrying; the cleanup engine records failures per item. A missing content
+// yields an error for which apierrors.IsNotFound holds.
+func (c *client) DeleteVolumeSnapshotContent(ctx context.Context, name string) error {
+	err := c.snapshotClient.SnapshotV1().VolumeSnapshotContents().Delete(ctx, name, metav1.DeleteOptions{})
+	c.logger.LogK8sOperation("delete", "volumesnapshotcontents", "", name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete VolumeSnapshotContent %s: %w", name, err)
+	}
+	return nil
 }
 
 // ListPods lists pods in a namespace with retry logic
 func (c *client) ListPods(ctx context.Context, namespace string) ([]corev1.Pod, error) {
+	podList, err := c.listPodsWithOptions(ctx, namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+// listPodsWithOptions lists all pages of pods with retry logic using the given
+// list options. The returned list carries the final page's resourceVersion.
+func (c *client) listPodsWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
 	if namespace == "" {
 		namespace = metav1.NamespaceAll
 	}
 
-	var podList *corev1.PodList
-	
-	err := retry.OnError(
-		retry.DefaultRetry,
-		isTransientK8sError,
-		func() error {
-			var err error
-			podList, err = c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-			return err
-		},
-	)
+	pods, resourceVersion, err := listAllPages(ctx, c, "pods", opts,
+		func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Pod, metav1.ListMeta, error) {
+			list, err := c.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
 	
 	if err != nil {
 		c.logger.Error("Failed to list pods after retries",
 			zap.Error(err),
-			zap.String("namespace", namespace))
+			zap.String("namespace", namespace),
+			zap.String("label_selector", opts.LabelSelector))
 		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
 
 	c.logger.LogK8sOperation("list", "pods", namespace, "", nil)
 	
-	return podList.Items, nil
+	return &corev1.PodList{
+		ListMeta: metav1.ListMeta{ResourceVersion: resourceVersion},
+		Items:    pods,
+	}, nil
 }
 
 // GetNamespace gets a specific namespace with retry logic
@@ -350,11 +571,30 @@ func (c *client) TestConnection(ctx context.Context) error {
 		return fmt.Errorf("failed to connect to Kubernetes API: %w", err)
 	}
 
-	c.logger.Info("Kubernetes connection test successful")
+	fields := []zap.Field{}
+	if user, err := c.GetEffectiveUser(ctx); err != nil {
+		// SelfSubjectReview is GA in Kubernetes 1.28; older clusters or
+		// identities without access only lose the identity report
+		c.logger.Warn("Failed to determine effective Kubernetes user", zap.Error(err))
+	} else {
+		fields = append(fields, zap.String("user", user.Username), zap.Strings("groups", user.Groups))
+	}
+	c.logger.Info("Kubernetes connection test successful", fields...)
 	
 	return nil
 }
 
+// GetEffectiveUser asks the API server who the client is with a
+// SelfSubjectReview
+func (c *client) GetEffectiveUser(ctx context.Context) (*UserInfo, error) {
+	review, err := c.clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to review effective user: %w", err)
+	}
+	user := review.Status.UserInfo
+	return &UserInfo{Username: user.Username, UID: user.UID, Groups: user.Groups}, nil
+}
+
 // ListDemocraticCSIPersistentVolumes lists PVs managed by democratic-csi
 func (c *client) ListDemocraticCSIPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
 	pvs, err := c.ListPersistentVolumes(ctx)
@@ -364,7 +604,7 @@ func (c *client) ListDemocraticCSIPersistentVolumes(ctx context.Context) ([]core
 
 	var filtered []corev1.PersistentVolume
 	for _, pv := range pvs {
-		if pv.Spec.CSI != nil && isDemocraticCSIDriver(pv.Spec.CSI.Driver) {
+		if pv.Spec.CSI != nil && IsDemocraticCSIDriver(pv.Spec.CSI.Driver) {
 			filtered = append(filtered, pv)
 		}
 	}
@@ -398,10 +638,13 @@ func (c *client) ListPersistentVolumesByStorageClass(ctx context.Context, storag
 	return filtered, nil
 }
 
-// ListUnboundPersistentVolumeClaims lists PVCs that are in Pending state
+// ListUnboundPersistentVolumeClaims lists PVCs that are in Pending state. Like
+// ListPersistentVolumeClaims, it returns the PVCs of the readable namespaces
+// with an *UnreadableNamespacesError.
 func (c *client) ListUnboundPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
 	pvcs, err := c.ListPersistentVolumeClaims(ctx, namespace)
-	if err != nil {
+	var unreadable *UnreadableNamespacesError
+	if err != nil && !errors.As(err, &unreadable) {
 		return nil, err
 	}
 
@@ -417,22 +660,19 @@ func (c *client) ListUnboundPersistentVolumeClaims(ctx context.Context, namespac
 		zap.Int("total_pvcs", len(pvcs)),
 		zap.Int("unbound_pvcs", len(unbound)))
 
-	return unbound, nil
+	return unbound, err
 }
 
 // ListNamespaces lists all namespaces
 func (c *client) ListNamespaces(ctx context.Context) ([]corev1.Namespace, error) {
-	var nsList *corev1.NamespaceList
-	
-	err := retry.OnError(
-		retry.DefaultRetry,
-		isTransientK8sError,
-		func() error {
-			var err error
-			nsList, err = c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
-			return err
-		},
-	)
+	namespaces, _, err := listAllPages(ctx, c, "namespaces", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Namespace, metav1.ListMeta, error) {
+			list, err := c.clientset.CoreV1().Namespaces().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
 	
 	if err != nil {
 		c.logger.Error("Failed to list namespaces after retries", zap.Error(err))
@@ -441,37 +681,71 @@ func (c *client) ListNamespaces(ctx context.Context) ([]corev1.Namespace, error)
 
 	c.logger.LogK8sOperation("list", "namespaces", "", "", nil)
 	
-	return nsList.Items, nil
+	return namespaces, nil
 }
 
 // GetCSIDriverPods lists pods for CSI drivers in the specified namespace
 func (c *client) GetCSIDriverPods(ctx context.Context, namespace string) ([]corev1.Pod, error) {
-	pods, err := c.ListPods(ctx, namespace)
+	pods, _, err := c.listCSIDriverPods(ctx, namespace)
+	return pods, err
+}
+
+// listCSIDriverPods lists CSI driver pods by label selector, falling back to a
+// full list filtered client-side when the selector matches nothing. It also
+// returns the resourceVersion of the list that produced the pods.
+func (c *client) listCSIDriverPods(ctx context.Context, namespace string) ([]corev1.Pod, string, error) {
+	selector := c.config.CSIPodSelector
+	if selector == "" {
+		selector = DefaultCSIPodSelector
+	}
+
+	podList, err := c.listPodsWithOptions(ctx, namespace, metav1.ListOptions{LabelSelector: selector})
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if len(podList.Items) > 0 {
+		c.logger.Debug("Found CSI driver pods by label selector",
+			zap.String("namespace", namespace),
+			zap.String("selector", selector),
+			zap.Int("csi_pods", len(podList.Items)))
+		return podList.Items, podList.ResourceVersion, nil
+	}
+
+	c.logger.Warn("CSI pod selector matched no pods, falling back to listing all pods",
+		zap.String("namespace", namespace),
+		zap.String("selector", selector))
+
+	podList, err = c.listPodsWithOptions(ctx, namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, "", err
 	}
 
 	var csiPods []corev1.Pod
-	for _, pod := range pods {
+	for _, pod := range podList.Items {
 		// Look for CSI-related pods based on labels or names
-		if isCSIDriverPod(pod) {
+		if IsCSIDriverPod(pod) {
 			csiPods = append(csiPods, pod)
 		}
 	}
 
 	c.logger.Info("Found CSI driver pods",
 		zap.String("namespace", namespace),
-		zap.Int("total_pods", len(pods)),
+		zap.Int("total_pods", len(podList.Items)),
 		zap.Int("csi_pods", len(csiPods)))
 
-	return csiPods, nil
+	return csiPods, podList.ResourceVersion, nil
 }
 
+// GetClusterInfo reports the API server version and platform from a single
+// GET /version bounded by ctx; the other fields are not gathered.
 func (c *client) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
-	// TODO: Implement cluster info gathering
+	info, err := c.serverVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes server version: %w", err)
+	}
 	return &ClusterInfo{
-		Version:        "unknown",
-		Platform:       "unknown",
+		Version:        info.GitVersion,
+		Platform:       info.Platform,
 		NodeCount:      0,
 		NamespaceCount: 0,
 		StorageClasses: []string{},
@@ -481,6 +755,25 @@ func (c *client) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
 	}, nil
 }
 
+// serverVersion requests /version like Discovery().ServerVersion, which
+// does not take a context. Fake clientsets have no REST client and fall
+// back to it.
+func (c *client) serverVersion(ctx context.Context) (*version.Info, error) {
+	restClient := c.clientset.Discovery().RESTClient()
+	if restClient == nil {
+		return c.clientset.Discovery().ServerVersion()
+	}
+	body, err := restClient.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	var info version.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse the server version: %w", err)
+	}
+	return &info, nil
+}
+
 func (c *client) ListCSINodes(ctx context.Context) ([]storagev1.CSINode, error) {
 	// TODO: Implement CSI node listing
 	return []storagev1.CSINode{}, nil
@@ -491,9 +784,42 @@ func (c *client) ListCSIDrivers(ctx context.Context) ([]storagev1.CSIDriver, err
 	return []storagev1.CSIDriver{}, nil
 }
 
+// ListVolumeAttachments lists all volume attachments with retry logic
 func (c *client) ListVolumeAttachments(ctx context.Context) ([]storagev1.VolumeAttachment, error) {
-	// TODO: Implement volume attachment listing
-	return []storagev1.VolumeAttachment{}, nil
+	attachments, _, err := listAllPages(ctx, c, "volumeattachments", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]storagev1.VolumeAttachment, metav1.ListMeta, error) {
+			list, err := c.clientset.StorageV1().VolumeAttachments().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
+	if err != nil {
+		c.logger.Error("Failed to list volume attachments after retries", zap.Error(err))
+		return nil, fmt.Errorf("failed to list volume attachments: %w", err)
+	}
+
+	c.logger.LogK8sOperation("list", "volumeattachments", "", "", nil)
+	return attachments, nil
+}
+
+// ListNodes lists all nodes with retry logic
+func (c *client) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodes, _, err := listAllPages(ctx, c, "nodes", metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Node, metav1.ListMeta, error) {
+			list, err := c.clientset.CoreV1().Nodes().List(ctx, opts)
+			if err != nil {
+				return nil, metav1.ListMeta{}, err
+			}
+			return list.Items, list.ListMeta, nil
+		})
+	if err != nil {
+		c.logger.Error("Failed to list nodes after retries", zap.Error(err))
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	c.logger.LogK8sOperation("list", "nodes", "", "", nil)
+	return nodes, nil
 }
 
 func (c *client) ListPersistentVolumeClaimsByStorageClass(ctx context.Context, namespace, storageClass string) ([]corev1.PersistentVolumeClaim, error) {
@@ -503,16 +829,17 @@ func (c *client) ListPersistentVolumeClaimsByStorageClass(ctx context.Context, n
 
 // Helper functions
 
-// isDemocraticCSIDriver checks if the driver name indicates democratic-csi
-func isDemocraticCSIDriver(driverName string) bool {
-	democraticCSIDrivers := []string{
-		"org.democratic-csi.iscsi",
-		"org.democratic-csi.nfs",
-		"org.democratic-csi.smb",
-		"democratic-csi",
-	}
-	
-	for _, driver := range democraticCSIDrivers {
+// DemocraticCSIDrivers are the CSI driver names treated as democratic-csi's.
+var DemocraticCSIDrivers = []string{
+	"org.democratic-csi.iscsi",
+	"org.democratic-csi.nfs",
+	"org.democratic-csi.smb",
+	"democratic-csi",
+}
+
+// IsDemocraticCSIDriver reports whether a CSI driver name is one of democratic-csi's
+func IsDemocraticCSIDriver(driverName string) bool {
+	for _, driver := range DemocraticCSIDrivers {
 		if driverName == driver {
 			return true
 		}
@@ -520,15 +847,20 @@ func isDemocraticCSIDriver(driverName string) bool {
 	return false
 }
 
-// isCSIDriverPod checks if a pod is a CSI driver pod
-func isCSIDriverPod(pod corev1.Pod) bool {
-	// Check labels for CSI-related components
-	labels := pod.Labels
-	if labels == nil {
-		return false
+// NFSSharePath returns the exported path of a PV provisioned by a CSI
+// driver with "nfs" in its name, in any case, from its volume attributes, or
+// "" for other drivers.
+func NFSSharePath(driverName string, attributes map[string]string) string {
+	if !strings.Contains(strings.ToLower(driverName), "nfs") {
+		return ""
 	}
-	
-	for k, v := range labels {
+	return attributes["share"]
+}
+
+// IsCSIDriverPod reports whether a pod looks like a CSI driver pod by its labels or name
+func IsCSIDriverPod(pod corev1.Pod) bool {
+	// Check labels for CSI-related components
+	for k, v := range pod.Labels {
 		if k == "app" && v == "csi-driver" ||
 		   k == "component" && v == "csi-driver" ||
 		   k == "app.kubernetes.io/component" && v == "csi-driver" ||
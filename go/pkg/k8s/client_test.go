@@ -2,17 +2,23 @@ package k8s
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	authorizationv1 "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
 	k8stesting "k8s.io/client-go/testing"
 
 	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v6/clientset/versioned/fake"
@@ -74,6 +80,101 @@ users:
 	})
 }
 
+func TestBuildRESTConfig_ContextAndImpersonation(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	content := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+current-context: prod
+users:
+- name: admin
+  user:
+    token: fake-token
+`)
+	if err := os.WriteFile(kubeconfig, content, 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	restConfig, err := buildRESTConfig(Config{Kubeconfig: kubeconfig})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restConfig.Host != "https://prod.example.com:6443" || restConfig.Impersonate.UserName != "" {
+		t.Fatalf("current context: host %q, impersonate %+v", restConfig.Host, restConfig.Impersonate)
+	}
+
+	restConfig, err = buildRESTConfig(Config{
+		Kubeconfig:        kubeconfig,
+		Context:           "staging",
+		ImpersonateUser:   "system:serviceaccount:storage:scanner",
+		ImpersonateGroups: []string{"system:serviceaccounts"},
+		ImpersonateUID:    "1234",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restConfig.Host != "https://staging.example.com:6443" {
+		t.Fatalf("host = %q, want the staging cluster", restConfig.Host)
+	}
+	impersonate := restConfig.Impersonate
+	if impersonate.UserName != "system:serviceaccount:storage:scanner" || impersonate.UID != "1234" ||
+		len(impersonate.Groups) != 1 || impersonate.Groups[0] != "system:serviceaccounts" {
+		t.Fatalf("impersonate = %+v", impersonate)
+	}
+
+	invalid := []Config{
+		{Kubeconfig: kubeconfig, Context: "missing"},
+		{Kubeconfig: kubeconfig, ImpersonateGroups: []string{"system:serviceaccounts"}},
+		{InCluster: true, Context: "staging"},
+	}
+	for _, config := range invalid {
+		if _, err := buildRESTConfig(config); err == nil {
+			t.Fatalf("expected error for %+v", config)
+		}
+	}
+}
+
+func TestClient_GetEffectiveUser(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	fakeClient.PrependReactor("create", "selfsubjectreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &authenticationv1.SelfSubjectReview{
+				Status: authenticationv1.SelfSubjectReviewStatus{UserInfo: authenticationv1.UserInfo{
+					Username: "system:serviceaccount:storage:scanner",
+					UID:      "1234",
+					Groups:   []string{"system:serviceaccounts", "system:authenticated"},
+				}},
+			}, nil
+		})
+	c := &client{clientset: fakeClient, logger: testLogger(t)}
+
+	user, err := c.GetEffectiveUser(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Username != "system:serviceaccount:storage:scanner" || user.UID != "1234" || len(user.Groups) != 2 {
+		t.Fatalf("user = %+v", user)
+	}
+	if err := c.TestConnection(context.Background()); err != nil {
+		t.Fatalf("TestConnection: %v", err)
+	}
+}
+
 func TestClient_ListPersistentVolumes(t *testing.T) {
 	ctx := context.Background()
 
@@ -193,6 +294,42 @@ func TestClient_ListStorageClasses(t *testing.T) {
 	}
 }
 
+func TestClient_ListVolumeAttachmentsAndNodes(t *testing.T) {
+	ctx := context.Background()
+
+	pv := "pv-data"
+	attachment := &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-abc"},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: "org.democratic-csi.iscsi",
+			NodeName: "worker-1",
+			Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pv},
+		},
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+
+	c := &client{
+		clientset: fake.NewSimpleClientset(attachment, node),
+		config:    Config{Namespace: "default"},
+		logger:    testLogger(t),
+	}
+
+	attachments, err := c.ListVolumeAttachments(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].Spec.NodeName != "worker-1" {
+		t.Fatalf("unexpected attachments: %+v", attachments)
+	}
+	nodes, err := c.ListNodes(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "worker-1" {
+		t.Fatalf("unexpected nodes: %+v", nodes)
+	}
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
@@ -233,6 +370,12 @@ func TestClient_ValidateRBACPermissions_Allowed(t *testing.T) {
 	if !result.PermissionChecks["persistentvolumeclaims/list"] {
 		t.Fatal("expected namespaced PVC list check")
 	}
+	if !result.PermissionChecks["events/list"] {
+		t.Fatal("expected namespaced events list check")
+	}
+	if !result.PermissionChecks["volumesnapshotcontents.snapshot.storage.k8s.io/list"] {
+		t.Fatal("expected cluster-wide snapshot content list check")
+	}
 }
 
 func TestClient_ValidateRBACPermissions_AllNamespacesScan(t *testing.T) {
@@ -269,6 +412,9 @@ func TestClient_ValidateRBACPermissions_AllNamespacesScan(t *testing.T) {
 	if !result.PermissionChecks["persistentvolumeclaims/list (all namespaces)"] {
 		t.Fatal("expected all-namespaces PVC list key")
 	}
+	if !result.PermissionChecks["events/list (all namespaces)"] {
+		t.Fatal("expected all-namespaces events list key")
+	}
 }
 
 func TestClient_ValidateRBACPermissions_Denied(t *testing.T) {
@@ -312,3 +458,66 @@ func TestClient_ValidateRBACPermissions_Denied(t *testing.T) {
 		t.Fatalf("expected snapshot skip note, got %v", result.MissingPermissions)
 	}
 }
+
+func TestDeepCopyItems(t *testing.T) {
+	pvs := []v1.PersistentVolume{{ObjectMeta: metav1.ObjectMeta{Name: "pv-1", Labels: map[string]string{"app": "db"}}}}
+	copies := DeepCopyItems(pvs)
+	copies[0].Labels["app"] = "changed"
+	if pvs[0].Labels["app"] != "db" {
+		t.Fatal("writing into a copy changed the original labels")
+	}
+	if copies := DeepCopyItems[v1.PersistentVolume](nil); copies == nil {
+		t.Fatal("DeepCopyItems(nil) = nil, want an empty list")
+	}
+}
+
+func TestNFSSharePath(t *testing.T) {
+	attributes := map[string]string{"share": "/mnt/tank/k8s/nfs/pvc-1"}
+	for driver, want := range map[string]string{
+		"org.democratic-csi.nfs":   "/mnt/tank/k8s/nfs/pvc-1",
+		"org.democratic-csi.NFS":   "/mnt/tank/k8s/nfs/pvc-1",
+		"org.democratic-csi.iscsi": "",
+	} {
+		if got := NFSSharePath(driver, attributes); got != want {
+			t.Errorf("NFSSharePath(%q) = %q, want %q", driver, got, want)
+		}
+	}
+}
+
+func TestClient_GetClusterInfoHonoursContext(t *testing.T) {
+	newClient := func(handler http.HandlerFunc) *client {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+		if err != nil {
+			t.Fatalf("NewForConfig: %v", err)
+		}
+		return &client{clientset: clientset, logger: testLogger(t)}
+	}
+
+	c := newClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"gitVersion":"v1.29.2","platform":"linux/amd64"}`))
+	})
+	info, err := c.GetClusterInfo(context.Background())
+	if err != nil {
+		t.Fatalf("GetClusterInfo: %v", err)
+	}
+	if info.Version != "v1.29.2" || info.Platform != "linux/amd64" {
+		t.Fatalf("cluster info = %+v", info)
+	}
+
+	// An API server that never answers is given up on at the deadline.
+	c = newClient(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetClusterInfo(ctx); err == nil {
+		t.Fatal("GetClusterInfo succeeded against a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("GetClusterInfo returned after %s, want the 50ms deadline", elapsed)
+	}
+}
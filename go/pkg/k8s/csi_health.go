@@ -0,0 +1,226 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// CSIRoleController marks democratic-csi controller pods.
+	CSIRoleController = "controller"
+	// CSIRoleNode marks democratic-csi node plugin pods.
+	CSIRoleNode = "node"
+	// CSIRoleUnknown marks CSI pods whose role could not be determined.
+	CSIRoleUnknown = "unknown"
+)
+
+// CSIPodStatus summarizes a single CSI driver pod.
+type CSIPodStatus struct {
+	Name          string            `json:"name"`
+	Namespace     string            `json:"namespace"`
+	Node          string            `json:"node,omitempty"`
+	Role          string            `json:"role"`
+	Phase         string            `json:"phase"`
+	Ready         bool              `json:"ready"`
+	DriverVersion string            `json:"driver_version,omitempty"`
+	Images        map[string]string `json:"images"`
+}
+
+// CSIDriverHealth holds the health and version picture of democratic-csi pods.
+type CSIDriverHealth struct {
+	Namespace          string         `json:"namespace"`
+	ResourceVersion    string         `json:"resource_version,omitempty"`
+	Pods               []CSIPodStatus `json:"pods"`
+	ControllerVersions []string       `json:"controller_versions"`
+	NodeVersions       []string       `json:"node_versions"`
+	VersionSkew        bool           `json:"version_skew"`
+	Warnings           []string       `json:"warnings,omitempty"`
+}
+
+// CheckCSIDriverHealth inspects CSI driver pods and reports image versions and skew.
+// An empty namespace falls back to the client's configured namespace.
+func (c *client) CheckCSIDriverHealth(ctx context.Context, namespace string) (*CSIDriverHealth, error) {
+	if namespace == "" {
+		namespace = c.config.Namespace
+	}
+
+	pods, resourceVersion, err := c.listCSIDriverPods(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check CSI driver health: %w", err)
+	}
+
+	health := BuildCSIDriverHealth(namespace, pods)
+	health.ResourceVersion = resourceVersion
+	if health.VersionSkew {
+		c.logger.Warn("democratic-csi version skew detected",
+			zap.String("namespace", namespace),
+			zap.Strings("controller_versions", health.ControllerVersions),
+			zap.Strings("node_versions", health.NodeVersions))
+	}
+
+	return health, nil
+}
+
+// BuildCSIDriverHealth derives per-pod versions and skew warnings from CSI driver pods.
+func BuildCSIDriverHealth(namespace string, pods []corev1.Pod) *CSIDriverHealth {
+	health := &CSIDriverHealth{
+		Namespace:          namespace,
+		Pods:               make([]CSIPodStatus, 0, len(pods)),
+		ControllerVersions: []string{},
+		NodeVersions:       []string{},
+	}
+
+	controllerVersions := make(map[string]struct{})
+	nodeVersions := make(map[string]struct{})
+	allVersions := make(map[string]struct{})
+
+	for _, pod := range pods {
+		status := CSIPodStatus{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Node:      pod.Spec.NodeName,
+			Role:      csiPodRole(pod),
+			Phase:     string(pod.Status.Phase),
+			Ready:     podReady(pod),
+			Images:    make(map[string]string, len(pod.Spec.Containers)),
+		}
+
+		for _, container := range pod.Spec.Containers {
+			status.Images[container.Name] = container.Image
+		}
+		status.DriverVersion = driverVersion(pod)
+
+		if status.DriverVersion != "" {
+			allVersions[status.DriverVersion] = struct{}{}
+			switch status.Role {
+			case CSIRoleController:
+				controllerVersions[status.DriverVersion] = struct{}{}
+			case CSIRoleNode:
+				nodeVersions[status.DriverVersion] = struct{}{}
+			}
+		}
+
+		health.Pods = append(health.Pods, status)
+	}
+
+	health.ControllerVersions = sortedKeys(controllerVersions)
+	health.NodeVersions = sortedKeys(nodeVersions)
+
+	if len(nodeVersions) > 1 {
+		health.Warnings = append(health.Warnings, fmt.Sprintf(
+			"node plugins run different democratic-csi versions: %s",
+			strings.Join(health.NodeVersions, ", ")))
+	}
+	if len(controllerVersions) > 1 {
+		health.Warnings = append(health.Warnings, fmt.Sprintf(
+			"controllers run different democratic-csi versions: %s",
+			strings.Join(health.ControllerVersions, ", ")))
+	}
+	if len(controllerVersions) > 0 && len(nodeVersions) > 0 && !sameKeys(controllerVersions, nodeVersions) {
+		health.Warnings = append(health.Warnings, fmt.Sprintf(
+			"controller version(s) %s differ from node version(s) %s",
+			strings.Join(health.ControllerVersions, ", "),
+			strings.Join(health.NodeVersions, ", ")))
+	}
+	health.VersionSkew = len(allVersions) > 1
+
+	return health
+}
+
+// ImageTag returns the tag portion of a container image reference, "latest"
+// when the reference carries no tag, or the digest when pinned by digest only.
+func ImageTag(image string) string {
+	ref := image
+	if idx := strings.Index(ref, "@"); idx >= 0 {
+		digest := ref[idx+1:]
+		ref = ref[:idx]
+		if tag := tagFromRef(ref); tag != "" {
+			return tag
+		}
+		return digest
+	}
+	if tag := tagFromRef(ref); tag != "" {
+		return tag
+	}
+	return "latest"
+}
+
+func tagFromRef(ref string) string {
+	lastSlash := strings.LastIndex(ref, "/")
+	lastColon := strings.LastIndex(ref, ":")
+	if lastColon > lastSlash {
+		return ref[lastColon+1:]
+	}
+	return ""
+}
+
+// driverVersion picks the democratic-csi image tag, falling back to the
+// container conventionally named csi-driver by the upstream chart.
+func driverVersion(pod corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if strings.Contains(container.Image, "democratic-csi") {
+			return ImageTag(container.Image)
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "csi-driver" {
+			return ImageTag(container.Image)
+		}
+	}
+	return ""
+}
+
+func csiPodRole(pod corev1.Pod) string {
+	candidates := []string{
+		pod.Labels["app.kubernetes.io/csi-role"],
+		pod.Labels["app.kubernetes.io/component"],
+		pod.Labels["component"],
+		pod.Name,
+	}
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(candidate)
+		switch {
+		case strings.Contains(candidate, "controller"):
+			return CSIRoleController
+		case strings.Contains(candidate, "node"):
+			return CSIRoleNode
+		}
+	}
+	return CSIRoleUnknown
+}
+
+func podReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sameKeys(a, b map[string]struct{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
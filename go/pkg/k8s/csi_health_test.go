@@ -0,0 +1,210 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func csiPod(name, role, node, image string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "democratic-csi",
+			Labels: map[string]string{
+				"app.kubernetes.io/name":     "democratic-csi",
+				"app.kubernetes.io/csi-role": role,
+			},
+		},
+		Spec: v1.PodSpec{
+			NodeName: node,
+			Containers: []v1.Container{
+				{Name: "csi-driver", Image: image},
+				{Name: "csi-proxy", Image: "docker.io/democraticcsi/csi-grpc-proxy:v0.5.6"},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	cases := map[string]string{
+		"democraticcsi/democratic-csi:v1.8.3":              "v1.8.3",
+		"registry.local:5000/democraticcsi/democratic-csi": "latest",
+		"registry.local:5000/democratic-csi:next":          "next",
+		"democraticcsi/democratic-csi@sha256:abc":          "sha256:abc",
+		"democraticcsi/democratic-csi:v1.9.0@sha256:abc":   "v1.9.0",
+	}
+	for image, want := range cases {
+		if got := ImageTag(image); got != want {
+			t.Fatalf("ImageTag(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestClient_CheckCSIDriverHealth_NoSkew(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(
+		csiPod("truenas-nfs-controller-0", "controller", "worker-a", "democraticcsi/democratic-csi:v1.8.3"),
+		csiPod("truenas-nfs-node-a", "node", "worker-a", "democraticcsi/democratic-csi:v1.8.3"),
+	)
+	c := &client{
+		clientset: fakeClient,
+		config:    Config{Namespace: "democratic-csi"},
+		logger:    testLogger(t),
+	}
+
+	health, err := c.CheckCSIDriverHealth(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if health.Namespace != "democratic-csi" {
+		t.Fatalf("namespace = %q, want democratic-csi", health.Namespace)
+	}
+	if len(health.Pods) != 2 {
+		t.Fatalf("expected 2 CSI pods, got %d", len(health.Pods))
+	}
+	if health.VersionSkew || len(health.Warnings) != 0 {
+		t.Fatalf("expected no skew, got warnings %v", health.Warnings)
+	}
+	for _, pod := range health.Pods {
+		if pod.DriverVersion != "v1.8.3" {
+			t.Fatalf("pod %s driver version = %q", pod.Name, pod.DriverVersion)
+		}
+		if !pod.Ready {
+			t.Fatalf("pod %s expected ready", pod.Name)
+		}
+	}
+}
+
+func TestBuildCSIDriverHealth_ControllerNodeSkew(t *testing.T) {
+	pods := []v1.Pod{
+		*csiPod("truenas-nfs-controller-0", "controller", "worker-a", "democraticcsi/democratic-csi:v1.9.0"),
+		*csiPod("truenas-nfs-node-a", "node", "worker-a", "democraticcsi/democratic-csi:v1.8.3"),
+		*csiPod("truenas-nfs-node-b", "node", "worker-b", "democraticcsi/democratic-csi:v1.8.3"),
+	}
+
+	health := BuildCSIDriverHealth("democratic-csi", pods)
+	if !health.VersionSkew {
+		t.Fatal("expected version skew between controller and nodes")
+	}
+	if len(health.Warnings) != 1 {
+		t.Fatalf("expected one warning, got %v", health.Warnings)
+	}
+	if len(health.ControllerVersions) != 1 || health.ControllerVersions[0] != "v1.9.0" {
+		t.Fatalf("controller versions = %v", health.ControllerVersions)
+	}
+}
+
+func TestBuildCSIDriverHealth_NodeSkew(t *testing.T) {
+	pods := []v1.Pod{
+		*csiPod("truenas-nfs-node-a", "node", "worker-a", "democraticcsi/democratic-csi:v1.8.3"),
+		*csiPod("truenas-nfs-node-b", "node", "worker-b", "democraticcsi/democratic-csi:v1.9.0"),
+	}
+
+	health := BuildCSIDriverHealth("democratic-csi", pods)
+	if !health.VersionSkew {
+		t.Fatal("expected version skew between nodes")
+	}
+	if len(health.NodeVersions) != 2 {
+		t.Fatalf("node versions = %v", health.NodeVersions)
+	}
+}
+
+func TestClient_GetCSIDriverPods_UsesLabelSelector(t *testing.T) {
+	labeled := csiPod("truenas-nfs-node-a", "node", "worker-a", "democraticcsi/democratic-csi:v1.8.3")
+	unrelated := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "democratic-csi"}}
+
+	fakeClient := fake.NewSimpleClientset(labeled, unrelated)
+	var selectors []string
+	fakeClient.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selectors = append(selectors, action.(k8stesting.ListAction).GetListRestrictions().Labels.String())
+		return false, nil, nil
+	})
+
+	c := &client{
+		clientset: fakeClient,
+		config:    Config{Namespace: "democratic-csi", CSIPodSelector: DefaultCSIPodSelector},
+		logger:    testLogger(t),
+	}
+
+	pods, err := c.GetCSIDriverPods(context.Background(), "democratic-csi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "truenas-nfs-node-a" {
+		t.Fatalf("expected only the labeled CSI pod, got %v", pods)
+	}
+	if len(selectors) != 1 || selectors[0] != DefaultCSIPodSelector {
+		t.Fatalf("expected a single selector-based list, got %v", selectors)
+	}
+}
+
+func TestClient_GetCSIDriverPods_FallsBackWhenSelectorMatchesNothing(t *testing.T) {
+	legacy := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "csi-nfs-node-a", Namespace: "democratic-csi"}}
+	unrelated := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "democratic-csi"}}
+
+	fakeClient := fake.NewSimpleClientset(legacy, unrelated)
+	var lists int
+	fakeClient.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return false, nil, nil
+	})
+
+	c := &client{
+		clientset: fakeClient,
+		config:    Config{Namespace: "democratic-csi"},
+		logger:    testLogger(t),
+	}
+
+	pods, err := c.GetCSIDriverPods(context.Background(), "democratic-csi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "csi-nfs-node-a" {
+		t.Fatalf("expected fallback to find the name-matched CSI pod, got %v", pods)
+	}
+	if lists != 2 {
+		t.Fatalf("expected selector list plus fallback list, got %d lists", lists)
+	}
+}
+
+func TestClient_CheckCSIDriverHealth_IncludesResourceVersion(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	fakeClient.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &v1.PodList{
+			ListMeta: metav1.ListMeta{ResourceVersion: "12345"},
+			Items:    []v1.Pod{*csiPod("truenas-nfs-node-a", "node", "worker-a", "democraticcsi/democratic-csi:v1.8.3")},
+		}, nil
+	})
+
+	c := &client{
+		clientset: fakeClient,
+		config:    Config{Namespace: "democratic-csi"},
+		logger:    testLogger(t),
+	}
+
+	health, err := c.CheckCSIDriverHealth(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if health.ResourceVersion != "12345" {
+		t.Fatalf("resource version = %q, want 12345", health.ResourceVersion)
+	}
+}
+
+func TestNewClient_RejectsInvalidCSIPodSelector(t *testing.T) {
+	_, err := NewClient(Config{Kubeconfig: "testdata/does-not-exist", CSIPodSelector: "app in (("})
+	if err == nil {
+		t.Fatal("expected error for invalid selector")
+	}
+}
@@ -0,0 +1,18 @@
+package k8s
+
+// objectPointer is a pointer to an API object that deep-copies into another.
+type objectPointer[T any] interface {
+	*T
+	DeepCopyInto(*T)
+}
+
+// DeepCopyItems returns deep copies of items, never nil. List
+// implementations serving objects from a shared store, such as an informer
+// cache or a test fixture, return it so callers own what they list.
+func DeepCopyItems[T any, P objectPointer[T]](items []T) []T {
+	copies := make([]T, len(items))
+	for i := range items {
+		P(&items[i]).DeepCopyInto(&copies[i])
+	}
+	return copies
+}
@@ -0,0 +1,474 @@
+// Package k8stest provides an in-memory k8s.Client for tests.
+package k8stest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+)
+
+// Client is a hand-written k8s.Client mock. Set the data fields to control
+// what the list calls return and the *Err fields to make a call fail. The
+// namespaced calls filter by namespace, with "" meaning all namespaces, and
+// the filtered calls apply the same rules as the real client. Calls records
+// how many times each method was invoked. Listed objects are deep copies,
+// as the k8s.Client contract requires.
+type Client struct {
+	PersistentVolumes      []corev1.PersistentVolume
+	PersistentVolumeClaims []corev1.PersistentVolumeClaim
+	VolumeSnapshots        []snapshotv1.VolumeSnapshot
+	VolumeSnapshotContents []snapshotv1.VolumeSnapshotContent
+	VolumeSnapshotClasses  []snapshotv1.VolumeSnapshotClass
+	StorageClasses         []storagev1.StorageClass
+	Pods                   []corev1.Pod
+	// Events are returned by ListPersistentVolumeClaimEvents when they
+	// involve a PersistentVolumeClaim.
+	Events            []corev1.Event
+	Namespaces        []corev1.Namespace
+	CSINodes          []storagev1.CSINode
+	CSIDrivers        []storagev1.CSIDriver
+	VolumeAttachments []storagev1.VolumeAttachment
+	Nodes             []corev1.Node
+	// ResourceVersion is returned by ListPersistentVolumesWithResourceVersion.
+	ResourceVersion string
+	// UnreadableNamespaces are left out of PVC and VolumeSnapshot lists
+	// across all namespaces, which then return a
+	// *k8s.UnreadableNamespacesError as the real client does when RBAC
+	// denies them.
+	UnreadableNamespaces []string
+	// CSIDriverHealth is returned by CheckCSIDriverHealth; when nil the
+	// health is built from the CSI driver pods among Pods.
+	CSIDriverHealth *k8s.CSIDriverHealth
+	RBAC            *k8s.RBACValidationResult
+	ClusterInfo     *k8s.ClusterInfo
+	EffectiveUser   *k8s.UserInfo
+
+	ListPersistentVolumesErr      error
+	ListPersistentVolumeClaimsErr error
+	ListVolumeSnapshotsErr        error
+	ListSnapshotContentsErr       error
+	ListSnapshotClassesErr        error
+	ListStorageClassesErr         error
+	ListPodsErr                   error
+	ListEventsErr                 error
+	ListNamespacesErr             error
+	ListCSIErr                    error
+	ListNodesErr                  error
+	CheckCSIDriverHealthErr       error
+	ValidateRBACErr               error
+	GetClusterInfoErr             error
+	TestConnectionErr             error
+	GetEffectiveUserErr           error
+	CreateEventErr                error
+	DeleteSnapshotContentErr      error
+
+	mu            sync.Mutex
+	calls         map[string]int
+	createdEvents []corev1.Event
+	deleted       []string
+}
+
+var _ k8s.Client = (*Client)(nil)
+
+// ListPersistentVolumes returns PersistentVolumes or ListPersistentVolumesErr.
+func (c *Client) ListPersistentVolumes(context.Context) ([]corev1.PersistentVolume, error) {
+	c.record("ListPersistentVolumes")
+	if c.ListPersistentVolumesErr != nil {
+		return nil, c.ListPersistentVolumesErr
+	}
+	return k8s.DeepCopyItems(c.PersistentVolumes), nil
+}
+
+// ListPersistentVolumesWithResourceVersion returns PersistentVolumes and
+// ResourceVersion, or ListPersistentVolumesErr.
+func (c *Client) ListPersistentVolumesWithResourceVersion(context.Context) ([]corev1.PersistentVolume, string, error) {
+	c.record("ListPersistentVolumesWithResourceVersion")
+	if c.ListPersistentVolumesErr != nil {
+		return nil, "", c.ListPersistentVolumesErr
+	}
+	return k8s.DeepCopyItems(c.PersistentVolumes), c.ResourceVersion, nil
+}
+
+// ListPersistentVolumeClaims returns the PersistentVolumeClaims of namespace,
+// or ListPersistentVolumeClaimsErr.
+func (c *Client) ListPersistentVolumeClaims(_ context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	c.record("ListPersistentVolumeClaims")
+	if c.ListPersistentVolumeClaimsErr != nil {
+		return nil, c.ListPersistentVolumeClaimsErr
+	}
+	return filter(c.PersistentVolumeClaims, func(pvc corev1.PersistentVolumeClaim) bool {
+		return inNamespace(pvc.Namespace, namespace) && c.readable(pvc.Namespace, namespace)
+	}), c.unreadableErr("persistentvolumeclaims", namespace)
+}
+
+// ListVolumeSnapshots returns the VolumeSnapshots of namespace, or
+// ListVolumeSnapshotsErr.
+func (c *Client) ListVolumeSnapshots(_ context.Context, namespace string) ([]snapshotv1.VolumeSnapshot, error) {
+	c.record("ListVolumeSnapshots")
+	if c.ListVolumeSnapshotsErr != nil {
+		return nil, c.ListVolumeSnapshotsErr
+	}
+	return filter(c.VolumeSnapshots, func(snapshot snapshotv1.VolumeSnapshot) bool {
+		return inNamespace(snapshot.Namespace, namespace) && c.readable(snapshot.Namespace, namespace)
+	}), c.unreadableErr("volumesnapshots", namespace)
+}
+
+// ListVolumeSnapshotContents returns VolumeSnapshotContents or
+// ListSnapshotContentsErr.
+func (c *Client) ListVolumeSnapshotContents(context.Context) ([]snapshotv1.VolumeSnapshotContent, error) {
+	c.record("ListVolumeSnapshotContents")
+	if c.ListSnapshotContentsErr != nil {
+		return nil, c.ListSnapshotContentsErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return k8s.DeepCopyItems(c.VolumeSnapshotContents), nil
+}
+
+// DeleteVolumeSnapshotContent removes the named content from
+// VolumeSnapshotContents, or returns DeleteSnapshotContentErr or a NotFound
+// error.
+func (c *Client) DeleteVolumeSnapshotContent(_ context.Context, name string) error {
+	c.record("DeleteVolumeSnapshotContent")
+	if c.DeleteSnapshotContentErr != nil {
+		return c.DeleteSnapshotContentErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, content := range c.VolumeSnapshotContents {
+		if content.Name == name {
+			c.VolumeSnapshotContents = append(c.VolumeSnapshotContents[:i:i], c.VolumeSnapshotContents[i+1:]...)
+			c.deleted = append(c.deleted, name)
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{Group: "snapshot.storage.k8s.io", Resource: "volumesnapshotcontents"}, name)
+}
+
+// DeletedSnapshotContents returns the names DeleteVolumeSnapshotContent
+// removed, in order.
+func (c *Client) DeletedSnapshotContents() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.deleted...)
+}
+
+// ListVolumeSnapshotClasses returns VolumeSnapshotClasses or
+// ListSnapshotClassesErr.
+func (c *Client) ListVolumeSnapshotClasses(context.Context) ([]snapshotv1.VolumeSnapshotClass, error) {
+	c.record("ListVolumeSnapshotClasses")
+	if c.ListSnapshotClassesErr != nil {
+		return nil, c.ListSnapshotClassesErr
+	}
+	return k8s.DeepCopyItems(c.VolumeSnapshotClasses), nil
+}
+
+// ListStorageClasses returns StorageClasses or ListStorageClassesErr.
+func (c *Client) ListStorageClasses(context.Context) ([]storagev1.StorageClass, error) {
+	c.record("ListStorageClasses")
+	if c.ListStorageClassesErr != nil {
+		return nil, c.ListStorageClassesErr
+	}
+	return k8s.DeepCopyItems(c.StorageClasses), nil
+}
+
+// ListPods returns the Pods of namespace, or ListPodsErr.
+func (c *Client) ListPods(_ context.Context, namespace string) ([]corev1.Pod, error) {
+	c.record("ListPods")
+	if c.ListPodsErr != nil {
+		return nil, c.ListPodsErr
+	}
+	return filter(c.Pods, func(pod corev1.Pod) bool {
+		return inNamespace(pod.Namespace, namespace)
+	}), nil
+}
+
+// ListPersistentVolumeClaimEvents returns the Events of namespace that involve
+// a PersistentVolumeClaim, or ListEventsErr.
+func (c *Client) ListPersistentVolumeClaimEvents(_ context.Context, namespace string) ([]corev1.Event, error) {
+	c.record("ListPersistentVolumeClaimEvents")
+	if c.ListEventsErr != nil {
+		return nil, c.ListEventsErr
+	}
+	return filter(c.Events, func(event corev1.Event) bool {
+		return inNamespace(event.Namespace, namespace) && event.InvolvedObject.Kind == "PersistentVolumeClaim"
+	}), nil
+}
+
+// CreateEvent records event, or returns CreateEventErr without recording it.
+func (c *Client) CreateEvent(_ context.Context, event *corev1.Event) error {
+	c.record("CreateEvent")
+	if c.CreateEventErr != nil {
+		return c.CreateEventErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.createdEvents = append(c.createdEvents, *event.DeepCopy())
+	return nil
+}
+
+// CreatedEvents returns the events recorded by CreateEvent, in order.
+func (c *Client) CreatedEvents() []corev1.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return k8s.DeepCopyItems(c.createdEvents)
+}
+
+// ListNamespaces returns Namespaces or ListNamespacesErr.
+func (c *Client) ListNamespaces(context.Context) ([]corev1.Namespace, error) {
+	c.record("ListNamespaces")
+	if c.ListNamespacesErr != nil {
+		return nil, c.ListNamespacesErr
+	}
+	return k8s.DeepCopyItems(c.Namespaces), nil
+}
+
+// GetNamespace returns the entry of Namespaces named name, a NotFound error
+// when there is none, or ListNamespacesErr.
+func (c *Client) GetNamespace(_ context.Context, name string) (*corev1.Namespace, error) {
+	c.record("GetNamespace")
+	if c.ListNamespacesErr != nil {
+		return nil, c.ListNamespacesErr
+	}
+	for _, namespace := range c.Namespaces {
+		if namespace.Name == name {
+			return &namespace, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, name)
+}
+
+// ListPersistentVolumesByStorageClass returns the PersistentVolumes of
+// storageClass, or ListPersistentVolumesErr.
+func (c *Client) ListPersistentVolumesByStorageClass(_ context.Context, storageClass string) ([]corev1.PersistentVolume, error) {
+	c.record("ListPersistentVolumesByStorageClass")
+	if c.ListPersistentVolumesErr != nil {
+		return nil, c.ListPersistentVolumesErr
+	}
+	return filter(c.PersistentVolumes, func(pv corev1.PersistentVolume) bool {
+		return pv.Spec.StorageClassName == storageClass
+	}), nil
+}
+
+// ListPersistentVolumeClaimsByStorageClass returns the PersistentVolumeClaims
+// of namespace that request storageClass, or ListPersistentVolumeClaimsErr.
+func (c *Client) ListPersistentVolumeClaimsByStorageClass(_ context.Context, namespace, storageClass string) ([]corev1.PersistentVolumeClaim, error) {
+	c.record("ListPersistentVolumeClaimsByStorageClass")
+	if c.ListPersistentVolumeClaimsErr != nil {
+		return nil, c.ListPersistentVolumeClaimsErr
+	}
+	return filter(c.PersistentVolumeClaims, func(pvc corev1.PersistentVolumeClaim) bool {
+		return inNamespace(pvc.Namespace, namespace) &&
+			pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName == storageClass
+	}), nil
+}
+
+// ListDemocraticCSIPersistentVolumes returns the PersistentVolumes provisioned
+// by a democratic-csi driver, or ListPersistentVolumesErr.
+func (c *Client) ListDemocraticCSIPersistentVolumes(context.Context) ([]corev1.PersistentVolume, error) {
+	c.record("ListDemocraticCSIPersistentVolumes")
+	if c.ListPersistentVolumesErr != nil {
+		return nil, c.ListPersistentVolumesErr
+	}
+	return filter(c.PersistentVolumes, func(pv corev1.PersistentVolume) bool {
+		return pv.Spec.CSI != nil && k8s.IsDemocraticCSIDriver(pv.Spec.CSI.Driver)
+	}), nil
+}
+
+// ListUnboundPersistentVolumeClaims returns the pending PersistentVolumeClaims
+// of namespace, or ListPersistentVolumeClaimsErr.
+func (c *Client) ListUnboundPersistentVolumeClaims(_ context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	c.record("ListUnboundPersistentVolumeClaims")
+	if c.ListPersistentVolumeClaimsErr != nil {
+		return nil, c.ListPersistentVolumeClaimsErr
+	}
+	return filter(c.PersistentVolumeClaims, func(pvc corev1.PersistentVolumeClaim) bool {
+		return inNamespace(pvc.Namespace, namespace) && c.readable(pvc.Namespace, namespace) && pvc.Status.Phase == corev1.ClaimPending
+	}), c.unreadableErr("persistentvolumeclaims", namespace)
+}
+
+// TestConnection returns TestConnectionErr.
+func (c *Client) TestConnection(context.Context) error {
+	c.record("TestConnection")
+	return c.TestConnectionErr
+}
+
+// GetEffectiveUser returns EffectiveUser, an empty identity when it is nil,
+// or GetEffectiveUserErr.
+func (c *Client) GetEffectiveUser(context.Context) (*k8s.UserInfo, error) {
+	c.record("GetEffectiveUser")
+	if c.GetEffectiveUserErr != nil {
+		return nil, c.GetEffectiveUserErr
+	}
+	if c.EffectiveUser == nil {
+		return &k8s.UserInfo{}, nil
+	}
+	user := *c.EffectiveUser
+	return &user, nil
+}
+
+// ValidateRBACPermissions returns RBAC, a result with every permission
+// granted when RBAC is nil, or ValidateRBACErr.
+func (c *Client) ValidateRBACPermissions(context.Context) (*k8s.RBACValidationResult, error) {
+	c.record("ValidateRBACPermissions")
+	if c.ValidateRBACErr != nil {
+		return nil, c.ValidateRBACErr
+	}
+	if c.RBAC == nil {
+		return &k8s.RBACValidationResult{
+			HasRequiredPermissions: true,
+			MissingPermissions:     []string{},
+			PermissionChecks:       map[string]bool{},
+		}, nil
+	}
+	result := *c.RBAC
+	return &result, nil
+}
+
+// GetClusterInfo returns ClusterInfo or GetClusterInfoErr.
+func (c *Client) GetClusterInfo(context.Context) (*k8s.ClusterInfo, error) {
+	c.record("GetClusterInfo")
+	if c.GetClusterInfoErr != nil {
+		return nil, c.GetClusterInfoErr
+	}
+	if c.ClusterInfo == nil {
+		return &k8s.ClusterInfo{}, nil
+	}
+	info := *c.ClusterInfo
+	return &info, nil
+}
+
+// ListCSINodes returns CSINodes or ListCSIErr.
+func (c *Client) ListCSINodes(context.Context) ([]storagev1.CSINode, error) {
+	c.record("ListCSINodes")
+	if c.ListCSIErr != nil {
+		return nil, c.ListCSIErr
+	}
+	return k8s.DeepCopyItems(c.CSINodes), nil
+}
+
+// ListCSIDrivers returns CSIDrivers or ListCSIErr.
+func (c *Client) ListCSIDrivers(context.Context) ([]storagev1.CSIDriver, error) {
+	c.record("ListCSIDrivers")
+	if c.ListCSIErr != nil {
+		return nil, c.ListCSIErr
+	}
+	return k8s.DeepCopyItems(c.CSIDrivers), nil
+}
+
+// ListVolumeAttachments returns VolumeAttachments or ListCSIErr.
+func (c *Client) ListVolumeAttachments(context.Context) ([]storagev1.VolumeAttachment, error) {
+	c.record("ListVolumeAttachments")
+	if c.ListCSIErr != nil {
+		return nil, c.ListCSIErr
+	}
+	return k8s.DeepCopyItems(c.VolumeAttachments), nil
+}
+
+// ListNodes returns Nodes or ListNodesErr.
+func (c *Client) ListNodes(context.Context) ([]corev1.Node, error) {
+	c.record("ListNodes")
+	if c.ListNodesErr != nil {
+		return nil, c.ListNodesErr
+	}
+	return k8s.DeepCopyItems(c.Nodes), nil
+}
+
+// GetCSIDriverPods returns the Pods of namespace that look like CSI driver
+// pods, or ListPodsErr.
+func (c *Client) GetCSIDriverPods(_ context.Context, namespace string) ([]corev1.Pod, error) {
+	c.record("GetCSIDriverPods")
+	if c.ListPodsErr != nil {
+		return nil, c.ListPodsErr
+	}
+	return c.csiDriverPods(namespace), nil
+}
+
+// CheckCSIDriverHealth returns CSIDriverHealth, or the health of the CSI
+// driver pods of namespace when it is nil, or CheckCSIDriverHealthErr.
+func (c *Client) CheckCSIDriverHealth(_ context.Context, namespace string) (*k8s.CSIDriverHealth, error) {
+	c.record("CheckCSIDriverHealth")
+	if c.CheckCSIDriverHealthErr != nil {
+		return nil, c.CheckCSIDriverHealthErr
+	}
+	if c.CSIDriverHealth != nil {
+		health := *c.CSIDriverHealth
+		return &health, nil
+	}
+	return k8s.BuildCSIDriverHealth(namespace, c.csiDriverPods(namespace)), nil
+}
+
+// Calls returns how many times method has been called.
+func (c *Client) Calls(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+func (c *Client) record(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[method]++
+}
+
+func (c *Client) csiDriverPods(namespace string) []corev1.Pod {
+	return filter(c.Pods, func(pod corev1.Pod) bool {
+		return inNamespace(pod.Namespace, namespace) && k8s.IsCSIDriverPod(pod)
+	})
+}
+
+func inNamespace(objectNamespace, namespace string) bool {
+	return namespace == "" || objectNamespace == namespace
+}
+
+// readable reports whether a list of namespace returns the objects of
+// objectNamespace.
+func (c *Client) readable(objectNamespace, namespace string) bool {
+	if namespace != "" {
+		return true
+	}
+	for _, unreadable := range c.UnreadableNamespaces {
+		if unreadable == objectNamespace {
+			return false
+		}
+	}
+	return true
+}
+
+// unreadableErr returns the *k8s.UnreadableNamespacesError of a list of
+// namespace, or nil. Its total is the number of Namespaces.
+func (c *Client) unreadableErr(resource, namespace string) error {
+	if namespace != "" || len(c.UnreadableNamespaces) == 0 {
+		return nil
+	}
+	err := &k8s.UnreadableNamespacesError{Resource: resource, Namespaces: make(map[string]string), Total: len(c.Namespaces)}
+	for _, unreadable := range c.UnreadableNamespaces {
+		err.Namespaces[unreadable] = fmt.Sprintf("%s is forbidden in namespace %s", resource, unreadable)
+	}
+	return err
+}
+
+// filter returns deep copies of the items kept by keep, never nil.
+func filter[T any, P interface {
+	*T
+	DeepCopyInto(*T)
+}](items []T, keep func(T) bool) []T {
+	kept := []T{}
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return k8s.DeepCopyItems[T, P](kept)
+}
@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UnreadableNamespacesError reports namespaces a list across all namespaces
+// could not read. The list was forbidden cluster-wide, so it was repeated
+// namespace by namespace, and these namespaces were forbidden too. The list
+// call returns the items of the readable namespaces along with it.
+type UnreadableNamespacesError struct {
+	Resource string
+	// Namespaces maps each unreadable namespace to its error.
+	Namespaces map[string]string
+	// Total is the number of namespaces in the cluster.
+	Total int
+}
+
+func (e *UnreadableNamespacesError) Error() string {
+	names := e.Names()
+	return fmt.Sprintf("cannot list %s in %d of %d namespaces: %s", e.Resource, len(names), e.Total, strings.Join(names, ", "))
+}
+
+// Names returns the unreadable namespaces, sorted.
+func (e *UnreadableNamespacesError) Names() []string {
+	names := make([]string, 0, len(e.Namespaces))
+	for name := range e.Namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namespacedPageFunc returns the listPageFunc of resource in namespace.
+type namespacedPageFunc[T any] func(namespace string) listPageFunc[T]
+
+// listNamespaced lists resource in namespace, "" meaning all namespaces.
+// When listing all namespaces is forbidden it lists each namespace instead
+// and returns the items of the readable ones with an
+// *UnreadableNamespacesError naming the others. Without permission to list
+// namespaces the original error is returned.
+func listNamespaced[T any](ctx context.Context, c *client, resource, namespace string, opts metav1.ListOptions, list namespacedPageFunc[T]) ([]T, error) {
+	items, _, err := listAllPages(ctx, c, resource, opts, list(namespace))
+	if err == nil || namespace != metav1.NamespaceAll || !apierrors.IsForbidden(err) {
+		return items, err
+	}
+	namespaces, nsErr := c.ListNamespaces(ctx)
+	if nsErr != nil {
+		return nil, err
+	}
+	c.logger.Warn("Listing across all namespaces is forbidden; listing namespace by namespace",
+		zap.String("resource", resource),
+		zap.Int("namespaces", len(namespaces)))
+
+	unreadable := &UnreadableNamespacesError{Resource: resource, Namespaces: make(map[string]string), Total: len(namespaces)}
+	items = nil
+	for _, ns := range namespaces {
+		nsItems, _, err := listAllPages(ctx, c, resource, opts, list(ns.Name))
+		if apierrors.IsForbidden(err) {
+			unreadable.Namespaces[ns.Name] = err.Error()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, nsItems...)
+	}
+	if len(unreadable.Namespaces) == 0 {
+		return items, nil
+	}
+	c.logger.Warn("Skipped namespaces that cannot be listed",
+		zap.String("resource", resource),
+		zap.Strings("namespaces", unreadable.Names()),
+		zap.Int("total_namespaces", unreadable.Total))
+	return items, unreadable
+}
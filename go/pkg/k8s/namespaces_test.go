@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// forbiddenPVCLists makes PVC lists across all namespaces and in the given
+// namespaces forbidden.
+func forbiddenPVCLists(fakeClient *fake.Clientset, namespaces ...string) {
+	denied := map[string]bool{"": true}
+	for _, namespace := range namespaces {
+		denied[namespace] = true
+	}
+	fakeClient.PrependReactor("list", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !denied[action.GetNamespace()] {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "persistentvolumeclaims"}, "", errors.New("RBAC: access denied"))
+	})
+}
+
+func TestClient_ListPersistentVolumeClaims_fallsBackPerNamespace(t *testing.T) {
+	ctx := context.Background()
+	fakeClient := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-c"}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "team-a"}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "team-b"}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "team-c"}},
+	)
+	forbiddenPVCLists(fakeClient, "team-b")
+	c := &client{clientset: fakeClient, logger: testLogger(t)}
+
+	pvcs, err := c.ListPersistentVolumeClaims(ctx, "")
+	var unreadable *UnreadableNamespacesError
+	if !errors.As(err, &unreadable) {
+		t.Fatalf("err = %v, want *UnreadableNamespacesError", err)
+	}
+	if unreadable.Total != 3 || len(unreadable.Namespaces) != 1 || unreadable.Namespaces["team-b"] == "" {
+		t.Fatalf("unreadable = %+v, want team-b of 3 namespaces", unreadable)
+	}
+	if len(pvcs) != 2 {
+		t.Fatalf("got %d PVCs, want the 2 readable ones", len(pvcs))
+	}
+
+	if _, err := c.ListPersistentVolumeClaims(ctx, "team-b"); errors.As(err, &unreadable) || !apierrors.IsForbidden(err) {
+		t.Fatalf("single namespace err = %v, want the Forbidden error", err)
+	}
+}
+
+func TestClient_ListPersistentVolumeClaims_fallbackReadsEveryNamespace(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "team-a"}},
+	)
+	forbiddenPVCLists(fakeClient)
+	c := &client{clientset: fakeClient, logger: testLogger(t)}
+
+	pvcs, err := c.ListPersistentVolumeClaims(context.Background(), "")
+	if err != nil || len(pvcs) != 1 {
+		t.Fatalf("got %d PVCs, err %v; want 1 and no error", len(pvcs), err)
+	}
+}
+
+func TestClient_ValidateRBACPermissions_namesUnreadableNamespaces(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+	)
+	fakeClient.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		denied := attrs.Resource == "persistentvolumeclaims" && attrs.Verb == "list" && (attrs.Namespace == "" || attrs.Namespace == "team-b")
+		review.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: !denied}
+		return true, review, nil
+	})
+	c := &client{clientset: fakeClient, logger: testLogger(t)}
+
+	result, err := c.ValidateRBACPermissions(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.UnreadableNamespaces; len(got) != 1 || len(got["team-b"]) != 1 || got["team-b"][0] != "persistentvolumeclaims/list" {
+		t.Fatalf("unreadable namespaces = %v, want team-b missing persistentvolumeclaims/list", got)
+	}
+	found := false
+	for _, missing := range result.MissingPermissions {
+		if missing == "persistentvolumeclaims/list (namespace team-b)" {
+			found = true
+		}
+	}
+	if !found || result.HasRequiredPermissions {
+		t.Fatalf("missing permissions = %v, want team-b called out", result.MissingPermissions)
+	}
+}
@@ -0,0 +1,99 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// DefaultListPageSize is the number of objects requested per list call.
+const DefaultListPageSize int64 = 500
+
+// listPageFunc fetches a single page of a list call.
+type listPageFunc[T any] func(ctx context.Context, opts metav1.ListOptions) ([]T, metav1.ListMeta, error)
+
+// pageSize returns the configured list page size or DefaultListPageSize.
+func (c *client) pageSize() int64 {
+	if c.config.PageSize > 0 {
+		return c.config.PageSize
+	}
+	return DefaultListPageSize
+}
+
+// listAllPages follows Continue tokens until the list is exhausted and returns
+// all items with the resourceVersion of the final page. Each page is retried
+// on transient errors. When the continue token expires mid-list the list is
+// restarted once from the beginning so callers never see a torn snapshot.
+func listAllPages[T any](ctx context.Context, c *client, resource string, opts metav1.ListOptions, list listPageFunc[T]) ([]T, string, error) {
+	ctx, span := tracing.Start(ctx, "k8s.list "+resource, tracing.WithKind(tracing.SpanKindClient),
+		tracing.WithAttributes(tracing.String("k8s.resource", resource)))
+	defer span.End()
+
+	opts.Limit = c.pageSize()
+	opts.Continue = ""
+
+	var items []T
+	var resourceVersion string
+	restarted := false
+	pages := 0
+
+	for {
+		if pages > 0 {
+			if err := ctx.Err(); err != nil {
+				span.RecordError(err)
+				return nil, "", fmt.Errorf("listing %s interrupted after %d pages: %w", resource, pages, err)
+			}
+		}
+
+		var pageItems []T
+		var meta metav1.ListMeta
+		err := retry.OnError(
+			retry.DefaultRetry,
+			isTransientK8sError,
+			func() error {
+				var err error
+				pageItems, meta, err = list(ctx, opts)
+				return err
+			},
+		)
+		if err != nil {
+			if apierrors.IsResourceExpired(err) && opts.Continue != "" && !restarted {
+				c.logger.Warn("Continue token expired, restarting list",
+					zap.String("resource", resource),
+					zap.Int("pages", pages))
+				restarted = true
+				items = nil
+				pages = 0
+				opts.Continue = ""
+				continue
+			}
+			span.RecordError(err)
+			return nil, "", err
+		}
+
+		items = append(items, pageItems...)
+		resourceVersion = meta.ResourceVersion
+		pages++
+
+		if meta.Continue == "" {
+			break
+		}
+		opts.Continue = meta.Continue
+	}
+
+	span.SetAttributes(tracing.Int("k8s.items", len(items)), tracing.Int("k8s.pages", pages))
+	c.logger.Debug("Paginated list completed",
+		zap.String("resource", resource),
+		zap.Int("pages", pages),
+		zap.Int("count", len(items)),
+		zap.String("resource_version", resourceVersion))
+
+	return items, resourceVersion, nil
+}
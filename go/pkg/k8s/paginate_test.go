@@ -0,0 +1,183 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// The fake clientset drops Limit and Continue from list actions, so PV lists
+// are routed through these wrappers to reach the reactor with full options.
+type pagingClientset struct {
+	kubernetes.Interface
+	reactor *pagingPVReactor
+}
+
+func (p pagingClientset) CoreV1() typedcorev1.CoreV1Interface {
+	return pagingCoreV1{CoreV1Interface: p.Interface.CoreV1(), reactor: p.reactor}
+}
+
+type pagingCoreV1 struct {
+	typedcorev1.CoreV1Interface
+	reactor *pagingPVReactor
+}
+
+func (p pagingCoreV1) PersistentVolumes() typedcorev1.PersistentVolumeInterface {
+	return pagingPVInterface{PersistentVolumeInterface: p.CoreV1Interface.PersistentVolumes(), reactor: p.reactor}
+}
+
+type pagingPVInterface struct {
+	typedcorev1.PersistentVolumeInterface
+	reactor *pagingPVReactor
+}
+
+func (p pagingPVInterface) List(_ context.Context, opts metav1.ListOptions) (*v1.PersistentVolumeList, error) {
+	return p.reactor.list(opts)
+}
+
+// pagingPVReactor serves PVs in pages and rejects requests whose Limit or
+// Continue token does not match what the previous page handed out.
+type pagingPVReactor struct {
+	pvs        []v1.PersistentVolume
+	limit      int64
+	calls      int
+	expireOnce string
+	onPage     func(page int)
+}
+
+func (r *pagingPVReactor) list(opts metav1.ListOptions) (*v1.PersistentVolumeList, error) {
+	r.calls++
+	if opts.Limit != r.limit {
+		return nil, fmt.Errorf("limit = %d, want %d", opts.Limit, r.limit)
+	}
+
+	start := 0
+	if opts.Continue != "" {
+		if opts.Continue == r.expireOnce {
+			r.expireOnce = ""
+			return nil, apierrors.NewResourceExpired("continue token expired")
+		}
+		offset, err := strconv.Atoi(opts.Continue[len("page-"):])
+		if err != nil || offset <= 0 || offset >= len(r.pvs) {
+			return nil, apierrors.NewBadRequest("invalid continue token " + opts.Continue)
+		}
+		start = offset
+	}
+	if r.onPage != nil {
+		r.onPage(start / int(r.limit))
+	}
+
+	end := start + int(r.limit)
+	list := &v1.PersistentVolumeList{ListMeta: metav1.ListMeta{ResourceVersion: strconv.Itoa(100 + start)}}
+	if end < len(r.pvs) {
+		list.Continue = "page-" + strconv.Itoa(end)
+	} else {
+		end = len(r.pvs)
+	}
+	list.Items = r.pvs[start:end]
+	return list, nil
+}
+
+func pagedPVs(n int) []v1.PersistentVolume {
+	pvs := make([]v1.PersistentVolume, n)
+	for i := range pvs {
+		pvs[i].Name = fmt.Sprintf("pv-%04d", i)
+	}
+	return pvs
+}
+
+func newPagingClient(t *testing.T, reactor *pagingPVReactor, pageSize int64) *client {
+	t.Helper()
+	return &client{
+		clientset: pagingClientset{Interface: fake.NewSimpleClientset(), reactor: reactor},
+		config:    Config{PageSize: pageSize},
+		logger:    testLogger(t),
+	}
+}
+
+func TestClient_ListPersistentVolumes_FollowsContinueTokens(t *testing.T) {
+	reactor := &pagingPVReactor{pvs: pagedPVs(25), limit: 10}
+	c := newPagingClient(t, reactor, 10)
+
+	pvs, resourceVersion, err := c.ListPersistentVolumesWithResourceVersion(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pvs) != 25 {
+		t.Fatalf("expected 25 PVs, got %d", len(pvs))
+	}
+	for i, pv := range pvs {
+		if pv.Name != fmt.Sprintf("pv-%04d", i) {
+			t.Fatalf("pv %d = %s, pages out of order", i, pv.Name)
+		}
+	}
+	if reactor.calls != 3 {
+		t.Fatalf("expected 3 page requests, got %d", reactor.calls)
+	}
+	if resourceVersion != "120" {
+		t.Fatalf("resource version = %q, want the final page's 120", resourceVersion)
+	}
+}
+
+func TestClient_ListPersistentVolumes_DefaultPageSize(t *testing.T) {
+	reactor := &pagingPVReactor{pvs: pagedPVs(int(DefaultListPageSize)*2 + 1), limit: DefaultListPageSize}
+	c := newPagingClient(t, reactor, 0)
+
+	pvs, err := c.ListPersistentVolumes(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if int64(len(pvs)) != DefaultListPageSize*2+1 || reactor.calls != 3 {
+		t.Fatalf("got %d PVs in %d calls", len(pvs), reactor.calls)
+	}
+}
+
+func TestClient_ListPersistentVolumes_RestartsOnExpiredContinue(t *testing.T) {
+	reactor := &pagingPVReactor{pvs: pagedPVs(15), limit: 10, expireOnce: "page-10"}
+	c := newPagingClient(t, reactor, 10)
+
+	pvs, err := c.ListPersistentVolumes(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pvs) != 15 {
+		t.Fatalf("expected 15 PVs without duplicates after restart, got %d", len(pvs))
+	}
+	if reactor.calls != 4 {
+		t.Fatalf("expected 4 page requests (2 before expiry, 2 after restart), got %d", reactor.calls)
+	}
+}
+
+func TestClient_ListPersistentVolumes_StopsWhenContextCancelledBetweenPages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reactor := &pagingPVReactor{pvs: pagedPVs(30), limit: 10}
+	reactor.onPage = func(page int) {
+		if page == 0 {
+			cancel()
+		}
+	}
+	c := newPagingClient(t, reactor, 10)
+
+	if _, err := c.ListPersistentVolumes(ctx); err == nil {
+		t.Fatal("expected an error after cancellation")
+	}
+	if reactor.calls != 1 {
+		t.Fatalf("expected listing to stop after the first page, got %d calls", reactor.calls)
+	}
+}
+
+func TestNewClient_RejectsNegativePageSize(t *testing.T) {
+	if _, err := NewClient(Config{PageSize: -1}); err == nil {
+		t.Fatal("expected error for negative page size")
+	}
+}
@@ -3,6 +3,8 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	authorizationv1 "k8s.io/api/authorization/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,14 +32,18 @@ func (c *client) ValidateRBACPermissions(ctx context.Context) (*RBACValidationRe
 	pvcNamespace := c.config.Namespace
 	pvcListKey := "persistentvolumeclaims/list"
 	pvcGetKey := "persistentvolumeclaims/get"
+	// Events explain why a PVC is still Pending.
+	eventListKey := "events/list"
 	if scanAllNamespaces {
 		pvcListKey = "persistentvolumeclaims/list (all namespaces)"
 		pvcGetKey = "persistentvolumeclaims/get (all namespaces)"
+		eventListKey = "events/list (all namespaces)"
 	}
 
 	requirements = append(requirements,
 		rbacRequirement{key: pvcListKey, resource: "persistentvolumeclaims", verb: "list", namespace: pvcNamespace},
 		rbacRequirement{key: pvcGetKey, resource: "persistentvolumeclaims", verb: "get", namespace: pvcNamespace},
+		rbacRequirement{key: eventListKey, resource: "events", verb: "list", namespace: pvcNamespace},
 	)
 
 	if c.snapshotClient != nil {
@@ -65,6 +71,22 @@ func (c *client) ValidateRBACPermissions(ctx context.Context) (*RBACValidationRe
 				verb:      "get",
 				namespace: snapNS,
 			},
+			rbacRequirement{
+				key:           "volumesnapshotcontents.snapshot.storage.k8s.io/list",
+				group:         "snapshot.storage.k8s.io",
+				version:       "v1",
+				resource:      "volumesnapshotcontents",
+				verb:          "list",
+				clusterScoped: true,
+			},
+			rbacRequirement{
+				key:           "volumesnapshotclasses.snapshot.storage.k8s.io/list",
+				group:         "snapshot.storage.k8s.io",
+				version:       "v1",
+				resource:      "volumesnapshotclasses",
+				verb:          "list",
+				clusterScoped: true,
+			},
 		)
 	}
 
@@ -87,15 +109,84 @@ func (c *client) ValidateRBACPermissions(ctx context.Context) (*RBACValidationRe
 		notes = append(notes, "skipped: volumesnapshots (snapshot client unavailable)")
 	}
 
+	var unreadable map[string][]string
+	if scanAllNamespaces {
+		var denied []rbacRequirement
+		for _, req := range requirements {
+			if req.verb == "list" && !req.clusterScoped && !permissionChecks[req.key] {
+				denied = append(denied, req)
+			}
+		}
+		var note string
+		var err error
+		unreadable, note, err = c.unreadableNamespaces(ctx, denied)
+		if err != nil {
+			return nil, err
+		}
+		if note != "" {
+			notes = append(notes, note)
+		}
+		names := make([]string, 0, len(unreadable))
+		for namespace := range unreadable {
+			names = append(names, namespace)
+		}
+		sort.Strings(names)
+		for _, namespace := range names {
+			for _, key := range unreadable[namespace] {
+				missing = append(missing, fmt.Sprintf("%s (namespace %s)", key, namespace))
+			}
+		}
+	}
+
 	return &RBACValidationResult{
 		HasRequiredPermissions: len(missing) == 0,
 		MissingPermissions:     append(missing, notes...),
 		PermissionChecks:       permissionChecks,
 		ServiceAccount:         "current",
 		Namespace:              reportNamespace,
+		UnreadableNamespaces:   unreadable,
 	}, nil
 }
 
+// unreadableNamespaces checks, for list permissions denied across all
+// namespaces, which namespaces deny them too. Scans list those namespace by
+// namespace, so only these namespaces are skipped. It returns the denied
+// permissions by namespace and a note when namespaces cannot be listed.
+func (c *client) unreadableNamespaces(ctx context.Context, denied []rbacRequirement) (map[string][]string, string, error) {
+	if len(denied) == 0 {
+		return nil, "", nil
+	}
+	allowed, err := c.checkSelfSubjectAccess(ctx, rbacRequirement{key: "namespaces/list", resource: "namespaces", verb: "list", clusterScoped: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("rbac validation failed for namespaces/list: %w", err)
+	}
+	if !allowed {
+		return nil, "namespaces/list is denied, so scans cannot fall back to listing namespace by namespace", nil
+	}
+	namespaces, err := c.ListNamespaces(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("rbac validation failed to list namespaces: %w", err)
+	}
+
+	unreadable := make(map[string][]string)
+	for _, ns := range namespaces {
+		for _, req := range denied {
+			req.namespace = ns.Name
+			allowed, err := c.checkSelfSubjectAccess(ctx, req)
+			if err != nil {
+				return nil, "", fmt.Errorf("rbac validation failed for %s in namespace %s: %w", req.key, ns.Name, err)
+			}
+			if !allowed {
+				unreadable[ns.Name] = append(unreadable[ns.Name], strings.TrimSuffix(req.key, " (all namespaces)"))
+			}
+		}
+	}
+	if len(unreadable) == 0 {
+		return nil, "every namespace grants the denied all-namespaces lists; scans list namespace by namespace", nil
+	}
+	return unreadable, "", nil
+}
+
 func (c *client) checkSelfSubjectAccess(ctx context.Context, req rbacRequirement) (bool, error) {
 	version := req.version
 	if version == "" {
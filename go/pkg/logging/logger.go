@@ -64,6 +64,33 @@ func NewLogger(config Config) (*Logger, error) {
 	}, nil
 }
 
+// NewNop returns a logger that discards everything, for components whose
+// caller did not supply a logger.
+func NewNop() *Logger {
+	return FromZap(zap.NewNop())
+}
+
+// FromZap wraps an existing zap logger so it can be passed to components
+// that take a *Logger. SetLevel only affects loggers created by NewLogger.
+func FromZap(logger *zap.Logger) *Logger {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Logger{
+		Logger: logger,
+		level:  zap.NewAtomicLevelAt(logger.Level()),
+	}
+}
+
+// Component returns a child logger tagged with a component field. It shares
+// the parent's level, so SetLevel on the parent applies to it.
+func (l *Logger) Component(component string) *Logger {
+	return &Logger{
+		Logger: l.WithComponent(component),
+		level:  l.level,
+	}
+}
+
 // SetLevel dynamically changes the log level
 func (l *Logger) SetLevel(level string) error {
 	zapLevel, err := zapcore.ParseLevel(level)
@@ -103,7 +130,7 @@ func (l *Logger) WithError(err error) *zap.Logger {
 func (l *Logger) LogAPIRequest(method, path, clientIP string, statusCode int, duration int64) {
 	l.Info("API request",
 		zap.String("method", method),
-		zap.String("path", path),
+		zap.String("path", RedactPath(path)),
 		zap.String("client_ip", clientIP),
 		zap.Int("status_code", statusCode),
 		zap.Int64("duration_ms", duration),
@@ -131,12 +158,12 @@ func (l *Logger) LogK8sOperation(operation, resource, namespace, name string, er
 func (l *Logger) LogTrueNASOperation(operation, endpoint string, statusCode int, err error) {
 	fields := []zap.Field{
 		zap.String("operation", operation),
-		zap.String("endpoint", endpoint),
+		zap.String("endpoint", RedactURL(endpoint)),
 		zap.Int("status_code", statusCode),
 	}
 
 	if err != nil {
-		fields = append(fields, zap.Error(err))
+		fields = append(fields, RedactedError(err))
 		l.Error("TrueNAS operation failed", fields...)
 	} else {
 		l.Debug("TrueNAS operation completed", fields...)
@@ -145,6 +145,26 @@ func TestLoggerLevelControl(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestComponentLoggerFollowsParentLevel(t *testing.T) {
+	logger, err := NewLogger(Config{Level: "warn"})
+	require.NoError(t, err)
+
+	component := logger.Component("k8s")
+	assert.False(t, component.Core().Enabled(zap.DebugLevel))
+
+	require.NoError(t, logger.SetLevel("debug"))
+	assert.True(t, component.Core().Enabled(zap.DebugLevel))
+	assert.Equal(t, "debug", component.GetLevel())
+}
+
+func TestNopAndFromZap(t *testing.T) {
+	assert.False(t, NewNop().Core().Enabled(zap.ErrorLevel))
+	assert.NotNil(t, FromZap(nil).Logger)
+
+	wrapped := FromZap(zap.NewExample())
+	assert.Equal(t, "debug", wrapped.GetLevel())
+}
+
 func TestConfigValidation(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Redacted replaces sensitive values in log output.
+const Redacted = "REDACTED"
+
+// sensitiveParams are query parameter names whose values are never logged.
+// Matching is case-insensitive and ignores "-" and "_" separators.
+var sensitiveParams = map[string]bool{
+	"apikey":        true,
+	"key":           true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"idtoken":       true,
+	"auth":          true,
+	"authorization": true,
+	"password":      true,
+	"passwd":        true,
+	"pass":          true,
+	"secret":        true,
+	"clientsecret":  true,
+	"signature":     true,
+	"sig":           true,
+	"session":       true,
+	"sessionid":     true,
+	"credential":    true,
+	"credentials":   true,
+}
+
+// sensitiveHeaders are HTTP header names whose values are never logged.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"X-Auth-Token":        true,
+}
+
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// IsSensitiveParam reports whether a query parameter name carries a secret.
+func IsSensitiveParam(name string) bool {
+	normalized := strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	return sensitiveParams[normalized]
+}
+
+// IsSensitiveHeader reports whether an HTTP header carries a secret.
+func IsSensitiveHeader(name string) bool {
+	return sensitiveHeaders[http.CanonicalHeaderKey(name)]
+}
+
+// RedactQuery masks the values of sensitive parameters in a raw query string.
+// Parameter order and non-sensitive values are preserved.
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		name, _, hasValue := strings.Cut(part, "=")
+		decoded, err := url.QueryUnescape(name)
+		if err != nil {
+			decoded = name
+		}
+		if hasValue && IsSensitiveParam(decoded) {
+			parts[i] = name + "=" + Redacted
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// RedactPath masks sensitive query parameters in a request path such as
+// "/api/v1/orphans?api_key=...".
+func RedactPath(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	return base + "?" + RedactQuery(rawQuery)
+}
+
+// RedactURL masks embedded passwords and sensitive query parameters in a URL.
+// Strings that do not parse as URLs are redacted as paths.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return RedactPath(raw)
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+		}
+	}
+	u.RawQuery = RedactQuery(u.RawQuery)
+	return u.String()
+}
+
+// RedactHeaders returns a copy of headers with sensitive values masked.
+func RedactHeaders(headers http.Header) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		if IsSensitiveHeader(name) {
+			redacted[name] = []string{Redacted}
+			continue
+		}
+		redacted[name] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// RedactText masks secrets in URLs embedded in free text, such as transport
+// error messages that quote the request URL.
+func RedactText(text string) string {
+	return urlPattern.ReplaceAllStringFunc(text, RedactURL)
+}
+
+// RedactedError returns an "error" field whose message has embedded URLs
+// redacted. Use it instead of zap.Error for errors from HTTP clients.
+func RedactedError(err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+	return zap.String("error", RedactText(err.Error()))
+}
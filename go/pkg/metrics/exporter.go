@@ -3,7 +3,10 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
@@ -15,9 +18,13 @@ import (
 // Exporter handles Prometheus metrics export
 type Exporter struct {
 	server   *http.Server
+	mux      *http.ServeMux
 	registry *prometheus.Registry
 	logger   *zap.Logger
 
+	// mu is held for writing by Update and for reading by scrapes.
+	mu sync.RWMutex
+
 	// Metrics
 	orphanedPVsCount       prometheus.Gauge
 	orphanedPVCsCount      prometheus.Gauge
@@ -28,19 +35,132 @@ type Exporter struct {
 	totalPVs               prometheus.Gauge
 	totalPVCs              prometheus.Gauge
 	totalSnapshots         prometheus.Gauge
+	snapshotsBySource      *prometheus.GaugeVec
+	orphanedBySource       *prometheus.GaugeVec
 	storageEfficiency      prometheus.Gauge
+	storageEfficiencyCov   prometheus.Gauge
 	lastScanTimestamp      prometheus.Gauge
+	scanLoopHealthy        prometheus.Gauge
+	scanPanics             prometheus.Counter
+	scanLoopRestarts       prometheus.Counter
+	csiDriverInfo          *seriesSet
+	scheduleCompliant      *seriesSet
+	backupCoverage         *seriesSet
+	duplicateHandles       prometheus.Gauge
+	unparseableHandles     prometheus.Gauge
+	abandonedReclaimable   prometheus.Gauge
+	multiAttachedPVs       prometheus.Gauge
+	staleAttachments       prometheus.Gauge
+	inventory              *prometheus.GaugeVec
+	inventoryDrift         prometheus.Gauge
+	backendRequests        *seriesSet
+	snapshotCacheSize      prometheus.Gauge
+	snapshotCacheAge       prometheus.Gauge
+	activeAlerts           *seriesSet
+	alertDestinationHealth *seriesSet
+	backendDegraded        prometheus.Histogram
+	apiRequestTimeouts     *prometheus.CounterVec
+	apiRequests            *prometheus.CounterVec
+	apiRequestDuration     *prometheus.HistogramVec
+	apiPanics              prometheus.Counter
+	parseAnomalies         *prometheus.CounterVec
+	truenasReauths         *prometheus.CounterVec
+	pvPhaseTransitions     *prometheus.CounterVec
+	k8sWrites              *prometheus.CounterVec
+	cleanupJobsPruned      prometheus.Counter
+	artifactsBytes         prometheus.Gauge
+	artifactsPruned        prometheus.Counter
+	volumeReadBytesRate    *seriesSet
+	volumeWriteBytesRate   *seriesSet
+	snapshotsByAge         *seriesSet
+	poolSize               *seriesSet
+	poolUsed               *seriesSet
+	poolUtilization        *seriesSet
+	storageClassVolumes    *seriesSet
+	storageClassCapacity   *seriesSet
+	storageClassUsed       *seriesSet
+	storageClassOrphans    *seriesSet
+	storageClassWasted     *seriesSet
+	provisioningDuration   *prometheus.HistogramVec
+	restoreCanarySuccess   prometheus.Gauge
+	restoreCanaryDuration  *prometheus.HistogramVec
+}
+
+// ActiveAlertCount is the number of active alerts with one level and state
+type ActiveAlertCount struct {
+	Level string
+	State string
+	Count int
+}
+
+// VolumeIORate is the average throughput of one dataset backing a PV
+type VolumeIORate struct {
+	Dataset          string
+	PersistentVolume string
+	ReadBytesRate    float64
+	WriteBytesRate   float64
+}
+
+// InventoryCounts are the democratic-csi PVs and managed TrueNAS volumes
+// of a scan and the unmatched ones on each side
+type InventoryCounts struct {
+	K8sManagedPVs         float64
+	TrueNASManagedVolumes float64
+	UnmatchedK8s          float64
+	UnmatchedTrueNAS      float64
+	DriftPercent          float64
+}
+
+// PoolUsage is the capacity and usage of one TrueNAS pool
+type PoolUsage struct {
+	Pool               string
+	SizeBytes          int64
+	UsedBytes          int64
+	UtilizationPercent float64
+}
+
+// StorageClassUsage is the democratic-csi PVs of one StorageClass and the
+// orphans attributed to it
+type StorageClassUsage struct {
+	StorageClass     string
+	Volumes          int
+	ProvisionedBytes int64
+	UsedBytes        int64
+	Orphans          int
+	WastedBytes      int64
+}
+
+// CSIDriverInfo describes the democratic-csi version running in one CSI pod
+type CSIDriverInfo struct {
+	Pod     string
+	Node    string
+	Role    string
+	Version string
 }
 
 var scanDurationBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60, 120}
 
+var backendDegradedBuckets = []float64{30, 60, 120, 300, 600, 1800, 3600}
+
 var listDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30}
 
+var apiRequestDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+var restoreCanaryDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60, 120}
+
+var provisioningDurationBuckets = []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600}
+
 // Config holds metrics exporter configuration
 type Config struct {
 	Enabled bool
+	// Address is the interface the HTTP server listens on; empty listens
+	// on all of them.
+	Address string
 	Port    int
 	Path    string
+	// Logger receives metrics server logs tagged component=metrics. Nil
+	// discards them.
+	Logger *zap.Logger
 }
 
 // NewExporter creates a new metrics exporter
@@ -76,7 +196,7 @@ func NewExporter(config Config) *Exporter {
 
 	listDurationHist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "truenas_monitor_list_duration_seconds",
-		Help:    "Duration of inventory list operations during orphan detection",
+		Help:    "Duration of monitoring scan phases: inventory lists, correlation and checks",
 		Buckets: listDurationBuckets,
 	}, []string{"phase"})
 
@@ -95,9 +215,24 @@ func NewExporter(config Config) *Exporter {
 		Help: "Total number of volume snapshots",
 	})
 
+	snapshotsBySource := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_monitor_snapshots_by_source_total",
+		Help: "Number of snapshots by source (kubernetes or truenas)",
+	}, []string{"source"})
+
+	orphanedBySource := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_monitor_orphaned_snapshots_by_source_total",
+		Help: "Number of orphaned snapshots by source (kubernetes or truenas)",
+	}, []string{"source"})
+
 	storageEfficiency := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "truenas_monitor_storage_efficiency_percent",
-		Help: "Storage efficiency percentage from thin provisioning",
+		Help: "Used bytes of the TrueNAS datasets backing PVs divided by the requested capacity of those PVs, times 100; PVs without a correlated dataset or requested capacity are excluded",
+	})
+
+	storageEfficiencyCoverage := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_storage_efficiency_coverage_percent",
+		Help: "Percent of PVs included in truenas_monitor_storage_efficiency_percent",
 	})
 
 	lastScanTimestamp := prometheus.NewGauge(prometheus.GaugeOpts{
@@ -105,6 +240,230 @@ func NewExporter(config Config) *Exporter {
 		Help: "Timestamp of the last successful scan",
 	})
 
+	scanLoopHealthy := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_scan_loop_healthy",
+		Help: "1 while the scan loop heartbeat is younger than twice the scan interval, 0 otherwise",
+	})
+
+	scanPanics := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "truenas_monitor_scan_panics_total",
+		Help: "Number of scans that panicked and were recovered",
+	})
+
+	scanLoopRestarts := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "truenas_monitor_scan_loop_restarts_total",
+		Help: "Number of scan loop restarts requested through the admin endpoint",
+	})
+
+	csiDriverInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_csi_driver_info",
+		Help: "democratic-csi driver version per CSI pod (always 1)",
+	}, []string{"pod", "node", "role", "version"})
+
+	scheduleCompliant := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_snapshot_schedule_compliant",
+		Help: "Whether all datasets of a storage class meet the snapshot schedule (1) or not (0)",
+	}, []string{"storage_class"})
+
+	backupCoverage := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_backup_coverage_percent",
+		Help: "Percentage of the PVCs a backup coverage policy selects that have a recent ready VolumeSnapshot, by namespace",
+	}, []string{"namespace"})
+
+	duplicateHandles := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_duplicate_volume_handles",
+		Help: "Number of volume handles referenced by more than one persistent volume",
+	})
+
+	unparseableHandles := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_unparseable_volume_handles",
+		Help: "Number of persistent volumes whose volume handle names no dataset, so their correlation is unknown",
+	})
+
+	abandonedReclaimable := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_abandoned_dataset_reclaimable_bytes",
+		Help: "Bytes reclaimable by deleting the unblocked abandoned datasets, which have no PV and are held by old snapshots",
+	})
+
+	multiAttachedPVs := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_multi_attached_pvs",
+		Help: "Number of persistent volumes with more than one VolumeAttachment",
+	})
+
+	staleAttachments := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_stale_volume_attachments",
+		Help: "Number of VolumeAttachments to nodes that are NotReady or no longer exist",
+	})
+
+	inventory := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_monitor_inventory",
+		Help: "Democratic-csi PVs and managed TrueNAS volumes, and the unmatched ones on each side",
+	}, []string{"kind"})
+
+	inventoryDrift := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_inventory_drift_percent",
+		Help: "Unmatched PVs and volumes as a percentage of the larger inventory",
+	})
+
+	backendRequests := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_monitor_backend_requests_per_scan",
+		Help: "Requests the last monitoring scan sent to each backend, retries and list pages included",
+	}, []string{"backend"})
+
+	snapshotCacheSize := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_snapshot_cache_size",
+		Help: "Number of TrueNAS snapshots held in the incremental listing cache",
+	})
+
+	snapshotCacheAge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_snapshot_cache_refresh_age_seconds",
+		Help: "Seconds since the incremental snapshot cache was last fully re-listed",
+	})
+
+	activeAlerts := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_active_alerts_total",
+		Help: "Number of active alerts by level and state",
+	}, []string{"level", "state"})
+
+	alertDestinationHealth := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_alert_destination_healthy",
+		Help: "Whether the last test notification to an alert destination was delivered (1) or not (0)",
+	}, []string{"destination"})
+
+	backendDegraded := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "truenas_backend_degraded_seconds",
+		Help:    "Duration of periods in which TrueNAS was temporarily unavailable (maintenance or HA failover)",
+		Buckets: backendDegradedBuckets,
+	})
+
+	apiRequestTimeouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "truenas_api_request_timeouts_total",
+		Help: "Number of API requests that exceeded their route budget, by route",
+	}, []string{"route"})
+
+	apiRequests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "truenas_api_requests_total",
+		Help: "Number of API requests by route template, method and status code",
+	}, []string{"route", "method", "status"})
+
+	apiRequestDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "truenas_api_request_duration_seconds",
+		Help:    "API request latency by route template",
+		Buckets: apiRequestDurationBuckets,
+	}, []string{"route"})
+
+	apiPanics := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "truenas_api_panics_total",
+		Help: "Number of API handler panics recovered by the API server",
+	})
+
+	parseAnomalies := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "truenas_api_parse_anomalies_total",
+		Help: "Number of TrueNAS response items missing an expected field, by endpoint",
+	}, []string{"endpoint"})
+
+	truenasReauths := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "truenas_api_reauth_total",
+		Help: "TrueNAS requests answered 401 by re-authentication result (succeeded, failed, backoff)",
+	}, []string{"result"})
+
+	pvPhaseTransitions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "truenas_pv_phase_transitions_total",
+		Help: "PersistentVolume phase changes seen between consecutive scans, by previous and new phase",
+	}, []string{"from", "to"})
+
+	k8sWrites := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "truenas_k8s_writes_total",
+		Help: "Kubernetes Event writes by result (performed, deduplicated, failed, dropped)",
+	}, []string{"result"})
+
+	cleanupJobsPruned := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "truenas_cleanup_jobs_pruned_total",
+		Help: "Number of finished cleanup job records pruned by retention",
+	})
+
+	artifactsBytes := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_monitor_artifacts_bytes",
+		Help: "Total size in bytes of the stored report artifacts",
+	})
+
+	artifactsPruned := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "truenas_monitor_artifacts_pruned_total",
+		Help: "Number of report artifacts pruned by retention age or size cap",
+	})
+
+	volumeReadBytesRate := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_volume_read_bytes_rate",
+		Help: "Average read throughput in bytes/s of the busiest datasets backing PVs",
+	}, []string{"dataset", "persistent_volume"})
+
+	volumeWriteBytesRate := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_volume_write_bytes_rate",
+		Help: "Average write throughput in bytes/s of the busiest datasets backing PVs",
+	}, []string{"dataset", "persistent_volume"})
+
+	snapshotsByAge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_snapshots_by_age",
+		Help: "Number of TrueNAS snapshots by age bucket (upper bound, older or unknown)",
+	}, []string{"bucket"})
+
+	poolSize := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_pool_size_bytes",
+		Help: "Size of a TrueNAS pool in bytes",
+	}, []string{"pool"})
+
+	poolUsed := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_pool_used_bytes",
+		Help: "Bytes used in a TrueNAS pool",
+	}, []string{"pool"})
+
+	poolUtilization := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_pool_utilization_percent",
+		Help: "Percentage of a TrueNAS pool in use",
+	}, []string{"pool"})
+
+	storageClassVolumes := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_class_volumes",
+		Help: "Number of democratic-csi PVs of a StorageClass",
+	}, []string{"storage_class"})
+
+	storageClassCapacity := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_class_provisioned_bytes",
+		Help: "Capacity requested by the democratic-csi PVs of a StorageClass",
+	}, []string{"storage_class"})
+
+	storageClassUsed := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_class_used_bytes",
+		Help: "TrueNAS bytes used by the datasets of a StorageClass's PVs",
+	}, []string{"storage_class"})
+
+	storageClassOrphans := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_class_orphans",
+		Help: "Number of orphaned PVs, PVCs, TrueNAS volumes and snapshots attributed to a StorageClass",
+	}, []string{"storage_class"})
+
+	storageClassWasted := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "truenas_storage_class_wasted_bytes",
+		Help: "TrueNAS bytes used by the orphaned volumes and snapshots attributed to a StorageClass",
+	}, []string{"storage_class"})
+
+	provisioningDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "truenas_pvc_provisioning_duration_seconds",
+		Help:    "Time from PVC creation (or first pod creation for WaitForFirstConsumer) until the PVC was bound",
+		Buckets: provisioningDurationBuckets,
+	}, []string{"storage_class"})
+
+	restoreCanarySuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "truenas_restore_canary_success",
+		Help: "1 if the last restore canary run succeeded, 0 if it failed",
+	})
+
+	restoreCanaryDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "truenas_restore_canary_duration_seconds",
+		Help:    "Duration of restore canary steps, and of whole runs as step=total",
+		Buckets: restoreCanaryDurationBuckets,
+	}, []string{"step"})
+
 	// Register metrics
 	registry.MustRegister(
 		orphanedPVsCount,
@@ -116,29 +475,63 @@ func NewExporter(config Config) *Exporter {
 		totalPVs,
 		totalPVCs,
 		totalSnapshots,
+		snapshotsBySource,
+		orphanedBySource,
 		storageEfficiency,
+		storageEfficiencyCoverage,
 		lastScanTimestamp,
+		scanLoopHealthy,
+		scanPanics,
+		scanLoopRestarts,
+		csiDriverInfo,
+		scheduleCompliant,
+		backupCoverage,
+		duplicateHandles,
+		unparseableHandles,
+		abandonedReclaimable,
+		multiAttachedPVs,
+		staleAttachments,
+		inventory,
+		inventoryDrift,
+		backendRequests,
+		snapshotCacheSize,
+		snapshotCacheAge,
+		activeAlerts,
+		alertDestinationHealth,
+		backendDegraded,
+		apiRequestTimeouts,
+		apiRequests,
+		apiRequestDuration,
+		apiPanics,
+		parseAnomalies,
+		truenasReauths,
+		pvPhaseTransitions,
+		k8sWrites,
+		cleanupJobsPruned,
+		artifactsBytes,
+		artifactsPruned,
+		volumeReadBytesRate,
+		volumeWriteBytesRate,
+		snapshotsByAge,
+		poolSize,
+		poolUsed,
+		poolUtilization,
+		storageClassVolumes,
+		storageClassCapacity,
+		storageClassUsed,
+		storageClassOrphans,
+		storageClassWasted,
+		provisioningDuration,
+		restoreCanarySuccess,
+		restoreCanaryDuration,
 	)
 
-	// Create HTTP server
-	mux := http.NewServeMux()
-	mux.Handle(config.Path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	})
-
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", config.Port),
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	logger := zap.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger.With(zap.String("component", "metrics"))
 	}
 
-	logger, _ := zap.NewProduction()
-
-	return &Exporter{
-		server:                 server,
+	e := &Exporter{
 		registry:               registry,
 		logger:                 logger,
 		orphanedPVsCount:       orphanedPVsCount,
@@ -150,17 +543,86 @@ func NewExporter(config Config) *Exporter {
 		totalPVs:               totalPVs,
 		totalPVCs:              totalPVCs,
 		totalSnapshots:         totalSnapshots,
+		snapshotsBySource:      snapshotsBySource,
+		orphanedBySource:       orphanedBySource,
 		storageEfficiency:      storageEfficiency,
+		storageEfficiencyCov:   storageEfficiencyCoverage,
 		lastScanTimestamp:      lastScanTimestamp,
+		scanLoopHealthy:        scanLoopHealthy,
+		scanPanics:             scanPanics,
+		scanLoopRestarts:       scanLoopRestarts,
+		csiDriverInfo:          newSeriesSet(csiDriverInfo),
+		scheduleCompliant:      newSeriesSet(scheduleCompliant),
+		backupCoverage:         newSeriesSet(backupCoverage),
+		duplicateHandles:       duplicateHandles,
+		unparseableHandles:     unparseableHandles,
+		abandonedReclaimable:   abandonedReclaimable,
+		multiAttachedPVs:       multiAttachedPVs,
+		staleAttachments:       staleAttachments,
+		inventory:              inventory,
+		inventoryDrift:         inventoryDrift,
+		backendRequests:        newSeriesSet(backendRequests),
+		snapshotCacheSize:      snapshotCacheSize,
+		snapshotCacheAge:       snapshotCacheAge,
+		activeAlerts:           newSeriesSet(activeAlerts),
+		alertDestinationHealth: newSeriesSet(alertDestinationHealth),
+		backendDegraded:        backendDegraded,
+		apiRequestTimeouts:     apiRequestTimeouts,
+		apiRequests:            apiRequests,
+		apiRequestDuration:     apiRequestDuration,
+		apiPanics:              apiPanics,
+		parseAnomalies:         parseAnomalies,
+		truenasReauths:         truenasReauths,
+		pvPhaseTransitions:     pvPhaseTransitions,
+		k8sWrites:              k8sWrites,
+		cleanupJobsPruned:      cleanupJobsPruned,
+		artifactsBytes:         artifactsBytes,
+		artifactsPruned:        artifactsPruned,
+		volumeReadBytesRate:    newSeriesSet(volumeReadBytesRate),
+		volumeWriteBytesRate:   newSeriesSet(volumeWriteBytesRate),
+		snapshotsByAge:         newSeriesSet(snapshotsByAge),
+		poolSize:               newSeriesSet(poolSize),
+		poolUsed:               newSeriesSet(poolUsed),
+		poolUtilization:        newSeriesSet(poolUtilization),
+		storageClassVolumes:    newSeriesSet(storageClassVolumes),
+		storageClassCapacity:   newSeriesSet(storageClassCapacity),
+		storageClassUsed:       newSeriesSet(storageClassUsed),
+		storageClassOrphans:    newSeriesSet(storageClassOrphans),
+		storageClassWasted:     newSeriesSet(storageClassWasted),
+		provisioningDuration:   provisioningDuration,
+		restoreCanarySuccess:   restoreCanarySuccess,
+		restoreCanaryDuration:  restoreCanaryDuration,
+	}
+
+	// Create HTTP server
+	mux := http.NewServeMux()
+	e.mux = mux
+	mux.Handle(config.Path, e.Handler())
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+	})
+
+	e.server = &http.Server{
+		Addr:         net.JoinHostPort(config.Address, strconv.Itoa(config.Port)),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
 	}
+	return e
 }
 
-// Start starts the metrics HTTP server
+// Start starts the metrics HTTP server. It binds the address before
+// returning, so a port in use fails startup.
 func (e *Exporter) Start() error {
 	e.logger.Info("Starting metrics server", zap.String("addr", e.server.Addr))
 
+	listener, err := net.Listen("tcp", e.server.Addr)
+	if err != nil {
+		return fmt.Errorf("metrics server cannot listen on %s (metrics.address and metrics.port): %w", e.server.Addr, err)
+	}
 	go func() {
-		if err := e.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := e.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			e.logger.Error("Metrics server error", zap.Error(err))
 		}
 	}()
@@ -178,6 +640,20 @@ func (e *Exporter) Stop() error {
 	return e.server.Shutdown(ctx)
 }
 
+// Handle registers an extra handler on the metrics HTTP server, such as the
+// monitor's readiness probe. It must be called before Start.
+func (e *Exporter) Handle(pattern string, handler http.Handler) {
+	e.mux.Handle(pattern, handler)
+}
+
+// Update runs apply while holding off scrapes, so the metrics it writes are
+// exported together or not at all. apply must not call Update.
+func (e *Exporter) Update(apply func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	apply()
+}
+
 // SetOrphanedPVsCount sets the orphaned PVs count metric
 func (e *Exporter) SetOrphanedPVsCount(count float64) {
 	e.orphanedPVsCount.Set(count)
@@ -203,11 +679,17 @@ func (e *Exporter) ObserveScanDuration(duration float64) {
 	e.scanDurationHist.Observe(duration)
 }
 
-// ObserveListPhaseDuration records a list operation duration for a detection phase
+// ObserveListPhaseDuration records the duration of a monitoring scan phase
 func (e *Exporter) ObserveListPhaseDuration(phase string, duration float64) {
 	e.listDurationHist.WithLabelValues(phase).Observe(duration)
 }
 
+// ObserveProvisioningDuration records how long a PVC of a storage class
+// took to be provisioned and bound
+func (e *Exporter) ObserveProvisioningDuration(storageClass string, seconds float64) {
+	e.provisioningDuration.WithLabelValues(storageClass).Observe(seconds)
+}
+
 // SetTotalPVs sets the total PVs metric
 func (e *Exporter) SetTotalPVs(count float64) {
 	e.totalPVs.Set(count)
@@ -223,9 +705,55 @@ func (e *Exporter) SetTotalSnapshots(count float64) {
 	e.totalSnapshots.Set(count)
 }
 
-// SetStorageEfficiency sets the storage efficiency metric
-func (e *Exporter) SetStorageEfficiency(efficiency float64) {
+// SetSnapshotCounts sets snapshot totals and orphan counts for each source
+func (e *Exporter) SetSnapshotCounts(totalK8s, totalTrueNAS, orphanedK8s, orphanedTrueNAS float64) {
+	e.snapshotsBySource.WithLabelValues("kubernetes").Set(totalK8s)
+	e.snapshotsBySource.WithLabelValues("truenas").Set(totalTrueNAS)
+	e.orphanedBySource.WithLabelValues("kubernetes").Set(orphanedK8s)
+	e.orphanedBySource.WithLabelValues("truenas").Set(orphanedTrueNAS)
+}
+
+// SetDuplicateVolumeHandles sets the number of volume handles shared by several PVs
+func (e *Exporter) SetDuplicateVolumeHandles(count float64) {
+	e.duplicateHandles.Set(count)
+}
+
+// SetUnparseableVolumeHandles sets the number of PVs whose volume handle does not parse
+func (e *Exporter) SetUnparseableVolumeHandles(count float64) {
+	e.unparseableHandles.Set(count)
+}
+
+// SetAbandonedDatasetReclaimableBytes sets the bytes reclaimable by deleting abandoned datasets
+func (e *Exporter) SetAbandonedDatasetReclaimableBytes(bytes float64) {
+	e.abandonedReclaimable.Set(bytes)
+}
+
+// SetVolumeAttachmentProblems sets the numbers of multi-attached PVs and stale VolumeAttachments
+func (e *Exporter) SetVolumeAttachmentProblems(multiAttached, stale float64) {
+	e.multiAttachedPVs.Set(multiAttached)
+	e.staleAttachments.Set(stale)
+}
+
+// SetInventoryCounts sets the inventory gauges of a scan
+func (e *Exporter) SetInventoryCounts(counts InventoryCounts) {
+	e.inventory.WithLabelValues("k8s_managed_pvs").Set(counts.K8sManagedPVs)
+	e.inventory.WithLabelValues("truenas_managed_volumes").Set(counts.TrueNASManagedVolumes)
+	e.inventory.WithLabelValues("unmatched_k8s").Set(counts.UnmatchedK8s)
+	e.inventory.WithLabelValues("unmatched_truenas").Set(counts.UnmatchedTrueNAS)
+	e.inventoryDrift.Set(counts.DriftPercent)
+}
+
+// SetSnapshotCacheStats sets the incremental snapshot cache size and refresh age
+func (e *Exporter) SetSnapshotCacheStats(size float64, refreshAge time.Duration) {
+	e.snapshotCacheSize.Set(size)
+	e.snapshotCacheAge.Set(refreshAge.Seconds())
+}
+
+// SetStorageEfficiency sets the storage efficiency and the percent of PVs
+// it covers
+func (e *Exporter) SetStorageEfficiency(efficiency, coverage float64) {
 	e.storageEfficiency.Set(efficiency)
+	e.storageEfficiencyCov.Set(coverage)
 }
 
 // SetLastScanTimestamp sets the last scan timestamp metric
@@ -233,7 +761,243 @@ func (e *Exporter) SetLastScanTimestamp(timestamp time.Time) {
 	e.lastScanTimestamp.Set(float64(timestamp.Unix()))
 }
 
+// ObserveRestoreCanary records a restore canary run: whether it succeeded,
+// its total duration and the duration of each step, in seconds
+func (e *Exporter) ObserveRestoreCanary(success bool, totalSeconds float64, stepSeconds map[string]float64) {
+	value := 0.0
+	if success {
+		value = 1
+	}
+	e.restoreCanarySuccess.Set(value)
+	e.restoreCanaryDuration.WithLabelValues("total").Observe(totalSeconds)
+	for step, seconds := range stepSeconds {
+		e.restoreCanaryDuration.WithLabelValues(step).Observe(seconds)
+	}
+}
+
+// SetScanLoopHealthy sets the scan loop watchdog gauge
+func (e *Exporter) SetScanLoopHealthy(healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	e.scanLoopHealthy.Set(value)
+}
+
+// IncScanPanic counts a recovered scan panic
+func (e *Exporter) IncScanPanic() {
+	e.scanPanics.Inc()
+}
+
+// IncScanLoopRestart counts a scan loop restart
+func (e *Exporter) IncScanLoopRestart() {
+	e.scanLoopRestarts.Inc()
+}
+
+// SetCSIDriverInfo replaces the CSI driver info series with the given pods
+func (e *Exporter) SetCSIDriverInfo(infos []CSIDriverInfo) {
+	values := make([]labeledValue, 0, len(infos))
+	for _, info := range infos {
+		values = append(values, labeledValue{labels: []string{info.Pod, info.Node, info.Role, info.Version}, value: 1})
+	}
+	e.csiDriverInfo.replace(values)
+}
+
+// SetSnapshotScheduleCompliance replaces the per-class schedule compliance series
+func (e *Exporter) SetSnapshotScheduleCompliance(compliance map[string]bool) {
+	values := make([]labeledValue, 0, len(compliance))
+	for storageClass, compliant := range compliance {
+		value := 0.0
+		if compliant {
+			value = 1
+		}
+		values = append(values, labeledValue{labels: []string{storageClass}, value: value})
+	}
+	e.scheduleCompliant.replace(values)
+}
+
+// SetBackupCoverage replaces the per-namespace backup coverage series
+func (e *Exporter) SetBackupCoverage(percentByNamespace map[string]float64) {
+	values := make([]labeledValue, 0, len(percentByNamespace))
+	for namespace, percent := range percentByNamespace {
+		values = append(values, labeledValue{labels: []string{namespace}, value: percent})
+	}
+	e.backupCoverage.replace(values)
+}
+
+// SetVolumeIORates replaces the volume throughput series with the given
+// datasets. Callers pass only the busiest datasets to bound cardinality.
+func (e *Exporter) SetVolumeIORates(rates []VolumeIORate) {
+	reads := make([]labeledValue, 0, len(rates))
+	writes := make([]labeledValue, 0, len(rates))
+	for _, rate := range rates {
+		labels := []string{rate.Dataset, rate.PersistentVolume}
+		reads = append(reads, labeledValue{labels: labels, value: rate.ReadBytesRate})
+		writes = append(writes, labeledValue{labels: labels, value: rate.WriteBytesRate})
+	}
+	e.volumeReadBytesRate.replace(reads)
+	e.volumeWriteBytesRate.replace(writes)
+}
+
+// SetBackendRequestsPerScan replaces the per-backend request counts of the
+// last scan
+func (e *Exporter) SetBackendRequestsPerScan(counts map[string]int64) {
+	values := make([]labeledValue, 0, len(counts))
+	for backend, count := range counts {
+		values = append(values, labeledValue{labels: []string{backend}, value: float64(count)})
+	}
+	e.backendRequests.replace(values)
+}
+
+// SetSnapshotAges replaces the snapshot age series with the given bucket counts
+func (e *Exporter) SetSnapshotAges(counts map[string]int) {
+	values := make([]labeledValue, 0, len(counts))
+	for bucket, count := range counts {
+		values = append(values, labeledValue{labels: []string{bucket}, value: float64(count)})
+	}
+	e.snapshotsByAge.replace(values)
+}
+
+// SetPoolUsage replaces the TrueNAS pool series with the given pools; pools
+// that were destroyed or renamed stop being exported. A pool without a size
+// exports no utilization series rather than NaN
+func (e *Exporter) SetPoolUsage(pools []PoolUsage) {
+	sizes := make([]labeledValue, 0, len(pools))
+	used := make([]labeledValue, 0, len(pools))
+	utilization := make([]labeledValue, 0, len(pools))
+	for _, pool := range pools {
+		labels := []string{pool.Pool}
+		sizes = append(sizes, labeledValue{labels: labels, value: float64(pool.SizeBytes)})
+		used = append(used, labeledValue{labels: labels, value: float64(pool.UsedBytes)})
+		if pool.SizeBytes > 0 {
+			utilization = append(utilization, labeledValue{labels: labels, value: pool.UtilizationPercent})
+		}
+	}
+	e.poolSize.replace(sizes)
+	e.poolUsed.replace(used)
+	e.poolUtilization.replace(utilization)
+}
+
+// SetStorageClassUsage replaces the per-StorageClass series with classes
+func (e *Exporter) SetStorageClassUsage(classes []StorageClassUsage) {
+	volumes := make([]labeledValue, len(classes))
+	provisioned := make([]labeledValue, len(classes))
+	used := make([]labeledValue, len(classes))
+	orphans := make([]labeledValue, len(classes))
+	wasted := make([]labeledValue, len(classes))
+	for i, class := range classes {
+		labels := []string{class.StorageClass}
+		volumes[i] = labeledValue{labels: labels, value: float64(class.Volumes)}
+		provisioned[i] = labeledValue{labels: labels, value: float64(class.ProvisionedBytes)}
+		used[i] = labeledValue{labels: labels, value: float64(class.UsedBytes)}
+		orphans[i] = labeledValue{labels: labels, value: float64(class.Orphans)}
+		wasted[i] = labeledValue{labels: labels, value: float64(class.WastedBytes)}
+	}
+	e.storageClassVolumes.replace(volumes)
+	e.storageClassCapacity.replace(provisioned)
+	e.storageClassUsed.replace(used)
+	e.storageClassOrphans.replace(orphans)
+	e.storageClassWasted.replace(wasted)
+}
+
+// SetActiveAlerts replaces the active alert series with the given counts
+func (e *Exporter) SetActiveAlerts(counts []ActiveAlertCount) {
+	values := make([]labeledValue, 0, len(counts))
+	for _, count := range counts {
+		values = append(values, labeledValue{labels: []string{count.Level, count.State}, value: float64(count.Count)})
+	}
+	e.activeAlerts.replace(values)
+}
+
+// SetAlertDestinationHealth replaces the alert destination health series
+// with the result of the last destination test, keyed by destination name
+func (e *Exporter) SetAlertDestinationHealth(health map[string]bool) {
+	values := make([]labeledValue, 0, len(health))
+	for destination, healthy := range health {
+		value := 0.0
+		if healthy {
+			value = 1
+		}
+		values = append(values, labeledValue{labels: []string{destination}, value: value})
+	}
+	e.alertDestinationHealth.replace(values)
+}
+
+// ObserveBackendDegraded records how long TrueNAS was unavailable
+func (e *Exporter) ObserveBackendDegraded(seconds float64) {
+	e.backendDegraded.Observe(seconds)
+}
+
+// IncAPIRequestTimeout counts an API request that exceeded its route budget
+func (e *Exporter) IncAPIRequestTimeout(route string) {
+	e.apiRequestTimeouts.WithLabelValues(route).Inc()
+}
+
+// ObserveAPIRequest counts a finished API request and records its latency.
+// route is the route template, never the raw path, so label cardinality
+// stays bounded by the number of routes.
+func (e *Exporter) ObserveAPIRequest(route, method string, status int, seconds float64) {
+	e.apiRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	e.apiRequestDuration.WithLabelValues(route).Observe(seconds)
+}
+
+// IncAPIPanic counts an API handler panic
+func (e *Exporter) IncAPIPanic() {
+	e.apiPanics.Inc()
+}
+
+// IncParseAnomaly counts a TrueNAS response item missing an expected field;
+// it is the truenas.Config OnParseAnomaly hook
+func (e *Exporter) IncParseAnomaly(endpoint string) {
+	e.parseAnomalies.WithLabelValues(endpoint).Inc()
+}
+
+// IncTrueNASReauth counts a TrueNAS 401 by re-authentication result; it
+// is the truenas.Config OnReauth hook
+func (e *Exporter) IncTrueNASReauth(result string) {
+	e.truenasReauths.WithLabelValues(result).Inc()
+}
+
+// IncPVPhaseTransition counts a PV phase change between two scans
+func (e *Exporter) IncPVPhaseTransition(from, to string) {
+	e.pvPhaseTransitions.WithLabelValues(from, to).Inc()
+}
+
+// AddK8sWrites counts n Kubernetes writes with result performed,
+// deduplicated, failed or dropped
+func (e *Exporter) AddK8sWrites(result string, n int) {
+	e.k8sWrites.WithLabelValues(result).Add(float64(n))
+}
+
+// AddCleanupJobsPruned counts n pruned cleanup job records; it is the
+// cleanup.Config OnJobsPruned hook
+func (e *Exporter) AddCleanupJobsPruned(n int) {
+	e.cleanupJobsPruned.Add(float64(n))
+}
+
+// SetArtifactsBytes sets the total size of the report artifacts; it is the
+// artifacts.Config OnBytes hook
+func (e *Exporter) SetArtifactsBytes(bytes int64) {
+	e.artifactsBytes.Set(float64(bytes))
+}
+
+// AddArtifactsPruned counts n pruned report artifacts; it is the
+// artifacts.Config OnPruned hook
+func (e *Exporter) AddArtifactsPruned(n int) {
+	e.artifactsPruned.Add(float64(n))
+}
+
+// Handler serves the registered metrics, for servers that expose them on
+// their own listener instead of calling Start
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.gatherer(), promhttp.HandlerOpts{})
+}
+
 // GatherForTest exposes registered metrics for unit tests.
 func (e *Exporter) GatherForTest() ([]*dto.MetricFamily, error) {
-	return e.registry.Gather()
+	return e.gatherer().Gather()
+}
+
+func (e *Exporter) gatherer() prometheus.Gatherer {
+	return lockedGatherer{mu: &e.mu, gatherer: e.registry}
 }
\ No newline at end of file
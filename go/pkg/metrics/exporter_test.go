@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -51,3 +52,303 @@ func TestExporter_ObserveListPhaseDuration(t *testing.T) {
 	}
 	require.True(t, found, "list phase histogram sample not found")
 }
+
+func TestExporter_SetCSIDriverInfoReplacesSeries(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetCSIDriverInfo([]CSIDriverInfo{
+		{Pod: "csi-controller-0", Role: "controller", Version: "v1.8.3"},
+		{Pod: "csi-node-a", Node: "worker-a", Role: "node", Version: "v1.8.3"},
+	})
+	exporter.SetCSIDriverInfo([]CSIDriverInfo{
+		{Pod: "csi-node-a", Node: "worker-a", Role: "node", Version: "v1.9.0"},
+	})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	var series int
+	for _, family := range families {
+		if family.GetName() != "truenas_csi_driver_info" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			series++
+			require.Equal(t, 1.0, metric.GetGauge().GetValue())
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "version" {
+					require.Equal(t, "v1.9.0", label.GetValue())
+				}
+			}
+		}
+	}
+	require.Equal(t, 1, series, "stale CSI driver info series should be dropped")
+}
+
+func TestExporter_SetSnapshotCountsBySource(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetSnapshotCounts(4, 10, 1, 2)
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		name := family.GetName()
+		if name != "truenas_monitor_snapshots_by_source_total" &&
+			name != "truenas_monitor_orphaned_snapshots_by_source_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values[name+"/"+metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, 4.0, values["truenas_monitor_snapshots_by_source_total/kubernetes"])
+	require.Equal(t, 10.0, values["truenas_monitor_snapshots_by_source_total/truenas"])
+	require.Equal(t, 1.0, values["truenas_monitor_orphaned_snapshots_by_source_total/kubernetes"])
+	require.Equal(t, 2.0, values["truenas_monitor_orphaned_snapshots_by_source_total/truenas"])
+}
+
+func TestExporter_SetSnapshotScheduleCompliance(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetSnapshotScheduleCompliance(map[string]bool{"prod": true, "removed": true})
+	exporter.SetSnapshotScheduleCompliance(map[string]bool{"prod": false, "dev": true})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_snapshot_schedule_compliant" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{"prod": 0, "dev": 1}, values)
+}
+
+func TestExporter_SetBackupCoverage(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetBackupCoverage(map[string]float64{"prod": 100, "removed": 50})
+	exporter.SetBackupCoverage(map[string]float64{"prod": 75, "staging": 0})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_backup_coverage_percent" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{"prod": 75, "staging": 0}, values)
+}
+
+func TestExporter_SetSnapshotAges(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetSnapshotAges(map[string]int{"1d": 5, "12h0m0s": 1})
+	exporter.SetSnapshotAges(map[string]int{"1d": 3, "7d": 0, "older": 2})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_snapshots_by_age" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{"1d": 3, "7d": 0, "older": 2}, values)
+}
+
+func TestExporter_SetActiveAlerts(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetActiveAlerts([]ActiveAlertCount{{Level: "info", State: "firing", Count: 4}})
+	exporter.SetActiveAlerts([]ActiveAlertCount{
+		{Level: "critical", State: "firing", Count: 2},
+		{Level: "warning", State: "acknowledged", Count: 1},
+	})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_active_alerts_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			values[labels["level"]+"/"+labels["state"]] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{"critical/firing": 2, "warning/acknowledged": 1}, values)
+}
+
+func TestExporter_SetVolumeIORatesReplacesSeries(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetVolumeIORates([]VolumeIORate{{Dataset: "tank/k8s/pvc-old", PersistentVolume: "pvc-old", ReadBytesRate: 1}})
+	exporter.SetVolumeIORates([]VolumeIORate{
+		{Dataset: "tank/k8s/pvc-a", PersistentVolume: "pvc-a", ReadBytesRate: 4096, WriteBytesRate: 1024},
+	})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_volume_read_bytes_rate" && family.GetName() != "truenas_volume_write_bytes_rate" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			values[family.GetName()+"/"+labels["dataset"]] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"truenas_volume_read_bytes_rate/tank/k8s/pvc-a":  4096,
+		"truenas_volume_write_bytes_rate/tank/k8s/pvc-a": 1024,
+	}, values)
+}
+
+func TestExporter_SetPoolUsageDeletesRemovedPools(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetPoolUsage([]PoolUsage{
+		{Pool: "tank", SizeBytes: 100, UsedBytes: 40, UtilizationPercent: 40},
+		{Pool: "old", SizeBytes: 10, UsedBytes: 5, UtilizationPercent: 50},
+	})
+	exporter.SetPoolUsage([]PoolUsage{
+		{Pool: "tank", SizeBytes: 100, UsedBytes: 60, UtilizationPercent: 60},
+		{Pool: "new", SizeBytes: 10, UsedBytes: 1, UtilizationPercent: 10},
+		{Pool: "unsized", UsedBytes: 7},
+	})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		switch family.GetName() {
+		case "truenas_storage_pool_size_bytes", "truenas_storage_pool_used_bytes", "truenas_storage_pool_utilization_percent":
+			for _, metric := range family.GetMetric() {
+				values[family.GetName()+"/"+metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"truenas_storage_pool_size_bytes/tank":          100,
+		"truenas_storage_pool_used_bytes/tank":          60,
+		"truenas_storage_pool_utilization_percent/tank": 60,
+		"truenas_storage_pool_size_bytes/new":           10,
+		"truenas_storage_pool_used_bytes/new":           1,
+		"truenas_storage_pool_utilization_percent/new":  10,
+		"truenas_storage_pool_size_bytes/unsized":       0,
+		"truenas_storage_pool_used_bytes/unsized":       7,
+	}, values, "a pool without a size must not export a utilization series")
+}
+
+func TestExporter_SetStorageClassUsageDeletesRemovedClasses(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetStorageClassUsage([]StorageClassUsage{
+		{StorageClass: "nfs", Volumes: 3, ProvisionedBytes: 300, UsedBytes: 120, Orphans: 1, WastedBytes: 40},
+		{StorageClass: "retired", Volumes: 1},
+	})
+	exporter.SetStorageClassUsage([]StorageClassUsage{
+		{StorageClass: "nfs", Volumes: 4, ProvisionedBytes: 400, UsedBytes: 150, Orphans: 2, WastedBytes: 90},
+	})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "truenas_storage_class_") {
+			for _, metric := range family.GetMetric() {
+				values[family.GetName()+"/"+metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"truenas_storage_class_volumes/nfs":           4,
+		"truenas_storage_class_provisioned_bytes/nfs": 400,
+		"truenas_storage_class_used_bytes/nfs":        150,
+		"truenas_storage_class_orphans/nfs":           2,
+		"truenas_storage_class_wasted_bytes/nfs":      90,
+	}, values)
+}
+
+func TestExporter_UpdateIsAtomicForScrapes(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 200; i++ {
+			exporter.Update(func() {
+				exporter.SetTotalPVs(float64(i))
+				exporter.SetTotalPVCs(float64(i))
+			})
+		}
+	}()
+
+	for scraping := true; scraping; {
+		select {
+		case <-done:
+			scraping = false
+		default:
+		}
+		families, err := exporter.GatherForTest()
+		require.NoError(t, err)
+		values := make(map[string]float64)
+		for _, family := range families {
+			switch family.GetName() {
+			case "truenas_monitor_pvs_total", "truenas_monitor_pvcs_total":
+				values[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		require.Equal(t, values["truenas_monitor_pvs_total"], values["truenas_monitor_pvcs_total"])
+	}
+}
+
+func TestExporter_SetAlertDestinationHealth(t *testing.T) {
+	exporter := NewExporter(Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	exporter.SetAlertDestinationHealth(map[string]bool{"slack:#storage": true, "webhook:old.example.com": true})
+	exporter.SetAlertDestinationHealth(map[string]bool{"slack:#storage": false, "email:2 recipients": true})
+
+	families, err := exporter.registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_alert_destination_healthy" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{"slack:#storage": 0, "email:2 recipients": 1}, values)
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labeledValue is one series of a GaugeVec.
+type labeledValue struct {
+	labels []string
+	value  float64
+}
+
+// seriesSet replaces the series of a GaugeVec each cycle. It remembers the
+// label values written in the previous cycle and deletes those that are not
+// written again, so pools, datasets or pods that disappear stop being
+// exported instead of keeping their last value.
+type seriesSet struct {
+	vec *prometheus.GaugeVec
+
+	mu      sync.Mutex
+	written map[string][]string
+}
+
+func newSeriesSet(vec *prometheus.GaugeVec) *seriesSet {
+	return &seriesSet{vec: vec, written: make(map[string][]string)}
+}
+
+// replace sets the given series, summing values with the same labels, and
+// deletes the series of the previous cycle that are not among them.
+func (s *seriesSet) replace(values []labeledValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sums := make(map[string]float64, len(values))
+	written := make(map[string][]string, len(values))
+	for _, v := range values {
+		key := strings.Join(v.labels, "\xff")
+		sums[key] += v.value
+		written[key] = v.labels
+	}
+	for key, labels := range written {
+		s.vec.WithLabelValues(labels...).Set(sums[key])
+	}
+	for key, labels := range s.written {
+		if _, ok := written[key]; !ok {
+			s.vec.DeleteLabelValues(labels...)
+		}
+	}
+	s.written = written
+}
+
+// lockedGatherer gathers a registry while holding the exporter's read lock,
+// so a scrape never sees the metrics of an Update half applied.
+type lockedGatherer struct {
+	mu       *sync.RWMutex
+	gatherer prometheus.Gatherer
+}
+
+func (g lockedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.gatherer.Gather()
+}
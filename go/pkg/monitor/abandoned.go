@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+)
+
+// DefaultAbandonedTopN is the number of abandoned datasets kept in scan
+// results when AbandonedDatasetOptions.TopN is zero.
+const DefaultAbandonedTopN = 10
+
+// AbandonedDatasetOptions configures the abandoned dataset check (see
+// analysis.FindAbandonedDatasets).
+type AbandonedDatasetOptions struct {
+	Enabled bool
+	// TopN limits the datasets kept in scan results (0 uses
+	// DefaultAbandonedTopN); the report totals still cover all of them.
+	TopN    int
+	Options analysis.AbandonedDatasetOptions
+}
+
+// checkAbandonedDatasets reports the largest managed datasets without a PV
+// whose space is held by old snapshots. Failures are logged and do not fail
+// the scan.
+func (s *Service) checkAbandonedDatasets(ctx context.Context, now time.Time) *analysis.AbandonedDatasetReport {
+	if !s.abandoned.Enabled {
+		return nil
+	}
+
+	classes, err := s.k8sClient.ListStorageClasses(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check abandoned datasets")
+		return nil
+	}
+	in, err := analysis.Gather(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check abandoned datasets")
+		return nil
+	}
+	report := analysis.FindAbandonedDatasets(in, analysis.ManagedDatasetPrefixes(classes), now, s.abandoned.Options)
+	if len(report.Datasets) > 0 {
+		s.logger.Info("Abandoned datasets found",
+			zap.Int("datasets", len(report.Datasets)),
+			zap.Int("blocked", report.Blocked),
+			zap.Int64("reclaimable_bytes", report.ReclaimableBytes))
+	}
+
+	topN := s.abandoned.TopN
+	if topN <= 0 {
+		topN = DefaultAbandonedTopN
+	}
+	return report.Top(topN)
+}
@@ -0,0 +1,404 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+)
+
+// Alert categories raised by the monitor service.
+const (
+	AlertCategoryOrphan         = "orphaned_resource"
+	AlertCategoryCSIVersionSkew = "csi_version_skew"
+	AlertCategoryInventoryDrift = "inventory_drift"
+)
+
+// InventoryDriftThresholds bound the drift between the democratic-csi PVs
+// and the managed TrueNAS volumes (see orphan.InventoryCounts). Zero
+// disables a bound.
+type InventoryDriftThresholds struct {
+	// MaxUnmatched is the most unmatched PVs and volumes, together, allowed.
+	MaxUnmatched int
+	// MaxPercent is the most drift allowed as a percentage of the larger
+	// inventory.
+	MaxPercent float64
+}
+
+// inventoryDriftAlert returns the alert for an inventory drifting past the
+// thresholds. Such drift usually means the CSI driver or correlation is
+// broken rather than a few leftover volumes.
+func inventoryDriftAlert(result *ScanResult, thresholds InventoryDriftThresholds) (alerts.Alert, bool) {
+	inventory := result.Inventory
+	if inventory == nil {
+		return alerts.Alert{}, false
+	}
+	var exceeded []string
+	if thresholds.MaxUnmatched > 0 && inventory.Drift > thresholds.MaxUnmatched {
+		exceeded = append(exceeded, fmt.Sprintf("%d unmatched (limit %d)", inventory.Drift, thresholds.MaxUnmatched))
+	}
+	if thresholds.MaxPercent > 0 && inventory.DriftPercent > thresholds.MaxPercent {
+		exceeded = append(exceeded, fmt.Sprintf("%.1f%% drift (limit %.1f%%)", inventory.DriftPercent, thresholds.MaxPercent))
+	}
+	if len(exceeded) == 0 {
+		return alerts.Alert{}, false
+	}
+	return alerts.Alert{
+		Source:   alerts.SourceMonitor,
+		Level:    alerts.LevelCritical,
+		Category: AlertCategoryInventoryDrift,
+		// A fixed resource keeps the alert ID stable as the counts change.
+		Resource: "Inventory/democratic-csi",
+		Message: fmt.Sprintf("Kubernetes and TrueNAS inventories drifted apart: %s; %d PVs (%d unmatched) vs %d TrueNAS volumes (%d unmatched). Check the CSI driver and volume handle correlation",
+			strings.Join(exceeded, ", "), inventory.K8sManagedPVs, inventory.UnmatchedK8s, inventory.TrueNASManagedVolumes, inventory.UnmatchedTrueNAS),
+		Labels: map[string]string{
+			"unmatched_k8s":     strconv.Itoa(inventory.UnmatchedK8s),
+			"unmatched_truenas": strconv.Itoa(inventory.UnmatchedTrueNAS),
+		},
+		Timestamp: result.Timestamp,
+	}, true
+}
+
+// groupAlertTopN is how many of a group's largest orphans its alert names.
+const groupAlertTopN = 10
+
+// largestOrphans lists the group's largest orphans for its alert, e.g.
+// "; top 10 by size: tank/k8s/a (20.0GiB), ...", so the alert stays short
+// however many orphans the group holds.
+func largestOrphans(group orphan.Group) string {
+	largest := group.Largest(groupAlertTopN)
+	if len(largest) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(largest))
+	for _, resource := range largest {
+		names = append(names, fmt.Sprintf("%s (%s)", resource.Name, humanize.Bytes(resource.SizeBytes)))
+	}
+	return fmt.Sprintf("; top %d by size: %s", len(largest), strings.Join(names, ", "))
+}
+
+// scanAlerts builds the alerts for a scan result. The alert store turns them
+// into notifications, so every current condition is listed on every scan.
+func scanAlerts(result *ScanResult) []alerts.Alert {
+	var out []alerts.Alert
+	now := result.Timestamp
+
+	// One alert per orphan group, so an incident that orphans dozens of
+	// volumes notifies once. A lone orphan keeps its per-resource alert.
+	for _, group := range result.OrphanGroups {
+		if group.Count == 1 {
+			resource := group.Resources[0]
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelWarning,
+				Category:  AlertCategoryOrphan,
+				Namespace: resource.Namespace,
+				Resource:  resource.Type + "/" + resource.Name,
+				Message:   fmt.Sprintf("Orphaned %s %s: %s", resource.Type, resource.Name, resource.Reason),
+				Labels:    map[string]string{"type": resource.Type},
+				Timestamp: now,
+			})
+			continue
+		}
+		out = append(out, alerts.Alert{
+			Source:    alerts.SourceMonitor,
+			Level:     alerts.LevelWarning,
+			Category:  AlertCategoryOrphan,
+			Namespace: group.Namespace,
+			Resource:  "OrphanGroup/" + group.ID,
+			Message:   "Orphan group: " + group.Hint + largestOrphans(group),
+			Labels: map[string]string{
+				"type":          group.Type,
+				"storage_class": group.StorageClass,
+				"count":         strconv.Itoa(group.Count),
+			},
+			Timestamp: now,
+		})
+	}
+
+	for _, duplicate := range result.DuplicateVolumeHandles {
+		out = append(out, alerts.Alert{
+			Source:    alerts.SourceMonitor,
+			Level:     alerts.LevelCritical,
+			Category:  orphan.DuplicateHandleCategory,
+			Resource:  duplicate.VolumeHandle,
+			Message:   fmt.Sprintf("Volume handle %s is shared by %d PVs", duplicate.VolumeHandle, len(duplicate.PersistentVolumes)),
+			Timestamp: now,
+		})
+	}
+
+	for _, issue := range result.ExportMissing {
+		out = append(out, alerts.Alert{
+			Source:    alerts.SourceMonitor,
+			Level:     alerts.LevelCritical,
+			Category:  orphan.ExportMissingCategory,
+			Resource:  "PersistentVolume/" + issue.PersistentVolume,
+			Message:   fmt.Sprintf("Volume of %s exists but is not exported: %s; %s", issue.PersistentVolume, issue.Message, issue.Remediation),
+			Labels:    map[string]string{"dataset": issue.Dataset, "kind": issue.Kind},
+			Timestamp: now,
+		})
+	}
+
+	if result.SnapshotSchedule != nil {
+		for _, violation := range result.SnapshotSchedule.Violations() {
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelWarning,
+				Category:  analysis.ScheduleAlertCategory,
+				Resource:  violation.PersistentVolume,
+				Message:   fmt.Sprintf("Snapshot schedule violation for %s (%s): %s", violation.PersistentVolume, violation.StorageClass, violation.Reason),
+				Labels:    map[string]string{"storage_class": violation.StorageClass},
+				Timestamp: now,
+			})
+		}
+	}
+
+	if result.BackupCoverage != nil {
+		for _, namespace := range result.BackupCoverage.BelowFloor() {
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelWarning,
+				Category:  analysis.BackupCoverageAlertCategory,
+				Namespace: namespace.Namespace,
+				Resource:  "Namespace/" + namespace.Namespace,
+				Message: fmt.Sprintf("Backup coverage of %s is %.1f%%, below the %.1f%% floor: %d of %d PVCs have no recent VolumeSnapshot",
+					namespace.Namespace, namespace.Percent, result.BackupCoverage.FloorPercent, namespace.Claims-namespace.Covered, namespace.Claims),
+				Labels:    map[string]string{"namespace": namespace.Namespace},
+				Timestamp: now,
+			})
+		}
+	}
+
+	if result.NFSMounts != nil {
+		for _, violation := range result.NFSMounts.Violations {
+			claim := violation.Claim
+			if claim == "" {
+				claim = "no bound PVC"
+			}
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelCritical,
+				Category:  analysis.NFSMountAlertCategory,
+				Namespace: violation.Namespace,
+				Resource:  "PersistentVolume/" + violation.PersistentVolume,
+				Message:   fmt.Sprintf("NFS share %s of %s (%s) is not exportable: %s", violation.SharePath, violation.PersistentVolume, claim, violation.Reason),
+				Labels:    map[string]string{"pvc": violation.Claim, "dataset": violation.Dataset},
+				Timestamp: now,
+			})
+		}
+	}
+
+	if result.ISCSISessions != nil {
+		for _, violation := range result.ISCSISessions.Violations {
+			resource := "Node/" + violation.Node
+			if violation.PersistentVolume != "" {
+				resource = "PersistentVolume/" + violation.PersistentVolume
+			}
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelCritical,
+				Category:  analysis.ISCSISessionAlertCategory,
+				Namespace: violation.Namespace,
+				Resource:  resource,
+				Message:   fmt.Sprintf("iSCSI problem on node %s: %s", violation.Node, violation.Reason),
+				Labels:    map[string]string{"node": violation.Node, "initiator": violation.Initiator, "kind": violation.Category},
+				Timestamp: now,
+			})
+		}
+	}
+
+	if result.ZFSReadiness != nil {
+		// A dataset that was unlocked raises a new alert once it is locked.
+		for _, problem := range result.ZFSReadiness.Problems {
+			resource := "Pool/" + problem.Pool
+			if problem.Dataset != "" {
+				resource = "Dataset/" + problem.Dataset
+			}
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelCritical,
+				Category:  analysis.ZFSReadinessAlertCategory,
+				Resource:  resource,
+				Message:   fmt.Sprintf("%s. Remediation: %s", problem.Message, problem.Remediation),
+				Labels:    map[string]string{"kind": problem.Kind, "pool": problem.Pool, "dataset": problem.Dataset},
+				Timestamp: now,
+			})
+		}
+	}
+
+	if result.Scope != nil {
+		for _, problem := range result.Scope.Problems {
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelCritical,
+				Category:  analysis.ScopeAlertCategory,
+				Pool:      result.Scope.Pool,
+				Resource:  "Pool/" + result.Scope.Pool,
+				Message:   problem,
+				Timestamp: now,
+			})
+		}
+	}
+
+	if result.CSIHealth != nil {
+		for _, warning := range result.CSIHealth.Warnings {
+			out = append(out, alerts.Alert{
+				Source:    alerts.SourceMonitor,
+				Level:     alerts.LevelWarning,
+				Category:  AlertCategoryCSIVersionSkew,
+				Message:   warning,
+				Timestamp: now,
+			})
+		}
+	}
+	return out
+}
+
+// coveredAlertCategories lists the categories whose checks completed in this
+// scan; only their missing alerts are resolved.
+func coveredAlertCategories(result *ScanResult) []string {
+	// A completed scan reached TrueNAS.
+	covered := []string{AlertCategoryBackendUnavailable}
+	if !result.Partial {
+		covered = append(covered, AlertCategoryOrphan, orphan.DuplicateHandleCategory)
+	}
+	if result.SnapshotSchedule != nil {
+		covered = append(covered, analysis.ScheduleAlertCategory)
+	}
+	if result.BackupCoverage != nil {
+		covered = append(covered, analysis.BackupCoverageAlertCategory)
+	}
+	if result.NFSMounts != nil {
+		covered = append(covered, analysis.NFSMountAlertCategory)
+	}
+	if result.ExportsChecked {
+		covered = append(covered, orphan.ExportMissingCategory)
+	}
+	if result.ISCSISessions != nil {
+		covered = append(covered, analysis.ISCSISessionAlertCategory)
+	}
+	if result.CSIHealth != nil {
+		covered = append(covered, AlertCategoryCSIVersionSkew)
+	}
+	if result.ZFSReadiness != nil {
+		covered = append(covered, analysis.ZFSReadinessAlertCategory)
+	}
+	if result.Inventory != nil {
+		covered = append(covered, AlertCategoryInventoryDrift)
+	}
+	if result.Scope != nil {
+		covered = append(covered, analysis.ScopeAlertCategory)
+	}
+	return covered
+}
+
+// processAlerts reconciles the scan's alerts with the active alert store,
+// sends new, due and resolved alerts through the dispatcher and updates the
+// active alert metric. Failures are logged and do not fail the scan.
+func (s *Service) processAlerts(ctx context.Context, result *ScanResult) {
+	current := scanAlerts(result)
+	if alert, ok := inventoryDriftAlert(result, s.inventoryDrift); ok {
+		current = append(current, alert)
+	}
+	covered := coveredAlertCategories(result)
+	if truenasAlerts, ok := s.pullTrueNASAlerts(ctx); ok {
+		current = append(current, truenasAlerts...)
+		covered = append(covered, alerts.TrueNASCategory)
+	}
+	s.reconcileAlerts(ctx, current, covered, result.Timestamp)
+}
+
+// reconcileAlerts updates the active alert store with current, resolving
+// missing alerts of the covered categories, and dispatches the resulting
+// notifications.
+func (s *Service) reconcileAlerts(ctx context.Context, current []alerts.Alert, covered []string, now time.Time) {
+	reconciliation, err := s.alertStore.Reconcile(current, covered)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to update active alerts")
+		return
+	}
+
+	for _, active := range reconciliation.Notify {
+		s.dispatchAlert(ctx, active.Alert)
+	}
+	for _, active := range reconciliation.Resolved {
+		resolved := active.Alert
+		resolved.Resolved = true
+		resolved.Timestamp = now
+		s.dispatchAlert(ctx, resolved)
+	}
+
+	s.updateAlertMetrics()
+}
+
+// pullTrueNASAlerts lists undismissed TrueNAS alerts when enabled. ok is
+// false when disabled or the listing failed, so existing TrueNAS alerts are
+// kept rather than resolved.
+func (s *Service) pullTrueNASAlerts(ctx context.Context) ([]alerts.Alert, bool) {
+	if !s.truenasAlerts {
+		return nil, false
+	}
+	list, err := s.truenasClient.ListAlerts(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to list TrueNAS alerts", logging.RedactedError(err))
+		return nil, false
+	}
+
+	out := make([]alerts.Alert, 0, len(list))
+	for _, alert := range list {
+		if alert.Dismissed {
+			continue
+		}
+		out = append(out, alerts.FromTrueNAS(alert))
+	}
+	return out, true
+}
+
+func (s *Service) dispatchAlert(ctx context.Context, alert alerts.Alert) {
+	if s.alertDispatcher == nil {
+		return
+	}
+	if alert.Source == alerts.SourceTrueNAS && !s.forwardTrueNAS {
+		return
+	}
+	decision, err := s.alertDispatcher.Dispatch(ctx, alert)
+	if err != nil {
+		s.logger.Warn("Alert delivery incomplete",
+			zap.String("category", alert.Category),
+			zap.String("route", decision.Route),
+			zap.Bool("resolved", alert.Resolved),
+			logging.RedactedError(err))
+	}
+}
+
+// updateAlertMetrics sets truenas_active_alerts_total from the alert store.
+func (s *Service) updateAlertMetrics() {
+	if s.metricsExporter == nil {
+		return
+	}
+	list, err := s.alertStore.List()
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to list active alerts")
+		return
+	}
+
+	counts := make(map[[2]string]int)
+	for _, active := range list {
+		counts[[2]string{active.Level, active.State}]++
+	}
+	series := make([]metrics.ActiveAlertCount, 0, len(counts))
+	for key, count := range counts {
+		series = append(series, metrics.ActiveAlertCount{Level: key[0], State: key[1], Count: count})
+	}
+	s.metricsExporter.SetActiveAlerts(series)
+}
@@ -0,0 +1,629 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestService_PerformScan_DispatchesRoutedAlerts(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	original := scanTestPV("pv-original", now.Add(-72*time.Hour))
+	restored := scanTestPV("pv-restored", now.Add(-72*time.Hour))
+	restored.Spec.CSI.VolumeHandle = original.Spec.CSI.VolumeHandle
+
+	delivered := make(map[string][]alerts.Alert)
+	sender := alerts.SenderFunc(func(_ context.Context, destination alerts.Destination, alert alerts.Alert) error {
+		delivered[destination.Channel] = append(delivered[destination.Channel], alert)
+		return nil
+	})
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: alerts.NewRouter(alerts.RouterConfig{
+			Routes: []alerts.Route{{
+				Name:         "critical",
+				Match:        alerts.Match{Levels: []string{alerts.LevelCritical}},
+				Destinations: []alerts.Destination{{Type: alerts.DestinationSlack, Channel: "#critical"}},
+			}},
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationSlack, Channel: "#storage"}}},
+			Clock:   fake,
+		}),
+		Senders: map[string]alerts.Sender{alerts.DestinationSlack: sender},
+		Logger:  logger,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient: &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+			original, restored, scanTestPV("pv-missing", now.Add(-72*time.Hour)),
+		}},
+		TruenasClient:   &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-original"}}},
+		Logger:          logger,
+		ScanInterval:    time.Minute,
+		Clock:           fake,
+		AlertDispatcher: dispatcher,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	if got := delivered["#critical"]; len(got) != 1 || got[0].Category != orphan.DuplicateHandleCategory {
+		t.Fatalf("critical route got %+v, want one duplicate handle alert", got)
+	}
+	if got := delivered["#storage"]; len(got) != 1 || got[0].Resource != "PersistentVolume/pv-missing" {
+		t.Fatalf("default route got %+v, want one orphan alert", got)
+	}
+
+	// A rescan does not re-notify alerts that are still active.
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if len(delivered["#critical"]) != 1 || len(delivered["#storage"]) != 1 {
+		t.Fatalf("after rescan critical=%d storage=%d, want 1 and 1",
+			len(delivered["#critical"]), len(delivered["#storage"]))
+	}
+}
+
+func TestService_PerformScan_ResolvesClearedAlerts(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	var delivered []alerts.Alert
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: alerts.NewRouter(alerts.RouterConfig{
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationWebhook, URL: "http://hooks"}}},
+			Clock:   fake,
+		}),
+		Senders: map[string]alerts.Sender{alerts.DestinationWebhook: alerts.SenderFunc(
+			func(_ context.Context, _ alerts.Destination, alert alerts.Alert) error {
+				delivered = append(delivered, alert)
+				return nil
+			})},
+		Logger: logger,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	truenasClient := &truenastest.Client{}
+
+	svc, err := NewService(Config{
+		K8sClient:       &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{scanTestPV("pv-missing", now.Add(-72*time.Hour))}},
+		TruenasClient:   truenasClient,
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Minute,
+		Clock:           fake,
+		AlertDispatcher: dispatcher,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	if got := activeAlertGauge(t, exporter, alerts.LevelWarning, alerts.StateFiring); got != 1 {
+		t.Fatalf("active alert gauge = %v, want 1", got)
+	}
+
+	// The dataset reappears, so the orphan alert resolves.
+	truenasClient.Volumes = []truenas.Volume{{Name: "tank/k8s/pv-missing"}}
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+
+	if len(delivered) != 2 || delivered[0].Resolved || !delivered[1].Resolved {
+		t.Fatalf("expected a firing then a resolved notification, got %+v", delivered)
+	}
+	if delivered[1].Resource != "PersistentVolume/pv-missing" {
+		t.Fatalf("resolved alert resource = %q", delivered[1].Resource)
+	}
+	if got := activeAlertGauge(t, exporter, alerts.LevelWarning, alerts.StateFiring); got != 0 {
+		t.Fatalf("active alert gauge = %v after resolution, want 0", got)
+	}
+}
+
+func activeAlertGauge(t *testing.T, exporter *metrics.Exporter, level, state string) float64 {
+	t.Helper()
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "truenas_active_alerts_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["level"] == level && labels["state"] == state {
+				return metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestService_PerformScan_PullsTrueNASAlerts(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	degraded := truenas.Alert{UUID: "6a9e1d27", Klass: "VolumeStatus", Level: "CRITICAL", Pool: "backup", Message: "Pool backup is DEGRADED"}
+	dismissed := truenas.Alert{UUID: "c2d4e6f8", Klass: "ReplicationFailed", Level: "ERROR", Dismissed: true}
+	truenasClient := &truenastest.Client{Alerts: []truenas.Alert{degraded, dismissed}}
+
+	var delivered []alerts.Alert
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: alerts.NewRouter(alerts.RouterConfig{
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationWebhook, URL: "http://hooks"}}},
+			Clock:   fake,
+		}),
+		Senders: map[string]alerts.Sender{alerts.DestinationWebhook: alerts.SenderFunc(
+			func(_ context.Context, _ alerts.Destination, alert alerts.Alert) error {
+				delivered = append(delivered, alert)
+				return nil
+			})},
+		Logger: logger,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	newService := func(forward bool) (*Service, *alerts.Store) {
+		store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+		if err != nil {
+			t.Fatalf("NewStore: %v", err)
+		}
+		svc, err := NewService(Config{
+			K8sClient:            &k8stest.Client{},
+			TruenasClient:        truenasClient,
+			Logger:               logger,
+			ScanInterval:         time.Minute,
+			Clock:                fake,
+			AlertDispatcher:      dispatcher,
+			AlertStore:           store,
+			TrueNASAlerts:        true,
+			ForwardTrueNASAlerts: forward,
+		})
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+		return svc, store
+	}
+
+	// Without forwarding the alert is stored but not sent.
+	svc, store := newService(false)
+	svc.performScan(context.Background())
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Source != alerts.SourceTrueNAS || list[0].Level != alerts.LevelCritical {
+		t.Fatalf("expected one critical TrueNAS alert, got %+v", list)
+	}
+	if len(delivered) != 0 {
+		t.Fatalf("TrueNAS alerts forwarded without forwarding enabled: %+v", delivered)
+	}
+
+	// Repeated polls keep one alert per UUID and notify once.
+	svc, store = newService(true)
+	svc.performScan(context.Background())
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if len(delivered) != 1 || delivered[0].Resource != "6a9e1d27" {
+		t.Fatalf("expected one forwarded notification, got %+v", delivered)
+	}
+
+	// A failed listing keeps the alert; clearing it on TrueNAS resolves it.
+	truenasClient.ListAlertsErr = errors.New("timeout")
+	svc.performScan(context.Background())
+	if list, _ := store.List(); len(list) != 1 {
+		t.Fatalf("alert dropped after a failed listing: %+v", list)
+	}
+	truenasClient.ListAlertsErr = nil
+	truenasClient.Alerts = nil
+	svc.performScan(context.Background())
+	if list, _ := store.List(); len(list) != 0 {
+		t.Fatalf("alert not resolved after clearing on TrueNAS: %+v", list)
+	}
+	if len(delivered) != 2 || !delivered[1].Resolved {
+		t.Fatalf("expected a resolution notification, got %+v", delivered)
+	}
+}
+
+func TestService_PerformScan_AlertsOnUnexportableNFSShares(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	pv := scanTestPV("pv-nfs", now.Add(-time.Hour))
+	pv.Spec.CSI.VolumeAttributes = map[string]string{"share": "/mnt/tank/k8s/pv-nfs"}
+	pv.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{ID: "tank/k8s/pv-nfs", Name: "tank/k8s/pv-nfs", Path: "/mnt/tank/k8s/pv-nfs"}},
+	}
+	store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:     &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{pv}},
+		TruenasClient: truenasClient,
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Clock:         fake,
+		AlertStore:    store,
+		NFSDeepCheck:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Category != analysis.NFSMountAlertCategory || list[0].Labels["pvc"] != "apps/data" {
+		t.Fatalf("expected one NFS mountpoint alert for apps/data, got %+v", list)
+	}
+
+	// Enabling the share resolves the alert on the next check.
+	truenasClient.NFSShares = []truenas.NFSShare{{Path: "/mnt/tank/k8s/pv-nfs", Enabled: true}}
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if list, _ = store.List(); len(list) != 0 {
+		t.Fatalf("expected NFS alert resolved, got %+v", list)
+	}
+}
+
+func TestService_PerformScan_AlertsOnMissingISCSISession(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	pv := scanTestPV("pv-block", now.Add(-time.Hour))
+	pv.Spec.CSI.Driver = "org.democratic-csi.iscsi"
+	pvName := pv.Name
+	k8sClient := &k8stest.Client{
+		PersistentVolumes: []corev1.PersistentVolume{pv},
+		VolumeAttachments: []storagev1.VolumeAttachment{{
+			ObjectMeta: metav1.ObjectMeta{Name: "csi-block"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: "worker-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: true},
+		}},
+		Nodes: []corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.11"}}},
+		}},
+	}
+	truenasClient := &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-block"}}}
+	store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:     k8sClient,
+		TruenasClient: truenasClient,
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Clock:         fake,
+		AlertStore:    store,
+		ISCSISessions: analysis.ISCSISessionOptions{Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Category != analysis.ISCSISessionAlertCategory ||
+		list[0].Level != alerts.LevelCritical || list[0].Resource != "Node/worker-1" {
+		t.Fatalf("expected one critical iSCSI alert for worker-1, got %+v", list)
+	}
+	if _, ok := svc.GetLastScanResult().Phases[PhaseISCSISessions]; !ok {
+		t.Fatalf("phases = %v, want %s", svc.GetLastScanResult().Phases, PhaseISCSISessions)
+	}
+
+	// A session from the node's address resolves the alert.
+	truenasClient.ISCSISessions = []truenas.ISCSISession{{Initiator: "iqn.2024-01.lab:worker-1", InitiatorAddr: "10.0.0.11"}}
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if list, _ = store.List(); len(list) != 0 {
+		t.Fatalf("expected iSCSI alert resolved, got %+v", list)
+	}
+}
+
+func TestService_PerformScan_AlertsWhenParentDatasetBecomesLocked(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	k8sClient := &k8stest.Client{StorageClasses: []storagev1.StorageClass{{
+		ObjectMeta:  metav1.ObjectMeta{Name: "nfs"},
+		Provisioner: "org.democratic-csi.nfs",
+		Parameters:  map[string]string{"datasetParentName": "tank/k8s"},
+	}}}
+	parent := truenas.Volume{ID: "tank/k8s", Name: "tank/k8s", Properties: map[string]string{
+		truenas.PropertyEncrypted: "true", truenas.PropertyKeyLoaded: "true",
+	}}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{parent},
+		Pools:   []truenas.Pool{{Name: "tank", Status: "ONLINE"}},
+	}
+	store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:     k8sClient,
+		TruenasClient: truenasClient,
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Clock:         fake,
+		AlertStore:    store,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	if list, _ := store.List(); len(list) != 0 {
+		t.Fatalf("expected no alerts while unlocked, got %+v", list)
+	}
+
+	truenasClient.Volumes[0].Properties = map[string]string{
+		truenas.PropertyEncrypted: "true", truenas.PropertyKeyLoaded: "false",
+	}
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Category != analysis.ZFSReadinessAlertCategory ||
+		list[0].Level != alerts.LevelCritical || list[0].Resource != "Dataset/tank/k8s" {
+		t.Fatalf("expected one critical alert for the locked dataset, got %+v", list)
+	}
+	if diff := svc.GetLastScanDiff(); diff == nil || len(diff.LockedDatasets) != 1 || diff.LockedDatasets[0] != "tank/k8s" {
+		t.Fatalf("diff = %+v, want tank/k8s newly locked", diff)
+	}
+}
+
+func TestService_PerformScan_AlertsOnInventoryDrift(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		scanTestPV("pv-a", now.Add(-72*time.Hour)),
+		// Too young to be an orphan, but still unmatched.
+		scanTestPV("pv-new", now.Add(-time.Minute)),
+	}}
+	truenasClient := &truenastest.Client{Volumes: []truenas.Volume{
+		{Name: "tank/k8s"},
+		{Name: "tank/k8s/pv-a"},
+		{Name: "tank/k8s/pv-stray"},
+		{Name: "tank/backups/db"},
+	}}
+	store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:      k8sClient,
+		TruenasClient:  truenasClient,
+		Logger:         logger,
+		ScanInterval:   time.Minute,
+		Clock:          fake,
+		AlertStore:     store,
+		InventoryDrift: InventoryDriftThresholds{MaxUnmatched: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	want := orphan.InventoryCounts{K8sManagedPVs: 2, TrueNASManagedVolumes: 2, UnmatchedK8s: 1, UnmatchedTrueNAS: 1, Drift: 2, DriftPercent: 100}
+	if got := svc.GetLastScanResult().Inventory; got == nil || *got != want {
+		t.Fatalf("inventory = %+v, want %+v", got, want)
+	}
+	if orphans := svc.GetLastScanResult().OrphanedPVs; len(orphans) != 0 {
+		t.Fatalf("young PV must not be an orphan: %+v", orphans)
+	}
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Category != AlertCategoryInventoryDrift || list[0].Level != alerts.LevelCritical {
+		t.Fatalf("expected one critical inventory drift alert, got %+v", list)
+	}
+
+	// Provisioning the missing dataset brings the drift within the limit.
+	truenasClient.Volumes = append(truenasClient.Volumes, truenas.Volume{Name: "tank/k8s/pv-new"})
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if list, _ = store.List(); len(list) != 0 {
+		t.Fatalf("expected inventory drift alert resolved, got %+v", list)
+	}
+}
+
+func TestService_PerformScan_DegradedWhenConfiguredPoolIsRenamed(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	fake := clock.NewFake(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{ID: "tank/k8s", Name: "tank/k8s"}},
+		Pools:   []truenas.Pool{{Name: "tank", Status: "ONLINE"}},
+	}
+	store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:     &k8stest.Client{},
+		TruenasClient: truenasClient,
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Clock:         fake,
+		AlertStore:    store,
+		Scope:         analysis.ScopeOptions{Pool: "tank", ParentDataset: "tank/k8s"},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	if result := svc.GetLastScanResult(); result.Degraded || result.Scope == nil || !result.Scope.ParentDatasetFound {
+		t.Fatalf("scan = degraded %v, scope %+v; want the pool and dataset found", result.Degraded, result.Scope)
+	}
+
+	truenasClient.Pools = []truenas.Pool{{Name: "tank-old", Status: "ONLINE"}}
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	result := svc.GetLastScanResult()
+	if !result.Degraded || result.Scope.PoolFound || strings.Join(result.Scope.AvailablePools, ",") != "tank-old" {
+		t.Fatalf("scan = degraded %v, scope %+v; want the renamed pool noticed", result.Degraded, result.Scope)
+	}
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Category != analysis.ScopeAlertCategory || list[0].Resource != "Pool/tank" {
+		t.Fatalf("expected one truenas_scope alert for Pool/tank, got %+v", list)
+	}
+}
+
+func TestScanAlerts_OneAlertPerOrphanGroup(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var resources []orphan.OrphanedResource
+	for _, name := range []string{"pv-a", "pv-b", "pv-c"} {
+		resources = append(resources, orphan.OrphanedResource{
+			Type: "PersistentVolume", Name: name, Reason: "No corresponding TrueNAS volume found",
+			StorageClass: "nfs", CreatedAt: now.Add(-48 * time.Hour),
+		})
+	}
+	resources = append(resources, orphan.OrphanedResource{
+		Type: "VolumeSnapshot", Name: "snap-1", Namespace: "apps", Reason: "No corresponding TrueNAS snapshot found",
+		CreatedAt: now.Add(-72 * time.Hour),
+	})
+
+	out := scanAlerts(&ScanResult{Timestamp: now, OrphanGroups: orphan.GroupOrphans(resources, 0)})
+	if len(out) != 2 {
+		t.Fatalf("got %d alerts, want one per group: %+v", len(out), out)
+	}
+	group, single := out[0], out[1]
+	if !strings.HasPrefix(group.Resource, "OrphanGroup/") || group.Labels["count"] != "3" || !strings.Contains(group.Message, "3 PersistentVolumes") {
+		t.Fatalf("group alert = %+v", group)
+	}
+	if single.Resource != "VolumeSnapshot/snap-1" || single.Namespace != "apps" {
+		t.Fatalf("a lone orphan keeps its per-resource alert, got %+v", single)
+	}
+}
+
+func TestScanAlerts_LargeGroupIsSummarized(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var resources []orphan.OrphanedResource
+	for i := 0; i < 5012; i++ {
+		resources = append(resources, orphan.OrphanedResource{
+			Type: "TrueNASSnapshot", Name: fmt.Sprintf("tank/k8s/pvc-%d@auto", i),
+			Reason:    "Old TrueNAS snapshot without corresponding VolumeSnapshot",
+			SizeBytes: int64(i+1) << 20, CreatedAt: now.Add(-48 * time.Hour),
+		})
+	}
+
+	out := scanAlerts(&ScanResult{Timestamp: now, OrphanGroups: orphan.GroupOrphans(resources, 0)})
+	if len(out) != 1 {
+		t.Fatalf("got %d alerts, want one group alert", len(out))
+	}
+	message := out[0].Message
+	if !strings.Contains(message, "5,012 TrueNASSnapshots") ||
+		!strings.Contains(message, "top 10 by size: tank/k8s/pvc-5011@auto (4.9GiB), tank/k8s/pvc-5010@auto") ||
+		strings.Count(message, "@auto") != 10 {
+		t.Fatalf("group alert message = %q", message)
+	}
+}
+
+func TestScanAlerts_BackupCoverageBelowFloor(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	result := &ScanResult{Timestamp: now, BackupCoverage: &analysis.BackupCoverageReport{
+		FloorPercent: 90,
+		Namespaces: []analysis.NamespaceBackupCoverage{
+			{Namespace: "prod", Claims: 4, Covered: 3, Percent: 75, BelowFloor: true},
+			{Namespace: "prod-db", Claims: 2, Covered: 2, Percent: 100},
+		},
+	}}
+
+	out := scanAlerts(result)
+	if len(out) != 1 {
+		t.Fatalf("got %d alerts, want one for the namespace below the floor: %+v", len(out), out)
+	}
+	alert := out[0]
+	if alert.Category != analysis.BackupCoverageAlertCategory || alert.Level != alerts.LevelWarning ||
+		alert.Namespace != "prod" || !strings.Contains(alert.Message, "1 of 4 PVCs") {
+		t.Fatalf("backup coverage alert = %+v", alert)
+	}
+	covered := strings.Join(coveredAlertCategories(result), ",")
+	if !strings.Contains(covered, analysis.BackupCoverageAlertCategory) {
+		t.Fatalf("covered categories %s do not include %s", covered, analysis.BackupCoverageAlertCategory)
+	}
+}
@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+)
+
+// checkBackupCoverage checks that the claims the backup coverage policies
+// select have a recent VolumeSnapshot and records per-namespace coverage for
+// export. Failures are logged and do not fail the scan.
+func (s *Service) checkBackupCoverage(ctx context.Context, now time.Time, pending *scanMetrics) *analysis.BackupCoverageReport {
+	if len(s.backupCoverage.Policies) == 0 {
+		return nil
+	}
+
+	in, err := analysis.GatherBackupCoverage(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check backup coverage")
+		return nil
+	}
+	report := analysis.CheckBackupCoverage(in, now, s.backupCoverage)
+
+	for _, namespace := range report.BelowFloor() {
+		s.logger.Warn("Backup coverage below floor",
+			zap.String("namespace", namespace.Namespace),
+			zap.Float64("percent", namespace.Percent),
+			zap.Float64("floor_percent", report.FloorPercent),
+			zap.Int("uncovered", namespace.Claims-namespace.Covered))
+	}
+	if len(report.CSIBypass) > 0 {
+		s.logger.Info("Datasets with ZFS snapshots but no VolumeSnapshot",
+			zap.Int("datasets", len(report.CSIBypass)))
+	}
+
+	pending.backupCoverage = make(map[string]float64, len(report.Namespaces))
+	for _, namespace := range report.Namespaces {
+		pending.backupCoverage[namespace.Namespace] = namespace.Percent
+	}
+	return report
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/canary"
+)
+
+// RestoreCanaryOptions configures the restore canary (see pkg/canary).
+type RestoreCanaryOptions struct {
+	Enabled bool
+	// Interval is the time between runs (0 uses canary.DefaultInterval).
+	// The first run starts with the service.
+	Interval time.Duration
+	Options  canary.Options
+}
+
+// LastRestoreCanary returns the most recent restore canary result, or nil
+// before the first run.
+func (s *Service) LastRestoreCanary() *canary.Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastCanary
+}
+
+// canaryLoop runs the restore canary at start and then every interval.
+func (s *Service) canaryLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	interval := s.restoreCanary.Interval
+	if interval <= 0 {
+		interval = canary.DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.runRestoreCanary(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runRestoreCanary runs one canary cycle, records its metrics and raises or
+// resolves the restore_canary alert.
+func (s *Service) runRestoreCanary(ctx context.Context) *canary.Result {
+	ctx, span := s.tracer.Start(ctx, "monitor.restore_canary")
+	defer span.End()
+
+	result := canary.Run(ctx, s.truenasClient, s.k8sClient, s.restoreCanary.Options, s.clock.Now())
+
+	fields := []zap.Field{
+		zap.String("dataset", result.Dataset),
+		zap.Duration("duration", result.Duration),
+	}
+	for _, step := range result.Steps {
+		fields = append(fields, zap.Duration(step.Step, step.Duration))
+	}
+	if result.Success {
+		s.logger.Info("Restore canary succeeded", fields...)
+	} else {
+		s.logger.Error("Restore canary failed", append(fields,
+			zap.String("failed_step", result.FailedStep),
+			zap.String("error", result.Error))...)
+	}
+
+	if s.metricsExporter != nil {
+		steps := make(map[string]float64, len(result.Steps))
+		for _, step := range result.Steps {
+			steps[step.Step] = step.Duration.Seconds()
+		}
+		s.metricsExporter.ObserveRestoreCanary(result.Success, result.Duration.Seconds(), steps)
+	}
+
+	s.mu.Lock()
+	s.lastCanary = result
+	s.mu.Unlock()
+
+	var current []alerts.Alert
+	if !result.Success {
+		current = append(current, alerts.Alert{
+			Source:    alerts.SourceMonitor,
+			Level:     alerts.LevelCritical,
+			Category:  canary.AlertCategory,
+			Resource:  "Dataset/" + result.Dataset,
+			Message:   "Restore canary failed at step " + result.FailedStep + ": " + result.Error,
+			Labels:    map[string]string{"step": result.FailedStep},
+			Timestamp: result.StartedAt,
+		})
+	}
+	s.reconcileAlerts(ctx, current, []string{canary.AlertCategory}, result.StartedAt)
+	return result
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/canary"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestService_RestoreCanary_FailureRaisesCriticalAlert(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	truenasClient := &truenastest.Client{
+		Volumes:          []truenas.Volume{{ID: "tank/canary", Name: "tank/canary", Path: "/mnt/tank/canary", Available: 1 << 30}},
+		CloneSnapshotErr: errors.New("clone failed"),
+	}
+	store, err := alerts.NewStore(alerts.StoreConfig{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	svc, err := NewService(Config{
+		K8sClient:       &k8stest.Client{},
+		TruenasClient:   truenasClient,
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Minute,
+		Clock:           clock.NewFake(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)),
+		AlertStore:      store,
+		RestoreCanary: RestoreCanaryOptions{
+			Enabled: true,
+			Options: canary.Options{Dataset: "tank/canary"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	result := svc.runRestoreCanary(context.Background())
+	if result.Success || result.FailedStep != canary.StepClone {
+		t.Fatalf("unexpected canary result: %+v", result)
+	}
+	active, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(active) != 1 || active[0].Category != canary.AlertCategory || active[0].Level != alerts.LevelCritical || active[0].Labels["step"] != canary.StepClone {
+		t.Fatalf("expected a critical restore_canary alert for the clone step, got %+v", active)
+	}
+	if got := restoreCanarySuccess(t, exporter); got != 0 {
+		t.Fatalf("truenas_restore_canary_success = %v, want 0", got)
+	}
+
+	truenasClient.CloneSnapshotErr = nil
+	if result := svc.runRestoreCanary(context.Background()); !result.Success {
+		t.Fatalf("canary should pass once cloning works: %+v", result)
+	}
+	if active, _ := store.List(); len(active) != 0 {
+		t.Fatalf("alert should resolve after a passing run, got %+v", active)
+	}
+	if got := restoreCanarySuccess(t, exporter); got != 1 {
+		t.Fatalf("truenas_restore_canary_success = %v, want 1", got)
+	}
+	if svc.LastRestoreCanary() == nil || !svc.LastRestoreCanary().Success {
+		t.Fatalf("last canary result not stored: %+v", svc.LastRestoreCanary())
+	}
+}
+
+func restoreCanarySuccess(t *testing.T, exporter *metrics.Exporter) float64 {
+	t.Helper()
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "truenas_restore_canary_success" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatal("truenas_restore_canary_success not registered")
+	return 0
+}
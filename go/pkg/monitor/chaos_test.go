@@ -0,0 +1,273 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/chaos"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+// chaosPhaseTimeout bounds the detection phases, so hung lists end the
+// phase instead of the scan.
+const chaosPhaseTimeout = 20 * time.Millisecond
+
+// chaosScan is a monitor over healthy backends, where nothing is orphaned,
+// with fault injection into both clients.
+type chaosScan struct {
+	svc     *Service
+	clock   *clock.Fake
+	k8s     *chaos.K8sClient
+	truenas *chaos.TrueNASClient
+}
+
+func newChaosScan(t *testing.T) *chaosScan {
+	t.Helper()
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	k8sClient := &k8stest.Client{}
+	truenasClient := &truenastest.Client{
+		Pools: []truenas.Pool{{Name: "tank", Size: 100 << 30, Used: 10 << 30, Available: 90 << 30, Health: "ONLINE"}},
+	}
+	for i := 1; i <= 5; i++ {
+		pv := scanTestPV(fmt.Sprintf("pv-%d", i), old)
+		pvc := fmt.Sprintf("data-%d", i)
+		pv.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: pvc}
+		pv.Status.Phase = corev1.VolumeBound
+		k8sClient.PersistentVolumes = append(k8sClient.PersistentVolumes, pv)
+		k8sClient.PersistentVolumeClaims = append(k8sClient.PersistentVolumeClaims, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: pvc, Namespace: "apps", CreationTimestamp: metav1.NewTime(old)},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: pv.Name},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		})
+		dataset := "tank/k8s/" + pv.Name
+		snapshot := fmt.Sprintf("snap-%d", i)
+		k8sClient.VolumeSnapshots = append(k8sClient.VolumeSnapshots, snapshotv1.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              snapshot,
+				Namespace:         "apps",
+				CreationTimestamp: metav1.NewTime(old),
+				Annotations:       map[string]string{"truenas.dataset": dataset},
+			},
+		})
+		truenasClient.Volumes = append(truenasClient.Volumes, truenas.Volume{Name: dataset, Used: 1 << 30})
+		truenasClient.Snapshots = append(truenasClient.Snapshots, truenas.Snapshot{
+			Name:      dataset + "@" + snapshot,
+			Dataset:   dataset,
+			CreatedAt: old,
+		})
+	}
+
+	scan := &chaosScan{
+		clock:   clock.NewFake(now),
+		k8s:     chaos.NewK8sClient(k8sClient, chaos.NewSchedule(0)),
+		truenas: chaos.NewTrueNASClient(truenasClient, chaos.NewSchedule(0)),
+	}
+	scan.svc, err = NewService(Config{
+		K8sClient:     scan.k8s,
+		TruenasClient: scan.truenas,
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		PhaseTimeouts: orphan.PhaseTimeouts{K8sList: chaosPhaseTimeout, TrueNASList: chaosPhaseTimeout},
+		Clock:         scan.clock,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return scan
+}
+
+// inject replaces the fault schedule of both clients.
+func (c *chaosScan) inject(seed int64, rules ...chaos.Rule) *chaos.Schedule {
+	schedule := chaos.NewSchedule(seed, rules...)
+	c.k8s.Schedule = schedule
+	c.truenas.Schedule = schedule
+	return schedule
+}
+
+// scan runs one scan a scan interval after the previous one, failing the
+// test on a panic, and returns the last result afterwards.
+func (c *chaosScan) scan(t *testing.T, schedule *chaos.Schedule) *ScanResult {
+	t.Helper()
+	c.clock.Advance(time.Minute)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("scan panicked with faults %v: %v", schedule.Injected(), r)
+			}
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		c.svc.performScan(ctx)
+	}()
+	return c.svc.GetLastScanResult()
+}
+
+func assertNoOrphans(t *testing.T, result *ScanResult, schedule *chaos.Schedule) {
+	t.Helper()
+	if result == nil {
+		return
+	}
+	lists := map[string][]OrphanedResource{
+		"PVs":             result.OrphanedPVs,
+		"PVCs":            result.OrphanedPVCs,
+		"snapshots":       result.OrphanedSnapshots,
+		"TrueNAS volumes": result.OrphanedTrueNASVolumes,
+	}
+	for name, orphans := range lists {
+		if len(orphans) > 0 {
+			t.Fatalf("healthy %s reported orphaned with faults %v: %+v", name, schedule.Injected(), orphans)
+		}
+	}
+}
+
+// waitForGoroutines fails the test unless the goroutine count drops back
+// to baseline.
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, started with %d:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChaos_HealthyBaselineHasNoOrphans(t *testing.T) {
+	scan := newChaosScan(t)
+	schedule := scan.inject(0)
+	result := scan.scan(t, schedule)
+	if result == nil || result.Partial || result.Stale {
+		t.Fatalf("baseline scan = %+v, want a complete result", result)
+	}
+	if result.TotalPVs != 5 || result.TotalTrueNASSnapshots != 5 {
+		t.Fatalf("baseline totals = %d PVs, %d TrueNAS snapshots, want 5 and 5", result.TotalPVs, result.TotalTrueNASSnapshots)
+	}
+	assertNoOrphans(t, result, schedule)
+}
+
+func TestChaos_HungPageYieldsPartialResult(t *testing.T) {
+	for _, method := range []string{"ListDemocraticCSIPersistentVolumes", "ListVolumes", "ListVolumeSnapshots", "ListSnapshots"} {
+		t.Run(method, func(t *testing.T) {
+			scan := newChaosScan(t)
+			schedule := scan.inject(1, chaos.Rule{Method: method, Fault: chaos.FaultHang, Rate: 1})
+			result := scan.scan(t, schedule)
+			if result == nil {
+				t.Fatal("a timed-out phase should still produce a result")
+			}
+			if !result.Partial || len(result.PhaseErrors) != 1 {
+				t.Fatalf("partial = %v, phase errors = %v, want one timed-out phase", result.Partial, result.PhaseErrors)
+			}
+			if result.Stale {
+				t.Fatal("a fresh partial result must not be stale")
+			}
+			assertNoOrphans(t, result, schedule)
+		})
+	}
+}
+
+func TestChaos_FailedListingKeepsPreviousResult(t *testing.T) {
+	for _, tt := range []struct {
+		method    string
+		fault     chaos.Fault
+		wantStale bool
+	}{
+		{method: "ListSnapshots", fault: chaos.FaultTruncate},
+		{method: "ListVolumeSnapshots", fault: chaos.FaultTruncate},
+		{method: "ListVolumes", fault: chaos.FaultError},
+		{method: "ListDemocraticCSIPersistentVolumes", fault: chaos.FaultError},
+		{method: "ListSnapshots", fault: chaos.FaultUnavailable, wantStale: true},
+	} {
+		t.Run(tt.method+"/"+string(tt.fault), func(t *testing.T) {
+			scan := newChaosScan(t)
+			previous := scan.scan(t, scan.inject(0))
+
+			schedule := scan.inject(1, chaos.Rule{Method: tt.method, Fault: tt.fault, Rate: 1})
+			result := scan.scan(t, schedule)
+			if len(schedule.Injected()) == 0 {
+				t.Fatalf("%s was not called", tt.method)
+			}
+			if result == nil || result.Timestamp != previous.Timestamp {
+				t.Fatalf("a failed listing replaced the previous result: %+v", result)
+			}
+			if result.Stale != tt.wantStale {
+				t.Fatalf("stale = %v, want %v", result.Stale, tt.wantStale)
+			}
+			assertNoOrphans(t, result, schedule)
+
+			// Scans pause during a TrueNAS maintenance window.
+			scan.clock.Advance(DefaultMaintenanceGrace)
+			recovered := scan.scan(t, scan.inject(0))
+			if recovered.Stale || recovered.Partial {
+				t.Fatalf("recovered scan: stale = %v, partial = %v", recovered.Stale, recovered.Partial)
+			}
+		})
+	}
+}
+
+// TestChaos_SeededFaults sweeps seeded mixes of realistic faults: a 500 on
+// one of five calls, the odd 503, truncated lists and hung pages. No seed
+// may panic, report a healthy resource as orphaned or leak a goroutine.
+func TestChaos_SeededFaults(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	rules := []chaos.Rule{
+		{Fault: chaos.FaultError, Rate: 0.2},
+		{Fault: chaos.FaultUnavailable, Rate: 0.05},
+		{Fault: chaos.FaultTruncate, Rate: 0.05},
+	}
+	// Hangs are injected only where a phase timeout bounds them.
+	for _, method := range []string{"ListDemocraticCSIPersistentVolumes", "ListVolumes", "ListVolumeSnapshots", "ListSnapshots", "ListVolumeSnapshotContents"} {
+		rules = append(rules, chaos.Rule{Method: method, Fault: chaos.FaultHang, Rate: 0.05})
+	}
+
+	faults := 0
+	for seed := int64(1); seed <= 40; seed++ {
+		scan := newChaosScan(t)
+		sawUnavailable := false
+		for i := int64(0); i < 3; i++ {
+			schedule := scan.inject(seed*10+i, rules...)
+			result := scan.scan(t, schedule)
+			injected := map[chaos.Fault]bool{}
+			for _, injection := range schedule.Injected() {
+				injected[injection.Fault] = true
+			}
+			faults += len(schedule.Injected())
+			sawUnavailable = sawUnavailable || injected[chaos.FaultUnavailable]
+
+			assertNoOrphans(t, result, schedule)
+			if result == nil {
+				continue
+			}
+			if result.Stale && !sawUnavailable {
+				t.Fatalf("seed %d: stale result without a 503: %v", seed, schedule.Injected())
+			}
+			fresh := result.Timestamp.Equal(scan.clock.Now())
+			if fresh && result.Partial && !injected[chaos.FaultHang] {
+				t.Fatalf("seed %d: partial result without a timed-out phase: %v", seed, schedule.Injected())
+			}
+		}
+	}
+	if faults == 0 {
+		t.Fatal("no faults were injected")
+	}
+	waitForGoroutines(t, baseline)
+}
@@ -0,0 +1,279 @@
+package monitor
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+)
+
+// Pool threshold crossing directions.
+const (
+	ThresholdCrossedAbove = "above"
+	ThresholdCrossedBelow = "below"
+)
+
+// PoolThresholdCrossing is a pool whose utilization crossed
+// analysis.PoolUtilizationWarnPercent between two scans.
+type PoolThresholdCrossing struct {
+	Pool                       string  `json:"pool"`
+	Direction                  string  `json:"direction"`
+	PreviousUtilizationPercent float64 `json:"previous_utilization_percent"`
+	UtilizationPercent         float64 `json:"utilization_percent"`
+}
+
+// CSIPodChange is a democratic-csi pod whose health changed between two
+// scans. Previous or Current is nil when the pod appeared or went away.
+type CSIPodChange struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Previous  *CSIPodHealth `json:"previous"`
+	Current   *CSIPodHealth `json:"current"`
+}
+
+// CSIPodHealth is the part of a CSI pod status compared across scans.
+type CSIPodHealth struct {
+	Phase string `json:"phase"`
+	Ready bool   `json:"ready"`
+}
+
+// PoolStorageDelta is the change of used bytes of a pool between two scans.
+type PoolStorageDelta struct {
+	Pool           string `json:"pool"`
+	PreviousUsed   int64  `json:"previous_used"`
+	Used           int64  `json:"used"`
+	UsedBytesDelta int64  `json:"used_bytes_delta"`
+}
+
+// ScanDiff describes what changed between two consecutive scans.
+type ScanDiff struct {
+	From            time.Time               `json:"from"`
+	To              time.Time               `json:"to"`
+	NewOrphans      []OrphanedResource      `json:"new_orphans"`
+	ResolvedOrphans []OrphanedResource      `json:"resolved_orphans"`
+	PoolThresholds  []PoolThresholdCrossing `json:"pool_thresholds"`
+	CSIPods         []CSIPodChange          `json:"csi_pods"`
+	PoolDeltas      []PoolStorageDelta      `json:"pool_deltas"`
+	// LockedDatasets are parent datasets unlocked in the previous scan and
+	// locked in this one.
+	LockedDatasets []string `json:"locked_datasets"`
+	// ResolvedSkipped is set when the current scan was partial, so orphans
+	// missing from it are not reported as resolved.
+	ResolvedSkipped bool `json:"resolved_skipped,omitempty"`
+	// ConfigDrift is set when the two scans ran under different
+	// configurations, so changes may come from the settings rather than
+	// the cluster.
+	ConfigDrift *ConfigDrift `json:"config_drift,omitempty"`
+}
+
+// ConfigDrift holds the configuration hashes of two scans that differ.
+type ConfigDrift struct {
+	PreviousHash string `json:"previous_hash"`
+	Hash         string `json:"hash"`
+}
+
+// ScanChanges is a compact summary of a ScanDiff.
+type ScanChanges struct {
+	NewOrphans             int   `json:"new_orphans"`
+	ResolvedOrphans        int   `json:"resolved_orphans"`
+	PoolThresholdCrossings int   `json:"pool_threshold_crossings"`
+	CSIPodChanges          int   `json:"csi_pod_changes"`
+	LockedDatasets         int   `json:"locked_datasets"`
+	UsedBytesDelta         int64 `json:"used_bytes_delta"`
+}
+
+// Changes summarizes the diff.
+func (d *ScanDiff) Changes() ScanChanges {
+	changes := ScanChanges{
+		NewOrphans:             len(d.NewOrphans),
+		ResolvedOrphans:        len(d.ResolvedOrphans),
+		PoolThresholdCrossings: len(d.PoolThresholds),
+		CSIPodChanges:          len(d.CSIPods),
+		LockedDatasets:         len(d.LockedDatasets),
+	}
+	for _, delta := range d.PoolDeltas {
+		changes.UsedBytesDelta += delta.UsedBytesDelta
+	}
+	return changes
+}
+
+// Empty reports whether nothing changed.
+func (d *ScanDiff) Empty() bool {
+	return len(d.NewOrphans) == 0 && len(d.ResolvedOrphans) == 0 &&
+		len(d.PoolThresholds) == 0 && len(d.CSIPods) == 0 && len(d.PoolDeltas) == 0 &&
+		len(d.LockedDatasets) == 0
+}
+
+// DiffScans compares two scan results. A nil previous result is treated as
+// an empty scan. Orphans are matched by type, namespace and name; pools
+// missing from either scan are left out of threshold and delta changes, and
+// CSI pod health is only compared when both scans checked it.
+func DiffScans(previous, current *ScanResult) *ScanDiff {
+	if previous == nil {
+		previous = &ScanResult{}
+	}
+	if current == nil {
+		current = &ScanResult{}
+	}
+
+	diff := &ScanDiff{
+		From:            previous.Timestamp,
+		To:              current.Timestamp,
+		NewOrphans:      []OrphanedResource{},
+		ResolvedOrphans: []OrphanedResource{},
+		PoolThresholds:  []PoolThresholdCrossing{},
+		CSIPods:         []CSIPodChange{},
+		PoolDeltas:      []PoolStorageDelta{},
+		LockedDatasets:  []string{},
+		ResolvedSkipped: current.Partial,
+	}
+	if previous.Config != nil && current.Config != nil && previous.Config.Hash != current.Config.Hash {
+		diff.ConfigDrift = &ConfigDrift{PreviousHash: previous.Config.Hash, Hash: current.Config.Hash}
+	}
+
+	previousOrphans := orphansByKey(previous)
+	currentOrphans := orphansByKey(current)
+	for key, resource := range currentOrphans {
+		if _, ok := previousOrphans[key]; !ok {
+			diff.NewOrphans = append(diff.NewOrphans, resource)
+		}
+	}
+	if !current.Partial {
+		for key, resource := range previousOrphans {
+			if _, ok := currentOrphans[key]; !ok {
+				diff.ResolvedOrphans = append(diff.ResolvedOrphans, resource)
+			}
+		}
+	}
+	sortOrphans(diff.NewOrphans)
+	sortOrphans(diff.ResolvedOrphans)
+
+	previousPools := make(map[string]analysis.PoolUsage, len(previous.Pools))
+	for _, pool := range previous.Pools {
+		previousPools[pool.Name] = pool
+	}
+	for _, pool := range current.Pools {
+		before, ok := previousPools[pool.Name]
+		if !ok {
+			continue
+		}
+		wasAbove := before.UtilizationPercent >= analysis.PoolUtilizationWarnPercent
+		isAbove := pool.UtilizationPercent >= analysis.PoolUtilizationWarnPercent
+		if wasAbove != isAbove {
+			direction := ThresholdCrossedAbove
+			if wasAbove {
+				direction = ThresholdCrossedBelow
+			}
+			diff.PoolThresholds = append(diff.PoolThresholds, PoolThresholdCrossing{
+				Pool:                       pool.Name,
+				Direction:                  direction,
+				PreviousUtilizationPercent: before.UtilizationPercent,
+				UtilizationPercent:         pool.UtilizationPercent,
+			})
+		}
+		if pool.Used != before.Used {
+			diff.PoolDeltas = append(diff.PoolDeltas, PoolStorageDelta{
+				Pool:           pool.Name,
+				PreviousUsed:   before.Used,
+				Used:           pool.Used,
+				UsedBytesDelta: pool.Used - before.Used,
+			})
+		}
+	}
+	sort.Slice(diff.PoolThresholds, func(i, j int) bool { return diff.PoolThresholds[i].Pool < diff.PoolThresholds[j].Pool })
+	sort.Slice(diff.PoolDeltas, func(i, j int) bool { return diff.PoolDeltas[i].Pool < diff.PoolDeltas[j].Pool })
+
+	if previous.CSIHealth != nil && current.CSIHealth != nil {
+		diff.CSIPods = diffCSIPods(previous.CSIHealth.Pods, current.CSIHealth.Pods)
+	}
+
+	if previous.ZFSReadiness != nil && current.ZFSReadiness != nil {
+		diff.LockedDatasets = newlyLockedDatasets(previous.ZFSReadiness, current.ZFSReadiness)
+	}
+
+	return diff
+}
+
+// newlyLockedDatasets lists datasets checked and unlocked in previous that
+// are locked in current.
+func newlyLockedDatasets(previous, current *analysis.ZFSReadinessReport) []string {
+	unlocked := make(map[string]bool, len(previous.Datasets))
+	for _, dataset := range previous.Datasets {
+		unlocked[dataset] = true
+	}
+	for _, dataset := range previous.LockedDatasets() {
+		delete(unlocked, dataset)
+	}
+	locked := []string{}
+	for _, dataset := range current.LockedDatasets() {
+		if unlocked[dataset] {
+			locked = append(locked, dataset)
+		}
+	}
+	sort.Strings(locked)
+	return locked
+}
+
+func orphansByKey(result *ScanResult) map[string]OrphanedResource {
+	byKey := make(map[string]OrphanedResource)
+	for _, list := range [][]OrphanedResource{result.OrphanedPVs, result.OrphanedPVCs, result.OrphanedSnapshots, result.OrphanedTrueNASVolumes} {
+		for _, resource := range list {
+			byKey[resource.Type+"/"+resource.Namespace+"/"+resource.Name] = resource
+		}
+	}
+	return byKey
+}
+
+func sortOrphans(list []OrphanedResource) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Type != list[j].Type {
+			return list[i].Type < list[j].Type
+		}
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].Name < list[j].Name
+	})
+}
+
+func diffCSIPods(previous, current []k8s.CSIPodStatus) []CSIPodChange {
+	health := func(pods []k8s.CSIPodStatus) map[string]CSIPodHealth {
+		byKey := make(map[string]CSIPodHealth, len(pods))
+		for _, pod := range pods {
+			byKey[pod.Namespace+"/"+pod.Name] = CSIPodHealth{Phase: pod.Phase, Ready: pod.Ready}
+		}
+		return byKey
+	}
+	before, after := health(previous), health(current)
+
+	changes := []CSIPodChange{}
+	add := func(key string, prev, cur *CSIPodHealth) {
+		namespace, name, _ := strings.Cut(key, "/")
+		changes = append(changes, CSIPodChange{Name: name, Namespace: namespace, Previous: prev, Current: cur})
+	}
+	for key, cur := range after {
+		cur := cur
+		prev, ok := before[key]
+		switch {
+		case !ok:
+			add(key, nil, &cur)
+		case prev != cur:
+			add(key, &prev, &cur)
+		}
+	}
+	for key, prev := range before {
+		prev := prev
+		if _, ok := after[key]; !ok {
+			add(key, &prev, nil)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
@@ -0,0 +1,264 @@
+package monitor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func diffTestScan(orphanedPVs []string, pools map[string]int64, pods map[string]bool) *ScanResult {
+	result := &ScanResult{}
+	for _, name := range orphanedPVs {
+		result.OrphanedPVs = append(result.OrphanedPVs, OrphanedResource{Type: "PersistentVolume", Name: name})
+	}
+	for name, used := range pools {
+		result.Pools = append(result.Pools, analysis.PoolUsage{
+			Name: name, Size: 100, Used: used, UtilizationPercent: float64(used),
+		})
+	}
+	if pods != nil {
+		result.CSIHealth = &k8s.CSIDriverHealth{}
+		for name, ready := range pods {
+			phase := "Running"
+			if !ready {
+				phase = "Pending"
+			}
+			result.CSIHealth.Pods = append(result.CSIHealth.Pods, k8s.CSIPodStatus{
+				Name: name, Namespace: "democratic-csi", Phase: phase, Ready: ready,
+			})
+		}
+	}
+	return result
+}
+
+func TestDiffScans(t *testing.T) {
+	tests := []struct {
+		name         string
+		previous     *ScanResult
+		current      *ScanResult
+		partial      bool
+		wantNew      []string
+		wantResolved []string
+		wantCrossed  map[string]string
+		wantPods     []string
+		wantDelta    int64
+		wantEmpty    bool
+	}{
+		{
+			name:      "no change",
+			previous:  diffTestScan([]string{"pv-a"}, map[string]int64{"tank": 50}, map[string]bool{"node-1": true}),
+			current:   diffTestScan([]string{"pv-a"}, map[string]int64{"tank": 50}, map[string]bool{"node-1": true}),
+			wantEmpty: true,
+		},
+		{
+			name:     "new orphans and growing pool",
+			previous: diffTestScan([]string{"pv-a"}, map[string]int64{"tank": 70}, nil),
+			current:  diffTestScan([]string{"pv-a", "pv-b"}, map[string]int64{"tank": 85}, nil),
+			wantNew:  []string{"pv-b"},
+			wantCrossed: map[string]string{
+				"tank": ThresholdCrossedAbove,
+			},
+			wantDelta: 15,
+		},
+		{
+			name:         "resolved orphans and shrinking pool",
+			previous:     diffTestScan([]string{"pv-a", "pv-b"}, map[string]int64{"tank": 90, "fast": 10}, nil),
+			current:      diffTestScan([]string{"pv-b"}, map[string]int64{"tank": 60, "fast": 10}, nil),
+			wantResolved: []string{"pv-a"},
+			wantCrossed: map[string]string{
+				"tank": ThresholdCrossedBelow,
+			},
+			wantDelta: -30,
+		},
+		{
+			name:      "partial scan does not resolve orphans",
+			previous:  diffTestScan([]string{"pv-a"}, nil, nil),
+			current:   diffTestScan(nil, nil, nil),
+			partial:   true,
+			wantEmpty: true,
+		},
+		{
+			name:     "CSI pods changed health, appeared and went away",
+			previous: diffTestScan(nil, nil, map[string]bool{"node-1": true, "node-2": true}),
+			current:  diffTestScan(nil, nil, map[string]bool{"node-1": false, "node-3": true}),
+			wantPods: []string{"node-1", "node-2", "node-3"},
+		},
+		{
+			name:      "CSI health not checked in one scan",
+			previous:  diffTestScan(nil, nil, map[string]bool{"node-1": true}),
+			current:   diffTestScan(nil, nil, nil),
+			wantEmpty: true,
+		},
+		{
+			name:     "first scan",
+			previous: nil,
+			current:  diffTestScan([]string{"pv-a"}, map[string]int64{"tank": 50}, nil),
+			wantNew:  []string{"pv-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.current.Partial = tt.partial
+			diff := DiffScans(tt.previous, tt.current)
+
+			assertNames(t, "new orphans", diff.NewOrphans, tt.wantNew)
+			assertNames(t, "resolved orphans", diff.ResolvedOrphans, tt.wantResolved)
+			if diff.ResolvedSkipped != tt.partial {
+				t.Fatalf("ResolvedSkipped = %v, want %v", diff.ResolvedSkipped, tt.partial)
+			}
+
+			if len(diff.PoolThresholds) != len(tt.wantCrossed) {
+				t.Fatalf("pool thresholds = %+v, want %v", diff.PoolThresholds, tt.wantCrossed)
+			}
+			for _, crossing := range diff.PoolThresholds {
+				if tt.wantCrossed[crossing.Pool] != crossing.Direction {
+					t.Fatalf("pool %s crossed %q, want %q", crossing.Pool, crossing.Direction, tt.wantCrossed[crossing.Pool])
+				}
+			}
+
+			if len(diff.CSIPods) != len(tt.wantPods) {
+				t.Fatalf("CSI pod changes = %+v, want %v", diff.CSIPods, tt.wantPods)
+			}
+			for i, change := range diff.CSIPods {
+				if change.Name != tt.wantPods[i] {
+					t.Fatalf("CSI pod change %d = %s, want %s", i, change.Name, tt.wantPods[i])
+				}
+			}
+
+			changes := diff.Changes()
+			if changes.UsedBytesDelta != tt.wantDelta {
+				t.Fatalf("UsedBytesDelta = %d, want %d", changes.UsedBytesDelta, tt.wantDelta)
+			}
+			if diff.Empty() != tt.wantEmpty {
+				t.Fatalf("Empty() = %v, want %v", diff.Empty(), tt.wantEmpty)
+			}
+		})
+	}
+}
+
+func TestDiffScans_CSIPodTransitions(t *testing.T) {
+	previous := diffTestScan(nil, nil, map[string]bool{"node-1": true, "node-2": true})
+	current := diffTestScan(nil, nil, map[string]bool{"node-1": false, "node-3": true})
+
+	diff := DiffScans(previous, current)
+	if len(diff.CSIPods) != 3 {
+		t.Fatalf("expected 3 CSI pod changes, got %+v", diff.CSIPods)
+	}
+	if became := diff.CSIPods[0]; became.Previous == nil || !became.Previous.Ready || became.Current == nil || became.Current.Ready {
+		t.Fatalf("node-1 should go from ready to not ready: %+v", became)
+	}
+	if gone := diff.CSIPods[1]; gone.Previous == nil || gone.Current != nil {
+		t.Fatalf("node-2 should have gone away: %+v", gone)
+	}
+	if added := diff.CSIPods[2]; added.Previous != nil || added.Current == nil {
+		t.Fatalf("node-3 should have appeared: %+v", added)
+	}
+}
+
+func TestDiffScans_ConfigDrift(t *testing.T) {
+	previous := diffTestScan(nil, nil, nil)
+	current := diffTestScan(nil, nil, nil)
+	if diff := DiffScans(previous, current); diff.ConfigDrift != nil {
+		t.Fatalf("scans without a recorded config drifted: %+v", diff.ConfigDrift)
+	}
+
+	previous.Config = &scanconfig.Effective{Hash: "aaaa"}
+	current.Config = &scanconfig.Effective{Hash: "aaaa"}
+	if diff := DiffScans(previous, current); diff.ConfigDrift != nil {
+		t.Fatalf("scans with the same config drifted: %+v", diff.ConfigDrift)
+	}
+
+	current.Config = &scanconfig.Effective{Hash: "bbbb"}
+	diff := DiffScans(previous, current)
+	if diff.ConfigDrift == nil || diff.ConfigDrift.PreviousHash != "aaaa" || diff.ConfigDrift.Hash != "bbbb" {
+		t.Fatalf("config drift = %+v", diff.ConfigDrift)
+	}
+}
+
+func assertNames(t *testing.T, what string, got []OrphanedResource, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %+v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i].Name != want[i] {
+			t.Fatalf("%s[%d] = %s, want %s", what, i, got[i].Name, want[i])
+		}
+	}
+}
+
+func TestService_PerformScan_WritesScanDiff(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	stateFile := filepath.Join(t.TempDir(), "scan.json")
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{Name: "tank/k8s/pv-a"}, {Name: "tank/k8s/pv-b"}},
+		Pools:   []truenas.Pool{{Name: "tank", Size: 100, Used: 70}},
+	}
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{scanTestPV("pv-a", old)}}
+	newService := func() *Service {
+		svc, err := NewService(Config{
+			K8sClient:     k8sClient,
+			TruenasClient: truenasClient,
+			Logger:        logger,
+			ScanInterval:  time.Minute,
+			Clock:         clock.NewFake(now),
+			ScanStateFile: stateFile,
+		})
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+		return svc
+	}
+
+	svc := newService()
+	svc.performScan(context.Background())
+	state, err := ReadScanState(stateFile)
+	if err != nil {
+		t.Fatalf("ReadScanState: %v", err)
+	}
+	if state.Diff != nil || state.Result.Changes != nil {
+		t.Fatalf("first scan should have no diff: %+v", state)
+	}
+	if len(state.Result.Pools) != 1 || state.Result.Pools[0].UtilizationPercent != 70 {
+		t.Fatalf("unexpected pools: %+v", state.Result.Pools)
+	}
+
+	// A restarted monitor diffs its first scan against the persisted one.
+	k8sClient.PersistentVolumes = append(k8sClient.PersistentVolumes, scanTestPV("pv-missing", old))
+	truenasClient.Pools[0].Used = 90
+	svc = newService()
+	svc.performScan(context.Background())
+
+	state, err = ReadScanState(stateFile)
+	if err != nil {
+		t.Fatalf("ReadScanState: %v", err)
+	}
+	if state.Diff == nil || state.Result.Changes == nil {
+		t.Fatalf("second scan should have a diff: %+v", state)
+	}
+	if got := *state.Result.Changes; got.NewOrphans != 1 || got.PoolThresholdCrossings != 1 || got.UsedBytesDelta != 20 {
+		t.Fatalf("unexpected changes: %+v", got)
+	}
+	if svc.GetLastScanDiff() == nil {
+		t.Fatal("expected the service to keep the diff")
+	}
+}
@@ -0,0 +1,291 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+)
+
+// OrphanEventReason is the reason of the Warning Events posted on orphans.
+const OrphanEventReason = "OrphanDetected"
+
+// Defaults of OrphanEventOptions.
+const (
+	DefaultOrphanEventOpsPerSecond = 5
+	DefaultOrphanEventWorkers      = 2
+)
+
+// Results of Kubernetes writes, the result label of truenas_k8s_writes_total.
+const (
+	WritePerformed    = "performed"
+	WriteDeduplicated = "deduplicated"
+	WriteFailed       = "failed"
+	WriteDropped      = "dropped"
+)
+
+// maxEventMessage keeps Event messages well below the apiserver limit.
+const maxEventMessage = 1024
+
+// eventSource is the component and reporting controller of posted Events.
+const eventSource = "truenas-monitor"
+
+// OrphanEventOptions controls the Warning Events posted on orphaned PVs,
+// PVCs and VolumeSnapshots the first time a scan reports them.
+type OrphanEventOptions struct {
+	Enabled bool
+	// OpsPerSecond and Burst size the write token bucket (0 uses
+	// DefaultOrphanEventOpsPerSecond and a burst of OpsPerSecond, at least 1).
+	OpsPerSecond float64
+	Burst        int
+	// Workers is how many goroutines drain the write queue (0 uses
+	// DefaultOrphanEventWorkers).
+	Workers int
+}
+
+// eventObjects maps orphan types to the API version of the involved object.
+// TrueNAS snapshots have no Kubernetes object to attach an Event to.
+var eventObjects = map[string]string{
+	"PersistentVolume":      "v1",
+	"PersistentVolumeClaim": "v1",
+	"VolumeSnapshot":        "snapshot.storage.k8s.io/v1",
+}
+
+// eventWriter posts orphan Events through a token bucket and a small worker
+// pool. Each resource gets at most one queued write however many detection
+// rules matched it; writes still queued at shutdown are dropped.
+type eventWriter struct {
+	client  k8s.Client
+	limiter *rate.Limiter
+	workers int
+	logger  *logging.Logger
+	metrics *metrics.Exporter
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu     sync.Mutex
+	queue  []*queuedEvent
+	queued map[string]*queuedEvent
+	active int
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type queuedEvent struct {
+	key     string
+	event   *corev1.Event
+	reasons []string
+}
+
+func newEventWriter(client k8s.Client, opts OrphanEventOptions, logger *logging.Logger, exporter *metrics.Exporter) *eventWriter {
+	ops := opts.OpsPerSecond
+	if ops <= 0 {
+		ops = DefaultOrphanEventOpsPerSecond
+	}
+	burst := opts.Burst
+	if burst <= 0 {
+		burst = int(ops)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultOrphanEventWorkers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &eventWriter{
+		client:  client,
+		limiter: rate.NewLimiter(rate.Limit(ops), burst),
+		workers: workers,
+		logger:  logger,
+		metrics: exporter,
+		ctx:     ctx,
+		cancel:  cancel,
+		queued:  make(map[string]*queuedEvent),
+	}
+}
+
+// Submit queues one Event per orphan first reported at now and starts
+// workers to drain the queue. It does not wait for the writes.
+func (w *eventWriter) Submit(resources []OrphanedResource, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	queued, deduplicated, dropped := 0, 0, 0
+	for _, resource := range resources {
+		apiVersion, ok := eventObjects[resource.Type]
+		if !ok || !resource.FirstSeen.Equal(now) {
+			continue
+		}
+		if w.closed {
+			dropped++
+			continue
+		}
+		key := strings.Join([]string{resource.Type, resource.Namespace, resource.Name, resource.UID}, "/")
+		if pending, ok := w.queued[key]; ok {
+			pending.reasons = append(pending.reasons, resource.Reason)
+			deduplicated++
+			continue
+		}
+		pending := &queuedEvent{key: key, event: orphanEvent(resource, apiVersion, now), reasons: []string{resource.Reason}}
+		w.queued[key] = pending
+		w.queue = append(w.queue, pending)
+		queued++
+	}
+	w.count(WriteDeduplicated, deduplicated)
+	w.count(WriteDropped, dropped)
+	if queued > 0 {
+		w.logger.Debug("Queued orphan events",
+			zap.Int("queued", queued),
+			zap.Int("deduplicated", deduplicated),
+			zap.Int("pending", len(w.queue)))
+	}
+
+	for w.active < w.workers && w.active < len(w.queue) {
+		w.active++
+		w.wg.Add(1)
+		go w.work()
+	}
+}
+
+func (w *eventWriter) work() {
+	defer w.wg.Done()
+	for {
+		pending := w.next()
+		if pending == nil {
+			return
+		}
+		if err := w.limiter.Wait(w.ctx); err != nil {
+			w.count(WriteDropped, 1)
+			continue
+		}
+		err := w.client.CreateEvent(w.ctx, pending.event)
+		switch {
+		case err == nil:
+			w.count(WritePerformed, 1)
+		case errors.Is(w.ctx.Err(), context.Canceled):
+			w.count(WriteDropped, 1)
+		default:
+			w.count(WriteFailed, 1)
+			w.logger.WithError(err).Warn("Failed to post orphan event",
+				zap.String("object", pending.key))
+		}
+	}
+}
+
+// next pops the oldest queued Event with its merged message, or returns nil
+// and retires the worker when the queue is empty.
+func (w *eventWriter) next() *queuedEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		w.active--
+		return nil
+	}
+	pending := w.queue[0]
+	w.queue[0] = nil
+	w.queue = w.queue[1:]
+	delete(w.queued, pending.key)
+	pending.event.Message = eventMessage(pending.reasons)
+	return pending
+}
+
+// Wait blocks until the queue is drained.
+func (w *eventWriter) Wait() {
+	w.wg.Wait()
+}
+
+// Close stops the workers, counts the writes still queued as dropped and
+// waits for in-flight writes to return.
+func (w *eventWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.cancel()
+	dropped := len(w.queue)
+	w.queue = nil
+	w.queued = make(map[string]*queuedEvent)
+	w.mu.Unlock()
+
+	w.count(WriteDropped, dropped)
+	if dropped > 0 {
+		w.logger.Warn("Dropped orphan events queued at shutdown", zap.Int("dropped", dropped))
+	}
+	w.wg.Wait()
+}
+
+func (w *eventWriter) count(result string, n int) {
+	if w.metrics != nil && n > 0 {
+		w.metrics.AddK8sWrites(result, n)
+	}
+}
+
+// orphanEvent builds the Warning Event for resource. Events of cluster-scoped
+// PVs go to the default namespace, as kubectl describe expects.
+func orphanEvent(resource OrphanedResource, apiVersion string, now time.Time) *corev1.Event {
+	namespace := resource.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	timestamp := metav1.NewTime(now)
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", resource.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       resource.Type,
+			APIVersion: apiVersion,
+			Namespace:  resource.Namespace,
+			Name:       resource.Name,
+			UID:        types.UID(resource.UID),
+		},
+		Reason:              OrphanEventReason,
+		Type:                corev1.EventTypeWarning,
+		Source:              corev1.EventSource{Component: eventSource},
+		ReportingController: eventSource,
+		FirstTimestamp:      timestamp,
+		LastTimestamp:       timestamp,
+		Count:               1,
+	}
+}
+
+// eventMessage joins the distinct reasons of one resource.
+func eventMessage(reasons []string) string {
+	var distinct []string
+	for _, reason := range reasons {
+		if reason != "" {
+			distinct = appendUniqueString(distinct, reason)
+		}
+	}
+	message := strings.Join(distinct, "; ")
+	if len(message) > maxEventMessage {
+		message = message[:maxEventMessage-3] + "..."
+	}
+	return message
+}
+
+func appendUniqueString(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+)
+
+func TestEventWriter_WritesEachNewOrphanOnce(t *testing.T) {
+	k8sClient := &k8stest.Client{}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	writer := newEventWriter(k8sClient, OrphanEventOptions{Enabled: true, OpsPerSecond: 1000}, logging.NewNop(), exporter)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	writer.Submit([]OrphanedResource{
+		{Type: "PersistentVolume", Name: "pv-1", UID: "uid-1", Reason: "no bound claim", FirstSeen: now},
+		{Type: "PersistentVolume", Name: "pv-1", UID: "uid-1", Reason: "dataset missing on TrueNAS", FirstSeen: now},
+		{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data", UID: "uid-2", Reason: "unused", FirstSeen: now},
+		{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "old", UID: "uid-3", Reason: "unused", FirstSeen: now.Add(-time.Hour)},
+		{Type: "TrueNASSnapshot", Name: "tank/k8s/pv-1@auto", Reason: "stale", FirstSeen: now},
+	}, now)
+	writer.Wait()
+
+	events := k8sClient.CreatedEvents()
+	if len(events) != 2 {
+		t.Fatalf("created %d events, want one per new PV and PVC: %+v", len(events), events)
+	}
+	byKind := make(map[string]int)
+	for i, event := range events {
+		byKind[event.InvolvedObject.Kind] = i
+		if event.Type != "Warning" || event.Reason != OrphanEventReason {
+			t.Fatalf("event = %+v", event)
+		}
+	}
+	pv := events[byKind["PersistentVolume"]]
+	if pv.Namespace != "default" || pv.InvolvedObject.UID != "uid-1" ||
+		pv.Message != "no bound claim; dataset missing on TrueNAS" {
+		t.Fatalf("PV event = %+v", pv)
+	}
+	if pvc := events[byKind["PersistentVolumeClaim"]]; pvc.Namespace != "apps" || pvc.InvolvedObject.Name != "data" {
+		t.Fatalf("PVC event = %+v", pvc)
+	}
+	if got := k8sWritesCounter(t, exporter, WritePerformed); got != 2 {
+		t.Fatalf("performed = %v, want 2", got)
+	}
+	if got := k8sWritesCounter(t, exporter, WriteDeduplicated); got != 1 {
+		t.Fatalf("deduplicated = %v, want 1", got)
+	}
+}
+
+func TestEventWriter_CloseDropsQueuedWrites(t *testing.T) {
+	k8sClient := &k8stest.Client{}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	// One token, refilled once an hour: only the first write goes out.
+	writer := newEventWriter(k8sClient, OrphanEventOptions{Enabled: true, OpsPerSecond: 1.0 / 3600, Workers: 1}, logging.NewNop(), exporter)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var orphans []OrphanedResource
+	for _, name := range []string{"a", "b", "c"} {
+		orphans = append(orphans, OrphanedResource{Type: "PersistentVolumeClaim", Namespace: "apps", Name: name, FirstSeen: now})
+	}
+	writer.Submit(orphans, now)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(k8sClient.CreatedEvents()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first event was not written")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	writer.Close()
+	writer.Submit(orphans, now)
+
+	if got := len(k8sClient.CreatedEvents()); got != 1 {
+		t.Fatalf("created %d events, want 1", got)
+	}
+	if got := k8sWritesCounter(t, exporter, WriteDropped); got != 5 {
+		t.Fatalf("dropped = %v, want the 2 queued writes and the 3 submitted after Close", got)
+	}
+}
+
+func k8sWritesCounter(t *testing.T, exporter *metrics.Exporter, result string) float64 {
+	t.Helper()
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "truenas_k8s_writes_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "result" && label.GetValue() == result {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
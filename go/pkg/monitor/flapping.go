@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+)
+
+// PV phase history in the state store: one entry holding every PV.
+const (
+	pvPhasesBucket = "pv_phases"
+	pvPhasesKey    = "history"
+)
+
+// trackPVPhases records the PV phases of a scan at now and returns the
+// transitions since the previous scan and the flapping PVs. phases is nil
+// when the scan could not list the PVs; the history is then left alone.
+// With a state store the history survives restarts, so a PV flapping on a
+// longer cycle than the monitor's uptime is still caught.
+func (s *Service) trackPVPhases(ctx context.Context, phases map[string]string, now time.Time) ([]analysis.PVPhaseTransition, []analysis.FlappingVolume) {
+	if phases == nil {
+		return nil, nil
+	}
+	s.pvPhasesMu.Lock()
+	defer s.pvPhasesMu.Unlock()
+
+	var bucket store.Bucket[map[string]analysis.PVPhaseHistory]
+	if s.stateStore != nil {
+		bucket = store.NewBucket[map[string]analysis.PVPhaseHistory](s.stateStore, pvPhasesBucket)
+	}
+	if !s.pvPhasesLoaded {
+		s.pvPhasesLoaded = true
+		if s.stateStore != nil {
+			history, err := bucket.Get(ctx, pvPhasesKey)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				s.logger.WithError(err).Warn("Failed to load PV phase history; tracking starts afresh")
+			}
+			s.pvPhases = history
+		}
+		if s.pvPhases == nil {
+			s.pvPhases = make(map[string]analysis.PVPhaseHistory)
+		}
+	}
+
+	transitions, flapping := analysis.TrackPVPhases(s.pvPhases, phases, now, s.phaseFlapping)
+	if s.stateStore != nil {
+		if err := bucket.Put(ctx, pvPhasesKey, s.pvPhases); err != nil {
+			s.logger.WithError(err).Warn("Failed to save PV phase history")
+		}
+	}
+	for _, volume := range flapping {
+		s.logger.Warn("PersistentVolume phase is flapping",
+			zap.String("pv", volume.PersistentVolume),
+			zap.String("phase", volume.Phase),
+			zap.Int("transitions", len(volume.Transitions)))
+	}
+	return transitions, flapping
+}
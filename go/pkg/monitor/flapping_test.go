@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestService_PerformScan_TracksPhaseFlappingAcrossRestarts(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	stateStore, err := store.OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer stateStore.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	pv := scanTestPV("pv-flap", now.Add(-72*time.Hour))
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{pv}}
+	newService := func() *Service {
+		svc, err := NewService(Config{
+			K8sClient:     k8sClient,
+			TruenasClient: &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-flap"}}},
+			Logger:        logger,
+			ScanInterval:  time.Minute,
+			Clock:         fakeClock,
+			Store:         stateStore,
+			PhaseFlapping: analysis.PhaseFlappingOptions{Window: time.Hour, MaxTransitions: 1},
+		})
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+		return svc
+	}
+	scan := func(svc *Service, phase corev1.PersistentVolumePhase) *ScanResult {
+		k8sClient.PersistentVolumes[0].Status.Phase = phase
+		fakeClock.Advance(10 * time.Minute)
+		svc.performScan(context.Background())
+		return svc.GetLastScanResult()
+	}
+
+	svc := newService()
+	scan(svc, corev1.VolumeBound)
+	result := scan(svc, corev1.VolumeReleased)
+	if len(result.PhaseTransitions) != 1 || result.PhaseTransitions[0].From != "Bound" || result.PhaseTransitions[0].To != "Released" {
+		t.Fatalf("transitions = %+v, want pv-flap Bound -> Released", result.PhaseTransitions)
+	}
+	if len(result.FlappingVolumes) != 0 {
+		t.Fatalf("flapping after one transition = %+v, want none", result.FlappingVolumes)
+	}
+
+	// A restarted monitor picks the history up from the state store.
+	result = scan(newService(), corev1.VolumeBound)
+	if len(result.FlappingVolumes) != 1 || len(result.FlappingVolumes[0].Transitions) != 2 {
+		t.Fatalf("flapping = %+v, want pv-flap with both transitions", result.FlappingVolumes)
+	}
+}
@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// scanListings holds the inventories listed during one scan, so the orphan
+// detector and the checks after it list each of them once. Failed lists are
+// not kept; the next caller lists again.
+type scanListings struct {
+	pvs             listing[corev1.PersistentVolume]
+	claims          listing[corev1.PersistentVolumeClaim]
+	classes         listing[storagev1.StorageClass]
+	volumeSnapshots listing[snapshotv1.VolumeSnapshot]
+	contents        listing[snapshotv1.VolumeSnapshotContent]
+	volumes         listing[truenas.Volume]
+	snapshots       listing[truenas.Snapshot]
+	pools           listing[truenas.Pool]
+}
+
+type scanListingsKey struct{}
+
+// withScanListings returns ctx carrying new, empty scan listings.
+func withScanListings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scanListingsKey{}, &scanListings{})
+}
+
+func scanListingsFrom(ctx context.Context) *scanListings {
+	listings, _ := ctx.Value(scanListingsKey{}).(*scanListings)
+	return listings
+}
+
+// listing is one memoized list call.
+type listing[T any] struct {
+	mu     sync.Mutex
+	done   bool
+	values []T
+}
+
+// get returns the kept values or calls list and keeps its result. The
+// returned slice has no spare capacity, so a caller appending to it
+// cannot write into another caller's view.
+func (l *listing[T]) get(ctx context.Context, list func(context.Context) ([]T, error)) ([]T, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.done {
+		values, err := list(ctx)
+		if err != nil {
+			return values, err
+		}
+		l.values, l.done = values, true
+	}
+	return l.values[:len(l.values):len(l.values)], nil
+}
+
+// scanK8sClient is a k8s.Client that lists democratic-csi PVs, storage
+// classes, VolumeSnapshotContents and the all-namespace PVCs and
+// VolumeSnapshots once per scan. Outside a scan every call goes to the
+// embedded client.
+type scanK8sClient struct {
+	k8s.Client
+}
+
+func (c scanK8sClient) ListDemocraticCSIPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil {
+		return c.Client.ListDemocraticCSIPersistentVolumes(ctx)
+	}
+	return listings.pvs.get(ctx, c.Client.ListDemocraticCSIPersistentVolumes)
+}
+
+func (c scanK8sClient) ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil || namespace != "" {
+		return c.Client.ListPersistentVolumeClaims(ctx, namespace)
+	}
+	return listings.claims.get(ctx, func(ctx context.Context) ([]corev1.PersistentVolumeClaim, error) {
+		return c.Client.ListPersistentVolumeClaims(ctx, "")
+	})
+}
+
+func (c scanK8sClient) ListVolumeSnapshots(ctx context.Context, namespace string) ([]snapshotv1.VolumeSnapshot, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil || namespace != "" {
+		return c.Client.ListVolumeSnapshots(ctx, namespace)
+	}
+	return listings.volumeSnapshots.get(ctx, func(ctx context.Context) ([]snapshotv1.VolumeSnapshot, error) {
+		return c.Client.ListVolumeSnapshots(ctx, "")
+	})
+}
+
+func (c scanK8sClient) ListVolumeSnapshotContents(ctx context.Context) ([]snapshotv1.VolumeSnapshotContent, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil {
+		return c.Client.ListVolumeSnapshotContents(ctx)
+	}
+	return listings.contents.get(ctx, c.Client.ListVolumeSnapshotContents)
+}
+
+func (c scanK8sClient) ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil {
+		return c.Client.ListStorageClasses(ctx)
+	}
+	return listings.classes.get(ctx, c.Client.ListStorageClasses)
+}
+
+// scanTrueNASClient is a truenas.Client that lists volumes, snapshots and
+// pools once per scan. Outside a scan every call goes to the embedded
+// client.
+type scanTrueNASClient struct {
+	truenas.Client
+}
+
+func (c scanTrueNASClient) ListVolumes(ctx context.Context) ([]truenas.Volume, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil {
+		return c.Client.ListVolumes(ctx)
+	}
+	return listings.volumes.get(ctx, c.Client.ListVolumes)
+}
+
+func (c scanTrueNASClient) ListSnapshots(ctx context.Context) ([]truenas.Snapshot, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil {
+		return c.Client.ListSnapshots(ctx)
+	}
+	return listings.snapshots.get(ctx, c.Client.ListSnapshots)
+}
+
+func (c scanTrueNASClient) ListPools(ctx context.Context) ([]truenas.Pool, error) {
+	listings := scanListingsFrom(ctx)
+	if listings == nil {
+		return c.Client.ListPools(ctx)
+	}
+	return listings.pools.get(ctx, c.Client.ListPools)
+}
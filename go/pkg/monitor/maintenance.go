@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// DefaultMaintenanceGrace is how long TrueNAS may be unavailable before scans
+// are treated as failing when Config.MaintenanceGrace is zero.
+const DefaultMaintenanceGrace = 5 * time.Minute
+
+// Alert categories for TrueNAS availability.
+const (
+	// AlertCategoryBackendMaintenance is the one-off info event sent when
+	// TrueNAS becomes temporarily unavailable.
+	AlertCategoryBackendMaintenance = "truenas_maintenance"
+	// AlertCategoryBackendUnavailable is raised once TrueNAS stays
+	// unavailable past the maintenance grace window.
+	AlertCategoryBackendUnavailable = "truenas_unavailable"
+)
+
+// backendState tracks a TrueNAS maintenance window (503 responses or refused
+// connections, e.g. during an HA failover). It is guarded by Service.mu.
+type backendState struct {
+	degradedSince time.Time
+	backoffUntil  time.Time
+	alerted       bool
+}
+
+// inMaintenanceBackoff reports whether scans are paused for a maintenance window.
+func (s *Service) inMaintenanceBackoff(now time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return now.Before(s.backend.backoffUntil)
+}
+
+// handleBackendUnavailable handles a failed scan. It returns true when err
+// means TrueNAS is in maintenance and the grace window has not expired: the
+// last result is marked stale, scans back off for the rest of the window and
+// a single info event is sent. After the window, a critical
+// AlertCategoryBackendUnavailable alert is raised and false is returned.
+func (s *Service) handleBackendUnavailable(ctx context.Context, err error, now time.Time) bool {
+	retryAfter, ok := truenas.IsUnavailable(err)
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	started := s.backend.degradedSince.IsZero()
+	if started {
+		s.backend.degradedSince = now
+	}
+	degradedSince := s.backend.degradedSince
+	windowEnd := degradedSince.Add(s.maintenanceGrace)
+	inGrace := now.Before(windowEnd)
+	if inGrace {
+		s.backend.backoffUntil = windowEnd
+		if retryAfter > 0 && now.Add(retryAfter).Before(windowEnd) {
+			s.backend.backoffUntil = now.Add(retryAfter)
+		}
+	}
+	if s.lastScanResult != nil && !s.lastScanResult.Stale {
+		stale := *s.lastScanResult
+		stale.Stale = true
+		s.lastScanResult = &stale
+	}
+	raise := !inGrace && !s.backend.alerted
+	if raise {
+		s.backend.alerted = true
+	}
+	backoffUntil := s.backend.backoffUntil
+	s.mu.Unlock()
+
+	if started {
+		s.logger.Info("TrueNAS temporarily unavailable, backing off scans",
+			zap.Time("backoff_until", backoffUntil),
+			zap.Duration("grace", s.maintenanceGrace),
+			logging.RedactedError(err))
+		s.dispatchAlert(ctx, alerts.Alert{
+			Source:    alerts.SourceMonitor,
+			Level:     alerts.LevelInfo,
+			Category:  AlertCategoryBackendMaintenance,
+			Resource:  "truenas",
+			Message:   "TrueNAS temporarily unavailable; scans paused and last-known data served as stale",
+			Timestamp: now,
+		})
+	}
+	if inGrace {
+		return true
+	}
+
+	if raise {
+		s.reconcileAlerts(ctx, []alerts.Alert{{
+			Source:    alerts.SourceMonitor,
+			Level:     alerts.LevelCritical,
+			Category:  AlertCategoryBackendUnavailable,
+			Resource:  "truenas",
+			Message:   "TrueNAS unavailable for " + humanize.Duration(now.Sub(degradedSince)),
+			Timestamp: now,
+		}}, []string{AlertCategoryBackendUnavailable}, now)
+	}
+	return false
+}
+
+// backendRecovered ends a maintenance window after a successful scan and
+// records its duration.
+func (s *Service) backendRecovered(now time.Time) {
+	s.mu.Lock()
+	degradedSince := s.backend.degradedSince
+	s.backend = backendState{}
+	s.mu.Unlock()
+
+	if degradedSince.IsZero() {
+		return
+	}
+	degraded := now.Sub(degradedSince)
+	s.logger.Info("TrueNAS available again", zap.Duration("degraded", degraded))
+	if s.metricsExporter != nil {
+		s.metricsExporter.ObserveBackendDegraded(degraded.Seconds())
+	}
+}
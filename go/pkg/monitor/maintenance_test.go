@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestService_PerformScan_BacksOffDuringTrueNASMaintenance(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	var delivered []alerts.Alert
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: alerts.NewRouter(alerts.RouterConfig{
+			Default: alerts.Route{Destinations: []alerts.Destination{{Type: alerts.DestinationWebhook, URL: "http://hooks"}}},
+			Clock:   fake,
+		}),
+		Senders: map[string]alerts.Sender{alerts.DestinationWebhook: alerts.SenderFunc(
+			func(_ context.Context, _ alerts.Destination, alert alerts.Alert) error {
+				delivered = append(delivered, alert)
+				return nil
+			})},
+		Logger: logger,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	store, err := alerts.NewStore(alerts.StoreConfig{Clock: fake})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	truenasClient := &truenastest.Client{}
+
+	svc, err := NewService(Config{
+		K8sClient:        &k8stest.Client{},
+		TruenasClient:    truenasClient,
+		MetricsExporter:  exporter,
+		Logger:           logger,
+		ScanInterval:     time.Minute,
+		Clock:            fake,
+		AlertDispatcher:  dispatcher,
+		AlertStore:       store,
+		MaintenanceGrace: 3 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	if svc.GetLastScanResult() == nil {
+		t.Fatal("expected an initial scan result")
+	}
+
+	// Failover starts: the last result is kept as stale and one info event is sent.
+	truenasClient.ListVolumesErr = &truenas.UnavailableError{StatusCode: 503}
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if result := svc.GetLastScanResult(); result == nil || !result.Stale {
+		t.Fatalf("expected last-known result marked stale, got %+v", result)
+	}
+	if len(delivered) != 1 || delivered[0].Level != alerts.LevelInfo || delivered[0].Category != AlertCategoryBackendMaintenance {
+		t.Fatalf("expected one maintenance info event, got %+v", delivered)
+	}
+
+	// Scans are skipped for the rest of the grace window.
+	calls := truenasClient.Calls("ListVolumes")
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if truenasClient.Calls("ListVolumes") != calls {
+		t.Fatal("scan ran during the maintenance backoff")
+	}
+	if list, _ := store.List(); len(list) != 0 {
+		t.Fatalf("alerts raised during the grace window: %+v", list)
+	}
+
+	// Still unavailable after the window: a critical alert is raised.
+	fake.Advance(2 * time.Minute)
+	svc.performScan(context.Background())
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Category != AlertCategoryBackendUnavailable || list[0].Level != alerts.LevelCritical {
+		t.Fatalf("expected a critical unavailable alert, got %+v", list)
+	}
+
+	// Recovery resolves the alert and records the degraded duration.
+	truenasClient.ListVolumesErr = nil
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+	if list, _ = store.List(); len(list) != 0 {
+		t.Fatalf("expected unavailable alert resolved, got %+v", list)
+	}
+	if result := svc.GetLastScanResult(); result.Stale {
+		t.Fatal("fresh scan result still marked stale")
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "truenas_backend_degraded_seconds" {
+			continue
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.GetSampleCount() != 1 || histogram.GetSampleSum() != 240 {
+			t.Fatalf("degraded histogram count=%d sum=%v, want 1 observation of 240s", histogram.GetSampleCount(), histogram.GetSampleSum())
+		}
+		return
+	}
+	t.Fatal("truenas_backend_degraded_seconds not exported")
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// Monitor scan phases following orphan detection.
+const (
+	PhaseCSIHealth         = "csi_health"
+	PhaseSnapshotSchedules = "snapshot_schedules"
+	PhaseNFSMounts         = "nfs_mounts"
+	PhaseISCSISessions     = "iscsi_sessions"
+	PhaseAttachments       = "volume_attachments"
+	PhaseZFSReadiness      = "zfs_readiness"
+	PhaseTrueNASScope      = "truenas_scope"
+	PhaseVolumeIO          = "volume_io"
+	PhaseTrueNASPools      = "truenas_pools"
+	PhaseSnapshotAges      = "snapshot_ages"
+	PhaseProvisioning      = "provisioning_latency"
+	PhaseAbandonedDatasets = "abandoned_datasets"
+	PhaseBackupCoverage    = "backup_coverage"
+	PhaseMetricsUpdate     = "metrics_update"
+)
+
+// PhaseStats is the duration of one scan phase, the number of objects it
+// listed, correlated or checked and the requests it sent to each backend.
+// Orphan detection phases also report the approximate heap bytes they
+// allocated.
+type PhaseStats struct {
+	Duration   time.Duration    `json:"duration"`
+	Items      int              `json:"items"`
+	AllocBytes uint64           `json:"alloc_bytes,omitempty"`
+	Requests   map[string]int64 `json:"requests,omitempty"`
+}
+
+// detectionPhases converts the orphan detection phase timings and counts.
+func detectionPhases(result *orphan.DetectionResult) map[string]PhaseStats {
+	phases := make(map[string]PhaseStats, len(result.PhaseTimings)+8)
+	for phase, duration := range result.PhaseTimings {
+		phases[phase] = PhaseStats{
+			Duration:   duration,
+			Items:      result.PhaseItems[phase],
+			AllocBytes: result.PhaseAllocBytes[phase],
+			Requests:   result.PhaseRequests[phase],
+		}
+	}
+	return phases
+}
+
+// timePhase runs fn in a span of the scan trace and records its duration,
+// the item count it returns and the backend requests it sent.
+func timePhase(ctx context.Context, phases map[string]PhaseStats, phase string, fn func(ctx context.Context) int) {
+	ctx, span := tracing.Start(ctx, "scan."+phase)
+	ctx, requests := apiusage.NewContext(ctx)
+	start := time.Now()
+	items := fn(ctx)
+	stats := PhaseStats{Duration: time.Since(start), Items: items}
+	if counts := requests.Counts(); len(counts) > 0 {
+		stats.Requests = counts
+	}
+	phases[phase] = stats
+	span.SetAttributes(tracing.Int("items", items))
+	span.End()
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoScanState is returned by ReadScanState before the first scan was
+// written.
+var ErrNoScanState = errors.New("no scan recorded yet")
+
+// ScanState is the latest scan result and its diff against the scan before,
+// as persisted to the scan state file for the API server.
+type ScanState struct {
+	Result *ScanResult `json:"result"`
+	// Diff is nil after the first scan.
+	Diff *ScanDiff `json:"diff,omitempty"`
+}
+
+// ReadScanState reads a scan state file written by the monitor.
+func ReadScanState(path string) (*ScanState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoScanState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan state: %w", err)
+	}
+	var state ScanState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse scan state %s: %w", path, err)
+	}
+	if state.Result == nil {
+		return nil, ErrNoScanState
+	}
+	return &state, nil
+}
+
+// writeScanState writes the state atomically through a temporary file.
+func writeScanState(path string, state ScanState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scan state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".scan-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write scan state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write scan state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write scan state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write scan state: %w", err)
+	}
+	return nil
+}
@@ -2,36 +2,104 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/canary"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scheduler"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
 )
 
 // Service represents the monitoring service
 type Service struct {
-	k8sClient       k8s.Client
-	truenasClient   truenas.Client
-	metricsExporter *metrics.Exporter
-	logger          *logging.Logger
-	scanInterval    time.Duration
-	orphanDetector  *orphan.Detector
-	
+	k8sClient         k8s.Client
+	truenasClient     truenas.Client
+	metricsExporter   *metrics.Exporter
+	logger            *logging.Logger
+	scanInterval      time.Duration
+	startupJitter     float64
+	orphanDetector    *orphan.Detector
+	snapshotSchedules []analysis.SchedulePolicy
+	snapshotCache     *truenas.IncrementalSnapshotClient
+	nfsChecker        *analysis.NFSMountChecker
+	iscsiSessions     analysis.ISCSISessionOptions
+	ioStats           analysis.IOStatsOptions
+	ioStatsTopN       int
+	snapshotAges      bool
+	ageBuckets        []time.Duration
+	provisioning      bool
+	provisioningWin   time.Duration
+	alertDispatcher   *alerts.Dispatcher
+	alertStore        *alerts.Store
+	truenasAlerts     bool
+	forwardTrueNAS    bool
+	maintenanceGrace  time.Duration
+	scanStateFile     string
+	tracer            *tracing.Tracer
+	reportScheduler   *scheduler.Scheduler
+	stateStore        store.Store
+	events            *eventWriter
+	inventoryDrift    InventoryDriftThresholds
+	scope             analysis.ScopeOptions
+	restoreCanary     RestoreCanaryOptions
+	orphanGroupWindow time.Duration
+	phaseFlapping     analysis.PhaseFlappingOptions
+	abandoned         AbandonedDatasetOptions
+	backupCoverage    analysis.BackupCoverageOptions
+	scanConfig        *scanconfig.Effective
+	requestBudget     map[string]int64
+	clock             clock.Clock
+
 	// Internal state
 	mu             sync.RWMutex
 	running        bool
 	stopChan       chan struct{}
 	wg             sync.WaitGroup
 	lastScanResult *ScanResult
+	lastScanDiff   *ScanDiff
+	lastCanary     *canary.Result
+	// restoredScan is the result read from the scan state file at startup,
+	// used as the baseline of the first diff.
+	restoredScan *ScanResult
+	backend      backendState
+	// orphanFirstSeen maps orphan identity keys (see orphan.OrphanedResource.Key)
+	// to the scan time each orphan was first reported.
+	orphanFirstSeen map[string]time.Time
+	// provisioningObserved maps the UIDs of PVCs already recorded in the
+	// provisioning histogram to their bind time, so each PVC is observed
+	// once while it stays in the window.
+	provisioningObserved map[string]time.Time
+	// loop is the scan loop watchdog state (see watchdog.go).
+	loop scanLoop
+	// pvPhases is the phase history of each PV (see flapping.go), loaded
+	// from the state store before the first scan when one is configured.
+	pvPhasesMu     sync.Mutex
+	pvPhases       map[string]analysis.PVPhaseHistory
+	pvPhasesLoaded bool
 }
 
+// DefaultIOStatsTopN is how many of the busiest datasets get throughput
+// gauges.
+const DefaultIOStatsTopN = 20
+
 // Config holds the service configuration
 type Config struct {
 	K8sClient         k8s.Client
@@ -41,6 +109,108 @@ type Config struct {
 	ScanInterval      time.Duration
 	OrphanThreshold   time.Duration
 	SnapshotRetention time.Duration
+	// OrphanThresholds override OrphanThreshold and SnapshotRetention per
+	// resource type.
+	OrphanThresholds orphan.AgeThresholds
+	// StartupJitter delays the first scan by a random fraction (0-1) of
+	// ScanInterval so fleets sharing one TrueNAS do not scan in lockstep.
+	StartupJitter float64
+	PhaseTimeouts orphan.PhaseTimeouts
+	// Exclusions leaves intentionally detached resources out of orphan reports.
+	Exclusions orphan.Exclusions
+	// StrictSnapshots also reports TrueNAS snapshots managed by periodic
+	// snapshot and replication tasks as orphans.
+	StrictSnapshots bool
+	// OrphanGroupWindow is the creation window of orphan groups (0 =
+	// orphan.DefaultGroupWindow); orphan alerts fire per group.
+	OrphanGroupWindow time.Duration
+	// ScanConfig is recorded in every scan result, so diffs can flag scans
+	// produced under different settings; nil records none.
+	ScanConfig *scanconfig.Effective
+	// RequestBudget is the number of requests one scan may send to each
+	// backend (apiusage.BackendKubernetes, apiusage.BackendTrueNAS) before
+	// a warning is logged; a missing or zero budget is unlimited.
+	RequestBudget map[string]int64
+	// Clock drives resource age checks. Nil uses the real clock.
+	Clock clock.Clock
+	// SnapshotSchedules are checked on every scan when non-empty.
+	SnapshotSchedules []analysis.SchedulePolicy
+	// IncrementalSnapshots makes the detector list only TrueNAS snapshots
+	// created since the previous scan, re-listing fully every
+	// SnapshotFullRelistEvery scans (0 uses truenas.DefaultFullRelistEvery).
+	IncrementalSnapshots    bool
+	SnapshotFullRelistEvery int
+	// NamespacePriority limits VolumeSnapshot correlation to the most
+	// active namespaces and a rotating share of the rest.
+	NamespacePriority orphan.NamespacePriority
+	// NFSDeepCheck verifies on every scan that the share path of a sample of
+	// NFS-backed PVs is a dataset mountpoint exported by an enabled NFS share.
+	// NFSDeepCheckSampleRate is the sampled fraction (0 checks every PV).
+	NFSDeepCheck           bool
+	NFSDeepCheckSampleRate float64
+	// ISCSISessions correlates attached iSCSI PVs with TrueNAS iSCSI
+	// sessions and initiator groups on every scan when enabled.
+	ISCSISessions analysis.ISCSISessionOptions
+	// AlertDispatcher routes scan findings to notification destinations.
+	// Nil disables notifications.
+	AlertDispatcher *alerts.Dispatcher
+	// AlertStore tracks active alerts across scans. Nil uses an in-memory store.
+	AlertStore *alerts.Store
+	// TrueNASAlerts adds undismissed TrueNAS alerts to the alert store.
+	// ForwardTrueNASAlerts also routes them to notification destinations.
+	TrueNASAlerts        bool
+	ForwardTrueNASAlerts bool
+	// MaintenanceGrace is how long TrueNAS may answer 503 or refuse
+	// connections before scans count as failed. Zero uses
+	// DefaultMaintenanceGrace.
+	MaintenanceGrace time.Duration
+	// IOStats classifies PV datasets as hot, warm or cold on every scan and
+	// exports the throughput of the IOStatsTopN busiest ones (0 uses
+	// DefaultIOStatsTopN).
+	IOStats     analysis.IOStatsOptions
+	IOStatsTopN int
+	// SnapshotAges exports TrueNAS snapshot counts per age bucket on every
+	// scan. SnapshotAgeBuckets are the ascending bucket bounds (nil uses
+	// analysis.DefaultSnapshotAgeBuckets).
+	SnapshotAges       bool
+	SnapshotAgeBuckets []time.Duration
+	// ProvisioningLatency measures how long the PVCs bound within
+	// ProvisioningWindow took to provision (0 uses
+	// analysis.DefaultProvisioningWindow) and exports a histogram.
+	ProvisioningLatency bool
+	ProvisioningWindow  time.Duration
+	// ScanStateFile persists the latest scan result and its diff against
+	// the previous scan for GET /api/v1/scan/diff. Empty disables it.
+	ScanStateFile string
+	// Tracer records a trace per scan with a span per phase. Nil disables
+	// tracing.
+	Tracer *tracing.Tracer
+	// ReportScheduler runs scheduled reports alongside the scans. Nil
+	// disables them.
+	ReportScheduler *scheduler.Scheduler
+	// Store is the persistent state store; ReadyHandler fails while it is
+	// unavailable. Nil when not configured.
+	Store store.Store
+	// OrphanEvents posts a rate-limited Warning Event on each newly
+	// detected orphan when enabled.
+	OrphanEvents OrphanEventOptions
+	// InventoryDrift raises an alert when the Kubernetes and TrueNAS
+	// inventories drift apart by more than the thresholds.
+	InventoryDrift InventoryDriftThresholds
+	// Scope is the configured TrueNAS pool and parent dataset, re-checked
+	// on every scan when set so a renamed pool is noticed.
+	Scope analysis.ScopeOptions
+	// RestoreCanary periodically snapshots, clones, verifies and destroys a
+	// test dataset when enabled.
+	RestoreCanary RestoreCanaryOptions
+	// PhaseFlapping flags PVs whose phase changes too often across scans.
+	PhaseFlapping analysis.PhaseFlappingOptions
+	// AbandonedDatasets reports the managed datasets without a PV whose
+	// space is held by old snapshots when enabled.
+	AbandonedDatasets AbandonedDatasetOptions
+	// BackupCoverage checks that the PVCs its policies select have a
+	// recent VolumeSnapshot when it has policies.
+	BackupCoverage analysis.BackupCoverageOptions
 }
 
 // OrphanedResource represents an orphaned resource
@@ -48,22 +218,124 @@ type OrphanedResource struct {
 	Type        string            `json:"type"`
 	Name        string            `json:"name"`
 	Namespace   string            `json:"namespace,omitempty"`
+	UID         string            `json:"uid,omitempty"`
 	Age         time.Duration     `json:"age"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	Annotations map[string]string `json:"annotations,omitempty"`
 	Reason      string            `json:"reason"`
+	Details     map[string]string `json:"details,omitempty"`
+	FirstSeen   time.Time         `json:"first_seen"`
+	// SizeBytes is the used bytes of a TrueNAS volume or snapshot; 0 when
+	// unknown.
+	SizeBytes int64 `json:"size_bytes,omitempty"`
 }
 
 // ScanResult represents the result of a monitoring scan
 type ScanResult struct {
-	Timestamp        time.Time           `json:"timestamp"`
-	OrphanedPVs      []OrphanedResource  `json:"orphaned_pvs"`
-	OrphanedPVCs     []OrphanedResource  `json:"orphaned_pvcs"`
+	Timestamp         time.Time          `json:"timestamp"`
+	OrphanedPVs       []OrphanedResource `json:"orphaned_pvs"`
+	OrphanedPVCs      []OrphanedResource `json:"orphaned_pvcs"`
 	OrphanedSnapshots []OrphanedResource `json:"orphaned_snapshots"`
-	TotalPVs         int                 `json:"total_pvs"`
-	TotalPVCs        int                 `json:"total_pvcs"`
-	TotalSnapshots   int                 `json:"total_snapshots"`
-	ScanDuration     time.Duration       `json:"scan_duration"`
+	// OrphanedTrueNASVolumes are managed datasets no PV references.
+	OrphanedTrueNASVolumes []OrphanedResource `json:"orphaned_truenas_volumes"`
+	TotalPVs               int                `json:"total_pvs"`
+	TotalPVCs              int                `json:"total_pvcs"`
+	// TotalSnapshots is deprecated; it is TotalK8sSnapshots + TotalTrueNASSnapshots.
+	TotalSnapshots           int                      `json:"total_snapshots"`
+	TotalK8sSnapshots        int                      `json:"total_k8s_snapshots"`
+	TotalTrueNASSnapshots    int                      `json:"total_truenas_snapshots"`
+	OrphanedK8sSnapshots     int                      `json:"orphaned_k8s_snapshots"`
+	OrphanedTrueNASSnapshots int                      `json:"orphaned_truenas_snapshots"`
+	ManagedByTrueNAS         int                      `json:"managed_by_truenas"`
+	ScanDuration             time.Duration            `json:"scan_duration"`
+	Partial                  bool                     `json:"partial"`
+	PhaseErrors              map[string]string        `json:"phase_errors,omitempty"`
+	CSIHealth                *k8s.CSIDriverHealth     `json:"csi_health,omitempty"`
+	SnapshotSchedule         *analysis.ScheduleReport `json:"snapshot_schedule,omitempty"`
+	NFSMounts                *analysis.NFSMountReport `json:"nfs_mounts,omitempty"`
+	// ISCSISessions reports nodes without iSCSI sessions and disallowed
+	// initiators when the iSCSI session check is enabled.
+	ISCSISessions *analysis.ISCSISessionReport `json:"iscsi_sessions,omitempty"`
+	// UnreadableNamespaces are the namespaces the scan could not list for
+	// lack of permission, and NamespaceCoveragePercent the percentage of
+	// namespaces it listed in full; both are empty when it read them all.
+	UnreadableNamespaces     []orphan.UnreadableNamespace `json:"unreadable_namespaces,omitempty"`
+	NamespaceCoveragePercent *float64                     `json:"namespace_coverage_percent,omitempty"`
+	// StuckResources lists resources that keep volumes from attaching;
+	// nil when the check failed.
+	StuckResources *StuckResources `json:"stuck_resources,omitempty"`
+	// PhaseTransitions are the PV phase changes since the previous scan.
+	// FlappingVolumes are the PVs that changed phase more often than
+	// monitor.phase_flapping allows, with their recent transitions.
+	PhaseTransitions []analysis.PVPhaseTransition `json:"phase_transitions,omitempty"`
+	FlappingVolumes  []analysis.FlappingVolume    `json:"flapping_volumes,omitempty"`
+	// ZFSReadiness reports locked or read-only parent datasets and unhealthy
+	// pools; nil when the check failed.
+	ZFSReadiness *analysis.ZFSReadinessReport `json:"zfs_readiness,omitempty"`
+	// Stale marks a result kept from before TrueNAS became unavailable.
+	Stale bool `json:"stale,omitempty"`
+	// DuplicateVolumeHandles lists handles shared by several PVs (critical).
+	DuplicateVolumeHandles []orphan.DuplicateVolumeHandle `json:"duplicate_volume_handles,omitempty"`
+	// CorrelationUnknown lists PVs whose volume handle does not parse; they
+	// are never reported as orphaned.
+	CorrelationUnknown []orphan.OrphanedResource `json:"correlation_unknown,omitempty"`
+	// ExportMissing lists NFS PVs whose dataset exists but is not exported;
+	// ExportsChecked is false when the check did not run.
+	ExportMissing  []orphan.ExportIssue `json:"export_missing,omitempty"`
+	ExportsChecked bool                 `json:"exports_checked,omitempty"`
+	// Excluded counts orphans matched by the configured exclusion rules.
+	Excluded int `json:"excluded"`
+	// VolumeTemperatures counts PV datasets per I/O temperature when I/O
+	// statistics are enabled.
+	VolumeTemperatures map[string]int `json:"volume_temperatures,omitempty"`
+	// Pools is TrueNAS pool usage at scan time; nil when listing failed.
+	Pools []analysis.PoolUsage `json:"pools,omitempty"`
+	// StorageEfficiency compares used and requested PV capacity; nil when
+	// PV correlation did not complete.
+	StorageEfficiency *analysis.StorageEfficiency `json:"storage_efficiency,omitempty"`
+	// SnapshotAges counts TrueNAS snapshots per age bucket when snapshot
+	// age metrics are enabled.
+	SnapshotAges []analysis.SnapshotAgeCount `json:"snapshot_ages,omitempty"`
+	// ProvisioningLatency holds p50/p95 provisioning durations of the PVCs
+	// bound within the window when provisioning latency is enabled.
+	ProvisioningLatency *analysis.ProvisioningReport `json:"provisioning_latency,omitempty"`
+	// AbandonedDatasets lists the largest abandoned datasets when the check
+	// is enabled; its totals cover all of them.
+	AbandonedDatasets *analysis.AbandonedDatasetReport `json:"abandoned_datasets,omitempty"`
+	// BackupCoverage holds the per-namespace VolumeSnapshot coverage when
+	// backup coverage policies are configured.
+	BackupCoverage *analysis.BackupCoverageReport `json:"backup_coverage,omitempty"`
+	// Changes summarizes the diff against the previous scan; nil on the
+	// first scan.
+	Changes *ScanChanges `json:"changes,omitempty"`
+	// Config is the configuration the scan ran under.
+	Config *scanconfig.Effective `json:"config,omitempty"`
+	// Phases holds the duration and item count of each detection phase and
+	// of the monitor's checks.
+	Phases map[string]PhaseStats `json:"phases,omitempty"`
+	// BackendRequests counts the requests the scan sent to each backend,
+	// retries and list pages included, up to the metrics update.
+	BackendRequests map[string]int64 `json:"backend_requests,omitempty"`
+	// Inventory counts democratic-csi PVs and managed TrueNAS volumes and the
+	// unmatched ones on each side, from the PV correlation index; nil when
+	// PV correlation did not complete.
+	Inventory *orphan.InventoryCounts `json:"inventory,omitempty"`
+	// StorageClasses breaks democratic-csi PVs and their orphans down by
+	// StorageClass, most wasted bytes first; nil when PV correlation did not
+	// complete.
+	StorageClasses []orphan.StorageClassUsage `json:"storage_classes,omitempty"`
+	// Scope reports whether the configured pool and parent dataset exist;
+	// nil when none is configured or the check failed.
+	Scope *analysis.ScopeReport `json:"scope,omitempty"`
+	// Degraded marks a scan of a configured pool or parent dataset that
+	// does not exist, whose results cover the wrong scope.
+	Degraded bool `json:"degraded,omitempty"`
+	// OrphanGroups clusters the orphans by probable root cause; orphan
+	// alerts are raised per group.
+	OrphanGroups []orphan.Group `json:"orphan_groups,omitempty"`
+	// SnapshotCorrelatedAt is when the VolumeSnapshots of each namespace
+	// were last correlated, with namespace prioritization.
+	SnapshotCorrelatedAt map[string]time.Time `json:"snapshot_correlated_at,omitempty"`
 }
 
 // NewService creates a new monitoring service
@@ -77,28 +349,124 @@ func NewService(config Config) (*Service, error) {
 		snapshotRetention = 30 * 24 * time.Hour
 	}
 
+	// The detector and the checks after it share each scan's inventories
+	k8sClient := scanK8sClient{Client: config.K8sClient}
+	truenasClient := scanTrueNASClient{Client: config.TruenasClient}
+	detectorTruenasClient := truenasClient
+	var snapshotCache *truenas.IncrementalSnapshotClient
+	if config.IncrementalSnapshots {
+		snapshotCache = truenas.NewIncrementalSnapshotClient(config.TruenasClient, truenas.IncrementalOptions{
+			FullRelistEvery: config.SnapshotFullRelistEvery,
+			Clock:           config.Clock,
+		})
+		detectorTruenasClient = scanTrueNASClient{Client: snapshotCache}
+	}
+
 	// Initialize orphan detector
 	orphanDetector, err := orphan.NewDetector(
-		config.K8sClient,
-		config.TruenasClient,
+		k8sClient,
+		detectorTruenasClient,
 		orphan.Config{
 			AgeThreshold:      orphanThreshold,
 			SnapshotRetention: snapshotRetention,
+			Thresholds:        config.OrphanThresholds,
 			DryRun:            false,
+			PhaseTimeouts:     config.PhaseTimeouts,
+			Exclusions:        config.Exclusions,
+			StrictSnapshots:   config.StrictSnapshots,
+			NamespacePriority: config.NamespacePriority,
+			Clock:             config.Clock,
+			Logger:            config.Logger,
 		},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create orphan detector: %w", err)
 	}
 
+	maintenanceGrace := config.MaintenanceGrace
+	if maintenanceGrace == 0 {
+		maintenanceGrace = DefaultMaintenanceGrace
+	}
+
+	provisioningWindow := config.ProvisioningWindow
+	if provisioningWindow == 0 {
+		provisioningWindow = analysis.DefaultProvisioningWindow
+	}
+
+	var nfsChecker *analysis.NFSMountChecker
+	if config.NFSDeepCheck {
+		nfsChecker = analysis.NewNFSMountChecker(config.TruenasClient, config.NFSDeepCheckSampleRate)
+	}
+
+	alertStore := config.AlertStore
+	if alertStore == nil {
+		alertStore, err = alerts.NewStore(alerts.StoreConfig{Clock: config.Clock})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create alert store: %w", err)
+		}
+	}
+
+	ioStatsTopN := config.IOStatsTopN
+	if ioStatsTopN <= 0 {
+		ioStatsTopN = DefaultIOStatsTopN
+	}
+
+	var restoredScan *ScanResult
+	if config.ScanStateFile != "" {
+		state, err := ReadScanState(config.ScanStateFile)
+		switch {
+		case err == nil:
+			restoredScan = state.Result
+		case !errors.Is(err, ErrNoScanState) && config.Logger != nil:
+			config.Logger.WithError(err).Warn("Ignoring unreadable scan state file")
+		}
+	}
+
+	var events *eventWriter
+	if config.OrphanEvents.Enabled && config.K8sClient != nil {
+		events = newEventWriter(config.K8sClient, config.OrphanEvents, config.Logger, config.MetricsExporter)
+	}
+
 	return &Service{
-		k8sClient:       config.K8sClient,
-		truenasClient:   config.TruenasClient,
-		metricsExporter: config.MetricsExporter,
-		logger:          config.Logger,
-		scanInterval:    config.ScanInterval,
-		orphanDetector:  orphanDetector,
-		stopChan:        make(chan struct{}),
+		k8sClient:         k8sClient,
+		truenasClient:     truenasClient,
+		metricsExporter:   config.MetricsExporter,
+		logger:            config.Logger,
+		scanInterval:      config.ScanInterval,
+		startupJitter:     config.StartupJitter,
+		orphanDetector:    orphanDetector,
+		snapshotSchedules: config.SnapshotSchedules,
+		snapshotCache:     snapshotCache,
+		nfsChecker:        nfsChecker,
+		iscsiSessions:     config.ISCSISessions,
+		ioStats:           config.IOStats,
+		ioStatsTopN:       ioStatsTopN,
+		snapshotAges:      config.SnapshotAges,
+		ageBuckets:        config.SnapshotAgeBuckets,
+		provisioning:      config.ProvisioningLatency,
+		provisioningWin:   provisioningWindow,
+		alertDispatcher:   config.AlertDispatcher,
+		alertStore:        alertStore,
+		truenasAlerts:     config.TrueNASAlerts,
+		forwardTrueNAS:    config.ForwardTrueNASAlerts,
+		maintenanceGrace:  maintenanceGrace,
+		scanStateFile:     config.ScanStateFile,
+		tracer:            config.Tracer,
+		reportScheduler:   config.ReportScheduler,
+		stateStore:        config.Store,
+		events:            events,
+		inventoryDrift:    config.InventoryDrift,
+		scope:             config.Scope,
+		restoreCanary:     config.RestoreCanary,
+		orphanGroupWindow: config.OrphanGroupWindow,
+		phaseFlapping:     config.PhaseFlapping,
+		abandoned:         config.AbandonedDatasets,
+		backupCoverage:    config.BackupCoverage,
+		scanConfig:        config.ScanConfig,
+		requestBudget:     config.RequestBudget,
+		restoredScan:      restoredScan,
+		clock:             clock.OrReal(config.Clock),
+		stopChan:          make(chan struct{}),
 	}, nil
 }
 
@@ -121,9 +489,20 @@ func (s *Service) Start(ctx context.Context) error {
 
 	s.running = true
 
-	// Start monitoring goroutine
+	// Start the scan loop and its watchdog
+	s.startScanLoop(ctx)
 	s.wg.Add(1)
-	go s.monitorLoop(ctx)
+	go s.watchdogLoop(ctx)
+
+	if s.reportScheduler != nil {
+		s.wg.Add(1)
+		go s.reportLoop(ctx)
+	}
+
+	if s.restoreCanary.Enabled {
+		s.wg.Add(1)
+		go s.canaryLoop(ctx)
+	}
 
 	return nil
 }
@@ -131,9 +510,8 @@ func (s *Service) Start(ctx context.Context) error {
 // Stop gracefully stops the monitoring service
 func (s *Service) Stop(ctx context.Context) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.running {
+		s.mu.Unlock()
 		return nil
 	}
 
@@ -141,11 +519,17 @@ func (s *Service) Stop(ctx context.Context) error {
 
 	close(s.stopChan)
 	s.running = false
+	// Release the lock before waiting: a scan in progress needs it to
+	// store its result.
+	s.mu.Unlock()
 
 	// Wait for goroutines to finish
 	done := make(chan struct{})
 	go func() {
 		s.wg.Wait()
+		if s.events != nil {
+			s.events.Close()
+		}
 		close(done)
 	}()
 
@@ -170,6 +554,22 @@ func (s *Service) GetLastScanResult() *ScanResult {
 	return s.lastScanResult
 }
 
+// GetLastScanDiff returns the diff between the two most recent scans, or nil
+// before the second scan.
+func (s *Service) GetLastScanDiff() *ScanDiff {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastScanDiff
+}
+
+// FlappingVolumes returns the flapping PVs of the most recent scan.
+func (s *Service) FlappingVolumes() []analysis.FlappingVolume {
+	if result := s.GetLastScanResult(); result != nil {
+		return result.FlappingVolumes
+	}
+	return nil
+}
+
 // DetectorThresholds returns the effective orphan detection thresholds.
 func (s *Service) DetectorThresholds() (time.Duration, time.Duration) {
 	if s.orphanDetector == nil {
@@ -178,15 +578,42 @@ func (s *Service) DetectorThresholds() (time.Duration, time.Duration) {
 	return s.orphanDetector.Thresholds()
 }
 
-// monitorLoop runs the main monitoring loop
-func (s *Service) monitorLoop(ctx context.Context) {
+// startupDelay returns a random delay in [0, StartupJitter*ScanInterval).
+func (s *Service) startupDelay() time.Duration {
+	if s.startupJitter <= 0 || s.scanInterval <= 0 {
+		return 0
+	}
+	maxDelay := time.Duration(float64(s.scanInterval) * s.startupJitter)
+	if maxDelay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(maxDelay)))
+}
+
+// monitorLoop runs the main monitoring loop. generation identifies the loop
+// to the watchdog.
+func (s *Service) monitorLoop(ctx context.Context, generation int) {
 	defer s.wg.Done()
 
+	if delay := s.startupDelay(); delay > 0 {
+		s.logger.Info("Delaying first scan by startup jitter", zap.Duration("delay", delay))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+
 	ticker := time.NewTicker(s.scanInterval)
 	defer ticker.Stop()
 
 	// Run initial scan
-	s.performScan(ctx)
+	s.runScan(ctx, generation)
 
 	for {
 		select {
@@ -197,91 +624,766 @@ func (s *Service) monitorLoop(ctx context.Context) {
 			s.logger.Info("Monitor loop stopped")
 			return
 		case <-ticker.C:
-			s.performScan(ctx)
+			s.runScan(ctx, generation)
+		}
+	}
+}
+
+// reportLoop runs the scheduled reports that are due every
+// scheduler.TickInterval. Report generation runs its own analysis and
+// orphan detection, independent of the scans.
+func (s *Service) reportLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(scheduler.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if err := s.reportScheduler.RunDue(ctx); err != nil {
+				s.logger.Warn("Scheduled reports failed", logging.RedactedError(err))
+			}
 		}
 	}
 }
 
 // performScan executes a complete monitoring scan using the orphan detector
 func (s *Service) performScan(ctx context.Context) {
+	if now := s.clock.Now(); s.inMaintenanceBackoff(now) {
+		s.logger.Debug("Skipping scan while TrueNAS is in maintenance")
+		return
+	}
 	s.logger.Debug("Starting monitoring scan")
+	ctx, span := s.tracer.Start(ctx, "monitor.scan")
+	defer span.End()
+	ctx, requests := apiusage.NewContext(ctx)
+	ctx = withScanListings(ctx)
 
 	// Use the comprehensive orphan detector
 	detectionResult, err := s.orphanDetector.DetectOrphanedResources(ctx, "")
 	if err != nil {
+		span.RecordError(err)
+		if s.handleBackendUnavailable(ctx, err, s.clock.Now()) {
+			return
+		}
 		s.logger.WithError(err).Error("Failed to detect orphaned resources")
 		return
 	}
+	s.backendRecovered(s.clock.Now())
 
 	// Convert detection result to scan result format
+	seen := make(map[string]time.Time)
+	now := detectionResult.Timestamp
 	result := &ScanResult{
-		Timestamp:         detectionResult.Timestamp,
-		OrphanedPVs:       s.convertOrphanedResources(detectionResult.OrphanedPVs),
-		OrphanedPVCs:      s.convertOrphanedResources(detectionResult.OrphanedPVCs),
-		OrphanedSnapshots: s.convertOrphanedResources(detectionResult.OrphanedSnapshots),
-		TotalPVs:          detectionResult.TotalPVs,
-		TotalPVCs:         detectionResult.TotalPVCs,
-		TotalSnapshots:    detectionResult.TotalSnapshots,
-		ScanDuration:      detectionResult.ScanDuration,
+		Timestamp:                detectionResult.Timestamp,
+		OrphanedPVs:              s.convertOrphanedResources(detectionResult.OrphanedPVs, seen, now),
+		OrphanedPVCs:             s.convertOrphanedResources(detectionResult.OrphanedPVCs, seen, now),
+		OrphanedSnapshots:        s.convertOrphanedResources(detectionResult.OrphanedSnapshots, seen, now),
+		OrphanedTrueNASVolumes:   s.convertOrphanedResources(detectionResult.OrphanedTrueNASVolumes, seen, now),
+		TotalPVs:                 detectionResult.TotalPVs,
+		TotalPVCs:                detectionResult.TotalPVCs,
+		TotalSnapshots:           detectionResult.TotalSnapshots,
+		TotalK8sSnapshots:        detectionResult.TotalK8sSnapshots,
+		TotalTrueNASSnapshots:    detectionResult.TotalTrueNASSnapshots,
+		OrphanedK8sSnapshots:     detectionResult.OrphanedK8sSnapshots,
+		OrphanedTrueNASSnapshots: detectionResult.OrphanedTrueNASSnapshots,
+		ManagedByTrueNAS:         detectionResult.ManagedByTrueNAS,
+		ScanDuration:             detectionResult.ScanDuration,
+		Partial:                  detectionResult.Partial,
+		PhaseErrors:              detectionResult.PhaseErrors,
+		UnreadableNamespaces:     detectionResult.UnreadableNamespaces,
+		NamespaceCoveragePercent: detectionResult.NamespaceCoveragePercent,
+		DuplicateVolumeHandles:   detectionResult.DuplicateVolumeHandles,
+		CorrelationUnknown:       detectionResult.CorrelationUnknown,
+		ExportMissing:            detectionResult.ExportMissing,
+		ExportsChecked:           detectionResult.ExportsChecked,
+		Excluded:                 detectionResult.Excluded,
+		Phases:                   detectionPhases(detectionResult),
+		Inventory:                detectionResult.Inventory,
+		StorageClasses:           detectionResult.StorageClasses,
+		OrphanGroups:             detectionResult.Groups(s.orphanGroupWindow),
+		SnapshotCorrelatedAt:     detectionResult.SnapshotCorrelatedAt,
+		Config:                   s.scanConfig,
 	}
+	result.PhaseTransitions, result.FlappingVolumes = s.trackPVPhases(ctx, detectionResult.PVPhases, now)
+	pending := &scanMetrics{}
+	if inventory := detectionResult.Inventory; inventory != nil {
+		efficiency := analysis.NewStorageEfficiency(inventory.UsedBytes, inventory.RequestedBytes, inventory.CapacityPVs, inventory.K8sManagedPVs)
+		result.StorageEfficiency = &efficiency
+	}
+	timePhase(ctx, result.Phases, PhaseCSIHealth, func(ctx context.Context) int {
+		if result.CSIHealth = s.checkCSIDriverHealth(ctx, pending); result.CSIHealth == nil {
+			return 0
+		}
+		return len(result.CSIHealth.Pods)
+	})
+	timePhase(ctx, result.Phases, PhaseSnapshotSchedules, func(ctx context.Context) int {
+		if result.SnapshotSchedule = s.checkSnapshotSchedules(ctx, now, pending); result.SnapshotSchedule == nil {
+			return 0
+		}
+		return len(result.SnapshotSchedule.Classes)
+	})
+	timePhase(ctx, result.Phases, PhaseNFSMounts, func(ctx context.Context) int {
+		if result.NFSMounts = s.checkNFSMounts(ctx, now); result.NFSMounts == nil {
+			return 0
+		}
+		return len(result.NFSMounts.Checked)
+	})
+	timePhase(ctx, result.Phases, PhaseISCSISessions, func(ctx context.Context) int {
+		if result.ISCSISessions = s.checkISCSISessions(ctx); result.ISCSISessions == nil {
+			return 0
+		}
+		return len(result.ISCSISessions.Nodes)
+	})
+	timePhase(ctx, result.Phases, PhaseAttachments, func(ctx context.Context) int {
+		if result.StuckResources = s.checkVolumeAttachments(ctx, now); result.StuckResources == nil {
+			return 0
+		}
+		return result.StuckResources.CheckedAttachments
+	})
+	timePhase(ctx, result.Phases, PhaseZFSReadiness, func(ctx context.Context) int {
+		if result.ZFSReadiness = s.checkZFSReadiness(ctx); result.ZFSReadiness == nil {
+			return 0
+		}
+		return len(result.ZFSReadiness.Datasets) + len(result.ZFSReadiness.Pools)
+	})
+	timePhase(ctx, result.Phases, PhaseTrueNASScope, func(ctx context.Context) int {
+		if result.Scope = s.checkScope(ctx); result.Scope == nil {
+			return 0
+		}
+		result.Degraded = len(result.Scope.Problems) > 0
+		return len(result.Scope.AvailablePools)
+	})
+	timePhase(ctx, result.Phases, PhaseVolumeIO, func(ctx context.Context) int {
+		result.VolumeTemperatures = s.checkVolumeIO(ctx, pending)
+		items := 0
+		for _, count := range result.VolumeTemperatures {
+			items += count
+		}
+		return items
+	})
+	timePhase(ctx, result.Phases, PhaseTrueNASPools, func(ctx context.Context) int {
+		result.Pools = s.checkPools(ctx, pending)
+		return len(result.Pools)
+	})
+	timePhase(ctx, result.Phases, PhaseSnapshotAges, func(ctx context.Context) int {
+		result.SnapshotAges = s.checkSnapshotAges(ctx, now, pending)
+		items := 0
+		for _, count := range result.SnapshotAges {
+			items += count.Count
+		}
+		return items
+	})
 
-	// Store the latest scan result
+	timePhase(ctx, result.Phases, PhaseProvisioning, func(ctx context.Context) int {
+		if result.ProvisioningLatency = s.checkProvisioningLatency(ctx, now, pending); result.ProvisioningLatency == nil {
+			return 0
+		}
+		return result.ProvisioningLatency.Overall.Count
+	})
+	timePhase(ctx, result.Phases, PhaseAbandonedDatasets, func(ctx context.Context) int {
+		if result.AbandonedDatasets = s.checkAbandonedDatasets(ctx, now); result.AbandonedDatasets == nil {
+			return 0
+		}
+		return len(result.AbandonedDatasets.Datasets)
+	})
+	timePhase(ctx, result.Phases, PhaseBackupCoverage, func(ctx context.Context) int {
+		if result.BackupCoverage = s.checkBackupCoverage(ctx, now, pending); result.BackupCoverage == nil {
+			return 0
+		}
+		items := 0
+		for _, namespace := range result.BackupCoverage.Namespaces {
+			items += namespace.Claims
+		}
+		return items
+	})
+
+	result.BackendRequests = requests.Counts()
+	s.checkRequestBudget(result.BackendRequests)
+
+	// Update metrics; the metrics update is itself a timed phase
+	timePhase(ctx, result.Phases, PhaseMetricsUpdate, func(ctx context.Context) int {
+		s.updateMetrics(result, pending)
+		return 0
+	})
+	if s.metricsExporter != nil {
+		s.metricsExporter.ObserveListPhaseDuration(PhaseMetricsUpdate, result.Phases[PhaseMetricsUpdate].Duration.Seconds())
+	}
+
+	// Store the latest scan result and diff it against the previous one
 	s.mu.Lock()
+	previous := s.lastScanResult
+	if previous == nil {
+		previous = s.restoredScan
+		s.restoredScan = nil
+	}
+	var diff *ScanDiff
+	if previous != nil {
+		diff = DiffScans(previous, result)
+		changes := diff.Changes()
+		result.Changes = &changes
+	}
 	s.lastScanResult = result
+	s.lastScanDiff = diff
+	s.orphanFirstSeen = seen
 	s.mu.Unlock()
 
-	// Update metrics
-	s.updateMetrics(result, detectionResult.PhaseTimings)
+	if s.scanStateFile != "" {
+		if err := writeScanState(s.scanStateFile, ScanState{Result: result, Diff: diff}); err != nil {
+			s.logger.WithError(err).Warn("Failed to write scan state file")
+		}
+	}
+
+	s.processAlerts(ctx, result)
+
+	if s.events != nil {
+		orphans := append(append(append([]OrphanedResource{}, result.OrphanedPVs...), result.OrphanedPVCs...), result.OrphanedSnapshots...)
+		s.events.Submit(orphans, now)
+	}
 
 	// Log scan results using structured logging
 	s.logger.Info("Monitoring scan completed",
 		zap.Int("orphaned_pvs", len(result.OrphanedPVs)),
 		zap.Int("orphaned_pvcs", len(result.OrphanedPVCs)),
 		zap.Int("orphaned_snapshots", len(result.OrphanedSnapshots)),
+		zap.Int("orphaned_truenas_volumes", len(result.OrphanedTrueNASVolumes)),
 		zap.Int("total_pvs", result.TotalPVs),
 		zap.Int("total_pvcs", result.TotalPVCs),
 		zap.Int("total_snapshots", result.TotalSnapshots),
 		zap.Duration("scan_duration", result.ScanDuration),
+		zap.Bool("partial", result.Partial),
+		zap.Int("unreadable_namespaces", len(result.UnreadableNamespaces)),
+		zap.Float64p("namespace_coverage_percent", result.NamespaceCoveragePercent),
+		zap.Int("duplicate_volume_handles", len(result.DuplicateVolumeHandles)),
+		zap.Int("correlation_unknown", len(result.CorrelationUnknown)),
+		zap.Any("phases", result.Phases),
+		zap.Any("backend_requests", result.BackendRequests),
 	)
+	span.SetAttributes(
+		tracing.Int("scan.orphaned_pvs", len(result.OrphanedPVs)),
+		tracing.Int("scan.orphaned_pvcs", len(result.OrphanedPVCs)),
+		tracing.Int("scan.orphaned_snapshots", len(result.OrphanedSnapshots)),
+		tracing.Bool("scan.partial", result.Partial))
+	if diff != nil && !diff.Empty() {
+		changes := diff.Changes()
+		s.logger.Info("Scan changes since previous scan",
+			zap.Int("new_orphans", changes.NewOrphans),
+			zap.Int("resolved_orphans", changes.ResolvedOrphans),
+			zap.Int("pool_threshold_crossings", changes.PoolThresholdCrossings),
+			zap.Int("csi_pod_changes", changes.CSIPodChanges),
+			zap.Int("locked_datasets", changes.LockedDatasets),
+			zap.Int64("used_bytes_delta", changes.UsedBytesDelta),
+		)
+	}
+}
+
+// checkRequestBudget warns about each backend the scan sent more requests
+// to than its budget allows.
+func (s *Service) checkRequestBudget(requests map[string]int64) {
+	for _, backend := range []string{apiusage.BackendKubernetes, apiusage.BackendTrueNAS} {
+		budget := s.requestBudget[backend]
+		if budget > 0 && requests[backend] > budget {
+			s.logger.Warn("Scan exceeded its backend request budget",
+				zap.String("backend", backend),
+				zap.Int64("requests", requests[backend]),
+				zap.Int64("budget", budget))
+		}
+	}
+}
+
+// checkVolumeIO classifies PV datasets by I/O and records the busiest ones
+// for export. Failures are logged and do not fail the scan.
+func (s *Service) checkVolumeIO(ctx context.Context, pending *scanMetrics) map[string]int {
+	if !s.ioStats.Enabled {
+		return nil
+	}
+
+	var in analysis.Inputs
+	var err error
+	if in.PersistentVolumes, err = s.k8sClient.ListDemocraticCSIPersistentVolumes(ctx); err == nil {
+		in.Volumes, err = s.truenasClient.ListVolumes(ctx)
+	}
+	var stats map[string]truenas.DatasetIOStats
+	if err == nil {
+		stats, err = analysis.GatherIOStats(ctx, s.truenasClient, in, s.ioStats.Window)
+	}
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to collect volume I/O statistics")
+		return nil
+	}
+
+	volumes := analysis.VolumeIO(in, stats, s.ioStats.Thresholds)
+	temperatures := make(map[string]int)
+	for _, volume := range volumes {
+		temperatures[volume.Temperature]++
+	}
+
+	if s.metricsExporter != nil {
+		// VolumeIO sorts by throughput, so the busiest datasets come first.
+		rates := make([]metrics.VolumeIORate, 0, s.ioStatsTopN)
+		for _, volume := range volumes {
+			if len(rates) == s.ioStatsTopN {
+				break
+			}
+			if volume.Temperature == analysis.TemperatureUnknown {
+				continue
+			}
+			rates = append(rates, metrics.VolumeIORate{
+				Dataset:          volume.Dataset,
+				PersistentVolume: volume.PersistentVolume,
+				ReadBytesRate:    volume.ReadBytesRate,
+				WriteBytesRate:   volume.WriteBytesRate,
+			})
+		}
+		pending.volumeIORates = rates
+	}
+
+	return temperatures
+}
+
+// checkPools records TrueNAS pool usage for the scan diff and for export.
+// Failures are logged and do not fail the scan.
+func (s *Service) checkPools(ctx context.Context, pending *scanMetrics) []analysis.PoolUsage {
+	pools, err := s.truenasClient.ListPools(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to list TrueNAS pools")
+		return nil
+	}
+	usages := analysis.PoolUsages(pools)
+
+	pending.pools = make([]metrics.PoolUsage, 0, len(usages))
+	for _, usage := range usages {
+		pending.pools = append(pending.pools, metrics.PoolUsage{
+			Pool:               usage.Name,
+			SizeBytes:          usage.Size,
+			UsedBytes:          usage.Used,
+			UtilizationPercent: usage.UtilizationPercent,
+		})
+	}
+	return usages
+}
+
+// checkSnapshotAges counts TrueNAS snapshots per age bucket and records the
+// counts for export. Failures are logged and do not fail the scan.
+func (s *Service) checkSnapshotAges(ctx context.Context, now time.Time, pending *scanMetrics) []analysis.SnapshotAgeCount {
+	if !s.snapshotAges {
+		return nil
+	}
+
+	snapshots, err := s.truenasClient.ListSnapshots(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to list TrueNAS snapshots for age buckets")
+		return nil
+	}
+	counts := analysis.SnapshotAgeDistribution(snapshots, now, s.ageBuckets)
+
+	pending.snapshotAges = make(map[string]int, len(counts))
+	for _, count := range counts {
+		pending.snapshotAges[count.Bucket] = count.Count
+	}
+
+	return counts
+}
+
+// checkProvisioningLatency measures the PVCs bound within the provisioning
+// window and records the ones not observed by earlier scans for the
+// histogram. Failures are logged and do not fail the scan.
+func (s *Service) checkProvisioningLatency(ctx context.Context, now time.Time, pending *scanMetrics) *analysis.ProvisioningReport {
+	if !s.provisioning {
+		return nil
+	}
+
+	pvcs, err := s.k8sClient.ListPersistentVolumeClaims(ctx, "")
+	var unreadable *k8s.UnreadableNamespacesError
+	if errors.As(err, &unreadable) {
+		// The scan reports the unreadable namespaces; measure the others.
+		err = nil
+	}
+	var pvs []corev1.PersistentVolume
+	if err == nil {
+		pvs, err = s.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+	}
+	var classes []storagev1.StorageClass
+	if err == nil {
+		classes, err = s.k8sClient.ListStorageClasses(ctx)
+	}
+	var pods []corev1.Pod
+	if err == nil && hasWaitForFirstConsumer(classes) {
+		pods, err = s.k8sClient.ListPods(ctx, "")
+	}
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to measure PVC provisioning latency")
+		return nil
+	}
+
+	since := now.Add(-s.provisioningWin)
+	samples := analysis.ProvisioningSamples(pvcs, pvs, classes, pods, since)
+
+	s.mu.Lock()
+	observed := make(map[string]time.Time, len(samples))
+	for _, sample := range samples {
+		if _, ok := s.provisioningObserved[sample.UID]; !ok {
+			pending.provisioningSamples = append(pending.provisioningSamples, sample)
+		}
+		observed[sample.UID] = sample.BoundAt
+	}
+	s.provisioningObserved = observed
+	s.mu.Unlock()
+
+	return analysis.SummarizeProvisioning(samples, s.provisioningWin)
+}
+
+func hasWaitForFirstConsumer(classes []storagev1.StorageClass) bool {
+	for _, class := range classes {
+		if class.VolumeBindingMode != nil && *class.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCSIDriverHealth records democratic-csi pod versions for export.
+// Failures are logged and do not fail the scan.
+func (s *Service) checkCSIDriverHealth(ctx context.Context, pending *scanMetrics) *k8s.CSIDriverHealth {
+	health, err := s.k8sClient.CheckCSIDriverHealth(ctx, "")
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check CSI driver health")
+		return nil
+	}
+	if health == nil {
+		return nil
+	}
+
+	for _, warning := range health.Warnings {
+		s.logger.Warn("CSI driver version skew", zap.String("detail", warning))
+	}
+
+	pending.csiDrivers = make([]metrics.CSIDriverInfo, 0, len(health.Pods))
+	for _, pod := range health.Pods {
+		pending.csiDrivers = append(pending.csiDrivers, metrics.CSIDriverInfo{
+			Pod:     pod.Name,
+			Node:    pod.Node,
+			Role:    pod.Role,
+			Version: pod.DriverVersion,
+		})
+	}
+
+	return health
+}
+
+// checkSnapshotSchedules checks configured snapshot schedule policies and
+// records per-class compliance for export. Failures are logged and do not
+// fail the scan.
+func (s *Service) checkSnapshotSchedules(ctx context.Context, now time.Time, pending *scanMetrics) *analysis.ScheduleReport {
+	if len(s.snapshotSchedules) == 0 {
+		return nil
+	}
+
+	in, err := analysis.Gather(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check snapshot schedules")
+		return nil
+	}
+	report := analysis.CheckSnapshotSchedules(s.snapshotSchedules, in, now)
+
+	for _, violation := range report.Violations() {
+		s.logger.Warn("Snapshot schedule violation",
+			zap.String("category", violation.Category),
+			zap.String("storage_class", violation.StorageClass),
+			zap.String("pv", violation.PersistentVolume),
+			zap.String("dataset", violation.Dataset),
+			zap.String("reason", violation.Reason))
+	}
+
+	pending.scheduleCompliance = make(map[string]bool, len(report.Classes))
+	for _, class := range report.Classes {
+		pending.scheduleCompliance[class.StorageClass] = class.Compliant
+	}
+
+	return report
+}
+
+// checkNFSMounts runs the sampled NFS mountpoint deep check when enabled.
+// Failures are logged and do not fail the scan.
+func (s *Service) checkNFSMounts(ctx context.Context, now time.Time) *analysis.NFSMountReport {
+	if s.nfsChecker == nil {
+		return nil
+	}
+
+	pvs, err := s.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check NFS mountpoints")
+		return nil
+	}
+	report, err := s.nfsChecker.Check(ctx, pvs, now)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check NFS mountpoints")
+		return nil
+	}
+
+	for _, violation := range report.Violations {
+		s.logger.Warn("NFS share not exportable",
+			zap.String("category", violation.Category),
+			zap.String("pv", violation.PersistentVolume),
+			zap.String("pvc", violation.Claim),
+			zap.String("share_path", violation.SharePath),
+			zap.String("reason", violation.Reason))
+	}
+	return report
+}
+
+// checkISCSISessions correlates attached iSCSI PVs with TrueNAS iSCSI
+// sessions when enabled. Failures are logged and do not fail the scan.
+func (s *Service) checkISCSISessions(ctx context.Context) *analysis.ISCSISessionReport {
+	if !s.iscsiSessions.Enabled {
+		return nil
+	}
+
+	report, err := analysis.CheckISCSISessions(ctx, s.k8sClient, s.truenasClient, s.iscsiSessions)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check iSCSI sessions")
+		return nil
+	}
+
+	for _, violation := range report.Violations {
+		s.logger.Warn("iSCSI session problem",
+			zap.String("category", violation.Category),
+			zap.String("node", violation.Node),
+			zap.String("initiator", violation.Initiator),
+			zap.String("pv", violation.PersistentVolume),
+			zap.String("reason", violation.Reason))
+	}
+	return report
+}
+
+// StuckResources is the stuck-resources section of a scan: VolumeAttachments
+// that cause Multi-Attach errors, with remediation hints.
+type StuckResources struct {
+	CheckedAttachments int                          `json:"checked_attachments"`
+	MultiAttached      int                          `json:"multi_attached"`
+	StaleAttachments   int                          `json:"stale_attachments"`
+	Attachments        []analysis.AttachmentFinding `json:"attachments"`
+}
+
+// checkVolumeAttachments flags PVs attached to several nodes and
+// attachments to NotReady or missing nodes. Failures are logged and do not
+// fail the scan.
+func (s *Service) checkVolumeAttachments(ctx context.Context, now time.Time) *StuckResources {
+	report, err := analysis.CheckVolumeAttachments(ctx, s.k8sClient, now)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check volume attachments")
+		return nil
+	}
+
+	for _, finding := range report.Findings {
+		s.logger.Warn("Stuck volume attachment",
+			zap.String("kind", finding.Kind),
+			zap.String("pv", finding.PersistentVolume),
+			zap.Strings("nodes", finding.Nodes),
+			zap.Strings("attachments", finding.Attachments),
+			zap.String("remediation", finding.Remediation))
+	}
+	return &StuckResources{
+		CheckedAttachments: len(report.Attachments),
+		MultiAttached:      report.MultiAttached,
+		StaleAttachments:   report.Stale,
+		Attachments:        report.Findings,
+	}
+}
+
+// checkScope checks that the configured pool and parent dataset exist, when
+// set. Failures are logged and do not fail the scan.
+func (s *Service) checkScope(ctx context.Context) *analysis.ScopeReport {
+	if !s.scope.Enabled() {
+		return nil
+	}
+	report, err := analysis.CheckScope(ctx, s.truenasClient, s.scope)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check the configured TrueNAS pool")
+		return nil
+	}
+	if err := report.Err(); err != nil {
+		s.logger.WithError(err).Error("Configured TrueNAS pool or parent dataset is missing; scan results are degraded",
+			zap.Strings("available_pools", report.AvailablePools))
+	}
+	return report
+}
+
+// checkZFSReadiness checks the democratic-csi parent datasets and their
+// pools. Failures are logged and do not fail the scan.
+func (s *Service) checkZFSReadiness(ctx context.Context) *analysis.ZFSReadinessReport {
+	report, err := analysis.CheckZFSReadiness(ctx, s.k8sClient, s.truenasClient)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to check ZFS readiness")
+		return nil
+	}
+
+	for _, problem := range report.Problems {
+		s.logger.Error("ZFS state blocks democratic-csi operations",
+			zap.String("kind", problem.Kind),
+			zap.String("pool", problem.Pool),
+			zap.String("dataset", problem.Dataset),
+			zap.String("reason", problem.Message),
+			zap.String("remediation", problem.Remediation))
+	}
+	return report
 }
 
 // Note: The old placeholder scanning methods have been removed since we now use
 // the comprehensive orphan detector which provides much more sophisticated
 // detection algorithms with proper correlation between K8s and TrueNAS resources.
 
-// convertOrphanedResources converts orphan detector results to monitor service format
-func (s *Service) convertOrphanedResources(orphanResources []orphan.OrphanedResource) []OrphanedResource {
+// convertOrphanedResources converts orphan detector results to monitor service format.
+// FirstSeen carries over from earlier scans by identity key and each key is
+// recorded in seen; a recreated object with a new UID starts fresh at now.
+func (s *Service) convertOrphanedResources(orphanResources []orphan.OrphanedResource, seen map[string]time.Time, now time.Time) []OrphanedResource {
+	s.mu.RLock()
+	previous := s.orphanFirstSeen
+	s.mu.RUnlock()
+
 	var result []OrphanedResource
 	for _, orphan := range orphanResources {
+		key := orphan.Key()
+		firstSeen, ok := previous[key]
+		if !ok {
+			firstSeen = now
+		}
+		seen[key] = firstSeen
+
 		result = append(result, OrphanedResource{
 			Type:        orphan.Type,
 			Name:        orphan.Name,
 			Namespace:   orphan.Namespace,
+			UID:         orphan.UID,
 			Age:         orphan.Age,
 			Labels:      orphan.Labels,
 			Annotations: orphan.Annotations,
 			Reason:      orphan.Reason,
+			Details:     orphan.Details,
+			FirstSeen:   firstSeen,
+			SizeBytes:   orphan.SizeBytes,
 		})
 	}
 	return result
 }
 
-// updateMetrics updates Prometheus metrics with scan results
-func (s *Service) updateMetrics(result *ScanResult, phaseTimings map[string]time.Duration) {
+// scanMetrics holds the metric values recorded by the checks of one scan
+// until updateMetrics applies them. A nil field means the check did not run
+// or failed, and its series keep their previous values.
+type scanMetrics struct {
+	csiDrivers         []metrics.CSIDriverInfo
+	scheduleCompliance map[string]bool
+	backupCoverage     map[string]float64
+	volumeIORates      []metrics.VolumeIORate
+	pools              []metrics.PoolUsage
+	snapshotAges       map[string]int
+	// provisioningSamples are the PVCs newly bound since the last scan.
+	provisioningSamples []analysis.ProvisioningSample
+}
+
+// updateMetrics updates Prometheus metrics with scan results and the values
+// recorded by the checks. All writes happen in one exporter update, so a
+// scrape never sees a partly updated scan; pending may be nil.
+func (s *Service) updateMetrics(result *ScanResult, pending *scanMetrics) {
 	if s.metricsExporter == nil {
 		return
 	}
+	if pending == nil {
+		pending = &scanMetrics{}
+	}
+	s.metricsExporter.Update(func() {
+		s.applyMetrics(result, pending)
+	})
+}
+
+func (s *Service) applyMetrics(result *ScanResult, pending *scanMetrics) {
 	s.metricsExporter.SetOrphanedPVsCount(float64(len(result.OrphanedPVs)))
 	s.metricsExporter.SetOrphanedPVCsCount(float64(len(result.OrphanedPVCs)))
 	s.metricsExporter.SetOrphanedSnapshotsCount(float64(len(result.OrphanedSnapshots)))
 	scanSeconds := result.ScanDuration.Seconds()
 	s.metricsExporter.SetScanDuration(scanSeconds)
+	s.metricsExporter.SetBackendRequestsPerScan(result.BackendRequests)
 	s.metricsExporter.ObserveScanDuration(scanSeconds)
-	for phase, duration := range phaseTimings {
-		s.metricsExporter.ObserveListPhaseDuration(phase, duration.Seconds())
+	for phase, stats := range result.Phases {
+		if phase != PhaseMetricsUpdate {
+			s.metricsExporter.ObserveListPhaseDuration(phase, stats.Duration.Seconds())
+		}
+	}
+	if result.StorageEfficiency != nil {
+		s.metricsExporter.SetStorageEfficiency(result.StorageEfficiency.Percent, result.StorageEfficiency.CoveragePercent)
 	}
 	s.metricsExporter.SetTotalPVs(float64(result.TotalPVs))
 	s.metricsExporter.SetTotalPVCs(float64(result.TotalPVCs))
 	s.metricsExporter.SetTotalSnapshots(float64(result.TotalSnapshots))
+	s.metricsExporter.SetSnapshotCounts(
+		float64(result.TotalK8sSnapshots),
+		float64(result.TotalTrueNASSnapshots),
+		float64(result.OrphanedK8sSnapshots),
+		float64(result.OrphanedTrueNASSnapshots),
+	)
+	for _, transition := range result.PhaseTransitions {
+		s.metricsExporter.IncPVPhaseTransition(transition.From, transition.To)
+	}
+	s.metricsExporter.SetDuplicateVolumeHandles(float64(len(result.DuplicateVolumeHandles)))
+	s.metricsExporter.SetUnparseableVolumeHandles(float64(len(result.CorrelationUnknown)))
+	if result.AbandonedDatasets != nil {
+		s.metricsExporter.SetAbandonedDatasetReclaimableBytes(float64(result.AbandonedDatasets.ReclaimableBytes))
+	}
+	if stuck := result.StuckResources; stuck != nil {
+		s.metricsExporter.SetVolumeAttachmentProblems(float64(stuck.MultiAttached), float64(stuck.StaleAttachments))
+	}
+	if inventory := result.Inventory; inventory != nil {
+		s.metricsExporter.SetInventoryCounts(metrics.InventoryCounts{
+			K8sManagedPVs:         float64(inventory.K8sManagedPVs),
+			TrueNASManagedVolumes: float64(inventory.TrueNASManagedVolumes),
+			UnmatchedK8s:          float64(inventory.UnmatchedK8s),
+			UnmatchedTrueNAS:      float64(inventory.UnmatchedTrueNAS),
+			DriftPercent:          inventory.DriftPercent,
+		})
+	}
+	if result.StorageClasses != nil {
+		classes := make([]metrics.StorageClassUsage, len(result.StorageClasses))
+		for i, class := range result.StorageClasses {
+			classes[i] = metrics.StorageClassUsage{
+				StorageClass:     class.StorageClass,
+				Volumes:          class.Volumes,
+				ProvisionedBytes: class.ProvisionedBytes,
+				UsedBytes:        class.UsedBytes,
+				Orphans:          class.Orphans,
+				WastedBytes:      class.WastedBytes,
+			}
+		}
+		s.metricsExporter.SetStorageClassUsage(classes)
+	}
+	if s.snapshotCache != nil {
+		stats := s.snapshotCache.Stats()
+		s.metricsExporter.SetSnapshotCacheStats(float64(stats.Size), s.clock.Now().Sub(stats.LastFullList))
+	}
+	if pending.csiDrivers != nil {
+		s.metricsExporter.SetCSIDriverInfo(pending.csiDrivers)
+	}
+	if pending.scheduleCompliance != nil {
+		s.metricsExporter.SetSnapshotScheduleCompliance(pending.scheduleCompliance)
+	}
+	if pending.backupCoverage != nil {
+		s.metricsExporter.SetBackupCoverage(pending.backupCoverage)
+	}
+	if pending.volumeIORates != nil {
+		s.metricsExporter.SetVolumeIORates(pending.volumeIORates)
+	}
+	if pending.pools != nil {
+		s.metricsExporter.SetPoolUsage(pending.pools)
+	}
+	if pending.snapshotAges != nil {
+		s.metricsExporter.SetSnapshotAges(pending.snapshotAges)
+	}
+	for _, sample := range pending.provisioningSamples {
+		s.metricsExporter.ObserveProvisioningDuration(sample.StorageClass, sample.Duration.Seconds())
+	}
 	s.metricsExporter.SetLastScanTimestamp(result.Timestamp)
-}
\ No newline at end of file
+}
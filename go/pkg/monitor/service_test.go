@@ -2,11 +2,30 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
 )
 
 func TestService_UpdateMetrics_NilExporterDoesNotPanic(t *testing.T) {
@@ -79,7 +98,8 @@ func TestService_UpdateMetrics_RecordsHistogram(t *testing.T) {
 		Timestamp:    time.Now(),
 		ScanDuration: 2 * time.Second,
 		TotalPVs:     3,
-	}, map[string]time.Duration{"k8s_pvs": 500 * time.Millisecond})
+		Phases:       map[string]PhaseStats{"k8s_pvs": {Duration: 500 * time.Millisecond, Items: 3}},
+	}, nil)
 
 	families, err := exporter.GatherForTest()
 	if err != nil {
@@ -115,3 +135,806 @@ func TestService_UpdateMetrics_RecordsHistogram(t *testing.T) {
 		t.Fatal("phase histogram sample for k8s_pvs not found")
 	}
 }
+
+func TestService_StartupDelay_BoundedByJitterFraction(t *testing.T) {
+	svc := &Service{scanInterval: 10 * time.Minute, startupJitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		delay := svc.startupDelay()
+		if delay < 0 || delay >= 5*time.Minute {
+			t.Fatalf("startupDelay() = %v, want within [0, 5m)", delay)
+		}
+	}
+}
+
+func TestService_StartupDelay_ZeroJitterStartsImmediately(t *testing.T) {
+	svc := &Service{scanInterval: 10 * time.Minute}
+	if delay := svc.startupDelay(); delay != 0 {
+		t.Fatalf("startupDelay() = %v, want 0", delay)
+	}
+}
+
+func scanTestPV(name string, created time.Time) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "org.democratic-csi.nfs",
+					VolumeHandle: "tank/k8s/" + name,
+				},
+			},
+		},
+	}
+}
+
+func TestService_PerformScan_UsesTrueNASInterface(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{Name: "tank/k8s/pv-present", Used: 1 << 30}},
+	}
+	present := scanTestPV("pv-present", old)
+	present.Spec.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("4Gi")}
+
+	svc, err := NewService(Config{
+		K8sClient: &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+			present,
+			scanTestPV("pv-missing", old),
+		}},
+		TruenasClient: truenasClient,
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Clock:         clock.NewFake(now),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	result := svc.GetLastScanResult()
+	if result == nil {
+		t.Fatal("expected a scan result")
+	}
+	if result.TotalPVs != 2 {
+		t.Fatalf("TotalPVs = %d, want 2", result.TotalPVs)
+	}
+	if len(result.OrphanedPVs) != 1 || result.OrphanedPVs[0].Name != "pv-missing" {
+		t.Fatalf("unexpected orphaned PVs: %+v", result.OrphanedPVs)
+	}
+	if truenasClient.Calls("ListVolumes") != 1 {
+		t.Fatalf("ListVolumes calls = %d, want 1", truenasClient.Calls("ListVolumes"))
+	}
+	// Storage efficiency comes from the same correlation and covers only
+	// the PV with a dataset.
+	if efficiency := result.StorageEfficiency; efficiency == nil || efficiency.Percent != 25 || efficiency.CoveragePercent != 50 {
+		t.Fatalf("storage efficiency = %+v, want 25%% at 50%% coverage", efficiency)
+	}
+}
+
+// countingTrueNAS counts the volume and snapshot lists on the request
+// counter, as the HTTP client does.
+type countingTrueNAS struct {
+	*truenastest.Client
+}
+
+func (c countingTrueNAS) ListVolumes(ctx context.Context) ([]truenas.Volume, error) {
+	apiusage.Add(ctx, apiusage.BackendTrueNAS)
+	return c.Client.ListVolumes(ctx)
+}
+
+func (c countingTrueNAS) ListSnapshots(ctx context.Context) ([]truenas.Snapshot, error) {
+	apiusage.Add(ctx, apiusage.BackendTrueNAS)
+	return c.Client.ListSnapshots(ctx)
+}
+
+func TestService_PerformScan_CountsBackendRequests(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	truenasClient := &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-a"}}}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	svc, err := NewService(Config{
+		K8sClient:       &k8stest.Client{},
+		TruenasClient:   countingTrueNAS{truenasClient},
+		MetricsExporter: exporter,
+		Logger:          logging.FromZap(zap.New(core)),
+		ScanInterval:    time.Minute,
+		RequestBudget:   map[string]int64{apiusage.BackendTrueNAS: 1, apiusage.BackendKubernetes: 100},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	result := svc.GetLastScanResult()
+	want := int64(truenasClient.Calls("ListVolumes") + truenasClient.Calls("ListSnapshots"))
+	if got := result.BackendRequests[apiusage.BackendTrueNAS]; got != want || got < 2 {
+		t.Fatalf("TrueNAS requests = %d, want %d (at least 2)", got, want)
+	}
+	exceeded := logs.FilterMessage("Scan exceeded its backend request budget").All()
+	if len(exceeded) != 1 || exceeded[0].ContextMap()["backend"] != apiusage.BackendTrueNAS {
+		t.Fatalf("budget warnings = %+v, want one for truenas", exceeded)
+	}
+	var phaseRequests int64
+	for _, phase := range result.Phases {
+		phaseRequests += phase.Requests[apiusage.BackendTrueNAS]
+	}
+	if phaseRequests != want {
+		t.Fatalf("phase TrueNAS requests = %d, want %d", phaseRequests, want)
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var exported float64
+	for _, family := range families {
+		if family.GetName() != "truenas_monitor_backend_requests_per_scan" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == apiusage.BackendTrueNAS {
+				exported = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	if exported != float64(want) {
+		t.Fatalf("truenas_monitor_backend_requests_per_scan{backend=truenas} = %v, want %d", exported, want)
+	}
+}
+
+func TestService_PerformScan_ChecksSnapshotSchedules(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fresh := scanTestPV("pv-fresh", now.Add(-72*time.Hour))
+	fresh.Spec.StorageClassName = "prod"
+	stale := scanTestPV("pv-stale", now.Add(-72*time.Hour))
+	stale.Spec.StorageClassName = "prod"
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{fresh, stale}}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{{Name: "tank/k8s/pv-fresh"}, {Name: "tank/k8s/pv-stale"}},
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pv-fresh@auto", Dataset: "tank/k8s/pv-fresh", CreatedAt: now.Add(-time.Minute)},
+			{Name: "tank/k8s/pv-stale@auto", Dataset: "tank/k8s/pv-stale", CreatedAt: now.Add(-48 * time.Hour)},
+		},
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:         k8sClient,
+		TruenasClient:     truenasClient,
+		MetricsExporter:   exporter,
+		Logger:            logger,
+		ScanInterval:      time.Minute,
+		Clock:             clock.NewFake(now),
+		SnapshotSchedules: []analysis.SchedulePolicy{{StorageClass: "prod", Cadence: time.Hour}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	report := svc.GetLastScanResult().SnapshotSchedule
+	if report == nil || report.Compliant {
+		t.Fatalf("expected non-compliant schedule report, got %+v", report)
+	}
+	violations := report.Violations()
+	if len(violations) != 1 || violations[0].PersistentVolume != "pv-stale" {
+		t.Fatalf("unexpected violations: %+v", violations)
+	}
+
+	// The schedule check reuses the inventories the detector listed.
+	if calls := k8sClient.Calls("ListDemocraticCSIPersistentVolumes"); calls != 1 {
+		t.Fatalf("ListDemocraticCSIPersistentVolumes calls = %d, want 1", calls)
+	}
+	for _, method := range []string{"ListVolumes", "ListSnapshots", "ListPools"} {
+		if calls := truenasClient.Calls(method); calls != 1 {
+			t.Fatalf("%s calls = %d, want 1", method, calls)
+		}
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var found bool
+	for _, family := range families {
+		if family.GetName() != "truenas_snapshot_schedule_compliant" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			found = true
+			if metric.GetGauge().GetValue() != 0 {
+				t.Fatalf("compliance gauge = %v, want 0", metric.GetGauge().GetValue())
+			}
+		}
+	}
+	if !found {
+		t.Fatal("schedule compliance gauge not exported")
+	}
+}
+
+func TestService_PerformScan_AbandonedDatasetsReuseInventories(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	k8sClient := &k8stest.Client{
+		PersistentVolumes: []corev1.PersistentVolume{scanTestPV("pv-live", now.Add(-72*time.Hour))},
+		StorageClasses: []storagev1.StorageClass{{
+			ObjectMeta:  metav1.ObjectMeta{Name: "nfs"},
+			Provisioner: "org.democratic-csi.nfs",
+			Parameters:  map[string]string{"datasetParentName": "tank/k8s"},
+		}},
+	}
+	truenasClient := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{Name: "tank/k8s/pv-live", Used: 100},
+			{Name: "tank/k8s/pv-gone", Used: 1000, UsedBySnapshots: 990},
+		},
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pv-gone@old", Dataset: "tank/k8s/pv-gone", CreatedAt: now.Add(-90 * 24 * time.Hour)},
+		},
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:           k8sClient,
+		TruenasClient:       truenasClient,
+		Logger:              logger,
+		ScanInterval:        time.Minute,
+		Clock:               clock.NewFake(now),
+		ProvisioningLatency: true,
+		AbandonedDatasets:   AbandonedDatasetOptions{Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	report := svc.GetLastScanResult().AbandonedDatasets
+	if report == nil || len(report.Datasets) != 1 || report.Datasets[0].Dataset != "tank/k8s/pv-gone" {
+		t.Fatalf("abandoned datasets = %+v", report)
+	}
+
+	// The abandoned dataset check reuses the inventories listed earlier in
+	// the scan, including the storage classes.
+	for _, method := range []string{"ListDemocraticCSIPersistentVolumes", "ListStorageClasses"} {
+		if calls := k8sClient.Calls(method); calls != 1 {
+			t.Fatalf("%s calls = %d, want 1", method, calls)
+		}
+	}
+	for _, method := range []string{"ListVolumes", "ListSnapshots"} {
+		if calls := truenasClient.Calls(method); calls != 1 {
+			t.Fatalf("%s calls = %d, want 1", method, calls)
+		}
+	}
+}
+
+func TestService_PerformScan_BackupCoverageReusesInventories(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	claim, ready := "data", true
+	k8sClient := &k8stest.Client{
+		PersistentVolumes: []corev1.PersistentVolume{scanTestPV("pv-data", now.Add(-72*time.Hour))},
+		PersistentVolumeClaims: []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Name: claim, Namespace: "apps", CreationTimestamp: metav1.NewTime(now.Add(-72 * time.Hour))},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-data"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		}},
+		VolumeSnapshots: []snapshotv1.VolumeSnapshot{{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-1", Namespace: "apps", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+			Spec:       snapshotv1.VolumeSnapshotSpec{Source: snapshotv1.VolumeSnapshotSource{PersistentVolumeClaimName: &claim}},
+			Status:     &snapshotv1.VolumeSnapshotStatus{ReadyToUse: &ready},
+		}},
+	}
+	truenasClient := &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-data"}}}
+
+	svc, err := NewService(Config{
+		K8sClient:           k8sClient,
+		TruenasClient:       truenasClient,
+		Logger:              logger,
+		ScanInterval:        time.Minute,
+		Clock:               clock.NewFake(now),
+		ProvisioningLatency: true,
+		BackupCoverage: analysis.BackupCoverageOptions{
+			Policies: []analysis.BackupCoveragePolicy{{Namespaces: []string{"apps"}, MaxAge: 24 * time.Hour}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	report := svc.GetLastScanResult().BackupCoverage
+	if report == nil || len(report.Namespaces) != 1 || report.Namespaces[0].Percent != 100 {
+		t.Fatalf("backup coverage = %+v", report)
+	}
+
+	// The backup coverage check reuses the claims, VolumeSnapshots and
+	// VolumeSnapshotContents the orphan detector listed.
+	for _, method := range []string{"ListPersistentVolumeClaims", "ListVolumeSnapshots", "ListVolumeSnapshotContents", "ListDemocraticCSIPersistentVolumes"} {
+		if calls := k8sClient.Calls(method); calls != 1 {
+			t.Fatalf("%s calls = %d, want 1", method, calls)
+		}
+	}
+	for _, method := range []string{"ListVolumes", "ListSnapshots"} {
+		if calls := truenasClient.Calls(method); calls != 1 {
+			t.Fatalf("%s calls = %d, want 1", method, calls)
+		}
+	}
+}
+
+func TestService_PerformScan_DropsRemovedPoolSeries(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	truenasClient := &truenastest.Client{Pools: []truenas.Pool{
+		{Name: "tank", Size: 100, Used: 50},
+		{Name: "old", Size: 100, Used: 10},
+	}}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	svc, err := NewService(Config{
+		K8sClient:       &k8stest.Client{},
+		TruenasClient:   truenasClient,
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	truenasClient.Pools = truenasClient.Pools[:1]
+	svc.performScan(context.Background())
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	pools := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "truenas_storage_pool_utilization_percent" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			pools[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	if len(pools) != 1 || pools["tank"] != 50 {
+		t.Fatalf("pool utilization series = %v, want only tank at 50", pools)
+	}
+}
+
+func TestService_PerformScan_ObservesProvisioningOnce(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	class := "nfs"
+	pvc := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "apps", UID: "uid-data", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+		Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &class, VolumeName: "pv-data"},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	svc, err := NewService(Config{
+		K8sClient: &k8stest.Client{
+			PersistentVolumes:      []corev1.PersistentVolume{scanTestPV("pv-data", now.Add(-time.Hour+8*time.Second))},
+			PersistentVolumeClaims: []corev1.PersistentVolumeClaim{pvc},
+		},
+		TruenasClient:       &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-data"}}},
+		MetricsExporter:     exporter,
+		Logger:              logger,
+		ScanInterval:        time.Minute,
+		Clock:               clock.NewFake(now),
+		ProvisioningLatency: true,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	svc.performScan(context.Background())
+
+	report := svc.GetLastScanResult().ProvisioningLatency
+	if report == nil || report.Overall.Count != 1 || report.Overall.P50Seconds != 8 {
+		t.Fatalf("provisioning latency = %+v", report)
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "truenas_pvc_provisioning_duration_seconds" {
+			continue
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.GetSampleCount() != 1 || histogram.GetSampleSum() != 8 {
+			t.Fatalf("histogram count = %d sum = %v, want one 8s sample", histogram.GetSampleCount(), histogram.GetSampleSum())
+		}
+		return
+	}
+	t.Fatal("provisioning histogram not exported")
+}
+
+func TestService_PerformScan_ReportsDuplicateVolumeHandles(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	original := scanTestPV("pv-original", now.Add(-time.Hour))
+	restored := scanTestPV("pv-restored", now.Add(-time.Hour))
+	restored.Spec.CSI.VolumeHandle = original.Spec.CSI.VolumeHandle
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	svc, err := NewService(Config{
+		K8sClient:       &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{original, restored}},
+		TruenasClient:   &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-original"}}},
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Minute,
+		Clock:           clock.NewFake(now),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	duplicates := svc.GetLastScanResult().DuplicateVolumeHandles
+	if len(duplicates) != 1 || len(duplicates[0].PersistentVolumes) != 2 {
+		t.Fatalf("unexpected duplicates: %+v", duplicates)
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "truenas_monitor_duplicate_volume_handles" {
+			if got := family.GetMetric()[0].GetGauge().GetValue(); got != 1 {
+				t.Fatalf("duplicate handle gauge = %v, want 1", got)
+			}
+			return
+		}
+	}
+	t.Fatal("duplicate handle gauge not exported")
+}
+
+func TestService_PerformScan_ReportsStuckAttachments(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	pv := "pv-a"
+	attach := func(name, node string) storagev1.VolumeAttachment {
+		return storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: node,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pv},
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: true},
+		}
+	}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	svc, err := NewService(Config{
+		K8sClient: &k8stest.Client{
+			VolumeAttachments: []storagev1.VolumeAttachment{attach("csi-1", "worker-1"), attach("csi-2", "worker-gone")},
+			Nodes: []corev1.Node{{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+				Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+			}},
+		},
+		TruenasClient:   &truenastest.Client{},
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Minute,
+		Clock:           clock.NewFake(now),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	stuck := svc.GetLastScanResult().StuckResources
+	if stuck == nil || stuck.CheckedAttachments != 2 || stuck.MultiAttached != 1 || stuck.StaleAttachments != 1 || len(stuck.Attachments) != 2 {
+		t.Fatalf("unexpected stuck resources: %+v", stuck)
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	gauges := map[string]float64{}
+	for _, family := range families {
+		switch family.GetName() {
+		case "truenas_monitor_multi_attached_pvs", "truenas_monitor_stale_volume_attachments":
+			gauges[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	if gauges["truenas_monitor_multi_attached_pvs"] != 1 || gauges["truenas_monitor_stale_volume_attachments"] != 1 {
+		t.Fatalf("attachment gauges = %v, want 1 each", gauges)
+	}
+}
+
+func TestService_PerformScan_IncrementalSnapshots(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	truenasClient := &truenastest.Client{Snapshots: []truenas.Snapshot{
+		{Name: "tank/k8s/a@1", Dataset: "tank/k8s/a", CreatedAt: now.Add(-time.Hour)},
+	}}
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+
+	svc, err := NewService(Config{
+		K8sClient:               &k8stest.Client{},
+		TruenasClient:           truenasClient,
+		MetricsExporter:         exporter,
+		Logger:                  logger,
+		ScanInterval:            time.Minute,
+		Clock:                   fake,
+		IncrementalSnapshots:    true,
+		SnapshotFullRelistEvery: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	fake.Advance(time.Minute)
+	svc.performScan(context.Background())
+
+	if full, incremental := truenasClient.Calls("ListSnapshots"), truenasClient.Calls("ListSnapshotsSince"); full != 1 || incremental != 1 {
+		t.Fatalf("ListSnapshots = %d, ListSnapshotsSince = %d, want 1 and 1", full, incremental)
+	}
+	if got := svc.GetLastScanResult().TotalTrueNASSnapshots; got != 1 {
+		t.Fatalf("TotalTrueNASSnapshots = %d, want 1", got)
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		switch family.GetName() {
+		case "truenas_monitor_snapshot_cache_size", "truenas_monitor_snapshot_cache_refresh_age_seconds":
+			values[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	if values["truenas_monitor_snapshot_cache_size"] != 1 {
+		t.Fatalf("cache size gauge = %v, want 1", values["truenas_monitor_snapshot_cache_size"])
+	}
+	if values["truenas_monitor_snapshot_cache_refresh_age_seconds"] != 60 {
+		t.Fatalf("cache refresh age = %v, want 60", values["truenas_monitor_snapshot_cache_refresh_age_seconds"])
+	}
+}
+
+func TestService_PerformScan_TrueNASErrorKeepsPreviousResult(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:     &k8stest.Client{},
+		TruenasClient: &truenastest.Client{ListVolumesErr: errors.New("truenas down")},
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	previous := &ScanResult{TotalPVs: 7}
+	svc.lastScanResult = previous
+
+	svc.performScan(context.Background())
+
+	if svc.GetLastScanResult() != previous {
+		t.Fatal("failed scan should not replace the previous result")
+	}
+}
+
+func TestService_ConvertOrphanedResources_FirstSeenKeyedOnUID(t *testing.T) {
+	svc := &Service{}
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := first.Add(time.Hour)
+
+	seen := make(map[string]time.Time)
+	svc.convertOrphanedResources([]orphan.OrphanedResource{
+		{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data", UID: "uid-1"},
+	}, seen, first)
+	svc.orphanFirstSeen = seen
+
+	seen = make(map[string]time.Time)
+	converted := svc.convertOrphanedResources([]orphan.OrphanedResource{
+		{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data", UID: "uid-1"},
+		{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "cache", UID: "uid-3"},
+	}, seen, later)
+	if !converted[0].FirstSeen.Equal(first) {
+		t.Fatalf("existing orphan FirstSeen = %v, want %v", converted[0].FirstSeen, first)
+	}
+	if converted[0].UID != "uid-1" {
+		t.Fatalf("UID = %q, want uid-1", converted[0].UID)
+	}
+	if !converted[1].FirstSeen.Equal(later) {
+		t.Fatalf("new orphan FirstSeen = %v, want %v", converted[1].FirstSeen, later)
+	}
+	svc.orphanFirstSeen = seen
+
+	seen = make(map[string]time.Time)
+	recreated := svc.convertOrphanedResources([]orphan.OrphanedResource{
+		{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data", UID: "uid-2"},
+	}, seen, later.Add(time.Hour))
+	if !recreated[0].FirstSeen.Equal(later.Add(time.Hour)) {
+		t.Fatal("a recreated PVC with a new UID must not inherit the old FirstSeen")
+	}
+}
+
+func TestService_PerformScan_RecordsPhases(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	svc, err := NewService(Config{
+		K8sClient: &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+			scanTestPV("pv-a", now.Add(-72*time.Hour)), scanTestPV("pv-b", now.Add(-72*time.Hour)),
+		}},
+		TruenasClient: &truenastest.Client{Volumes: []truenas.Volume{{Name: "tank/k8s/pv-a"}}},
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Clock:         clock.NewFake(now),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	result := svc.GetLastScanResult()
+	for _, phase := range []string{"k8s_pvs", "truenas_datasets", "correlate_pvs", "correlate_snapshots",
+		PhaseCSIHealth, PhaseNFSMounts, PhaseTrueNASPools, PhaseMetricsUpdate} {
+		if _, ok := result.Phases[phase]; !ok {
+			t.Fatalf("phase %q missing from %+v", phase, result.Phases)
+		}
+	}
+	if got := result.Phases["k8s_pvs"].Items; got != 2 {
+		t.Fatalf("k8s_pvs items = %d, want 2", got)
+	}
+	if got := result.Phases["truenas_datasets"].Items; got != 1 {
+		t.Fatalf("truenas_datasets items = %d, want 1", got)
+	}
+}
+
+func TestService_PerformScan_SnapshotAges(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	svc, err := NewService(Config{
+		K8sClient: &k8stest.Client{},
+		TruenasClient: &truenastest.Client{Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pv-a@hourly", CreatedAt: now.Add(-time.Hour)},
+			{Name: "tank/k8s/pv-a@weekly", CreatedAt: now.Add(-6 * 24 * time.Hour)},
+			{Name: "tank/k8s/pv-a@manual"},
+		}},
+		Logger:             logger,
+		ScanInterval:       time.Minute,
+		Clock:              clock.NewFake(now),
+		SnapshotAges:       true,
+		SnapshotAgeBuckets: []time.Duration{24 * time.Hour, 7 * 24 * time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+
+	result := svc.GetLastScanResult()
+	want := []analysis.SnapshotAgeCount{{Bucket: "1d", Count: 1}, {Bucket: "7d", Count: 1},
+		{Bucket: analysis.SnapshotAgeOlder}, {Bucket: analysis.SnapshotAgeUnknown, Count: 1}}
+	if len(result.SnapshotAges) != len(want) {
+		t.Fatalf("SnapshotAges = %+v, want %+v", result.SnapshotAges, want)
+	}
+	for i := range want {
+		if result.SnapshotAges[i] != want[i] {
+			t.Fatalf("SnapshotAges[%d] = %+v, want %+v", i, result.SnapshotAges[i], want[i])
+		}
+	}
+	if got := result.Phases[PhaseSnapshotAges].Items; got != 3 {
+		t.Fatalf("snapshot_ages items = %d, want 3", got)
+	}
+}
+
+func TestService_PerformScan_TracesPhases(t *testing.T) {
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tracer, err := tracing.NewTracer(tracing.Config{Enabled: true, SampleRatio: 1, Exporter: exporter, BatchTimeout: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTracer: %v", err)
+	}
+
+	svc, err := NewService(Config{
+		K8sClient:     &k8stest.Client{},
+		TruenasClient: &truenastest.Client{},
+		Logger:        logger,
+		ScanInterval:  time.Minute,
+		Tracer:        tracer,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	svc.performScan(context.Background())
+	// Shutdown would clear the in-memory exporter.
+	defer tracer.Shutdown(context.Background())
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+
+	parents := map[string]string{}
+	ids := map[trace.SpanID]string{}
+	for _, span := range exporter.GetSpans() {
+		ids[span.SpanContext.SpanID()] = span.Name
+	}
+	for _, span := range exporter.GetSpans() {
+		parents[span.Name] = ids[span.Parent.SpanID()]
+	}
+	for name, parent := range map[string]string{
+		"monitor.scan":         "",
+		"orphan.detect":        "monitor.scan",
+		"orphan.correlate_pvs": "orphan.detect",
+		"scan.csi_health":      "monitor.scan",
+		"scan.metrics_update":  "monitor.scan",
+	} {
+		got, ok := parents[name]
+		if !ok || got != parent {
+			t.Fatalf("span %q: parent %q (recorded %v), want %q", name, got, ok, parent)
+		}
+	}
+}
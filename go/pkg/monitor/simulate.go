@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Actions Simulate applies.
+const (
+	// SimulateCleanupSafeOrphans deletes what the snapshot cleanup deletes
+	// without an explicit list: every orphaned TrueNAS snapshot, and nothing
+	// when the scan was partial.
+	SimulateCleanupSafeOrphans = "cleanup_safe_orphans"
+	// SimulateEnforceRetention deletes the TrueNAS snapshots older than the
+	// snapshot retention that no VolumeSnapshot references, the snapshots
+	// the scan reports as orphaned for exceeding the retention.
+	SimulateEnforceRetention = "enforce_retention"
+)
+
+// SimulationActions lists the actions Simulate accepts.
+var SimulationActions = []string{SimulateCleanupSafeOrphans, SimulateEnforceRetention}
+
+// Simulation is the projected state of the pools after applying cleanup
+// actions to a scan. Nothing is deleted.
+type Simulation struct {
+	ScanTimestamp  time.Time          `json:"scan_timestamp"`
+	Actions        []SimulatedAction  `json:"actions"`
+	Snapshots      int                `json:"snapshots"`
+	ReclaimedBytes int64              `json:"reclaimed_bytes"`
+	Pools          []SimulatedPool    `json:"pools"`
+	Namespaces     []NamespaceReclaim `json:"namespaces"`
+	Notes          []string           `json:"notes"`
+}
+
+// SimulatedAction is what one action selects. Snapshots selected by
+// several actions are reclaimed once in the totals.
+type SimulatedAction struct {
+	Action         string `json:"action"`
+	Snapshots      int    `json:"snapshots"`
+	ReclaimedBytes int64  `json:"reclaimed_bytes"`
+	// Skipped explains why the action selected nothing, as the real
+	// cleanup would refuse to run.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// SimulatedPool is the current and projected usage of a pool.
+// GrowthBytesPerDay is the change of used bytes per day between the last
+// two scans; it and the days until full are nil when unknown or when the
+// pool is not growing.
+type SimulatedPool struct {
+	Pool                        string   `json:"pool"`
+	Size                        int64    `json:"size"`
+	Used                        int64    `json:"used"`
+	ProjectedUsed               int64    `json:"projected_used"`
+	ReclaimedBytes              int64    `json:"reclaimed_bytes"`
+	UtilizationPercent          float64  `json:"utilization_percent"`
+	ProjectedUtilizationPercent float64  `json:"projected_utilization_percent"`
+	GrowthBytesPerDay           *float64 `json:"growth_bytes_per_day"`
+	DaysUntilFull               *float64 `json:"days_until_full"`
+	ProjectedDaysUntilFull      *float64 `json:"projected_days_until_full"`
+}
+
+// NamespaceReclaim is the space reclaimed from snapshots of the PVs of a
+// namespace. Namespace is "" for snapshots of datasets no bound PV uses.
+type NamespaceReclaim struct {
+	Namespace      string `json:"namespace"`
+	Snapshots      int    `json:"snapshots"`
+	ReclaimedBytes int64  `json:"reclaimed_bytes"`
+}
+
+// ParseSimulationActions splits a comma-separated action list, rejecting
+// unknown and missing actions.
+func ParseSimulationActions(list string) ([]string, error) {
+	var actions []string
+	seen := map[string]bool{}
+	for _, action := range strings.Split(list, ",") {
+		action = strings.TrimSpace(action)
+		if action == "" || seen[action] {
+			continue
+		}
+		known := false
+		for _, name := range SimulationActions {
+			known = known || name == action
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown action %q; use %s", action, strings.Join(SimulationActions, ", "))
+		}
+		seen[action] = true
+		actions = append(actions, action)
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("no action given; use %s", strings.Join(SimulationActions, ", "))
+	}
+	return actions, nil
+}
+
+// Simulate applies actions to the scan of state and projects the pool
+// usage. It reads nothing but the scan state. Growth comes from the pool
+// deltas of the last scan diff.
+func Simulate(state *ScanState, actions []string) *Simulation {
+	result := state.Result
+	sim := &Simulation{
+		ScanTimestamp: result.Timestamp,
+		Actions:       []SimulatedAction{},
+		Pools:         []SimulatedPool{},
+		Namespaces:    []NamespaceReclaim{},
+		Notes: []string{
+			"snapshot sizes count the blocks unique to each snapshot; deleting several snapshots of a dataset can free more",
+			"the hands-off check for snapshots democratic-csi is operating on runs at deletion time and is not simulated",
+		},
+	}
+	if result.Stale {
+		sim.Notes = append(sim.Notes, "the scan is stale")
+	}
+
+	selected := map[string]OrphanedResource{}
+	for _, action := range actions {
+		simulated := SimulatedAction{Action: action}
+		if result.Partial {
+			simulated.Skipped = "the scan was partial; cleanup refuses to delete after a partial orphan detection"
+		} else {
+			for _, resource := range result.OrphanedSnapshots {
+				if resource.Type != "TrueNASSnapshot" {
+					continue
+				}
+				simulated.Snapshots++
+				simulated.ReclaimedBytes += resource.SizeBytes
+				selected[resource.Name] = resource
+			}
+		}
+		sim.Actions = append(sim.Actions, simulated)
+	}
+
+	poolReclaim := map[string]int64{}
+	namespaces := map[string]*NamespaceReclaim{}
+	for name, resource := range selected {
+		sim.Snapshots++
+		sim.ReclaimedBytes += resource.SizeBytes
+		pool, _, _ := strings.Cut(name, "/")
+		poolReclaim[pool] += resource.SizeBytes
+		namespace := resource.Details["claim_namespace"]
+		reclaim, ok := namespaces[namespace]
+		if !ok {
+			reclaim = &NamespaceReclaim{Namespace: namespace}
+			namespaces[namespace] = reclaim
+		}
+		reclaim.Snapshots++
+		reclaim.ReclaimedBytes += resource.SizeBytes
+	}
+	for _, reclaim := range namespaces {
+		sim.Namespaces = append(sim.Namespaces, *reclaim)
+	}
+	sort.Slice(sim.Namespaces, func(i, j int) bool {
+		if sim.Namespaces[i].ReclaimedBytes != sim.Namespaces[j].ReclaimedBytes {
+			return sim.Namespaces[i].ReclaimedBytes > sim.Namespaces[j].ReclaimedBytes
+		}
+		return sim.Namespaces[i].Namespace < sim.Namespaces[j].Namespace
+	})
+
+	growth := poolGrowth(state.Diff)
+	if state.Diff == nil {
+		sim.Notes = append(sim.Notes, "days until full need two scans; they are unknown until the next scan")
+	}
+	for _, pool := range result.Pools {
+		reclaimed := min(poolReclaim[pool.Name], pool.Used)
+		simulated := SimulatedPool{
+			Pool:               pool.Name,
+			Size:               pool.Size,
+			Used:               pool.Used,
+			ProjectedUsed:      pool.Used - reclaimed,
+			ReclaimedBytes:     reclaimed,
+			UtilizationPercent: pool.UtilizationPercent,
+		}
+		if pool.Size > 0 {
+			simulated.ProjectedUtilizationPercent = float64(simulated.ProjectedUsed) / float64(pool.Size) * 100
+		}
+		if perDay, ok := growth[pool.Name]; ok {
+			simulated.GrowthBytesPerDay = &perDay
+			if perDay > 0 {
+				available := pool.Available
+				if available == 0 {
+					available = max(pool.Size-pool.Used, 0)
+				}
+				days := float64(available) / perDay
+				projected := float64(available+reclaimed) / perDay
+				simulated.DaysUntilFull = &days
+				simulated.ProjectedDaysUntilFull = &projected
+			}
+		}
+		sim.Pools = append(sim.Pools, simulated)
+	}
+	return sim
+}
+
+// poolGrowth returns the used bytes per day each pool grew by between the
+// scans of diff; pools without a delta are missing.
+func poolGrowth(diff *ScanDiff) map[string]float64 {
+	if diff == nil || !diff.To.After(diff.From) || diff.From.IsZero() {
+		return nil
+	}
+	days := diff.To.Sub(diff.From).Hours() / 24
+	growth := map[string]float64{}
+	for _, delta := range diff.PoolDeltas {
+		growth[delta.Pool] = float64(delta.UsedBytesDelta) / days
+	}
+	return growth
+}
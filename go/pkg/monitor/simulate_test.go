@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+)
+
+func TestSimulate(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	previous := &ScanResult{
+		Timestamp: now.Add(-48 * time.Hour),
+		Pools:     []analysis.PoolUsage{{Name: "tank", Size: 1000, Used: 400, Available: 600}},
+	}
+	current := &ScanResult{
+		Timestamp: now,
+		Pools: []analysis.PoolUsage{
+			{Name: "tank", Size: 1000, Used: 600, Available: 400, UtilizationPercent: 60},
+			{Name: "cold", Size: 100, Used: 10, Available: 90, UtilizationPercent: 10},
+		},
+		OrphanedSnapshots: []OrphanedResource{
+			{Type: "TrueNASSnapshot", Name: "tank/k8s/pvc-a@old", SizeBytes: 100, Details: map[string]string{"claim_namespace": "apps"}},
+			{Type: "TrueNASSnapshot", Name: "tank/k8s/pvc-stray@old", SizeBytes: 50},
+			{Type: "VolumeSnapshot", Name: "snap", Namespace: "apps"},
+		},
+	}
+	sim := Simulate(&ScanState{Result: current, Diff: DiffScans(previous, current)}, []string{SimulateCleanupSafeOrphans, SimulateEnforceRetention})
+
+	if !sim.ScanTimestamp.Equal(now) || sim.Snapshots != 2 || sim.ReclaimedBytes != 150 {
+		t.Fatalf("simulation = %+v, want 2 snapshots and 150 bytes from the scan at %v", sim, now)
+	}
+	if len(sim.Actions) != 2 || sim.Actions[1].Snapshots != 2 || sim.Actions[1].ReclaimedBytes != 150 {
+		t.Fatalf("actions = %+v, want each to select both snapshots", sim.Actions)
+	}
+	if len(sim.Namespaces) != 2 || sim.Namespaces[0] != (NamespaceReclaim{Namespace: "apps", Snapshots: 1, ReclaimedBytes: 100}) ||
+		sim.Namespaces[1] != (NamespaceReclaim{Namespace: "", Snapshots: 1, ReclaimedBytes: 50}) {
+		t.Fatalf("namespaces = %+v, want apps then the unattributed snapshot", sim.Namespaces)
+	}
+
+	tank := sim.Pools[0]
+	if tank.Pool != "tank" || tank.ProjectedUsed != 450 || tank.ReclaimedBytes != 150 || tank.ProjectedUtilizationPercent != 45 {
+		t.Fatalf("tank = %+v, want 450 bytes used after reclaiming 150", tank)
+	}
+	// tank grew by 200 bytes in two days: 100 bytes per day.
+	if tank.GrowthBytesPerDay == nil || *tank.GrowthBytesPerDay != 100 ||
+		tank.DaysUntilFull == nil || *tank.DaysUntilFull != 4 ||
+		tank.ProjectedDaysUntilFull == nil || *tank.ProjectedDaysUntilFull != 5.5 {
+		t.Fatalf("tank growth = %v, days until full %v, projected %v; want 100, 4 and 5.5",
+			tank.GrowthBytesPerDay, tank.DaysUntilFull, tank.ProjectedDaysUntilFull)
+	}
+	cold := sim.Pools[1]
+	if cold.ReclaimedBytes != 0 || cold.ProjectedUsed != 10 || cold.DaysUntilFull != nil {
+		t.Fatalf("cold = %+v, want it unchanged without a growth estimate", cold)
+	}
+}
+
+func TestSimulate_partialScanReclaimsNothing(t *testing.T) {
+	result := &ScanResult{
+		Partial:           true,
+		OrphanedSnapshots: []OrphanedResource{{Type: "TrueNASSnapshot", Name: "tank/k8s/pvc-a@old", SizeBytes: 100}},
+	}
+	sim := Simulate(&ScanState{Result: result}, []string{SimulateCleanupSafeOrphans})
+
+	if sim.ReclaimedBytes != 0 || sim.Actions[0].Skipped == "" {
+		t.Fatalf("simulation = %+v, want the action skipped", sim)
+	}
+}
+
+func TestParseSimulationActions(t *testing.T) {
+	actions, err := ParseSimulationActions("enforce_retention, cleanup_safe_orphans,enforce_retention")
+	if err != nil || len(actions) != 2 || actions[0] != SimulateEnforceRetention {
+		t.Fatalf("actions = %v, err %v; want both actions once", actions, err)
+	}
+	if _, err := ParseSimulationActions("delete_everything"); err == nil {
+		t.Fatal("unknown action accepted")
+	}
+	if _, err := ParseSimulationActions(""); err == nil {
+		t.Fatal("empty action list accepted")
+	}
+}
@@ -0,0 +1,298 @@
+package monitor
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// scanLoopStaleFactor is how many scan intervals the scan loop heartbeat
+	// may age before the loop counts as unhealthy.
+	scanLoopStaleFactor = 2
+	// maxWatchdogInterval caps how often the watchdog re-evaluates the
+	// heartbeat, so long scan intervals still update the gauge promptly.
+	maxWatchdogInterval = 30 * time.Second
+	// scanLoopStopWait bounds how long a restart waits for the old loop to
+	// return. A loop still stuck after that is abandoned; it exits once its
+	// blocked call honours the cancelled context.
+	scanLoopStopWait = 10 * time.Second
+)
+
+// ErrServiceNotRunning is returned by RestartScanLoop before Start or after
+// Stop.
+var ErrServiceNotRunning = errors.New("monitor service is not running")
+
+// scanLoop is the watchdog state of the scan loop.
+type scanLoop struct {
+	mu sync.Mutex
+	// restartMu serializes restarts.
+	restartMu sync.Mutex
+	parent    context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	// generation identifies the current loop, so an abandoned loop that
+	// returns late neither beats nor marks the current loop stopped.
+	generation int
+	running    bool
+	heartbeat  time.Time
+	panics     int
+	restarts   int
+	// unhealthy is the watchdog's last verdict, for logging transitions.
+	unhealthy bool
+}
+
+// ScanLoopHealth reports whether the scan loop is alive.
+type ScanLoopHealth struct {
+	Healthy       bool      `json:"healthy"`
+	Running       bool      `json:"running"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	// MaxHeartbeatAge is twice the scan interval.
+	MaxHeartbeatAge string `json:"max_heartbeat_age"`
+	Panics          int    `json:"panics"`
+	Restarts        int    `json:"restarts"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// startScanLoop starts a new scan loop under parent. The caller holds s.mu.
+func (s *Service) startScanLoop(parent context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+
+	s.loop.mu.Lock()
+	s.loop.generation++
+	generation := s.loop.generation
+	done := make(chan struct{})
+	s.loop.parent = parent
+	s.loop.cancel = cancel
+	s.loop.done = done
+	s.loop.running = true
+	s.loop.heartbeat = s.clock.Now()
+	s.loop.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer close(done)
+		defer s.scanLoopExited(generation)
+		s.monitorLoop(ctx, generation)
+	}()
+}
+
+func (s *Service) scanLoopExited(generation int) {
+	s.loop.mu.Lock()
+	defer s.loop.mu.Unlock()
+	if generation == s.loop.generation {
+		s.loop.running = false
+	}
+}
+
+// beat records that the loop with the given generation is alive.
+func (s *Service) beat(generation int) {
+	s.loop.mu.Lock()
+	defer s.loop.mu.Unlock()
+	if generation == s.loop.generation {
+		s.loop.heartbeat = s.clock.Now()
+	}
+}
+
+// runScan runs one scan, recovering a panic so it is logged with its stack
+// and counted instead of killing the scan loop.
+func (s *Service) runScan(ctx context.Context, generation int) {
+	defer s.beat(generation)
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		s.logger.Error("Recovered from panic in scan",
+			zap.Any("panic", recovered),
+			zap.ByteString("stack", debug.Stack()),
+		)
+		s.loop.mu.Lock()
+		s.loop.panics++
+		s.loop.mu.Unlock()
+		if s.metricsExporter != nil {
+			s.metricsExporter.IncScanPanic()
+		}
+	}()
+	s.performScan(ctx)
+}
+
+// ScanLoopHealth reports the scan loop as unhealthy when it is not running
+// or its heartbeat is older than twice the scan interval.
+func (s *Service) ScanLoopHealth() ScanLoopHealth {
+	maxAge := scanLoopStaleFactor * s.scanInterval
+
+	s.loop.mu.Lock()
+	health := ScanLoopHealth{
+		Running:         s.loop.running,
+		LastHeartbeat:   s.loop.heartbeat,
+		MaxHeartbeatAge: maxAge.String(),
+		Panics:          s.loop.panics,
+		Restarts:        s.loop.restarts,
+	}
+	s.loop.mu.Unlock()
+
+	switch age := s.clock.Now().Sub(health.LastHeartbeat); {
+	case !health.Running:
+		health.Reason = "scan loop is not running"
+	case maxAge > 0 && age > maxAge:
+		health.Reason = "last heartbeat was " + age.Round(time.Second).String() + " ago"
+	default:
+		health.Healthy = true
+	}
+	return health
+}
+
+// RestartScanLoop stops the current scan loop, waiting up to
+// scanLoopStopWait for it to return, and starts a new one that scans
+// immediately.
+func (s *Service) RestartScanLoop() error {
+	s.loop.restartMu.Lock()
+	defer s.loop.restartMu.Unlock()
+
+	s.loop.mu.Lock()
+	cancel, done := s.loop.cancel, s.loop.done
+	s.loop.mu.Unlock()
+	if cancel == nil {
+		return ErrServiceNotRunning
+	}
+
+	// Not under s.mu: the old loop may need it to finish its scan.
+	cancel()
+	timer := time.NewTimer(scanLoopStopWait)
+	select {
+	case <-done:
+		timer.Stop()
+	case <-timer.C:
+		s.logger.Warn("Scan loop did not stop in time; starting a new one anyway", zap.Duration("waited", scanLoopStopWait))
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.running {
+		return ErrServiceNotRunning
+	}
+	s.loop.mu.Lock()
+	s.loop.restarts++
+	parent := s.loop.parent
+	s.loop.mu.Unlock()
+
+	s.startScanLoop(parent)
+	if s.metricsExporter != nil {
+		s.metricsExporter.IncScanLoopRestart()
+	}
+	s.logger.Warn("Scan loop restarted")
+	return nil
+}
+
+// watchdogInterval is how often the watchdog checks the heartbeat.
+func (s *Service) watchdogInterval() time.Duration {
+	if interval := s.scanInterval / 2; interval < maxWatchdogInterval {
+		return interval
+	}
+	return maxWatchdogInterval
+}
+
+// watchdogLoop exports the scan loop health and logs when it changes.
+func (s *Service) watchdogLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.watchdogInterval())
+	defer ticker.Stop()
+
+	for {
+		s.checkScanLoop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) checkScanLoop() {
+	health := s.ScanLoopHealth()
+	if s.metricsExporter != nil {
+		s.metricsExporter.SetScanLoopHealthy(health.Healthy)
+	}
+
+	s.loop.mu.Lock()
+	wasUnhealthy := s.loop.unhealthy
+	s.loop.unhealthy = !health.Healthy
+	s.loop.mu.Unlock()
+
+	switch {
+	case !health.Healthy && !wasUnhealthy:
+		s.logger.Error("Scan loop is unhealthy",
+			zap.String("reason", health.Reason),
+			zap.Time("last_heartbeat", health.LastHeartbeat),
+		)
+	case health.Healthy && wasUnhealthy:
+		s.logger.Info("Scan loop is healthy again")
+	}
+}
+
+// storePingTimeout bounds the state store check of a readiness probe.
+const storePingTimeout = 5 * time.Second
+
+// ReadyHandler answers the monitor's readiness probe: 200 while the scan
+// loop is healthy and the state store, if any, answers, 503 otherwise, with
+// the ScanLoopHealth as JSON.
+func (s *Service) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := s.ScanLoopHealth()
+		status, code := "ready", http.StatusOK
+		if !health.Healthy {
+			status, code = "not ready", http.StatusServiceUnavailable
+		}
+		body := map[string]interface{}{"status": status, "scan_loop": health}
+		if s.stateStore != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), storePingTimeout)
+			defer cancel()
+			if err := s.stateStore.Ping(ctx); err != nil {
+				body["status"], code = "not ready", http.StatusServiceUnavailable
+				body["store_error"] = err.Error()
+			}
+		}
+		writeJSON(w, code, body)
+	})
+}
+
+// RestartScanLoopHandler restarts the scan loop for a request carrying
+// token as a bearer token. It refuses every request when token is empty.
+func (s *Service) RestartScanLoopHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "admin endpoints are disabled; set security.admin_token to enable them"})
+			return
+		}
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			s.logger.Warn("Scan loop restart rejected: invalid credentials", zap.String("remote_addr", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid admin token"})
+			return
+		}
+		if err := s.RestartScanLoop(); err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "restarted", "scan_loop": s.ScanLoopHealth()})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
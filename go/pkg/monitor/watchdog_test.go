@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+// panickingTrueNASClient panics on the first ListVolumes call.
+type panickingTrueNASClient struct {
+	*truenastest.Client
+	calls atomic.Int32
+}
+
+func (p *panickingTrueNASClient) ListVolumes(ctx context.Context) ([]truenas.Volume, error) {
+	if p.calls.Add(1) == 1 {
+		panic("nil map in volume decoder")
+	}
+	return p.Client.ListVolumes(ctx)
+}
+
+func newWatchdogTestService(t *testing.T, exporter *metrics.Exporter, fakeClock *clock.Fake) *Service {
+	t.Helper()
+	logger, err := logging.NewLogger(logging.Config{Level: "fatal", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	svc, err := NewService(Config{
+		K8sClient:       &k8stest.Client{},
+		TruenasClient:   &panickingTrueNASClient{Client: &truenastest.Client{}},
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Hour,
+		Clock:           fakeClock,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return svc
+}
+
+func TestService_RunScan_RecoversPanic(t *testing.T) {
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: 0, Path: "/metrics"})
+	svc := newWatchdogTestService(t, exporter, clock.NewFake(time.Now()))
+
+	svc.runScan(context.Background(), 0)
+	if svc.GetLastScanResult() != nil {
+		t.Fatal("a panicked scan must not store a result")
+	}
+	svc.runScan(context.Background(), 0)
+	if svc.GetLastScanResult() == nil {
+		t.Fatal("the scan after a panic should succeed")
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var panics float64
+	for _, family := range families {
+		if family.GetName() == "truenas_monitor_scan_panics_total" {
+			panics = family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	if panics != 1 {
+		t.Fatalf("truenas_monitor_scan_panics_total = %v, want 1", panics)
+	}
+}
+
+func TestService_ScanLoopWatchdogAndRestart(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	svc := newWatchdogTestService(t, nil, fakeClock)
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		svc.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rec.Code
+	}
+	restart := func(authorization string, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/scan-loop/restart", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		svc.RestartScanLoopHandler(token).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("ready before Start = %d, want 503", code)
+	}
+	if err := svc.RestartScanLoop(); err != ErrServiceNotRunning {
+		t.Fatalf("RestartScanLoop before Start = %v, want ErrServiceNotRunning", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := svc.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = svc.Stop(context.Background()) }()
+
+	// The first scan panics; the loop must survive it.
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.ScanLoopHealth().Panics == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first scan did not run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("ready after a recovered panic = %d, want 200", code)
+	}
+
+	fakeClock.Advance(2*time.Hour + time.Second)
+	health := svc.ScanLoopHealth()
+	if health.Healthy || !health.Running || health.Reason == "" {
+		t.Fatalf("stale heartbeat health = %+v, want unhealthy with a reason", health)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("ready with a stale heartbeat = %d, want 503", code)
+	}
+
+	if code := restart("", ""); code != http.StatusForbidden {
+		t.Fatalf("restart without admin token configured = %d, want 403", code)
+	}
+	if code := restart("Bearer wrong", "secret"); code != http.StatusUnauthorized {
+		t.Fatalf("restart with wrong token = %d, want 401", code)
+	}
+	if code := restart("Bearer secret", "secret"); code != http.StatusOK {
+		t.Fatalf("restart = %d, want 200", code)
+	}
+	health = svc.ScanLoopHealth()
+	if !health.Healthy || health.Restarts != 1 {
+		t.Fatalf("health after restart = %+v, want healthy with 1 restart", health)
+	}
+}
@@ -0,0 +1,144 @@
+package orphan
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// SnapshotContentType is the orphan type of dangling VolumeSnapshotContents.
+const SnapshotContentType = "VolumeSnapshotContent"
+
+// detectDanglingSnapshotContents lists VolumeSnapshotContents and returns the
+// dangling ones (see danglingSnapshotContents). A failed list is logged and
+// yields none, so clusters without the snapshot CRDs or the list permission
+// keep the rest of the snapshot detection.
+func (d *Detector) detectDanglingSnapshotContents(
+	ctx context.Context,
+	namespace string,
+	k8sSnapshots []k8sSnapshotRecord,
+	truenasSnapshots []truenas.Snapshot,
+	phases *phaseRecorder,
+) []OrphanedResource {
+	var contents []snapshotv1.VolumeSnapshotContent
+	start := phases.start()
+	err := runPhase(ctx, "k8s_snapshot_contents", d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+		var err error
+		contents, err = d.k8sClient.ListVolumeSnapshotContents(ctx)
+		return err
+	})
+	phases.record("k8s_snapshot_contents", start, len(contents))
+	if err != nil {
+		d.logger.WithError(err).Warn("Failed to list VolumeSnapshotContents; skipping dangling content detection")
+		return nil
+	}
+	return danglingSnapshotContents(contents, namespace, k8sSnapshots, truenasSnapshots,
+		d.now(), d.ageThreshold(d.config.Thresholds.VolumeSnapshot))
+}
+
+// danglingSnapshotContents returns the contents at least threshold old whose
+// snapshot handle names a ZFS snapshot that does not exist and whose bound
+// VolumeSnapshot is gone. Both must hold: a content whose VolumeSnapshot
+// remains is reported through the VolumeSnapshot, and one whose ZFS snapshot
+// remains is still restorable. Only handles of the form dataset@snapshot are
+// judged; others, such as detached snapshots stored as datasets, are never
+// reported. With a namespace, only contents bound into it are checked, since
+// only its VolumeSnapshots were listed.
+func danglingSnapshotContents(
+	contents []snapshotv1.VolumeSnapshotContent,
+	namespace string,
+	k8sSnapshots []k8sSnapshotRecord,
+	truenasSnapshots []truenas.Snapshot,
+	now time.Time,
+	threshold time.Duration,
+) []OrphanedResource {
+	snapshots := make(map[string]string, len(k8sSnapshots))
+	for _, snapshot := range k8sSnapshots {
+		snapshots[snapshot.Namespace+"/"+snapshot.Name] = snapshot.UID
+	}
+	zfs := make(map[string]bool, 2*len(truenasSnapshots))
+	for _, snapshot := range truenasSnapshots {
+		// Index every suffix after a "/", so handles relative to a
+		// parent dataset match too.
+		for name := truenasSnapshotFullName(snapshot); name != ""; {
+			zfs[name] = true
+			idx := strings.Index(name, "/")
+			if idx < 0 {
+				break
+			}
+			name = name[idx+1:]
+		}
+	}
+
+	var dangling []OrphanedResource
+	for i := range contents {
+		content := &contents[i]
+		ref := content.Spec.VolumeSnapshotRef
+		if namespace != "" && ref.Namespace != namespace {
+			continue
+		}
+		created := content.CreationTimestamp.Time
+		if !olderThan(created, now, threshold) {
+			continue
+		}
+		handle := snapshotContentHandle(content)
+		if !strings.Contains(handle, "@") || zfs[handle] {
+			continue
+		}
+		bound := ref.Namespace + "/" + ref.Name
+		if uid, ok := snapshots[bound]; ok && (ref.UID == "" || string(ref.UID) == uid) {
+			continue
+		}
+
+		policy := string(content.Spec.DeletionPolicy)
+		orphan := OrphanedResource{
+			Type:        SnapshotContentType,
+			Name:        content.Name,
+			UID:         string(content.UID),
+			Age:         now.Sub(created),
+			Reason:      "ZFS snapshot " + handle + " and VolumeSnapshot " + bound + " no longer exist",
+			Labels:      content.Labels,
+			Annotations: content.Annotations,
+			CreatedAt:   created,
+			Details: map[string]string{
+				"snapshot_handle": handle,
+				"volume_snapshot": bound,
+				"deletion_policy": policy,
+				"remediation":     snapshotContentRemediation(policy),
+			},
+		}
+		if content.Spec.Source.VolumeHandle != nil {
+			orphan.VolumeHandle = *content.Spec.Source.VolumeHandle
+		}
+		if content.Spec.VolumeSnapshotClassName != nil {
+			orphan.Details["volume_snapshot_class"] = *content.Spec.VolumeSnapshotClassName
+		}
+		dangling = append(dangling, orphan)
+	}
+	return dangling
+}
+
+// snapshotContentHandle returns the snapshot handle the driver reported, or
+// the one a pre-provisioned content was created with.
+func snapshotContentHandle(content *snapshotv1.VolumeSnapshotContent) string {
+	if content.Status != nil && content.Status.SnapshotHandle != nil {
+		return *content.Status.SnapshotHandle
+	}
+	if content.Spec.Source.SnapshotHandle != nil {
+		return *content.Spec.Source.SnapshotHandle
+	}
+	return ""
+}
+
+// snapshotContentRemediation describes how to remove a dangling content
+// given its deletion policy.
+func snapshotContentRemediation(policy string) string {
+	if policy == string(snapshotv1.VolumeSnapshotContentRetain) {
+		return "delete the VolumeSnapshotContent; its deletionPolicy is Retain, so the cleanup API requires force"
+	}
+	return "delete the VolumeSnapshotContent; the CSI driver's delete of the missing ZFS snapshot is a no-op"
+}
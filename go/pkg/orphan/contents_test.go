@@ -0,0 +1,70 @@
+package orphan
+
+import (
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func testSnapshotContent(name, namespace, snapshot, handle string, policy snapshotv1.DeletionPolicy, created time.Time) snapshotv1.VolumeSnapshotContent {
+	return snapshotv1.VolumeSnapshotContent{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name), CreationTimestamp: metav1.NewTime(created)},
+		Spec: snapshotv1.VolumeSnapshotContentSpec{
+			VolumeSnapshotRef: corev1.ObjectReference{Namespace: namespace, Name: snapshot, UID: types.UID("uid-" + snapshot)},
+			DeletionPolicy:    policy,
+		},
+		Status: &snapshotv1.VolumeSnapshotContentStatus{SnapshotHandle: &handle},
+	}
+}
+
+func TestDanglingSnapshotContents(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	contents := []snapshotv1.VolumeSnapshotContent{
+		testSnapshotContent("dangling", "apps", "snap-a", "tank/k8s/pvc-a@snap-a", snapshotv1.VolumeSnapshotContentDelete, old),
+		testSnapshotContent("retained", "apps", "snap-b", "pvc-b@snap-b", snapshotv1.VolumeSnapshotContentRetain, old),
+		testSnapshotContent("zfs-remains", "apps", "snap-c", "k8s/pvc-c@snap-c", snapshotv1.VolumeSnapshotContentDelete, old),
+		testSnapshotContent("snapshot-remains", "apps", "snap-d", "tank/k8s/pvc-d@snap-d", snapshotv1.VolumeSnapshotContentDelete, old),
+		testSnapshotContent("recreated-snapshot", "apps", "snap-e", "tank/k8s/pvc-e@snap-e", snapshotv1.VolumeSnapshotContentDelete, old),
+		testSnapshotContent("too-young", "apps", "snap-f", "tank/k8s/pvc-f@snap-f", snapshotv1.VolumeSnapshotContentDelete, now.Add(-time.Hour)),
+		testSnapshotContent("detached", "apps", "snap-g", "tank/k8s/detached-g", snapshotv1.VolumeSnapshotContentDelete, old),
+		testSnapshotContent("other-namespace", "db", "snap-h", "tank/k8s/pvc-h@snap-h", snapshotv1.VolumeSnapshotContentDelete, old),
+	}
+	k8sSnapshots := []k8sSnapshotRecord{
+		{Namespace: "apps", Name: "snap-d", UID: "uid-snap-d"},
+		{Namespace: "apps", Name: "snap-e", UID: "uid-new"},
+	}
+	truenasSnapshots := []truenas.Snapshot{{Name: "tank/k8s/pvc-c@snap-c", Dataset: "tank/k8s/pvc-c"}}
+
+	dangling := danglingSnapshotContents(contents, "apps", k8sSnapshots, truenasSnapshots, now, 24*time.Hour)
+
+	var names []string
+	for _, orphan := range dangling {
+		names = append(names, orphan.Name)
+		if orphan.Type != SnapshotContentType || orphan.Age != 48*time.Hour {
+			t.Fatalf("unexpected orphan: %+v", orphan)
+		}
+	}
+	want := []string{"dangling", "retained", "recreated-snapshot"}
+	if len(names) != len(want) {
+		t.Fatalf("dangling = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("dangling = %v, want %v", names, want)
+		}
+	}
+	if details := dangling[1].Details; details["deletion_policy"] != "Retain" || details["volume_snapshot"] != "apps/snap-b" {
+		t.Fatalf("unexpected details: %+v", details)
+	}
+
+	if all := danglingSnapshotContents(contents, "", k8sSnapshots, truenasSnapshots, now, 24*time.Hour); len(all) != 4 {
+		t.Fatalf("all namespaces = %d dangling, want 4", len(all))
+	}
+}
@@ -2,15 +2,23 @@ package orphan
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
 	"time"
 
-	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"go.uber.org/zap"
 
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
 )
 
@@ -20,13 +28,85 @@ type Detector struct {
 	truenasClient truenas.Client
 	logger        *logging.Logger
 	config        Config
+	// namespaces schedules VolumeSnapshot correlation per namespace; nil
+	// correlates every namespace on every detection.
+	namespaces *namespaceScheduler
 }
 
-// Config holds detector configuration
+// Config holds detector configuration.
+//
+// AgeThreshold and SnapshotRetention are inclusive: a resource whose age is
+// exactly the threshold is eligible to be reported.
 type Config struct {
 	AgeThreshold      time.Duration
 	SnapshotRetention time.Duration
+	// Thresholds override AgeThreshold and SnapshotRetention per resource
+	// type. They are inclusive too.
+	Thresholds AgeThresholds
 	DryRun            bool
+	PhaseTimeouts     PhaseTimeouts
+	Exclusions        Exclusions
+	// StrictSnapshots also evaluates TrueNAS snapshots created by periodic
+	// snapshot tasks or received by replication tasks. By default they are
+	// skipped and counted in DetectionResult.ManagedByTrueNAS.
+	StrictSnapshots bool
+	// NamespacePriority limits cluster-wide VolumeSnapshot correlation to
+	// the most active namespaces and a rotating share of the rest. Copies
+	// made by WithAgeThreshold and WithThresholds correlate every namespace.
+	NamespacePriority NamespacePriority
+	// Clock supplies the current time for age checks. Nil uses the real clock.
+	Clock clock.Clock
+	// Logger receives detection logs tagged component=orphan. Nil discards
+	// them.
+	Logger *logging.Logger
+}
+
+// MinAgeThreshold is the smallest age threshold configuration accepts, so a
+// typo cannot make freshly provisioned resources look orphaned.
+const MinAgeThreshold = 10 * time.Minute
+
+// CorrelationUnknown is the "status" detail of PVs whose volume handle does
+// not parse.
+const CorrelationUnknown = "correlation_unknown"
+
+// MigratedToAnnotation is set on PVs migrated from an in-tree volume plugin
+// to a CSI driver.
+const MigratedToAnnotation = "pv.kubernetes.io/migrated-to"
+
+// AgeThresholds are per-type age thresholds. A zero field falls back to
+// Config.AgeThreshold, except TrueNASSnapshot, which falls back to
+// Config.SnapshotRetention.
+type AgeThresholds struct {
+	PersistentVolume      time.Duration
+	PersistentVolumeClaim time.Duration
+	VolumeSnapshot        time.Duration
+	TrueNASSnapshot       time.Duration
+	// TrueNASVolume applies to managed TrueNAS datasets no PV references.
+	TrueNASVolume time.Duration
+}
+
+// PhaseTimeouts bounds individual detection phases. Zero disables a bound.
+type PhaseTimeouts struct {
+	K8sList     time.Duration
+	TrueNASList time.Duration
+	Correlation time.Duration
+}
+
+// PhaseTimeoutError reports a detection phase that exceeded its configured budget.
+type PhaseTimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("phase %s exceeded timeout of %s", e.Phase, e.Timeout)
+}
+
+// UnreadableNamespace is a namespace a scan could not list a resource in.
+type UnreadableNamespace struct {
+	Namespace string `json:"namespace"`
+	Resource  string `json:"resource"`
+	Error     string `json:"error"`
 }
 
 // OrphanedResource represents an orphaned resource
@@ -34,14 +114,33 @@ type OrphanedResource struct {
 	Type        string            `json:"type"`
 	Name        string            `json:"name"`
 	Namespace   string            `json:"namespace,omitempty"`
+	// UID is the Kubernetes object UID, or the ZFS GUID for TrueNAS snapshots
+	// when TrueNAS reports one. It distinguishes recreated same-name objects.
+	UID         string            `json:"uid,omitempty"`
 	Age         time.Duration     `json:"age"`
 	Size        string            `json:"size,omitempty"`
+	// SizeBytes is Size in bytes, for ranking orphans by size; 0 when
+	// unknown.
+	SizeBytes   int64             `json:"size_bytes,omitempty"`
 	Reason      string            `json:"reason"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	Annotations map[string]string `json:"annotations,omitempty"`
 	VolumeHandle string           `json:"volume_handle,omitempty"`
 	StorageClass string           `json:"storage_class,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
+	// Details holds type-specific context, such as the latest event and
+	// pending_reason of an unbound PVC, or the claim_namespace of the PV a
+	// TrueNAS snapshot was taken of.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Key identifies an orphan across scans. Resources with a UID are keyed on it,
+// so a deleted and recreated object with the same name gets a new key.
+func (o OrphanedResource) Key() string {
+	if o.UID != "" {
+		return o.Type + "/uid/" + o.UID
+	}
+	return o.Type + "/name/" + o.Namespace + "/" + o.Name
 }
 
 // DetectionResult holds the results of orphan detection
@@ -50,21 +149,98 @@ type DetectionResult struct {
 	OrphanedPVs       []OrphanedResource  `json:"orphaned_pvs"`
 	OrphanedPVCs      []OrphanedResource  `json:"orphaned_pvcs"`
 	OrphanedSnapshots []OrphanedResource  `json:"orphaned_snapshots"`
+	// OrphanedTrueNASVolumes lists managed TrueNAS datasets no PV
+	// references. Datasets whose creation time TrueNAS did not report are
+	// left out, since their age is unknown.
+	OrphanedTrueNASVolumes []OrphanedResource `json:"orphaned_truenas_volumes"`
 	TotalPVs          int                 `json:"total_pvs"`
 	TotalPVCs         int                 `json:"total_pvcs"`
-	TotalSnapshots    int                 `json:"total_snapshots"`
+	// TotalSnapshots is deprecated: it is the sum of TotalK8sSnapshots and
+	// TotalTrueNASSnapshots and will be removed in a future release.
+	TotalSnapshots           int `json:"total_snapshots"`
+	TotalK8sSnapshots        int `json:"total_k8s_snapshots"`
+	TotalTrueNASSnapshots    int `json:"total_truenas_snapshots"`
+	OrphanedK8sSnapshots     int `json:"orphaned_k8s_snapshots"`
+	OrphanedTrueNASSnapshots int `json:"orphaned_truenas_snapshots"`
+	// OrphanedSnapshotContents counts the dangling VolumeSnapshotContents
+	// in OrphanedSnapshots.
+	OrphanedSnapshotContents int `json:"orphaned_snapshot_contents"`
+	// SnapshotCorrelatedAt is when the VolumeSnapshots of each namespace
+	// were last correlated. It is set only with namespace prioritization,
+	// where a namespace's VolumeSnapshot orphans may date from that time.
+	SnapshotCorrelatedAt map[string]time.Time `json:"snapshot_correlated_at,omitempty"`
+	// ManagedByTrueNAS counts TrueNAS snapshots left out of orphan detection
+	// because a periodic snapshot or replication task manages them.
+	ManagedByTrueNAS int `json:"managed_by_truenas"`
 	ScanDuration      time.Duration       `json:"scan_duration"`
 	PhaseTimings      map[string]time.Duration `json:"phase_timings,omitempty"`
+	// PhaseItems counts the objects listed or correlated by each phase.
+	PhaseItems        map[string]int      `json:"phase_items,omitempty"`
+	// PhaseAllocBytes approximates the heap bytes each phase allocated. It is
+	// measured process-wide, so concurrent work inflates it.
+	PhaseAllocBytes map[string]uint64 `json:"phase_alloc_bytes,omitempty"`
+	// PhaseRequests counts the requests each phase sent to each backend,
+	// when the detection context carries an apiusage counter. Phases running
+	// concurrently count each other's requests.
+	PhaseRequests map[string]map[string]int64 `json:"phase_requests,omitempty"`
+	Partial           bool                `json:"partial"`
+	PhaseErrors       map[string]string   `json:"phase_errors,omitempty"`
+	DuplicateVolumeHandles []DuplicateVolumeHandle `json:"duplicate_volume_handles,omitempty"`
+	// UnreadableNamespaces are the namespaces whose PVCs or VolumeSnapshots
+	// could not be listed for lack of permission. Their resources are
+	// missing, so the result is partial.
+	UnreadableNamespaces []UnreadableNamespace `json:"unreadable_namespaces,omitempty"`
+	// NamespaceCoveragePercent is the percentage of namespaces that were
+	// listed in full; nil when every namespace was.
+	NamespaceCoveragePercent *float64 `json:"namespace_coverage_percent,omitempty"`
+	// Inventory counts managed PVs and TrueNAS volumes and the unmatched
+	// ones on each side; nil when PV correlation did not complete.
+	Inventory *InventoryCounts `json:"inventory,omitempty"`
+	// StorageClasses breaks the democratic-csi PVs and their orphans down
+	// by StorageClass, most wasted bytes first; nil when PV correlation did
+	// not complete.
+	StorageClasses []StorageClassUsage `json:"storage_classes,omitempty"`
+	// CorrelationUnknown lists PVs, of any age, whose volume handle does not
+	// parse. They are never reported as orphaned; Details holds status
+	// correlation_unknown, parse_error and, for migrated volumes,
+	// migrated_to.
+	CorrelationUnknown []OrphanedResource `json:"correlation_unknown,omitempty"`
+	// ExportMissing lists NFS PVs whose dataset exists but is unmounted or
+	// not exported by an enabled share. ExportsChecked is false when the
+	// NFS shares could not be listed or no PV uses the NFS driver.
+	ExportMissing  []ExportIssue `json:"export_missing,omitempty"`
+	ExportsChecked bool          `json:"exports_checked"`
+	Deprecated        map[string]string   `json:"deprecated,omitempty"`
+	// Excluded counts orphans matched by Config.Exclusions; they are listed in
+	// ExcludedResources rather than the orphan lists.
+	Excluded          int                 `json:"excluded"`
+	ExcludedResources []OrphanedResource  `json:"excluded_resources,omitempty"`
+
+	// PVPhases maps every democratic-csi PV to its phase, for tracking
+	// phase changes across scans; nil when the PVs could not be listed.
+	PVPhases map[string]string `json:"-"`
+
+	// classes attributes datasets to StorageClasses for StorageClasses.
+	classes *storageClassIndex
+}
+
+// DeprecatedResultFields documents DetectionResult fields kept for compatibility.
+var DeprecatedResultFields = map[string]string{
+	"total_snapshots": "sum of total_k8s_snapshots and total_truenas_snapshots; use those fields instead",
+}
+
+// snapshotTotals counts snapshots seen on each side during detection.
+type snapshotTotals struct {
+	K8s     int
+	TrueNAS int
+	Managed int
 }
 
 // NewDetector creates a new orphan detector
 func NewDetector(k8sClient k8s.Client, truenasClient truenas.Client, config Config) (*Detector, error) {
-	logger, err := logging.NewLogger(logging.Config{
-		Level:    "info",
-		Encoding: "json",
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create logger: %w", err)
+	logger := logging.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger.Component("orphan")
 	}
 
 	// Set default values
@@ -74,17 +250,21 @@ func NewDetector(k8sClient k8s.Client, truenasClient truenas.Client, config Conf
 	if config.SnapshotRetention == 0 {
 		config.SnapshotRetention = 30 * 24 * time.Hour
 	}
+	config.Clock = clock.OrReal(config.Clock)
 
 	return &Detector{
 		k8sClient:     k8sClient,
 		truenasClient: truenasClient,
 		logger:        logger,
 		config:        config,
+		namespaces:    newNamespaceScheduler(config.NamespacePriority),
 	}, nil
 }
 
 // DetectOrphanedResources performs comprehensive orphan detection
 func (d *Detector) DetectOrphanedResources(ctx context.Context, namespace string) (*DetectionResult, error) {
+	ctx, span := tracing.Start(ctx, "orphan.detect")
+	defer span.End()
 	start := time.Now()
 	d.logger.Info("Starting orphaned resource detection",
 		zap.String("namespace", namespace),
@@ -93,68 +273,315 @@ func (d *Detector) DetectOrphanedResources(ctx context.Context, namespace string
 	)
 
 	result := &DetectionResult{
-		Timestamp:    start,
-		PhaseTimings: make(map[string]time.Duration),
+		Timestamp:    d.now(),
+		PhaseTimings:    make(map[string]time.Duration),
+		PhaseItems:      make(map[string]int),
+		PhaseAllocBytes: make(map[string]uint64),
+		PhaseRequests:   make(map[string]map[string]int64),
 	}
+	phases := &phaseRecorder{ctx: ctx, timings: result.PhaseTimings, items: result.PhaseItems, allocs: result.PhaseAllocBytes, requests: result.PhaseRequests}
 
 	// Detect orphaned PVs
-	orphanedPVs, totalPVs, err := d.detectOrphanedPVs(ctx, result.PhaseTimings)
-	if err != nil {
+	orphanedPVs, totalPVs, err := d.detectOrphanedPVs(ctx, phases, result)
+	if err = d.absorbPhaseTimeout(result, err); err != nil {
 		d.logger.WithError(err).Error("Failed to detect orphaned PVs")
+		span.RecordError(err)
 		return nil, fmt.Errorf("failed to detect orphaned PVs: %w", err)
 	}
-	result.OrphanedPVs = orphanedPVs
+	result.OrphanedPVs = d.applyExclusions(result, orphanedPVs)
 	result.TotalPVs = totalPVs
 
 	// Detect orphaned PVCs
-	orphanedPVCs, totalPVCs, err := d.detectOrphanedPVCs(ctx, namespace, result.PhaseTimings)
-	if err != nil {
+	orphanedPVCs, totalPVCs, err := d.detectOrphanedPVCs(ctx, namespace, phases, result)
+	if err = d.absorbPhaseTimeout(result, err); err != nil {
 		d.logger.WithError(err).Error("Failed to detect orphaned PVCs")
+		span.RecordError(err)
 		return nil, fmt.Errorf("failed to detect orphaned PVCs: %w", err)
 	}
-	result.OrphanedPVCs = orphanedPVCs
+	result.OrphanedPVCs = d.applyExclusions(result, orphanedPVCs)
 	result.TotalPVCs = totalPVCs
 
 	// Detect orphaned snapshots
-	orphanedSnapshots, totalSnapshots, err := d.detectOrphanedSnapshots(ctx, namespace, result.PhaseTimings)
-	if err != nil {
+	orphanedSnapshots, snapshotCounts, err := d.detectOrphanedSnapshots(ctx, namespace, phases, result)
+	if err = d.absorbPhaseTimeout(result, err); err != nil {
 		d.logger.WithError(err).Error("Failed to detect orphaned snapshots")
+		span.RecordError(err)
 		return nil, fmt.Errorf("failed to detect orphaned snapshots: %w", err)
 	}
-	result.OrphanedSnapshots = orphanedSnapshots
-	result.TotalSnapshots = totalSnapshots
+	result.OrphanedSnapshots = d.applyExclusions(result, orphanedSnapshots)
+	result.setSnapshotCounts(snapshotCounts)
+	if d.namespaces != nil && namespace == "" {
+		result.SnapshotCorrelatedAt = d.namespaces.correlatedAt()
+	}
+
+	result.classes.attributeNamespaces(result.OrphanedSnapshots)
+	result.StorageClasses = result.classes.breakdown(result)
 
 	result.ScanDuration = time.Since(start)
+	span.SetAttributes(
+		tracing.Int("orphan.orphaned_pvs", len(result.OrphanedPVs)),
+		tracing.Int("orphan.orphaned_pvcs", len(result.OrphanedPVCs)),
+		tracing.Int("orphan.orphaned_snapshots", len(result.OrphanedSnapshots)),
+		tracing.Bool("orphan.partial", result.Partial))
 
 	d.logger.Info("Orphaned resource detection completed",
 		zap.Int("orphaned_pvs", len(result.OrphanedPVs)),
 		zap.Int("orphaned_pvcs", len(result.OrphanedPVCs)),
 		zap.Int("orphaned_snapshots", len(result.OrphanedSnapshots)),
+		zap.Int("orphaned_truenas_volumes", len(result.OrphanedTrueNASVolumes)),
 		zap.Int("total_pvs", result.TotalPVs),
 		zap.Int("total_pvcs", result.TotalPVCs),
 		zap.Int("total_snapshots", result.TotalSnapshots),
+		zap.Int("excluded", result.Excluded),
 		zap.Int64("scan_duration_ms", result.ScanDuration.Milliseconds()),
+		zap.Bool("partial", result.Partial),
 	)
 
 	return result, nil
 }
 
+// setSnapshotCounts fills the per-side snapshot totals and the deprecated sum.
+func (r *DetectionResult) setSnapshotCounts(totals snapshotTotals) {
+	r.TotalK8sSnapshots = totals.K8s
+	r.TotalTrueNASSnapshots = totals.TrueNAS
+	r.TotalSnapshots = totals.K8s + totals.TrueNAS
+	r.ManagedByTrueNAS = totals.Managed
+	r.OrphanedK8sSnapshots = 0
+	r.OrphanedTrueNASSnapshots = 0
+	r.OrphanedSnapshotContents = 0
+	for _, orphan := range r.OrphanedSnapshots {
+		switch orphan.Type {
+		case "VolumeSnapshot":
+			r.OrphanedK8sSnapshots++
+		case "TrueNASSnapshot":
+			r.OrphanedTrueNASSnapshots++
+		case SnapshotContentType:
+			r.OrphanedSnapshotContents++
+		}
+	}
+	r.Deprecated = make(map[string]string, len(DeprecatedResultFields))
+	for field, note := range DeprecatedResultFields {
+		r.Deprecated[field] = note
+	}
+}
+
+// phaseRecorder accumulates the duration, item count, allocated bytes and
+// backend requests of each detection phase and records each phase as a span
+// of the detection trace. A nil recorder records nothing.
+type phaseRecorder struct {
+	ctx      context.Context
+	timings  map[string]time.Duration
+	items    map[string]int
+	allocs   map[string]uint64
+	requests map[string]map[string]int64
+}
+
+// phaseStart is when a phase began and how many heap bytes had been
+// allocated and backend requests sent by then.
+type phaseStart struct {
+	at        time.Time
+	allocated uint64
+	requests  map[string]int64
+}
+
+func (r *phaseRecorder) start() phaseStart {
+	if r == nil {
+		return phaseStart{at: time.Now()}
+	}
+	return phaseStart{at: time.Now(), allocated: allocatedBytes(), requests: apiusage.FromContext(r.ctx).Counts()}
+}
+
+func (r *phaseRecorder) record(phase string, start phaseStart, items int) {
+	if r == nil {
+		return
+	}
+	r.timings[phase] += time.Since(start.at)
+	r.items[phase] += items
+	r.allocs[phase] += allocatedBytes() - start.allocated
+	for backend, count := range apiusage.FromContext(r.ctx).Counts() {
+		if sent := count - start.requests[backend]; sent > 0 {
+			if r.requests[phase] == nil {
+				r.requests[phase] = make(map[string]int64)
+			}
+			r.requests[phase][backend] += sent
+		}
+	}
+	_, span := tracing.Start(r.ctx, "orphan."+phase, tracing.WithTimestamp(start.at),
+		tracing.WithAttributes(tracing.Int("items", items)))
+	span.End()
+}
+
+// allocatedBytes returns the cumulative bytes allocated on the heap. Reading
+// it does not stop the world, unlike runtime.ReadMemStats.
+func allocatedBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// absorbPhaseTimeout records a phase timeout on the result so the scan can
+// continue with partial data. Any other error is returned unchanged.
+func (d *Detector) absorbPhaseTimeout(result *DetectionResult, err error) error {
+	var timeoutErr *PhaseTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		return err
+	}
+
+	result.Partial = true
+	if result.PhaseErrors == nil {
+		result.PhaseErrors = make(map[string]string)
+	}
+	result.PhaseErrors[timeoutErr.Phase] = timeoutErr.Error()
+
+	d.logger.Warn("Detection phase timed out, continuing with partial result",
+		zap.String("phase", timeoutErr.Phase),
+		zap.Duration("timeout", timeoutErr.Timeout),
+	)
+	return nil
+}
+
+// absorbUnreadableNamespaces records the namespaces a list could not read
+// for lack of permission so the scan can continue without them. Any other
+// error is returned unchanged.
+func (d *Detector) absorbUnreadableNamespaces(result *DetectionResult, err error) error {
+	var unreadable *k8s.UnreadableNamespacesError
+	if !errors.As(err, &unreadable) {
+		return err
+	}
+
+	result.Partial = true
+	recorded := make(map[string]bool, len(result.UnreadableNamespaces))
+	for _, ns := range result.UnreadableNamespaces {
+		recorded[ns.Resource+"/"+ns.Namespace] = true
+	}
+	for _, name := range unreadable.Names() {
+		if !recorded[unreadable.Resource+"/"+name] {
+			result.UnreadableNamespaces = append(result.UnreadableNamespaces, UnreadableNamespace{
+				Namespace: name,
+				Resource:  unreadable.Resource,
+				Error:     unreadable.Namespaces[name],
+			})
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, ns := range result.UnreadableNamespaces {
+		names[ns.Namespace] = true
+	}
+	total := unreadable.Total
+	if total < len(names) {
+		total = len(names)
+	}
+	coverage := 100 * float64(total-len(names)) / float64(total)
+	coverage = math.Round(coverage*10) / 10
+	result.NamespaceCoveragePercent = &coverage
+
+	d.logger.Warn("Namespaces could not be listed, continuing without them",
+		zap.String("resource", unreadable.Resource),
+		zap.Strings("namespaces", unreadable.Names()),
+		zap.Float64("namespace_coverage_percent", coverage),
+	)
+	return nil
+}
+
+// runPhase calls fn under the given phase timeout. A deadline hit by the phase
+// itself, rather than by the caller's context, is reported as *PhaseTimeoutError.
+func runPhase(ctx context.Context, phase string, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	phaseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(phaseCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(phaseCtx.Err(), context.DeadlineExceeded) {
+		return &PhaseTimeoutError{Phase: phase, Timeout: timeout}
+	}
+	return err
+}
+
+// now returns the current time from the configured clock.
+func (d *Detector) now() time.Time {
+	return clock.OrReal(d.config.Clock).Now()
+}
+
+// quantityBytes parses a Kubernetes storage quantity such as "10Gi"; it
+// returns 0 for an empty or malformed one.
+func quantityBytes(size string) int64 {
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0
+	}
+	return quantity.Value()
+}
+
+// olderThan reports whether created is at least age before now. The bound is
+// inclusive so a resource created exactly age ago qualifies.
+func olderThan(created, now time.Time, age time.Duration) bool {
+	return !created.After(now.Add(-age))
+}
+
 // Thresholds returns the detector's configured age and snapshot retention thresholds.
 func (d *Detector) Thresholds() (time.Duration, time.Duration) {
 	return d.config.AgeThreshold, d.config.SnapshotRetention
 }
 
+// TypeThresholds returns the age threshold used for each resource type, with
+// fallbacks resolved.
+func (d *Detector) TypeThresholds() AgeThresholds {
+	return AgeThresholds{
+		PersistentVolume:      d.ageThreshold(d.config.Thresholds.PersistentVolume),
+		PersistentVolumeClaim: d.ageThreshold(d.config.Thresholds.PersistentVolumeClaim),
+		VolumeSnapshot:        d.ageThreshold(d.config.Thresholds.VolumeSnapshot),
+		TrueNASSnapshot:       d.snapshotRetention(),
+		TrueNASVolume:         d.ageThreshold(d.config.Thresholds.TrueNASVolume),
+	}
+}
+
+// ageThreshold returns override, or AgeThreshold when it is zero.
+func (d *Detector) ageThreshold(override time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	return d.config.AgeThreshold
+}
+
+// snapshotRetention returns the TrueNAS snapshot threshold.
+func (d *Detector) snapshotRetention() time.Duration {
+	if d.config.Thresholds.TrueNASSnapshot > 0 {
+		return d.config.Thresholds.TrueNASSnapshot
+	}
+	return d.config.SnapshotRetention
+}
+
 // WithAgeThreshold returns a detector copy that reuses clients and logger.
+// Per-type thresholds still override ageThreshold.
 func (d *Detector) WithAgeThreshold(ageThreshold time.Duration) *Detector {
+	config := d.config
+	config.AgeThreshold = ageThreshold
 	return &Detector{
 		k8sClient:     d.k8sClient,
 		truenasClient: d.truenasClient,
 		logger:        d.logger,
-		config: Config{
-			AgeThreshold:      ageThreshold,
-			SnapshotRetention: d.config.SnapshotRetention,
-			DryRun:            d.config.DryRun,
-		},
+		config:        config,
+	}
+}
+
+// WithThresholds returns a detector copy that uses ageThreshold and
+// thresholds in place of the configured ones.
+func (d *Detector) WithThresholds(ageThreshold time.Duration, thresholds AgeThresholds) *Detector {
+	config := d.config
+	config.AgeThreshold = ageThreshold
+	config.Thresholds = thresholds
+	return &Detector{
+		k8sClient:     d.k8sClient,
+		truenasClient: d.truenasClient,
+		logger:        d.logger,
+		config:        config,
 	}
 }
 
@@ -162,132 +589,285 @@ func (d *Detector) WithAgeThreshold(ageThreshold time.Duration) *Detector {
 func (d *Detector) DetectOrphanedPVs(ctx context.Context) (*DetectionResult, error) {
 	start := time.Now()
 
-	orphanedPVs, totalPVs, err := d.detectOrphanedPVs(ctx, nil)
-	if err != nil {
+	result := &DetectionResult{Timestamp: d.now()}
+
+	orphanedPVs, totalPVs, err := d.detectOrphanedPVs(ctx, nil, result)
+	if err = d.absorbPhaseTimeout(result, err); err != nil {
 		d.logger.WithError(err).Error("Failed to detect orphaned PVs")
 		return nil, fmt.Errorf("failed to detect orphaned PVs: %w", err)
 	}
 
-	result := &DetectionResult{
-		Timestamp:   start,
-		OrphanedPVs: orphanedPVs,
-		TotalPVs:    totalPVs,
-		ScanDuration: time.Since(start),
-	}
+	result.OrphanedPVs = d.applyExclusions(result, orphanedPVs)
+	result.TotalPVs = totalPVs
+	result.ScanDuration = time.Since(start)
 
 	d.logger.Info("PV orphan detection completed",
 		zap.Int("total_pvs", result.TotalPVs),
 		zap.Int("orphaned_pvs", len(result.OrphanedPVs)),
-		zap.String("age_threshold", d.config.AgeThreshold.String()),
+		zap.String("age_threshold", d.ageThreshold(d.config.Thresholds.PersistentVolume).String()),
 	)
 
 	return result, nil
 }
 
-// detectOrphanedPVs identifies PVs without corresponding TrueNAS volumes
-func (d *Detector) detectOrphanedPVs(ctx context.Context, timings map[string]time.Duration) ([]OrphanedResource, int, error) {
-	// Get all democratic-csi PVs from Kubernetes
-	pvStart := time.Now()
-	pvs, err := d.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
-	if timings != nil {
-		timings["k8s_pvs"] = time.Since(pvStart)
-	}
+// detectOrphanedPVs identifies PVs without corresponding TrueNAS volumes.
+// Volume handles shared by several PVs, PVs with unparseable handles and the
+// inventory counts are stored in result.
+func (d *Detector) detectOrphanedPVs(
+	ctx context.Context,
+	phases *phaseRecorder,
+	result *DetectionResult,
+) ([]OrphanedResource, int, error) {
+	duplicates := &result.DuplicateVolumeHandles
+	// Get all democratic-csi PVs from Kubernetes. Only their records and
+	// duplicate handles are kept past this point.
+	var records []pvRecord
+	var smb bool
+	pvStart := phases.start()
+	err := runPhase(ctx, "k8s_pvs", d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+		pvs, err := d.k8sClient.ListDemocraticCSIPersistentVolumes(ctx)
+		if err != nil {
+			return err
+		}
+		records = newPVRecords(pvs)
+		result.PVPhases = make(map[string]string, len(pvs))
+		for _, pv := range pvs {
+			result.PVPhases[pv.Name] = string(pv.Status.Phase)
+		}
+		smb = hasSMBVolumes(pvs)
+		*duplicates = FindDuplicateVolumeHandles(pvs)
+		return nil
+	})
+	phases.record("k8s_pvs", pvStart, len(records))
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list democratic-csi PVs: %w", err)
 	}
 
 	// Get all volumes from TrueNAS
-	tnStart := time.Now()
-	truenasVolumes, err := d.truenasClient.ListVolumes(ctx)
-	if timings != nil {
-		timings["truenas_datasets"] = time.Since(tnStart)
-	}
+	var truenasVolumes []truenas.Volume
+	var nfsShares []truenas.NFSShare
+	exports := false
+	tnStart := phases.start()
+	err = runPhase(ctx, "truenas_datasets", d.config.PhaseTimeouts.TrueNASList, func(ctx context.Context) error {
+		var err error
+		truenasVolumes, err = d.truenasClient.ListVolumes(ctx)
+		if err == nil && smb {
+			truenasVolumes = append(truenasVolumes, smbShareVolumes(ctx, d.truenasClient, d.logger, truenasVolumes)...)
+		}
+		if err == nil && hasNFSRecords(records) {
+			nfsShares, exports = listNFSShares(ctx, d.truenasClient, d.logger)
+		}
+		return err
+	})
+	phases.record("truenas_datasets", tnStart, len(truenasVolumes))
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list TrueNAS volumes: %w", err)
 	}
 
 	var orphaned []OrphanedResource
-	threshold := time.Now().Add(-d.config.AgeThreshold)
+	now := d.now()
+
+	correlateStart := phases.start()
+	err = runPhase(ctx, "correlate_pvs", d.config.PhaseTimeouts.Correlation, func(ctx context.Context) error {
+		volumes := newVolumeIndex(truenasVolumes)
+		if err := d.correlatePVs(ctx, records, volumes, now, &orphaned, &result.CorrelationUnknown); err != nil {
+			return err
+		}
+		// Datasets decide whether a PV's volume exists; a missing or
+		// disabled share is reported apart, never as an orphan.
+		if exports {
+			result.ExportMissing = checkExports(records, volumes, nfsShares)
+			result.ExportsChecked = true
+		}
+		inventory, unmatched := matchInventory(records, volumes)
+		result.Inventory = &inventory
+		result.classes = newStorageClassIndex(records, volumes)
+		result.OrphanedTrueNASVolumes = d.applyExclusions(result, d.unmatchedVolumeOrphans(unmatched, now))
+		return nil
+	})
+	phases.record("correlate_pvs", correlateStart, len(records))
+	if err != nil {
+		return orphaned, len(records), fmt.Errorf("failed to correlate PVs: %w", err)
+	}
+
+	for _, duplicate := range *duplicates {
+		names := make([]string, 0, len(duplicate.PersistentVolumes))
+		for _, pv := range duplicate.PersistentVolumes {
+			names = append(names, pv.Name)
+		}
+		d.logger.Error("Volume handle shared by multiple PVs",
+			zap.String("severity", duplicate.Severity),
+			zap.String("category", duplicate.Category),
+			zap.String("volume_handle", duplicate.VolumeHandle),
+			zap.Strings("persistent_volumes", names))
+	}
+
+	for _, pv := range result.CorrelationUnknown {
+		d.logger.Warn("Volume handle could not be parsed; PV correlation unknown",
+			zap.String("pv_name", pv.Name),
+			zap.String("volume_handle", pv.VolumeHandle),
+			zap.String("parse_error", pv.Details["parse_error"]))
+	}
 
+	d.logger.Info("PV orphan detection completed",
+		zap.Int("total_democratic_csi_pvs", len(records)),
+		zap.Int("orphaned_pvs", len(orphaned)),
+		zap.Int("orphaned_truenas_volumes", len(result.OrphanedTrueNASVolumes)),
+		zap.String("age_threshold", d.ageThreshold(d.config.Thresholds.PersistentVolume).String()),
+	)
+
+	return orphaned, len(records), nil
+}
+
+// correlatePVs appends PVs at least the PV age threshold old (as of now) without a
+// TrueNAS peer to orphaned, and PVs whose handle does not parse to unknown.
+// It stops early when ctx is done, leaving the partial lists in place.
+func (d *Detector) correlatePVs(
+	ctx context.Context,
+	pvs []pvRecord,
+	volumes *volumeIndex,
+	now time.Time,
+	orphaned, unknown *[]OrphanedResource,
+) error {
+	threshold := d.ageThreshold(d.config.Thresholds.PersistentVolume)
 	for _, pv := range pvs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if pv.ParseErr != nil {
+			*unknown = append(*unknown, correlationUnknownPV(pv, now))
+			continue
+		}
+
 		// Check if PV is old enough to be considered for orphan detection
-		if pv.CreationTimestamp.Time.After(threshold) {
+		if !olderThan(pv.CreatedAt, now, threshold) {
 			continue
 		}
 
 		// Check if PV has corresponding TrueNAS volume
-		if !d.hasCorrespondingTrueNASVolume(pv, truenasVolumes) {
-			orphan := OrphanedResource{
+		if !d.hasCorrespondingTrueNASVolume(pv, volumes) {
+			*orphaned = append(*orphaned, OrphanedResource{
 				Type:         "PersistentVolume",
 				Name:         pv.Name,
-				Age:          time.Since(pv.CreationTimestamp.Time),
+				UID:          pv.UID,
+				Age:          now.Sub(pv.CreatedAt),
+				Size:         pv.Size,
+				SizeBytes:    quantityBytes(pv.Size),
 				Reason:       "No corresponding TrueNAS volume found",
 				Labels:       pv.Labels,
 				Annotations:  pv.Annotations,
-				CreatedAt:    pv.CreationTimestamp.Time,
-			}
-
-			// Extract additional information
-			if pv.Spec.Capacity != nil {
-				if storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
-					orphan.Size = storage.String()
-				}
-			}
-
-			if pv.Spec.StorageClassName != "" {
-				orphan.StorageClass = pv.Spec.StorageClassName
-			}
-
-			if pv.Spec.CSI != nil {
-				orphan.VolumeHandle = pv.Spec.CSI.VolumeHandle
-			}
-
-			orphaned = append(orphaned, orphan)
+				VolumeHandle: pv.Handle,
+				StorageClass: pv.StorageClass,
+				CreatedAt:    pv.CreatedAt,
+			})
 		}
 	}
+	return nil
+}
 
-	d.logger.Info("PV orphan detection completed",
-		zap.Int("total_democratic_csi_pvs", len(pvs)),
-		zap.Int("orphaned_pvs", len(orphaned)),
-		zap.String("age_threshold", d.config.AgeThreshold.String()),
-	)
+// unmatchedVolumeOrphans returns the unmatched managed volumes at least the
+// TrueNAS volume age threshold old. Volumes without a creation time are
+// skipped rather than treated as old, so a TrueNAS release that omits the
+// property cannot flood the report.
+func (d *Detector) unmatchedVolumeOrphans(volumes []volumeRecord, now time.Time) []OrphanedResource {
+	threshold := d.ageThreshold(d.config.Thresholds.TrueNASVolume)
+	var orphaned []OrphanedResource
+	unknownAge := 0
+	for _, volume := range volumes {
+		if volume.CreatedAt.IsZero() {
+			unknownAge++
+			continue
+		}
+		if !olderThan(volume.CreatedAt, now, threshold) {
+			continue
+		}
+		orphaned = append(orphaned, OrphanedResource{
+			Type:      "TrueNASVolume",
+			Name:      volume.Name,
+			Age:       now.Sub(volume.CreatedAt),
+			Size:      humanize.Bytes(volume.Used),
+			SizeBytes: volume.Used,
+			Reason:    "No PersistentVolume references this dataset",
+			CreatedAt: volume.CreatedAt,
+		})
+	}
+	if unknownAge > 0 {
+		d.logger.Debug("Skipped unmatched TrueNAS volumes without a creation time",
+			zap.Int("count", unknownAge))
+	}
+	return orphaned
+}
 
-	return orphaned, len(pvs), nil
+// correlationUnknownPV describes a PV whose volume handle does not parse.
+func correlationUnknownPV(pv pvRecord, now time.Time) OrphanedResource {
+	details := map[string]string{
+		"status":      CorrelationUnknown,
+		"parse_error": pv.ParseErr.Error(),
+	}
+	if migratedTo := pv.Annotations[MigratedToAnnotation]; migratedTo != "" {
+		details["migrated_to"] = migratedTo
+	}
+	return OrphanedResource{
+		Type:         "PersistentVolume",
+		Name:         pv.Name,
+		UID:          pv.UID,
+		Age:          now.Sub(pv.CreatedAt),
+		Size:         pv.Size,
+		Reason:       "Volume handle could not be parsed; correlation unknown",
+		Labels:       pv.Labels,
+		Annotations:  pv.Annotations,
+		VolumeHandle: pv.Handle,
+		StorageClass: pv.StorageClass,
+		CreatedAt:    pv.CreatedAt,
+		Details:      details,
+	}
 }
 
 // detectOrphanedPVCs identifies unbound PVCs older than threshold
-func (d *Detector) detectOrphanedPVCs(ctx context.Context, namespace string, timings map[string]time.Duration) ([]OrphanedResource, int, error) {
-	var listDuration time.Duration
+func (d *Detector) detectOrphanedPVCs(ctx context.Context, namespace string, phases *phaseRecorder, result *DetectionResult) ([]OrphanedResource, int, error) {
+	var unboundPVCs, allPVCs []corev1.PersistentVolumeClaim
 
-	unboundStart := time.Now()
-	unboundPVCs, err := d.k8sClient.ListUnboundPersistentVolumeClaims(ctx, namespace)
-	listDuration += time.Since(unboundStart)
-	if err != nil {
+	unboundStart := phases.start()
+	err := runPhase(ctx, "k8s_pvcs", d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+		var err error
+		unboundPVCs, err = d.k8sClient.ListUnboundPersistentVolumeClaims(ctx, namespace)
+		return err
+	})
+	phases.record("k8s_pvcs", unboundStart, 0)
+	if err = d.absorbUnreadableNamespaces(result, err); err != nil {
 		return nil, 0, fmt.Errorf("failed to list unbound PVCs: %w", err)
 	}
 
-	allStart := time.Now()
-	allPVCs, err := d.k8sClient.ListPersistentVolumeClaims(ctx, namespace)
-	listDuration += time.Since(allStart)
-	if err != nil {
+	allStart := phases.start()
+	err = runPhase(ctx, "k8s_pvcs", d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+		var err error
+		allPVCs, err = d.k8sClient.ListPersistentVolumeClaims(ctx, namespace)
+		return err
+	})
+	phases.record("k8s_pvcs", allStart, len(allPVCs))
+	if err = d.absorbUnreadableNamespaces(result, err); err != nil {
 		return nil, 0, fmt.Errorf("failed to list all PVCs: %w", err)
 	}
-	if timings != nil {
-		timings["k8s_pvcs"] = listDuration
+	if d.namespaces != nil && namespace == "" {
+		d.namespaces.observePVCs(allPVCs)
 	}
 
 	var orphaned []OrphanedResource
-	threshold := time.Now().Add(-d.config.AgeThreshold)
+	now := d.now()
+	pending := newPendingPVCInspector(d)
+	waiting := 0
 
 	for _, pvc := range unboundPVCs {
 		// Check if PVC is old enough to be considered orphaned
-		if pvc.CreationTimestamp.Time.Before(threshold) {
+		if olderThan(pvc.CreationTimestamp.Time, now, d.ageThreshold(d.config.Thresholds.PersistentVolumeClaim)) {
 			orphan := OrphanedResource{
 				Type:        "PersistentVolumeClaim",
 				Name:        pvc.Name,
 				Namespace:   pvc.Namespace,
-				Age:         time.Since(pvc.CreationTimestamp.Time),
-				Reason:      fmt.Sprintf("Unbound for %v", time.Since(pvc.CreationTimestamp.Time)),
+				UID:         string(pvc.UID),
+				Age:         now.Sub(pvc.CreationTimestamp.Time),
+				Reason:      "Unbound for " + humanize.Duration(now.Sub(pvc.CreationTimestamp.Time)),
 				Labels:      pvc.Labels,
 				Annotations: pvc.Annotations,
 				CreatedAt:   pvc.CreationTimestamp.Time,
@@ -297,6 +877,7 @@ func (d *Detector) detectOrphanedPVCs(ctx context.Context, namespace string, tim
 			if pvc.Spec.Resources.Requests != nil {
 				if storage, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
 					orphan.Size = storage.String()
+					orphan.SizeBytes = storage.Value()
 				}
 			}
 
@@ -304,6 +885,12 @@ func (d *Detector) detectOrphanedPVCs(ctx context.Context, namespace string, tim
 				orphan.StorageClass = *pvc.Spec.StorageClassName
 			}
 
+			orphan.Details = pending.details(ctx, pvc)
+			if orphan.Details["pending_reason"] == PendingWaitingForFirstConsumer {
+				orphan.Reason = "Waiting for first consumer for " + humanize.Duration(orphan.Age)
+				waiting++
+			}
+
 			orphaned = append(orphaned, orphan)
 		}
 	}
@@ -313,79 +900,258 @@ func (d *Detector) detectOrphanedPVCs(ctx context.Context, namespace string, tim
 		zap.Int("total_pvcs", len(allPVCs)),
 		zap.Int("unbound_pvcs", len(unboundPVCs)),
 		zap.Int("orphaned_pvcs", len(orphaned)),
-		zap.String("age_threshold", d.config.AgeThreshold.String()),
+		zap.Int("waiting_for_first_consumer", waiting),
+		zap.String("age_threshold", d.ageThreshold(d.config.Thresholds.PersistentVolumeClaim).String()),
 	)
 
 	return orphaned, len(allPVCs), nil
 }
 
 // detectOrphanedSnapshots identifies snapshots without corresponding resources
-func (d *Detector) detectOrphanedSnapshots(ctx context.Context, namespace string, timings map[string]time.Duration) ([]OrphanedResource, int, error) {
-	k8sStart := time.Now()
-	k8sSnapshots, err := d.k8sClient.ListVolumeSnapshots(ctx, namespace)
-	if timings != nil {
-		timings["k8s_snapshots"] = time.Since(k8sStart)
+func (d *Detector) detectOrphanedSnapshots(ctx context.Context, namespace string, phases *phaseRecorder, result *DetectionResult) ([]OrphanedResource, snapshotTotals, error) {
+	var k8sSnapshots []k8sSnapshotRecord
+	k8sStart := phases.start()
+	err := runPhase(ctx, "k8s_snapshots", d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+		snapshots, err := d.k8sClient.ListVolumeSnapshots(ctx, namespace)
+		k8sSnapshots = newK8sSnapshotRecords(snapshots)
+		return err
+	})
+	phases.record("k8s_snapshots", k8sStart, len(k8sSnapshots))
+	if err = d.absorbUnreadableNamespaces(result, err); err != nil {
+		return nil, snapshotTotals{}, fmt.Errorf("failed to list Kubernetes snapshots: %w", err)
 	}
+	totals := snapshotTotals{K8s: len(k8sSnapshots)}
+
+	var listed []truenas.Snapshot
+	tnStart := phases.start()
+	err = runPhase(ctx, "truenas_snapshots", d.config.PhaseTimeouts.TrueNASList, func(ctx context.Context) error {
+		var err error
+		listed, err = d.truenasClient.ListSnapshots(ctx)
+		return err
+	})
+	phases.record("truenas_snapshots", tnStart, len(listed))
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list Kubernetes snapshots: %w", err)
+		return nil, totals, fmt.Errorf("failed to list TrueNAS snapshots: %w", err)
+	}
+	totals.TrueNAS = len(listed)
+	all := listed
+
+	if !d.config.StrictSnapshots {
+		managed := d.managedSnapshots(ctx, phases)
+		unmanaged := listed[:0:0]
+		for _, snapshot := range listed {
+			if managed.Matches(snapshot) {
+				totals.Managed++
+				continue
+			}
+			unmanaged = append(unmanaged, snapshot)
+		}
+		listed = unmanaged
 	}
+	truenasSnapshots := newTrueNASSnapshotRecords(listed)
 
-	tnStart := time.Now()
-	truenasSnapshots, err := d.truenasClient.ListSnapshots(ctx)
-	if timings != nil {
-		timings["truenas_snapshots"] = time.Since(tnStart)
+	correlated := k8sSnapshots
+	var selected map[string]bool
+	var carried []OrphanedResource
+	var onMatch func(k8sIndex, truenasIndex int)
+	matched := make(map[string]map[string]bool)
+	now := d.now()
+	if d.namespaces != nil && namespace == "" {
+		d.namespaces.observeSnapshots(k8sSnapshots)
+		selected = d.namespaces.plan(now, k8sSnapshots)
+		var claimed map[string]bool
+		carried, claimed = d.namespaces.carryOver(now, selected, k8sSnapshots)
+		correlated = nil
+		for _, snapshot := range k8sSnapshots {
+			if selected[snapshot.Namespace] {
+				correlated = append(correlated, snapshot)
+			}
+		}
+		unclaimed := truenasSnapshots[:0:0]
+		for _, snapshot := range truenasSnapshots {
+			if !claimed[snapshot.FullName] {
+				unclaimed = append(unclaimed, snapshot)
+			}
+		}
+		truenasSnapshots = unclaimed
+		onMatch = func(k8sIndex, truenasIndex int) {
+			ns := correlated[k8sIndex].Namespace
+			if matched[ns] == nil {
+				matched[ns] = make(map[string]bool)
+			}
+			matched[ns][truenasSnapshots[truenasIndex].FullName] = true
+		}
+		d.logger.Info("Prioritized snapshot correlation",
+			zap.Int("correlated_namespaces", len(selected)),
+			zap.Int("correlated_snapshots", len(correlated)),
+			zap.Int("carried_orphans", len(carried)))
 	}
+
+	var orphaned []OrphanedResource
+	correlateStart := phases.start()
+	err = runPhase(ctx, "correlate_snapshots", d.config.PhaseTimeouts.Correlation, func(ctx context.Context) error {
+		var err error
+		orphaned, _, err = d.correlateSnapshotLists(ctx, correlated, truenasSnapshots, onMatch)
+		return err
+	})
+	phases.record("correlate_snapshots", correlateStart, len(correlated)+len(truenasSnapshots))
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list TrueNAS snapshots: %w", err)
+		return append(orphaned, carried...), totals, fmt.Errorf("failed to correlate snapshots: %w", err)
+	}
+	if selected != nil {
+		d.namespaces.record(now, selected, orphaned, matched)
+		orphaned = append(orphaned, carried...)
+	}
+
+	// Snapshots managed by TrueNAS tasks still back contents, so the
+	// unfiltered list is searched for their handles.
+	orphaned = append(orphaned, d.detectDanglingSnapshotContents(ctx, namespace, k8sSnapshots, all, phases)...)
+	return d.dropUnverifiableSnapshotOrphans(result, orphaned), totals, nil
+}
+
+// dropUnverifiableSnapshotOrphans removes the orphans whose VolumeSnapshot
+// may sit in a namespace the VolumeSnapshot list could not read, since the
+// partial list does not show that it is gone: TrueNAS snapshots of datasets
+// whose PV is claimed from such a namespace or that no bound PV claims, and
+// VolumeSnapshotContents bound into such a namespace.
+func (d *Detector) dropUnverifiableSnapshotOrphans(result *DetectionResult, orphans []OrphanedResource) []OrphanedResource {
+	unreadable := make(map[string]bool)
+	for _, ns := range result.UnreadableNamespaces {
+		if ns.Resource == "volumesnapshots" {
+			unreadable[ns.Namespace] = true
+		}
+	}
+	if len(unreadable) == 0 {
+		return orphans
 	}
 
-	return d.detectOrphanedSnapshotsFromLists(k8sSnapshots, truenasSnapshots)
+	var namespaces map[string]string
+	if result.classes != nil {
+		namespaces = result.classes.namespaces
+	}
+	kept := orphans[:0]
+	dropped := 0
+	for _, orphan := range orphans {
+		switch orphan.Type {
+		case "TrueNASSnapshot":
+			dataset, _, _ := strings.Cut(orphan.Name, "@")
+			if namespace, ok := namespaces[dataset]; !ok || unreadable[namespace] {
+				dropped++
+				continue
+			}
+		case SnapshotContentType:
+			namespace, _, _ := strings.Cut(orphan.Details["volume_snapshot"], "/")
+			if unreadable[namespace] {
+				dropped++
+				continue
+			}
+		}
+		kept = append(kept, orphan)
+	}
+	if dropped > 0 {
+		d.logger.Info("Skipped snapshot orphans that VolumeSnapshots in unreadable namespaces may own",
+			zap.Int("skipped", dropped),
+			zap.Int("unreadable_namespaces", len(unreadable)))
+	}
+	return kept
+}
+
+// managedSnapshots fetches the TrueNAS periodic snapshot and replication
+// tasks. Failures are logged and leave every snapshot subject to detection.
+func (d *Detector) managedSnapshots(ctx context.Context, phases *phaseRecorder) *truenas.ManagedSnapshots {
+	var periodic []truenas.PeriodicSnapshotTask
+	var replication []truenas.ReplicationTask
+	start := phases.start()
+	err := runPhase(ctx, "truenas_snapshot_tasks", d.config.PhaseTimeouts.TrueNASList, func(ctx context.Context) error {
+		var err error
+		if periodic, err = d.truenasClient.ListSnapshotTasks(ctx); err != nil {
+			return err
+		}
+		replication, err = d.truenasClient.ListReplicationTasks(ctx)
+		return err
+	})
+	phases.record("truenas_snapshot_tasks", start, len(periodic)+len(replication))
+	if err != nil {
+		d.logger.WithError(err).Warn("Failed to list TrueNAS snapshot tasks; evaluating all snapshots")
+		return nil
+	}
+	return truenas.NewManagedSnapshots(periodic, replication)
 }
 
+// detectOrphanedSnapshotsFromLists correlates both snapshot inventories. When ctx
+// is done it returns the orphans found so far together with ctx's error.
 func (d *Detector) detectOrphanedSnapshotsFromLists(
-	k8sSnapshots []snapshotv1.VolumeSnapshot,
-	truenasSnapshots []truenas.Snapshot,
+	ctx context.Context,
+	k8sSnapshots []k8sSnapshotRecord,
+	truenasSnapshots []truenasSnapshotRecord,
 ) ([]OrphanedResource, int, error) {
-	var orphaned []OrphanedResource
-	threshold := time.Now().Add(-d.config.AgeThreshold)
+	return d.correlateSnapshotLists(ctx, k8sSnapshots, truenasSnapshots, nil)
+}
 
-	// Check for K8s snapshots without corresponding TrueNAS snapshots
-	for _, snapshot := range k8sSnapshots {
-		if snapshot.CreationTimestamp.Time.Before(threshold) {
-			if !d.hasCorrespondingTrueNASSnapshot(snapshot, truenasSnapshots) {
-				orphan := OrphanedResource{
-					Type:        "VolumeSnapshot",
-					Name:        snapshot.Name,
-					Namespace:   snapshot.Namespace,
-					Age:         time.Since(snapshot.CreationTimestamp.Time),
-					Reason:      "No corresponding TrueNAS snapshot found",
-					Labels:      snapshot.Labels,
-					Annotations: snapshot.Annotations,
-					CreatedAt:   snapshot.CreationTimestamp.Time,
-				}
+// correlateSnapshotLists is detectOrphanedSnapshotsFromLists passing onMatch
+// to correlateSnapshotsFunc.
+func (d *Detector) correlateSnapshotLists(
+	ctx context.Context,
+	k8sSnapshots []k8sSnapshotRecord,
+	truenasSnapshots []truenasSnapshotRecord,
+	onMatch func(k8sIndex, truenasIndex int),
+) ([]OrphanedResource, int, error) {
+	now := d.now()
+	k8sMatched, truenasMatched, err := correlateSnapshotsFunc(ctx, k8sSnapshots, truenasSnapshots, onMatch)
+	if err != nil {
+		return nil, len(k8sSnapshots), err
+	}
 
-				orphaned = append(orphaned, orphan)
-			}
+	// Count first: with tens of thousands of orphans, growing the slice
+	// would allocate several times its final size.
+	threshold := d.ageThreshold(d.config.Thresholds.VolumeSnapshot)
+	retention := d.snapshotRetention()
+	count := 0
+	for i, snapshot := range k8sSnapshots {
+		if !k8sMatched[i] && olderThan(snapshot.CreatedAt, now, threshold) {
+			count++
 		}
 	}
+	for i, snapshot := range truenasSnapshots {
+		if !truenasMatched[i] && olderThan(snapshot.CreatedAt, now, retention) {
+			count++
+		}
+	}
+	orphaned := make([]OrphanedResource, 0, count)
 
-	// Check for old TrueNAS snapshots that might be orphaned
-	retentionThreshold := time.Now().Add(-d.config.SnapshotRetention)
-	for _, truenasSnapshot := range truenasSnapshots {
-		if truenasSnapshot.CreatedAt.Before(retentionThreshold) {
-			if !d.hasCorrespondingK8sSnapshot(truenasSnapshot, k8sSnapshots) {
-				orphan := OrphanedResource{
-					Type:      "TrueNASSnapshot",
-					Name:      truenasSnapshot.Name,
-					Age:       time.Since(truenasSnapshot.CreatedAt),
-					Reason:    "Old TrueNAS snapshot without corresponding VolumeSnapshot",
-					Size:      fmt.Sprintf("%d bytes", truenasSnapshot.Used),
-					CreatedAt: truenasSnapshot.CreatedAt,
-				}
+	// Check for K8s snapshots without corresponding TrueNAS snapshots
+	for i, snapshot := range k8sSnapshots {
+		if k8sMatched[i] || !olderThan(snapshot.CreatedAt, now, threshold) {
+			continue
+		}
+		orphaned = append(orphaned, OrphanedResource{
+			Type:        "VolumeSnapshot",
+			Name:        snapshot.Name,
+			Namespace:   snapshot.Namespace,
+			UID:         snapshot.UID,
+			Age:         now.Sub(snapshot.CreatedAt),
+			Reason:      "No corresponding TrueNAS snapshot found",
+			Labels:      snapshot.Labels,
+			Annotations: snapshot.Annotations,
+			CreatedAt:   snapshot.CreatedAt,
+		})
+	}
 
-				orphaned = append(orphaned, orphan)
-			}
+	// Check for old TrueNAS snapshots that might be orphaned
+	for i, snapshot := range truenasSnapshots {
+		if truenasMatched[i] || !olderThan(snapshot.CreatedAt, now, retention) {
+			continue
 		}
+		orphaned = append(orphaned, OrphanedResource{
+			Type:      "TrueNASSnapshot",
+			Name:      snapshot.Name,
+			UID:       snapshot.GUID,
+			Age:       now.Sub(snapshot.CreatedAt),
+			Reason:    "Old TrueNAS snapshot without corresponding VolumeSnapshot",
+			Size:      humanize.Bytes(snapshot.Used),
+			SizeBytes: snapshot.Used,
+			CreatedAt: snapshot.CreatedAt,
+		})
 	}
 
 	if d.logger != nil {
@@ -393,8 +1159,8 @@ func (d *Detector) detectOrphanedSnapshotsFromLists(
 			zap.Int("k8s_snapshots", len(k8sSnapshots)),
 			zap.Int("truenas_snapshots", len(truenasSnapshots)),
 			zap.Int("orphaned_snapshots", len(orphaned)),
-			zap.String("age_threshold", d.config.AgeThreshold.String()),
-			zap.String("retention_threshold", d.config.SnapshotRetention.String()),
+			zap.String("age_threshold", threshold.String()),
+			zap.String("retention_threshold", retention.String()),
 		)
 	}
 
@@ -402,44 +1168,19 @@ func (d *Detector) detectOrphanedSnapshotsFromLists(
 }
 
 // hasCorrespondingTrueNASVolume checks if a PV has a corresponding TrueNAS volume
-func (d *Detector) hasCorrespondingTrueNASVolume(pv corev1.PersistentVolume, truenasVolumes []truenas.Volume) bool {
-	if pv.Spec.CSI == nil {
+func (d *Detector) hasCorrespondingTrueNASVolume(pv pvRecord, volumes *volumeIndex) bool {
+	volume, ok := volumes.find(pv)
+	if !ok {
 		return false
 	}
-
-	volumeHandle := pv.Spec.CSI.VolumeHandle
-	if volumeHandle == "" {
-		return false
-	}
-
-	datasetName := extractDatasetFromVolumeHandle(volumeHandle)
-
-	for _, volume := range truenasVolumes {
-		// Check various matching strategies
-		if volumeMatches(volume, volumeHandle, datasetName) {
-			d.logger.Debug("Found matching TrueNAS volume for PV",
-				zap.String("pv_name", pv.Name),
-				zap.String("volume_handle", volumeHandle),
-				zap.String("dataset_name", datasetName),
-				zap.String("truenas_volume", volume.Name),
-			)
-			return true
-		}
+	// Check first so large inventories do not build fields that are dropped.
+	if entry := d.logger.Check(zap.DebugLevel, "Found matching TrueNAS volume for PV"); entry != nil {
+		entry.Write(
+			zap.String("pv_name", pv.Name),
+			zap.String("volume_handle", pv.Handle),
+			zap.String("dataset_name", pv.Dataset),
+			zap.String("truenas_volume", volume.Name),
+		)
 	}
-
-	return false
+	return true
 }
-
-func (d *Detector) hasCorrespondingTrueNASSnapshot(
-	k8sSnapshot snapshotv1.VolumeSnapshot,
-	truenasSnapshots []truenas.Snapshot,
-) bool {
-	return snapshotCorrelatesWithTrueNAS(k8sSnapshot, truenasSnapshots)
-}
-
-func (d *Detector) hasCorrespondingK8sSnapshot(
-	truenasSnapshot truenas.Snapshot,
-	k8sSnapshots []snapshotv1.VolumeSnapshot,
-) bool {
-	return truenasSnapshotCorrelatesWithK8s(truenasSnapshot, k8sSnapshots)
-}
\ No newline at end of file
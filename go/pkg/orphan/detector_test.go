@@ -1,11 +1,16 @@
 package orphan
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -100,7 +105,7 @@ func TestVolumeMatches(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := volumeMatches(tt.volume, tt.volumeHandle, tt.datasetName)
+			got := volumeMatches(newVolumeRecord(tt.volume), tt.volumeHandle, tt.datasetName)
 			if got != tt.want {
 				t.Fatalf("volumeMatches() = %v, want %v", got, tt.want)
 			}
@@ -158,9 +163,13 @@ func TestSnapshotCorrelatesWithTrueNAS(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := snapshotCorrelatesWithTrueNAS(k8sSnap, tt.truenas)
-			if got != tt.want {
-				t.Fatalf("snapshotCorrelatesWithTrueNAS() = %v, want %v", got, tt.want)
+			matched, _, err := correlateSnapshots(context.Background(),
+				newK8sSnapshotRecords([]snapshotv1.VolumeSnapshot{k8sSnap}), newTrueNASSnapshotRecords(tt.truenas))
+			if err != nil {
+				t.Fatalf("correlateSnapshots: %v", err)
+			}
+			if got := matched[0]; got != tt.want {
+				t.Fatalf("VolumeSnapshot correlated = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -211,9 +220,13 @@ func TestTruenasSnapshotCorrelatesWithK8s(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := truenasSnapshotCorrelatesWithK8s(tt.truenas, k8sSnaps)
-			if got != tt.want {
-				t.Fatalf("truenasSnapshotCorrelatesWithK8s() = %v, want %v", got, tt.want)
+			_, matched, err := correlateSnapshots(context.Background(),
+				newK8sSnapshotRecords(k8sSnaps), newTrueNASSnapshotRecords([]truenas.Snapshot{tt.truenas}))
+			if err != nil {
+				t.Fatalf("correlateSnapshots: %v", err)
+			}
+			if got := matched[0]; got != tt.want {
+				t.Fatalf("TrueNAS snapshot correlated = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -246,7 +259,7 @@ func TestDetectOrphanedSnapshots_FlagsMissingPeers(t *testing.T) {
 		},
 	}
 
-	orphaned, total, err := d.detectOrphanedSnapshotsFromLists(k8sSnaps, truenasSnaps)
+	orphaned, total, err := d.detectOrphanedSnapshotsFromLists(context.Background(), newK8sSnapshotRecords(k8sSnaps), newTrueNASSnapshotRecords(truenasSnaps))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -258,12 +271,515 @@ func TestDetectOrphanedSnapshots_FlagsMissingPeers(t *testing.T) {
 	}
 }
 
+func TestParseVolumeHandle_Errors(t *testing.T) {
+	for _, handle := range []string{
+		"",
+		"  ",
+		"iqn.2005-10.org.freenas.ctl:",
+		"iqn.2005-10.org.freenas.ctl",
+		"tank/k8s/@daily",
+		"tank/k8s/vol\x00-1",
+	} {
+		if dataset, err := parseVolumeHandle(handle); err == nil {
+			t.Fatalf("parseVolumeHandle(%q) = %q, want an error", handle, dataset)
+		}
+	}
+}
+
+func TestDetectOrphanedPVs_UnparseableHandleIsCorrelationUnknown(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-30 * 24 * time.Hour)
+	migrated := orphanCandidatePV("pv-migrated", old)
+	migrated.Annotations = map[string]string{MigratedToAnnotation: "org.democratic-csi.iscsi"}
+	migrated.Spec.CSI.VolumeHandle = "iqn.2005-10.org.freenas.ctl:"
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		migrated,
+		orphanCandidatePV("pv-gone", old),
+		orphanCandidatePV("pv-ok", old),
+	}}
+	truenasClient := &truenastest.Client{Volumes: []truenas.Volume{{ID: "tank/k8s/pv-ok", Name: "tank/k8s/pv-ok"}}}
+	d, err := NewDetector(k8sClient, truenasClient, Config{AgeThreshold: time.Hour, Clock: clock.NewFake(now)})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if len(result.OrphanedPVs) != 1 || result.OrphanedPVs[0].Name != "pv-gone" {
+		t.Fatalf("orphaned PVs = %+v, want only pv-gone", result.OrphanedPVs)
+	}
+	if len(result.CorrelationUnknown) != 1 {
+		t.Fatalf("correlation unknown = %+v, want pv-migrated", result.CorrelationUnknown)
+	}
+	unknown := result.CorrelationUnknown[0]
+	if unknown.Name != "pv-migrated" || unknown.Details["status"] != CorrelationUnknown ||
+		unknown.Details["migrated_to"] != "org.democratic-csi.iscsi" || unknown.Details["parse_error"] == "" {
+		t.Fatalf("correlation unknown PV = %+v", unknown)
+	}
+	if result.Inventory == nil || result.Inventory.UnmatchedK8s != 1 {
+		t.Fatalf("inventory = %+v, want one unmatched PV", result.Inventory)
+	}
+}
+
 func TestHasCorrespondingTrueNASVolume_EmptyCSI(t *testing.T) {
 	d := &Detector{}
 	pv := corev1.PersistentVolume{
 		Spec: corev1.PersistentVolumeSpec{},
 	}
-	if d.hasCorrespondingTrueNASVolume(pv, nil) {
+	if d.hasCorrespondingTrueNASVolume(newPVRecords([]corev1.PersistentVolume{pv})[0], nil) {
 		t.Fatal("expected false when PV has no CSI source")
 	}
 }
+
+// slowPVK8sClient blocks listing PVs until the context ends.
+type slowPVK8sClient struct {
+	k8stest.Client
+}
+
+func (*slowPVK8sClient) ListDemocraticCSIPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestDetectOrphanedResources_PhaseTimeoutYieldsPartialResult(t *testing.T) {
+	d, err := NewDetector(&slowPVK8sClient{}, &truenastest.Client{}, Config{
+		PhaseTimeouts: PhaseTimeouts{K8sList: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedResources(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected partial result, got error: %v", err)
+	}
+	if !result.Partial {
+		t.Fatal("expected result to be marked partial")
+	}
+	if _, ok := result.PhaseErrors["k8s_pvs"]; !ok {
+		t.Fatalf("expected k8s_pvs phase error, got %v", result.PhaseErrors)
+	}
+	if len(result.PhaseErrors) != 1 {
+		t.Fatalf("expected only the PV phase to time out, got %v", result.PhaseErrors)
+	}
+}
+
+func TestDetectOrphanedResources_SkipsUnreadableNamespaces(t *testing.T) {
+	created := metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	pending := func(namespace string) corev1.PersistentVolumeClaim {
+		return corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: namespace, CreationTimestamp: created},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		}
+	}
+	k8sClient := &k8stest.Client{
+		Namespaces: []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-c"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-d"}},
+		},
+		PersistentVolumeClaims: []corev1.PersistentVolumeClaim{pending("team-a"), pending("team-b")},
+		UnreadableNamespaces:   []string{"team-b"},
+	}
+	d, err := NewDetector(k8sClient, &truenastest.Client{}, Config{AgeThreshold: time.Hour})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedResources(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected partial result, got error: %v", err)
+	}
+	if !result.Partial {
+		t.Fatal("expected result to be marked partial")
+	}
+	if len(result.OrphanedPVCs) != 1 || result.OrphanedPVCs[0].Namespace != "team-a" {
+		t.Fatalf("orphaned PVCs = %+v, want the team-a PVC", result.OrphanedPVCs)
+	}
+	want := map[string]bool{"persistentvolumeclaims": true, "volumesnapshots": true}
+	for _, ns := range result.UnreadableNamespaces {
+		if ns.Namespace != "team-b" || !want[ns.Resource] || ns.Error == "" {
+			t.Fatalf("unexpected unreadable namespace %+v", ns)
+		}
+		delete(want, ns.Resource)
+	}
+	if len(want) != 0 || len(result.UnreadableNamespaces) != 2 {
+		t.Fatalf("unreadable namespaces = %+v, want team-b for PVCs and VolumeSnapshots once each", result.UnreadableNamespaces)
+	}
+	if result.NamespaceCoveragePercent == nil || *result.NamespaceCoveragePercent != 75 {
+		t.Fatalf("namespace coverage = %v, want 75", result.NamespaceCoveragePercent)
+	}
+}
+
+func TestDetectOrphanedResources_UnreadableNamespacesDoNotOrphanTrueNASSnapshots(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	detect := func(unreadable []string) *DetectionResult {
+		t.Helper()
+		k8sClient := &k8stest.Client{
+			Namespaces: []corev1.Namespace{
+				{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+			},
+			PersistentVolumes: []corev1.PersistentVolume{
+				handlePV("pv-a", "tank/k8s/pv-a", "team-a"),
+				handlePV("pv-b", "tank/k8s/pv-b", "team-b"),
+			},
+			VolumeSnapshots: []snapshotv1.VolumeSnapshot{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "snap-1",
+					Namespace:         "team-b",
+					Labels:            map[string]string{"truenas.dataset": "tank/k8s/pv-b"},
+					CreationTimestamp: metav1.NewTime(old),
+				},
+			}},
+			VolumeSnapshotContents: []snapshotv1.VolumeSnapshotContent{
+				testSnapshotContent("content-a", "team-a", "snap-gone", "tank/k8s/pv-a@snap-gone", snapshotv1.VolumeSnapshotContentDelete, old),
+				testSnapshotContent("content-b", "team-b", "snap-gone", "tank/k8s/pv-b@snap-gone", snapshotv1.VolumeSnapshotContentDelete, old),
+			},
+			UnreadableNamespaces: unreadable,
+		}
+		truenasClient := &truenastest.Client{
+			Volumes: []truenas.Volume{{Name: "tank/k8s/pv-a"}, {Name: "tank/k8s/pv-b"}, {Name: "tank/k8s/pv-gone"}},
+			Snapshots: []truenas.Snapshot{
+				{Name: "tank/k8s/pv-a@leftover", Dataset: "tank/k8s/pv-a", CreatedAt: old},
+				{Name: "tank/k8s/pv-b@snap-1", Dataset: "tank/k8s/pv-b", CreatedAt: old},
+				{Name: "tank/k8s/pv-gone@old", Dataset: "tank/k8s/pv-gone", CreatedAt: old},
+			},
+		}
+		d, err := NewDetector(k8sClient, truenasClient, Config{
+			AgeThreshold:      time.Hour,
+			SnapshotRetention: 30 * 24 * time.Hour,
+			Clock:             clock.NewFake(now),
+		})
+		if err != nil {
+			t.Fatalf("NewDetector: %v", err)
+		}
+		result, err := d.DetectOrphanedResources(context.Background(), "")
+		if err != nil {
+			t.Fatalf("DetectOrphanedResources: %v", err)
+		}
+		return result
+	}
+	orphans := func(result *DetectionResult) map[string]bool {
+		names := make(map[string]bool)
+		for _, orphan := range result.OrphanedSnapshots {
+			names[orphan.Type+" "+orphan.Name] = true
+		}
+		return names
+	}
+
+	readable := orphans(detect(nil))
+	for _, want := range []string{"TrueNASSnapshot tank/k8s/pv-a@leftover", "TrueNASSnapshot tank/k8s/pv-gone@old", "VolumeSnapshotContent content-a", "VolumeSnapshotContent content-b"} {
+		if !readable[want] {
+			t.Fatalf("readable scan: missing orphan %q in %v", want, readable)
+		}
+	}
+	if readable["TrueNASSnapshot tank/k8s/pv-b@snap-1"] {
+		t.Fatal("readable scan: the team-b VolumeSnapshot should match tank/k8s/pv-b@snap-1")
+	}
+
+	// team-b's VolumeSnapshots cannot be listed (403): only the orphans
+	// attributable to team-a remain.
+	result := detect([]string{"team-b"})
+	if !result.Partial {
+		t.Fatal("expected result to be marked partial")
+	}
+	partial := orphans(result)
+	for _, unwanted := range []string{"TrueNASSnapshot tank/k8s/pv-b@snap-1", "TrueNASSnapshot tank/k8s/pv-gone@old", "VolumeSnapshotContent content-b"} {
+		if partial[unwanted] {
+			t.Fatalf("partial scan: %q reported as orphan although team-b is unreadable", unwanted)
+		}
+	}
+	for _, want := range []string{"TrueNASSnapshot tank/k8s/pv-a@leftover", "VolumeSnapshotContent content-a"} {
+		if !partial[want] {
+			t.Fatalf("partial scan: missing orphan %q in %v", want, partial)
+		}
+	}
+}
+
+func TestRunPhase_CallerCancellationIsNotPhaseTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := runPhase(ctx, "k8s_pvs", time.Minute, func(ctx context.Context) error {
+		return ctx.Err()
+	})
+
+	var timeoutErr *PhaseTimeoutError
+	if errors.As(err, &timeoutErr) {
+		t.Fatal("caller cancellation must not be reported as a phase timeout")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRunPhase_ZeroTimeoutDisablesBound(t *testing.T) {
+	err := runPhase(context.Background(), "k8s_pvs", 0, func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			t.Fatal("expected no deadline when timeout is zero")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDetector_AgeThresholdBoundaryIsInclusive(t *testing.T) {
+	now := time.Date(2024, 10, 27, 2, 30, 0, 0, time.UTC)
+	threshold := 24 * time.Hour
+	retention := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		created time.Time
+		want    bool
+	}{
+		{name: "exactly at threshold is flagged", created: now.Add(-threshold), want: true},
+		{name: "one nanosecond younger is not flagged", created: now.Add(-threshold + time.Nanosecond), want: false},
+		{name: "older than threshold is flagged", created: now.Add(-threshold - time.Second), want: true},
+		{name: "created in the future due to clock skew is not flagged", created: now.Add(time.Minute), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Detector{
+				config: Config{
+					AgeThreshold:      threshold,
+					SnapshotRetention: retention,
+					Clock:             clock.NewFake(now),
+				},
+			}
+
+			pvs := []corev1.PersistentVolume{orphanCandidatePV("pv-boundary", tt.created)}
+			var orphaned, unknown []OrphanedResource
+			if err := d.correlatePVs(context.Background(), newPVRecords(pvs), nil, now, &orphaned, &unknown); err != nil {
+				t.Fatalf("correlatePVs: %v", err)
+			}
+			if got := len(orphaned) == 1; got != tt.want {
+				t.Fatalf("PV flagged = %v, want %v", got, tt.want)
+			}
+			if tt.want && orphaned[0].Age != now.Sub(tt.created) {
+				t.Fatalf("PV age = %v, want %v", orphaned[0].Age, now.Sub(tt.created))
+			}
+
+			k8sSnaps := []snapshotv1.VolumeSnapshot{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "snap-boundary",
+					CreationTimestamp: metav1.NewTime(tt.created),
+				},
+			}}
+			snapOrphans, _, err := d.detectOrphanedSnapshotsFromLists(context.Background(), newK8sSnapshotRecords(k8sSnaps), newTrueNASSnapshotRecords(nil))
+			if err != nil {
+				t.Fatalf("detectOrphanedSnapshotsFromLists: %v", err)
+			}
+			if got := len(snapOrphans) == 1; got != tt.want {
+				t.Fatalf("VolumeSnapshot flagged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetector_PerTypeThresholdsFallBackToGlobal(t *testing.T) {
+	now := time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC)
+	created := now.Add(-48 * time.Hour)
+	d := &Detector{
+		config: Config{
+			AgeThreshold:      24 * time.Hour,
+			SnapshotRetention: 30 * 24 * time.Hour,
+			Thresholds: AgeThresholds{
+				PersistentVolume: 48*time.Hour + time.Second,
+				TrueNASSnapshot:  48 * time.Hour,
+			},
+			Clock: clock.NewFake(now),
+		},
+	}
+
+	var orphaned, unknown []OrphanedResource
+	pvs := []corev1.PersistentVolume{orphanCandidatePV("pv-young", created)}
+	if err := d.correlatePVs(context.Background(), newPVRecords(pvs), nil, now, &orphaned, &unknown); err != nil {
+		t.Fatalf("correlatePVs: %v", err)
+	}
+	if len(orphaned) != 0 {
+		t.Fatalf("PV younger than its own threshold flagged: %+v", orphaned)
+	}
+
+	k8sSnaps := []snapshotv1.VolumeSnapshot{{
+		ObjectMeta: metav1.ObjectMeta{Name: "snap", CreationTimestamp: metav1.NewTime(created)},
+	}}
+	truenasSnaps := []truenas.Snapshot{{Name: "tank/k8s/vol-1@manual", Dataset: "tank/k8s/vol-1", CreatedAt: created}}
+	snapOrphans, _, err := d.detectOrphanedSnapshotsFromLists(context.Background(), newK8sSnapshotRecords(k8sSnaps), newTrueNASSnapshotRecords(truenasSnaps))
+	if err != nil {
+		t.Fatalf("detectOrphanedSnapshotsFromLists: %v", err)
+	}
+	if len(snapOrphans) != 2 {
+		t.Fatalf("orphaned snapshots = %+v, want the VolumeSnapshot (global 24h) and the TrueNAS snapshot (exactly 48h)", snapOrphans)
+	}
+
+	want := AgeThresholds{
+		PersistentVolume:      48*time.Hour + time.Second,
+		PersistentVolumeClaim: 24 * time.Hour,
+		VolumeSnapshot:        24 * time.Hour,
+		TrueNASSnapshot:       48 * time.Hour,
+		TrueNASVolume:         24 * time.Hour,
+	}
+	if got := d.TypeThresholds(); got != want {
+		t.Fatalf("TypeThresholds() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDetector_SnapshotRetentionBoundaryUsesClock(t *testing.T) {
+	now := time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+	fake := clock.NewFake(now)
+
+	d := &Detector{
+		config: Config{
+			AgeThreshold:      24 * time.Hour,
+			SnapshotRetention: retention,
+			Clock:             fake,
+		},
+	}
+	truenasSnaps := []truenas.Snapshot{{
+		Name:      "auto-daily",
+		Dataset:   "tank/k8s/vol-1",
+		CreatedAt: now.Add(-retention + time.Second),
+	}}
+
+	orphaned, _, err := d.detectOrphanedSnapshotsFromLists(context.Background(), newK8sSnapshotRecords(nil), newTrueNASSnapshotRecords(truenasSnaps))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(orphaned) != 0 {
+		t.Fatalf("snapshot younger than retention flagged: %+v", orphaned)
+	}
+
+	fake.Advance(time.Second)
+	orphaned, _, err = d.detectOrphanedSnapshotsFromLists(context.Background(), newK8sSnapshotRecords(nil), newTrueNASSnapshotRecords(truenasSnaps))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(orphaned) != 1 {
+		t.Fatalf("snapshot exactly at retention should be flagged, got %d", len(orphaned))
+	}
+	if orphaned[0].Age != retention {
+		t.Fatalf("age = %v, want %v", orphaned[0].Age, retention)
+	}
+}
+
+func TestDetectOrphanedSnapshots_SkipsTaskManagedSnapshots(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	truenasClient := &truenastest.Client{
+		Snapshots: []truenas.Snapshot{
+			{Name: "tank/k8s/pvc-1@auto-2024-04-01_00-00", Dataset: "tank/k8s/pvc-1", CreatedAt: old},
+			{Name: "tank/k8s/pvc-1@leftover", Dataset: "tank/k8s/pvc-1", CreatedAt: old},
+		},
+		SnapshotTasks: []truenas.PeriodicSnapshotTask{{
+			Dataset: "tank/k8s", Recursive: true, NamingSchema: "auto-%Y-%m-%d_%H-%M",
+		}},
+	}
+
+	for _, tt := range []struct {
+		name        string
+		strict      bool
+		listErr     error
+		wantOrphans int
+		wantManaged int
+	}{
+		{name: "default skips managed", wantOrphans: 1, wantManaged: 1},
+		{name: "strict reports everything", strict: true, wantOrphans: 2},
+		{name: "task listing failure reports everything", listErr: errors.New("boom"), wantOrphans: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			truenasClient.ListTasksErr = tt.listErr
+			d, err := NewDetector(&slowPVK8sClient{}, truenasClient, Config{
+				StrictSnapshots: tt.strict,
+				Clock:           clock.NewFake(now),
+			})
+			if err != nil {
+				t.Fatalf("NewDetector: %v", err)
+			}
+
+			orphaned, totals, err := d.detectOrphanedSnapshots(context.Background(), "", nil, &DetectionResult{})
+			if err != nil {
+				t.Fatalf("detectOrphanedSnapshots: %v", err)
+			}
+			if len(orphaned) != tt.wantOrphans {
+				t.Fatalf("orphans = %+v, want %d", orphaned, tt.wantOrphans)
+			}
+			if totals.Managed != tt.wantManaged || totals.TrueNAS != 2 {
+				t.Fatalf("totals = %+v, want %d managed of 2", totals, tt.wantManaged)
+			}
+		})
+	}
+}
+
+func orphanCandidatePV(name string, created time.Time) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "org.democratic-csi.nfs",
+					VolumeHandle: "tank/k8s/" + name,
+				},
+			},
+		},
+	}
+}
+
+func TestDetectionResult_SetSnapshotCounts(t *testing.T) {
+	result := &DetectionResult{
+		OrphanedSnapshots: []OrphanedResource{
+			{Type: "VolumeSnapshot", Name: "a"},
+			{Type: "TrueNASSnapshot", Name: "b"},
+			{Type: "TrueNASSnapshot", Name: "c"},
+		},
+	}
+
+	result.setSnapshotCounts(snapshotTotals{K8s: 4, TrueNAS: 10})
+
+	if result.TotalK8sSnapshots != 4 || result.TotalTrueNASSnapshots != 10 {
+		t.Fatalf("totals = %d/%d, want 4/10", result.TotalK8sSnapshots, result.TotalTrueNASSnapshots)
+	}
+	if result.OrphanedK8sSnapshots != 1 || result.OrphanedTrueNASSnapshots != 2 {
+		t.Fatalf("orphaned = %d/%d, want 1/2", result.OrphanedK8sSnapshots, result.OrphanedTrueNASSnapshots)
+	}
+	if result.TotalSnapshots != 14 {
+		t.Fatalf("deprecated TotalSnapshots = %d, want 14", result.TotalSnapshots)
+	}
+	if result.OrphanedK8sSnapshots > result.TotalK8sSnapshots ||
+		result.OrphanedTrueNASSnapshots > result.TotalTrueNASSnapshots {
+		t.Fatal("orphaned counts must never exceed their per-source totals")
+	}
+	if _, ok := result.Deprecated["total_snapshots"]; !ok {
+		t.Fatal("expected deprecation note for total_snapshots")
+	}
+}
+
+func TestOrphanedResource_KeyPrefersUID(t *testing.T) {
+	original := OrphanedResource{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data", UID: "uid-1"}
+	recreated := OrphanedResource{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data", UID: "uid-2"}
+	if original.Key() == recreated.Key() {
+		t.Fatal("same-name resources with different UIDs must have different keys")
+	}
+
+	renamed := OrphanedResource{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "data-renamed", UID: "uid-1"}
+	if original.Key() != renamed.Key() {
+		t.Fatal("resources sharing a UID must share a key")
+	}
+
+	noUID := OrphanedResource{Type: "TrueNASSnapshot", Name: "tank/k8s/vol@snap"}
+	if noUID.Key() != "TrueNASSnapshot/name//tank/k8s/vol@snap" {
+		t.Fatalf("unexpected name-based key %q", noUID.Key())
+	}
+}
@@ -0,0 +1,77 @@
+package orphan
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SeverityCritical marks findings that risk data loss or corruption.
+const SeverityCritical = "critical"
+
+// DuplicateHandleCategory is the alert category for shared volume handles.
+const DuplicateHandleCategory = "duplicate_volume_handle"
+
+// DuplicateHandlePV is one of the PVs sharing a volume handle.
+type DuplicateHandlePV struct {
+	Name           string   `json:"name"`
+	UID            string   `json:"uid,omitempty"`
+	Driver         string   `json:"driver"`
+	ClaimNamespace string   `json:"claim_namespace,omitempty"`
+	ClaimName      string   `json:"claim_name,omitempty"`
+	AccessModes    []string `json:"access_modes"`
+	StorageClass   string   `json:"storage_class,omitempty"`
+}
+
+// DuplicateVolumeHandle is a volume handle referenced by more than one PV.
+// Mounting such PVs read-write at the same time corrupts the shared dataset,
+// which typically happens after restoring cloned PVs from a backup.
+type DuplicateVolumeHandle struct {
+	VolumeHandle      string              `json:"volume_handle"`
+	Severity          string              `json:"severity"`
+	Category          string              `json:"category"`
+	PersistentVolumes []DuplicateHandlePV `json:"persistent_volumes"`
+}
+
+// FindDuplicateVolumeHandles groups CSI PVs by volume handle and returns the
+// handles used by more than one PV, sorted by handle with PVs sorted by name.
+func FindDuplicateVolumeHandles(pvs []corev1.PersistentVolume) []DuplicateVolumeHandle {
+	byHandle := make(map[string][]DuplicateHandlePV)
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle == "" {
+			continue
+		}
+		entry := DuplicateHandlePV{
+			Name:         pv.Name,
+			UID:          string(pv.UID),
+			Driver:       pv.Spec.CSI.Driver,
+			AccessModes:  make([]string, 0, len(pv.Spec.AccessModes)),
+			StorageClass: pv.Spec.StorageClassName,
+		}
+		if pv.Spec.ClaimRef != nil {
+			entry.ClaimNamespace = pv.Spec.ClaimRef.Namespace
+			entry.ClaimName = pv.Spec.ClaimRef.Name
+		}
+		for _, mode := range pv.Spec.AccessModes {
+			entry.AccessModes = append(entry.AccessModes, string(mode))
+		}
+		handle := pv.Spec.CSI.VolumeHandle
+		byHandle[handle] = append(byHandle[handle], entry)
+	}
+
+	var duplicates []DuplicateVolumeHandle
+	for handle, entries := range byHandle {
+		if len(entries) < 2 {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		duplicates = append(duplicates, DuplicateVolumeHandle{
+			VolumeHandle:      handle,
+			Severity:          SeverityCritical,
+			Category:          DuplicateHandleCategory,
+			PersistentVolumes: entries,
+		})
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].VolumeHandle < duplicates[j].VolumeHandle })
+	return duplicates
+}
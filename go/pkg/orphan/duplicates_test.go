@@ -0,0 +1,76 @@
+package orphan
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func handlePV(name, handle, claimNamespace string, modes ...corev1.PersistentVolumeAccessMode) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			AccessModes: modes,
+			ClaimRef:    &corev1.ObjectReference{Namespace: claimNamespace, Name: "data-" + name},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "org.democratic-csi.nfs",
+					VolumeHandle: handle,
+				},
+			},
+		},
+	}
+}
+
+func TestFindDuplicateVolumeHandles(t *testing.T) {
+	pvs := []corev1.PersistentVolume{
+		handlePV("pv-restored", "pvc-1111", "restore", corev1.ReadWriteMany),
+		handlePV("pv-original", "pvc-1111", "apps", corev1.ReadWriteOnce),
+		handlePV("pv-unique", "pvc-2222", "apps", corev1.ReadWriteOnce),
+		{ObjectMeta: metav1.ObjectMeta{Name: "pv-hostpath"}},
+	}
+
+	duplicates := FindDuplicateVolumeHandles(pvs)
+
+	if len(duplicates) != 1 {
+		t.Fatalf("expected 1 duplicate handle, got %+v", duplicates)
+	}
+	dup := duplicates[0]
+	if dup.VolumeHandle != "pvc-1111" || dup.Severity != SeverityCritical || dup.Category != DuplicateHandleCategory {
+		t.Fatalf("unexpected duplicate: %+v", dup)
+	}
+	if len(dup.PersistentVolumes) != 2 || dup.PersistentVolumes[0].Name != "pv-original" {
+		t.Fatalf("expected PVs sorted by name, got %+v", dup.PersistentVolumes)
+	}
+	restored := dup.PersistentVolumes[1]
+	if restored.ClaimNamespace != "restore" || len(restored.AccessModes) != 1 || restored.AccessModes[0] != "ReadWriteMany" {
+		t.Fatalf("unexpected PV details: %+v", restored)
+	}
+}
+
+func TestDetectOrphanedResources_ReportsDuplicateHandles(t *testing.T) {
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		handlePV("pv-a", "tank/k8s/shared", "apps", corev1.ReadWriteOnce),
+		handlePV("pv-b", "tank/k8s/shared", "restore", corev1.ReadWriteOnce),
+	}}
+	d, err := NewDetector(k8sClient, &truenastest.Client{
+		Volumes: []truenas.Volume{{Name: "tank/k8s/shared"}},
+	}, Config{})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedResources(context.Background(), "")
+	if err != nil {
+		t.Fatalf("DetectOrphanedResources: %v", err)
+	}
+	if len(result.DuplicateVolumeHandles) != 1 || result.DuplicateVolumeHandles[0].VolumeHandle != "tank/k8s/shared" {
+		t.Fatalf("unexpected duplicates: %+v", result.DuplicateVolumeHandles)
+	}
+}
@@ -0,0 +1,103 @@
+package orphan
+
+import (
+	"path"
+	"strings"
+)
+
+// IgnoreAnnotation excludes a Kubernetes object from orphan reports when set
+// to "true", regardless of the configured exclusion rules.
+const IgnoreAnnotation = "truenas-monitor.io/ignore"
+
+// Exclusions lists resources that are intentionally detached, such as DR seed
+// datasets or manual backups. Excluded orphans are counted in
+// DetectionResult.Excluded instead of being reported.
+//
+// Names and Patterns are compared with the resource name, "namespace/name",
+// the PV volume handle and its dataset, and the dataset of a TrueNAS
+// snapshot. Patterns use path.Match syntax. Labels and Annotations match when
+// every listed key has the given value; "*" matches any value.
+type Exclusions struct {
+	Names       []string
+	Patterns    []string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Empty reports whether no exclusion rules are configured.
+func (e Exclusions) Empty() bool {
+	return len(e.Names) == 0 && len(e.Patterns) == 0 && len(e.Labels) == 0 && len(e.Annotations) == 0
+}
+
+// Excludes reports whether the orphan matches any exclusion rule or carries
+// IgnoreAnnotation.
+func (e Exclusions) Excludes(resource OrphanedResource) bool {
+	if resource.Annotations[IgnoreAnnotation] == "true" {
+		return true
+	}
+	if len(e.Labels) > 0 && selectorMatches(e.Labels, resource.Labels) {
+		return true
+	}
+	if len(e.Annotations) > 0 && selectorMatches(e.Annotations, resource.Annotations) {
+		return true
+	}
+
+	for _, candidate := range exclusionCandidates(resource) {
+		for _, name := range e.Names {
+			if candidate == name {
+				return true
+			}
+		}
+		for _, pattern := range e.Patterns {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exclusionCandidates returns the identifiers Names and Patterns are compared with.
+func exclusionCandidates(resource OrphanedResource) []string {
+	candidates := []string{resource.Name}
+	if resource.Namespace != "" {
+		candidates = append(candidates, resource.Namespace+"/"+resource.Name)
+	}
+	if resource.VolumeHandle != "" {
+		candidates = append(candidates, resource.VolumeHandle)
+		if dataset := extractDatasetFromVolumeHandle(resource.VolumeHandle); dataset != "" {
+			candidates = append(candidates, dataset)
+		}
+	}
+	if resource.Type == "TrueNASSnapshot" {
+		if idx := strings.LastIndex(resource.Name, "@"); idx > 0 {
+			candidates = append(candidates, resource.Name[:idx])
+		}
+	}
+	return candidates
+}
+
+func selectorMatches(selector, values map[string]string) bool {
+	for key, want := range selector {
+		got, ok := values[key]
+		if !ok || (want != "*" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyExclusions removes excluded orphans from resources and records them on
+// result.
+func (d *Detector) applyExclusions(result *DetectionResult, resources []OrphanedResource) []OrphanedResource {
+	kept := resources[:0]
+	for _, resource := range resources {
+		if d.config.Exclusions.Excludes(resource) {
+			result.Excluded++
+			result.ExcludedResources = append(result.ExcludedResources, resource)
+			continue
+		}
+		kept = append(kept, resource)
+	}
+	return kept
+}
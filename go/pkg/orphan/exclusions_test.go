@@ -0,0 +1,73 @@
+package orphan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestExclusions_Excludes(t *testing.T) {
+	rules := Exclusions{
+		Names:       []string{"apps/manual-restore"},
+		Patterns:    []string{"dr-seed-*"},
+		Labels:      map[string]string{"backup.example.com/keep": "*"},
+		Annotations: map[string]string{"owner": "storage-team"},
+	}
+
+	tests := []struct {
+		name     string
+		resource OrphanedResource
+		want     bool
+	}{
+		{"namespaced exact name", OrphanedResource{Type: "PersistentVolumeClaim", Namespace: "apps", Name: "manual-restore"}, true},
+		{"name in other namespace", OrphanedResource{Type: "PersistentVolumeClaim", Namespace: "web", Name: "manual-restore"}, false},
+		{"pattern on volume handle dataset", OrphanedResource{Type: "PersistentVolume", Name: "pv-1", VolumeHandle: "tank/k8s/dr-seed-1"}, true},
+		{"pattern on truenas snapshot dataset", OrphanedResource{Type: "TrueNASSnapshot", Name: "dr-seed-2@weekly"}, true},
+		{"label wildcard value", OrphanedResource{Name: "pv-2", Labels: map[string]string{"backup.example.com/keep": "yes"}}, true},
+		{"annotation value mismatch", OrphanedResource{Name: "pv-3", Annotations: map[string]string{"owner": "apps"}}, false},
+		{"ignore annotation", OrphanedResource{Name: "pv-4", Annotations: map[string]string{IgnoreAnnotation: "true"}}, true},
+		{"ignore annotation false", OrphanedResource{Name: "pv-5", Annotations: map[string]string{IgnoreAnnotation: "false"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.Excludes(tt.resource); got != tt.want {
+				t.Fatalf("Excludes(%+v) = %v, want %v", tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectOrphanedPVs_CountsExcluded(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ignored := orphanCandidatePV("pv-ignored", now.Add(-48*time.Hour))
+	ignored.Annotations = map[string]string{IgnoreAnnotation: "true"}
+
+	d, err := NewDetector(&k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		orphanCandidatePV("pv-orphan", now.Add(-48*time.Hour)),
+		orphanCandidatePV("dr-seed-db", now.Add(-48*time.Hour)),
+		ignored,
+	}}, &truenastest.Client{}, Config{
+		Clock:      clock.NewFake(now),
+		Exclusions: Exclusions{Patterns: []string{"dr-seed-*"}},
+	})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if len(result.OrphanedPVs) != 1 || result.OrphanedPVs[0].Name != "pv-orphan" {
+		t.Fatalf("expected only pv-orphan reported, got %+v", result.OrphanedPVs)
+	}
+	if result.Excluded != 2 || len(result.ExcludedResources) != 2 {
+		t.Fatalf("excluded = %d (%d listed), want 2", result.Excluded, len(result.ExcludedResources))
+	}
+}
@@ -0,0 +1,110 @@
+package orphan
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// ExportMissingCategory is the alert category for PVs whose dataset exists
+// but is not exported.
+const ExportMissingCategory = "export_missing"
+
+// Export issue kinds.
+const (
+	// ExportDatasetUnmounted is a dataset that exists but is not mounted,
+	// as after a pool import that left datasets unmounted.
+	ExportDatasetUnmounted = "dataset_unmounted"
+	// ExportShareMissing is a mounted dataset no NFS share exports.
+	ExportShareMissing = "share_missing"
+	// ExportShareDisabled is a dataset exported only by disabled shares.
+	ExportShareDisabled = "share_disabled"
+)
+
+// ExportIssue is a PV whose backing dataset exists but cannot be mounted by
+// nodes because it is not exported. Such PVs are never orphans: the data is
+// still on TrueNAS.
+type ExportIssue struct {
+	PersistentVolume string `json:"persistent_volume"`
+	Dataset          string `json:"dataset"`
+	SharePath        string `json:"share_path"`
+	Kind             string `json:"kind"`
+	Message          string `json:"message"`
+	Remediation      string `json:"remediation"`
+}
+
+// exportRemediations tell operators how to restore each kind of export.
+var exportRemediations = map[string]string{
+	ExportDatasetUnmounted: "mount the dataset (zfs mount, or re-import the pool), then check its NFS share",
+	ExportShareMissing:     "re-create the NFS share for the dataset, or restart the democratic-csi controller so it re-exports the volume",
+	ExportShareDisabled:    "re-enable the NFS share",
+}
+
+// checkExports reports the NFS PVs whose dataset exists but is unmounted or
+// not exported by an enabled share. PVs without a matching dataset are left
+// to orphan correlation.
+func checkExports(pvs []pvRecord, volumes *volumeIndex, shares []truenas.NFSShare) []ExportIssue {
+	var issues []ExportIssue
+	for _, pv := range pvs {
+		if pv.SharePath == "" || pv.ParseErr != nil {
+			continue
+		}
+		volume, ok := volumes.find(pv)
+		if !ok || volume.Type != truenas.VolumeTypeFilesystem {
+			continue
+		}
+		issue := ExportIssue{PersistentVolume: pv.Name, Dataset: volume.Name, SharePath: pv.SharePath}
+		switch {
+		case volume.Path == "":
+			issue.Kind = ExportDatasetUnmounted
+			issue.Message = fmt.Sprintf("dataset %s exists but is not mounted", volume.Name)
+		default:
+			covered, enabled := false, false
+			for _, share := range shares {
+				if share.Covers(pv.SharePath) {
+					covered = true
+					enabled = enabled || share.Enabled
+				}
+			}
+			switch {
+			case enabled:
+				continue
+			case covered:
+				issue.Kind = ExportShareDisabled
+				issue.Message = fmt.Sprintf("the NFS share exporting %s is disabled", pv.SharePath)
+			default:
+				issue.Kind = ExportShareMissing
+				issue.Message = fmt.Sprintf("no NFS share exports %s", pv.SharePath)
+			}
+		}
+		issue.Remediation = exportRemediations[issue.Kind]
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// listNFSShares lists the NFS shares for checkExports. Errors are logged
+// and skip the export check; they never affect orphan correlation.
+func listNFSShares(ctx context.Context, client truenas.Client, logger *logging.Logger) ([]truenas.NFSShare, bool) {
+	shares, err := client.GetNFSShares(ctx)
+	if err != nil {
+		logger.Warn("Failed to list NFS shares, skipping the export check",
+			logging.RedactedError(err))
+		return nil, false
+	}
+	logger.Debug("Listed NFS shares", zap.Int("count", len(shares)))
+	return shares, true
+}
+
+func hasNFSRecords(pvs []pvRecord) bool {
+	for _, pv := range pvs {
+		if pv.SharePath != "" {
+			return true
+		}
+	}
+	return false
+}
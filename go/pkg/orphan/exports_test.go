@@ -0,0 +1,104 @@
+package orphan
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func nfsPV(name string) corev1.PersistentVolume {
+	pv := handlePV(name, name, "apps", corev1.ReadWriteMany)
+	pv.CreationTimestamp = metav1.Unix(0, 0)
+	pv.Spec.CSI.VolumeAttributes = map[string]string{"share": "/mnt/tank/k8s/" + name}
+	return pv
+}
+
+func nfsDataset(name string, mounted bool) truenas.Volume {
+	volume := truenas.Volume{ID: "tank/k8s/" + name, Name: "tank/k8s/" + name, Type: truenas.VolumeTypeFilesystem}
+	if mounted {
+		volume.Path = "/mnt/tank/k8s/" + name
+	}
+	return volume
+}
+
+// After a pool import left datasets unmounted, TrueNAS lists the datasets
+// without a mountpoint and no NFS share exports them. The PVs must be
+// reported as not exported, never as orphans.
+func TestDetectOrphanedPVs_UnmountedDatasetsAreNotOrphans(t *testing.T) {
+	tn := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			nfsDataset("pvc-unmounted", false),
+			nfsDataset("pvc-unshared", true),
+			nfsDataset("pvc-disabled", true),
+			nfsDataset("pvc-ok", true),
+		},
+		NFSShares: []truenas.NFSShare{
+			{ID: 1, Path: "/mnt/tank/k8s/pvc-disabled", Enabled: false},
+			{ID: 2, Path: "/mnt/tank/k8s/pvc-ok", Enabled: true},
+		},
+	}
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		nfsPV("pvc-unmounted"), nfsPV("pvc-unshared"), nfsPV("pvc-disabled"), nfsPV("pvc-ok"), nfsPV("pvc-gone"),
+	}}
+	d, err := NewDetector(k8sClient, tn, Config{})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if len(result.OrphanedPVs) != 1 || result.OrphanedPVs[0].Name != "pvc-gone" {
+		t.Fatalf("orphaned PVs = %+v, want only pvc-gone", result.OrphanedPVs)
+	}
+	if !result.ExportsChecked {
+		t.Fatal("exports were not checked")
+	}
+	kinds := make(map[string]string)
+	for _, issue := range result.ExportMissing {
+		if issue.Remediation == "" {
+			t.Errorf("issue %+v has no remediation", issue)
+		}
+		kinds[issue.PersistentVolume] = issue.Kind
+	}
+	want := map[string]string{
+		"pvc-unmounted": ExportDatasetUnmounted,
+		"pvc-unshared":  ExportShareMissing,
+		"pvc-disabled":  ExportShareDisabled,
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("export issues = %+v, want %v", result.ExportMissing, want)
+	}
+	for pv, kind := range want {
+		if kinds[pv] != kind {
+			t.Errorf("%s: kind = %q, want %q", pv, kinds[pv], kind)
+		}
+	}
+}
+
+func TestDetectOrphanedPVs_ShareListingErrorSkipsExportCheck(t *testing.T) {
+	tn := &truenastest.Client{
+		Volumes:         []truenas.Volume{nfsDataset("pvc-unmounted", false)},
+		GetNFSSharesErr: errors.New("502 bad gateway"),
+	}
+	d, err := NewDetector(&k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{nfsPV("pvc-unmounted")}}, tn, Config{})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if len(result.OrphanedPVs) != 0 || result.ExportsChecked || len(result.ExportMissing) != 0 {
+		t.Fatalf("result = %+v, want no orphans and no export check", result)
+	}
+}
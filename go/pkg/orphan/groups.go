@@ -0,0 +1,191 @@
+package orphan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+)
+
+// DefaultGroupWindow is the creation window of an orphan group when none is
+// configured.
+const DefaultGroupWindow = 10 * time.Minute
+
+// Group is a cluster of orphans that probably share one root cause: the same
+// type, namespace, storage class and cause, created within one window. A
+// flood of orphans is usually one incident, such as a namespace deleted
+// while the CSI controller was down.
+type Group struct {
+	// ID is derived from the shared attributes and the first creation time,
+	// so it is stable across scans while the group's oldest member remains.
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Namespace    string `json:"namespace,omitempty"`
+	StorageClass string `json:"storage_class,omitempty"`
+	// Cause is the shared failure reason: the orphan reason, or the
+	// pending_reason of unbound PVCs, whose reasons include their age.
+	Cause string `json:"cause"`
+	// CreatedFrom and CreatedTo bound the members' creation times.
+	CreatedFrom time.Time          `json:"created_from"`
+	CreatedTo   time.Time          `json:"created_to"`
+	Count       int                `json:"count"`
+	Hint        string             `json:"hint"`
+	Resources   []OrphanedResource `json:"resources"`
+}
+
+// Groups clusters the orphans of the result; see GroupOrphans.
+func (r *DetectionResult) Groups(window time.Duration) []Group {
+	resources := make([]OrphanedResource, 0, len(r.OrphanedPVs)+len(r.OrphanedPVCs)+len(r.OrphanedSnapshots)+len(r.OrphanedTrueNASVolumes))
+	resources = append(resources, r.OrphanedPVs...)
+	resources = append(resources, r.OrphanedPVCs...)
+	resources = append(resources, r.OrphanedSnapshots...)
+	resources = append(resources, r.OrphanedTrueNASVolumes...)
+	return GroupOrphans(resources, window)
+}
+
+// GroupOrphans clusters resources sharing type, namespace, storage class and
+// cause, starting a new group whenever a resource was created more than
+// window (0 = DefaultGroupWindow) after the first one of the current group.
+// Every resource lands in exactly one group; groups are sorted by size,
+// largest first.
+func GroupOrphans(resources []OrphanedResource, window time.Duration) []Group {
+	if window <= 0 {
+		window = DefaultGroupWindow
+	}
+
+	type attributes struct{ kind, namespace, storageClass, cause string }
+	buckets := make(map[attributes][]OrphanedResource)
+	var order []attributes
+	for _, resource := range resources {
+		key := attributes{resource.Type, resource.Namespace, resource.StorageClass, groupCause(resource)}
+		if _, ok := buckets[key]; !ok {
+			order = append(order, key)
+		}
+		buckets[key] = append(buckets[key], resource)
+	}
+
+	groups := []Group{}
+	for _, key := range order {
+		members := buckets[key]
+		sort.SliceStable(members, func(i, j int) bool { return members[i].CreatedAt.Before(members[j].CreatedAt) })
+		current := -1
+		for _, member := range members {
+			if current < 0 || member.CreatedAt.Sub(groups[current].CreatedFrom) > window {
+				groups = append(groups, Group{
+					Type:         key.kind,
+					Namespace:    key.namespace,
+					StorageClass: key.storageClass,
+					Cause:        key.cause,
+					CreatedFrom:  member.CreatedAt,
+				})
+				current = len(groups) - 1
+			}
+			groups[current].CreatedTo = member.CreatedAt
+			groups[current].Resources = append(groups[current].Resources, member)
+			groups[current].Count++
+		}
+	}
+
+	for i := range groups {
+		groups[i].ID = groupID(groups[i])
+		groups[i].Hint = groupHint(groups[i])
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+	return groups
+}
+
+// Largest returns up to n members of the group with a known size, largest
+// first.
+func (g Group) Largest(n int) []OrphanedResource {
+	var sized []OrphanedResource
+	for _, resource := range g.Resources {
+		if resource.SizeBytes > 0 {
+			sized = append(sized, resource)
+		}
+	}
+	sort.SliceStable(sized, func(i, j int) bool { return sized[i].SizeBytes > sized[j].SizeBytes })
+	if len(sized) > n {
+		sized = sized[:n]
+	}
+	return sized
+}
+
+// groupCause is the failure reason resources are grouped on.
+func groupCause(resource OrphanedResource) string {
+	if resource.Type == "PersistentVolumeClaim" {
+		if pending := resource.Details["pending_reason"]; pending != "" {
+			return pending
+		}
+		return "unbound"
+	}
+	return resource.Reason
+}
+
+func groupID(group Group) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		group.Type, group.Namespace, group.StorageClass, group.Cause,
+		strconv.FormatInt(group.CreatedFrom.Unix(), 10),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// groupHint describes the group and names its likely root cause, e.g. "42
+// PersistentVolumeClaims created within 8m in namespace payments (storage
+// class nfs): provisioning_failed; likely ...".
+func groupHint(group Group) string {
+	var b strings.Builder
+	noun := group.Type
+	if group.Count != 1 {
+		noun += "s"
+	}
+	fmt.Fprintf(&b, "%s %s", humanize.Count(group.Count), noun)
+	if group.Count > 1 {
+		fmt.Fprintf(&b, " created within %s", humanize.Duration(group.CreatedTo.Sub(group.CreatedFrom)))
+	}
+	if group.Namespace != "" {
+		fmt.Fprintf(&b, " in namespace %s", group.Namespace)
+	}
+	if group.StorageClass != "" {
+		fmt.Fprintf(&b, " (storage class %s)", group.StorageClass)
+	}
+	fmt.Fprintf(&b, ": %s", group.Cause)
+	if cause := likelyCause(group); cause != "" {
+		fmt.Fprintf(&b, "; likely %s", cause)
+	}
+	return b.String()
+}
+
+// likelyCause names the incident that usually leaves many orphans of the
+// group's kind behind at once. Single orphans get no guess.
+func likelyCause(group Group) string {
+	if group.Count < 2 {
+		return ""
+	}
+	switch group.Type {
+	case "PersistentVolume":
+		return "their datasets were destroyed on TrueNAS together or the parent dataset was renamed"
+	case "PersistentVolumeClaim":
+		switch group.Cause {
+		case PendingWaitingForFirstConsumer:
+			return "a workload that was scaled down or deleted before its pods were scheduled"
+		case PendingProvisioningFailed:
+			return "the CSI controller or TrueNAS failed while these claims were provisioned"
+		default:
+			return "the CSI controller was down when these claims were created"
+		}
+	case "VolumeSnapshot":
+		return "their ZFS snapshots were destroyed on TrueNAS together, e.g. by a retention task"
+	case "TrueNASSnapshot":
+		return "their VolumeSnapshots were deleted while the CSI snapshotter was down"
+	case SnapshotContentType:
+		return "a snapshot-controller upgrade or outage left their contents behind"
+	case "TrueNASVolume":
+		return "their PVs were deleted with reclaim policy Retain or while the CSI controller was down"
+	}
+	return ""
+}
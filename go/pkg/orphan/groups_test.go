@@ -0,0 +1,66 @@
+package orphan
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupOrphans_ClustersBySharedAttributesAndWindow(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	pvc := func(name, namespace string, created time.Time) OrphanedResource {
+		return OrphanedResource{
+			Type:         "PersistentVolumeClaim",
+			Name:         name,
+			Namespace:    namespace,
+			StorageClass: "nfs",
+			Reason:       "Unbound for " + name,
+			Details:      map[string]string{"pending_reason": PendingProvisioningFailed},
+			CreatedAt:    created,
+		}
+	}
+	resources := []OrphanedResource{
+		pvc("a", "payments", start),
+		pvc("b", "payments", start.Add(4*time.Minute)),
+		pvc("c", "payments", start.Add(8*time.Minute)),
+		// Outside the window of the first group.
+		pvc("d", "payments", start.Add(3*time.Hour)),
+		pvc("e", "web", start.Add(time.Minute)),
+		{Type: "PersistentVolume", Name: "pv-1", Reason: "No corresponding TrueNAS volume found", CreatedAt: start},
+	}
+
+	groups := GroupOrphans(resources, 10*time.Minute)
+	if len(groups) != 4 {
+		t.Fatalf("got %d groups, want 4: %+v", len(groups), groups)
+	}
+	largest := groups[0]
+	if largest.Count != 3 || largest.Namespace != "payments" || largest.Cause != PendingProvisioningFailed {
+		t.Fatalf("largest group = %+v", largest)
+	}
+	if !largest.CreatedFrom.Equal(start) || !largest.CreatedTo.Equal(start.Add(8*time.Minute)) {
+		t.Fatalf("group window = %s..%s", largest.CreatedFrom, largest.CreatedTo)
+	}
+	want := "3 PersistentVolumeClaims created within 8m in namespace payments (storage class nfs): provisioning_failed; likely "
+	if !strings.HasPrefix(largest.Hint, want) {
+		t.Fatalf("hint = %q, want prefix %q", largest.Hint, want)
+	}
+
+	total := 0
+	ids := map[string]bool{}
+	for _, group := range groups {
+		total += group.Count
+		ids[group.ID] = true
+		if group.Count == 1 && strings.Contains(group.Hint, "likely") {
+			t.Fatalf("single orphan should get no root-cause guess: %q", group.Hint)
+		}
+	}
+	if total != len(resources) || len(ids) != len(groups) {
+		t.Fatalf("groups cover %d of %d resources with %d distinct ids", total, len(resources), len(ids))
+	}
+
+	// IDs are stable across scans while the oldest member stays.
+	again := GroupOrphans(append(resources, pvc("f", "payments", start.Add(9*time.Minute))), 10*time.Minute)
+	if again[0].ID != largest.ID || again[0].Count != 4 {
+		t.Fatalf("regrouped largest = %+v, want id %s with 4 members", again[0], largest.ID)
+	}
+}
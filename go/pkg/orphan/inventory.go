@@ -0,0 +1,386 @@
+package orphan
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Inventories are converted to these records right after listing, so
+// correlating tens of thousands of objects neither keeps the full API
+// objects alive nor copies them per comparison. Labels and annotations are
+// shared with the listed objects rather than copied, so nothing may write
+// into them.
+
+// pvRecord holds the PersistentVolume fields correlation needs.
+type pvRecord struct {
+	Name    string
+	UID     string
+	Handle  string
+	Dataset string
+	// ParseErr is why Handle names no dataset; correlation of the PV is
+	// unknown rather than failed.
+	ParseErr     error
+	StorageClass string
+	// ClaimNamespace is the namespace of the PV's claim; "" when unbound.
+	ClaimNamespace string
+	// SharePath is the exported path of an NFS PV; "" for other drivers.
+	SharePath string
+	Size      string
+	// RequestedBytes is the requested capacity; 0 when none is set.
+	RequestedBytes int64
+	Labels         map[string]string
+	Annotations    map[string]string
+	CreatedAt      time.Time
+}
+
+func newPVRecords(pvs []corev1.PersistentVolume) []pvRecord {
+	records := make([]pvRecord, len(pvs))
+	for i := range pvs {
+		pv := &pvs[i]
+		record := pvRecord{
+			Name:         pv.Name,
+			UID:          string(pv.UID),
+			StorageClass: pv.Spec.StorageClassName,
+			Labels:       pv.Labels,
+			Annotations:  pv.Annotations,
+			CreatedAt:    pv.CreationTimestamp.Time,
+		}
+		if pv.Spec.ClaimRef != nil {
+			record.ClaimNamespace = pv.Spec.ClaimRef.Namespace
+		}
+		if storage, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+			record.Size = storage.String()
+			record.RequestedBytes = storage.Value()
+		}
+		if pv.Spec.CSI != nil {
+			record.Handle = pv.Spec.CSI.VolumeHandle
+			record.Dataset, record.ParseErr = parseVolumeHandle(record.Handle)
+			record.SharePath = k8s.NFSSharePath(pv.Spec.CSI.Driver, pv.Spec.CSI.VolumeAttributes)
+		}
+		records[i] = record
+	}
+	return records
+}
+
+// volumeRecord holds the TrueNAS volume fields a PV handle is matched on.
+type volumeRecord struct {
+	Name string
+	ID   string
+	Type string
+	// Path is trimmed of trailing slashes.
+	Path   string
+	Values []string
+	Used   int64
+	// CreatedAt is zero when TrueNAS did not report the creation time.
+	CreatedAt time.Time
+}
+
+func newVolumeRecord(volume truenas.Volume) volumeRecord {
+	record := volumeRecord{
+		Name:      volume.Name,
+		ID:        volume.ID,
+		Type:      volume.Type,
+		Path:      strings.TrimRight(volume.Path, "/"),
+		Used:      volume.Used,
+		CreatedAt: volume.CreatedAt,
+	}
+	if len(volume.Properties) > 0 {
+		record.Values = make([]string, 0, len(volume.Properties))
+		for _, value := range volume.Properties {
+			record.Values = append(record.Values, value)
+		}
+	}
+	return record
+}
+
+// volumeIndex finds the volumes a PV handle may match without scanning all
+// of them. Every field volumeMatches compares is indexed whole and by its
+// last "/" and ":" segment, which covers the suffix matches for datasets
+// without separators; other datasets fall back to a full scan.
+type volumeIndex struct {
+	volumes []volumeRecord
+	byKey   map[string][]int32
+}
+
+func newVolumeIndex(volumes []truenas.Volume) *volumeIndex {
+	index := &volumeIndex{
+		volumes: make([]volumeRecord, len(volumes)),
+		byKey:   make(map[string][]int32, 2*len(volumes)),
+	}
+	for i, volume := range volumes {
+		record := newVolumeRecord(volume)
+		index.volumes[i] = record
+		keys := make(map[string]bool, 8)
+		for _, value := range append([]string{record.Name, record.ID, record.Path}, record.Values...) {
+			addIndexKeys(keys, value)
+		}
+		for key := range keys {
+			index.byKey[key] = append(index.byKey[key], int32(i))
+		}
+	}
+	return index
+}
+
+// addIndexKeys adds value and its segments after the last "/" and ":".
+func addIndexKeys(keys map[string]bool, value string) {
+	if value == "" {
+		return
+	}
+	keys[value] = true
+	if idx := strings.LastIndex(value, "/"); idx >= 0 {
+		keys[value[idx+1:]] = true
+	}
+	if idx := strings.LastIndex(value, ":"); idx >= 0 {
+		keys[value[idx+1:]] = true
+	}
+}
+
+// find returns the first volume matching the PV, if any. A nil index has no
+// volumes.
+func (x *volumeIndex) find(pv pvRecord) (volumeRecord, bool) {
+	if x == nil || pv.Dataset == "" {
+		return volumeRecord{}, false
+	}
+	if strings.ContainsAny(pv.Dataset, "/:") {
+		for _, volume := range x.volumes {
+			if volumeMatches(volume, pv.Handle, pv.Dataset) {
+				return volume, true
+			}
+		}
+		return volumeRecord{}, false
+	}
+	for _, key := range []string{pv.Dataset, pv.Handle} {
+		for _, i := range x.byKey[key] {
+			if volume := x.volumes[i]; volumeMatches(volume, pv.Handle, pv.Dataset) {
+				return volume, true
+			}
+		}
+	}
+	return volumeRecord{}, false
+}
+
+// MatchedVolumeNames returns the names of the volumes the democratic-csi
+// PVs correlate with, matched the way orphan detection matches them: on
+// full dataset paths, iSCSI IQNs, share paths and democratic-csi properties.
+func MatchedVolumeNames(pvs []corev1.PersistentVolume, volumes []truenas.Volume) map[string]bool {
+	index := newVolumeIndex(volumes)
+	matched := make(map[string]bool, len(pvs))
+	for _, pv := range newPVRecords(pvs) {
+		if volume, ok := index.find(pv); ok {
+			matched[volume.Name] = true
+		}
+	}
+	return matched
+}
+
+// InventoryCounts compares the democratic-csi PVs with the TrueNAS volumes
+// correlation matched them to. A TrueNAS volume counts as managed when it
+// sits directly in a parent dataset that holds at least one matched volume,
+// so the counts need no StorageClass configuration.
+type InventoryCounts struct {
+	K8sManagedPVs         int `json:"k8s_managed_pvs"`
+	TrueNASManagedVolumes int `json:"truenas_managed_volumes"`
+	// UnmatchedK8s counts PVs, of any age, without a TrueNAS volume.
+	UnmatchedK8s int `json:"unmatched_k8s"`
+	// UnmatchedTrueNAS counts managed volumes no PV matched.
+	UnmatchedTrueNAS int `json:"unmatched_truenas"`
+	// Drift is UnmatchedK8s + UnmatchedTrueNAS, and DriftPercent its share
+	// of the larger of the two inventories.
+	Drift        int     `json:"drift"`
+	DriftPercent float64 `json:"drift_percent"`
+	// CapacityPVs counts the matched PVs with a requested capacity;
+	// RequestedBytes sums their requested capacity and UsedBytes the used
+	// bytes of their volumes.
+	CapacityPVs    int   `json:"capacity_pvs"`
+	RequestedBytes int64 `json:"requested_bytes"`
+	UsedBytes      int64 `json:"used_bytes"`
+}
+
+// countInventory matches every PV against the volume index, regardless of
+// age, and counts both sides. SMB share entries duplicate their dataset and
+// are not counted as volumes, and PVs whose handle does not parse count as
+// managed but never as unmatched.
+func countInventory(pvs []pvRecord, volumes *volumeIndex) InventoryCounts {
+	counts, _ := matchInventory(pvs, volumes)
+	return counts
+}
+
+// matchInventory is countInventory that also returns the unmatched managed
+// volumes, the candidates for TrueNAS-side orphans.
+func matchInventory(pvs []pvRecord, volumes *volumeIndex) (InventoryCounts, []volumeRecord) {
+	counts := InventoryCounts{K8sManagedPVs: len(pvs)}
+	var unmatched []volumeRecord
+	matched := make(map[string]bool, len(pvs))
+	for _, pv := range pvs {
+		if pv.ParseErr != nil {
+			continue
+		}
+		volume, ok := volumes.find(pv)
+		if !ok {
+			counts.UnmatchedK8s++
+			continue
+		}
+		matched[volume.Name] = true
+		if pv.RequestedBytes > 0 {
+			counts.CapacityPVs++
+			counts.RequestedBytes += pv.RequestedBytes
+			counts.UsedBytes += volume.Used
+		}
+	}
+
+	parents := make(map[string]bool)
+	for name := range matched {
+		if idx := strings.LastIndex(name, "/"); idx > 0 {
+			parents[name[:idx]] = true
+		}
+	}
+	if volumes != nil {
+		for _, volume := range volumes.volumes {
+			idx := strings.LastIndex(volume.Name, "/")
+			if volume.Type == truenas.VolumeTypeSMB || idx <= 0 || !parents[volume.Name[:idx]] {
+				continue
+			}
+			counts.TrueNASManagedVolumes++
+			if !matched[volume.Name] {
+				counts.UnmatchedTrueNAS++
+				unmatched = append(unmatched, volume)
+			}
+		}
+	}
+
+	counts.Drift = counts.UnmatchedK8s + counts.UnmatchedTrueNAS
+	if total := max(counts.K8sManagedPVs, counts.TrueNASManagedVolumes); total > 0 {
+		counts.DriftPercent = float64(counts.Drift) / float64(total) * 100
+	}
+	return counts, unmatched
+}
+
+// k8sSnapshotRecord holds the VolumeSnapshot fields correlation needs.
+type k8sSnapshotRecord struct {
+	Name        string
+	Namespace   string
+	UID         string
+	Labels      map[string]string
+	Annotations map[string]string
+	CreatedAt   time.Time
+	// Hints are the dataset hints of k8sSnapshotDatasetHints, trimmed of
+	// slashes.
+	Hints []string
+}
+
+func newK8sSnapshotRecords(snapshots []snapshotv1.VolumeSnapshot) []k8sSnapshotRecord {
+	records := make([]k8sSnapshotRecord, len(snapshots))
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		hints := k8sSnapshotDatasetHints(snapshot)
+		for j, hint := range hints {
+			hints[j] = strings.Trim(hint, "/")
+		}
+		records[i] = k8sSnapshotRecord{
+			Name:        snapshot.Name,
+			Namespace:   snapshot.Namespace,
+			UID:         string(snapshot.UID),
+			Labels:      snapshot.Labels,
+			Annotations: snapshot.Annotations,
+			CreatedAt:   snapshot.CreationTimestamp.Time,
+			Hints:       hints,
+		}
+	}
+	return records
+}
+
+// truenasSnapshotRecord holds the TrueNAS snapshot fields correlation needs.
+type truenasSnapshotRecord struct {
+	Name string
+	// FullName is dataset@name and Component the part after the last "@".
+	FullName  string
+	Component string
+	Dataset   string
+	GUID      string
+	Used      int64
+	CreatedAt time.Time
+}
+
+func newTrueNASSnapshotRecords(snapshots []truenas.Snapshot) []truenasSnapshotRecord {
+	records := make([]truenasSnapshotRecord, len(snapshots))
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		full := truenasSnapshotFullName(*snapshot)
+		component := snapshot.Name
+		if idx := strings.LastIndex(full, "@"); idx >= 0 {
+			component = full[idx+1:]
+		}
+		records[i] = truenasSnapshotRecord{
+			Name:      snapshot.Name,
+			FullName:  full,
+			Component: component,
+			Dataset:   snapshot.Dataset,
+			GUID:      snapshot.Properties["guid"],
+			Used:      snapshot.Used,
+			CreatedAt: snapshot.CreatedAt,
+		}
+	}
+	return records
+}
+
+// correlateSnapshots reports which snapshots on each side have a peer on the
+// other. TrueNAS snapshots are indexed by the names snapshotNameMatches
+// compares, so only same-name pairs are checked; Kubernetes names with an
+// "@", which the API server rejects, fall back to a full scan. It stops early
+// with ctx's error when ctx is done.
+func correlateSnapshots(ctx context.Context, k8sSnapshots []k8sSnapshotRecord, truenasSnapshots []truenasSnapshotRecord) (k8sMatched, truenasMatched []bool, err error) {
+	return correlateSnapshotsFunc(ctx, k8sSnapshots, truenasSnapshots, nil)
+}
+
+// correlateSnapshotsFunc is correlateSnapshots that also calls onMatch, when
+// not nil, with the indexes of every matching pair.
+func correlateSnapshotsFunc(
+	ctx context.Context,
+	k8sSnapshots []k8sSnapshotRecord,
+	truenasSnapshots []truenasSnapshotRecord,
+	onMatch func(k8sIndex, truenasIndex int),
+) (k8sMatched, truenasMatched []bool, err error) {
+	k8sMatched = make([]bool, len(k8sSnapshots))
+	truenasMatched = make([]bool, len(truenasSnapshots))
+
+	byName := make(map[string][]int32, len(truenasSnapshots))
+	for i, snapshot := range truenasSnapshots {
+		names := [3]string{snapshot.Component, snapshot.Name, snapshot.FullName}
+		for k, name := range names {
+			if name == "" || (k > 0 && name == names[0]) || (k == 2 && name == names[1]) {
+				continue
+			}
+			byName[name] = append(byName[name], int32(i))
+		}
+	}
+
+	for i, snapshot := range k8sSnapshots {
+		if err := ctx.Err(); err != nil {
+			return k8sMatched, truenasMatched, err
+		}
+		candidates := byName[snapshot.Name]
+		if strings.Contains(snapshot.Name, "@") {
+			candidates = nil
+			for j := range truenasSnapshots {
+				candidates = append(candidates, int32(j))
+			}
+		}
+		for _, j := range candidates {
+			if snapshotCorrelatesPair(snapshot, truenasSnapshots[j]) {
+				k8sMatched[i] = true
+				truenasMatched[j] = true
+				if onMatch != nil {
+					onMatch(i, int(j))
+				}
+			}
+		}
+	}
+	return k8sMatched, truenasMatched, nil
+}
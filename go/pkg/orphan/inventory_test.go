@@ -0,0 +1,376 @@
+package orphan
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+// largeInventory is a synthetic environment with pvs PVs and datasets, one
+// VolumeSnapshot for every other PV and snapshotsPerDataset TrueNAS
+// snapshots per dataset: the VolumeSnapshot peers plus periodic snapshots
+// whose names repeat across datasets. One PV in a hundred has no dataset.
+type largeInventory struct {
+	pvs              []corev1.PersistentVolume
+	volumes          []truenas.Volume
+	k8sSnapshots     []snapshotv1.VolumeSnapshot
+	truenasSnapshots []truenas.Snapshot
+}
+
+func newLargeInventory(pvs, snapshotsPerDataset int, created time.Time) largeInventory {
+	var inv largeInventory
+	for i := 0; i < pvs; i++ {
+		name := fmt.Sprintf("pvc-%08d", i)
+		dataset := "tank/k8s/" + name
+		inv.pvs = append(inv.pvs, corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				UID:               types.UID("uid-" + name),
+				CreationTimestamp: metav1.NewTime(created),
+				Labels:            map[string]string{"app": "db"},
+			},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity:         corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				StorageClassName: "democratic-csi-nfs",
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: name},
+				},
+			},
+		})
+		if i%100 != 0 {
+			inv.volumes = append(inv.volumes, truenas.Volume{
+				ID:         dataset,
+				Name:       dataset,
+				Path:       "/mnt/" + dataset,
+				Type:       truenas.VolumeTypeFilesystem,
+				Properties: map[string]string{"mountpoint": "/mnt/" + dataset},
+			})
+		}
+
+		snapshots := snapshotsPerDataset
+		if i%2 == 0 {
+			snapshotName := "snapshot-" + name
+			inv.k8sSnapshots = append(inv.k8sSnapshots, snapshotv1.VolumeSnapshot{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              snapshotName,
+					Namespace:         "apps",
+					CreationTimestamp: metav1.NewTime(created),
+					Annotations:       map[string]string{"zfs.dataset": dataset},
+				},
+			})
+			inv.truenasSnapshots = append(inv.truenasSnapshots, truenas.Snapshot{
+				Name: dataset + "@" + snapshotName, Dataset: dataset, Used: 1 << 20, CreatedAt: created,
+			})
+			snapshots--
+		}
+		for j := 0; j < snapshots; j++ {
+			inv.truenasSnapshots = append(inv.truenasSnapshots, truenas.Snapshot{
+				Name: fmt.Sprintf("auto-%d", j), Dataset: dataset, Used: 1 << 20, CreatedAt: created,
+			})
+		}
+	}
+	return inv
+}
+
+// correlate converts the inventory and correlates it as detection does.
+func (inv largeInventory) correlate(d *Detector, now time.Time) (pvOrphans, snapshotOrphans []OrphanedResource, err error) {
+	ctx := context.Background()
+	if err := d.correlatePVs(ctx, newPVRecords(inv.pvs), newVolumeIndex(inv.volumes), now, &pvOrphans, new([]OrphanedResource)); err != nil {
+		return nil, nil, err
+	}
+	snapshotOrphans, _, err = d.detectOrphanedSnapshotsFromLists(ctx,
+		newK8sSnapshotRecords(inv.k8sSnapshots), newTrueNASSnapshotRecords(inv.truenasSnapshots))
+	return pvOrphans, snapshotOrphans, err
+}
+
+func largeInventoryDetector(now time.Time) *Detector {
+	return &Detector{
+		logger: logging.NewNop(),
+		config: Config{
+			AgeThreshold:      time.Hour,
+			SnapshotRetention: time.Hour,
+			Clock:             clock.NewFake(now),
+		},
+	}
+}
+
+// TestCorrelation_LargeInventoryStaysWithinAllocationBudget correlates 10k
+// PVs with 60k TrueNAS snapshots. Matching every pair used to allocate
+// gigabytes; the bytes allocated by conversion, indexing and correlation
+// together must stay under the budget.
+func TestCountInventory_UsesParentsOfMatchedVolumes(t *testing.T) {
+	pv := func(name, handle string) corev1.PersistentVolume {
+		return corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: handle},
+			}},
+		}
+	}
+	pvs := newPVRecords([]corev1.PersistentVolume{
+		pv("pvc-a", "pvc-a"),
+		pv("pvc-b", "pvc-b"),
+		pv("pvc-gone", "pvc-gone"),
+		pv("pvc-zvol", "pvc-zvol"),
+	})
+	volumes := newVolumeIndex([]truenas.Volume{
+		{ID: "tank/k8s/nfs", Name: "tank/k8s/nfs", Type: truenas.VolumeTypeFilesystem},
+		{ID: "tank/k8s/nfs/pvc-a", Name: "tank/k8s/nfs/pvc-a", Type: truenas.VolumeTypeFilesystem},
+		{ID: "tank/k8s/nfs/pvc-b", Name: "tank/k8s/nfs/pvc-b", Type: truenas.VolumeTypeFilesystem},
+		{ID: "tank/k8s/nfs/pvc-stray", Name: "tank/k8s/nfs/pvc-stray", Type: truenas.VolumeTypeFilesystem},
+		{ID: "tank/k8s/nfs/pvc-b", Name: "tank/k8s/nfs/pvc-b", Type: truenas.VolumeTypeSMB},
+		{ID: "tank/k8s/iscsi/pvc-zvol", Name: "tank/k8s/iscsi/pvc-zvol", Type: truenas.VolumeTypeZvol},
+		{ID: "tank/home/alice", Name: "tank/home/alice", Type: truenas.VolumeTypeFilesystem},
+	})
+
+	got := countInventory(pvs, volumes)
+	want := InventoryCounts{
+		K8sManagedPVs:         4,
+		TrueNASManagedVolumes: 4,
+		UnmatchedK8s:          1,
+		UnmatchedTrueNAS:      1,
+		Drift:                 2,
+		DriftPercent:          50,
+	}
+	if got != want {
+		t.Fatalf("countInventory = %+v, want %+v", got, want)
+	}
+
+	if got := countInventory(nil, nil); got != (InventoryCounts{}) {
+		t.Fatalf("empty inventory = %+v", got)
+	}
+}
+
+func TestCountInventory_SumsCapacityOfMatchedPVs(t *testing.T) {
+	pv := func(name, capacity string) corev1.PersistentVolume {
+		pv := corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "org.democratic-csi.nfs", VolumeHandle: name},
+			}},
+		}
+		if capacity != "" {
+			pv.Spec.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)}
+		}
+		return pv
+	}
+	pvs := newPVRecords([]corev1.PersistentVolume{
+		pv("pvc-a", "10Gi"),
+		pv("pvc-b", ""),
+		pv("pvc-gone", "5Gi"),
+	})
+	volumes := newVolumeIndex([]truenas.Volume{
+		{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a", Type: truenas.VolumeTypeFilesystem, Used: 2 << 30},
+		{ID: "tank/k8s/pvc-b", Name: "tank/k8s/pvc-b", Type: truenas.VolumeTypeFilesystem, Used: 1 << 30},
+	})
+
+	got := countInventory(pvs, volumes)
+	if got.CapacityPVs != 1 || got.RequestedBytes != 10<<30 || got.UsedBytes != 2<<30 {
+		t.Fatalf("capacity = %d PVs, %d requested, %d used; want 1 PV, 10Gi requested, 2Gi used",
+			got.CapacityPVs, got.RequestedBytes, got.UsedBytes)
+	}
+}
+
+func TestDetectOrphanedPVs_FlagsOldUnmatchedTrueNASVolumes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tn := &truenastest.Client{Volumes: []truenas.Volume{
+		{ID: "tank/k8s/pvc-a", Name: "tank/k8s/pvc-a", Type: truenas.VolumeTypeFilesystem, CreatedAt: now.Add(-72 * time.Hour)},
+		{ID: "tank/k8s/pvc-old", Name: "tank/k8s/pvc-old", Type: truenas.VolumeTypeFilesystem, Used: 2048, CreatedAt: now.Add(-72 * time.Hour)},
+		{ID: "tank/k8s/pvc-new", Name: "tank/k8s/pvc-new", Type: truenas.VolumeTypeFilesystem, CreatedAt: now.Add(-time.Hour)},
+		{ID: "tank/k8s/pvc-unknown", Name: "tank/k8s/pvc-unknown", Type: truenas.VolumeTypeFilesystem},
+	}}
+	d, err := NewDetector(&k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		handlePV("pv-a", "pvc-a", "apps"),
+	}}, tn, Config{AgeThreshold: 24 * time.Hour, Clock: clock.NewFake(now)})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if result.Inventory == nil || result.Inventory.UnmatchedTrueNAS != 3 {
+		t.Fatalf("inventory = %+v, want 3 unmatched TrueNAS volumes", result.Inventory)
+	}
+	got := result.OrphanedTrueNASVolumes
+	if len(got) != 1 || got[0].Name != "tank/k8s/pvc-old" || got[0].Type != "TrueNASVolume" || got[0].Age != 72*time.Hour || got[0].Size != "2.0KiB" {
+		t.Fatalf("expected only the old unmatched dataset, got %+v", got)
+	}
+}
+
+func TestCorrelation_LargeInventoryStaysWithinAllocationBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large synthetic inventory")
+	}
+	const budget = 64 << 20
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	inv := newLargeInventory(10000, 6, now.Add(-48*time.Hour))
+	d := largeInventoryDetector(now)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	pvOrphans, snapshotOrphans, err := inv.correlate(d, now)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("correlate: %v", err)
+	}
+
+	if len(inv.truenasSnapshots) != 60000 {
+		t.Fatalf("synthetic TrueNAS snapshots = %d, want 60000", len(inv.truenasSnapshots))
+	}
+	if len(pvOrphans) != 100 {
+		t.Fatalf("orphaned PVs = %d, want the 100 without a dataset", len(pvOrphans))
+	}
+	// Every periodic snapshot lacks a VolumeSnapshot; every VolumeSnapshot
+	// has its TrueNAS peer.
+	if want := 60000 - len(inv.k8sSnapshots); len(snapshotOrphans) != want {
+		t.Fatalf("orphaned snapshots = %d, want %d", len(snapshotOrphans), want)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > budget {
+		t.Fatalf("correlation allocated %d MiB, budget %d MiB", allocated>>20, budget>>20)
+	}
+}
+
+func BenchmarkCorrelation_10kPVs60kSnapshots(b *testing.B) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	inv := newLargeInventory(10000, 6, now.Add(-48*time.Hour))
+	d := largeInventoryDetector(now)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := inv.correlate(d, now); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// cachedK8sClient serves PVs and VolumeSnapshots from a store that resync
+// rewrites in place, as an informer cache updates the objects it holds.
+type cachedK8sClient struct {
+	k8stest.Client
+	mu sync.RWMutex
+}
+
+func (c *cachedK8sClient) ListDemocraticCSIPersistentVolumes(ctx context.Context) ([]corev1.PersistentVolume, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Client.ListDemocraticCSIPersistentVolumes(ctx)
+}
+
+func (c *cachedK8sClient) ListVolumeSnapshots(ctx context.Context, namespace string) ([]snapshotv1.VolumeSnapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Client.ListVolumeSnapshots(ctx, namespace)
+}
+
+func (c *cachedK8sClient) resync(generation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.PersistentVolumes {
+		c.PersistentVolumes[i].Labels["generation"] = fmt.Sprint(generation)
+	}
+	for i := range c.VolumeSnapshots {
+		c.VolumeSnapshots[i].Annotations["generation"] = fmt.Sprint(generation)
+	}
+}
+
+// TestDetectOrphanedResources_ConcurrentWithCacheResync runs scans while
+// the cache they list from resyncs, and writes into the labels of the
+// reported orphans. Under the race detector it fails if a listed object or
+// a map derived from one is shared with the cache.
+func TestDetectOrphanedResources_ConcurrentWithCacheResync(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-30 * 24 * time.Hour)
+	client := &cachedK8sClient{}
+	for i := 0; i < 10; i++ {
+		pv := orphanCandidatePV(fmt.Sprintf("pv-%d", i), old)
+		pv.Labels = map[string]string{"app": "db"}
+		pv.Annotations = map[string]string{"note": "kept"}
+		client.PersistentVolumes = append(client.PersistentVolumes, pv)
+		client.VolumeSnapshots = append(client.VolumeSnapshots, snapshotv1.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("snap-%d", i),
+				Namespace:         "apps",
+				CreationTimestamp: metav1.NewTime(old),
+				Annotations:       map[string]string{"truenas.dataset": "tank/k8s/" + pv.Name},
+			},
+		})
+	}
+	d, err := NewDetector(client, &truenastest.Client{}, Config{AgeThreshold: time.Hour, Clock: clock.NewFake(now)})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	stop := make(chan struct{})
+	resynced := make(chan struct{})
+	go func() {
+		defer close(resynced)
+		for generation := 0; ; generation++ {
+			select {
+			case <-stop:
+				return
+			default:
+				client.resync(generation)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				result, err := d.DetectOrphanedResources(context.Background(), "")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(result.OrphanedPVs) != 10 || len(result.OrphanedSnapshots) == 0 {
+					errs <- fmt.Errorf("%d orphaned PVs and %d snapshots, want 10 and some", len(result.OrphanedPVs), len(result.OrphanedSnapshots))
+					return
+				}
+				for _, orphan := range append(result.OrphanedPVs, result.OrphanedSnapshots...) {
+					_ = orphan.Labels["generation"]
+					_ = orphan.Annotations["generation"]
+					if orphan.Labels != nil {
+						orphan.Labels["reported"] = "true"
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-resynced
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	for _, pv := range client.PersistentVolumes {
+		if _, ok := pv.Labels["reported"]; ok {
+			t.Fatalf("a write into reported labels reached the cached PV %s", pv.Name)
+		}
+	}
+}
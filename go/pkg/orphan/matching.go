@@ -1,6 +1,8 @@
 package orphan
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
@@ -17,21 +19,13 @@ func truenasSnapshotFullName(s truenas.Snapshot) string {
 	return s.Name
 }
 
-func truenasSnapshotComponentName(s truenas.Snapshot) string {
-	full := truenasSnapshotFullName(s)
-	if idx := strings.LastIndex(full, "@"); idx >= 0 {
-		return full[idx+1:]
-	}
-	return s.Name
-}
-
-func snapshotNameMatches(k8sName string, tn truenas.Snapshot) bool {
-	full := truenasSnapshotFullName(tn)
-	component := truenasSnapshotComponentName(tn)
-	return tn.Name == k8sName || full == k8sName || strings.HasSuffix(full, "@"+k8sName) || component == k8sName
+// snapshotNameMatches reports whether a TrueNAS snapshot carries the
+// VolumeSnapshot name as its name, full name or snapshot component.
+func snapshotNameMatches(k8sName string, tn truenasSnapshotRecord) bool {
+	return tn.Name == k8sName || tn.FullName == k8sName || strings.HasSuffix(tn.FullName, "@"+k8sName) || tn.Component == k8sName
 }
 
-func k8sSnapshotDatasetHints(k8s snapshotv1.VolumeSnapshot) []string {
+func k8sSnapshotDatasetHints(k8s *snapshotv1.VolumeSnapshot) []string {
 	var hints []string
 	add := func(s string) {
 		s = strings.TrimSpace(s)
@@ -64,13 +58,14 @@ func k8sSnapshotDatasetHints(k8s snapshotv1.VolumeSnapshot) []string {
 	return hints
 }
 
+// truenasDatasetMatchesHints matches a dataset against hints already trimmed
+// of slashes.
 func truenasDatasetMatchesHints(dataset string, hints []string) bool {
 	dataset = strings.Trim(dataset, "/")
 	if dataset == "" {
 		return false
 	}
 	for _, hint := range hints {
-		hint = strings.Trim(hint, "/")
 		if hint == dataset {
 			return true
 		}
@@ -81,47 +76,46 @@ func truenasDatasetMatchesHints(dataset string, hints []string) bool {
 	return false
 }
 
-func snapshotCorrelatesPair(k8s snapshotv1.VolumeSnapshot, tn truenas.Snapshot) bool {
+func snapshotCorrelatesPair(k8s k8sSnapshotRecord, tn truenasSnapshotRecord) bool {
 	if !snapshotNameMatches(k8s.Name, tn) {
 		return false
 	}
 
-	hints := k8sSnapshotDatasetHints(k8s)
-	if len(hints) == 0 {
-		return truenasSnapshotFullName(tn) == k8s.Name
+	if len(k8s.Hints) == 0 {
+		return tn.FullName == k8s.Name
 	}
 
-	return truenasDatasetMatchesHints(tn.Dataset, hints) ||
-		truenasDatasetMatchesHints(truenasSnapshotFullName(tn), hints)
+	return truenasDatasetMatchesHints(tn.Dataset, k8s.Hints) ||
+		truenasDatasetMatchesHints(tn.FullName, k8s.Hints)
 }
 
-func snapshotCorrelatesWithTrueNAS(k8s snapshotv1.VolumeSnapshot, truenasSnapshots []truenas.Snapshot) bool {
-	for _, tn := range truenasSnapshots {
-		if snapshotCorrelatesPair(k8s, tn) {
-			return true
-		}
-	}
-	return false
-}
-
-func truenasSnapshotCorrelatesWithK8s(tn truenas.Snapshot, k8sSnapshots []snapshotv1.VolumeSnapshot) bool {
-	for _, ks := range k8sSnapshots {
-		if snapshotCorrelatesPair(ks, tn) {
-			return true
-		}
+// extractDatasetFromVolumeHandle returns the dataset named by a volume
+// handle, or "" when parseVolumeHandle rejects it.
+func extractDatasetFromVolumeHandle(volumeHandle string) string {
+	dataset, err := parseVolumeHandle(volumeHandle)
+	if err != nil {
+		return ""
 	}
-	return false
+	return dataset
 }
 
-func extractDatasetFromVolumeHandle(volumeHandle string) string {
+// parseVolumeHandle returns the dataset named by a volume handle: the part
+// after the last ":" of an iSCSI IQN, otherwise the part after the last "/",
+// without any "@snapshot" suffix. Handles of volumes migrated from in-tree
+// plugins do not always follow that shape; they fail with an error that says
+// why, so the PV can be reported instead of guessed at.
+func parseVolumeHandle(volumeHandle string) (string, error) {
 	handle := strings.TrimSpace(volumeHandle)
+	if handle == "" {
+		return "", errors.New("volume handle is empty")
+	}
 	if strings.Contains(handle, "iqn.") {
 		handle = strings.TrimRight(handle, ":")
-		if idx := strings.LastIndex(handle, ":"); idx >= 0 && idx+1 < len(handle) {
-			handle = handle[idx+1:]
-		} else {
-			return ""
+		idx := strings.LastIndex(handle, ":")
+		if idx < 0 || idx+1 >= len(handle) {
+			return "", fmt.Errorf("iSCSI volume handle %q has no target name after the last colon", volumeHandle)
 		}
+		handle = handle[idx+1:]
 	} else {
 		handle = strings.TrimRight(handle, "/")
 		if idx := strings.LastIndex(handle, "/"); idx >= 0 && idx+1 < len(handle) {
@@ -132,10 +126,17 @@ func extractDatasetFromVolumeHandle(volumeHandle string) string {
 	if idx := strings.LastIndex(handle, "@"); idx >= 0 {
 		handle = handle[:idx]
 	}
-	return strings.TrimSpace(handle)
+	handle = strings.TrimSpace(handle)
+	if handle == "" {
+		return "", fmt.Errorf("volume handle %q names no dataset", volumeHandle)
+	}
+	if err := truenas.ValidateIdentifier(handle); err != nil {
+		return "", fmt.Errorf("volume handle %q: %w", volumeHandle, err)
+	}
+	return handle, nil
 }
 
-func volumeMatches(volume truenas.Volume, volumeHandle, datasetName string) bool {
+func volumeMatches(volume volumeRecord, volumeHandle, datasetName string) bool {
 	if datasetName == "" {
 		return false
 	}
@@ -147,17 +148,14 @@ func volumeMatches(volume truenas.Volume, volumeHandle, datasetName string) bool
 		strings.HasSuffix(volume.ID, ":"+datasetName) {
 		return true
 	}
-	path := strings.TrimRight(volume.Path, "/")
-	if path == datasetName || strings.HasSuffix(path, "/"+datasetName) {
+	if volume.Path == datasetName || strings.HasSuffix(volume.Path, "/"+datasetName) {
 		return true
 	}
-	if volume.Properties != nil {
-		for _, value := range volume.Properties {
-			if value == datasetName ||
-				strings.HasSuffix(value, "/"+datasetName) ||
-				strings.HasSuffix(value, ":"+datasetName) {
-				return true
-			}
+	for _, value := range volume.Values {
+		if value == datasetName ||
+			strings.HasSuffix(value, "/"+datasetName) ||
+			strings.HasSuffix(value, ":"+datasetName) {
+			return true
 		}
 	}
 	return false
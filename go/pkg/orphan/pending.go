@@ -0,0 +1,213 @@
+package orphan
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+// maxPendingEvents bounds the events kept per Pending PVC.
+const maxPendingEvents = 5
+
+// Pending PVC classifications, reported in
+// OrphanedResource.Details["pending_reason"].
+const (
+	// PendingWaitingForFirstConsumer is a WaitForFirstConsumer PVC that no
+	// pod uses yet. Binding is deferred by design, so it is not an error.
+	PendingWaitingForFirstConsumer = "waiting_for_first_consumer"
+	// PendingWaitingForScheduling is a WaitForFirstConsumer PVC whose pods
+	// have not been scheduled, so binding has not started.
+	PendingWaitingForScheduling = "waiting_for_scheduling"
+	// PendingProvisioningFailed is a PVC whose latest event is a
+	// provisioning failure.
+	PendingProvisioningFailed = "provisioning_failed"
+	// PendingUnknown is any other Pending PVC.
+	PendingUnknown = "pending"
+)
+
+// Event reasons set by the PV controller and external provisioners.
+const (
+	eventReasonWaitForFirstConsumer = "WaitForFirstConsumer"
+	eventReasonProvisioningFailed   = "ProvisioningFailed"
+)
+
+// pendingPVCInspector explains why unbound PVCs are Pending. It lists events,
+// pods and StorageClasses lazily and caches them, so one instance must not
+// outlive a scan.
+type pendingPVCInspector struct {
+	d       *Detector
+	events  map[string]map[string][]corev1.Event
+	pods    map[string][]corev1.Pod
+	classes map[string]storagev1.VolumeBindingMode
+}
+
+func newPendingPVCInspector(d *Detector) *pendingPVCInspector {
+	return &pendingPVCInspector{
+		d:      d,
+		events: make(map[string]map[string][]corev1.Event),
+		pods:   make(map[string][]corev1.Pod),
+	}
+}
+
+// details returns the latest event and the pending classification of pvc.
+// Lookups that fail are logged and leave their keys out.
+func (p *pendingPVCInspector) details(ctx context.Context, pvc corev1.PersistentVolumeClaim) map[string]string {
+	details := make(map[string]string)
+
+	events := p.claimEvents(ctx, pvc.Namespace, pvc.Name)
+	if len(events) > 0 {
+		details["latest_event_reason"] = events[0].Reason
+		details["latest_event_message"] = events[0].Message
+	}
+
+	waitForFirstConsumer := p.bindingMode(ctx, pvc) == storagev1.VolumeBindingWaitForFirstConsumer
+	for _, event := range events {
+		if event.Reason == eventReasonWaitForFirstConsumer {
+			waitForFirstConsumer = true
+		}
+	}
+
+	var consumers []corev1.Pod
+	if waitForFirstConsumer {
+		consumers = p.consumers(ctx, pvc.Namespace, pvc.Name)
+	}
+
+	switch {
+	case len(events) > 0 && events[0].Reason == eventReasonProvisioningFailed:
+		details["pending_reason"] = PendingProvisioningFailed
+	case waitForFirstConsumer && len(consumers) == 0:
+		details["pending_reason"] = PendingWaitingForFirstConsumer
+		details["scheduling_hint"] = "binding waits for a pod that uses the claim"
+	case waitForFirstConsumer:
+		details["pending_reason"] = PendingWaitingForScheduling
+		details["scheduling_hint"] = schedulingHint(consumers)
+	default:
+		details["pending_reason"] = PendingUnknown
+	}
+	return details
+}
+
+// claimEvents returns the newest events of a PVC, newest first.
+func (p *pendingPVCInspector) claimEvents(ctx context.Context, namespace, name string) []corev1.Event {
+	byClaim, ok := p.events[namespace]
+	if !ok {
+		var events []corev1.Event
+		err := runPhase(ctx, "k8s_pvc_events", p.d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+			var err error
+			events, err = p.d.k8sClient.ListPersistentVolumeClaimEvents(ctx, namespace)
+			return err
+		})
+		if err != nil {
+			p.d.logger.Warn("Failed to list PVC events", zap.String("namespace", namespace), zap.Error(err))
+		}
+		byClaim = groupClaimEvents(events)
+		p.events[namespace] = byClaim
+	}
+	return byClaim[name]
+}
+
+// groupClaimEvents indexes events by PVC name, keeping the newest
+// maxPendingEvents of each.
+func groupClaimEvents(events []corev1.Event) map[string][]corev1.Event {
+	byClaim := make(map[string][]corev1.Event)
+	for _, event := range events {
+		byClaim[event.InvolvedObject.Name] = append(byClaim[event.InvolvedObject.Name], event)
+	}
+	for name, claimEvents := range byClaim {
+		sort.SliceStable(claimEvents, func(i, j int) bool {
+			return eventTime(claimEvents[i]).After(eventTime(claimEvents[j]))
+		})
+		if len(claimEvents) > maxPendingEvents {
+			claimEvents = claimEvents[:maxPendingEvents:maxPendingEvents]
+		}
+		byClaim[name] = claimEvents
+	}
+	return byClaim
+}
+
+// eventTime is when an event last occurred. Events from the events.k8s.io
+// API only set EventTime, older ones only the timestamps.
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// bindingMode returns the volume binding mode of the PVC's StorageClass, or
+// "" when it is unknown.
+func (p *pendingPVCInspector) bindingMode(ctx context.Context, pvc corev1.PersistentVolumeClaim) storagev1.VolumeBindingMode {
+	if p.classes == nil {
+		p.classes = make(map[string]storagev1.VolumeBindingMode)
+		var classes []storagev1.StorageClass
+		err := runPhase(ctx, "k8s_storage_classes", p.d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+			var err error
+			classes, err = p.d.k8sClient.ListStorageClasses(ctx)
+			return err
+		})
+		if err != nil {
+			p.d.logger.Warn("Failed to list storage classes", zap.Error(err))
+		}
+		for _, class := range classes {
+			if class.VolumeBindingMode != nil {
+				p.classes[class.Name] = *class.VolumeBindingMode
+			}
+		}
+	}
+	if pvc.Spec.StorageClassName == nil {
+		return ""
+	}
+	return p.classes[*pvc.Spec.StorageClassName]
+}
+
+// consumers returns the running or pending pods that mount the claim.
+func (p *pendingPVCInspector) consumers(ctx context.Context, namespace, claim string) []corev1.Pod {
+	pods, ok := p.pods[namespace]
+	if !ok {
+		err := runPhase(ctx, "k8s_pods", p.d.config.PhaseTimeouts.K8sList, func(ctx context.Context) error {
+			var err error
+			pods, err = p.d.k8sClient.ListPods(ctx, namespace)
+			return err
+		})
+		if err != nil {
+			p.d.logger.Warn("Failed to list pods", zap.String("namespace", namespace), zap.Error(err))
+		}
+		p.pods[namespace] = pods
+	}
+
+	var consumers []corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claim {
+				consumers = append(consumers, pod)
+				break
+			}
+		}
+	}
+	return consumers
+}
+
+// schedulingHint returns the scheduler's message for the first unscheduled
+// consumer, which usually names the node constraint that failed.
+func schedulingHint(consumers []corev1.Pod) string {
+	for _, pod := range consumers {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Message != "" {
+				return "pod " + pod.Name + ": " + condition.Message
+			}
+		}
+	}
+	return "pods use the claim but binding has not started; check their events"
+}
@@ -0,0 +1,168 @@
+package orphan
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func pendingPVC(name, class string, created time.Time) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", CreationTimestamp: metav1.NewTime(created)},
+		Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &class},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+}
+
+func pvcEvent(claim, reason, message string, at time.Time) corev1.Event {
+	return corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "apps"},
+		InvolvedObject: corev1.ObjectReference{Kind: "PersistentVolumeClaim", Name: claim},
+		Reason:         reason,
+		Message:        message,
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func claimPod(name, claim string, scheduled *corev1.PodCondition) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+			},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	if scheduled != nil {
+		pod.Status.Conditions = []corev1.PodCondition{*scheduled}
+	}
+	return pod
+}
+
+func TestDetectOrphanedPVCs_ClassifiesPendingClaims(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	wffc := storagev1.VolumeBindingWaitForFirstConsumer
+	immediate := storagev1.VolumeBindingImmediate
+
+	client := &k8stest.Client{
+		PersistentVolumeClaims: []corev1.PersistentVolumeClaim{
+			pendingPVC("idle", "local", old),
+			pendingPVC("unscheduled", "local", old),
+			pendingPVC("failed", "nfs", old),
+			pendingPVC("quiet", "nfs", old),
+		},
+		Events: []corev1.Event{
+			pvcEvent("idle", "WaitForFirstConsumer", "waiting for first consumer to be created before binding", old),
+			pvcEvent("failed", "ExternalProvisioning", "waiting for a volume to be created", old),
+			pvcEvent("failed", "ProvisioningFailed", "dataset tank/k8s quota exceeded", old.Add(time.Hour)),
+			pvcEvent("failed", "Provisioning", "External provisioner is provisioning volume", old.Add(time.Minute)),
+		},
+		Pods: []corev1.Pod{
+			claimPod("web-0", "unscheduled", &corev1.PodCondition{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Message: "0/3 nodes are available: 3 node(s) didn't match node selector.",
+			}),
+			claimPod("done", "idle", nil),
+		},
+		StorageClasses: []storagev1.StorageClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: "local"}, VolumeBindingMode: &wffc},
+			{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}, VolumeBindingMode: &immediate},
+		},
+	}
+	client.Pods[1].Status.Phase = corev1.PodSucceeded
+
+	d, err := NewDetector(client, &truenastest.Client{}, Config{AgeThreshold: 24 * time.Hour, Clock: clock.NewFake(now)})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	orphaned, _, err := d.detectOrphanedPVCs(context.Background(), "apps", nil, &DetectionResult{})
+	if err != nil {
+		t.Fatalf("detectOrphanedPVCs: %v", err)
+	}
+	if calls := client.Calls("ListPersistentVolumeClaimEvents"); calls != 1 {
+		t.Fatalf("events listed %d times, want once per namespace", calls)
+	}
+
+	byName := make(map[string]OrphanedResource)
+	for _, o := range orphaned {
+		byName[o.Name] = o
+	}
+
+	idle := byName["idle"]
+	if idle.Details["pending_reason"] != PendingWaitingForFirstConsumer {
+		t.Fatalf("idle details = %v", idle.Details)
+	}
+	if idle.Reason != "Waiting for first consumer for 2d" {
+		t.Fatalf("idle reason = %q", idle.Reason)
+	}
+
+	unscheduled := byName["unscheduled"]
+	if unscheduled.Details["pending_reason"] != PendingWaitingForScheduling {
+		t.Fatalf("unscheduled details = %v", unscheduled.Details)
+	}
+	if want := "pod web-0: 0/3 nodes are available: 3 node(s) didn't match node selector."; unscheduled.Details["scheduling_hint"] != want {
+		t.Fatalf("scheduling_hint = %q, want %q", unscheduled.Details["scheduling_hint"], want)
+	}
+
+	failed := byName["failed"]
+	if failed.Details["pending_reason"] != PendingProvisioningFailed ||
+		failed.Details["latest_event_message"] != "dataset tank/k8s quota exceeded" {
+		t.Fatalf("failed details = %v", failed.Details)
+	}
+	if failed.Reason != "Unbound for 2d" {
+		t.Fatalf("failed reason = %q", failed.Reason)
+	}
+
+	quiet := byName["quiet"]
+	if quiet.Details["pending_reason"] != PendingUnknown || quiet.Details["latest_event_reason"] != "" {
+		t.Fatalf("quiet details = %v", quiet.Details)
+	}
+}
+
+func TestDetectOrphanedPVCs_EventListFailureIsTolerated(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	client := &k8stest.Client{
+		PersistentVolumeClaims: []corev1.PersistentVolumeClaim{pendingPVC("claim", "nfs", now.Add(-48*time.Hour))},
+		ListEventsErr:          errors.New("events is forbidden"),
+	}
+
+	d, err := NewDetector(client, &truenastest.Client{}, Config{AgeThreshold: 24 * time.Hour, Clock: clock.NewFake(now)})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	orphaned, _, err := d.detectOrphanedPVCs(context.Background(), "apps", nil, &DetectionResult{})
+	if err != nil {
+		t.Fatalf("detectOrphanedPVCs: %v", err)
+	}
+	if len(orphaned) != 1 || orphaned[0].Details["pending_reason"] != PendingUnknown {
+		t.Fatalf("orphaned = %+v", orphaned)
+	}
+}
+
+func TestGroupClaimEvents_KeepsNewestEvents(t *testing.T) {
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var events []corev1.Event
+	for i := 0; i < maxPendingEvents+3; i++ {
+		events = append(events, pvcEvent("claim", "Provisioning", "attempt", base.Add(time.Duration(i)*time.Minute)))
+	}
+
+	got := groupClaimEvents(events)["claim"]
+	if len(got) != maxPendingEvents {
+		t.Fatalf("kept %d events, want %d", len(got), maxPendingEvents)
+	}
+	if newest := eventTime(got[0]); !newest.Equal(base.Add(time.Duration(maxPendingEvents+2) * time.Minute)) {
+		t.Fatalf("newest event at %v", newest)
+	}
+}
@@ -0,0 +1,271 @@
+package orphan
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Defaults for zero NamespacePriority fields.
+const (
+	DefaultPriorityTopK           = 20
+	DefaultPriorityCoveragePeriod = time.Hour
+)
+
+// NamespacePriority limits VolumeSnapshot correlation on clusters with many
+// namespaces. Each cluster-wide detection correlates the TopK namespaces
+// with the most PVC and VolumeSnapshot churn plus a rotating share of the
+// rest, sized so every namespace is correlated at least once per
+// CoveragePeriod. A namespace left out keeps the VolumeSnapshot orphans of
+// its last correlation that still exist, and the TrueNAS snapshots its
+// VolumeSnapshots matched then are not reported as orphaned.
+//
+// Churn is the number of PVCs and VolumeSnapshots created or deleted between
+// consecutive detections, halved on every detection so old activity fades.
+type NamespacePriority struct {
+	// Enabled turns prioritization on. Off, every namespace is correlated
+	// on every detection.
+	Enabled bool
+	// TopK is the number of most active namespaces correlated on every
+	// detection (0 = DefaultPriorityTopK).
+	TopK int
+	// CoveragePeriod bounds the time between two correlations of any
+	// namespace (0 = DefaultPriorityCoveragePeriod).
+	CoveragePeriod time.Duration
+}
+
+// namespaceScheduler chooses the namespaces correlated by each detection and
+// remembers the outcome of each namespace's last correlation.
+type namespaceScheduler struct {
+	topK   int
+	period time.Duration
+
+	mu      sync.Mutex
+	lastRun time.Time
+	states  map[string]*namespaceState
+}
+
+type namespaceState struct {
+	activity float64
+	churn    int
+	// pvcs and snapshots are the UIDs seen by the last detection.
+	pvcs, snapshots map[string]bool
+	correlatedAt    time.Time
+	// orphans are the VolumeSnapshot orphans of the last correlation and
+	// matched the full names of the TrueNAS snapshots it matched.
+	orphans []OrphanedResource
+	matched map[string]bool
+}
+
+func newNamespaceScheduler(priority NamespacePriority) *namespaceScheduler {
+	if !priority.Enabled {
+		return nil
+	}
+	if priority.TopK <= 0 {
+		priority.TopK = DefaultPriorityTopK
+	}
+	if priority.CoveragePeriod <= 0 {
+		priority.CoveragePeriod = DefaultPriorityCoveragePeriod
+	}
+	return &namespaceScheduler{
+		topK:   priority.TopK,
+		period: priority.CoveragePeriod,
+		states: make(map[string]*namespaceState),
+	}
+}
+
+func (s *namespaceScheduler) state(namespace string) *namespaceState {
+	state, ok := s.states[namespace]
+	if !ok {
+		state = &namespaceState{}
+		s.states[namespace] = state
+	}
+	return state
+}
+
+// observePVCs records the PVCs listed by a cluster-wide detection.
+func (s *namespaceScheduler) observePVCs(pvcs []corev1.PersistentVolumeClaim) {
+	uids := make(map[string][]string)
+	for i := range pvcs {
+		uids[pvcs[i].Namespace] = append(uids[pvcs[i].Namespace], string(pvcs[i].UID))
+	}
+	s.observe(uids, func(state *namespaceState) *map[string]bool { return &state.pvcs })
+}
+
+// observeSnapshots records the VolumeSnapshots listed by a cluster-wide
+// detection.
+func (s *namespaceScheduler) observeSnapshots(snapshots []k8sSnapshotRecord) {
+	uids := make(map[string][]string)
+	for _, snapshot := range snapshots {
+		uids[snapshot.Namespace] = append(uids[snapshot.Namespace], snapshot.UID)
+	}
+	s.observe(uids, func(state *namespaceState) *map[string]bool { return &state.snapshots })
+}
+
+// observe replaces one kind of UID set per namespace, counting UIDs added or
+// removed since the previous detection as churn. The first detection only
+// records them.
+func (s *namespaceScheduler) observe(uids map[string][]string, set func(*namespaceState) *map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for namespace := range uids {
+		s.state(namespace)
+	}
+	for namespace, state := range s.states {
+		previous := set(state)
+		current := make(map[string]bool, len(uids[namespace]))
+		for _, uid := range uids[namespace] {
+			current[uid] = true
+			if !s.lastRun.IsZero() && !(*previous)[uid] {
+				state.churn++
+			}
+		}
+		if !s.lastRun.IsZero() {
+			for uid := range *previous {
+				if !current[uid] {
+					state.churn++
+				}
+			}
+		}
+		*previous = current
+	}
+}
+
+// plan returns the namespaces among those with VolumeSnapshots to correlate
+// now. The first detection and namespaces never correlated are always
+// included; so is any namespace not correlated for a coverage period.
+func (s *namespaceScheduler) plan(now time.Time, snapshots []k8sSnapshotRecord) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	present := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		present[snapshot.Namespace] = true
+	}
+	for namespace, state := range s.states {
+		state.activity = state.activity/2 + float64(state.churn)
+		state.churn = 0
+		if !present[namespace] && len(state.pvcs) == 0 && len(state.snapshots) == 0 {
+			delete(s.states, namespace)
+		}
+	}
+
+	elapsed := now.Sub(s.lastRun)
+	first := s.lastRun.IsZero()
+	s.lastRun = now
+
+	selected := make(map[string]bool, len(present))
+	var rest []string
+	for namespace := range present {
+		if first || s.state(namespace).correlatedAt.IsZero() {
+			selected[namespace] = true
+		} else {
+			rest = append(rest, namespace)
+		}
+	}
+
+	// The most active namespaces first; among equals, the stalest.
+	sort.Slice(rest, func(i, j int) bool {
+		a, b := s.states[rest[i]], s.states[rest[j]]
+		if a.activity != b.activity {
+			return a.activity > b.activity
+		}
+		if !a.correlatedAt.Equal(b.correlatedAt) {
+			return a.correlatedAt.Before(b.correlatedAt)
+		}
+		return rest[i] < rest[j]
+	})
+	top := s.topK
+	if top > len(rest) {
+		top = len(rest)
+	}
+	for _, namespace := range rest[:top] {
+		selected[namespace] = true
+	}
+	rest = rest[top:]
+
+	// Rotate through the rest, stalest first, at the pace that covers all
+	// of them within one period, and catch up on any that are overdue.
+	sort.Slice(rest, func(i, j int) bool {
+		a, b := s.states[rest[i]].correlatedAt, s.states[rest[j]].correlatedAt
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return rest[i] < rest[j]
+	})
+	share := int(math.Ceil(float64(len(rest)) * elapsed.Seconds() / s.period.Seconds()))
+	for i, namespace := range rest {
+		if i >= share && now.Sub(s.states[namespace].correlatedAt) < s.period {
+			break
+		}
+		selected[namespace] = true
+	}
+	return selected
+}
+
+// carryOver returns the orphans of the last correlation of each namespace
+// not selected whose VolumeSnapshot still exists, aged to now, and the
+// TrueNAS snapshots those namespaces matched.
+func (s *namespaceScheduler) carryOver(now time.Time, selected map[string]bool, snapshots []k8sSnapshotRecord) ([]OrphanedResource, map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		if !selected[snapshot.Namespace] {
+			existing[snapshot.UID] = true
+		}
+	}
+	var orphans []OrphanedResource
+	claimed := make(map[string]bool)
+	for namespace, state := range s.states {
+		if selected[namespace] || state.correlatedAt.IsZero() {
+			continue
+		}
+		for _, orphan := range state.orphans {
+			if existing[orphan.UID] {
+				orphan.Age = now.Sub(orphan.CreatedAt)
+				orphans = append(orphans, orphan)
+			}
+		}
+		for name := range state.matched {
+			claimed[name] = true
+		}
+	}
+	return orphans, claimed
+}
+
+// record stores the outcome of correlating the selected namespaces.
+func (s *namespaceScheduler) record(now time.Time, selected map[string]bool, orphans []OrphanedResource, matched map[string]map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for namespace := range selected {
+		state := s.state(namespace)
+		state.correlatedAt = now
+		state.orphans = nil
+		state.matched = matched[namespace]
+	}
+	for _, orphan := range orphans {
+		if orphan.Type == "VolumeSnapshot" && selected[orphan.Namespace] {
+			state := s.states[orphan.Namespace]
+			state.orphans = append(state.orphans, orphan)
+		}
+	}
+}
+
+// correlatedAt returns when the VolumeSnapshots of each namespace that has
+// any were last correlated.
+func (s *namespaceScheduler) correlatedAt() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	times := make(map[string]time.Time, len(s.states))
+	for namespace, state := range s.states {
+		if len(state.snapshots) > 0 && !state.correlatedAt.IsZero() {
+			times[namespace] = state.correlatedAt
+		}
+	}
+	return times
+}
@@ -0,0 +1,81 @@
+package orphan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestDetectOrphanedSnapshots_PrioritizesNamespaces(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	snapshot := func(namespace, name string) snapshotv1.VolumeSnapshot {
+		return snapshotv1.VolumeSnapshot{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			UID:               types.UID(namespace + "-" + name),
+			CreationTimestamp: metav1.NewTime(start.Add(-48 * time.Hour)),
+			Annotations:       map[string]string{"zfs.dataset": "tank/k8s/vol-" + namespace},
+		}}
+	}
+	zfs := func(namespace, name string) truenas.Snapshot {
+		return truenas.Snapshot{Name: name, Dataset: "tank/k8s/vol-" + namespace, CreatedAt: start.Add(-60 * 24 * time.Hour)}
+	}
+	k8sClient := &k8stest.Client{VolumeSnapshots: []snapshotv1.VolumeSnapshot{
+		snapshot("a", "a1"), snapshot("b", "b1"), snapshot("c", "c1"), snapshot("c", "c2"),
+	}}
+	truenasClient := &truenastest.Client{Snapshots: []truenas.Snapshot{
+		zfs("a", "a1"), zfs("b", "b1"), zfs("c", "c2"),
+	}}
+	d, err := NewDetector(k8sClient, truenasClient, Config{
+		StrictSnapshots:   true,
+		Clock:             fake,
+		NamespacePriority: NamespacePriority{Enabled: true, TopK: 1, CoveragePeriod: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	detect := func() []OrphanedResource {
+		t.Helper()
+		orphaned, _, err := d.detectOrphanedSnapshots(context.Background(), "", nil, &DetectionResult{})
+		if err != nil {
+			t.Fatalf("detectOrphanedSnapshots: %v", err)
+		}
+		return orphaned
+	}
+
+	// The first detection correlates every namespace.
+	if orphaned := detect(); len(orphaned) != 1 || orphaned[0].Name != "c1" {
+		t.Fatalf("first detection orphans = %+v, want only c1", orphaned)
+	}
+
+	// A new snapshot makes a the most active namespace; the rotation
+	// picks b, the first of the equally stale rest, and c is skipped.
+	fake.Advance(time.Minute)
+	k8sClient.VolumeSnapshots = append(k8sClient.VolumeSnapshots, snapshot("a", "a2"))
+	truenasClient.Snapshots = append(truenasClient.Snapshots, zfs("a", "a2"))
+	orphaned := detect()
+	if len(orphaned) != 1 || orphaned[0].Name != "c1" || orphaned[0].Age != 48*time.Hour+time.Minute {
+		t.Fatalf("second detection orphans = %+v, want c1 carried over and aged; c2's TrueNAS snapshot stays matched", orphaned)
+	}
+	correlated := d.namespaces.correlatedAt()
+	if !correlated["a"].Equal(fake.Now()) || !correlated["b"].Equal(fake.Now()) || !correlated["c"].Equal(start) {
+		t.Fatalf("correlated at = %v", correlated)
+	}
+
+	// After a coverage period, the skipped namespace is overdue.
+	fake.Advance(time.Hour)
+	detect()
+	if correlated := d.namespaces.correlatedAt(); !correlated["c"].Equal(fake.Now()) {
+		t.Fatalf("c correlated at %v, want %v", correlated["c"], fake.Now())
+	}
+}
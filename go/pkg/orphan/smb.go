@@ -0,0 +1,60 @@
+package orphan
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// isSMBDriver reports whether a CSI driver name belongs to the democratic-csi
+// SMB driver, including renamed deployments such as "org.example.smb".
+func isSMBDriver(driver string) bool {
+	return strings.Contains(strings.ToLower(driver), "smb")
+}
+
+// hasSMBVolumes reports whether any PV is provisioned by an SMB driver.
+func hasSMBVolumes(pvs []corev1.PersistentVolume) bool {
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && isSMBDriver(pv.Spec.CSI.Driver) {
+			return true
+		}
+	}
+	return false
+}
+
+// smbShareVolumes lists SMB shares as volumes of type truenas.VolumeTypeSMB.
+// Share paths end in the dataset name democratic-csi uses as the volume
+// handle, so volumeMatches correlates them like datasets. Errors are logged
+// and yield no volumes, leaving the SMB PVs to match datasets alone. Shares
+// carry no creation time, so each takes that of its dataset in datasets.
+func smbShareVolumes(ctx context.Context, client truenas.Client, logger *logging.Logger, datasets []truenas.Volume) []truenas.Volume {
+	shares, err := client.GetSMBShares(ctx)
+	if err != nil {
+		logger.Warn("Failed to list SMB shares, correlating SMB PVs by dataset only",
+			logging.RedactedError(err))
+		return nil
+	}
+	created := make(map[string]time.Time, len(datasets))
+	for _, dataset := range datasets {
+		if !dataset.CreatedAt.IsZero() {
+			created[dataset.Name] = dataset.CreatedAt
+		}
+	}
+	volumes := make([]truenas.Volume, 0, len(shares))
+	for _, share := range shares {
+		if share.Path == "" {
+			continue
+		}
+		volume := share.AsVolume()
+		volume.CreatedAt = created[share.Dataset()]
+		volumes = append(volumes, volume)
+	}
+	logger.Debug("Listed SMB shares", zap.Int("count", len(volumes)))
+	return volumes
+}
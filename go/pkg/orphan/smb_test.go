@@ -0,0 +1,93 @@
+package orphan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+// scaleSMBShares loads a /sharing/smb response captured from TrueNAS SCALE.
+func scaleSMBShares(t *testing.T) []truenas.SMBShare {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "truenas", "testdata", "smb_shares_scale.json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	var shares []truenas.SMBShare
+	if err := json.Unmarshal(data, &shares); err != nil {
+		t.Fatalf("decode fixture: %v", err)
+	}
+	return shares
+}
+
+func smbPV(name, handle string) corev1.PersistentVolume {
+	pv := handlePV(name, handle, "apps", corev1.ReadWriteMany)
+	pv.Spec.CSI.Driver = "org.democratic-csi.smb"
+	return pv
+}
+
+func TestSMBSharePathMapsToVolumeHandle(t *testing.T) {
+	shares := scaleSMBShares(t)
+	volume := newVolumeRecord(shares[0].AsVolume())
+
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{"pvc-2f1c8a6e-1b7d-4c1a-9d0e-5a3c2b1f0e9d", true},
+		{"tank/k8s/smb/v/pvc-2f1c8a6e-1b7d-4c1a-9d0e-5a3c2b1f0e9d", true},
+		{"pvc-00000000-0000-0000-0000-000000000000", false},
+		{"media", false},
+	}
+	for _, tt := range tests {
+		got := volumeMatches(volume, tt.handle, extractDatasetFromVolumeHandle(tt.handle))
+		if got != tt.want {
+			t.Errorf("handle %q: volumeMatches = %v, want %v", tt.handle, got, tt.want)
+		}
+	}
+}
+
+func TestDetectOrphanedPVs_CorrelatesSMBShares(t *testing.T) {
+	tn := &truenastest.Client{SMBShares: scaleSMBShares(t)}
+	d, err := NewDetector(&k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		smbPV("pv-smb", "pvc-2f1c8a6e-1b7d-4c1a-9d0e-5a3c2b1f0e9d"),
+		smbPV("pv-smb-gone", "pvc-00000000-0000-0000-0000-000000000000"),
+	}}, tn, Config{})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if len(result.OrphanedPVs) != 1 || result.OrphanedPVs[0].Name != "pv-smb-gone" {
+		t.Fatalf("expected only pv-smb-gone orphaned, got %+v", result.OrphanedPVs)
+	}
+}
+
+func TestDetectOrphanedPVs_SkipsSMBSharesWithoutSMBVolumes(t *testing.T) {
+	tn := &truenastest.Client{GetSMBSharesErr: errors.New("unexpected call")}
+	d, err := NewDetector(&k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		handlePV("pv-nfs", "pvc-1111", "apps", corev1.ReadWriteOnce),
+	}}, tn, Config{})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	if _, err := d.DetectOrphanedPVs(context.Background()); err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if n := tn.Calls("GetSMBShares"); n != 0 {
+		t.Fatalf("SMB shares listed %d times without any SMB PVs", n)
+	}
+}
@@ -0,0 +1,168 @@
+package orphan
+
+import (
+	"sort"
+	"strings"
+)
+
+// StorageClassUsage aggregates the democratic-csi PVs of one StorageClass
+// and the orphans attributed to it.
+type StorageClassUsage struct {
+	StorageClass string `json:"storage_class"`
+	// Volumes counts the democratic-csi PVs of the class.
+	Volumes int `json:"volumes"`
+	// ProvisionedBytes sums their requested capacity and UsedBytes the used
+	// bytes of the TrueNAS volumes correlation matched them to.
+	ProvisionedBytes int64 `json:"provisioned_bytes"`
+	UsedBytes        int64 `json:"used_bytes"`
+	// Orphans counts the orphaned PVs and PVCs of the class and the
+	// orphaned TrueNAS volumes and snapshots under its datasets.
+	Orphans int `json:"orphans"`
+	// WastedBytes sums the used bytes of those TrueNAS volumes and
+	// snapshots; orphaned PVs and PVCs hold no TrueNAS space.
+	WastedBytes int64 `json:"wasted_bytes"`
+}
+
+// storageClassIndex attributes TrueNAS datasets to the StorageClass of the
+// PVs matched to them, or to their parent dataset when every matched PV
+// under that parent has one class.
+type storageClassIndex struct {
+	usage map[string]*StorageClassUsage
+	// datasets maps matched and parent datasets to their class; "" marks
+	// a parent shared by several classes.
+	datasets map[string]string
+	// namespaces maps matched datasets to the claim namespace of their PV.
+	namespaces map[string]string
+}
+
+// newStorageClassIndex sums the PVs of each class and records the class of
+// the datasets correlation matched them to, and the claim namespace of every
+// matched dataset.
+func newStorageClassIndex(pvs []pvRecord, volumes *volumeIndex) *storageClassIndex {
+	index := &storageClassIndex{
+		usage:      make(map[string]*StorageClassUsage),
+		datasets:   make(map[string]string),
+		namespaces: make(map[string]string),
+	}
+	for _, pv := range pvs {
+		var volume volumeRecord
+		matched := false
+		if pv.ParseErr == nil {
+			volume, matched = volumes.find(pv)
+		}
+		if matched && pv.ClaimNamespace != "" {
+			index.namespaces[volume.Name] = pv.ClaimNamespace
+		}
+		if pv.StorageClass == "" {
+			continue
+		}
+		usage := index.class(pv.StorageClass)
+		usage.Volumes++
+		usage.ProvisionedBytes += pv.RequestedBytes
+		if !matched {
+			continue
+		}
+		usage.UsedBytes += volume.Used
+		index.datasets[volume.Name] = pv.StorageClass
+		if idx := strings.LastIndex(volume.Name, "/"); idx > 0 {
+			parent := volume.Name[:idx]
+			if class, seen := index.datasets[parent]; seen && class != pv.StorageClass {
+				index.datasets[parent] = ""
+			} else {
+				index.datasets[parent] = pv.StorageClass
+			}
+		}
+	}
+	return index
+}
+
+func (x *storageClassIndex) class(name string) *StorageClassUsage {
+	usage, ok := x.usage[name]
+	if !ok {
+		usage = &StorageClassUsage{StorageClass: name}
+		x.usage[name] = usage
+	}
+	return usage
+}
+
+// datasetClass returns the class of a dataset, or of its parent, or "".
+func (x *storageClassIndex) datasetClass(dataset string) string {
+	if class, ok := x.datasets[dataset]; ok {
+		return class
+	}
+	if idx := strings.LastIndex(dataset, "/"); idx > 0 {
+		return x.datasets[dataset[:idx]]
+	}
+	return ""
+}
+
+// attributeNamespaces records in Details["claim_namespace"] the claim
+// namespace of the PV whose dataset each orphaned TrueNAS snapshot was
+// taken of. Snapshots of datasets no bound PV matched are left as they are.
+func (x *storageClassIndex) attributeNamespaces(orphans []OrphanedResource) {
+	if x == nil {
+		return
+	}
+	for i := range orphans {
+		if orphans[i].Type != "TrueNASSnapshot" {
+			continue
+		}
+		dataset, _, _ := strings.Cut(orphans[i].Name, "@")
+		namespace, ok := x.namespaces[dataset]
+		if !ok {
+			continue
+		}
+		if orphans[i].Details == nil {
+			orphans[i].Details = map[string]string{}
+		}
+		orphans[i].Details["claim_namespace"] = namespace
+	}
+}
+
+// breakdown adds the orphans of result to the classes and returns the
+// classes with democratic-csi PVs, most wasted bytes first. Orphans of
+// other classes, VolumeSnapshots and VolumeSnapshotContents are not
+// attributed. A nil index, when PV correlation did not complete, returns
+// nil.
+func (x *storageClassIndex) breakdown(result *DetectionResult) []StorageClassUsage {
+	if x == nil {
+		return nil
+	}
+	add := func(class string, wasted int64) {
+		if usage, ok := x.usage[class]; ok && class != "" {
+			usage.Orphans++
+			usage.WastedBytes += wasted
+		}
+	}
+	for _, orphans := range [][]OrphanedResource{result.OrphanedPVs, result.OrphanedPVCs} {
+		for _, orphan := range orphans {
+			add(orphan.StorageClass, 0)
+		}
+	}
+	for _, orphan := range result.OrphanedTrueNASVolumes {
+		add(x.datasetClass(orphan.Name), orphan.SizeBytes)
+	}
+	for _, orphan := range result.OrphanedSnapshots {
+		if orphan.Type != "TrueNASSnapshot" {
+			continue
+		}
+		if dataset, _, ok := strings.Cut(orphan.Name, "@"); ok {
+			add(x.datasetClass(dataset), orphan.SizeBytes)
+		}
+	}
+
+	classes := make([]StorageClassUsage, 0, len(x.usage))
+	for _, usage := range x.usage {
+		classes = append(classes, *usage)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].WastedBytes != classes[j].WastedBytes {
+			return classes[i].WastedBytes > classes[j].WastedBytes
+		}
+		if classes[i].Orphans != classes[j].Orphans {
+			return classes[i].Orphans > classes[j].Orphans
+		}
+		return classes[i].StorageClass < classes[j].StorageClass
+	})
+	return classes
+}
@@ -0,0 +1,69 @@
+package orphan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestDetectOrphanedResources_BreaksDownByStorageClass(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	pv := func(name, class, capacity string) corev1.PersistentVolume {
+		pv := handlePV(name, name, "apps")
+		pv.CreationTimestamp = metav1.NewTime(old)
+		pv.Spec.StorageClassName = class
+		pv.Spec.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)}
+		return pv
+	}
+	k8sClient := &k8stest.Client{PersistentVolumes: []corev1.PersistentVolume{
+		pv("pvc-a", "nfs-fast", "10Gi"),
+		pv("pvc-b", "iscsi", "5Gi"),
+		pv("pvc-gone", "iscsi", "1Gi"),
+		pv("pvc-other", "", "1Gi"),
+	}}
+	tn := &truenastest.Client{
+		Volumes: []truenas.Volume{
+			{ID: "tank/k8s/nfs/pvc-a", Name: "tank/k8s/nfs/pvc-a", Type: truenas.VolumeTypeFilesystem, Used: 2 << 30, CreatedAt: old},
+			{ID: "tank/k8s/nfs/pvc-stray", Name: "tank/k8s/nfs/pvc-stray", Type: truenas.VolumeTypeFilesystem, Used: 4 << 30, CreatedAt: old},
+			{ID: "tank/k8s/iscsi/pvc-b", Name: "tank/k8s/iscsi/pvc-b", Type: truenas.VolumeTypeZvol, Used: 1 << 30, CreatedAt: old},
+		},
+		Snapshots: []truenas.Snapshot{
+			{ID: "tank/k8s/iscsi/pvc-b@old", Name: "tank/k8s/iscsi/pvc-b@old", Dataset: "tank/k8s/iscsi/pvc-b", Used: 1 << 20, CreatedAt: old},
+		},
+	}
+	d, err := NewDetector(k8sClient, tn, Config{AgeThreshold: 24 * time.Hour, Clock: clock.NewFake(now)})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := d.DetectOrphanedResources(context.Background(), "")
+	if err != nil {
+		t.Fatalf("DetectOrphanedResources: %v", err)
+	}
+	want := []StorageClassUsage{
+		{StorageClass: "nfs-fast", Volumes: 1, ProvisionedBytes: 10 << 30, UsedBytes: 2 << 30, Orphans: 1, WastedBytes: 4 << 30},
+		{StorageClass: "iscsi", Volumes: 2, ProvisionedBytes: 6 << 30, UsedBytes: 1 << 30, Orphans: 2, WastedBytes: 1 << 20},
+	}
+	got := result.StorageClasses
+	if len(got) != len(want) {
+		t.Fatalf("storage classes = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("storage class %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if len(result.OrphanedSnapshots) != 1 || result.OrphanedSnapshots[0].Details["claim_namespace"] != "apps" {
+		t.Fatalf("orphaned snapshots = %+v, want the pvc-b snapshot attributed to apps", result.OrphanedSnapshots)
+	}
+}
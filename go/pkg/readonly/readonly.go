@@ -0,0 +1,81 @@
+// Package readonly guards the Kubernetes and TrueNAS clients in read-only
+// mode. The guards refuse every call that would change cluster or storage
+// state with ErrReadOnlyMode before it reaches the wrapped client, so a bug
+// or misconfiguration elsewhere cannot mutate anything.
+package readonly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// ErrReadOnlyMode is returned by the guarded clients for any call that
+// creates, updates, patches or deletes.
+var ErrReadOnlyMode = errors.New("refused in read-only mode")
+
+// K8sClient is a k8s.Client that refuses writes. Reads go to the embedded
+// client.
+type K8sClient struct {
+	k8s.Client
+}
+
+// NewK8sClient guards client.
+func NewK8sClient(client k8s.Client) *K8sClient {
+	return &K8sClient{Client: client}
+}
+
+// CreateEvent returns ErrReadOnlyMode.
+func (c *K8sClient) CreateEvent(_ context.Context, event *corev1.Event) error {
+	name := ""
+	if event != nil {
+		name = event.Namespace + "/" + event.Name
+	}
+	return fmt.Errorf("%w: create event %s", ErrReadOnlyMode, name)
+}
+
+// DeleteVolumeSnapshotContent returns ErrReadOnlyMode.
+func (c *K8sClient) DeleteVolumeSnapshotContent(_ context.Context, name string) error {
+	return fmt.Errorf("%w: delete VolumeSnapshotContent %s", ErrReadOnlyMode, name)
+}
+
+// TrueNASClient is a truenas.Client that refuses writes. Reads go to the
+// embedded client.
+type TrueNASClient struct {
+	truenas.Client
+}
+
+// NewTrueNASClient guards client.
+func NewTrueNASClient(client truenas.Client) *TrueNASClient {
+	return &TrueNASClient{Client: client}
+}
+
+// SetDatasetRefquota returns ErrReadOnlyMode.
+func (c *TrueNASClient) SetDatasetRefquota(_ context.Context, name string, _ int64) error {
+	return fmt.Errorf("%w: set refquota of %s", ErrReadOnlyMode, name)
+}
+
+// DeleteSnapshot returns ErrReadOnlyMode.
+func (c *TrueNASClient) DeleteSnapshot(_ context.Context, name string, _ truenas.DeleteSnapshotOptions) error {
+	return fmt.Errorf("%w: delete snapshot %s", ErrReadOnlyMode, name)
+}
+
+// CreateSnapshot returns ErrReadOnlyMode.
+func (c *TrueNASClient) CreateSnapshot(_ context.Context, dataset, name string) (*truenas.Snapshot, error) {
+	return nil, fmt.Errorf("%w: create snapshot %s@%s", ErrReadOnlyMode, dataset, name)
+}
+
+// CloneSnapshot returns ErrReadOnlyMode.
+func (c *TrueNASClient) CloneSnapshot(_ context.Context, snapshot, dataset string) error {
+	return fmt.Errorf("%w: clone snapshot %s to %s", ErrReadOnlyMode, snapshot, dataset)
+}
+
+// DeleteDataset returns ErrReadOnlyMode.
+func (c *TrueNASClient) DeleteDataset(_ context.Context, name string) error {
+	return fmt.Errorf("%w: delete dataset %s", ErrReadOnlyMode, name)
+}
@@ -0,0 +1,115 @@
+package readonly
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+// readPrefixes are the method name prefixes of calls that do not change
+// state. Every other interface method must be refused by the guard, so a
+// write added to an interface fails this test until the guard covers it.
+var readPrefixes = []string{"List", "Get", "Test", "Check", "Validate"}
+
+func isRead(method string) bool {
+	for _, prefix := range readPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// callMutating calls every method of iface on guard that isRead rejects,
+// with zero arguments besides a context, and fails unless each returns
+// ErrReadOnlyMode. It returns the names of the methods called.
+func callMutating(t *testing.T, iface reflect.Type, guard interface{}) []string {
+	t.Helper()
+	value := reflect.ValueOf(guard)
+	var called []string
+	for i := 0; i < iface.NumMethod(); i++ {
+		method := iface.Method(i)
+		if isRead(method.Name) {
+			continue
+		}
+		args := make([]reflect.Value, method.Type.NumIn())
+		for j := range args {
+			in := method.Type.In(j)
+			switch {
+			case in == reflect.TypeOf((*context.Context)(nil)).Elem():
+				args[j] = reflect.ValueOf(context.Background())
+			case in == reflect.TypeOf(&corev1.Event{}):
+				args[j] = reflect.ValueOf(&corev1.Event{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pv-a.orphan"}})
+			default:
+				args[j] = reflect.Zero(in)
+			}
+		}
+		out := value.MethodByName(method.Name).Call(args)
+		err, _ := out[len(out)-1].Interface().(error)
+		if !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("%s returned %v, want ErrReadOnlyMode", method.Name, err)
+		}
+		called = append(called, method.Name)
+	}
+	return called
+}
+
+func TestK8sClient_RefusesEveryWrite(t *testing.T) {
+	fake := &k8stest.Client{}
+	guard := NewK8sClient(fake)
+
+	called := callMutating(t, reflect.TypeOf((*k8s.Client)(nil)).Elem(), guard)
+	if len(called) == 0 {
+		t.Fatal("no mutating k8s.Client methods found")
+	}
+	if events := fake.CreatedEvents(); len(events) != 0 {
+		t.Fatalf("writes reached the client: %+v", events)
+	}
+	for _, name := range called {
+		if fake.Calls(name) != 0 {
+			t.Fatalf("%s reached the client", name)
+		}
+	}
+
+	// Reads still go through.
+	if _, err := guard.ListPersistentVolumes(context.Background()); err != nil {
+		t.Fatalf("ListPersistentVolumes: %v", err)
+	}
+	if fake.Calls("ListPersistentVolumes") != 1 {
+		t.Fatal("read did not reach the client")
+	}
+}
+
+func TestTrueNASClient_RefusesEveryWrite(t *testing.T) {
+	fake := &truenastest.Client{Snapshots: []truenas.Snapshot{{ID: "tank/k8s/pvc-a@daily", Name: "tank/k8s/pvc-a@daily"}}}
+	guard := NewTrueNASClient(fake)
+
+	called := callMutating(t, reflect.TypeOf((*truenas.Client)(nil)).Elem(), guard)
+	if len(called) == 0 {
+		t.Fatal("no mutating truenas.Client methods found")
+	}
+	if mutations := fake.Mutations(); len(mutations) != 0 {
+		t.Fatalf("writes reached the client: %+v", mutations)
+	}
+	if err := guard.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@daily", truenas.DeleteSnapshotOptions{}); !errors.Is(err, ErrReadOnlyMode) {
+		t.Fatalf("DeleteSnapshot = %v", err)
+	}
+	if len(fake.Snapshots) != 1 {
+		t.Fatal("snapshot was deleted")
+	}
+
+	snapshots, err := guard.ListSnapshots(context.Background())
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("ListSnapshots = %v, %v", snapshots, err)
+	}
+}
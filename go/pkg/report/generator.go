@@ -0,0 +1,182 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/schemas"
+)
+
+// Report kinds.
+const (
+	// KindDetailed is the storage analysis and orphan detection.
+	KindDetailed = "detailed"
+	// KindOrphans is orphan detection only.
+	KindOrphans = "orphans"
+)
+
+// Report formats.
+const (
+	FormatJSON = "json"
+	FormatHTML = "html"
+)
+
+// ValidKind reports whether kind is a known report kind.
+func ValidKind(kind string) bool {
+	return kind == KindDetailed || kind == KindOrphans
+}
+
+// ValidFormat reports whether format is a known report format.
+func ValidFormat(format string) bool {
+	return format == FormatJSON || format == FormatHTML
+}
+
+// Document is the JSON form of a report, versioned as
+// schemas.ReportDocument.
+type Document struct {
+	SchemaVersion int                       `json:"schema_version"`
+	Timestamp     time.Time                 `json:"timestamp"`
+	Analysis      *analysis.StorageAnalysis `json:"analysis,omitempty"`
+	Orphans       *orphan.DetectionResult   `json:"orphans"`
+	Config        *scanconfig.Effective     `json:"config,omitempty"`
+	// FlappingVolumes are the flapping PVs of the monitor's latest scan,
+	// in detailed reports.
+	FlappingVolumes []analysis.FlappingVolume `json:"flapping_volumes,omitempty"`
+}
+
+// Output is a generated report.
+type Output struct {
+	Kind        string
+	Format      string
+	GeneratedAt time.Time
+	Body        []byte
+	ContentType string
+	// Summary is a one-line plain text digest, for message bodies.
+	Summary string
+}
+
+// FileName names the report file, e.g. "detailed-20240506T070800Z.html".
+func (o *Output) FileName() string {
+	return fmt.Sprintf("%s-%s.%s", o.Kind, o.GeneratedAt.UTC().Format("20060102T150405Z"), o.Format)
+}
+
+// Generator builds reports for the API server and the report scheduler, so
+// both produce the same content.
+type Generator struct {
+	Analyzer   *analysis.Analyzer
+	Detector   *orphan.Detector
+	Renderer   *Renderer
+	Thresholds Thresholds
+	// GroupWindow is the creation window of orphan groups (0 =
+	// orphan.DefaultGroupWindow).
+	GroupWindow time.Duration
+	// Config is embedded in every report; nil embeds none.
+	Config *scanconfig.Effective
+	// FlappingVolumes returns the flapping PVs of the monitor's latest
+	// scan for detailed reports; nil reports none.
+	FlappingVolumes func() []analysis.FlappingVolume
+}
+
+// Generate runs the checks a report kind needs and encodes the result into
+// Output.Body. Orphan reports in HTML render only the "orphans" section.
+func (g *Generator) Generate(ctx context.Context, kind, format string) (*Output, error) {
+	out, write, err := g.Stream(ctx, kind, format)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := write(&body); err != nil {
+		return nil, err
+	}
+	out.Body = body.Bytes()
+	return out, nil
+}
+
+// Stream runs the checks a report kind needs and returns the report without
+// a Body, and a function that encodes it to w as it goes. Large orphan lists
+// are then written out without also holding the encoded report in memory;
+// HTML reports are still rendered one section at a time.
+func (g *Generator) Stream(ctx context.Context, kind, format string) (*Output, func(w io.Writer) error, error) {
+	if !ValidKind(kind) {
+		return nil, nil, fmt.Errorf("unknown report kind %q", kind)
+	}
+	if !ValidFormat(format) {
+		return nil, nil, fmt.Errorf("unknown report format %q", format)
+	}
+
+	data := Data{GeneratedAt: time.Now().UTC(), Thresholds: g.Thresholds, Config: g.Config}
+	if kind == KindDetailed {
+		result, err := g.Analyzer.Analyze(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("storage analysis failed: %w", err)
+		}
+		data.Analysis = result
+		if g.FlappingVolumes != nil {
+			data.FlappingVolumes = g.FlappingVolumes()
+		}
+	}
+	orphans, err := g.Detector.DetectOrphanedResources(ctx, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("orphan detection failed: %w", err)
+	}
+	data.Orphans = orphans
+	data.OrphanGroups = orphans.Groups(g.GroupWindow)
+
+	out := &Output{Kind: kind, Format: format, GeneratedAt: data.GeneratedAt, Summary: summary(data)}
+	if format == FormatJSON {
+		out.ContentType = "application/json; charset=utf-8"
+		return out, func(w io.Writer) error {
+			err := json.NewEncoder(w).Encode(Document{
+				SchemaVersion:   schemas.Current(schemas.ReportDocument),
+				Timestamp:       data.GeneratedAt,
+				Analysis:        data.Analysis,
+				Orphans:         data.Orphans,
+				Config:          data.Config,
+				FlappingVolumes: data.FlappingVolumes,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %w", err)
+			}
+			return nil
+		}, nil
+	}
+
+	out.ContentType = "text/html; charset=utf-8"
+	return out, func(w io.Writer) error {
+		var err error
+		if kind == KindOrphans {
+			data.Analysis = &analysis.StorageAnalysis{}
+			err = g.Renderer.RenderSections(w, data, []string{"orphans"})
+		} else {
+			err = g.Renderer.Render(w, data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to render report: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// summary counts the orphans and, when analyzed, lists pool utilization.
+func summary(data Data) string {
+	orphans := data.Orphans
+	text := fmt.Sprintf("%d orphaned PVs, %d orphaned PVCs, %d orphaned snapshots",
+		len(orphans.OrphanedPVs), len(orphans.OrphanedPVCs), len(orphans.OrphanedSnapshots))
+	if data.Analysis != nil && len(data.Analysis.Pools) > 0 {
+		pools := make([]string, 0, len(data.Analysis.Pools))
+		for _, pool := range data.Analysis.Pools {
+			pools = append(pools, pool.Name+" "+humanize.Percent(pool.UtilizationPercent))
+		}
+		text += "; pools: " + strings.Join(pools, ", ")
+	}
+	return text
+}
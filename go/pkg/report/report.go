@@ -0,0 +1,173 @@
+// Package report renders storage reports as HTML. The default template is
+// embedded; a template directory can override it or any of its sections.
+package report
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/humanize"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+)
+
+//go:embed templates/*.html.tmpl
+var defaultTemplates embed.FS
+
+// TemplatePattern matches the template files read from a template directory.
+const TemplatePattern = "*.html.tmpl"
+
+// rootTemplate is the template a report is rendered from. It lays out the
+// page and renders each section with the section function.
+const rootTemplate = "report"
+
+// DefaultPoolUtilizationPercent is the pool utilization highlighted in the
+// threshold table when no threshold is configured.
+const DefaultPoolUtilizationPercent = 80
+
+// DefaultSections are the sections of the default template, in order.
+var DefaultSections = []string{"summary", "pools", "thresholds", "orphans", "flapping", "recommendations"}
+
+// Branding customizes the report header.
+type Branding struct {
+	Title        string
+	Organization string
+	// LogoURL is an image URL or data: URI shown next to the title.
+	LogoURL string
+}
+
+// Thresholds are the limits a report compares its figures against.
+// PoolUtilizationPercent is set by the renderer.
+type Thresholds struct {
+	OrphanAge              time.Duration
+	SnapshotRetention      time.Duration
+	PoolUtilizationPercent float64
+}
+
+// Data is the template context of a report.
+type Data struct {
+	GeneratedAt time.Time
+	Branding    Branding
+	// Sections are the template names rendered, in order.
+	Sections   []string
+	Thresholds Thresholds
+	Analysis   *analysis.StorageAnalysis
+	Orphans    *orphan.DetectionResult
+	// OrphanGroups clusters Orphans by probable root cause.
+	OrphanGroups []orphan.Group
+	// FlappingVolumes are the PVs whose phase changed too often across the
+	// monitor's scans.
+	FlappingVolumes []analysis.FlappingVolume
+	// Config is the configuration the report was generated under; nil
+	// when unknown.
+	Config *scanconfig.Effective
+}
+
+// Options configure a Renderer.
+type Options struct {
+	// TemplateDir holds *.html.tmpl files parsed after the default template,
+	// so their {{define}} blocks replace the default ones with the same name
+	// and may add new sections. Empty uses the default template only.
+	TemplateDir string
+	// Sections are rendered in this order; nil uses DefaultSections.
+	Sections []string
+	Branding Branding
+	// PoolUtilizationPercent is highlighted in the threshold table; zero
+	// uses DefaultPoolUtilizationPercent.
+	PoolUtilizationPercent float64
+}
+
+// Renderer renders reports from parsed templates. It is safe for
+// concurrent use.
+type Renderer struct {
+	templates   *template.Template
+	sections    []string
+	branding    Branding
+	poolPercent float64
+}
+
+// New parses the default template and the templates of opts.TemplateDir.
+// It also renders a report without data, so templates that fail to parse,
+// name unknown sections or reference missing fields are rejected here
+// rather than when a report is requested.
+func New(opts Options) (*Renderer, error) {
+	r := &Renderer{sections: opts.Sections, branding: opts.Branding, poolPercent: opts.PoolUtilizationPercent}
+	if r.sections == nil {
+		r.sections = DefaultSections
+	}
+	if r.poolPercent == 0 {
+		r.poolPercent = DefaultPoolUtilizationPercent
+	}
+	if r.branding.Title == "" {
+		r.branding.Title = "Storage report"
+	}
+
+	templates, err := template.New(rootTemplate).Funcs(r.funcs()).ParseFS(defaultTemplates, "templates/"+TemplatePattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse default report template: %w", err)
+	}
+	if opts.TemplateDir != "" {
+		templates, err = templates.ParseGlob(filepath.Join(opts.TemplateDir, TemplatePattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse report templates in %s: %w", opts.TemplateDir, err)
+		}
+	}
+	r.templates = templates
+
+	for _, section := range r.sections {
+		if templates.Lookup(section) == nil {
+			return nil, fmt.Errorf("report section %q is not defined by any template", section)
+		}
+	}
+	if err := r.Render(io.Discard, Data{
+		Analysis: &analysis.StorageAnalysis{},
+		Orphans:  &orphan.DetectionResult{},
+	}); err != nil {
+		return nil, fmt.Errorf("report template check failed: %w", err)
+	}
+	return r, nil
+}
+
+// Render writes the report for data. The renderer's sections, branding and
+// pool threshold replace those of data.
+func (r *Renderer) Render(w io.Writer, data Data) error {
+	return r.RenderSections(w, data, r.sections)
+}
+
+// RenderSections is Render with the given sections instead of the
+// configured ones.
+func (r *Renderer) RenderSections(w io.Writer, data Data, sections []string) error {
+	data.Sections = sections
+	data.Branding = r.branding
+	data.Thresholds.PoolUtilizationPercent = r.poolPercent
+	return r.templates.ExecuteTemplate(w, rootTemplate, data)
+}
+
+// Sections returns the sections rendered, in order.
+func (r *Renderer) Sections() []string {
+	return append([]string(nil), r.sections...)
+}
+
+func (r *Renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"bytes":    humanize.Bytes,
+		"duration": humanize.Duration,
+		"percent":  humanize.Percent,
+		"join":     strings.Join,
+		// section renders the named section template with the report data.
+		"section": func(name string, data Data) (template.HTML, error) {
+			var buf bytes.Buffer
+			if err := r.templates.ExecuteTemplate(&buf, name, data); err != nil {
+				return "", err
+			}
+			return template.HTML(buf.String()), nil
+		},
+	}
+}
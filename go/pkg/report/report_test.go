@@ -0,0 +1,188 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/scanconfig"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func reportData() Data {
+	data := Data{
+		GeneratedAt: time.Date(2024, 5, 6, 7, 8, 0, 0, time.UTC),
+		Thresholds:  Thresholds{OrphanAge: 24 * time.Hour, SnapshotRetention: 30 * 24 * time.Hour},
+		Analysis: &analysis.StorageAnalysis{
+			Pools: []analysis.PoolUsage{
+				{Name: "tank", Health: "ONLINE", Size: 100 << 30, Used: 90 << 30, Available: 10 << 30, UtilizationPercent: 90},
+			},
+			Recommendations: []string{"Delete <old> snapshots"},
+		},
+		Orphans: &orphan.DetectionResult{
+			TotalPVs:    3,
+			OrphanedPVs: []orphan.OrphanedResource{{Type: "PersistentVolume", Name: "pv-old", Age: 48 * time.Hour, Reason: "released"}},
+		},
+	}
+	data.OrphanGroups = data.Orphans.Groups(0)
+	return data
+}
+
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestRenderer_DefaultTemplate(t *testing.T) {
+	r, err := New(Options{Branding: Branding{Title: "Weekly storage", Organization: "ACME SRE", LogoURL: "https://example.com/logo.png"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var out strings.Builder
+	if err := r.Render(&out, reportData()); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	html := out.String()
+	for _, want := range []string{
+		"<title>Weekly storage</title>",
+		`<img src="https://example.com/logo.png" alt="ACME SRE">`,
+		"Generated 2024-05-06 07:08 UTC",
+		"<td>tank</td>",
+		`<td class="over">90.0%</td>`,
+		"<td>pv-old</td>",
+		"<h3>Probable root causes</h3>",
+		"<td>1 PersistentVolume: released</td>",
+		"Delete &lt;old&gt; snapshots",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+	var last int
+	for _, section := range DefaultSections {
+		i := strings.Index(html, `<section id="`+section+`">`)
+		if i < last {
+			t.Fatalf("section %s missing or out of order", section)
+		}
+		last = i
+	}
+}
+
+func TestRenderer_TemplateDirOverridesAndOrdersSections(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "custom.html.tmpl",
+		`{{define "pools"}}<p>custom pools: {{len .Analysis.Pools}}</p>{{end}}`+
+			`{{define "owners"}}<p>owners of {{.Orphans.TotalPVs}} volumes</p>{{end}}`)
+
+	r, err := New(Options{TemplateDir: dir, Sections: []string{"owners", "pools"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var out strings.Builder
+	if err := r.Render(&out, reportData()); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	html := out.String()
+	owners := strings.Index(html, "<p>owners of 3 volumes</p>")
+	pools := strings.Index(html, "<p>custom pools: 1</p>")
+	if owners < 0 || pools < owners {
+		t.Fatalf("sections missing or out of order:\n%s", html)
+	}
+	if strings.Contains(html, `<section id="orphans">`) {
+		t.Fatal("excluded orphans section was rendered")
+	}
+}
+
+func TestNew_RejectsBrokenTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		sections []string
+		want     string
+	}{
+		{name: "parse error", template: `{{define "pools"}}{{if}}{{end}}`, want: "failed to parse report templates"},
+		{name: "missing field", template: `{{define "pools"}}{{.Analysis.NoSuchField}}{{end}}`, want: "report template check failed"},
+		{name: "unknown section", sections: []string{"summary", "capacity"}, want: `report section "capacity" is not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.template != "" {
+				writeTemplate(t, dir, "broken.html.tmpl", tt.template)
+			}
+			opts := Options{Sections: tt.sections}
+			if tt.template != "" {
+				opts.TemplateDir = dir
+			}
+			_, err := New(opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("New error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerator_OrphansReportRendersOnlyOrphans(t *testing.T) {
+	k8sClient := &k8stest.Client{}
+	truenasClient := &truenastest.Client{Pools: []truenas.Pool{{Name: "tank", Size: 100, Used: 50}}}
+	detector, err := orphan.NewDetector(k8sClient, truenasClient, orphan.Config{AgeThreshold: time.Hour})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	renderer, err := New(Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	generator := &Generator{
+		Analyzer: analysis.NewAnalyzer(k8sClient, truenasClient, analysis.Options{}),
+		Detector: detector,
+		Renderer: renderer,
+		Config:   &scanconfig.Effective{ScanInterval: "5m0s", Hash: "0123456789abcdef"},
+	}
+
+	out, err := generator.Generate(context.Background(), KindOrphans, FormatHTML)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	html := string(out.Body)
+	if !strings.Contains(html, `<section id="orphans">`) || strings.Contains(html, `<section id="pools">`) {
+		t.Fatalf("orphans report sections:\n%s", html)
+	}
+	if out.Summary != "0 orphaned PVs, 0 orphaned PVCs, 0 orphaned snapshots" {
+		t.Fatalf("summary = %q", out.Summary)
+	}
+
+	out, err = generator.Generate(context.Background(), KindDetailed, FormatJSON)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	var doc Document
+	if err := json.Unmarshal(out.Body, &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.Analysis == nil || len(doc.Analysis.Pools) != 1 || doc.Orphans == nil || doc.Config == nil || doc.Config.Hash != "0123456789abcdef" {
+		t.Fatalf("document = %+v", doc)
+	}
+
+	out, err = generator.Generate(context.Background(), KindDetailed, FormatHTML)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if html := string(out.Body); !strings.Contains(html, "<code>0123456789abcdef</code>; scan interval 5m0s") {
+		t.Fatalf("detailed report does not show its configuration:\n%s", html)
+	}
+	if !strings.HasSuffix(out.Summary, "pools: tank 50.0%") {
+		t.Fatalf("summary = %q", out.Summary)
+	}
+}
@@ -0,0 +1,69 @@
+// Package scanconfig records the settings that shape scan results, so an
+// archived report or scan shows what produced it and two of them can be
+// checked for configuration drift.
+package scanconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+)
+
+// Effective is the configuration a scan or report ran under. It holds no
+// secrets: the TrueNAS URL is stripped of credentials and query.
+type Effective struct {
+	ScanInterval      string `json:"scan_interval,omitempty"`
+	OrphanThreshold   string `json:"orphan_threshold"`
+	SnapshotRetention string `json:"snapshot_retention"`
+	// OrphanThresholds are the per-type overrides that are set, keyed by
+	// resource type.
+	OrphanThresholds  map[string]string `json:"orphan_thresholds,omitempty"`
+	OrphanGroupWindow string            `json:"orphan_group_window,omitempty"`
+	StrictSnapshots   bool              `json:"strict_snapshots"`
+	// Namespace limits namespaced lists; empty is all namespaces.
+	Namespace         string `json:"namespace,omitempty"`
+	NamespacePriority bool   `json:"namespace_priority"`
+	CSIPodSelector    string `json:"csi_pod_selector,omitempty"`
+	// DriverPatterns are the CSI driver names treated as democratic-csi.
+	DriverPatterns      []string          `json:"driver_patterns"`
+	ExcludedNames       []string          `json:"excluded_names,omitempty"`
+	ExcludedPatterns    []string          `json:"excluded_patterns,omitempty"`
+	ExcludedLabels      map[string]string `json:"excluded_labels,omitempty"`
+	ExcludedAnnotations map[string]string `json:"excluded_annotations,omitempty"`
+	TrueNASURL          string            `json:"truenas_url,omitempty"`
+	Pool                string            `json:"pool,omitempty"`
+	ParentDataset       string            `json:"parent_dataset,omitempty"`
+	// Hash identifies the settings above; equal hashes mean equal settings.
+	Hash string `json:"hash"`
+}
+
+// WithHash returns e with Hash set to the first 16 hex digits of the
+// SHA-256 of its JSON encoding without the hash.
+func (e Effective) WithHash() Effective {
+	e.Hash = ""
+	// Maps are encoded with sorted keys, so the encoding is stable.
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e
+	}
+	sum := sha256.Sum256(data)
+	e.Hash = hex.EncodeToString(sum[:8])
+	return e
+}
+
+// RedactURL drops the credentials, query and fragment of raw. A URL that
+// does not parse is dropped entirely.
+func RedactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
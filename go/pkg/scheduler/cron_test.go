@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron_Next(t *testing.T) {
+	// Monday 2024-05-06 07:08
+	from := time.Date(2024, 5, 6, 7, 8, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 6, 7, 9, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 6, 7, 15, 0, 0, time.UTC)},
+		{"0 8 * * 1", time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)},
+		{"0 6 * * 1", time.Date(2024, 5, 13, 6, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2024, 6, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted.
+		{"0 0 15 * 3", time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cron.Next(from))
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "x * * * *", "@yearly"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
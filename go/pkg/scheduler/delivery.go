@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/webhook"
+)
+
+// DefaultDeliveryTimeout bounds a single HTTP delivery when the client has
+// none.
+const DefaultDeliveryTimeout = 30 * time.Second
+
+// Target types.
+const (
+	TargetSlack = "slack"
+	TargetEmail = "email"
+	TargetS3    = "s3"
+)
+
+// ValidTargetType reports whether t is a known target type.
+func ValidTargetType(t string) bool {
+	return t == TargetSlack || t == TargetEmail || t == TargetS3
+}
+
+// Target is where a scheduled report is delivered.
+type Target struct {
+	Type string
+	// Channel and URL override the Slack webhook's channel and URL.
+	Channel string
+	URL     string
+	// To lists email recipients.
+	To []string
+	// Bucket and Prefix locate S3 archives; objects are named
+	// <prefix><schedule>/<kind>-<timestamp>.<format>.
+	Bucket string
+	Prefix string
+}
+
+// String identifies the target in logs and the schedule state without
+// exposing webhook URLs.
+func (t Target) String() string {
+	switch t.Type {
+	case TargetSlack:
+		if t.Channel != "" {
+			return "slack:" + t.Channel
+		}
+		return "slack"
+	case TargetEmail:
+		return fmt.Sprintf("email:%d recipients", len(t.To))
+	case TargetS3:
+		return "s3:" + t.Bucket
+	default:
+		return t.Type
+	}
+}
+
+// Delivery is one generated report on its way to a target.
+type Delivery struct {
+	Schedule string
+	Report   *report.Output
+	// Links are the URLs of copies archived by earlier targets of the run.
+	Links []string
+}
+
+// Deliverer sends reports to one type of target. It returns the URL of the
+// delivered copy when the target archives it, and "" otherwise.
+type Deliverer interface {
+	Deliver(ctx context.Context, target Target, delivery Delivery) (string, error)
+}
+
+// SlackDeliverer posts a message with the report summary and links to the
+// archived copies to a Slack incoming webhook. Incoming webhooks cannot
+// upload files, so a schedule that should link its report needs an S3
+// target.
+type SlackDeliverer struct {
+	// Webhook is used when the target has no URL of its own.
+	Webhook string
+	Client  *http.Client
+}
+
+// Deliver posts the report message.
+func (d *SlackDeliverer) Deliver(ctx context.Context, target Target, delivery Delivery) (string, error) {
+	webhookURL := target.URL
+	if webhookURL == "" {
+		webhookURL = d.Webhook
+	}
+	if webhookURL == "" {
+		return "", fmt.Errorf("slack webhook is not configured")
+	}
+	text := fmt.Sprintf("Storage report %s (%s) generated %s: %s",
+		delivery.Schedule, delivery.Report.Kind, delivery.Report.GeneratedAt.Format(time.RFC3339), delivery.Report.Summary)
+	for _, link := range delivery.Links {
+		text += "\n" + link
+	}
+	payload := map[string]string{"text": text}
+	if target.Channel != "" {
+		payload["channel"] = target.Channel
+	}
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultDeliveryTimeout}
+	}
+	return "", webhook.PostJSON(ctx, client, webhookURL, payload)
+}
+
+// SMTPConfig is the mail server reports are sent through.
+type SMTPConfig struct {
+	Host string
+	// Port defaults to 587.
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// EmailDeliverer mails the report as an attachment.
+type EmailDeliverer struct {
+	SMTP SMTPConfig
+	// send defaults to smtp.SendMail; tests replace it.
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Deliver sends the report to the target's recipients.
+func (d *EmailDeliverer) Deliver(ctx context.Context, target Target, delivery Delivery) (string, error) {
+	if d.SMTP.Host == "" {
+		return "", fmt.Errorf("smtp host is not configured")
+	}
+	if len(target.To) == 0 {
+		return "", fmt.Errorf("email target has no recipients")
+	}
+	msg, err := emailMessage(d.SMTP.From, target.To, delivery)
+	if err != nil {
+		return "", err
+	}
+
+	port := d.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if d.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", d.SMTP.Username, d.SMTP.Password, d.SMTP.Host)
+	}
+	send := d.send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return "", send(d.SMTP.Host+":"+strconv.Itoa(port), auth, d.SMTP.From, target.To, msg)
+}
+
+// emailMessage builds a multipart message with the summary as text and the
+// report as a base64 attachment.
+func emailMessage(from string, to []string, delivery Delivery) ([]byte, error) {
+	out := delivery.Report
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: Storage report %s (%s) %s\r\n", delivery.Schedule, out.Kind, out.GeneratedAt.Format("2006-01-02"))
+	fmt.Fprintf(&buf, "Date: %s\r\n", out.GeneratedAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	body := out.Summary + "\r\n"
+	for _, link := range delivery.Links {
+		body += link + "\r\n"
+	}
+	if _, err := text.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+
+	attachment, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {out.ContentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", out.FileName())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(out.Body)
+	for len(encoded) > 76 {
+		if _, err := attachment.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return nil, err
+		}
+		encoded = encoded[76:]
+	}
+	if _, err := attachment.Write([]byte(encoded + "\r\n")); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+)
+
+func testDelivery() Delivery {
+	return Delivery{
+		Schedule: "weekly",
+		Report: &report.Output{
+			Kind:        report.KindDetailed,
+			Format:      report.FormatHTML,
+			GeneratedAt: time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC),
+			Body:        []byte("<html>report</html>"),
+			ContentType: "text/html; charset=utf-8",
+			Summary:     "2 orphaned PVs",
+		},
+		Links: []string{"https://s3.example.com/reports/weekly/detailed-20240506T080000Z.html"},
+	}
+}
+
+func TestSlackDeliverer_PostsSummaryAndLinks(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	deliverer := &SlackDeliverer{Webhook: server.URL}
+	link, err := deliverer.Deliver(context.Background(), Target{Type: TargetSlack, Channel: "#storage"}, testDelivery())
+	require.NoError(t, err)
+	assert.Empty(t, link)
+	assert.Equal(t, "#storage", payload["channel"])
+	assert.Contains(t, payload["text"], "Storage report weekly (detailed)")
+	assert.Contains(t, payload["text"], "2 orphaned PVs")
+	assert.Contains(t, payload["text"], "https://s3.example.com/reports/weekly/detailed-20240506T080000Z.html")
+}
+
+func TestEmailDeliverer_AttachesReport(t *testing.T) {
+	var addr string
+	var to []string
+	var msg []byte
+	deliverer := &EmailDeliverer{
+		SMTP: SMTPConfig{Host: "smtp.example.com", From: "reports@example.com"},
+		send: func(a string, _ smtp.Auth, _ string, recipients []string, m []byte) error {
+			addr, to, msg = a, recipients, m
+			return nil
+		},
+	}
+	_, err := deliverer.Deliver(context.Background(), Target{Type: TargetEmail, To: []string{"sre@example.com"}}, testDelivery())
+	require.NoError(t, err)
+
+	assert.Equal(t, "smtp.example.com:587", addr)
+	assert.Equal(t, []string{"sre@example.com"}, to)
+	text := string(msg)
+	assert.Contains(t, text, "Subject: Storage report weekly (detailed) 2024-05-06\r\n")
+	assert.Contains(t, text, `Content-Disposition: attachment; filename="detailed-20240506T080000Z.html"`)
+	assert.Contains(t, text, base64.StdEncoding.EncodeToString([]byte("<html>report</html>")))
+
+	_, err = deliverer.Deliver(context.Background(), Target{Type: TargetEmail}, testDelivery())
+	assert.ErrorContains(t, err, "no recipients")
+}
+
+func TestS3Deliverer_SignsPut(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	deliverer := &S3Deliverer{
+		S3:  S3Config{Endpoint: server.URL, Region: "eu-west-1", AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"},
+		now: func() time.Time { return time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC) },
+	}
+	link, err := deliverer.Deliver(context.Background(), Target{Type: TargetS3, Bucket: "reports", Prefix: "storage/"}, testDelivery())
+	require.NoError(t, err)
+
+	assert.Equal(t, server.URL+"/reports/storage/weekly/detailed-20240506T080000Z.html", link)
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, "/reports/storage/weekly/detailed-20240506T080000Z.html", req.URL.Path)
+	assert.Equal(t, "<html>report</html>", string(body))
+	assert.Equal(t, "20240506T080000Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, sha256Hex(body), req.Header.Get("X-Amz-Content-Sha256"))
+	auth := req.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240506/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="), auth)
+}
+
+func TestS3EscapePath(t *testing.T) {
+	assert.Equal(t, "/bucket/a%20b/c%2Bd%3A1~x.html", s3EscapePath("/bucket/a b/c+d:1~x.html"))
+}
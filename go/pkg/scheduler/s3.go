@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// S3Config is the S3-compatible object store reports are archived in.
+type S3Config struct {
+	// Endpoint is the service base URL; empty uses AWS,
+	// https://s3.<region>.amazonaws.com. Objects are addressed path-style,
+	// which MinIO and other S3-compatible stores also accept.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Deliverer uploads reports with a Signature Version 4 signed PUT.
+type S3Deliverer struct {
+	S3     S3Config
+	Client *http.Client
+	// now stamps signatures; tests replace it.
+	now func() time.Time
+}
+
+// Deliver uploads the report and returns the object URL.
+func (d *S3Deliverer) Deliver(ctx context.Context, target Target, delivery Delivery) (string, error) {
+	if target.Bucket == "" {
+		return "", fmt.Errorf("s3 target has no bucket")
+	}
+	if d.S3.Region == "" || d.S3.AccessKeyID == "" || d.S3.SecretAccessKey == "" {
+		return "", fmt.Errorf("s3 region and credentials are not configured")
+	}
+	endpoint := strings.TrimRight(d.S3.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + d.S3.Region + ".amazonaws.com"
+	}
+	key := target.Prefix + delivery.Schedule + "/" + delivery.Report.FileName()
+	objectURL := endpoint + "/" + s3EscapePath(target.Bucket+"/"+key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(delivery.Report.Body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", delivery.Report.ContentType)
+	now := time.Now
+	if d.now != nil {
+		now = d.now
+	}
+	signS3Request(req, delivery.Report.Body, d.S3, now().UTC())
+
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultDeliveryTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("s3 returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return objectURL, nil
+}
+
+// signS3Request adds the AWS Signature Version 4 headers for an S3 request
+// with the given payload. The signed headers are host, x-amz-content-sha256
+// and x-amz-date.
+func signS3Request(req *http.Request, payload []byte, cfg S3Config, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// s3EscapePath percent-encodes everything but unreserved characters and
+// slashes, as SigV4 expects of S3 object paths.
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+)
+
+// TickInterval is how often the monitor checks for due schedules. Cron
+// expressions have minute resolution.
+const TickInterval = 30 * time.Second
+
+// Generator builds a report of a kind and format; *report.Generator
+// implements it.
+type Generator interface {
+	Generate(ctx context.Context, kind, format string) (*report.Output, error)
+}
+
+// Schedule generates a report on a cron expression and delivers it.
+type Schedule struct {
+	Name    string
+	Cron    *Cron
+	Kind    string
+	Format  string
+	Targets []Target
+}
+
+// Config configures a Scheduler.
+type Config struct {
+	Schedules []Schedule
+	Generator Generator
+	// Deliverers send reports by target type.
+	Deliverers map[string]Deliverer
+	// Store keeps the schedule states; nil keeps them in memory only.
+	Store *Store
+	// Backfill runs a schedule once at startup when it missed a trigger
+	// while the monitor was down. By default missed triggers are dropped.
+	Backfill bool
+	Clock    clock.Clock
+	Logger   *logging.Logger
+}
+
+// Scheduler runs report schedules. The monitor calls RunDue periodically.
+type Scheduler struct {
+	schedules  map[string]Schedule
+	generator  Generator
+	deliverers map[string]Deliverer
+	store      *Store
+	clock      clock.Clock
+	logger     *logging.Logger
+}
+
+// New creates a scheduler and records the configured schedules in the
+// store. Stored schedules that are no longer configured are dropped;
+// stored pause flags and last runs are kept.
+func New(config Config) (*Scheduler, error) {
+	if config.Generator == nil {
+		return nil, fmt.Errorf("report generator is required")
+	}
+	store := config.Store
+	if store == nil {
+		store, _ = NewStore("")
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.NewNop()
+	}
+	s := &Scheduler{
+		schedules:  make(map[string]Schedule, len(config.Schedules)),
+		generator:  config.Generator,
+		deliverers: config.Deliverers,
+		store:      store,
+		clock:      clock.OrReal(config.Clock),
+		logger:     logger,
+	}
+	for _, schedule := range config.Schedules {
+		if _, ok := s.schedules[schedule.Name]; ok {
+			return nil, fmt.Errorf("duplicate report schedule %q", schedule.Name)
+		}
+		s.schedules[schedule.Name] = schedule
+	}
+
+	now := s.clock.Now()
+	err := store.update(func(states map[string]*ScheduleState) error {
+		for name := range states {
+			if _, ok := s.schedules[name]; !ok {
+				delete(states, name)
+			}
+		}
+		for name, schedule := range s.schedules {
+			state, ok := states[name]
+			if !ok {
+				state = &ScheduleState{Name: name}
+				states[name] = state
+			}
+			state.Cron = schedule.Cron.String()
+			state.Kind = schedule.Kind
+			state.Format = schedule.Format
+			state.Targets = make([]string, 0, len(schedule.Targets))
+			for _, target := range schedule.Targets {
+				state.Targets = append(state.Targets, target.String())
+			}
+
+			state.NextRun = schedule.Cron.Next(now)
+			if config.Backfill && !state.LastRun.IsZero() {
+				if missed := schedule.Cron.Next(state.LastRun); !missed.IsZero() && !missed.After(now) {
+					state.NextRun = missed
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RunDue generates and delivers the reports of every schedule whose next
+// run has passed, then advances their next runs. Paused schedules only
+// advance. Failures are recorded in the schedule state and joined into the
+// returned error.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	now := s.clock.Now()
+	var due []Schedule
+	err := s.store.update(func(states map[string]*ScheduleState) error {
+		for name, schedule := range s.schedules {
+			state, ok := states[name]
+			if !ok {
+				// Removed from the shared file; register it again.
+				state = &ScheduleState{Name: name, Cron: schedule.Cron.String(), Kind: schedule.Kind, Format: schedule.Format}
+				states[name] = state
+			}
+			if state.NextRun.IsZero() || state.NextRun.After(now) {
+				if state.NextRun.IsZero() {
+					state.NextRun = schedule.Cron.Next(now)
+				}
+				continue
+			}
+			state.NextRun = schedule.Cron.Next(now)
+			if state.Paused {
+				s.logger.Info("Skipping paused report schedule", zap.String("schedule", name))
+				continue
+			}
+			due = append(due, schedule)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Name < due[j].Name })
+
+	var errs []error
+	for _, schedule := range due {
+		runErr := s.run(ctx, schedule)
+		err := s.store.update(func(states map[string]*ScheduleState) error {
+			state, ok := states[schedule.Name]
+			if !ok {
+				return nil
+			}
+			state.LastRun = now
+			state.LastStatus = RunSucceeded
+			state.LastError = ""
+			if runErr != nil {
+				state.LastStatus = RunFailed
+				// The state is served by the API; never persist a raw
+				// delivery error.
+				state.LastError = logging.RedactText(runErr.Error())
+			}
+			return nil
+		})
+		errs = append(errs, runErr, err)
+	}
+	return errors.Join(errs...)
+}
+
+// run generates one schedule's report and delivers it. S3 targets go first
+// so Slack messages and emails can link the archived copies; a failing
+// target does not stop delivery to the others.
+func (s *Scheduler) run(ctx context.Context, schedule Schedule) error {
+	start := s.clock.Now()
+	out, err := s.generator.Generate(ctx, schedule.Kind, schedule.Format)
+	if err != nil {
+		s.logger.Warn("Failed to generate scheduled report", zap.String("schedule", schedule.Name), logging.RedactedError(err))
+		return fmt.Errorf("schedule %s: %w", schedule.Name, err)
+	}
+
+	targets := append([]Target(nil), schedule.Targets...)
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].Type == TargetS3 && targets[j].Type != TargetS3
+	})
+	delivery := Delivery{Schedule: schedule.Name, Report: out}
+	var errs []error
+	for _, target := range targets {
+		deliverer, ok := s.deliverers[target.Type]
+		if !ok {
+			errs = append(errs, fmt.Errorf("schedule %s: no deliverer for %s target", schedule.Name, target.Type))
+			continue
+		}
+		link, err := deliverer.Deliver(ctx, target, delivery)
+		if err != nil {
+			s.logger.Warn("Failed to deliver scheduled report",
+				zap.String("schedule", schedule.Name),
+				zap.String("target", target.String()),
+				logging.RedactedError(err))
+			errs = append(errs, fmt.Errorf("schedule %s: %s: %w", schedule.Name, target, err))
+			continue
+		}
+		if link != "" {
+			delivery.Links = append(delivery.Links, link)
+		}
+	}
+	s.logger.Info("Scheduled report delivered",
+		zap.String("schedule", schedule.Name),
+		zap.Int("targets", len(targets)-len(errs)),
+		zap.Int("failed_targets", len(errs)),
+		zap.Duration("duration", s.clock.Now().Sub(start)))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/report"
+)
+
+type fakeGenerator struct {
+	calls int
+	err   error
+}
+
+func (g *fakeGenerator) Generate(_ context.Context, kind, format string) (*report.Output, error) {
+	g.calls++
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &report.Output{Kind: kind, Format: format, Body: []byte("<html></html>"), Summary: "0 orphaned PVs"}, nil
+}
+
+type recordingDeliverer struct {
+	targets *[]string
+	link    string
+	err     error
+	links   [][]string
+}
+
+func (d *recordingDeliverer) Deliver(_ context.Context, target Target, delivery Delivery) (string, error) {
+	*d.targets = append(*d.targets, target.String())
+	d.links = append(d.links, delivery.Links)
+	return d.link, d.err
+}
+
+func weekly(t *testing.T) Schedule {
+	t.Helper()
+	cron, err := ParseCron("0 8 * * 1")
+	require.NoError(t, err)
+	return Schedule{
+		Name:   "weekly",
+		Cron:   cron,
+		Kind:   report.KindDetailed,
+		Format: report.FormatHTML,
+		Targets: []Target{
+			{Type: TargetSlack, Channel: "#storage"},
+			{Type: TargetS3, Bucket: "reports"},
+		},
+	}
+}
+
+func TestScheduler_RunDueDeliversArchiveFirstAndAdvances(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC))
+	var delivered []string
+	slack := &recordingDeliverer{targets: &delivered}
+	s3 := &recordingDeliverer{targets: &delivered, link: "https://s3.example.com/reports/weekly/a.html"}
+	generator := &fakeGenerator{}
+	store, err := NewStore(filepath.Join(t.TempDir(), "schedules.json"))
+	require.NoError(t, err)
+
+	scheduler, err := New(Config{
+		Schedules:  []Schedule{weekly(t)},
+		Generator:  generator,
+		Deliverers: map[string]Deliverer{TargetSlack: slack, TargetS3: s3},
+		Store:      store,
+		Clock:      clk,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, scheduler.RunDue(context.Background()))
+	assert.Zero(t, generator.calls, "not due before 08:00")
+
+	clk.Set(time.Date(2024, 5, 6, 8, 0, 10, 0, time.UTC))
+	require.NoError(t, scheduler.RunDue(context.Background()))
+	assert.Equal(t, 1, generator.calls)
+	assert.Equal(t, []string{"s3:reports", "slack:#storage"}, delivered)
+	assert.Equal(t, [][]string{{"https://s3.example.com/reports/weekly/a.html"}}, slack.links)
+
+	states, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, RunSucceeded, states[0].LastStatus)
+	assert.Equal(t, time.Date(2024, 5, 6, 8, 0, 10, 0, time.UTC), states[0].LastRun)
+	assert.Equal(t, time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC), states[0].NextRun)
+	assert.Equal(t, []string{"slack:#storage", "s3:reports"}, states[0].Targets)
+}
+
+func TestScheduler_PausedScheduleSkipsAndFailuresAreRecorded(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC))
+	var delivered []string
+	generator := &fakeGenerator{}
+	store, err := NewStore("")
+	require.NoError(t, err)
+	scheduler, err := New(Config{
+		Schedules: []Schedule{weekly(t)},
+		Generator: generator,
+		Deliverers: map[string]Deliverer{
+			TargetSlack: &recordingDeliverer{targets: &delivered, err: errors.New("webhook gone")},
+			TargetS3:    &recordingDeliverer{targets: &delivered},
+		},
+		Store: store,
+		Clock: clk,
+	})
+	require.NoError(t, err)
+
+	_, err = store.SetPaused("weekly", true)
+	require.NoError(t, err)
+	clk.Set(time.Date(2024, 5, 6, 8, 1, 0, 0, time.UTC))
+	require.NoError(t, scheduler.RunDue(context.Background()))
+	assert.Zero(t, generator.calls)
+
+	_, err = store.SetPaused("weekly", false)
+	require.NoError(t, err)
+	clk.Set(time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC))
+	err = scheduler.RunDue(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "webhook gone")
+	assert.Equal(t, []string{"s3:reports", "slack:#storage"}, delivered)
+
+	states, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, RunFailed, states[0].LastStatus)
+	assert.Contains(t, states[0].LastError, "webhook gone")
+
+	_, err = store.SetPaused("monthly", true)
+	assert.ErrorIs(t, err, ErrScheduleNotFound)
+}
+
+func TestNew_BackfillsMissedRunOnlyWhenEnabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	lastRun := time.Date(2024, 4, 29, 8, 0, 0, 0, time.UTC)
+	restart := time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC)
+
+	for _, backfill := range []bool{false, true} {
+		store, err := NewStore(path)
+		require.NoError(t, err)
+		require.NoError(t, store.update(func(states map[string]*ScheduleState) error {
+			states["weekly"] = &ScheduleState{Name: "weekly", LastRun: lastRun}
+			return nil
+		}))
+
+		generator := &fakeGenerator{}
+		var delivered []string
+		scheduler, err := New(Config{
+			Schedules: []Schedule{weekly(t)},
+			Generator: generator,
+			Deliverers: map[string]Deliverer{
+				TargetSlack: &recordingDeliverer{targets: &delivered},
+				TargetS3:    &recordingDeliverer{targets: &delivered},
+			},
+			Store:    store,
+			Backfill: backfill,
+			Clock:    clock.NewFake(restart),
+		})
+		require.NoError(t, err)
+		require.NoError(t, scheduler.RunDue(context.Background()))
+		if backfill {
+			assert.Equal(t, 1, generator.calls, "missed 2024-05-06 run is backfilled once")
+		} else {
+			assert.Zero(t, generator.calls, "missed run is dropped")
+		}
+	}
+}
+
+func TestScheduler_FailedDeliveryDoesNotPersistWebhookURL(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	webhookURL := server.URL + "/services/T000/B000/secret-token"
+	server.Close()
+
+	clk := clock.NewFake(time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC))
+	store, err := NewStore("")
+	require.NoError(t, err)
+	schedule := weekly(t)
+	schedule.Targets = []Target{{Type: TargetSlack, Channel: "#storage"}}
+	scheduler, err := New(Config{
+		Schedules:  []Schedule{schedule},
+		Generator:  &fakeGenerator{},
+		Deliverers: map[string]Deliverer{TargetSlack: &SlackDeliverer{Webhook: webhookURL}},
+		Store:      store,
+		Clock:      clk,
+	})
+	require.NoError(t, err)
+
+	clk.Set(time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC))
+	err = scheduler.RunDue(context.Background())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+
+	states, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, RunFailed, states[0].LastStatus)
+	assert.NotEmpty(t, states[0].LastError)
+	assert.NotContains(t, states[0].LastError, "secret-token")
+}
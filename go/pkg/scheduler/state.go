@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run outcomes.
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	// RunSkipped is a trigger that passed while the schedule was paused.
+	RunSkipped = "skipped"
+)
+
+// ErrScheduleNotFound is returned for unknown schedule names.
+var ErrScheduleNotFound = errors.New("report schedule not found")
+
+// ScheduleState is the run state of one schedule.
+type ScheduleState struct {
+	Name    string   `json:"name"`
+	Cron    string   `json:"cron"`
+	Kind    string   `json:"kind"`
+	Format  string   `json:"format"`
+	Targets []string `json:"targets"`
+	Paused  bool     `json:"paused"`
+	// NextRun is when the schedule triggers next; zero before the scheduler
+	// first ran.
+	NextRun    time.Time `json:"next_run,omitempty"`
+	LastRun    time.Time `json:"last_run,omitempty"`
+	LastStatus string    `json:"last_status,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Store holds schedule states. With a path it persists them as JSON, so the
+// API server can list the monitor's schedules and pause them.
+type Store struct {
+	path string
+
+	mu     sync.Mutex
+	states map[string]*ScheduleState
+}
+
+// NewStore creates a store, loading existing states from path. An empty
+// path keeps the states in memory.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, states: make(map[string]*ScheduleState)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns the schedule states ordered by name.
+func (s *Store) List() ([]ScheduleState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.list(), nil
+}
+
+// SetPaused pauses or resumes a schedule. Paused schedules keep advancing
+// their next run but skip generation and delivery.
+func (s *Store) SetPaused(name string, paused bool) (ScheduleState, error) {
+	var updated ScheduleState
+	err := s.update(func(states map[string]*ScheduleState) error {
+		state, ok := states[name]
+		if !ok {
+			return ErrScheduleNotFound
+		}
+		state.Paused = paused
+		updated = *state
+		return nil
+	})
+	return updated, err
+}
+
+// update applies fn to freshly loaded states and saves them unless fn fails.
+func (s *Store) update(fn func(map[string]*ScheduleState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := fn(s.states); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *Store) list() []ScheduleState {
+	list := make([]ScheduleState, 0, len(s.states))
+	for _, state := range s.states {
+		list = append(list, *state)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// load replaces the in-memory states with the persisted ones. A missing
+// file leaves the store as is.
+func (s *Store) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read report schedule state: %w", err)
+	}
+	var list []ScheduleState
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse report schedule state %s: %w", s.path, err)
+	}
+	s.states = make(map[string]*ScheduleState, len(list))
+	for i := range list {
+		s.states[list[i].Name] = &list[i]
+	}
+	return nil
+}
+
+// save writes the states atomically through a temporary file.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report schedule state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".schedules-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write report schedule state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write report schedule state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write report schedule state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write report schedule state: %w", err)
+	}
+	return nil
+}
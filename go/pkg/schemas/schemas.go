@@ -0,0 +1,102 @@
+// Package schemas versions the JSON documents the API serves to automation.
+//
+// Every versioned document carries a schema_version field. A breaking
+// change (a removed or renamed field, or a field whose type or meaning
+// changes) bumps the document's Version, and the previous shape stays in
+// Supported, served under ?schema_version=, for at least one release.
+// Adding a field is not a breaking change and keeps the version.
+//
+// Documents served under /api/v2 as well keep the same schema versions
+// there; /api/v2 is where their breaking changes land once v1 is sunset.
+package schemas
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Names of the versioned documents.
+const (
+	OrphanReport     = "orphan_report"
+	OrphanedPVs      = "orphaned_pvs"
+	StorageAnalysis  = "storage_analysis"
+	ReportDocument   = "report_document"
+	SummaryReport    = "summary_report"
+	ValidationReport = "validation_report"
+	ScanDiff         = "scan_diff"
+	ScanStatus       = "scan_status"
+)
+
+// ErrUnsupportedVersion is returned by Negotiate for a version that is not
+// served.
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// Schema describes one versioned document.
+type Schema struct {
+	Name string `json:"name"`
+	// Version is the current version, served by default.
+	Version int `json:"version"`
+	// Supported lists every version still served, oldest first.
+	Supported []int `json:"supported_versions"`
+	// Endpoints are the API routes that return the document.
+	Endpoints []string `json:"endpoints"`
+}
+
+var registry = map[string]Schema{
+	OrphanReport:     {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/orphans"}},
+	OrphanedPVs:      {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/orphans/pvs"}},
+	StorageAnalysis:  {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/analysis"}},
+	ReportDocument:   {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/reports/detailed?format=json", "scheduled JSON reports"}},
+	SummaryReport:    {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/reports/summary", "GET /api/v2/reports/summary"}},
+	ValidationReport: {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/validate"}},
+	ScanDiff:         {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/scan/diff", "GET /api/v2/scan/diff"}},
+	ScanStatus:       {Version: 1, Supported: []int{1}, Endpoints: []string{"GET /api/v1/status", "GET /api/v2/status"}},
+}
+
+// All returns every versioned document, sorted by name.
+func All() []Schema {
+	all := make([]Schema, 0, len(registry))
+	for name := range registry {
+		schema, _ := Get(name)
+		all = append(all, schema)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Get returns the named document and whether it exists.
+func Get(name string) (Schema, bool) {
+	schema, ok := registry[name]
+	if !ok {
+		return Schema{}, false
+	}
+	schema.Name = name
+	schema.Supported = append([]int(nil), schema.Supported...)
+	schema.Endpoints = append([]string(nil), schema.Endpoints...)
+	return schema, true
+}
+
+// Current returns the current version of the named document, or 0 when the
+// name is unknown.
+func Current(name string) int {
+	return registry[name].Version
+}
+
+// Negotiate resolves a requested schema_version: empty means Version, and
+// anything else must be one of Supported.
+func (s Schema) Negotiate(requested string) (int, error) {
+	if requested == "" {
+		return s.Version, nil
+	}
+	version, err := strconv.Atoi(requested)
+	if err == nil {
+		for _, supported := range s.Supported {
+			if version == supported {
+				return version, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w: %s %q (supported: %v)", ErrUnsupportedVersion, s.Name, requested, s.Supported)
+}
@@ -0,0 +1,33 @@
+package schemas
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	schema := Schema{Name: "report", Version: 2, Supported: []int{1, 2}}
+
+	for requested, want := range map[string]int{"": 2, "1": 1, "2": 2} {
+		got, err := schema.Negotiate(requested)
+		if err != nil || got != want {
+			t.Fatalf("Negotiate(%q) = %d, %v; want %d", requested, got, err, want)
+		}
+	}
+	for _, requested := range []string{"3", "0", "v1"} {
+		if _, err := schema.Negotiate(requested); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatalf("Negotiate(%q) error = %v, want ErrUnsupportedVersion", requested, err)
+		}
+	}
+}
+
+func TestRegistry_CurrentVersionIsSupported(t *testing.T) {
+	for _, schema := range All() {
+		if len(schema.Supported) == 0 || schema.Supported[len(schema.Supported)-1] != schema.Version {
+			t.Fatalf("%s: supported %v must end with the current version %d", schema.Name, schema.Supported, schema.Version)
+		}
+		if len(schema.Endpoints) == 0 {
+			t.Fatalf("%s has no endpoints", schema.Name)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package startup holds the checks the monitor and the API server run before
+// they start serving, so both binaries fail or warn the same way.
+package startup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/config"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Timeout bounds each startup check.
+const Timeout = 30 * time.Second
+
+// CheckScope verifies the configured pool and parent dataset. A missing one
+// is returned as an error with truenas.missing_pool: fail and logged
+// otherwise; scans and GET /api/v1/validate then report it. An unreachable
+// TrueNAS only warns, since scans wait for it anyway.
+func CheckScope(truenasClient truenas.Client, scope analysis.ScopeOptions, logger *zap.Logger) error {
+	if !scope.Enabled() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	report, err := analysis.CheckScope(ctx, truenasClient, scope)
+	if err != nil {
+		logger.Warn("Could not verify the configured TrueNAS pool at startup", zap.Error(err))
+		return nil
+	}
+	err = report.Err()
+	if err == nil {
+		return nil
+	}
+	if scope.Strict {
+		return fmt.Errorf("%w (available pools: %s)", err, strings.Join(report.AvailablePools, ", "))
+	}
+	logger.Warn("Configured TrueNAS pool or parent dataset is missing; scans are marked degraded until it exists",
+		zap.Error(err), zap.Strings("available_pools", report.AvailablePools))
+	return nil
+}
+
+// VerifyAlertDestinations sends a test notification from origin to every
+// alert destination, exports the result when exporter is set and logs the
+// failing destinations. With alerts.required a failing destination is
+// returned as an error.
+func VerifyAlertDestinations(dispatcher *alerts.Dispatcher, origin string, required bool, exporter *metrics.Exporter, logger *zap.Logger) ([]alerts.DestinationCheck, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	checks := dispatcher.Verify(ctx, origin)
+	if exporter != nil {
+		exporter.SetAlertDestinationHealth(alerts.DestinationHealth(checks))
+	}
+	var failed []string
+	for _, check := range checks {
+		if check.Healthy {
+			continue
+		}
+		failed = append(failed, check.Destination.String())
+		fields := []zap.Field{
+			zap.String("destination", check.Destination.String()),
+			zap.Strings("routes", check.Routes),
+			zap.String("error", check.Error),
+		}
+		if required {
+			logger.Error("Alert destination failed the startup test notification", fields...)
+			continue
+		}
+		logger.Error("Alert destination failed the startup test notification; alerts sent there will be lost", fields...)
+	}
+	if required && len(failed) > 0 {
+		return checks, fmt.Errorf("alert destinations failed the startup test notification: %s", strings.Join(failed, ", "))
+	}
+	return checks, nil
+}
+
+// OpenStore opens the configured state store and applies its migrations.
+func OpenStore(cfg config.StoreConfig) (store.Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	return store.Open(ctx, cfg.Options())
+}
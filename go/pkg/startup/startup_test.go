@@ -0,0 +1,63 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/alerts"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/analysis"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func TestCheckScope(t *testing.T) {
+	client := &truenastest.Client{Pools: []truenas.Pool{{Name: "tank"}}}
+
+	assert.NoError(t, CheckScope(client, analysis.ScopeOptions{}, zap.NewNop()))
+	assert.NoError(t, CheckScope(client, analysis.ScopeOptions{Pool: "tank"}, zap.NewNop()))
+	assert.NoError(t, CheckScope(client, analysis.ScopeOptions{Pool: "tnak"}, zap.NewNop()), "only strict scopes fail")
+
+	err := CheckScope(client, analysis.ScopeOptions{Pool: "tnak", Strict: true}, zap.NewNop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "available pools: tank")
+
+	client.ListPoolsErr = errors.New("connection refused")
+	assert.NoError(t, CheckScope(client, analysis.ScopeOptions{Pool: "tnak", Strict: true}, zap.NewNop()),
+		"an unreachable TrueNAS only warns")
+}
+
+func TestVerifyAlertDestinations(t *testing.T) {
+	router := alerts.NewRouter(alerts.RouterConfig{
+		Default: alerts.Route{Destinations: []alerts.Destination{
+			{Type: alerts.DestinationSlack, Channel: "#storage"},
+			{Type: alerts.DestinationWebhook, URL: "https://hooks.example.com/a"},
+		}},
+	})
+	dispatcher, err := alerts.NewDispatcher(alerts.DispatcherConfig{
+		Router: router,
+		Senders: map[string]alerts.Sender{
+			alerts.DestinationSlack: alerts.SenderFunc(func(context.Context, alerts.Destination, alerts.Alert) error { return nil }),
+			alerts.DestinationWebhook: alerts.SenderFunc(func(context.Context, alerts.Destination, alerts.Alert) error {
+				return errors.New("destination returned status 404")
+			}),
+		},
+		Logger: logging.NewNop(),
+	})
+	require.NoError(t, err)
+
+	checks, err := VerifyAlertDestinations(dispatcher, "truenas-monitor", false, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, checks, 2)
+	assert.True(t, checks[0].Healthy)
+	assert.False(t, checks[1].Healthy)
+
+	_, err = VerifyAlertDestinations(dispatcher, "truenas-monitor", true, nil, zap.NewNop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), checks[1].Destination.String())
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltFormatVersion is the version of the layout written by BoltStore.
+// Opening a file of an older version upgrades it through boltMigrations; a
+// newer version is refused.
+const boltFormatVersion = 1
+
+// boltMigrations[i] upgrades a file of version i+1 to version i+2; it has
+// len(boltMigrations) == boltFormatVersion-1 entries.
+var boltMigrations []func(*bolt.Tx) error
+
+// boltLockTimeout bounds the wait for the file lock another process holds.
+const boltLockTimeout = 5 * time.Second
+
+// Top-level bbolt buckets: metaBucket holds the format version and
+// dataBucket holds one nested bucket per store bucket, so store bucket
+// names never collide with metadata.
+var (
+	metaBucket = []byte("meta")
+	dataBucket = []byte("buckets")
+	versionKey = []byte("version")
+)
+
+// BoltStore keeps all buckets in one embedded bbolt file. The file is
+// locked while open, so one process owns it; replicas that must share
+// state use the Postgres backend.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the store at path, creating the file and its directory and
+// upgrading an older format. It fails after boltLockTimeout when another
+// process has the file open.
+func OpenBolt(path string) (*BoltStore, error) {
+	if path == "" {
+		return nil, errors.New("the bolt store needs a path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltLockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("store %s is locked by another process; give each process its own file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", path, err)
+	}
+	if err := db.Update(migrateBolt); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Get implements Store.
+func (s *BoltStore) Get(_ context.Context, bucket, key string) ([]byte, error) {
+	if err := checkKey(bucket, key); err != nil {
+		return nil, err
+	}
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dataBucket).Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		// Values are only valid inside the transaction.
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+// Put implements Store.
+func (s *BoltStore) Put(_ context.Context, bucket, key string, value []byte) error {
+	if err := checkKey(bucket, key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(dataBucket).CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// List implements Store.
+func (s *BoltStore) List(_ context.Context, bucket string) ([]Entry, error) {
+	entries := []Entry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dataBucket).Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		// bbolt iterates in byte order, which is the key order of List.
+		return b.ForEach(func(k, v []byte) error {
+			entries = append(entries, Entry{Key: string(k), Value: append([]byte{}, v...)})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	return entries, nil
+}
+
+// Delete implements Store.
+func (s *BoltStore) Delete(_ context.Context, bucket, key string) error {
+	if err := checkKey(bucket, key); err != nil {
+		return err
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(dataBucket)
+		b := data.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		if k, _ := b.Cursor().First(); k == nil {
+			return data.DeleteBucket([]byte(bucket))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Ping rewrites the format version in a write transaction, so a closed
+// store or a read-only or full volume fails readiness.
+func (s *BoltStore) Ping(_ context.Context) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(versionKey, encodeVersion(boltFormatVersion))
+	})
+}
+
+// Close implements Store and releases the file lock.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// migrateBolt creates the layout of a new file, or upgrades an older one
+// to boltFormatVersion.
+func migrateBolt(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	version := boltFormatVersion
+	if raw := meta.Get(versionKey); raw != nil {
+		if len(raw) != 8 {
+			return errors.New("has a malformed format version")
+		}
+		version = int(binary.BigEndian.Uint64(raw))
+	}
+	if version < 1 || version > boltFormatVersion {
+		return fmt.Errorf("has format version %d; this build supports 1 to %d", version, boltFormatVersion)
+	}
+	if _, err := tx.CreateBucketIfNotExists(dataBucket); err != nil {
+		return err
+	}
+	for ; version < boltFormatVersion; version++ {
+		if err := boltMigrations[version-1](tx); err != nil {
+			return fmt.Errorf("failed to upgrade from version %d: %w", version, err)
+		}
+	}
+	return meta.Put(versionKey, encodeVersion(boltFormatVersion))
+}
+
+func encodeVersion(version int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(version))
+}
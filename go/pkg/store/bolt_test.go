@@ -0,0 +1,91 @@
+package store_test
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store/storetest"
+)
+
+func TestBoltStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.OpenBolt(filepath.Join(t.TempDir(), "state", "store.db"))
+		if err != nil {
+			t.Fatalf("OpenBolt: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestBoltStore_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.db")
+	writer, err := store.OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	if err := writer.Put(ctx, "alerts", "a", []byte("firing")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Open without a backend is the bolt backend.
+	reader, err := store.Open(ctx, store.Options{Path: path})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+	got, err := reader.Get(ctx, "alerts", "a")
+	if err != nil || string(got) != "firing" {
+		t.Fatalf("Get after reopen = %q, %v", got, err)
+	}
+}
+
+func TestBoltStore_RefusesNewerFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucket([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte("version"), binary.BigEndian.AppendUint64(nil, 99))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := store.OpenBolt(path); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Fatalf("OpenBolt = %v, want a format version error", err)
+	}
+}
+
+func TestBoltStore_PingFailsWhenClosed(t *testing.T) {
+	s, err := store.OpenBolt(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	s.Close()
+	if err := s.Ping(context.Background()); err == nil {
+		t.Fatal("Ping of a closed store succeeded")
+	}
+}
+
+func TestOpen_UnknownBackend(t *testing.T) {
+	if _, err := store.Open(context.Background(), store.Options{Backend: "file"}); err == nil {
+		t.Fatal("Open of an unknown backend succeeded")
+	}
+}
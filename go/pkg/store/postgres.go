@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	// Registers the "pgx" database/sql driver.
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresMigrations create and upgrade the Postgres schema; migration i
+// brings the schema to version i+1. Applied versions are recorded in
+// store_schema_migrations under an advisory lock, so replicas starting
+// together apply each once.
+var postgresMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS store_entries (
+		bucket TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value BYTEA NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (bucket, key)
+	)`,
+}
+
+// Postgres schema queries.
+const (
+	createMigrationsTable = `CREATE TABLE IF NOT EXISTS store_schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	// lockMigrations takes a transaction-scoped advisory lock; the key is
+	// arbitrary but fixed. Unlike a table lock it also covers creating
+	// store_schema_migrations, which concurrent CREATE TABLE IF NOT EXISTS
+	// statements can race on.
+	lockMigrations    = `SELECT pg_advisory_xact_lock(7241598210473)`
+	selectVersion     = `SELECT COALESCE(MAX(version), 0) FROM store_schema_migrations`
+	insertVersion     = `INSERT INTO store_schema_migrations (version) VALUES ($1)`
+	selectEntry       = `SELECT value FROM store_entries WHERE bucket = $1 AND key = $2`
+	selectBucket      = `SELECT key, value FROM store_entries WHERE bucket = $1 ORDER BY key COLLATE "C"`
+	deleteEntry       = `DELETE FROM store_entries WHERE bucket = $1 AND key = $2`
+	upsertEntry       = `INSERT INTO store_entries (bucket, key, value, updated_at) VALUES ($1, $2, $3, now()) ON CONFLICT (bucket, key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`
+	selectSchemaCheck = `SELECT 1 FROM store_entries LIMIT 1`
+)
+
+// PostgresStore keeps buckets in one Postgres table shared by all replicas.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// OpenPostgres connects to the database at dsn through pgx and migrates the
+// schema.
+func OpenPostgres(ctx context.Context, dsn string) (*PostgresStore, error) {
+	if dsn == "" {
+		return nil, errors.New("the postgres store needs a DSN")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres store: %w", err)
+	}
+	s := &PostgresStore{db: db}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get implements Store.
+func (s *PostgresStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	if err := checkKey(bucket, key); err != nil {
+		return nil, err
+	}
+	var value []byte
+	err := s.db.QueryRowContext(ctx, selectEntry, bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", bucket, key, err)
+	}
+	return value, nil
+}
+
+// Put implements Store.
+func (s *PostgresStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	if err := checkKey(bucket, key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	if _, err := s.db.ExecContext(ctx, upsertEntry, bucket, key, value); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// List implements Store.
+func (s *PostgresStore) List(ctx context.Context, bucket string) ([]Entry, error) {
+	rows, err := s.db.QueryContext(ctx, selectBucket, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(&entry.Key, &entry.Value); err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	return entries, nil
+}
+
+// Delete implements Store.
+func (s *PostgresStore) Delete(ctx context.Context, bucket, key string) error {
+	if err := checkKey(bucket, key); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, deleteEntry, bucket, key); err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Ping checks the connection and that the entries table is readable.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("postgres store is unreachable: %w", err)
+	}
+	var one int
+	if err := s.db.QueryRowContext(ctx, selectSchemaCheck).Scan(&one); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("postgres store is not readable: %w", err)
+	}
+	return nil
+}
+
+// Close implements Store.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies the pending postgresMigrations in one transaction that
+// holds the migrations advisory lock.
+func (s *PostgresStore) migrate(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, lockMigrations); err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	var version int
+	if err := tx.QueryRowContext(ctx, selectVersion).Scan(&version); err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	if version > len(postgresMigrations) {
+		return fmt.Errorf("postgres store schema version %d is newer than the supported %d", version, len(postgresMigrations))
+	}
+	for i := version; i < len(postgresMigrations); i++ {
+		if _, err := tx.ExecContext(ctx, postgresMigrations[i]); err != nil {
+			return fmt.Errorf("failed to apply postgres store migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, insertVersion, i+1); err != nil {
+			return fmt.Errorf("failed to record postgres store migration %d: %w", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,131 @@
+// Package store persists state that outlives a process, such as scan
+// history, orphan state, alerts and jobs, as opaque values in named buckets.
+// The default backend is one embedded bbolt file on a volume; the Postgres
+// backend lets several replicas share state.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Backends.
+const (
+	BackendBolt     = "bolt"
+	BackendPostgres = "postgres"
+)
+
+// ErrNotFound is returned by Get for a key that is not in the bucket.
+var ErrNotFound = errors.New("store: key not found")
+
+// Store is a key-value store over named buckets. Buckets exist implicitly;
+// keys and bucket names must not be empty.
+type Store interface {
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+	// Put creates or replaces a value.
+	Put(ctx context.Context, bucket, key string, value []byte) error
+	// List returns the entries of a bucket ordered by key.
+	List(ctx context.Context, bucket string) ([]Entry, error)
+	// Delete removes a key; deleting a missing key is not an error.
+	Delete(ctx context.Context, bucket, key string) error
+	// Ping checks that the store can be read and written, for readiness.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Entry is one key and value of a bucket.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// Options select and configure a backend.
+type Options struct {
+	// Backend is BackendBolt or BackendPostgres; empty with a Path is
+	// BackendBolt.
+	Backend string
+	// Path is the file of the bolt backend, typically on a PVC.
+	Path string
+	// DSN is the Postgres connection string.
+	DSN string
+}
+
+// Open opens the configured backend and applies its migrations.
+func Open(ctx context.Context, opts Options) (Store, error) {
+	switch opts.Backend {
+	case BackendBolt, "":
+		return OpenBolt(opts.Path)
+	case BackendPostgres:
+		return OpenPostgres(ctx, opts.DSN)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q (want %s or %s)", opts.Backend, BackendBolt, BackendPostgres)
+	}
+}
+
+// Bucket is a typed view of one bucket whose values are JSON encoded.
+type Bucket[T any] struct {
+	store Store
+	name  string
+}
+
+// NewBucket returns the bucket name of s holding values of type T.
+func NewBucket[T any](s Store, name string) Bucket[T] {
+	return Bucket[T]{store: s, name: name}
+}
+
+// Get decodes the value of key; it returns ErrNotFound for a missing key.
+func (b Bucket[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	data, err := b.store.Get(ctx, b.name, key)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("failed to decode %s/%s: %w", b.name, key, err)
+	}
+	return value, nil
+}
+
+// Put encodes and stores the value of key.
+func (b Bucket[T]) Put(ctx context.Context, key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", b.name, key, err)
+	}
+	return b.store.Put(ctx, b.name, key, data)
+}
+
+// List decodes all values of the bucket by key.
+func (b Bucket[T]) List(ctx context.Context) (map[string]T, error) {
+	entries, err := b.store.List(ctx, b.name)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]T, len(entries))
+	for _, entry := range entries {
+		var value T
+		if err := json.Unmarshal(entry.Value, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode %s/%s: %w", b.name, entry.Key, err)
+		}
+		values[entry.Key] = value
+	}
+	return values, nil
+}
+
+// Delete removes key from the bucket.
+func (b Bucket[T]) Delete(ctx context.Context, key string) error {
+	return b.store.Delete(ctx, b.name, key)
+}
+
+// checkKey rejects empty bucket names and keys.
+func checkKey(bucket, key string) error {
+	if bucket == "" {
+		return errors.New("store: empty bucket name")
+	}
+	if key == "" {
+		return errors.New("store: empty key")
+	}
+	return nil
+}
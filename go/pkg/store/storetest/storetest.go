@@ -0,0 +1,121 @@
+// Package storetest provides the conformance tests every store.Store
+// backend must pass.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/store"
+)
+
+// Run runs the conformance tests against stores returned by open, which is
+// called once per subtest and must return an empty store.
+func Run(t *testing.T, open func(t *testing.T) store.Store) {
+	ctx := context.Background()
+
+	t.Run("GetMissing", func(t *testing.T) {
+		s := open(t)
+		if _, err := s.Get(ctx, "jobs", "missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("PutGetReplace", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(ctx, "jobs", "a", []byte("one")); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := s.Put(ctx, "jobs", "a", []byte("two")); err != nil {
+			t.Fatalf("Put replace: %v", err)
+		}
+		got, err := s.Get(ctx, "jobs", "a")
+		if err != nil || string(got) != "two" {
+			t.Fatalf("Get = %q, %v, want the replaced value", got, err)
+		}
+		if _, err := s.Get(ctx, "alerts", "a"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Get from another bucket = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("ListOrdersByKeyPerBucket", func(t *testing.T) {
+		s := open(t)
+		for _, key := range []string{"c", "a", "b"} {
+			if err := s.Put(ctx, "scans", key, []byte(key)); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+		if err := s.Put(ctx, "other", "z", []byte("z")); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		entries, err := s.List(ctx, "scans")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(entries) != 3 || entries[0].Key != "a" || entries[2].Key != "c" || string(entries[1].Value) != "b" {
+			t.Fatalf("List = %+v, want a, b, c", entries)
+		}
+		empty, err := s.List(ctx, "empty")
+		if err != nil || len(empty) != 0 {
+			t.Fatalf("List of an empty bucket = %+v, %v, want none", empty, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(ctx, "jobs", "a", []byte("one")); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := s.Delete(ctx, "jobs", "a"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := s.Get(ctx, "jobs", "a"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+		}
+		if err := s.Delete(ctx, "jobs", "a"); err != nil {
+			t.Fatalf("Delete of a missing key: %v", err)
+		}
+	})
+
+	t.Run("RejectsEmptyKeys", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(ctx, "", "a", nil); err == nil {
+			t.Fatal("Put with an empty bucket succeeded")
+		}
+		if err := s.Put(ctx, "jobs", "", nil); err == nil {
+			t.Fatal("Put with an empty key succeeded")
+		}
+	})
+
+	t.Run("TypedBucket", func(t *testing.T) {
+		type job struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		}
+		jobs := store.NewBucket[job](open(t), "jobs")
+		if err := jobs.Put(ctx, "cleanup-1", job{Name: "cleanup", Count: 3}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		got, err := jobs.Get(ctx, "cleanup-1")
+		if err != nil || got != (job{Name: "cleanup", Count: 3}) {
+			t.Fatalf("Get = %+v, %v", got, err)
+		}
+		all, err := jobs.List(ctx)
+		if err != nil || len(all) != 1 || all["cleanup-1"].Count != 3 {
+			t.Fatalf("List = %+v, %v", all, err)
+		}
+		if err := jobs.Delete(ctx, "cleanup-1"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := jobs.Get(ctx, "cleanup-1"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Ping", func(t *testing.T) {
+		if err := open(t).Ping(ctx); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newOTLPExporter creates an OTLP/HTTP exporter for the collector at
+// endpoint, an http or https base URL such as http://tempo:4318.
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: must be an http or https URL", endpoint)
+	}
+	parsed.Path = strings.TrimRight(parsed.Path, "/") + "/v1/traces"
+	// New only builds the client; the collector is first contacted by an
+	// export.
+	return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(parsed.String()))
+}
@@ -0,0 +1,244 @@
+// Package tracing records spans for monitor scans and API requests with the
+// OpenTelemetry SDK and exports them over OTLP/HTTP.
+//
+// Spans live in the context. Start creates a child of the span in its
+// context and does nothing when there is none, so instrumented code only
+// pays for a context lookup when tracing is disabled or a trace was not
+// sampled. Root spans are started from a Tracer; a nil *Tracer and a nil
+// *Span are valid no-ops.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// DefaultServiceName is reported as service.name when Config.ServiceName is
+// empty.
+const DefaultServiceName = "truenas-monitor"
+
+// instrumentationScope names this package in exported spans.
+const instrumentationScope = "github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+
+// defaultBatchTimeout is how often ended spans are exported.
+const defaultBatchTimeout = 5 * time.Second
+
+// Config holds tracing settings.
+type Config struct {
+	Enabled bool
+	// Endpoint is the OTLP/HTTP collector base URL, e.g. http://tempo:4318;
+	// spans are posted to its /v1/traces path.
+	Endpoint string
+	// SampleRatio is the fraction of new traces recorded, between 0 and 1.
+	// Requests continuing a trace follow the caller's sampling decision.
+	SampleRatio float64
+	ServiceName string
+	// Exporter overrides the OTLP exporter built from Endpoint, e.g. with a
+	// tracetest.InMemoryExporter in tests.
+	Exporter sdktrace.SpanExporter
+	// BatchTimeout is how often ended spans are exported; zero uses 5s.
+	BatchTimeout time.Duration
+	// Logger receives the errors of span exports.
+	Logger *zap.Logger
+}
+
+// Propagator reads and writes the W3C traceparent header.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Attribute is a span attribute.
+type Attribute = attribute.KeyValue
+
+// String returns a string attribute.
+func String(key, value string) Attribute { return attribute.String(key, value) }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute { return attribute.Int(key, value) }
+
+// Int64 returns an integer attribute.
+func Int64(key string, value int64) Attribute { return attribute.Int64(key, value) }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute { return attribute.Bool(key, value) }
+
+// SpanKind is the OpenTelemetry span kind.
+type SpanKind = trace.SpanKind
+
+// Span kinds used by the instrumentation.
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+)
+
+// SpanOption configures a span when it is started.
+type SpanOption = trace.SpanStartOption
+
+// WithAttributes adds attributes to the span.
+func WithAttributes(attrs ...Attribute) SpanOption { return trace.WithAttributes(attrs...) }
+
+// WithKind sets the span kind; spans are internal by default.
+func WithKind(kind SpanKind) SpanOption { return trace.WithSpanKind(kind) }
+
+// WithTimestamp sets the span start time, for recording a step after it ran.
+func WithTimestamp(start time.Time) SpanOption { return trace.WithTimestamp(start) }
+
+// Span is a recording span. All methods are no-ops on a nil *Span.
+type Span struct {
+	span trace.Span
+}
+
+// SpanContext returns the span's identity; zero for a nil span.
+func (s *Span) SpanContext() trace.SpanContext {
+	if s == nil {
+		return trace.SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// RecordError marks the span as failed with err; nil is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span and queues it for export. Only the first call counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// SpanFromContext returns the recording span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// Start starts a child of the span in ctx. Without a recording span in ctx
+// it returns ctx unchanged and a nil span.
+func Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.IsRecording() {
+		return ctx, nil
+	}
+	ctx, span := parent.TracerProvider().Tracer(instrumentationScope).Start(ctx, name, opts...)
+	return ctx, &Span{span: span}
+}
+
+// Tracer starts root spans and exports ended spans.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewTracer creates a tracer; it returns nil, a valid no-op tracer, when
+// tracing is disabled.
+func NewTracer(config Config) (*Tracer, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio %v must be between 0 and 1", config.SampleRatio)
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	batchTimeout := config.BatchTimeout
+	if batchTimeout <= 0 {
+		batchTimeout = defaultBatchTimeout
+	}
+
+	exporter := config.Exporter
+	if exporter == nil {
+		otlp, err := newOTLPExporter(config.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlp
+	}
+
+	// The SDK reports failed exports through the global error handler.
+	logger = logger.With(zap.String("component", "tracing"))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Failed to export spans", zap.Error(err))
+	}))
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(batchTimeout)),
+		// Callers' sampling decisions are followed; new traces are sampled
+		// by trace ID, so every process makes the same decision for one.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	return &Tracer{provider: provider, tracer: provider.Tracer(instrumentationScope)}, nil
+}
+
+// TracerProvider returns the provider behind the tracer, for instrumentation
+// libraries such as otelgin.
+func (t *Tracer) TracerProvider() trace.TracerProvider {
+	return t.provider
+}
+
+// Start starts a span. It continues the span or remote parent in ctx;
+// otherwise it starts a new trace, recorded with the configured sample
+// ratio. Unsampled spans are nil, so their children are not created either.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	if trace.SpanFromContext(ctx).IsRecording() {
+		return Start(ctx, name, opts...)
+	}
+	spanCtx, span := t.tracer.Start(ctx, name, opts...)
+	if !span.IsRecording() {
+		return ctx, nil
+	}
+	return spanCtx, &Span{span: span}
+}
+
+// ForceFlush exports all ended spans now.
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.ForceFlush(ctx)
+}
+
+// Shutdown exports the remaining spans and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
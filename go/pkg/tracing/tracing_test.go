@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracer(t *testing.T, ratio float64) (*Tracer, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tracer, err := NewTracer(Config{Enabled: true, SampleRatio: ratio, Exporter: exporter, BatchTimeout: time.Hour})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tracer.Shutdown(context.Background()) })
+	return tracer, exporter
+}
+
+func TestTracer_RecordsSpanTree(t *testing.T) {
+	tracer, exporter := newTestTracer(t, 1)
+
+	ctx, root := tracer.Start(context.Background(), "monitor.scan")
+	childCtx, child := Start(ctx, "k8s.list persistentvolumes", WithKind(SpanKindClient), WithAttributes(String("k8s.resource", "persistentvolumes")))
+	child.SetAttributes(Int("k8s.items", 3))
+	_, grandchild := Start(childCtx, "retry")
+	grandchild.RecordError(errors.New("boom"))
+	grandchild.End()
+	child.End()
+	child.End() // a second End is ignored
+	root.End()
+
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	assert.Equal(t, "retry", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "boom", spans[0].Status.Description)
+	assert.Equal(t, child.SpanContext().SpanID(), spans[0].Parent.SpanID())
+
+	assert.Equal(t, SpanKindClient, spans[1].SpanKind)
+	assert.Equal(t, []Attribute{String("k8s.resource", "persistentvolumes"), Int("k8s.items", 3)}, spans[1].Attributes)
+	assert.Equal(t, root.SpanContext().SpanID(), spans[1].Parent.SpanID())
+
+	assert.False(t, spans[2].Parent.IsValid())
+	assert.Contains(t, spans[2].Resource.Attributes(), String("service.name", DefaultServiceName))
+	for _, span := range spans {
+		assert.Equal(t, root.SpanContext().TraceID(), span.SpanContext.TraceID())
+		assert.False(t, span.EndTime.Before(span.StartTime))
+	}
+}
+
+func TestTracer_DisabledAndUnsampledAreNoops(t *testing.T) {
+	disabled, err := NewTracer(Config{})
+	require.NoError(t, err)
+	require.Nil(t, disabled)
+
+	ctx := context.Background()
+	gotCtx, span := disabled.Start(ctx, "scan")
+	assert.Equal(t, ctx, gotCtx)
+	assert.Nil(t, span)
+	span.SetAttributes(Int("items", 1))
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	_, child := Start(gotCtx, "child")
+	assert.Nil(t, child)
+	assert.Nil(t, SpanFromContext(gotCtx))
+	assert.NoError(t, disabled.ForceFlush(ctx))
+	assert.NoError(t, disabled.Shutdown(ctx))
+
+	tracer, exporter := newTestTracer(t, 0)
+	_, span = tracer.Start(ctx, "scan")
+	assert.Nil(t, span)
+	require.NoError(t, tracer.ForceFlush(ctx))
+	assert.Empty(t, exporter.GetSpans())
+
+	_, err = NewTracer(Config{Enabled: true, SampleRatio: 2, Exporter: exporter})
+	assert.Error(t, err)
+	_, err = NewTracer(Config{Enabled: true, SampleRatio: 1, Endpoint: "tempo:4318"})
+	assert.Error(t, err)
+}
+
+func TestTracer_ContinuesRemoteParent(t *testing.T) {
+	tracer, exporter := newTestTracer(t, 0)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	remote := Propagator.Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	// A sampled caller is followed even though new traces are not sampled.
+	ctx, span := tracer.Start(remote, "GET /api/v1/orphans")
+	require.NotNil(t, span)
+	out := http.Header{}
+	Propagator.Inject(ctx, propagation.HeaderCarrier(out))
+	span.End()
+
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.True(t, spans[0].Parent.IsRemote())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanContext.SpanID().String()+"-01", out.Get("traceparent"))
+
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span = tracer.Start(Propagator.Extract(context.Background(), propagation.HeaderCarrier(header)), "GET /api/v1/orphans")
+	assert.Nil(t, span)
+
+	for _, invalid := range []string{"", "00-xyz-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"} {
+		header.Set("traceparent", invalid)
+		ctx := Propagator.Extract(context.Background(), propagation.HeaderCarrier(header))
+		assert.False(t, trace.SpanContextFromContext(ctx).IsValid(), invalid)
+	}
+}
+
+func TestOTLPExporter_PostsToTracesPath(t *testing.T) {
+	var mu sync.Mutex
+	var path, contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		path, contentType, body = r.URL.Path, r.Header.Get("Content-Type"), data
+	}))
+	defer server.Close()
+
+	tracer, err := NewTracer(Config{Enabled: true, SampleRatio: 1, Endpoint: server.URL + "/", ServiceName: "truenas-api"})
+	require.NoError(t, err)
+	_, span := tracer.Start(context.Background(), "monitor.scan")
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Contains(t, string(body), "monitor.scan")
+	assert.Contains(t, string(body), "truenas-api")
+}
@@ -2,12 +2,16 @@ package truenas
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
 	"go.uber.org/zap"
 )
 
@@ -15,18 +19,54 @@ import (
 type Client interface {
 	ListVolumes(ctx context.Context) ([]Volume, error)
 	ListSnapshots(ctx context.Context) ([]Snapshot, error)
+	// ListSnapshotsSince lists snapshots created at or after since.
+	ListSnapshotsSince(ctx context.Context, since time.Time) ([]Snapshot, error)
 	ListPools(ctx context.Context) ([]Pool, error)
+	GetSMBShares(ctx context.Context) ([]SMBShare, error)
+	GetNFSShares(ctx context.Context) ([]NFSShare, error)
+	// GetDataset returns the dataset with the given name, or ErrDatasetNotFound.
+	GetDataset(ctx context.Context, name string) (*Volume, error)
+	ListAlerts(ctx context.Context) ([]Alert, error)
+	ListSnapshotTasks(ctx context.Context) ([]PeriodicSnapshotTask, error)
+	ListReplicationTasks(ctx context.Context) ([]ReplicationTask, error)
+	// GetDatasetIOStats returns average I/O rates of the datasets over the
+	// last window.
+	GetDatasetIOStats(ctx context.Context, datasets []string, window time.Duration) ([]DatasetIOStats, error)
+	// SetDatasetRefquota sets the refquota of a dataset in bytes; 0 removes it.
+	SetDatasetRefquota(ctx context.Context, name string, refquota int64) error
+	// DeleteSnapshot destroys a snapshot by its full name, or returns
+	// ErrSnapshotNotFound. When TrueNAS runs the delete as a job, it waits
+	// for the job and returns a *JobError if the job failed. It returns
+	// ErrNotDeleted if the snapshot is still listed afterwards.
+	DeleteSnapshot(ctx context.Context, name string, opts DeleteSnapshotOptions) error
+	// CreateSnapshot takes a snapshot called name of dataset and returns it.
+	CreateSnapshot(ctx context.Context, dataset, name string) (*Snapshot, error)
+	// CloneSnapshot clones a snapshot, by its full name, to a new dataset.
+	CloneSnapshot(ctx context.Context, snapshot, dataset string) error
+	// DeleteDataset destroys a dataset without children, or returns
+	// ErrDatasetNotFound. TrueNAS jobs are awaited as for DeleteSnapshot.
+	DeleteDataset(ctx context.Context, name string) error
+	// ListISCSISessions lists the initiators connected to iSCSI targets.
+	ListISCSISessions(ctx context.Context) ([]ISCSISession, error)
+	// ListISCSIInitiatorGroups lists the iSCSI initiator allow-lists.
+	ListISCSIInitiatorGroups(ctx context.Context) ([]ISCSIInitiatorGroup, error)
 	GetSystemInfo(ctx context.Context) (*SystemInfo, error)
 	TestConnection(ctx context.Context) error
 }
 
 // client implements the Client interface
 type client struct {
-	httpClient *resty.Client
-	baseURL    string
-	logger     *logging.Logger
+	httpClient      *resty.Client
+	baseURL         string
+	logger          *logging.Logger
+	jobTimeout      time.Duration
+	jobPollInterval time.Duration
+	strictParsing   bool
+	onParseAnomaly  func(endpoint string)
 }
 
+var _ Client = (*client)(nil)
+
 // Config holds TrueNAS client configuration
 type Config struct {
 	URL      string
@@ -35,6 +75,30 @@ type Config struct {
 	Timeout  time.Duration
 	Insecure bool
 	CAFile   string
+	// ProxyURL is an HTTP(S) proxy for TrueNAS requests; empty honors
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+	ProxyURL string
+	// ResolveOverride maps host names to IP addresses dialed in their place;
+	// see TransportOptions.
+	ResolveOverride map[string]string
+	// JobTimeout bounds the wait for a long-running TrueNAS job (0 =
+	// DefaultJobTimeout); JobPollInterval is how often the job is polled
+	// (0 = DefaultJobPollInterval).
+	JobTimeout      time.Duration
+	JobPollInterval time.Duration
+	// Logger receives client logs tagged component=truenas. Nil discards them.
+	Logger *logging.Logger
+	// StrictParsing logs a warning with an excerpt of the raw item when a
+	// pool, dataset or snapshot in a response lacks an expected field;
+	// otherwise these are logged at debug level.
+	StrictParsing bool
+	// OnParseAnomaly, when set, is called with the endpoint (EndpointPools,
+	// EndpointDatasets or EndpointSnapshots) of every item missing an
+	// expected field, whether or not StrictParsing is set.
+	OnParseAnomaly func(endpoint string)
+	// OnReauth, when set, is called with ReauthSucceeded, ReauthFailed or
+	// ReauthBackoff each time a request answered 401 is handled.
+	OnReauth func(result string)
 }
 
 // Volume represents a TrueNAS volume
@@ -46,19 +110,113 @@ type Volume struct {
 	Used        int64             `json:"used"`
 	Available   int64             `json:"available"`
 	Properties  map[string]string `json:"properties"`
-	CreatedAt   time.Time         `json:"created_at"`
+	// UsedBySnapshots is the space only the dataset's snapshots hold, which
+	// destroying all of them frees; 0 when TrueNAS did not report it.
+	UsedBySnapshots int64 `json:"used_by_snapshots"`
+	// CreatedAt is the ZFS creation property of a dataset; zero when TrueNAS
+	// did not report it, so the volume's age is unknown.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Volume types reported in Volume.Type. Datasets keep the type TrueNAS
+// reports (FILESYSTEM or VOLUME); SMB shares converted with
+// SMBShare.AsVolume use VolumeTypeSMB.
+const (
+	VolumeTypeFilesystem = "FILESYSTEM"
+	VolumeTypeZvol       = "VOLUME"
+	VolumeTypeSMB        = "smb"
+)
+
+// SMBShare represents a TrueNAS SMB share
+type SMBShare struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Comment  string `json:"comment"`
+	Enabled  bool   `json:"enabled"`
+	ReadOnly bool   `json:"ro"`
+	Locked   bool   `json:"locked"`
+}
+
+// Dataset returns the dataset name backing the share, derived from its
+// /mnt/<pool>/... path.
+func (s SMBShare) Dataset() string {
+	return strings.TrimPrefix(strings.TrimRight(s.Path, "/"), "/mnt/")
+}
+
+// AsVolume converts the share into a Volume of type VolumeTypeSMB so SMB
+// shares can be correlated with PV volume handles like datasets.
+func (s SMBShare) AsVolume() Volume {
+	return Volume{
+		ID:   strconv.Itoa(s.ID),
+		Name: s.Dataset(),
+		Path: s.Path,
+		Type: VolumeTypeSMB,
+		Properties: map[string]string{
+			"share_name": s.Name,
+			"enabled":    strconv.FormatBool(s.Enabled),
+		},
+	}
+}
+
+// NFSShare represents a TrueNAS NFS share. SCALE reports a single Path;
+// CORE and older SCALE releases report Paths.
+type NFSShare struct {
+	ID       int      `json:"id"`
+	Path     string   `json:"path"`
+	Paths    []string `json:"paths"`
+	Comment  string   `json:"comment"`
+	Enabled  bool     `json:"enabled"`
+	ReadOnly bool     `json:"ro"`
+	Networks []string `json:"networks"`
+	Hosts    []string `json:"hosts"`
+}
+
+// Covers reports whether the share exports path, either directly or through
+// a parent directory.
+func (s NFSShare) Covers(path string) bool {
+	path = strings.TrimRight(path, "/")
+	for _, exported := range append([]string{s.Path}, s.Paths...) {
+		exported = strings.TrimRight(exported, "/")
+		if exported == "" {
+			continue
+		}
+		if path == exported || strings.HasPrefix(path, exported+"/") {
+			return true
+		}
+	}
+	return false
 }
 
+// ErrDatasetNotFound is returned by GetDataset for an unknown dataset.
+var ErrDatasetNotFound = errors.New("dataset not found")
+
 // Snapshot represents a TrueNAS snapshot
 type Snapshot struct {
 	ID        string            `json:"id"`
 	Name      string            `json:"name"`
 	Dataset   string            `json:"dataset"`
 	Used      int64             `json:"used"`
+	// CreatedAt is zero when TrueNAS did not report the creation time.
 	CreatedAt time.Time         `json:"created_at"`
 	Properties map[string]string `json:"properties"`
 }
 
+// Alert represents an entry of the TrueNAS alert subsystem, such as a failed
+// disk, a degraded pool or a failed replication task. Pool is set when the
+// alert refers to a pool.
+type Alert struct {
+	UUID           string    `json:"uuid"`
+	Klass          string    `json:"klass"`
+	Level          string    `json:"level"`
+	Node           string    `json:"node"`
+	Pool           string    `json:"pool,omitempty"`
+	Message        string    `json:"message"`
+	Dismissed      bool      `json:"dismissed"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastOccurrence time.Time `json:"last_occurrence"`
+}
+
 // Pool represents a TrueNAS storage pool
 type Pool struct {
 	ID        string  `json:"id"`
@@ -68,8 +226,37 @@ type Pool struct {
 	Used      int64   `json:"used"`
 	Available int64   `json:"available"`
 	Health    string  `json:"health"`
+	// Healthy is false when ZFS reports the pool degraded or faulted;
+	// nil when TrueNAS did not report it.
+	Healthy      *bool  `json:"healthy,omitempty"`
+	StatusDetail string `json:"status_detail,omitempty"`
+	// IsUpgraded is false when some supported pool features are disabled.
+	IsUpgraded *bool `json:"is_upgraded,omitempty"`
+	// Features lists the pool features when TrueNAS includes them.
+	Features []PoolFeature `json:"features,omitempty"`
+}
+
+// PoolFeature is a ZFS pool feature and its state (ENABLED, ACTIVE or
+// DISABLED).
+type PoolFeature struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
 }
 
+// Dataset properties set from the encryption and readonly fields of the
+// dataset API. Booleans are "true" or "false"; readonly keeps the TrueNAS
+// value ("ON" or "OFF").
+const (
+	PropertyEncrypted      = "encrypted"
+	PropertyKeyLoaded      = "key_loaded"
+	PropertyLocked         = "locked"
+	PropertyEncryptionRoot = "encryption_root"
+	PropertyReadonly       = "readonly"
+	// PropertyOrigin is the snapshot a clone was created from; unset for
+	// datasets that are not clones.
+	PropertyOrigin = "origin"
+)
+
 // SystemInfo represents TrueNAS system information
 type SystemInfo struct {
 	Version   string `json:"version"`
@@ -77,6 +264,32 @@ type SystemInfo struct {
 	Uptime    string `json:"uptime"`
 	LoadAvg   string `json:"loadavg"`
 	Memory    Memory `json:"memory"`
+
+	// AuthMethod and CertificateNotAfter describe the connection the info
+	// was read over rather than TrueNAS itself.
+	AuthMethod string `json:"-"`
+	// CertificateNotAfter is the expiry of the server's certificate; zero
+	// over plain HTTP.
+	CertificateNotAfter time.Time `json:"-"`
+}
+
+// AuthMethodBasic is the SystemInfo.AuthMethod of username and password
+// authentication, the only method the client supports.
+const AuthMethodBasic = "basic"
+
+// Product splits Version, such as "TrueNAS-SCALE-24.04.2", into the product
+// name and its release, "TrueNAS-SCALE" and "24.04.2". A bare release has
+// no product, and a version without a release is all product.
+func (i *SystemInfo) Product() (product, release string) {
+	if i.Version != "" && i.Version[0] >= '0' && i.Version[0] <= '9' {
+		return "", i.Version
+	}
+	for k := 0; k+1 < len(i.Version); k++ {
+		if i.Version[k] == '-' && i.Version[k+1] >= '0' && i.Version[k+1] <= '9' {
+			return i.Version[:k], i.Version[k+1:]
+		}
+	}
+	return i.Version, ""
 }
 
 // Memory represents system memory information
@@ -89,8 +302,9 @@ type Memory struct {
 
 // NewClient creates a new TrueNAS client
 func NewClient(config Config) (Client, error) {
-	if config.URL == "" {
-		return nil, fmt.Errorf("TrueNAS URL is required")
+	baseURL, err := NormalizeURL(config.URL)
+	if err != nil {
+		return nil, err
 	}
 
 	if config.Username == "" {
@@ -114,34 +328,87 @@ func NewClient(config Config) (Client, error) {
 		return nil, fmt.Errorf("failed to configure TLS: %w", err)
 	}
 
+	transport, err := buildTransport(TransportOptions{
+		TLS:             tlsCfg,
+		ProxyURL:        config.ProxyURL,
+		ResolveOverride: config.ResolveOverride,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure transport: %w", err)
+	}
+
+	logger := logging.NewNop()
+	if config.Logger != nil {
+		logger = config.Logger.Component("truenas")
+	}
+
+	jar := newSessionJar()
 	httpClient := resty.New().
-		SetBaseURL(config.URL).
+		SetBaseURL(baseURL).
 		SetBasicAuth(config.Username, config.Password).
 		SetTimeout(timeout).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("Accept", "application/json")
 
-	httpClient.SetTLSClientConfig(tlsCfg)
-
-	// Initialize logger
-	logger, err := logging.NewLogger(logging.Config{
-		Level:       "info",
-		Encoding:    "json",
-		Development: false,
+	httpClient.SetCookieJar(jar)
+	httpClient.SetTransport(&reauthTransport{
+		next:     transport,
+		jar:      jar,
+		logger:   logger,
+		onReauth: config.OnReauth,
+		now:      time.Now,
 	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create logger: %w", err)
+	httpClient.OnBeforeRequest(countRequest)
+	httpClient.OnAfterResponse(traceResponse)
+	httpClient.OnAfterResponse(unavailableResponse)
+	httpClient.OnError(traceError)
+
+	jobTimeout := config.JobTimeout
+	if jobTimeout <= 0 {
+		jobTimeout = DefaultJobTimeout
+	}
+	jobPollInterval := config.JobPollInterval
+	if jobPollInterval <= 0 {
+		jobPollInterval = DefaultJobPollInterval
 	}
 
 	return &client{
-		httpClient: httpClient,
-		baseURL:    config.URL,
-		logger:     logger,
+		httpClient:      httpClient,
+		baseURL:         baseURL,
+		logger:          logger,
+		jobTimeout:      jobTimeout,
+		jobPollInterval: jobPollInterval,
+		strictParsing:   config.StrictParsing,
+		onParseAnomaly:  config.OnParseAnomaly,
 	}, nil
 }
 
 // ListVolumes lists all volumes/datasets with enhanced metadata
 func (c *client) ListVolumes(ctx context.Context) ([]Volume, error) {
+	return c.listVolumes(ctx, nil)
+}
+
+// GetDataset returns a single dataset using a server-side id filter
+func (c *client) GetDataset(ctx context.Context, name string) (*Volume, error) {
+	if err := ValidateIdentifier(name); err != nil {
+		return nil, err
+	}
+	volumes, err := c.listVolumes(ctx, map[string]string{"id": name})
+	if err != nil {
+		return nil, err
+	}
+	for i := range volumes {
+		if volumes[i].ID == name {
+			return &volumes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrDatasetNotFound, name)
+}
+
+// listVolumes lists datasets matching the given query filters
+func (c *client) listVolumes(ctx context.Context, filters map[string]string) ([]Volume, error) {
+	ctx, span := startSpan(ctx, "list datasets")
+	defer span.End()
 	start := time.Now()
 	
 	// TrueNAS API response structure
@@ -156,18 +423,39 @@ func (c *client) ListVolumes(ctx context.Context) ([]Volume, error) {
 		Available struct {
 			Parsed int64 `json:"parsed"`
 		} `json:"available"`
+		UsedBySnapshots struct {
+			Parsed int64 `json:"parsed"`
+		} `json:"usedbysnapshots"`
+		Origin struct {
+			Value string `json:"value"`
+		} `json:"origin"`
 		Mountpoint  string            `json:"mountpoint"`
+		CompressRatio struct {
+			Rawvalue string `json:"rawvalue"`
+		} `json:"compressratio"`
+		Refquota struct {
+			Rawvalue string `json:"rawvalue"`
+		} `json:"refquota"`
+		Creation       zfsTimeProperty `json:"creation"`
+		Encrypted      *bool  `json:"encrypted"`
+		KeyLoaded      *bool  `json:"key_loaded"`
+		Locked         *bool  `json:"locked"`
+		EncryptionRoot string `json:"encryption_root"`
+		Readonly       struct {
+			Value string `json:"value"`
+		} `json:"readonly"`
 		Properties  map[string]interface{} `json:"properties"`
 		Children    []interface{}     `json:"children"`
 	}
 
 	resp, err := c.httpClient.R().
 		SetContext(ctx).
+		SetQueryParams(filters).
 		SetResult(&datasets).
 		Get("/api/v2.0/pool/dataset")
 
 	if err != nil {
-		c.logger.Error("Failed to list TrueNAS datasets", zap.Error(err))
+		c.logger.Error("Failed to list TrueNAS datasets", logging.RedactedError(err))
 		return nil, fmt.Errorf("failed to list volumes: %w", err)
 	}
 
@@ -177,40 +465,59 @@ func (c *client) ListVolumes(ctx context.Context) ([]Volume, error) {
 			zap.String("response", resp.String()))
 		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
 	}
+	c.checkFields(EndpointDatasets, resp.Body(), datasetFields)
 
 	// Transform TrueNAS dataset response to our Volume format
 	var result []Volume
 	for _, dataset := range datasets {
-		// Convert properties map to string map
-		props := make(map[string]string)
-		for k, v := range dataset.Properties {
-			if str, ok := v.(string); ok {
-				props[k] = str
-			} else {
-				props[k] = fmt.Sprintf("%v", v)
-			}
-		}
+		props := flattenProperties(dataset.Properties)
 
 		volume := Volume{
-			ID:         dataset.ID,
-			Name:       dataset.Name,
-			Path:       dataset.Mountpoint,
-			Type:       dataset.Type,
-			Used:       dataset.Used.Parsed,
-			Available:  dataset.Available.Parsed,
-			Properties: props,
-			CreatedAt:  time.Now(), // TrueNAS doesn't provide creation time in this API
+			ID:              dataset.ID,
+			Name:            dataset.Name,
+			Path:            dataset.Mountpoint,
+			Type:            dataset.Type,
+			Used:            dataset.Used.Parsed,
+			Available:       dataset.Available.Parsed,
+			UsedBySnapshots: dataset.UsedBySnapshots.Parsed,
+			Properties:      props,
+			CreatedAt:       dataset.Creation.Time(),
 		}
 
 		// Add pool information if available
 		if dataset.Pool != "" {
 			volume.Properties["pool"] = dataset.Pool
 		}
+		if dataset.CompressRatio.Rawvalue != "" {
+			volume.Properties["compressratio"] = dataset.CompressRatio.Rawvalue
+		}
+		if dataset.Refquota.Rawvalue != "" {
+			volume.Properties["refquota"] = dataset.Refquota.Rawvalue
+		}
+		for key, value := range map[string]*bool{
+			PropertyEncrypted: dataset.Encrypted,
+			PropertyKeyLoaded: dataset.KeyLoaded,
+			PropertyLocked:    dataset.Locked,
+		} {
+			if value != nil {
+				volume.Properties[key] = strconv.FormatBool(*value)
+			}
+		}
+		if dataset.EncryptionRoot != "" {
+			volume.Properties[PropertyEncryptionRoot] = dataset.EncryptionRoot
+		}
+		if dataset.Readonly.Value != "" {
+			volume.Properties[PropertyReadonly] = dataset.Readonly.Value
+		}
+		if dataset.Origin.Value != "" {
+			volume.Properties[PropertyOrigin] = dataset.Origin.Value
+		}
 
 		result = append(result, volume)
 	}
 
 	duration := time.Since(start)
+	span.SetAttributes(tracing.Int("truenas.items", len(result)))
 	c.logger.LogTrueNASOperation("list", "datasets", http.StatusOK, nil)
 	c.logger.Debug("TrueNAS list volumes completed",
 		zap.Int("count", len(result)),
@@ -221,6 +528,21 @@ func (c *client) ListVolumes(ctx context.Context) ([]Volume, error) {
 
 // ListSnapshots lists all snapshots with enhanced metadata
 func (c *client) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	return c.listSnapshots(ctx, nil)
+}
+
+// ListSnapshotsSince lists snapshots created at or after since using a
+// server-side query filter on the creation time.
+func (c *client) ListSnapshotsSince(ctx context.Context, since time.Time) ([]Snapshot, error) {
+	return c.listSnapshots(ctx, map[string]string{
+		"created.parsed__gte": strconv.FormatInt(since.Unix(), 10),
+	})
+}
+
+// listSnapshots lists snapshots matching the given query filters
+func (c *client) listSnapshots(ctx context.Context, filters map[string]string) ([]Snapshot, error) {
+	ctx, span := startSpan(ctx, "list snapshots")
+	defer span.End()
 	start := time.Now()
 	
 	// TrueNAS API response structure for snapshots
@@ -239,11 +561,12 @@ func (c *client) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
 
 	resp, err := c.httpClient.R().
 		SetContext(ctx).
+		SetQueryParams(filters).
 		SetResult(&snapshotData).
 		Get("/api/v2.0/zfs/snapshot")
 
 	if err != nil {
-		c.logger.Error("Failed to list TrueNAS snapshots", zap.Error(err))
+		c.logger.Error("Failed to list TrueNAS snapshots", logging.RedactedError(err))
 		return nil, fmt.Errorf("failed to list snapshots: %w", err)
 	}
 
@@ -253,43 +576,66 @@ func (c *client) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
 			zap.String("response", resp.String()))
 		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
 	}
+	c.checkFields(EndpointSnapshots, resp.Body(), snapshotFields)
 
 	// Transform TrueNAS snapshot response to our Snapshot format
 	var result []Snapshot
 	for _, snap := range snapshotData {
-		// Convert properties map to string map
-		props := make(map[string]string)
-		for k, v := range snap.Properties {
-			if str, ok := v.(string); ok {
-				props[k] = str
-			} else {
-				props[k] = fmt.Sprintf("%v", v)
-			}
-		}
+		props := flattenProperties(snap.Properties)
 
 		snapshot := Snapshot{
 			ID:         snap.ID,
 			Name:       snap.Name,
 			Dataset:    snap.Dataset,
 			Used:       snap.Used.Parsed,
-			CreatedAt:  time.Unix(snap.Created.Parsed, 0),
 			Properties: props,
 		}
+		// A missing creation time stays zero rather than becoming the
+		// Unix epoch, which would make the snapshot look decades old.
+		if snap.Created.Parsed > 0 {
+			snapshot.CreatedAt = time.Unix(snap.Created.Parsed, 0).UTC()
+		}
 
 		result = append(result, snapshot)
 	}
 
 	duration := time.Since(start)
+	span.SetAttributes(tracing.Int("truenas.items", len(result)))
 	c.logger.LogTrueNASOperation("list", "snapshots", http.StatusOK, nil)
 	c.logger.Debug("TrueNAS list snapshots completed",
 		zap.Int("count", len(result)),
+		zap.Bool("filtered", len(filters) > 0),
 		zap.Duration("duration", duration))
 
 	return result, nil
 }
 
+// flattenProperties converts TrueNAS property values to strings. ZFS
+// properties arrive as objects such as {"value": "...", "rawvalue": "..."};
+// their "value" member is used.
+func flattenProperties(properties map[string]interface{}) map[string]string {
+	props := make(map[string]string, len(properties))
+	for k, v := range properties {
+		switch typed := v.(type) {
+		case string:
+			props[k] = typed
+		case map[string]interface{}:
+			if value, ok := typed["value"]; ok && value != nil {
+				props[k] = fmt.Sprintf("%v", value)
+			} else {
+				props[k] = fmt.Sprintf("%v", typed)
+			}
+		default:
+			props[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return props
+}
+
 // ListPools lists all storage pools
 func (c *client) ListPools(ctx context.Context) ([]Pool, error) {
+	ctx, span := startSpan(ctx, "list pools")
+	defer span.End()
 	var pools []Pool
 
 	resp, err := c.httpClient.R().
@@ -298,7 +644,7 @@ func (c *client) ListPools(ctx context.Context) ([]Pool, error) {
 		Get("/api/v2.0/pool")
 
 	if err != nil {
-		c.logger.Error("Failed to list pools", zap.Error(err))
+		c.logger.Error("Failed to list pools", logging.RedactedError(err))
 		return nil, fmt.Errorf("failed to list pools: %w", err)
 	}
 
@@ -308,10 +654,123 @@ func (c *client) ListPools(ctx context.Context) ([]Pool, error) {
 			zap.String("response", resp.String()))
 		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
 	}
+	c.checkFields(EndpointPools, resp.Body(), poolFields)
 
+	span.SetAttributes(tracing.Int("truenas.items", len(pools)))
 	return pools, nil
 }
 
+// GetSMBShares lists SMB shares, including those created by the
+// democratic-csi SMB driver
+func (c *client) GetSMBShares(ctx context.Context) ([]SMBShare, error) {
+	var shares []SMBShare
+
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetResult(&shares).
+		Get("/api/v2.0/sharing/smb")
+
+	if err != nil {
+		c.logger.Error("Failed to list SMB shares", logging.RedactedError(err))
+		return nil, fmt.Errorf("failed to list SMB shares: %w", err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for SMB shares",
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	c.logger.LogTrueNASOperation("list", "sharing/smb", http.StatusOK, nil)
+
+	return shares, nil
+}
+
+// GetNFSShares lists NFS shares, including those created by the
+// democratic-csi NFS driver.
+func (c *client) GetNFSShares(ctx context.Context) ([]NFSShare, error) {
+	var shares []NFSShare
+
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetResult(&shares).
+		Get("/api/v2.0/sharing/nfs")
+
+	if err != nil {
+		c.logger.Error("Failed to list NFS shares", logging.RedactedError(err))
+		return nil, fmt.Errorf("failed to list NFS shares: %w", err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for NFS shares",
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	c.logger.LogTrueNASOperation("list", "sharing/nfs", http.StatusOK, nil)
+
+	return shares, nil
+}
+
+// ListAlerts lists TrueNAS alerts, including dismissed ones
+func (c *client) ListAlerts(ctx context.Context) ([]Alert, error) {
+	type mongoDate struct {
+		Date int64 `json:"$date"`
+	}
+	var alertData []struct {
+		UUID  string `json:"uuid"`
+		Klass string `json:"klass"`
+		Level string `json:"level"`
+		Node  string `json:"node"`
+		Args  struct {
+			Volume interface{} `json:"volume"`
+		} `json:"args"`
+		Formatted      string    `json:"formatted"`
+		Dismissed      bool      `json:"dismissed"`
+		Datetime       mongoDate `json:"datetime"`
+		LastOccurrence mongoDate `json:"last_occurrence"`
+	}
+
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetResult(&alertData).
+		Get("/api/v2.0/alert/list")
+
+	if err != nil {
+		c.logger.Error("Failed to list TrueNAS alerts", logging.RedactedError(err))
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for alerts",
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	alerts := make([]Alert, 0, len(alertData))
+	for _, a := range alertData {
+		pool, _ := a.Args.Volume.(string)
+		alerts = append(alerts, Alert{
+			UUID:           a.UUID,
+			Klass:          a.Klass,
+			Level:          a.Level,
+			Node:           a.Node,
+			Pool:           pool,
+			Message:        a.Formatted,
+			Dismissed:      a.Dismissed,
+			CreatedAt:      time.UnixMilli(a.Datetime.Date),
+			LastOccurrence: time.UnixMilli(a.LastOccurrence.Date),
+		})
+	}
+
+	c.logger.LogTrueNASOperation("list", "alert/list", http.StatusOK, nil)
+
+	return alerts, nil
+}
+
 // GetSystemInfo gets system information
 func (c *client) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
 	var sysInfo SystemInfo
@@ -322,7 +781,7 @@ func (c *client) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
 		Get("/api/v2.0/system/info")
 
 	if err != nil {
-		c.logger.Error("Failed to get system info", zap.Error(err))
+		c.logger.Error("Failed to get system info", logging.RedactedError(err))
 		return nil, fmt.Errorf("failed to get system info: %w", err)
 	}
 
@@ -333,6 +792,10 @@ func (c *client) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
 		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
 	}
 
+	sysInfo.AuthMethod = AuthMethodBasic
+	if raw := resp.RawResponse; raw != nil && raw.TLS != nil && len(raw.TLS.PeerCertificates) > 0 {
+		sysInfo.CertificateNotAfter = raw.TLS.PeerCertificates[0].NotAfter
+	}
 	return &sysInfo, nil
 }
 
@@ -343,7 +806,7 @@ func (c *client) TestConnection(ctx context.Context) error {
 		Get("/api/v2.0/system/info")
 
 	if err != nil {
-		c.logger.Error("Failed to connect to TrueNAS", zap.Error(err))
+		c.logger.Error("Failed to connect to TrueNAS", logging.RedactedError(err))
 		return fmt.Errorf("failed to connect to TrueNAS: %w", err)
 	}
 
@@ -15,6 +15,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
 )
 
 func TestNewClient_requiresURL(t *testing.T) {
@@ -53,7 +55,7 @@ func TestNewClient_defaultTLSIsSecure(t *testing.T) {
 	require.NoError(t, err)
 
 	cl := c.(*client)
-	transport, ok := cl.httpClient.GetClient().Transport.(*http.Transport)
+	transport, ok := cl.httpClient.GetClient().Transport.(*reauthTransport).next.(*http.Transport)
 	require.True(t, ok)
 	require.NotNil(t, transport.TLSClientConfig)
 	assert.False(t, transport.TLSClientConfig.InsecureSkipVerify)
@@ -69,7 +71,7 @@ func TestNewClient_insecureTLS(t *testing.T) {
 	require.NoError(t, err)
 
 	cl := c.(*client)
-	transport, ok := cl.httpClient.GetClient().Transport.(*http.Transport)
+	transport, ok := cl.httpClient.GetClient().Transport.(*reauthTransport).next.(*http.Transport)
 	require.True(t, ok)
 	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
 }
@@ -158,3 +160,225 @@ func writeCACertPEM(t *testing.T, path string, caCert *x509.Certificate) {
 		Bytes: caCert.Raw,
 	}), 0o600))
 }
+
+func TestFlattenProperties(t *testing.T) {
+	props := flattenProperties(map[string]interface{}{
+		"guid":        map[string]interface{}{"value": "1234567890", "rawvalue": "1234567890"},
+		"compression": "lz4",
+		"copies":      float64(1),
+		"opaque":      map[string]interface{}{"source": "LOCAL"},
+	})
+
+	assert.Equal(t, "1234567890", props["guid"])
+	assert.Equal(t, "lz4", props["compression"])
+	assert.Equal(t, "1", props["copies"])
+	assert.Equal(t, "map[source:LOCAL]", props["opaque"])
+}
+
+func TestListSnapshotsSince_sendsCreationFilter(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id":"tank/a@1","name":"tank/a@1","dataset":"tank/a","created":{"parsed":1704067200}}]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	snapshots, err := c.ListSnapshotsSince(context.Background(), time.Unix(1704067200, 0))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, "created.parsed__gte=1704067200", query)
+}
+
+func TestGetSMBShares_decodesScaleResponse(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "smb_shares_scale.json"))
+	require.NoError(t, err)
+
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	shares, err := c.GetSMBShares(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v2.0/sharing/smb", path)
+	require.Len(t, shares, 2)
+
+	share := shares[0]
+	assert.Equal(t, 1, share.ID)
+	assert.Equal(t, "pvc-2f1c8a6e-1b7d-4c1a-9d0e-5a3c2b1f0e9d", share.Name)
+	assert.True(t, share.Enabled)
+	assert.True(t, shares[1].ReadOnly)
+
+	volume := share.AsVolume()
+	assert.Equal(t, VolumeTypeSMB, volume.Type)
+	assert.Equal(t, "1", volume.ID)
+	assert.Equal(t, "tank/k8s/smb/v/pvc-2f1c8a6e-1b7d-4c1a-9d0e-5a3c2b1f0e9d", volume.Name)
+	assert.Equal(t, share.Path, volume.Path)
+	assert.Equal(t, share.Name, volume.Properties["share_name"])
+}
+
+func TestGetNFSShares_decodesScaleResponse(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "nfs_shares_scale.json"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/sharing/nfs", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	shares, err := c.GetNFSShares(context.Background())
+	require.NoError(t, err)
+	require.Len(t, shares, 2)
+
+	assert.True(t, shares[0].Enabled)
+	assert.True(t, shares[0].Covers("/mnt/tank/k8s/nfs/v/pvc-6d0c1f3a-2b4e-4f5a-8c7d-9e0f1a2b3c4d/"))
+	assert.False(t, shares[0].Covers("/mnt/tank/k8s/nfs/v/pvc-6d0c1f3a"))
+	assert.False(t, shares[1].Enabled)
+	assert.True(t, shares[1].Covers("/mnt/tank/legacy/app"))
+	assert.False(t, shares[1].Covers("/mnt/tank/legacy-2"))
+}
+
+func TestGetDataset_filtersByID(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("id")
+		w.Header().Set("Content-Type", "application/json")
+		if query == "tank/k8s/vol-1" {
+			_, _ = w.Write([]byte(`[{"id":"tank/k8s/vol-1","name":"tank/k8s/vol-1","type":"FILESYSTEM","mountpoint":"/mnt/tank/k8s/vol-1"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	dataset, err := c.GetDataset(context.Background(), "tank/k8s/vol-1")
+	require.NoError(t, err)
+	assert.Equal(t, "tank/k8s/vol-1", query)
+	assert.Equal(t, "/mnt/tank/k8s/vol-1", dataset.Path)
+
+	_, err = c.GetDataset(context.Background(), "tank/k8s/renamed")
+	assert.ErrorIs(t, err, ErrDatasetNotFound)
+}
+
+func TestClient_countsRequestsOnContextCounter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	ctx, counter := apiusage.NewContext(context.Background())
+	_, err = c.GetDataset(ctx, "tank/k8s/vol-1")
+	assert.ErrorIs(t, err, ErrDatasetNotFound)
+	_, err = c.ListAlerts(ctx)
+	require.NoError(t, err)
+	// Requests without a counter are not counted.
+	_, err = c.ListAlerts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{apiusage.BackendTrueNAS: 2}, counter.Counts())
+}
+
+func TestGetDataset_decodesEncryptionAndReadonly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id":"tank/k8s","name":"tank/k8s","type":"FILESYSTEM","encrypted":true,"key_loaded":false,"locked":true,"encryption_root":"tank/k8s","readonly":{"value":"OFF"},"usedbysnapshots":{"parsed":4096},"origin":{"value":"tank/base@gold"}}]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	dataset, err := c.GetDataset(context.Background(), "tank/k8s")
+	require.NoError(t, err)
+	assert.Equal(t, "true", dataset.Properties[PropertyEncrypted])
+	assert.Equal(t, "false", dataset.Properties[PropertyKeyLoaded])
+	assert.Equal(t, "true", dataset.Properties[PropertyLocked])
+	assert.Equal(t, "tank/k8s", dataset.Properties[PropertyEncryptionRoot])
+	assert.Equal(t, "OFF", dataset.Properties[PropertyReadonly])
+	assert.Equal(t, int64(4096), dataset.UsedBySnapshots)
+	assert.Equal(t, "tank/base@gold", dataset.Properties[PropertyOrigin])
+}
+
+func TestListAlerts_decodesScaleResponse(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "alert_list_scale.json"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/alert/list", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	alerts, err := c.ListAlerts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, alerts, 3)
+
+	degraded := alerts[1]
+	assert.Equal(t, "6a9e1d27-3f0c-4b8e-a2d5-7c4f8e1b9d30", degraded.UUID)
+	assert.Equal(t, "VolumeStatus", degraded.Klass)
+	assert.Equal(t, "CRITICAL", degraded.Level)
+	assert.Equal(t, "backup", degraded.Pool)
+	assert.Equal(t, "Pool backup state is DEGRADED: One or more devices has been removed.", degraded.Message)
+	assert.Equal(t, time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC), degraded.CreatedAt.UTC())
+	assert.False(t, degraded.Dismissed)
+	assert.True(t, alerts[2].Dismissed)
+}
+
+func TestGetSystemInfo_reportsConnection(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"version": "TrueNAS-SCALE-24.04.2", "hostname": "nas"})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(Config{URL: server.URL, Username: "u", Password: "p", Insecure: true})
+	require.NoError(t, err)
+
+	info, err := client.GetSystemInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, AuthMethodBasic, info.AuthMethod)
+	assert.Equal(t, server.Certificate().NotAfter, info.CertificateNotAfter)
+
+	product, release := info.Product()
+	assert.Equal(t, "TrueNAS-SCALE", product)
+	assert.Equal(t, "24.04.2", release)
+}
+
+func TestSystemInfo_Product(t *testing.T) {
+	for version, want := range map[string][2]string{
+		"TrueNAS-13.0-U6.1":     {"TrueNAS", "13.0-U6.1"},
+		"TrueNAS-SCALE-24.10.0": {"TrueNAS-SCALE", "24.10.0"},
+		"25.04.1":               {"", "25.04.1"},
+		"TrueNAS-SCALE":         {"TrueNAS-SCALE", ""},
+		"":                      {"", ""},
+	} {
+		info := SystemInfo{Version: version}
+		product, release := info.Product()
+		assert.Equal(t, want, [2]string{product, release}, version)
+	}
+}
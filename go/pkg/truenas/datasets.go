@@ -0,0 +1,49 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// DeleteDataset destroys a dataset by name. It is not recursive, so a
+// dataset with children or snapshots fails instead of taking them with it.
+func (c *client) DeleteDataset(ctx context.Context, name string) error {
+	path, err := idPath("pool/dataset", name)
+	if err != nil {
+		return err
+	}
+	ctx, span := startSpan(ctx, "delete dataset")
+	defer span.End()
+	span.SetAttributes(tracing.String("truenas.dataset", name))
+
+	resp, err := c.httpClient.R().SetContext(ctx).Delete(path)
+
+	if err != nil {
+		c.logger.Error("Failed to delete dataset", zap.String("dataset", name), logging.RedactedError(err))
+		return fmt.Errorf("failed to delete dataset %s: %w", name, err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrDatasetNotFound, name)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for dataset delete",
+			zap.String("dataset", name),
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+	if err := c.awaitJob(ctx, resp.Body()); err != nil {
+		c.logger.Error("Dataset delete job did not succeed", zap.String("dataset", name), logging.RedactedError(err))
+		return fmt.Errorf("failed to delete dataset %s: %w", name, err)
+	}
+
+	c.logger.LogTrueNASOperation("delete", "pool/dataset/id/"+name, http.StatusOK, nil)
+	c.logger.Info("Dataset deleted", zap.String("dataset", name))
+	return nil
+}
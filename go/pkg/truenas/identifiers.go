@@ -0,0 +1,95 @@
+package truenas
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidIdentifier is returned for a dataset or snapshot identifier the
+// client refuses to send: empty, or containing control characters.
+var ErrInvalidIdentifier = errors.New("invalid dataset or snapshot identifier")
+
+// Identifier problems reported by IdentifierProblems.
+const (
+	// IdentifierWhitespace is leading, trailing or embedded whitespace.
+	IdentifierWhitespace = "whitespace"
+	// IdentifierUppercase is an uppercase letter: Kubernetes volume names are
+	// lowercase, so such a dataset never matches a CSI handle exactly.
+	IdentifierUppercase = "uppercase"
+	// IdentifierUnsafeCharacter is a character outside a-z, 0-9, "_", "-",
+	// "." and ":".
+	IdentifierUnsafeCharacter = "unsafe_character"
+	// IdentifierEmptyComponent is an empty path component ("tank//k8s").
+	IdentifierEmptyComponent = "empty_component"
+)
+
+// ValidateIdentifier rejects identifiers that cannot be sent to TrueNAS
+// safely. Whitespace and other unusual characters are allowed, since ZFS
+// allows them; IdentifierProblems reports those.
+func ValidateIdentifier(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidIdentifier)
+	}
+	for i, r := range id {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: %q has control character %U at byte %d", ErrInvalidIdentifier, id, r, i)
+		}
+	}
+	return nil
+}
+
+// idPath returns the API path of a resource by ID, e.g.
+// "/api/v2.0/zfs/snapshot/id/tank%2Fk8s%2Fpvc-a@daily". The ID is one path
+// segment, so "/" and spaces are escaped; url.QueryEscape would turn spaces
+// into "+", which TrueNAS reads literally in a path.
+func idPath(resource, id string) (string, error) {
+	if err := ValidateIdentifier(id); err != nil {
+		return "", err
+	}
+	return "/api/v2.0/" + resource + "/id/" + url.PathEscape(id), nil
+}
+
+// IdentifierProblems lists what makes a dataset or snapshot name unsafe for
+// CSI volume handles, sorted and without duplicates. A snapshot name is
+// checked as its dataset and its part after "@". Nil means the name is safe.
+func IdentifierProblems(name string) []string {
+	found := make(map[string]bool)
+	if strings.TrimSpace(name) != name {
+		found[IdentifierWhitespace] = true
+	}
+	dataset, snapshot, isSnapshot := strings.Cut(name, "@")
+	components := strings.Split(dataset, "/")
+	if isSnapshot {
+		components = append(components, snapshot)
+	}
+	for _, component := range components {
+		if component == "" {
+			found[IdentifierEmptyComponent] = true
+			continue
+		}
+		for _, r := range component {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.', r == ':':
+			case r >= 'A' && r <= 'Z':
+				found[IdentifierUppercase] = true
+			case unicode.IsSpace(r):
+				found[IdentifierWhitespace] = true
+			default:
+				found[IdentifierUnsafeCharacter] = true
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	problems := make([]string, 0, len(found))
+	for _, problem := range []string{IdentifierEmptyComponent, IdentifierUnsafeCharacter, IdentifierUppercase, IdentifierWhitespace} {
+		if found[problem] {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,65 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifierProblems(t *testing.T) {
+	tests := map[string][]string{
+		"tank/k8s/pvc-1b2c":            nil,
+		"tank/k8s/pvc-1b2c@daily:01.5": nil,
+		"tank/k8s/pvc-a ":              {IdentifierWhitespace},
+		"tank/k8s/My Data":             {IdentifierUppercase, IdentifierWhitespace},
+		"tank//k8s/pvc-a":              {IdentifierEmptyComponent},
+		"tank/k8s/pvc-a@snap#1":        {IdentifierUnsafeCharacter},
+		"tank/k8s/pvc-%41@Daily":       {IdentifierUnsafeCharacter, IdentifierUppercase},
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, IdentifierProblems(name), name)
+	}
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	require.NoError(t, ValidateIdentifier("tank/k8s/pvc-a "))
+	for _, id := range []string{"", "tank/k8s/pvc-a\n", "tank/k8s/\x00pvc", "tank/k8s/pvc\u0085"} {
+		assert.ErrorIs(t, ValidateIdentifier(id), ErrInvalidIdentifier, "%q", id)
+	}
+}
+
+func TestClient_EscapesIdentifiersAndRejectsControlCharacters(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		paths = append(paths, r.URL.EscapedPath())
+		_, _ = w.Write([]byte(`true`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.DeleteSnapshot(ctx, "tank/k8s/pvc-a @daily+1", DeleteSnapshotOptions{}))
+	require.NoError(t, c.SetDatasetRefquota(ctx, "tank/k8s/pvc a?", 1024))
+	assert.Equal(t, []string{
+		"/api/v2.0/zfs/snapshot/id/tank%2Fk8s%2Fpvc-a%20@daily+1",
+		"/api/v2.0/pool/dataset/id/tank%2Fk8s%2Fpvc%20a%3F",
+	}, paths)
+
+	err = c.DeleteSnapshot(ctx, "tank/k8s/pvc-a\r@daily", DeleteSnapshotOptions{})
+	assert.True(t, errors.Is(err, ErrInvalidIdentifier), "got %v", err)
+	_, err = c.GetDataset(ctx, "tank/k8s/\tpvc")
+	assert.True(t, errors.Is(err, ErrInvalidIdentifier), "got %v", err)
+	assert.Len(t, paths, 2, "invalid identifiers must not reach TrueNAS")
+}
@@ -0,0 +1,156 @@
+package truenas
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+)
+
+// DefaultFullRelistEvery is how many snapshot listings an
+// IncrementalSnapshotClient serves between full re-lists.
+const DefaultFullRelistEvery = 12
+
+// IncrementalOptions configures an IncrementalSnapshotClient.
+type IncrementalOptions struct {
+	// FullRelistEvery forces a full snapshot listing every N calls so
+	// deletions on TrueNAS drop out of the cache. Zero uses
+	// DefaultFullRelistEvery; 1 disables incremental listing.
+	FullRelistEvery int
+	// Clock stamps full listings. Nil uses the real clock.
+	Clock clock.Clock
+}
+
+// SnapshotCacheStats describes the state of an IncrementalSnapshotClient cache.
+type SnapshotCacheStats struct {
+	Size         int
+	Watermark    time.Time
+	LastFullList time.Time
+	Incremental  int
+}
+
+// IncrementalSnapshotClient wraps a Client so ListSnapshots only fetches
+// snapshots created since the newest one seen, merging them into a cached
+// list. Snapshots deleted on TrueNAS stay in the cache until the next full
+// re-list; callers correlating against Kubernetes tolerate that because a
+// stale TrueNAS snapshot only delays orphan reporting by at most
+// FullRelistEvery listings.
+type IncrementalSnapshotClient struct {
+	Client
+
+	fullRelistEvery int
+	clock           clock.Clock
+
+	mu           sync.Mutex
+	cache        []Snapshot
+	index        map[string]int
+	watermark    time.Time
+	lastFullList time.Time
+	sinceFull    int
+}
+
+// NewIncrementalSnapshotClient wraps client with an incremental snapshot cache.
+func NewIncrementalSnapshotClient(client Client, opts IncrementalOptions) *IncrementalSnapshotClient {
+	every := opts.FullRelistEvery
+	if every <= 0 {
+		every = DefaultFullRelistEvery
+	}
+	return &IncrementalSnapshotClient{
+		Client:          client,
+		fullRelistEvery: every,
+		clock:           clock.OrReal(opts.Clock),
+	}
+}
+
+// ListSnapshots returns the cached snapshot list refreshed with snapshots
+// created at or after the watermark, or a full listing when one is due.
+func (c *IncrementalSnapshotClient) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index == nil || c.sinceFull+1 >= c.fullRelistEvery {
+		snapshots, err := c.Client.ListSnapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.cache = nil
+		c.index = make(map[string]int, len(snapshots))
+		c.watermark = time.Time{}
+		c.merge(snapshots)
+		c.lastFullList = c.clock.Now()
+		c.sinceFull = 0
+		return c.snapshot(), nil
+	}
+
+	snapshots, err := c.Client.ListSnapshotsSince(ctx, c.watermark)
+	if err != nil {
+		return nil, err
+	}
+	c.merge(snapshots)
+	c.sinceFull++
+	return c.snapshot(), nil
+}
+
+// DeleteSnapshot deletes the snapshot and drops it from the cache, so
+// deletions made through this client are not reported until the next full
+// re-list.
+func (c *IncrementalSnapshotClient) DeleteSnapshot(ctx context.Context, name string, opts DeleteSnapshotOptions) error {
+	if err := c.Client.DeleteSnapshot(ctx, name, opts); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i, ok := c.index[name]
+	if !ok {
+		return nil
+	}
+	c.cache = append(c.cache[:i], c.cache[i+1:]...)
+	delete(c.index, name)
+	for j := i; j < len(c.cache); j++ {
+		c.index[c.cache[j].Name] = j
+	}
+	return nil
+}
+
+// Invalidate drops the cache so the next listing is a full one.
+func (c *IncrementalSnapshotClient) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = nil
+	c.index = nil
+	c.watermark = time.Time{}
+}
+
+// Stats reports the cache size, watermark and time of the last full listing.
+func (c *IncrementalSnapshotClient) Stats() SnapshotCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return SnapshotCacheStats{
+		Size:         len(c.cache),
+		Watermark:    c.watermark,
+		LastFullList: c.lastFullList,
+		Incremental:  c.sinceFull,
+	}
+}
+
+// merge adds or replaces snapshots by name and advances the watermark.
+// The watermark filter is inclusive, so snapshots created in the same second
+// as the previous newest one are fetched again and deduplicated here.
+func (c *IncrementalSnapshotClient) merge(snapshots []Snapshot) {
+	for _, snapshot := range snapshots {
+		if i, ok := c.index[snapshot.Name]; ok {
+			c.cache[i] = snapshot
+		} else {
+			c.index[snapshot.Name] = len(c.cache)
+			c.cache = append(c.cache, snapshot)
+		}
+		if snapshot.CreatedAt.After(c.watermark) {
+			c.watermark = snapshot.CreatedAt
+		}
+	}
+}
+
+func (c *IncrementalSnapshotClient) snapshot() []Snapshot {
+	return append([]Snapshot{}, c.cache...)
+}
@@ -0,0 +1,139 @@
+package truenas_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func snapshotNames(snapshots []truenas.Snapshot) []string {
+	names := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Name)
+	}
+	return names
+}
+
+func TestIncrementalSnapshotClient_MergesNewSnapshots(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := &truenastest.Client{Snapshots: []truenas.Snapshot{
+		{Name: "tank/a@1", CreatedAt: base},
+		{Name: "tank/a@2", CreatedAt: base.Add(time.Hour)},
+	}}
+	fake := clock.NewFake(base.Add(2 * time.Hour))
+	c := truenas.NewIncrementalSnapshotClient(mock, truenas.IncrementalOptions{FullRelistEvery: 3, Clock: fake})
+	ctx := context.Background()
+
+	first, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tank/a@1", "tank/a@2"}, snapshotNames(first))
+	assert.Equal(t, 1, mock.Calls("ListSnapshots"))
+
+	mock.Snapshots = append(mock.Snapshots, truenas.Snapshot{Name: "tank/a@3", CreatedAt: base.Add(2 * time.Hour)})
+	second, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tank/a@1", "tank/a@2", "tank/a@3"}, snapshotNames(second))
+	assert.Equal(t, 1, mock.Calls("ListSnapshotsSince"))
+
+	stats := c.Stats()
+	assert.Equal(t, 3, stats.Size)
+	assert.Equal(t, base.Add(2*time.Hour), stats.Watermark)
+	assert.Equal(t, base.Add(2*time.Hour), stats.LastFullList)
+	assert.Equal(t, 1, stats.Incremental)
+}
+
+func TestIncrementalSnapshotClient_FullRelistDropsDeletedSnapshots(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := &truenastest.Client{Snapshots: []truenas.Snapshot{
+		{Name: "tank/a@old", CreatedAt: base},
+		{Name: "tank/a@new", CreatedAt: base.Add(time.Hour)},
+	}}
+	c := truenas.NewIncrementalSnapshotClient(mock, truenas.IncrementalOptions{FullRelistEvery: 3})
+	ctx := context.Background()
+
+	_, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+
+	mock.Snapshots = mock.Snapshots[1:]
+	cached, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, snapshotNames(cached), "tank/a@old", "deletions are only seen on a full re-list")
+
+	_, err = c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	relisted, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tank/a@new"}, snapshotNames(relisted))
+	assert.Equal(t, 2, mock.Calls("ListSnapshots"))
+	assert.Equal(t, 2, mock.Calls("ListSnapshotsSince"))
+}
+
+func TestIncrementalSnapshotClient_DeduplicatesSameSecondSnapshots(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := &truenastest.Client{Snapshots: []truenas.Snapshot{{Name: "tank/a@1", CreatedAt: base}}}
+	c := truenas.NewIncrementalSnapshotClient(mock, truenas.IncrementalOptions{})
+	ctx := context.Background()
+
+	_, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	mock.Snapshots = append(mock.Snapshots, truenas.Snapshot{Name: "tank/b@1", CreatedAt: base})
+
+	snapshots, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tank/a@1", "tank/b@1"}, snapshotNames(snapshots))
+}
+
+func TestIncrementalSnapshotClient_ErrorsAndInvalidate(t *testing.T) {
+	mock := &truenastest.Client{Snapshots: []truenas.Snapshot{{Name: "tank/a@1"}}}
+	c := truenas.NewIncrementalSnapshotClient(mock, truenas.IncrementalOptions{})
+	ctx := context.Background()
+
+	_, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+
+	mock.ListSnapshotsErr = errors.New("truenas down")
+	_, err = c.ListSnapshots(ctx)
+	require.Error(t, err)
+
+	mock.ListSnapshotsErr = nil
+	c.Invalidate()
+	_, err = c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, mock.Calls("ListSnapshots"), "invalidate forces a full listing")
+}
+
+func TestIncrementalSnapshotClient_DeleteSnapshotUpdatesCache(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := &truenastest.Client{Snapshots: []truenas.Snapshot{
+		{Name: "tank/a@1", CreatedAt: base},
+		{Name: "tank/a@2", CreatedAt: base.Add(time.Hour)},
+		{Name: "tank/a@3", CreatedAt: base.Add(2 * time.Hour)},
+	}}
+	c := truenas.NewIncrementalSnapshotClient(mock, truenas.IncrementalOptions{FullRelistEvery: 10})
+	ctx := context.Background()
+
+	_, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	require.NoError(t, c.DeleteSnapshot(ctx, "tank/a@1", truenas.DeleteSnapshotOptions{}))
+
+	listed, err := c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tank/a@2", "tank/a@3"}, snapshotNames(listed))
+	assert.Equal(t, 1, mock.Calls("ListSnapshots"))
+
+	// The index follows the shifted cache, so later merges replace in place.
+	require.NoError(t, c.DeleteSnapshot(ctx, "tank/a@2", truenas.DeleteSnapshotOptions{}))
+	listed, err = c.ListSnapshots(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tank/a@3"}, snapshotNames(listed))
+
+	assert.ErrorIs(t, c.DeleteSnapshot(ctx, "tank/a@missing", truenas.DeleteSnapshotOptions{}), truenas.ErrSnapshotNotFound)
+}
@@ -0,0 +1,131 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// DatasetIOGraph is the reporting graph holding per-dataset (and zvol) I/O.
+const DatasetIOGraph = "dataset"
+
+// DatasetIOStats holds the average I/O rates of a dataset over Window.
+type DatasetIOStats struct {
+	Dataset        string        `json:"dataset"`
+	ReadOpsRate    float64       `json:"read_ops_rate"`
+	WriteOpsRate   float64       `json:"write_ops_rate"`
+	ReadBytesRate  float64       `json:"read_bytes_rate"`
+	WriteBytesRate float64       `json:"write_bytes_rate"`
+	Window         time.Duration `json:"window"`
+}
+
+// TotalBytesRate is the combined read and write throughput in bytes/s.
+func (s DatasetIOStats) TotalBytesRate() float64 {
+	return s.ReadBytesRate + s.WriteBytesRate
+}
+
+// reportingGraph is one graph of a reporting/get_data response. Data rows
+// hold one value per legend entry; missing samples are null.
+type reportingGraph struct {
+	Name       string       `json:"name"`
+	Identifier string       `json:"identifier"`
+	Legend     []string     `json:"legend"`
+	Data       [][]*float64 `json:"data"`
+}
+
+// GetDatasetIOStats fetches the average read/write ops and throughput of
+// each dataset over the last window from the TrueNAS reporting API.
+// Datasets without samples are left out.
+func (c *client) GetDatasetIOStats(ctx context.Context, datasets []string, window time.Duration) ([]DatasetIOStats, error) {
+	if len(datasets) == 0 {
+		return nil, nil
+	}
+	ctx, span := startSpan(ctx, "get dataset io stats")
+	defer span.End()
+
+	type graphQuery struct {
+		Name       string `json:"name"`
+		Identifier string `json:"identifier"`
+	}
+	graphs := make([]graphQuery, 0, len(datasets))
+	for _, dataset := range datasets {
+		graphs = append(graphs, graphQuery{Name: DatasetIOGraph, Identifier: dataset})
+	}
+	end := time.Now()
+	body := map[string]interface{}{
+		"graphs": graphs,
+		"query": map[string]interface{}{
+			"start":     end.Add(-window).Unix(),
+			"end":       end.Unix(),
+			"aggregate": false,
+		},
+	}
+
+	var data []reportingGraph
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetBody(body).
+		SetResult(&data).
+		Post("/api/v2.0/reporting/get_data")
+
+	if err != nil {
+		c.logger.Error("Failed to get dataset I/O statistics", logging.RedactedError(err))
+		return nil, fmt.Errorf("failed to get dataset I/O statistics: %w", err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for reporting data",
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	c.logger.LogTrueNASOperation("get", "reporting/get_data", http.StatusOK, nil)
+
+	stats := make([]DatasetIOStats, 0, len(data))
+	for _, graph := range data {
+		if s, ok := graph.ioStats(window); ok {
+			stats = append(stats, s)
+		}
+	}
+	span.SetAttributes(tracing.Int("truenas.datasets", len(datasets)), tracing.Int("truenas.items", len(stats)))
+	return stats, nil
+}
+
+// ioStats averages the read/write ops and bytes columns of the graph.
+func (g reportingGraph) ioStats(window time.Duration) (DatasetIOStats, bool) {
+	stats := DatasetIOStats{Dataset: g.Identifier, Window: window}
+	fields := map[string]*float64{
+		"read_ops":    &stats.ReadOpsRate,
+		"write_ops":   &stats.WriteOpsRate,
+		"read_bytes":  &stats.ReadBytesRate,
+		"write_bytes": &stats.WriteBytesRate,
+	}
+
+	found := false
+	for column, name := range g.Legend {
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var sum float64
+		var samples int
+		for _, row := range g.Data {
+			if column < len(row) && row[column] != nil {
+				sum += *row[column]
+				samples++
+			}
+		}
+		if samples > 0 {
+			*field = sum / float64(samples)
+			found = true
+		}
+	}
+	return stats, found
+}
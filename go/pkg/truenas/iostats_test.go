@@ -0,0 +1,61 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDatasetIOStats_averagesReportingData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/reporting/get_data", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var body struct {
+			Graphs []struct {
+				Name       string `json:"name"`
+				Identifier string `json:"identifier"`
+			} `json:"graphs"`
+			Query struct {
+				Start int64 `json:"start"`
+				End   int64 `json:"end"`
+			} `json:"query"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Len(t, body.Graphs, 2)
+		assert.Equal(t, DatasetIOGraph, body.Graphs[0].Name)
+		assert.Equal(t, "tank/k8s/pvc-a", body.Graphs[0].Identifier)
+		assert.Equal(t, int64(3600), body.Query.End-body.Query.Start)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"name": "dataset", "identifier": "tank/k8s/pvc-a",
+			 "legend": ["time", "read_ops", "write_ops", "read_bytes", "write_bytes"],
+			 "data": [[1717200000, 10, 2, 4096, 1024], [1717200060, 20, null, 8192, 3072]]},
+			{"name": "dataset", "identifier": "tank/k8s/pvc-b",
+			 "legend": ["time", "read_ops", "write_ops", "read_bytes", "write_bytes"],
+			 "data": [[1717200000, null, null, null, null]]}
+		]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	stats, err := c.GetDatasetIOStats(context.Background(), []string{"tank/k8s/pvc-a", "tank/k8s/pvc-b"}, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+
+	assert.Equal(t, "tank/k8s/pvc-a", stats[0].Dataset)
+	assert.Equal(t, 15.0, stats[0].ReadOpsRate)
+	assert.Equal(t, 2.0, stats[0].WriteOpsRate)
+	assert.Equal(t, 6144.0, stats[0].ReadBytesRate)
+	assert.Equal(t, 2048.0, stats[0].WriteBytesRate)
+	assert.Equal(t, time.Hour, stats[0].Window)
+}
@@ -0,0 +1,48 @@
+package truenas
+
+import (
+	"context"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// ISCSISession is an initiator connected to an iSCSI target.
+type ISCSISession struct {
+	Initiator      string `json:"initiator"`
+	InitiatorAlias string `json:"initiator_alias"`
+	InitiatorAddr  string `json:"initiator_addr"`
+	Target         string `json:"target"`
+	TargetAlias    string `json:"target_alias"`
+}
+
+// ISCSIInitiatorGroup is an iSCSI initiator allow-list. A group without
+// initiators allows every initiator.
+type ISCSIInitiatorGroup struct {
+	ID         int      `json:"id"`
+	Initiators []string `json:"initiators"`
+	Comment    string   `json:"comment"`
+}
+
+// ListISCSISessions lists the initiators connected to iSCSI targets
+func (c *client) ListISCSISessions(ctx context.Context) ([]ISCSISession, error) {
+	ctx, span := startSpan(ctx, "list iscsi sessions")
+	defer span.End()
+	var sessions []ISCSISession
+	if err := c.getList(ctx, "iscsi/global/sessions", "iSCSI sessions", &sessions); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.Int("truenas.items", len(sessions)))
+	return sessions, nil
+}
+
+// ListISCSIInitiatorGroups lists the iSCSI initiator allow-lists
+func (c *client) ListISCSIInitiatorGroups(ctx context.Context) ([]ISCSIInitiatorGroup, error) {
+	ctx, span := startSpan(ctx, "list iscsi initiator groups")
+	defer span.End()
+	var groups []ISCSIInitiatorGroup
+	if err := c.getList(ctx, "iscsi/initiator", "iSCSI initiator groups", &groups); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.Int("truenas.items", len(groups)))
+	return groups, nil
+}
@@ -0,0 +1,53 @@
+package truenas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListISCSISessions_decodesScaleResponse(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "iscsi_sessions_scale.json"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/iscsi/global/sessions", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	sessions, err := c.ListISCSISessions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "iqn.1993-08.org.debian:01:worker1", sessions[0].Initiator)
+	assert.Equal(t, "10.0.0.11", sessions[0].InitiatorAddr)
+	assert.Equal(t, "iqn.2005-10.org.freenas.ctl:pvc-6d0c1f3a", sessions[0].Target)
+}
+
+func TestListISCSIInitiatorGroups(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/iscsi/initiator", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id":1,"initiators":["iqn.1993-08.org.debian:01:worker1"],"comment":"k8s"},{"id":2,"initiators":[],"comment":"any"}]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	groups, err := c.ListISCSIInitiatorGroups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []string{"iqn.1993-08.org.debian:01:worker1"}, groups[0].Initiators)
+	assert.Empty(t, groups[1].Initiators)
+}
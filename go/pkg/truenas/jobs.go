@@ -0,0 +1,161 @@
+package truenas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// Default job polling settings, used when Config leaves them zero.
+const (
+	DefaultJobTimeout      = 5 * time.Minute
+	DefaultJobPollInterval = time.Second
+)
+
+// Job states reported by TrueNAS.
+const (
+	JobStateWaiting = "WAITING"
+	JobStateRunning = "RUNNING"
+	JobStateSuccess = "SUCCESS"
+	JobStateFailed  = "FAILED"
+	JobStateAborted = "ABORTED"
+)
+
+// ErrJobTimeout is returned when a job is still running after the job timeout.
+var ErrJobTimeout = errors.New("TrueNAS job did not finish in time")
+
+// Job is a long-running TrueNAS middleware operation. Calls such as
+// recursive deletes answer with a job ID instead of their result.
+type Job struct {
+	ID       int             `json:"id"`
+	Method   string          `json:"method"`
+	State    string          `json:"state"`
+	Error    string          `json:"error,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Progress JobProgress     `json:"progress"`
+}
+
+// JobProgress is the progress a job last reported.
+type JobProgress struct {
+	Percent     float64 `json:"percent"`
+	Description string  `json:"description"`
+}
+
+// Done reports whether the job reached a final state.
+func (j *Job) Done() bool {
+	return j.State == JobStateSuccess || j.State == JobStateFailed || j.State == JobStateAborted
+}
+
+// JobError reports a job that finished in FAILED or ABORTED state.
+type JobError struct {
+	Job Job
+}
+
+func (e *JobError) Error() string {
+	if e.Job.Error == "" {
+		return fmt.Sprintf("TrueNAS job %d (%s) %s", e.Job.ID, e.Job.Method, e.Job.State)
+	}
+	return fmt.Sprintf("TrueNAS job %d (%s) %s: %s", e.Job.ID, e.Job.Method, e.Job.State, e.Job.Error)
+}
+
+// getJob returns the current state of a job.
+func (c *client) getJob(ctx context.Context, id int) (*Job, error) {
+	ctx, span := startSpan(ctx, "get job")
+	defer span.End()
+	span.SetAttributes(tracing.Int("truenas.job_id", id))
+
+	var jobs []Job
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetQueryParam("id", strconv.Itoa(id)).
+		SetResult(&jobs).
+		Get("/api/v2.0/core/get_jobs")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TrueNAS job %d: %w", id, err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+	for i := range jobs {
+		if jobs[i].ID == id {
+			return &jobs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("TrueNAS job %d not found", id)
+}
+
+// waitForJob polls a job until it finishes, the job timeout passes or ctx
+// ends. It returns a *JobError when the job failed or was aborted.
+func (c *client) waitForJob(ctx context.Context, id int) (*Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.jobTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(c.jobPollInterval)
+	defer ticker.Stop()
+	var last *Job
+	for {
+		job, err := c.getJob(ctx, id)
+		if err == nil {
+			last = job
+		}
+		switch {
+		case err == nil && job.Done():
+			c.logger.Debug("TrueNAS job finished",
+				zap.Int("job_id", id), zap.String("method", job.Method), zap.String("state", job.State))
+			if job.State != JobStateSuccess {
+				return job, &JobError{Job: *job}
+			}
+			return job, nil
+		case err != nil && ctx.Err() == nil:
+			c.logger.Warn("Failed to poll TrueNAS job", zap.Int("job_id", id), logging.RedactedError(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && last != nil {
+				return last, fmt.Errorf("%w: job %d (%s) still %s after %s", ErrJobTimeout, id, last.Method, last.State, c.jobTimeout)
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%w: job %d after %s", ErrJobTimeout, id, c.jobTimeout)
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// awaitJob waits for the job whose ID a call answered with. Responses that
+// are not a bare job ID completed synchronously and return nil.
+func (c *client) awaitJob(ctx context.Context, body []byte) error {
+	id, ok := jobID(body)
+	if !ok {
+		return nil
+	}
+	_, err := c.waitForJob(ctx, id)
+	return err
+}
+
+// jobID parses a job-style response: a JSON integer and nothing else.
+// Synchronous calls answer with true, null or an object.
+func jobID(body []byte) (int, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return 0, false
+	}
+	id, err := strconv.Atoi(string(body))
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
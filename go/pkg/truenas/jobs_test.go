@@ -0,0 +1,93 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jobServer answers snapshot deletes with job 42 and reports the job as
+// running for the first polls, then in finalState. The snapshot is gone
+// afterwards.
+func jobServer(t *testing.T, runningPolls int32, finalState, jobError string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodDelete:
+			_, _ = w.Write([]byte("42\n"))
+		case r.URL.Path == "/api/v2.0/core/get_jobs":
+			assert.Equal(t, "42", r.URL.Query().Get("id"))
+			state := JobStateRunning
+			if polls.Add(1) > runningPolls {
+				state = finalState
+			}
+			_, _ = w.Write([]byte(`[{"id": 42, "method": "zfs.snapshot.delete", "state": "` + state + `", "error": "` + jobError + `", "progress": {"percent": 50}}]`))
+		case r.URL.Path == "/api/v2.0/zfs/snapshot":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &polls
+}
+
+func TestDeleteSnapshot_waitsForJob(t *testing.T) {
+	server, polls := jobServer(t, 2, JobStateSuccess, "")
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret", JobPollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	require.NoError(t, c.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@daily-1", DeleteSnapshotOptions{}))
+	assert.Equal(t, int32(3), polls.Load())
+}
+
+func TestDeleteSnapshot_reportsFailedJob(t *testing.T) {
+	server, _ := jobServer(t, 0, JobStateFailed, "[EBUSY] snapshot has dependent clones")
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret", JobPollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	err = c.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@daily-1", DeleteSnapshotOptions{})
+	var jobErr *JobError
+	require.True(t, errors.As(err, &jobErr), "got %v", err)
+	assert.Equal(t, JobStateFailed, jobErr.Job.State)
+	assert.Contains(t, err.Error(), "dependent clones")
+}
+
+func TestDeleteSnapshot_jobTimeout(t *testing.T) {
+	server, _ := jobServer(t, 1<<30, JobStateSuccess, "")
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret",
+		JobTimeout: 20 * time.Millisecond, JobPollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	err = c.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@daily-1", DeleteSnapshotOptions{})
+	assert.True(t, errors.Is(err, ErrJobTimeout), "got %v", err)
+	assert.Contains(t, err.Error(), "still RUNNING")
+}
+
+func TestDeleteSnapshot_jobCancelled(t *testing.T) {
+	server, _ := jobServer(t, 1<<30, JobStateSuccess, "")
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret", JobPollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err = c.DeleteSnapshot(ctx, "tank/k8s/pvc-a@daily-1", DeleteSnapshotOptions{})
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+}
+
+func TestJobID(t *testing.T) {
+	for body, want := range map[string]int{"42": 42, " 7\n": 7, "true": 0, "null": 0, "": 0, `{"id": 3}`: 0, "-1": 0} {
+		id, ok := jobID([]byte(body))
+		assert.Equal(t, want, id, body)
+		assert.Equal(t, want != 0, ok, body)
+	}
+}
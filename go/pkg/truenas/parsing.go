@@ -0,0 +1,123 @@
+package truenas
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// Endpoints whose list responses are checked for missing fields. They are
+// the endpoint label passed to Config.OnParseAnomaly.
+const (
+	EndpointPools     = "pool"
+	EndpointDatasets  = "pool/dataset"
+	EndpointSnapshots = "zfs/snapshot"
+)
+
+// Fields every item of a list response must carry. A dotted name is a
+// member of a nested object, such as the "parsed" value of a ZFS property.
+var (
+	poolFields     = []string{"name", "size"}
+	datasetFields  = []string{"id", "used.parsed", "available.parsed"}
+	snapshotFields = []string{"name", "dataset", "created.parsed"}
+)
+
+// maxPayloadExcerpt bounds the raw item logged with a parse anomaly.
+const maxPayloadExcerpt = 512
+
+// checkFields reports list items of body that lack any of fields. Decoding
+// into structs turns a missing field into a zero value that looks like a
+// real one (a pool of size 0), so presence is checked on the raw payload.
+// Each incomplete item counts as one anomaly; in strict mode it is also
+// logged as a warning with an excerpt of the item.
+func (c *client) checkFields(endpoint string, body []byte, fields []string) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return
+	}
+	for index, item := range items {
+		missing := missingFields(item, fields)
+		if len(missing) == 0 {
+			continue
+		}
+		if c.onParseAnomaly != nil {
+			c.onParseAnomaly(endpoint)
+		}
+		log := c.logger.Debug
+		if c.strictParsing {
+			log = c.logger.Warn
+		}
+		log("TrueNAS response is missing expected fields",
+			zap.String("endpoint", endpoint),
+			zap.Int("index", index),
+			zap.Strings("missing", missing),
+			zap.String("payload", payloadExcerpt(item)))
+	}
+}
+
+// missingFields returns the fields that are absent or null in item.
+func missingFields(item json.RawMessage, fields []string) []string {
+	var missing []string
+	for _, field := range fields {
+		if !hasField(item, strings.Split(field, ".")) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+func hasField(item json.RawMessage, path []string) bool {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(item, &object); err != nil {
+		return false
+	}
+	value, ok := object[path[0]]
+	if !ok || bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	return hasField(value, path[1:])
+}
+
+// payloadExcerpt returns the start of a raw item with secrets redacted.
+func payloadExcerpt(item json.RawMessage) string {
+	excerpt := string(item)
+	if len(excerpt) > maxPayloadExcerpt {
+		excerpt = excerpt[:maxPayloadExcerpt] + "..."
+	}
+	return logging.RedactText(excerpt)
+}
+
+// zfsTimeProperty decodes a ZFS time property such as a dataset's creation:
+// {"rawvalue": "1700000000", "parsed": {"$date": 1700000000000}}.
+type zfsTimeProperty struct {
+	Rawvalue string          `json:"rawvalue"`
+	Parsed   json.RawMessage `json:"parsed"`
+}
+
+// Time returns the property as UTC time, preferring the raw Unix seconds,
+// or zero when the property is absent or unparseable.
+func (p zfsTimeProperty) Time() time.Time {
+	if seconds, err := strconv.ParseInt(p.Rawvalue, 10, 64); err == nil && seconds > 0 {
+		return time.Unix(seconds, 0).UTC()
+	}
+	var date struct {
+		Date int64 `json:"$date"`
+	}
+	if err := json.Unmarshal(p.Parsed, &date); err == nil && date.Date > 0 {
+		return time.UnixMilli(date.Date).UTC()
+	}
+	var seconds int64
+	if err := json.Unmarshal(p.Parsed, &seconds); err == nil && seconds > 0 {
+		return time.Unix(seconds, 0).UTC()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,130 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+func fixtureServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	fixture, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListPools_countsAndLogsMissingFieldsInStrictMode(t *testing.T) {
+	server := fixtureServer(t, "pools_malformed.json")
+	core, logs := observer.New(zap.DebugLevel)
+	anomalies := map[string]int{}
+
+	c, err := NewClient(Config{
+		URL:            server.URL,
+		Username:       "admin",
+		Password:       "secret",
+		Logger:         logging.FromZap(zap.New(core)),
+		StrictParsing:  true,
+		OnParseAnomaly: func(endpoint string) { anomalies[endpoint]++ },
+	})
+	require.NoError(t, err)
+
+	pools, err := c.ListPools(context.Background())
+	require.NoError(t, err)
+	require.Len(t, pools, 3)
+	assert.Equal(t, int64(0), pools[1].Size)
+	assert.Equal(t, map[string]int{EndpointPools: 2}, anomalies)
+
+	warnings := logs.FilterMessage("TrueNAS response is missing expected fields").FilterLevelExact(zap.WarnLevel).All()
+	require.Len(t, warnings, 2)
+	fields := warnings[0].ContextMap()
+	assert.Equal(t, EndpointPools, fields["endpoint"])
+	assert.Equal(t, []interface{}{"size"}, fields["missing"])
+	assert.Contains(t, fields["payload"], `"name": "backup"`)
+}
+
+func TestListVolumes_missingNestedFieldIsDebugWithoutStrictMode(t *testing.T) {
+	server := fixtureServer(t, "datasets_malformed.json")
+	core, logs := observer.New(zap.DebugLevel)
+	anomalies := map[string]int{}
+
+	c, err := NewClient(Config{
+		URL:            server.URL,
+		Username:       "admin",
+		Password:       "secret",
+		Logger:         logging.FromZap(zap.New(core)),
+		OnParseAnomaly: func(endpoint string) { anomalies[endpoint]++ },
+	})
+	require.NoError(t, err)
+
+	volumes, err := c.ListVolumes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, volumes, 2)
+	assert.Equal(t, map[string]int{EndpointDatasets: 1}, anomalies)
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), volumes[0].CreatedAt)
+	assert.True(t, volumes[1].CreatedAt.IsZero())
+
+	entries := logs.FilterMessage("TrueNAS response is missing expected fields").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zap.DebugLevel, entries[0].Level)
+	assert.Equal(t, []interface{}{"used.parsed", "available.parsed"}, entries[0].ContextMap()["missing"])
+}
+
+func TestListSnapshots_missingCreationIsZeroAndCounted(t *testing.T) {
+	server := fixtureServer(t, "snapshots_malformed.json")
+	anomalies := map[string]int{}
+
+	c, err := NewClient(Config{
+		URL:            server.URL,
+		Username:       "admin",
+		Password:       "secret",
+		OnParseAnomaly: func(endpoint string) { anomalies[endpoint]++ },
+	})
+	require.NoError(t, err)
+
+	snapshots, err := c.ListSnapshots(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), snapshots[0].CreatedAt)
+	assert.True(t, snapshots[1].CreatedAt.IsZero())
+	assert.Equal(t, map[string]int{EndpointSnapshots: 1}, anomalies)
+}
+
+func TestPayloadExcerpt_truncatesLongItems(t *testing.T) {
+	item := make([]byte, 2*maxPayloadExcerpt)
+	for i := range item {
+		item[i] = 'x'
+	}
+	excerpt := payloadExcerpt(item)
+	assert.Len(t, excerpt, maxPayloadExcerpt+len("..."))
+}
+
+func TestZFSTimeProperty_Time(t *testing.T) {
+	want := time.Unix(1700000000, 0).UTC()
+	for name, raw := range map[string]string{
+		"rawvalue":     `{"rawvalue": "1700000000", "parsed": null}`,
+		"parsed date":  `{"parsed": {"$date": 1700000000000}}`,
+		"parsed epoch": `{"parsed": 1700000000}`,
+	} {
+		var property zfsTimeProperty
+		require.NoError(t, json.Unmarshal([]byte(raw), &property), name)
+		assert.Equal(t, want, property.Time(), name)
+	}
+	assert.True(t, zfsTimeProperty{}.Time().IsZero())
+}
@@ -0,0 +1,53 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// SetDatasetRefquota sets the refquota of a dataset in bytes. A refquota
+// limits the space the dataset itself can reference, excluding snapshots and
+// descendants; 0 removes the limit.
+func (c *client) SetDatasetRefquota(ctx context.Context, name string, refquota int64) error {
+	if refquota < 0 {
+		return fmt.Errorf("invalid refquota %d for dataset %s: must not be negative", refquota, name)
+	}
+	path, err := idPath("pool/dataset", name)
+	if err != nil {
+		return err
+	}
+	ctx, span := startSpan(ctx, "set refquota")
+	defer span.End()
+	span.SetAttributes(tracing.String("truenas.dataset", name))
+
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetBody(map[string]interface{}{"refquota": refquota}).
+		Put(path)
+
+	if err != nil {
+		c.logger.Error("Failed to set dataset refquota", zap.String("dataset", name), logging.RedactedError(err))
+		return fmt.Errorf("failed to set refquota of dataset %s: %w", name, err)
+	}
+
+	if resp.StatusCode() == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrDatasetNotFound, name)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for dataset update",
+			zap.String("dataset", name),
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	c.logger.LogTrueNASOperation("update", "pool/dataset/id/"+name, http.StatusOK, nil)
+	c.logger.Info("Dataset refquota set", zap.String("dataset", name), zap.Int64("refquota", refquota))
+	return nil
+}
@@ -0,0 +1,64 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDatasetRefquota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/api/v2.0/pool/dataset/id/tank%2Fk8s%2Fmissing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/api/v2.0/pool/dataset/id/tank%2Fk8s%2Fpvc-a", r.URL.EscapedPath())
+
+		var body map[string]int64
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]int64{"refquota": 11 << 30}, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "tank/k8s/pvc-a", "refquota": {"rawvalue": "11811160064"}}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetDatasetRefquota(context.Background(), "tank/k8s/pvc-a", 11<<30))
+
+	err = c.SetDatasetRefquota(context.Background(), "tank/k8s/missing", 1<<30)
+	assert.True(t, errors.Is(err, ErrDatasetNotFound), "got %v", err)
+
+	assert.Error(t, c.SetDatasetRefquota(context.Background(), "tank/k8s/pvc-a", -1))
+}
+
+func TestListVolumes_exposesRefquota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"id": "tank/k8s/pvc-a", "name": "tank/k8s/pvc-a", "type": "FILESYSTEM",
+			 "refquota": {"parsed": 10737418240, "rawvalue": "10737418240"}},
+			{"id": "tank/k8s/pvc-b", "name": "tank/k8s/pvc-b", "type": "FILESYSTEM",
+			 "refquota": {"parsed": null, "rawvalue": "0"}}
+		]`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	volumes, err := c.ListVolumes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, volumes, 2)
+	assert.Equal(t, "10737418240", volumes[0].Properties["refquota"])
+	assert.Equal(t, "0", volumes[1].Properties["refquota"])
+}
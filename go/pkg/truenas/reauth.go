@@ -0,0 +1,172 @@
+package truenas
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// Re-authentication results passed to Config.OnReauth.
+const (
+	// ReauthSucceeded: the request was retried with fresh credentials and
+	// did not return 401.
+	ReauthSucceeded = "succeeded"
+	// ReauthFailed: the retried request returned 401 again.
+	ReauthFailed = "failed"
+	// ReauthBackoff: earlier re-authentications failed, so the 401 was
+	// returned without a retry.
+	ReauthBackoff = "backoff"
+)
+
+// Backoff between re-authentications after failed ones: it doubles per
+// consecutive failure up to the maximum.
+const (
+	reauthBackoffBase = 30 * time.Second
+	reauthBackoffMax  = 10 * time.Minute
+)
+
+// sessionJar is the client's cookie jar. TrueNAS may tie a session cookie
+// to the credentials; Reset drops it so the next request authenticates
+// afresh.
+type sessionJar struct {
+	mu  sync.Mutex
+	jar *cookiejar.Jar
+}
+
+func newSessionJar() *sessionJar {
+	jar, _ := cookiejar.New(nil) // fails only with invalid options
+	return &sessionJar{jar: jar}
+}
+
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+}
+
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// Reset drops every cookie.
+func (j *sessionJar) Reset() {
+	jar, _ := cookiejar.New(nil)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar = jar
+}
+
+// reauthTransport retries a request once when TrueNAS answers 401, after
+// dropping the session cookies, so a session TrueNAS invalidated does not
+// fail every call until restart. Basic auth credentials are sent with
+// every request, so the retry authenticates afresh. When the retry is
+// rejected too, further retries back off.
+type reauthTransport struct {
+	next     http.RoundTripper
+	jar      *sessionJar
+	logger   *logging.Logger
+	onReauth func(result string)
+	now      func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	until    time.Time
+}
+
+func (t *reauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	if wait := t.backoff(); wait > 0 {
+		t.record(ReauthBackoff)
+		t.logger.Debug("TrueNAS rejected the credentials; re-authentication is backing off",
+			zap.String("path", req.URL.Path),
+			zap.Duration("retry_in", wait))
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	retry.Header.Del("Cookie")
+	t.jar.Reset()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	apiusage.Add(req.Context(), apiusage.BackendTrueNAS)
+	resp, err = t.next.RoundTrip(retry)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		failures, wait := t.failed()
+		t.record(ReauthFailed)
+		t.logger.Error("TrueNAS rejected the credentials after re-authentication; check truenas.username and truenas.password",
+			zap.String("path", req.URL.Path),
+			zap.Int("consecutive_failures", failures),
+			zap.Duration("retry_in", wait))
+		return resp, nil
+	}
+	t.succeeded()
+	t.record(ReauthSucceeded)
+	t.logger.Info("Re-authenticated with TrueNAS after a 401",
+		zap.String("path", req.URL.Path))
+	return resp, nil
+}
+
+// backoff returns how long re-authentication must still wait.
+func (t *reauthTransport) backoff() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if wait := t.until.Sub(t.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// failed records a failed re-authentication and returns the consecutive
+// failures and the backoff it started.
+func (t *reauthTransport) failed() (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures++
+	wait := reauthBackoffBase
+	for i := 1; i < t.failures && wait < reauthBackoffMax; i++ {
+		wait *= 2
+	}
+	wait = min(wait, reauthBackoffMax)
+	t.until = t.now().Add(wait)
+	return t.failures, wait
+}
+
+func (t *reauthTransport) succeeded() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = 0
+	t.until = time.Time{}
+}
+
+func (t *reauthTransport) record(result string) {
+	if t.onReauth != nil {
+		t.onReauth(result)
+	}
+}
@@ -0,0 +1,69 @@
+package truenas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_reauthenticatesOnceWhenSessionIsInvalidated(t *testing.T) {
+	var sessions atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first session is invalidated server-side after one request.
+		cookie, err := r.Cookie("session")
+		if err == nil && cookie.Value == "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(int(sessions.Add(1))), Path: "/"})
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var results []string
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret", OnReauth: func(result string) { results = append(results, result) }})
+	require.NoError(t, err)
+
+	require.NoError(t, c.TestConnection(context.Background()))
+	require.NoError(t, c.TestConnection(context.Background()))
+	require.NoError(t, c.TestConnection(context.Background()))
+	assert.Equal(t, []string{ReauthSucceeded}, results)
+	assert.Equal(t, int32(2), sessions.Load())
+}
+
+func TestClient_reauthBacksOffWhenCredentialsAreRejected(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var results []string
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "wrong", OnReauth: func(result string) { results = append(results, result) }})
+	require.NoError(t, err)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	transport := c.(*client).httpClient.GetClient().Transport.(*reauthTransport)
+	transport.now = func() time.Time { return now }
+
+	require.Error(t, c.TestConnection(context.Background()))
+	assert.Equal(t, int32(2), hits.Load(), "the 401 is retried once")
+
+	require.Error(t, c.TestConnection(context.Background()))
+	assert.Equal(t, int32(3), hits.Load(), "no retry during the backoff")
+
+	now = now.Add(reauthBackoffBase)
+	require.Error(t, c.TestConnection(context.Background()))
+	assert.Equal(t, int32(5), hits.Load(), "retried again after the backoff")
+	assert.Equal(t, []string{ReauthFailed, ReauthBackoff, ReauthFailed}, results)
+	assert.Equal(t, 2*reauthBackoffBase, transport.backoff(), "the backoff doubles")
+}
@@ -0,0 +1,203 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+var (
+	// ErrSnapshotNotFound is returned by DeleteSnapshot for an unknown
+	// snapshot.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrNotDeleted is returned by DeleteSnapshot when TrueNAS accepted the
+	// delete but the snapshot is still listed afterwards, e.g. a deferred
+	// destroy of a snapshot with holds or clones.
+	ErrNotDeleted = errors.New("snapshot still exists after delete")
+)
+
+// DeleteSnapshotOptions are the zfs.snapshot.delete options sent in the
+// request body. The zero value sends no body.
+type DeleteSnapshotOptions struct {
+	// Defer marks a snapshot with holds or clones for deferred destroy
+	// instead of failing; ZFS destroys it once they are released.
+	Defer bool
+	// Recursive also destroys the snapshots of the same name on child
+	// datasets.
+	Recursive bool
+}
+
+func (o DeleteSnapshotOptions) body() map[string]bool {
+	body := make(map[string]bool)
+	if o.Defer {
+		body["defer"] = true
+	}
+	if o.Recursive {
+		body["recursive"] = true
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	return body
+}
+
+// DeleteSnapshot destroys a ZFS snapshot by its full name, e.g.
+// "tank/k8s/pvc-a@daily-1". TrueNAS may accept the delete as a job; the
+// job is then awaited so a failed delete is not reported as done. The
+// snapshot is then looked up again, and ErrNotDeleted is returned if it is
+// still listed.
+func (c *client) DeleteSnapshot(ctx context.Context, name string, opts DeleteSnapshotOptions) error {
+	path, err := idPath("zfs/snapshot", name)
+	if err != nil {
+		return err
+	}
+	ctx, span := startSpan(ctx, "delete snapshot")
+	defer span.End()
+	span.SetAttributes(tracing.String("truenas.snapshot", name))
+
+	req := c.httpClient.R().SetContext(ctx)
+	if body := opts.body(); body != nil {
+		req.SetBody(body)
+	}
+	resp, err := req.Delete(path)
+
+	if err != nil {
+		c.logger.Error("Failed to delete snapshot", zap.String("snapshot", name), logging.RedactedError(err))
+		return fmt.Errorf("failed to delete snapshot %s: %w", name, err)
+	}
+
+	if resp.StatusCode() == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for snapshot delete",
+			zap.String("snapshot", name),
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+	if err := c.awaitJob(ctx, resp.Body()); err != nil {
+		c.logger.Error("Snapshot delete job did not succeed", zap.String("snapshot", name), logging.RedactedError(err))
+		return fmt.Errorf("failed to delete snapshot %s: %w", name, err)
+	}
+
+	remaining, err := c.listSnapshots(ctx, map[string]string{"id": name})
+	if err != nil {
+		return fmt.Errorf("failed to verify deletion of snapshot %s: %w", name, err)
+	}
+	if len(remaining) > 0 {
+		c.logger.Warn("Snapshot still exists after delete",
+			zap.String("snapshot", name),
+			zap.Bool("defer", opts.Defer))
+		if opts.Defer {
+			return fmt.Errorf("%w: %s (destroy deferred until holds and clones are released)", ErrNotDeleted, name)
+		}
+		return fmt.Errorf("%w: %s", ErrNotDeleted, name)
+	}
+
+	c.logger.LogTrueNASOperation("delete", "zfs/snapshot/id/"+name, http.StatusOK, nil)
+	c.logger.Info("Snapshot deleted", zap.String("snapshot", name))
+	return nil
+}
+
+// CreateSnapshot takes a ZFS snapshot called name of dataset, e.g. dataset
+// "tank/canary" and name "restore-canary-1" for
+// "tank/canary@restore-canary-1".
+func (c *client) CreateSnapshot(ctx context.Context, dataset, name string) (*Snapshot, error) {
+	full := dataset + "@" + name
+	if err := ValidateIdentifier(full); err != nil {
+		return nil, err
+	}
+	ctx, span := startSpan(ctx, "create snapshot")
+	defer span.End()
+	span.SetAttributes(tracing.String("truenas.snapshot", full))
+
+	var created struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		Dataset string `json:"dataset"`
+	}
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetBody(map[string]string{"dataset": dataset, "name": name}).
+		SetResult(&created).
+		Post("/api/v2.0/zfs/snapshot")
+
+	if err != nil {
+		c.logger.Error("Failed to create snapshot", zap.String("snapshot", full), logging.RedactedError(err))
+		return nil, fmt.Errorf("failed to create snapshot %s: %w", full, err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrDatasetNotFound, dataset)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for snapshot create",
+			zap.String("snapshot", full),
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return nil, fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	snapshot := &Snapshot{ID: created.ID, Name: created.Name, Dataset: created.Dataset, CreatedAt: time.Now().UTC()}
+	if snapshot.ID == "" {
+		snapshot.ID = full
+	}
+	if snapshot.Name == "" {
+		snapshot.Name = full
+	}
+	if snapshot.Dataset == "" {
+		snapshot.Dataset = dataset
+	}
+	c.logger.LogTrueNASOperation("create", "zfs/snapshot", http.StatusOK, nil)
+	c.logger.Info("Snapshot created", zap.String("snapshot", full))
+	return snapshot, nil
+}
+
+// CloneSnapshot clones snapshot, a full name such as
+// "tank/canary@restore-canary-1", to the new dataset dataset.
+func (c *client) CloneSnapshot(ctx context.Context, snapshot, dataset string) error {
+	if err := ValidateIdentifier(snapshot); err != nil {
+		return err
+	}
+	if err := ValidateIdentifier(dataset); err != nil {
+		return err
+	}
+	ctx, span := startSpan(ctx, "clone snapshot")
+	defer span.End()
+	span.SetAttributes(tracing.String("truenas.snapshot", snapshot), tracing.String("truenas.dataset", dataset))
+
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetBody(map[string]string{"snapshot": snapshot, "dataset_dst": dataset}).
+		Post("/api/v2.0/zfs/snapshot/clone")
+
+	if err != nil {
+		c.logger.Error("Failed to clone snapshot", zap.String("snapshot", snapshot), logging.RedactedError(err))
+		return fmt.Errorf("failed to clone snapshot %s to %s: %w", snapshot, dataset, err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, snapshot)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for snapshot clone",
+			zap.String("snapshot", snapshot),
+			zap.String("dataset", dataset),
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+	if err := c.awaitJob(ctx, resp.Body()); err != nil {
+		return fmt.Errorf("failed to clone snapshot %s to %s: %w", snapshot, dataset, err)
+	}
+
+	c.logger.LogTrueNASOperation("clone", "zfs/snapshot/clone", http.StatusOK, nil)
+	c.logger.Info("Snapshot cloned", zap.String("snapshot", snapshot), zap.String("dataset", dataset))
+	return nil
+}
@@ -0,0 +1,170 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotServer deletes the snapshots in existing on DELETE and lists the
+// remaining ones on GET /api/v2.0/zfs/snapshot?id=. Snapshots in sticky are
+// accepted for delete but stay listed. Delete bodies are kept by name.
+func snapshotServer(t *testing.T, existing, sticky []string) (*httptest.Server, map[string]string) {
+	t.Helper()
+	present := make(map[string]bool)
+	for _, name := range append(existing, sticky...) {
+		present[name] = true
+	}
+	stays := make(map[string]bool)
+	for _, name := range sticky {
+		stays[name] = true
+	}
+	bodies := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet && r.URL.Path == "/api/v2.0/zfs/snapshot" {
+			id := r.URL.Query().Get("id")
+			if !present[id] {
+				_, _ = w.Write([]byte(`[]`))
+				return
+			}
+			data, _ := json.Marshal([]map[string]string{{"id": id, "name": id}})
+			_, _ = w.Write(data)
+			return
+		}
+		assert.Equal(t, http.MethodDelete, r.Method)
+		escaped, ok := strings.CutPrefix(r.URL.EscapedPath(), "/api/v2.0/zfs/snapshot/id/")
+		require.True(t, ok, r.URL.EscapedPath())
+		assert.NotContains(t, escaped, "/", "the snapshot name must be a single path segment")
+		name, err := url.PathUnescape(escaped)
+		require.NoError(t, err)
+		if !present[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies[name] = string(body)
+		if !stays[name] {
+			delete(present, name)
+		}
+		_, _ = w.Write([]byte(`true`))
+	}))
+	t.Cleanup(server.Close)
+	return server, bodies
+}
+
+func TestDeleteSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		assert.Equal(t, http.MethodDelete, r.Method)
+		switch r.URL.EscapedPath() {
+		case "/api/v2.0/zfs/snapshot/id/tank%2Fk8s%2Fpvc-a@daily-1":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`true`))
+		case "/api/v2.0/zfs/snapshot/id/tank%2Fk8s%2Fpvc-a@gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message": "snapshot has dependent clones"}`))
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	require.NoError(t, c.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@daily-1", DeleteSnapshotOptions{}))
+
+	err = c.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@gone", DeleteSnapshotOptions{})
+	assert.True(t, errors.Is(err, ErrSnapshotNotFound), "got %v", err)
+
+	err = c.DeleteSnapshot(context.Background(), "tank/k8s/pvc-a@cloned", DeleteSnapshotOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dependent clones")
+}
+
+func TestDeleteSnapshot_escapesNestedDatasetsAndSpecialCharacters(t *testing.T) {
+	names := []string{
+		"tank/a/b/c/pvc-x@auto-2026-10-16_00-00",
+		"tank/k8s/nested/pvc-y@auto 2026+1",
+		"tank/k8s/pvc-z@snap%41#frag?q=1&x",
+		"pool/a b/c;d@ünïcode",
+	}
+	server, bodies := snapshotServer(t, names, nil)
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	for _, name := range names {
+		require.NoError(t, c.DeleteSnapshot(context.Background(), name, DeleteSnapshotOptions{}), name)
+		assert.Empty(t, bodies[name], "no options means no body")
+	}
+	err = c.DeleteSnapshot(context.Background(), names[0], DeleteSnapshotOptions{})
+	assert.True(t, errors.Is(err, ErrSnapshotNotFound), "got %v", err)
+}
+
+func TestDeleteSnapshot_sendsOptionsAndVerifiesDeletion(t *testing.T) {
+	server, bodies := snapshotServer(t, []string{"tank/k8s/pvc-a@daily"}, []string{"tank/k8s/pvc-b@held"})
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.DeleteSnapshot(ctx, "tank/k8s/pvc-a@daily", DeleteSnapshotOptions{Recursive: true}))
+	assert.JSONEq(t, `{"recursive": true}`, bodies["tank/k8s/pvc-a@daily"])
+
+	err = c.DeleteSnapshot(ctx, "tank/k8s/pvc-b@held", DeleteSnapshotOptions{Defer: true})
+	assert.True(t, errors.Is(err, ErrNotDeleted), "got %v", err)
+	assert.Contains(t, err.Error(), "deferred")
+	assert.JSONEq(t, `{"defer": true}`, bodies["tank/k8s/pvc-b@held"])
+}
+
+func TestCreateCloneAndDeleteDataset(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath()+" "+string(body))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/v2.0/zfs/snapshot":
+			_, _ = w.Write([]byte(`{"id": "tank/canary@rc-1", "name": "tank/canary@rc-1", "dataset": "tank/canary"}`))
+		case "/api/v2.0/zfs/snapshot/clone":
+			_, _ = w.Write([]byte(`true`))
+		case "/api/v2.0/pool/dataset/id/tank%2Fcanary-rc-1":
+			_, _ = w.Write([]byte(`true`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	snapshot, err := c.CreateSnapshot(ctx, "tank/canary", "rc-1")
+	require.NoError(t, err)
+	assert.Equal(t, "tank/canary@rc-1", snapshot.Name)
+	assert.Equal(t, "tank/canary", snapshot.Dataset)
+
+	require.NoError(t, c.CloneSnapshot(ctx, "tank/canary@rc-1", "tank/canary-rc-1"))
+	require.NoError(t, c.DeleteDataset(ctx, "tank/canary-rc-1"))
+
+	err = c.DeleteDataset(ctx, "tank/gone")
+	assert.True(t, errors.Is(err, ErrDatasetNotFound), "got %v", err)
+
+	require.Len(t, requests, 4)
+	assert.Equal(t, `POST /api/v2.0/zfs/snapshot {"dataset":"tank/canary","name":"rc-1"}`, requests[0])
+	assert.Equal(t, `POST /api/v2.0/zfs/snapshot/clone {"dataset_dst":"tank/canary-rc-1","snapshot":"tank/canary@rc-1"}`, requests[1])
+	assert.Equal(t, "DELETE /api/v2.0/pool/dataset/id/tank%2Fcanary-rc-1 ", requests[2])
+}
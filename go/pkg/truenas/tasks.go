@@ -0,0 +1,236 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// Replication task directions.
+const (
+	ReplicationPush = "PUSH"
+	ReplicationPull = "PULL"
+)
+
+// PeriodicSnapshotTask is a TrueNAS periodic snapshot task. NamingSchema is
+// a strftime pattern such as "auto-%Y-%m-%d_%H-%M".
+type PeriodicSnapshotTask struct {
+	ID           int      `json:"id"`
+	Dataset      string   `json:"dataset"`
+	Recursive    bool     `json:"recursive"`
+	Exclude      []string `json:"exclude"`
+	NamingSchema string   `json:"naming_schema"`
+	Enabled      bool     `json:"enabled"`
+}
+
+// ReplicationTask is a TrueNAS replication task. Push tasks send snapshots
+// of SourceDatasets taken by PeriodicSnapshotTasks or matching
+// AlsoIncludeNamingSchema; pull tasks receive snapshots matching
+// NamingSchema into TargetDataset. NameRegex replaces naming schemas when set.
+type ReplicationTask struct {
+	ID                      int                    `json:"id"`
+	Name                    string                 `json:"name"`
+	Direction               string                 `json:"direction"`
+	Transport               string                 `json:"transport"`
+	SourceDatasets          []string               `json:"source_datasets"`
+	TargetDataset           string                 `json:"target_dataset"`
+	Recursive               bool                   `json:"recursive"`
+	Exclude                 []string               `json:"exclude"`
+	PeriodicSnapshotTasks   []PeriodicSnapshotTask `json:"periodic_snapshot_tasks"`
+	NamingSchema            []string               `json:"naming_schema"`
+	AlsoIncludeNamingSchema []string               `json:"also_include_naming_schema"`
+	NameRegex               string                 `json:"name_regex"`
+	Enabled                 bool                   `json:"enabled"`
+}
+
+// ListSnapshotTasks lists periodic snapshot tasks
+func (c *client) ListSnapshotTasks(ctx context.Context) ([]PeriodicSnapshotTask, error) {
+	ctx, span := startSpan(ctx, "list snapshot tasks")
+	defer span.End()
+	var tasks []PeriodicSnapshotTask
+	if err := c.getList(ctx, "pool/snapshottask", "periodic snapshot tasks", &tasks); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.Int("truenas.items", len(tasks)))
+	return tasks, nil
+}
+
+// ListReplicationTasks lists replication tasks
+func (c *client) ListReplicationTasks(ctx context.Context) ([]ReplicationTask, error) {
+	ctx, span := startSpan(ctx, "list replication tasks")
+	defer span.End()
+	var tasks []ReplicationTask
+	if err := c.getList(ctx, "replication", "replication tasks", &tasks); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.Int("truenas.items", len(tasks)))
+	return tasks, nil
+}
+
+// getList decodes a GET of /api/v2.0/<resource> into result; what names the
+// resource in logs and errors.
+func (c *client) getList(ctx context.Context, resource, what string, result interface{}) error {
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetResult(result).
+		Get("/api/v2.0/" + resource)
+
+	if err != nil {
+		c.logger.Error("Failed to list TrueNAS "+what, logging.RedactedError(err))
+		return fmt.Errorf("failed to list %s: %w", what, err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		c.logger.Error("TrueNAS API returned error status for "+what,
+			zap.Int("status_code", resp.StatusCode()),
+			zap.String("response", resp.String()))
+		return fmt.Errorf("TrueNAS API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	c.logger.LogTrueNASOperation("list", resource, http.StatusOK, nil)
+	return nil
+}
+
+// taskScope is a dataset tree whose snapshots matching names are created or
+// received by a TrueNAS task.
+type taskScope struct {
+	dataset   string
+	recursive bool
+	exclude   []string
+	names     []*regexp.Regexp
+}
+
+func (s taskScope) matches(dataset, name string) bool {
+	if dataset != s.dataset && !(s.recursive && strings.HasPrefix(dataset, s.dataset+"/")) {
+		return false
+	}
+	for _, excluded := range s.exclude {
+		if dataset == excluded || strings.HasPrefix(dataset, excluded+"/") {
+			return false
+		}
+	}
+	for _, pattern := range s.names {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ManagedSnapshots recognizes snapshots created by TrueNAS periodic
+// snapshot tasks or received by replication tasks, which are pruned by
+// TrueNAS retention rather than by Kubernetes.
+type ManagedSnapshots struct {
+	scopes []taskScope
+}
+
+// NewManagedSnapshots derives the dataset scopes and naming schemas managed
+// by the given tasks. Disabled tasks are included because the snapshots they
+// created before being disabled still follow their naming schema.
+func NewManagedSnapshots(periodic []PeriodicSnapshotTask, replication []ReplicationTask) *ManagedSnapshots {
+	managed := &ManagedSnapshots{}
+	for _, task := range periodic {
+		managed.add(task.Dataset, task.Recursive, task.Exclude, []string{task.NamingSchema}, "")
+	}
+	for _, task := range replication {
+		schemas := append([]string{}, task.NamingSchema...)
+		switch task.Direction {
+		case ReplicationPull:
+			// Received snapshots keep the source names below the target.
+			managed.add(task.TargetDataset, true, nil, schemas, task.NameRegex)
+		default:
+			schemas = append(schemas, task.AlsoIncludeNamingSchema...)
+			for _, periodicTask := range task.PeriodicSnapshotTasks {
+				schemas = append(schemas, periodicTask.NamingSchema)
+			}
+			for _, source := range task.SourceDatasets {
+				managed.add(source, task.Recursive, task.Exclude, schemas, task.NameRegex)
+			}
+			if task.Transport == "LOCAL" {
+				managed.add(task.TargetDataset, true, nil, schemas, task.NameRegex)
+			}
+		}
+	}
+	return managed
+}
+
+func (m *ManagedSnapshots) add(dataset string, recursive bool, exclude, schemas []string, nameRegex string) {
+	if dataset == "" {
+		return
+	}
+	scope := taskScope{dataset: dataset, recursive: recursive, exclude: exclude}
+	if nameRegex != "" {
+		if pattern, err := regexp.Compile("^(?:" + nameRegex + ")$"); err == nil {
+			scope.names = append(scope.names, pattern)
+		}
+	} else {
+		for _, schema := range schemas {
+			if schema != "" {
+				scope.names = append(scope.names, namingSchemaRegexp(schema))
+			}
+		}
+	}
+	if len(scope.names) > 0 {
+		m.scopes = append(m.scopes, scope)
+	}
+}
+
+// Matches reports whether the snapshot lies in a task's dataset scope and
+// its name follows the task's naming schema.
+func (m *ManagedSnapshots) Matches(snapshot Snapshot) bool {
+	if m == nil {
+		return false
+	}
+	dataset, name := snapshot.Dataset, snapshot.Name
+	if at := strings.LastIndex(name, "@"); at >= 0 {
+		if dataset == "" {
+			dataset = name[:at]
+		}
+		name = name[at+1:]
+	}
+	for _, scope := range m.scopes {
+		if scope.matches(dataset, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// namingSchemaRegexp converts a strftime naming schema into an anchored
+// regular expression.
+func namingSchemaRegexp(schema string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(schema); i++ {
+		if schema[i] != '%' || i+1 == len(schema) {
+			b.WriteString(regexp.QuoteMeta(schema[i : i+1]))
+			continue
+		}
+		i++
+		switch schema[i] {
+		case 'Y':
+			b.WriteString(`\d{4}`)
+		case 'm', 'd', 'H', 'M', 'S', 'y':
+			b.WriteString(`\d{2}`)
+		case 'j':
+			b.WriteString(`\d{3}`)
+		case 's':
+			b.WriteString(`\d+`)
+		case 'z':
+			b.WriteString(`[+-]\d{4}`)
+		case '%':
+			b.WriteString("%")
+		default:
+			b.WriteString(`.+?`)
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
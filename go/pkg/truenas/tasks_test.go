@@ -0,0 +1,92 @@
+package truenas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListReplicationTasks_decodesScaleResponse(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "replication_scale.json"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/replication", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	tasks, err := c.ListReplicationTasks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+
+	push := tasks[0]
+	assert.Equal(t, ReplicationPush, push.Direction)
+	assert.Equal(t, []string{"tank/k8s"}, push.SourceDatasets)
+	require.Len(t, push.PeriodicSnapshotTasks, 1)
+	assert.Equal(t, "auto-%Y-%m-%d_%H-%M", push.PeriodicSnapshotTasks[0].NamingSchema)
+	assert.Equal(t, []string{"manual-%Y%m%d"}, push.AlsoIncludeNamingSchema)
+	assert.Equal(t, ReplicationPull, tasks[1].Direction)
+	assert.False(t, tasks[1].Enabled)
+}
+
+func TestManagedSnapshots_Matches(t *testing.T) {
+	periodic := []PeriodicSnapshotTask{{
+		Dataset:      "tank/k8s",
+		Recursive:    true,
+		Exclude:      []string{"tank/k8s/scratch"},
+		NamingSchema: "auto-%Y-%m-%d_%H-%M",
+	}}
+	replication := []ReplicationTask{
+		{
+			Direction:               ReplicationPush,
+			SourceDatasets:          []string{"tank/apps"},
+			AlsoIncludeNamingSchema: []string{"manual-%Y%m%d"},
+		},
+		{
+			Direction:     ReplicationPull,
+			TargetDataset: "tank/offsite",
+			NamingSchema:  []string{"daily-%Y-%m-%d"},
+		},
+		{
+			Direction:      ReplicationPush,
+			SourceDatasets: []string{"tank/legacy"},
+			NameRegex:      "hourly-.*",
+		},
+	}
+	managed := NewManagedSnapshots(periodic, replication)
+
+	tests := []struct {
+		snapshot string
+		want     bool
+	}{
+		{"tank/k8s@auto-2024-06-01_00-00", true},
+		{"tank/k8s/pvc-1@auto-2024-06-01_00-00", true},
+		{"tank/k8s/scratch@auto-2024-06-01_00-00", false},
+		{"tank/k8s/pvc-1@snapshot-5c6f", false},
+		{"tank/k8s/pvc-1@auto-2024-06-01", false},
+		{"tank/k8s-other@auto-2024-06-01_00-00", false},
+		{"tank/apps@manual-20240601", true},
+		{"tank/apps/child@manual-20240601", false},
+		{"tank/offsite/data@daily-2024-06-01", true},
+		{"tank/legacy@hourly-anything", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.snapshot, func(t *testing.T) {
+			assert.Equal(t, tt.want, managed.Matches(Snapshot{Name: tt.snapshot}))
+		})
+	}
+
+	var none *ManagedSnapshots
+	assert.False(t, none.Matches(Snapshot{Name: "tank/k8s@auto-2024-06-01_00-00"}))
+}
@@ -0,0 +1,48 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/apiusage"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/tracing"
+)
+
+// startSpan starts a client span for a TrueNAS API operation. The request
+// hooks add the method, path and status or transport error of each call
+// made with the returned context.
+func startSpan(ctx context.Context, operation string) (context.Context, *tracing.Span) {
+	return tracing.Start(ctx, "truenas."+operation, tracing.WithKind(tracing.SpanKindClient))
+}
+
+// traceResponse records a response on the span in its request context.
+func traceResponse(_ *resty.Client, resp *resty.Response) error {
+	span := tracing.SpanFromContext(resp.Request.Context())
+	if span == nil {
+		return nil
+	}
+	span.SetAttributes(
+		tracing.String("http.request.method", resp.Request.Method),
+		tracing.Int("http.response.status_code", resp.StatusCode()))
+	if raw := resp.Request.RawRequest; raw != nil {
+		span.SetAttributes(tracing.String("url.path", raw.URL.Path))
+	}
+	if resp.StatusCode() >= 400 {
+		span.RecordError(fmt.Errorf("TrueNAS API returned status %d", resp.StatusCode()))
+	}
+	return nil
+}
+
+// countRequest counts each request, retries included, on the per-scan
+// counter of its context.
+func countRequest(_ *resty.Client, req *resty.Request) error {
+	apiusage.Add(req.Context(), apiusage.BackendTrueNAS)
+	return nil
+}
+
+// traceError records a failed request on the span in its context.
+func traceError(req *resty.Request, err error) {
+	tracing.SpanFromContext(req.Context()).RecordError(err)
+}
@@ -0,0 +1,156 @@
+package truenas
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// Hops reported by ConnectError.
+const (
+	ConnectHopProxy  = "proxy"
+	ConnectHopTarget = "target"
+)
+
+// ConnectError reports a failed connection and which hop failed: the proxy
+// itself, or TrueNAS reached directly or through the proxy.
+type ConnectError struct {
+	Hop string
+	// Addr is the host:port of the failed hop.
+	Addr string
+	// Dialed is the address actually dialed when a resolve override
+	// replaced the host; empty otherwise.
+	Dialed string
+	// Proxy is the redacted proxy URL when the request used one.
+	Proxy string
+	Err   error
+}
+
+func (e *ConnectError) Error() string {
+	addr := e.Addr
+	if e.Dialed != "" {
+		addr += " (dialed " + e.Dialed + ")"
+	}
+	switch {
+	case e.Hop == ConnectHopProxy:
+		return fmt.Sprintf("connecting to proxy %s failed: %v", addr, e.Err)
+	case e.Proxy != "":
+		return fmt.Sprintf("proxy %s could not connect to TrueNAS %s: %v", e.Proxy, addr, e.Err)
+	default:
+		return fmt.Sprintf("connecting to TrueNAS %s failed: %v", addr, e.Err)
+	}
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// TransportOptions configures how the client reaches TrueNAS.
+type TransportOptions struct {
+	TLS *tls.Config
+	// ProxyURL is an HTTP(S) proxy for all TrueNAS requests. Empty uses
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY from the environment.
+	ProxyURL string
+	// ResolveOverride maps host names to the IP addresses dialed in their
+	// place. It applies to the hosts the client connects to itself: TrueNAS
+	// when no proxy is used, otherwise the proxy. TLS still verifies the
+	// host name from the URL.
+	ResolveOverride map[string]string
+}
+
+// buildTransport creates the HTTP transport for the TrueNAS client.
+func buildTransport(opts TransportOptions) (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			// An unparseable URL cannot be redacted, so it is not quoted.
+			return nil, fmt.Errorf("invalid proxy URL: must be an http or https URL")
+		}
+		if (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: must be an http or https URL", logging.RedactURL(opts.ProxyURL))
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	for host, ip := range opts.ResolveOverride {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid resolve override for %s: %q is not an IP address", host, ip)
+		}
+	}
+
+	// proxies remembers the proxy addresses returned for requests so dial
+	// errors can be attributed to the proxy or the target.
+	var proxies sync.Map
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = opts.TLS
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if proxyURL != nil {
+			proxies.Store(canonicalAddr(proxyURL), proxyURL.Redacted())
+		}
+		return proxyURL, err
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed := ""
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if ip, ok := opts.ResolveOverride[host]; ok {
+				dialed = net.JoinHostPort(ip, port)
+			}
+		}
+		target := addr
+		if dialed != "" {
+			target = dialed
+		}
+
+		conn, err := dialer.DialContext(ctx, network, target)
+		if err != nil {
+			connectErr := &ConnectError{Hop: ConnectHopTarget, Addr: addr, Dialed: dialed, Err: err}
+			if proxyURL, ok := proxies.Load(addr); ok {
+				connectErr.Hop = ConnectHopProxy
+				connectErr.Proxy = proxyURL.(string)
+			}
+			return nil, connectErr
+		}
+		return conn, nil
+	}
+	transport.OnProxyConnectResponse = func(_ context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+		if connectRes.StatusCode == http.StatusOK {
+			return nil
+		}
+		// Gateway errors mean the proxy could not reach TrueNAS; anything
+		// else, such as 403 or 407, is the proxy refusing the tunnel.
+		hop, addr := ConnectHopProxy, canonicalAddr(proxyURL)
+		switch connectRes.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			hop, addr = ConnectHopTarget, connectReq.Host
+		}
+		return &ConnectError{
+			Hop:   hop,
+			Addr:  addr,
+			Proxy: proxyURL.Redacted(),
+			Err:   fmt.Errorf("proxy answered CONNECT with %s", connectRes.Status),
+		}
+	}
+	return transport, nil
+}
+
+// canonicalAddr returns host:port of a URL, adding the scheme's default port.
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,385 @@
+// Package truenastest provides an in-memory truenas.Client for tests.
+package truenastest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// Mutation is one call that changes TrueNAS state, recorded whether or not it
+// succeeded.
+type Mutation struct {
+	Method string
+	// Name is the dataset or snapshot the call targeted.
+	Name string
+	// Value is the refquota set by SetDatasetRefquota.
+	Value int64
+	// DeleteOptions are the options of DeleteSnapshot.
+	DeleteOptions truenas.DeleteSnapshotOptions
+	// Source is the snapshot cloned by CloneSnapshot.
+	Source string
+}
+
+// Client is a hand-written truenas.Client mock. Set the data fields to control
+// what the list calls return and the *Err fields to make a call fail. Calls
+// records how many times each method was invoked and Mutations the arguments
+// of the calls that change state.
+type Client struct {
+	Volumes    []truenas.Volume
+	Snapshots  []truenas.Snapshot
+	Pools      []truenas.Pool
+	SystemInfo *truenas.SystemInfo
+	SMBShares  []truenas.SMBShare
+	NFSShares  []truenas.NFSShare
+	Alerts     []truenas.Alert
+	// SnapshotTasks and ReplicationTasks are TrueNAS task definitions.
+	SnapshotTasks    []truenas.PeriodicSnapshotTask
+	ReplicationTasks []truenas.ReplicationTask
+	// IOStats are returned for the requested datasets by GetDatasetIOStats.
+	IOStats []truenas.DatasetIOStats
+	// ISCSISessions and ISCSIInitiatorGroups describe the iSCSI service.
+	ISCSISessions        []truenas.ISCSISession
+	ISCSIInitiatorGroups []truenas.ISCSIInitiatorGroup
+
+	ListVolumesErr    error
+	ListSnapshotsErr  error
+	ListPoolsErr      error
+	GetSMBSharesErr   error
+	GetNFSSharesErr   error
+	GetDatasetErr     error
+	ListAlertsErr     error
+	ListTasksErr      error
+	IOStatsErr        error
+	ListISCSIErr      error
+	SetRefquotaErr    error
+	DeleteSnapshotErr error
+	// DeleteSnapshotErrs fails DeleteSnapshot for individual snapshot names.
+	DeleteSnapshotErrs map[string]error
+	CreateSnapshotErr  error
+	CloneSnapshotErr   error
+	DeleteDatasetErr   error
+	GetSystemInfoErr   error
+	TestConnectionErr  error
+
+	mu        sync.Mutex
+	calls     map[string]int
+	mutations []Mutation
+}
+
+var _ truenas.Client = (*Client)(nil)
+
+// ListVolumes returns Volumes or ListVolumesErr.
+func (c *Client) ListVolumes(context.Context) ([]truenas.Volume, error) {
+	c.record("ListVolumes")
+	if c.ListVolumesErr != nil {
+		return nil, c.ListVolumesErr
+	}
+	return append([]truenas.Volume{}, c.Volumes...), nil
+}
+
+// ListSnapshots returns Snapshots or ListSnapshotsErr.
+func (c *Client) ListSnapshots(context.Context) ([]truenas.Snapshot, error) {
+	c.record("ListSnapshots")
+	if c.ListSnapshotsErr != nil {
+		return nil, c.ListSnapshotsErr
+	}
+	return append([]truenas.Snapshot{}, c.Snapshots...), nil
+}
+
+// ListSnapshotsSince returns Snapshots created at or after since, or
+// ListSnapshotsErr.
+func (c *Client) ListSnapshotsSince(_ context.Context, since time.Time) ([]truenas.Snapshot, error) {
+	c.record("ListSnapshotsSince")
+	if c.ListSnapshotsErr != nil {
+		return nil, c.ListSnapshotsErr
+	}
+	snapshots := []truenas.Snapshot{}
+	for _, snapshot := range c.Snapshots {
+		if !snapshot.CreatedAt.Before(since) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// ListPools returns Pools or ListPoolsErr.
+func (c *Client) ListPools(context.Context) ([]truenas.Pool, error) {
+	c.record("ListPools")
+	if c.ListPoolsErr != nil {
+		return nil, c.ListPoolsErr
+	}
+	return append([]truenas.Pool{}, c.Pools...), nil
+}
+
+// GetSMBShares returns SMBShares or GetSMBSharesErr.
+func (c *Client) GetSMBShares(context.Context) ([]truenas.SMBShare, error) {
+	c.record("GetSMBShares")
+	if c.GetSMBSharesErr != nil {
+		return nil, c.GetSMBSharesErr
+	}
+	return append([]truenas.SMBShare{}, c.SMBShares...), nil
+}
+
+// GetNFSShares returns NFSShares or GetNFSSharesErr.
+func (c *Client) GetNFSShares(context.Context) ([]truenas.NFSShare, error) {
+	c.record("GetNFSShares")
+	if c.GetNFSSharesErr != nil {
+		return nil, c.GetNFSSharesErr
+	}
+	return append([]truenas.NFSShare{}, c.NFSShares...), nil
+}
+
+// GetDataset returns the entry of Volumes whose ID or Name is name, or
+// GetDatasetErr.
+func (c *Client) GetDataset(_ context.Context, name string) (*truenas.Volume, error) {
+	c.record("GetDataset")
+	if c.GetDatasetErr != nil {
+		return nil, c.GetDatasetErr
+	}
+	for _, volume := range c.Volumes {
+		if volume.ID == name || volume.Name == name {
+			return &volume, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", truenas.ErrDatasetNotFound, name)
+}
+
+// ListAlerts returns Alerts or ListAlertsErr.
+func (c *Client) ListAlerts(context.Context) ([]truenas.Alert, error) {
+	c.record("ListAlerts")
+	if c.ListAlertsErr != nil {
+		return nil, c.ListAlertsErr
+	}
+	return append([]truenas.Alert{}, c.Alerts...), nil
+}
+
+// ListSnapshotTasks returns SnapshotTasks or ListTasksErr.
+func (c *Client) ListSnapshotTasks(context.Context) ([]truenas.PeriodicSnapshotTask, error) {
+	c.record("ListSnapshotTasks")
+	if c.ListTasksErr != nil {
+		return nil, c.ListTasksErr
+	}
+	return append([]truenas.PeriodicSnapshotTask{}, c.SnapshotTasks...), nil
+}
+
+// ListReplicationTasks returns ReplicationTasks or ListTasksErr.
+func (c *Client) ListReplicationTasks(context.Context) ([]truenas.ReplicationTask, error) {
+	c.record("ListReplicationTasks")
+	if c.ListTasksErr != nil {
+		return nil, c.ListTasksErr
+	}
+	return append([]truenas.ReplicationTask{}, c.ReplicationTasks...), nil
+}
+
+// GetDatasetIOStats returns the IOStats entries of the requested datasets,
+// or IOStatsErr.
+func (c *Client) GetDatasetIOStats(_ context.Context, datasets []string, window time.Duration) ([]truenas.DatasetIOStats, error) {
+	c.record("GetDatasetIOStats")
+	if c.IOStatsErr != nil {
+		return nil, c.IOStatsErr
+	}
+	wanted := make(map[string]bool, len(datasets))
+	for _, dataset := range datasets {
+		wanted[dataset] = true
+	}
+	var stats []truenas.DatasetIOStats
+	for _, s := range c.IOStats {
+		if wanted[s.Dataset] {
+			s.Window = window
+			stats = append(stats, s)
+		}
+	}
+	return stats, nil
+}
+
+// SetDatasetRefquota stores refquota in the "refquota" property of the
+// matching entry of Volumes, or returns SetRefquotaErr.
+func (c *Client) SetDatasetRefquota(_ context.Context, name string, refquota int64) error {
+	c.recordMutation(Mutation{Method: "SetDatasetRefquota", Name: name, Value: refquota})
+	if c.SetRefquotaErr != nil {
+		return c.SetRefquotaErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.Volumes {
+		if c.Volumes[i].ID == name || c.Volumes[i].Name == name {
+			properties := make(map[string]string, len(c.Volumes[i].Properties)+1)
+			for k, v := range c.Volumes[i].Properties {
+				properties[k] = v
+			}
+			properties["refquota"] = strconv.FormatInt(refquota, 10)
+			c.Volumes[i].Properties = properties
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", truenas.ErrDatasetNotFound, name)
+}
+
+// DeleteSnapshot removes the entry of Snapshots whose ID or Name is name, or
+// returns DeleteSnapshotErr or the DeleteSnapshotErrs entry for name.
+func (c *Client) DeleteSnapshot(_ context.Context, name string, opts truenas.DeleteSnapshotOptions) error {
+	c.recordMutation(Mutation{Method: "DeleteSnapshot", Name: name, DeleteOptions: opts})
+	if c.DeleteSnapshotErr != nil {
+		return c.DeleteSnapshotErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.DeleteSnapshotErrs[name]; err != nil {
+		return err
+	}
+	for i := range c.Snapshots {
+		if c.Snapshots[i].ID == name || c.Snapshots[i].Name == name {
+			c.Snapshots = append(c.Snapshots[:i:i], c.Snapshots[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", truenas.ErrSnapshotNotFound, name)
+}
+
+// CreateSnapshot appends the snapshot to Snapshots, or returns
+// CreateSnapshotErr or ErrDatasetNotFound when dataset is not in Volumes.
+func (c *Client) CreateSnapshot(_ context.Context, dataset, name string) (*truenas.Snapshot, error) {
+	full := dataset + "@" + name
+	c.recordMutation(Mutation{Method: "CreateSnapshot", Name: full})
+	if c.CreateSnapshotErr != nil {
+		return nil, c.CreateSnapshotErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.volume(dataset) < 0 {
+		return nil, fmt.Errorf("%w: %s", truenas.ErrDatasetNotFound, dataset)
+	}
+	snapshot := truenas.Snapshot{ID: full, Name: full, Dataset: dataset, CreatedAt: time.Now().UTC()}
+	c.Snapshots = append(c.Snapshots, snapshot)
+	return &snapshot, nil
+}
+
+// CloneSnapshot appends a dataset named dataset to Volumes, copying the type
+// and available space of the snapshot's dataset, or returns
+// CloneSnapshotErr or ErrSnapshotNotFound.
+func (c *Client) CloneSnapshot(_ context.Context, snapshot, dataset string) error {
+	c.recordMutation(Mutation{Method: "CloneSnapshot", Name: dataset, Source: snapshot})
+	if c.CloneSnapshotErr != nil {
+		return c.CloneSnapshotErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := false
+	for _, existing := range c.Snapshots {
+		if existing.ID == snapshot || existing.Name == snapshot {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", truenas.ErrSnapshotNotFound, snapshot)
+	}
+	clone := truenas.Volume{ID: dataset, Name: dataset, Path: "/mnt/" + dataset, Type: truenas.VolumeTypeFilesystem}
+	source, _, _ := strings.Cut(snapshot, "@")
+	if i := c.volume(source); i >= 0 {
+		clone.Type = c.Volumes[i].Type
+		clone.Available = c.Volumes[i].Available
+	}
+	c.Volumes = append(c.Volumes, clone)
+	return nil
+}
+
+// DeleteDataset removes the entry of Volumes whose ID or Name is name, or
+// returns DeleteDatasetErr or ErrDatasetNotFound.
+func (c *Client) DeleteDataset(_ context.Context, name string) error {
+	c.recordMutation(Mutation{Method: "DeleteDataset", Name: name})
+	if c.DeleteDatasetErr != nil {
+		return c.DeleteDatasetErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.volume(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", truenas.ErrDatasetNotFound, name)
+	}
+	c.Volumes = append(c.Volumes[:i:i], c.Volumes[i+1:]...)
+	return nil
+}
+
+// volume returns the index of the Volumes entry whose ID or Name is name, or
+// -1. The caller holds c.mu.
+func (c *Client) volume(name string) int {
+	for i := range c.Volumes {
+		if c.Volumes[i].ID == name || c.Volumes[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListISCSISessions returns ISCSISessions or ListISCSIErr.
+func (c *Client) ListISCSISessions(context.Context) ([]truenas.ISCSISession, error) {
+	c.record("ListISCSISessions")
+	if c.ListISCSIErr != nil {
+		return nil, c.ListISCSIErr
+	}
+	return append([]truenas.ISCSISession{}, c.ISCSISessions...), nil
+}
+
+// ListISCSIInitiatorGroups returns ISCSIInitiatorGroups or ListISCSIErr.
+func (c *Client) ListISCSIInitiatorGroups(context.Context) ([]truenas.ISCSIInitiatorGroup, error) {
+	c.record("ListISCSIInitiatorGroups")
+	if c.ListISCSIErr != nil {
+		return nil, c.ListISCSIErr
+	}
+	return append([]truenas.ISCSIInitiatorGroup{}, c.ISCSIInitiatorGroups...), nil
+}
+
+// GetSystemInfo returns SystemInfo or GetSystemInfoErr.
+func (c *Client) GetSystemInfo(context.Context) (*truenas.SystemInfo, error) {
+	c.record("GetSystemInfo")
+	if c.GetSystemInfoErr != nil {
+		return nil, c.GetSystemInfoErr
+	}
+	if c.SystemInfo == nil {
+		return &truenas.SystemInfo{}, nil
+	}
+	info := *c.SystemInfo
+	return &info, nil
+}
+
+// TestConnection returns TestConnectionErr.
+func (c *Client) TestConnection(context.Context) error {
+	c.record("TestConnection")
+	return c.TestConnectionErr
+}
+
+// Calls returns how many times method has been called.
+func (c *Client) Calls(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+// Mutations returns the state-changing calls made so far, in order.
+func (c *Client) Mutations() []Mutation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Mutation{}, c.mutations...)
+}
+
+func (c *Client) recordMutation(mutation Mutation) {
+	c.record(mutation.Method)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mutations = append(c.mutations, mutation)
+}
+
+func (c *Client) record(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[method]++
+}
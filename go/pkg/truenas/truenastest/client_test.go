@@ -0,0 +1,43 @@
+package truenastest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+func TestClient_ReturnsConfiguredData(t *testing.T) {
+	c := &Client{
+		Volumes: []truenas.Volume{{Name: "tank/k8s/vol-1"}},
+	}
+
+	volumes, err := c.ListVolumes(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(volumes) != 1 || volumes[0].Name != "tank/k8s/vol-1" {
+		t.Fatalf("unexpected volumes: %v", volumes)
+	}
+
+	volumes[0].Name = "mutated"
+	if c.Volumes[0].Name != "tank/k8s/vol-1" {
+		t.Fatal("callers must not be able to mutate the mock's data")
+	}
+	if c.Calls("ListVolumes") != 1 {
+		t.Fatalf("ListVolumes calls = %d, want 1", c.Calls("ListVolumes"))
+	}
+}
+
+func TestClient_ReturnsConfiguredErrors(t *testing.T) {
+	wantErr := errors.New("truenas unavailable")
+	c := &Client{ListSnapshotsErr: wantErr, TestConnectionErr: wantErr}
+
+	if _, err := c.ListSnapshots(context.Background()); !errors.Is(err, wantErr) {
+		t.Fatalf("ListSnapshots error = %v, want %v", err, wantErr)
+	}
+	if err := c.TestConnection(context.Background()); !errors.Is(err, wantErr) {
+		t.Fatalf("TestConnection error = %v, want %v", err, wantErr)
+	}
+}
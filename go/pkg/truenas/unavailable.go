@@ -0,0 +1,68 @@
+package truenas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// UnavailableError reports a 503 response, which TrueNAS returns during an
+// HA failover or maintenance. RetryAfter is taken from the Retry-After header
+// and is zero when the header is absent.
+type UnavailableError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("TrueNAS temporarily unavailable (status %d, retry after %s)", e.StatusCode, e.RetryAfter)
+	}
+	return fmt.Sprintf("TrueNAS temporarily unavailable (status %d)", e.StatusCode)
+}
+
+// IsUnavailable reports whether err means TrueNAS is temporarily unavailable:
+// a 503 response or a refused connection. retryAfter is the server's hint, if
+// any.
+func IsUnavailable(err error) (retryAfter time.Duration, ok bool) {
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		return unavailable.RetryAfter, true
+	}
+	return 0, errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// unavailableResponse turns 503 responses into *UnavailableError so callers
+// can tell maintenance apart from other API errors.
+func unavailableResponse(_ *resty.Client, resp *resty.Response) error {
+	if resp.StatusCode() != http.StatusServiceUnavailable {
+		return nil
+	}
+	return &UnavailableError{
+		StatusCode: resp.StatusCode(),
+		RetryAfter: parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an HTTP
+// date. Invalid or past values yield zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
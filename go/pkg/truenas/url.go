@@ -0,0 +1,69 @@
+package truenas
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+)
+
+// apiPath is the REST API root requested below the base URL.
+const apiPath = "/api/v2.0"
+
+// NormalizeURL validates a TrueNAS address and returns it as
+// scheme://host[:port][/prefix] without a trailing slash. It accepts a bare
+// host, host:port or a full URL; the scheme defaults to https and is never
+// derived from the port. A path is kept as the prefix of a TrueNAS behind a
+// reverse proxy, minus a trailing /api/v2.0 pasted from the API docs.
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("TrueNAS URL is required")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		// url.Error repeats the input, which may hold a password.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("invalid TrueNAS URL: %w", err)
+	}
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid TrueNAS URL %q: %s", logging.RedactURL(raw), reason)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", invalid("scheme must be http or https")
+	}
+	if u.Hostname() == "" {
+		return "", invalid("host is required")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", invalid("port must be between 1 and 65535")
+		}
+	} else if strings.HasSuffix(u.Host, ":") {
+		return "", invalid("port must be between 1 and 65535")
+	}
+	if u.User != nil {
+		return "", invalid("must not include credentials; set the username and password instead")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", invalid("must not include a query or fragment")
+	}
+
+	prefix := strings.TrimRight(u.EscapedPath(), "/")
+	prefix = strings.TrimSuffix(prefix, apiPath)
+	prefix = strings.TrimRight(prefix, "/")
+
+	return scheme + "://" + strings.ToLower(u.Host) + prefix, nil
+}
@@ -0,0 +1,34 @@
+// Package version exposes build information set at link time, e.g.
+//
+//	go build -ldflags "-X github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/version.Version=0.2.0"
+package version
+
+import "runtime"
+
+// Build information, overridden with -ldflags "-X ...". The defaults are used
+// for plain `go build` and `go test`.
+var (
+	Version   = "0.1.0"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info is the build information reported by the binaries.
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
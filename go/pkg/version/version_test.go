@@ -0,0 +1,20 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet_usesRuntimeGoVersion(t *testing.T) {
+	original := GitCommit
+	GitCommit = "abc1234"
+	defer func() { GitCommit = original }()
+
+	info := Get()
+	if info.GoVersion != runtime.Version() {
+		t.Fatalf("GoVersion = %q, want %q", info.GoVersion, runtime.Version())
+	}
+	if info.GitCommit != "abc1234" || info.Version != Version {
+		t.Fatalf("unexpected build info %+v", info)
+	}
+}
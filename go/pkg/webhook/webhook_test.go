@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostJSON(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	if err := PostJSON(context.Background(), server.Client(), server.URL+"/ok", map[string]string{"text": "hello"}); err != nil {
+		t.Fatalf("PostJSON: %v", err)
+	}
+	if got["text"] != "hello" {
+		t.Fatalf("payload = %v", got)
+	}
+	err := PostJSON(context.Background(), server.Client(), server.URL+"/fail", map[string]string{})
+	if err == nil || err.Error() != "destination returned status 502" {
+		t.Fatalf("err = %v, want the status", err)
+	}
+}
+
+func TestPostJSON_ErrorsLeaveOutTheURL(t *testing.T) {
+	const secret = "T000/B000/XXXXsecretXXXX"
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	target := server.URL + "/services/" + secret
+	server.Close()
+
+	for _, target := range []string{target, "http://hooks.example.com/services/" + secret + "\x7f"} {
+		err := PostJSON(context.Background(), http.DefaultClient, target, map[string]string{})
+		if err == nil {
+			t.Fatalf("PostJSON(%q) succeeded", target)
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Fatalf("error %q leaks the webhook URL", err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Command cliserver serves the API server over the k8stest and truenastest
+// fakes, seeded with a small fixture cluster. The Python CLI compatibility
+// tests start it and point the CLI at it with --api-url, so the CLI's flags
+// and exit codes are checked against the real API responses.
+//
+// It prints the base URL on stdout once it is listening and serves until
+// stdin is closed or it is interrupted.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/api"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas/truenastest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:0", "address to listen on")
+	flag.Parse()
+
+	gin.SetMode(gin.ReleaseMode)
+	k8sClient, truenasClient := fixture(time.Now())
+	server, err := api.NewServer(api.Config{
+		K8sClient:     k8sClient,
+		TruenasClient: truenasClient,
+		Logger:        zap.NewNop(),
+	})
+	if err != nil {
+		log.Fatalf("failed to create API server: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		if err := http.Serve(listener, server.Handler()); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	fmt.Printf("http://%s\n", listener.Addr())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		close(closed)
+	}()
+	select {
+	case <-stop:
+	case <-closed:
+	}
+}
+
+// fixture returns a cluster with one bound NFS volume used by a Deployment
+// and one PersistentVolume whose dataset is gone, which is an orphan.
+func fixture(now time.Time) (*k8stest.Client, *truenastest.Client) {
+	const (
+		driver = "org.democratic-csi.nfs"
+		class  = "democratic-csi-nfs"
+		parent = "tank/k8s/nfs"
+	)
+	created := metav1.NewTime(now.Add(-72 * time.Hour))
+	pv := func(name string, claim *corev1.ObjectReference) corev1.PersistentVolume {
+		return corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name), CreationTimestamp: created},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity:         corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				StorageClassName: class,
+				ClaimRef:         claim,
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: name},
+				},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeBound},
+		}
+	}
+	released := pv("pvc-gone", nil)
+	released.Status.Phase = corev1.VolumeReleased
+
+	k8sClient := &k8stest.Client{
+		StorageClasses: []storagev1.StorageClass{{
+			ObjectMeta:  metav1.ObjectMeta{Name: class},
+			Provisioner: driver,
+			Parameters:  map[string]string{"datasetParentName": parent},
+		}},
+		PersistentVolumes: []corev1.PersistentVolume{
+			pv("pvc-data", &corev1.ObjectReference{Namespace: "apps", Name: "data"}),
+			released,
+		},
+		PersistentVolumeClaims: []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "apps", UID: types.UID("uid-data"), CreationTimestamp: created},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-data", StorageClassName: ptr(class)},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		}},
+		Pods: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-7d9f-abcde",
+				Namespace:       "apps",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7d9f"}},
+			},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name:         "data",
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}},
+			}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}},
+		Namespaces: []corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "apps"}}},
+	}
+	truenasClient := &truenastest.Client{
+		Pools: []truenas.Pool{{Name: "tank", ID: "1", Status: "ONLINE", Health: "HEALTHY", Healthy: ptr(true), Size: 100 << 30, Used: 20 << 30, Available: 80 << 30}},
+		Volumes: []truenas.Volume{
+			{Name: parent, ID: parent, Type: "FILESYSTEM"},
+			{Name: parent + "/pvc-data", ID: parent + "/pvc-data", Type: "FILESYSTEM", Used: 2 << 30, Path: "/mnt/" + parent + "/pvc-data"},
+		},
+	}
+	return k8sClient, truenasClient
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
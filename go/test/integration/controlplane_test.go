@@ -0,0 +1,65 @@
+//go:build integration
+
+package integration
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// controlPlane is a kube-apiserver backed by etcd, started by controller-runtime
+// envtest from the binaries in $KUBEBUILDER_ASSETS (`setup-envtest use -p
+// path`).
+type controlPlane struct {
+	Kubeconfig string
+}
+
+// startControlPlane starts etcd and kube-apiserver for the test and stops
+// them on cleanup. The test is skipped when KUBEBUILDER_ASSETS is unset.
+func startControlPlane(t *testing.T) *controlPlane {
+	t.Helper()
+
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; run `setup-envtest use -p path` and export it")
+	}
+
+	env := &envtest.Environment{}
+	if _, err := env.Start(); err != nil {
+		t.Fatalf("start envtest control plane: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("stop envtest control plane: %v", err)
+		}
+	})
+
+	// The monitor and API server load a kubeconfig file, as in production.
+	admin, err := env.AddUser(envtest.User{Name: "admin", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		t.Fatalf("add envtest user: %v", err)
+	}
+	kubeconfig, err := admin.KubeConfig()
+	if err != nil {
+		t.Fatalf("envtest kubeconfig: %v", err)
+	}
+	cp := &controlPlane{Kubeconfig: filepath.Join(t.TempDir(), "kubeconfig")}
+	if err := os.WriteFile(cp.Kubeconfig, kubeconfig, 0o600); err != nil {
+		t.Fatalf("write %s: %v", cp.Kubeconfig, err)
+	}
+	return cp
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("find free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
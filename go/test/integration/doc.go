@@ -0,0 +1,7 @@
+// Package integration runs the monitor and API server end to end against a
+// real kube-apiserver and etcd and an httptest fake TrueNAS. The tests are
+// behind the integration build tag and need the envtest control plane
+// binaries:
+//
+//	KUBEBUILDER_ASSETS=$(setup-envtest use -p path) go test ./... -tags integration
+package integration
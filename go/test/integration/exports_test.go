@@ -0,0 +1,62 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s/k8stest"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/orphan"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+// TestIntegration_UnmountedDatasetsAreNotOrphans reproduces a pool import
+// that left datasets unmounted: the datasets are listed without a
+// mountpoint and the NFS share list is empty. No PV may be reported as
+// orphaned while its dataset exists; each is reported as not exported.
+// It needs only the fake TrueNAS, not the control plane.
+func TestIntegration_UnmountedDatasetsAreNotOrphans(t *testing.T) {
+	names := []string{"pvc-a", "pvc-b", "pvc-c"}
+	var datasets []fakeDataset
+	var pvs []corev1.PersistentVolume
+	for _, name := range names {
+		datasets = append(datasets, fakeDataset{Name: "tank/k8s/" + name, Pool: "tank", Used: 1 << 30})
+		pv := democraticPV(name, name, nil)
+		pv.CreationTimestamp = metav1.NewTime(time.Now().Add(-48 * time.Hour))
+		pvs = append(pvs, *pv)
+	}
+	fake := newFakeTrueNAS(t, datasets, nil)
+
+	truenasClient, err := truenas.NewClient(truenas.Config{URL: fake.URL, Username: fake.Username, Password: fake.Password})
+	if err != nil {
+		t.Fatalf("truenas.NewClient: %v", err)
+	}
+	detector, err := orphan.NewDetector(&k8stest.Client{PersistentVolumes: pvs}, truenasClient, orphan.Config{AgeThreshold: time.Hour})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	result, err := detector.DetectOrphanedPVs(context.Background())
+	if err != nil {
+		t.Fatalf("DetectOrphanedPVs: %v", err)
+	}
+	if len(result.OrphanedPVs) != 0 {
+		t.Fatalf("orphaned PVs = %+v, want none while the datasets exist", result.OrphanedPVs)
+	}
+	if len(result.ExportMissing) != len(names) {
+		t.Fatalf("export issues = %+v, want one per PV", result.ExportMissing)
+	}
+	for _, issue := range result.ExportMissing {
+		if issue.Kind != orphan.ExportDatasetUnmounted {
+			t.Errorf("%s: kind = %q, want %q", issue.PersistentVolume, issue.Kind, orphan.ExportDatasetUnmounted)
+		}
+	}
+	if fake.Requests("/api/v2.0/sharing/nfs") == 0 {
+		t.Fatal("detector never listed NFS shares")
+	}
+}
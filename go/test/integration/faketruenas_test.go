@@ -0,0 +1,165 @@
+//go:build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeDataset and fakeSnapshot are served in the TrueNAS API v2.0 shape.
+type fakeDataset struct {
+	Name      string
+	Pool      string
+	Used      int64
+	Available int64
+	// Mountpoint is empty for an unmounted dataset, served as null.
+	Mountpoint string
+}
+
+type fakeSnapshot struct {
+	Dataset string
+	Name    string
+	Used    int64
+	Created int64 // unix seconds
+}
+
+// fakeTrueNAS is an httptest server implementing the TrueNAS endpoints the
+// clients call. It requires basic auth with the given credentials.
+type fakeTrueNAS struct {
+	*httptest.Server
+
+	Username, Password string
+	Datasets           []fakeDataset
+	Snapshots          []fakeSnapshot
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newFakeTrueNAS(t *testing.T, datasets []fakeDataset, snapshots []fakeSnapshot) *fakeTrueNAS {
+	t.Helper()
+
+	fake := &fakeTrueNAS{
+		Username:  "root",
+		Password:  "integration",
+		Datasets:  datasets,
+		Snapshots: snapshots,
+		requests:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2.0/pool/dataset", fake.handleDatasets)
+	mux.HandleFunc("/api/v2.0/zfs/snapshot", fake.handleSnapshots)
+	mux.HandleFunc("/api/v2.0/pool", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, []map[string]interface{}{{
+			"id": "1", "name": "tank", "status": "ONLINE", "health": "HEALTHY",
+			"size": 1 << 40, "used": 1 << 38, "available": 3 << 38,
+		}})
+	})
+	mux.HandleFunc("/api/v2.0/sharing/nfs", func(w http.ResponseWriter, _ *http.Request) {
+		shares := []map[string]interface{}{}
+		for _, dataset := range fake.Datasets {
+			// An unmounted dataset has no export, as after a pool import
+			// that left datasets unmounted.
+			if dataset.Mountpoint == "" {
+				continue
+			}
+			shares = append(shares, map[string]interface{}{
+				"id": len(shares) + 1, "path": dataset.Mountpoint, "enabled": true,
+			})
+		}
+		writeJSON(w, shares)
+	})
+	mux.HandleFunc("/api/v2.0/sharing/smb", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, []interface{}{})
+	})
+	mux.HandleFunc("/api/v2.0/alert/list", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, []interface{}{})
+	})
+	mux.HandleFunc("/api/v2.0/pool/snapshottask", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, []interface{}{})
+	})
+	mux.HandleFunc("/api/v2.0/replication", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, []interface{}{})
+	})
+	mux.HandleFunc("/api/v2.0/system/info", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]interface{}{"version": "TrueNAS-SCALE-24.04", "hostname": "fake-truenas"})
+	})
+
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != fake.Username || pass != fake.Password {
+			http.Error(w, `{"message": "unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		fake.mu.Lock()
+		fake.requests[r.URL.Path]++
+		fake.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// Requests returns how often path was requested.
+func (f *fakeTrueNAS) Requests(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func (f *fakeTrueNAS) handleDatasets(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	out := []map[string]interface{}{}
+	for _, dataset := range f.Datasets {
+		if id != "" && dataset.Name != id {
+			continue
+		}
+		var mountpoint interface{}
+		if dataset.Mountpoint != "" {
+			mountpoint = dataset.Mountpoint
+		}
+		out = append(out, map[string]interface{}{
+			"id":            dataset.Name,
+			"name":          dataset.Name,
+			"pool":          dataset.Pool,
+			"type":          "FILESYSTEM",
+			"used":          map[string]interface{}{"parsed": dataset.Used},
+			"available":     map[string]interface{}{"parsed": dataset.Available},
+			"mountpoint":    mountpoint,
+			"compressratio": map[string]interface{}{"rawvalue": "1.50"},
+		})
+	}
+	writeJSON(w, out)
+}
+
+func (f *fakeTrueNAS) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if raw := r.URL.Query().Get("created.parsed__gte"); raw != "" {
+		since, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	out := []map[string]interface{}{}
+	for _, snapshot := range f.Snapshots {
+		if snapshot.Created < since {
+			continue
+		}
+		full := snapshot.Dataset + "@" + snapshot.Name
+		out = append(out, map[string]interface{}{
+			"id":      full,
+			"name":    full,
+			"dataset": snapshot.Dataset,
+			"used":    map[string]interface{}{"parsed": snapshot.Used},
+			"created": map[string]interface{}{"parsed": snapshot.Created},
+		})
+	}
+	writeJSON(w, out)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
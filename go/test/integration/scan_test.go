@@ -0,0 +1,303 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/api"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/clock"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/k8s"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/logging"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/metrics"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/monitor"
+	"github.com/tomazb/kubernetes-truenas-democratic-tool/pkg/truenas"
+)
+
+const storageClass = "truenas-nfs"
+
+func TestIntegration_FullScan(t *testing.T) {
+	cp := startControlPlane(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	seedCluster(ctx, t, cp)
+
+	now := time.Now()
+	fake := newFakeTrueNAS(t,
+		[]fakeDataset{
+			{Name: "tank/k8s/pvc-bound", Pool: "tank", Used: 1 << 30, Available: 9 << 30, Mountpoint: "/mnt/tank/k8s/pvc-bound"},
+		},
+		[]fakeSnapshot{
+			{Dataset: "tank/k8s/pvc-bound", Name: "recent", Used: 1 << 20, Created: now.Add(-time.Hour).Unix()},
+			{Dataset: "tank/k8s/pvc-bound", Name: "ancient", Used: 1 << 20, Created: now.Add(-60 * 24 * time.Hour).Unix()},
+		},
+	)
+
+	k8sClient, err := k8s.NewClient(k8s.Config{Kubeconfig: cp.Kubeconfig, Namespace: "default"})
+	if err != nil {
+		t.Fatalf("k8s.NewClient: %v", err)
+	}
+	truenasClient, err := truenas.NewClient(truenas.Config{URL: fake.URL, Username: fake.Username, Password: fake.Password})
+	if err != nil {
+		t.Fatalf("truenas.NewClient: %v", err)
+	}
+	logger, err := logging.NewLogger(logging.Config{Level: "error", Encoding: "json"})
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+
+	// Monitor: one scan with the clock two days ahead so the seeded
+	// resources are past the default 24h orphan threshold.
+	exporter := metrics.NewExporter(metrics.Config{Enabled: true, Port: freePort(t), Path: "/metrics"})
+	svc, err := monitor.NewService(monitor.Config{
+		K8sClient:       k8sClient,
+		TruenasClient:   truenasClient,
+		MetricsExporter: exporter,
+		Logger:          logger,
+		ScanInterval:    time.Hour,
+		Clock:           clock.NewFake(now.Add(48 * time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("monitor.NewService: %v", err)
+	}
+	if err := svc.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = svc.Stop(context.Background()) }()
+
+	result := waitForScan(t, svc, 30*time.Second)
+	if result.Partial {
+		t.Fatalf("scan was partial: %v", result.PhaseErrors)
+	}
+	if got := resourceNames(result.OrphanedPVs); len(got) != 1 || got[0] != "pv-orphan" {
+		t.Fatalf("orphaned PVs = %v, want [pv-orphan]", got)
+	}
+	if got := resourceNames(result.OrphanedPVCs); len(got) != 1 || got[0] != "pending" {
+		t.Fatalf("orphaned PVCs = %v, want [pending]", got)
+	}
+	if result.TotalPVs != 2 || result.TotalTrueNASSnapshots != 2 || result.OrphanedTrueNASSnapshots != 1 {
+		t.Fatalf("totals: pvs=%d truenas_snapshots=%d orphaned_truenas_snapshots=%d, want 2/2/1",
+			result.TotalPVs, result.TotalTrueNASSnapshots, result.OrphanedTrueNASSnapshots)
+	}
+	if fake.Requests("/api/v2.0/pool/dataset") == 0 {
+		t.Fatal("monitor never listed TrueNAS datasets")
+	}
+
+	families, err := exporter.GatherForTest()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	gauges := make(map[string]float64)
+	for _, family := range families {
+		if metric := family.GetMetric(); len(metric) == 1 && metric[0].GetGauge() != nil {
+			gauges[family.GetName()] = metric[0].GetGauge().GetValue()
+		}
+	}
+	for name, want := range map[string]float64{
+		"truenas_monitor_orphaned_pvs_total":  1,
+		"truenas_monitor_orphaned_pvcs_total": 1,
+		"truenas_monitor_pvs_total":           2,
+	} {
+		if gauges[name] != want {
+			t.Fatalf("%s = %v, want %v", name, gauges[name], want)
+		}
+	}
+
+	// API server against the same backends.
+	server, err := api.NewServer(api.Config{K8sClient: k8sClient, TruenasClient: truenasClient})
+	if err != nil {
+		t.Fatalf("api.NewServer: %v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	var orphans struct {
+		OrphanedPVs []struct {
+			Name string `json:"name"`
+		} `json:"orphaned_pvs"`
+		TotalPVs int `json:"total_pvs"`
+	}
+	getJSON(t, httpServer.URL+"/api/v1/orphans?age_threshold=1ns", &orphans)
+	if len(orphans.OrphanedPVs) != 1 || orphans.OrphanedPVs[0].Name != "pv-orphan" || orphans.TotalPVs != 2 {
+		t.Fatalf("GET /api/v1/orphans = %+v, want pv-orphan of 2 PVs", orphans)
+	}
+
+	var ready struct {
+		Status string `json:"status"`
+	}
+	getJSON(t, httpServer.URL+"/ready", &ready)
+	if ready.Status != "ready" {
+		t.Fatalf("GET /ready status = %q", ready.Status)
+	}
+}
+
+// seedCluster installs the VolumeSnapshot CRD and creates a StorageClass,
+// a bound PV backed by a TrueNAS dataset, a PV whose dataset is gone and a
+// PVC that never binds.
+func seedCluster(ctx context.Context, t *testing.T, cp *controlPlane) {
+	t.Helper()
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", cp.Kubeconfig)
+	if err != nil {
+		t.Fatalf("rest config: %v", err)
+	}
+	clientset := kubernetes.NewForConfigOrDie(restConfig)
+	installVolumeSnapshotCRD(ctx, t, dynamic.NewForConfigOrDie(restConfig))
+
+	if _, err := clientset.StorageV1().StorageClasses().Create(ctx, &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: storageClass},
+		Provisioner: "org.democratic-csi.nfs",
+		Parameters:  map[string]string{"datasetParentName": "tank/k8s"},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create StorageClass: %v", err)
+	}
+
+	if _, err := clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "apps"},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+
+	for _, pv := range []*corev1.PersistentVolume{
+		democraticPV("pv-bound", "pvc-bound", &corev1.ObjectReference{Namespace: "apps", Name: "data"}),
+		democraticPV("pv-orphan", "pvc-gone", nil),
+	} {
+		if _, err := clientset.CoreV1().PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create PV %s: %v", pv.Name, err)
+		}
+	}
+
+	missingClass := "does-not-exist"
+	if _, err := clientset.CoreV1().PersistentVolumeClaims("apps").Create(ctx, &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &missingClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create PVC: %v", err)
+	}
+}
+
+func democraticPV(name, handle string, claim *corev1.ObjectReference) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              storageClass,
+			ClaimRef:                      claim,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "org.democratic-csi.nfs",
+					VolumeHandle: handle,
+					VolumeAttributes: map[string]string{
+						"server": "truenas",
+						"share":  "/mnt/tank/k8s/" + handle,
+					},
+				},
+			},
+		},
+	}
+}
+
+// installVolumeSnapshotCRD registers a schemaless VolumeSnapshot CRD so the
+// snapshot client can list snapshots.
+func installVolumeSnapshotCRD(ctx context.Context, t *testing.T, client dynamic.Interface) {
+	t.Helper()
+
+	crds := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "volumesnapshots.snapshot.storage.k8s.io"},
+		"spec": map[string]interface{}{
+			"group": "snapshot.storage.k8s.io",
+			"scope": "Namespaced",
+			"names": map[string]interface{}{
+				"plural": "volumesnapshots", "singular": "volumesnapshot",
+				"kind": "VolumeSnapshot", "listKind": "VolumeSnapshotList",
+			},
+			"versions": []interface{}{map[string]interface{}{
+				"name": "v1", "served": true, "storage": true,
+				"schema": map[string]interface{}{"openAPIV3Schema": map[string]interface{}{
+					"type": "object", "x-kubernetes-preserve-unknown-fields": true,
+				}},
+			}},
+		},
+	}}
+	if _, err := client.Resource(crds).Create(ctx, crd, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create VolumeSnapshot CRD: %v", err)
+	}
+
+	snapshots := schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, err := client.Resource(snapshots).List(ctx, metav1.ListOptions{}); err == nil {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("VolumeSnapshot CRD not established: %v", err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func waitForScan(t *testing.T, svc *monitor.Service, timeout time.Duration) *monitor.ScanResult {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if result := svc.GetLastScanResult(); result != nil {
+			return result
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("no scan result after %s", timeout)
+	return nil
+}
+
+func resourceNames(resources []monitor.OrphanedResource) []string {
+	names := make([]string, 0, len(resources))
+	for _, r := range resources {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getJSON(t *testing.T, url string, out interface{}) {
+	t.Helper()
+
+	resp, err := http.Get(url) // #nosec G107 -- local test server
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decode %s: %v", url, err)
+	}
+}
@@ -0,0 +1 @@
+"""Integration tests for TrueNAS Storage Monitor."""
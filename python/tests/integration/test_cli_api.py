@@ -0,0 +1,174 @@
+"""CLI compatibility tests against the Go API server.
+
+The server is go/test/cliserver: the real API handlers over the k8stest and
+truenastest fakes, seeded with one bound volume (tank/k8s/nfs/pvc-data, used
+by apps/data) and one released PV whose dataset is gone. The tests check
+that the old flags, the exit codes and the JSON documents hold up against
+what the API actually returns.
+"""
+
+import json
+import shutil
+import subprocess
+from pathlib import Path
+from unittest.mock import patch
+
+import pytest
+from click.testing import CliRunner
+
+from truenas_storage_monitor.cli import EXIT_ERROR, EXIT_FAILED, cli
+
+pytestmark = pytest.mark.integration
+
+REPO_ROOT = Path(__file__).resolve().parents[3]
+SCHEMA_DIR = REPO_ROOT / "shared" / "schemas"
+
+
+def schema_errors(document, schema_name):
+    """Validate a document against a shared schema, skipping without jsonschema."""
+    jsonschema = pytest.importorskip("jsonschema")
+    schema = json.loads((SCHEMA_DIR / f"{schema_name}.json").read_text(encoding="utf-8"))
+    return [error.message for error in jsonschema.Draft7Validator(schema).iter_errors(document)]
+
+
+@pytest.fixture(scope="module")
+def api_url(tmp_path_factory):
+    """Build and start the fake-backed API server; yields its URL."""
+    go = shutil.which("go")
+    if go is None:
+        pytest.skip("go is not installed")
+    binary = tmp_path_factory.mktemp("cliserver") / "cliserver"
+    subprocess.run(
+        [go, "build", "-o", str(binary), "./test/cliserver"],
+        cwd=REPO_ROOT / "go",
+        check=True,
+        timeout=300,
+    )
+    # The server stops when its stdin is closed.
+    server = subprocess.Popen(
+        [str(binary)], stdin=subprocess.PIPE, stdout=subprocess.PIPE, text=True
+    )
+    try:
+        yield server.stdout.readline().strip()
+    finally:
+        server.stdin.close()
+        server.wait(timeout=10)
+        server.stdout.close()
+
+
+@pytest.fixture
+def runner(api_url):
+    """Invokes the CLI with --api-url and an empty configuration."""
+    with patch("truenas_storage_monitor.cli.load_config", return_value={}):
+        yield lambda args: CliRunner().invoke(cli, ["--api-url", api_url, *args])
+
+
+class TestOrphans:
+    """orphans reads GET /api/v1/orphans."""
+
+    def test_json_matches_schema(self, runner):
+        result = runner(["orphans", "--output", "json"])
+        assert result.exit_code == 0, result.output
+        document = json.loads(result.stdout)
+        assert [r["name"] for r in document["orphaned_resources"]] == ["pvc-gone"]
+        assert document["summary"]["total_orphans"] == 1
+        orphan = document["orphaned_resources"][0]
+        assert orphan["location"] == "Kubernetes"
+        assert orphan["age"] >= 72 * 3600
+        assert schema_errors(document, "orphaned-resources") == []
+
+    def test_storage_class_filter(self, runner):
+        result = runner(["orphans", "-o", "json", "--storage-class", "democratic-csi-nfs"])
+        assert len(json.loads(result.stdout)["orphaned_resources"]) == 1
+
+        result = runner(["orphans", "-o", "json", "--storage-class", "other"])
+        assert json.loads(result.stdout)["orphaned_resources"] == []
+
+    def test_table(self, runner):
+        result = runner(["orphans"])
+        assert result.exit_code == 0, result.output
+        assert "pvc-gone" in result.stdout
+
+    def test_deprecated_format(self, runner):
+        result = runner(["orphans", "-f", "json"])
+        assert result.exit_code == 0, result.output
+        assert json.loads(result.stdout)["summary"]["total_orphans"] == 1
+        assert "--format is deprecated" in result.stderr
+
+
+class TestWhois:
+    """whois reads GET /api/v1/truenas/datasets/{dataset}/owner."""
+
+    def test_found(self, runner):
+        result = runner(["whois", "tank/k8s/nfs/pvc-data", "-o", "json"])
+        assert result.exit_code == 0, result.output
+        owner = json.loads(result.stdout)
+        assert owner["found"] is True
+        assert owner["persistent_volume"] == "pvc-data"
+        assert (owner["namespace"], owner["persistent_volume_claim"]) == ("apps", "data")
+        assert owner["workloads"][0]["pods"] == ["web-7d9f-abcde"]
+
+    def test_not_found_exits_1(self, runner):
+        result = runner(["whois", "other/x", "-o", "json"])
+        assert result.exit_code == EXIT_FAILED
+        owner = json.loads(result.stdout)
+        assert owner["found"] is False
+        assert owner["managed_prefixes"] == ["tank/k8s/nfs"]
+        assert owner["note"] == "dataset is outside the managed prefixes"
+
+    def test_not_found_table_notes_prefixes(self, runner):
+        result = runner(["whois", "other/x"])
+        assert result.exit_code == EXIT_FAILED
+        assert "No PersistentVolume uses other/x" in result.stdout
+        assert "tank/k8s/nfs" in result.stderr
+
+    def test_deprecated_format(self, runner):
+        result = runner(["whois", "tank/k8s/nfs/pvc-data", "--format", "json"])
+        assert json.loads(result.stdout)["found"] is True
+        assert "--format is deprecated" in result.stderr
+
+
+class TestValidate:
+    """validate reads GET /api/v1/validate."""
+
+    def test_json_matches_schema(self, runner):
+        result = runner(["validate", "-o", "json"])
+        assert result.exit_code == 0, result.output
+        document = json.loads(result.stdout)
+        assert document["validation_summary"]["overall_status"] == "healthy"
+        assert {check["name"] for check in document["checks"]} >= {"kubernetes", "truenas"}
+        assert schema_errors(document, "config-validation") == []
+
+
+class TestReport:
+    """report writes GET /api/v1/reports/detailed to a file."""
+
+    def test_json(self, runner, tmp_path):
+        path = tmp_path / "report.json"
+        result = runner(["report", "--file", str(path), "-f", "json", "-o", "json"])
+        assert result.exit_code == 0, result.output
+        assert json.loads(result.stdout) == {"path": str(path), "format": "json"}
+        assert json.loads(path.read_text())["analysis"]["pools"][0]["name"] == "tank"
+
+    def test_deprecated_output_path(self, runner, tmp_path):
+        path = tmp_path / "old.html"
+        result = runner(["report", "--output", str(path)])
+        assert result.exit_code == 0, result.output
+        assert f"Report saved to: {path}" in result.stdout
+        assert "use --file PATH" in result.stderr
+        assert "<html" in path.read_text().lower()
+
+        new = tmp_path / "new.html"
+        result = runner(["report", "-o", str(path), "--file", str(new)])
+        assert f"Report saved to: {new}" in result.stdout
+
+    def test_pdf_exits_1(self, runner, tmp_path):
+        result = runner(["report", "--file", str(tmp_path / "out.pdf"), "-f", "pdf"])
+        assert result.exit_code == EXIT_ERROR
+        assert not (tmp_path / "out.pdf").exists()
+
+
+def test_unreachable_api_exits_1():
+    with patch("truenas_storage_monitor.cli.load_config", return_value={}):
+        result = CliRunner().invoke(cli, ["--api-url", "http://127.0.0.1:9", "validate"])
+    assert result.exit_code == EXIT_ERROR
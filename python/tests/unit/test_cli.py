@@ -0,0 +1,147 @@
+"""Tests for CLI commands, their JSON output and exit codes."""
+
+import json
+from pathlib import Path
+from unittest.mock import Mock, patch
+
+import pytest
+import yaml
+from click.shell_completion import CompletionItem
+from click.testing import CliRunner
+
+from truenas_storage_monitor import cli as cli_module
+from truenas_storage_monitor.cli import (
+    COMPLETE_VAR,
+    EXIT_ERROR,
+    cli,
+    complete_namespaces,
+    complete_storage_classes,
+)
+
+
+@pytest.fixture
+def runner():
+    """A runner whose commands load an empty configuration."""
+    with patch("truenas_storage_monitor.cli.load_config", return_value={}):
+        yield CliRunner()
+
+
+@pytest.fixture
+def monitor():
+    """The Monitor the commands construct."""
+    instance = Mock()
+    with patch("truenas_storage_monitor.monitor.Monitor", return_value=instance):
+        yield instance
+
+
+class TestJSONOutput:
+    """Every command prints one parseable JSON document with --output json."""
+
+    def test_analyze(self, runner, monitor):
+        monitor.analyze_storage_usage.return_value = {"total_used_bytes": 1024}
+        result = runner.invoke(cli, ["analyze", "--trend", "30d", "-o", "json"])
+        assert result.exit_code == 0, result.output
+        assert json.loads(result.stdout) == {"total_used_bytes": 1024}
+        monitor.analyze_storage_usage.assert_called_once_with(days=30)
+
+    def test_monitor_daemon(self, runner):
+        result = runner.invoke(cli, ["monitor", "--daemon", "-o", "json"])
+        assert result.exit_code == 0, result.output
+        assert json.loads(result.stdout) == {"event": "started", "daemon": True}
+
+
+class TestGlobalFlags:
+    """Global flags and exit codes."""
+
+    def test_quiet_suppresses_progress(self, runner):
+        result = runner.invoke(cli, ["--quiet", "orphans", "-o", "json"])
+        assert result.exit_code == 0
+        assert result.stderr == ""
+
+        result = runner.invoke(cli, ["orphans", "-o", "json"])
+        assert "Checking for orphaned resources" in result.stderr
+
+    def test_no_color(self, runner):
+        try:
+            result = runner.invoke(cli, ["--no-color", "orphans"])
+            assert result.exit_code == 0
+            assert cli_module.console.no_color and cli_module.err_console.no_color
+        finally:
+            cli_module.console.no_color = False
+            cli_module.err_console.no_color = False
+
+    def test_config_error_exits_1(self):
+        with patch("truenas_storage_monitor.cli.load_config", side_effect=ValueError("bad")):
+            result = CliRunner().invoke(cli, ["orphans"])
+        assert result.exit_code == EXIT_ERROR == 1
+        assert "bad" in result.stderr
+
+    def test_usage_error_exits_2(self, runner):
+        assert runner.invoke(cli, ["orphans", "-o", "yaml"]).exit_code == 2
+
+
+class TestDeprecatedFlags:
+    """Flags from before --output was the output format still work and warn."""
+
+    def test_format_is_hidden(self, runner):
+        result = runner.invoke(cli, ["orphans", "--help"])
+        assert "--format" not in result.stdout
+
+
+class TestCompletion:
+    """Shell completion scripts and dynamic values."""
+
+    @pytest.mark.parametrize("shell", ["bash", "zsh", "fish"])
+    def test_script_skips_config(self, shell):
+        with patch("truenas_storage_monitor.cli.load_config") as load:
+            result = CliRunner().invoke(cli, ["completion", shell])
+        assert result.exit_code == 0, result.output
+        assert COMPLETE_VAR in result.stdout
+        load.assert_not_called()
+
+    def test_namespaces_and_storage_classes(self):
+        client = Mock()
+        client.list_namespaces.return_value = ["prod", "apps", "payments"]
+        client.get_storage_classes.return_value = [{"name": "nfs"}, {"name": "iscsi"}]
+        with patch("truenas_storage_monitor.cli._completion_k8s_client", return_value=client):
+            namespaces = complete_namespaces(Mock(), Mock(), "p")
+            classes = complete_storage_classes(Mock(), Mock(), "")
+        assert [item.value for item in namespaces] == ["payments", "prod"]
+        assert all(isinstance(item, CompletionItem) for item in classes)
+        assert [item.value for item in classes] == ["iscsi", "nfs"]
+
+    def test_cluster_errors_complete_nothing(self):
+        client = Mock()
+        client.list_namespaces.side_effect = RuntimeError("forbidden")
+        with patch("truenas_storage_monitor.cli._completion_k8s_client", return_value=client):
+            assert complete_namespaces(Mock(), Mock(), "") == []
+        with patch("truenas_storage_monitor.cli._completion_k8s_client", return_value=None):
+            assert complete_storage_classes(Mock(), Mock(), "") == []
+
+
+class TestConfigMigrate:
+    """config migrate rewrites a file into the Go services' format."""
+
+    def test_migrate(self):
+        runner = CliRunner()
+        with patch("truenas_storage_monitor.cli.load_config") as load, runner.isolated_filesystem():
+            Path("old.yaml").write_text(
+                '{"openshift": {"namespace": "csi"}, "monitoring": {"orphan_threshold": "2d"}}'
+            )
+            result = runner.invoke(cli, ["config", "migrate", "-i", "old.yaml", "-o", "new.yaml"])
+            migrated = yaml.safe_load(Path("new.yaml").read_text())
+        assert result.exit_code == 0, result.output
+        load.assert_not_called()
+        assert migrated == {
+            "kubernetes": {"namespace": "csi"},
+            "monitor": {"orphan_threshold": "48h"},
+        }
+        assert "key openshift.namespace mapped to kubernetes.namespace" in result.stderr
+
+    def test_invalid_value_exits_1(self):
+        runner = CliRunner()
+        with runner.isolated_filesystem():
+            Path("old.yaml").write_text('{"monitoring": {"orphan_threshold": "soon"}}')
+            result = runner.invoke(cli, ["config", "migrate", "-i", "old.yaml"])
+        assert result.exit_code == EXIT_ERROR
+        assert "orphan_threshold" in result.stderr
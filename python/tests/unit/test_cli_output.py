@@ -0,0 +1,76 @@
+"""Golden-file tests for CLI table output.
+
+Set UPDATE_GOLDEN=1 to rewrite the golden files after an intended change.
+"""
+
+import io
+import os
+from datetime import timedelta
+from pathlib import Path
+
+from rich.console import Console
+
+from truenas_storage_monitor.cli import orphans_table, storage_summary_table
+
+GOLDEN_DIR = Path(__file__).parent / "golden"
+
+
+def render(table) -> str:
+    """Render a table without color at a fixed width."""
+    output = io.StringIO()
+    Console(file=output, width=80, color_system=None, force_terminal=False).print(table)
+    return output.getvalue()
+
+
+def assert_golden(name: str, actual: str) -> None:
+    """Compare output with a golden file, rewriting it with UPDATE_GOLDEN=1."""
+    path = GOLDEN_DIR / name
+    if os.environ.get("UPDATE_GOLDEN"):
+        path.write_text(actual, encoding="utf-8")
+    assert actual == path.read_text(encoding="utf-8")
+
+
+class TestCLIOutput:
+    """Test cases for CLI table rendering."""
+
+    def test_orphans_table(self):
+        """Ages and sizes are humanized."""
+        table = orphans_table(
+            [
+                {
+                    "type": "PersistentVolume",
+                    "name": "pvc-12345",
+                    "age": timedelta(days=3, hours=4, minutes=10),
+                    "size_bytes": 10 * 1024**3,
+                },
+                {
+                    "type": "PersistentVolumeClaim",
+                    "name": "data",
+                    "namespace": "apps",
+                    "age": timedelta(minutes=90),
+                    "size_bytes": 512 * 1024**2,
+                },
+                {
+                    "type": "VolumeSnapshot",
+                    "name": "daily-2024-06-01",
+                    "namespace": "apps",
+                    "age": timedelta(days=30),
+                    "size_bytes": None,
+                },
+            ]
+        )
+        assert_golden("orphans_table.txt", render(table))
+
+    def test_storage_summary_table(self):
+        """Byte totals are humanized."""
+        table = storage_summary_table(
+            {
+                "total_allocated_bytes": 15 * 1024**3,
+                "total_used_bytes": 8 * 1024**3 + 512 * 1024**2,
+                "thin_provisioning_efficiency": "43.3%",
+                "total_pvcs": 3,
+                "total_pvs": 4,
+                "growth_trend": "Stable",
+            }
+        )
+        assert_golden("storage_summary_table.txt", render(table))
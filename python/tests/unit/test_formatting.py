@@ -0,0 +1,53 @@
+"""Unit tests for human-readable formatting helpers."""
+
+from datetime import timedelta
+
+import pytest
+
+from truenas_storage_monitor.formatting import format_bytes, format_duration, format_percent
+
+
+class TestFormatting:
+    """Test cases for formatting helpers."""
+
+    @pytest.mark.parametrize(
+        "size,expected",
+        [
+            (0, "0B"),
+            (1023, "1023B"),
+            (1024, "1.0KiB"),
+            (1536, "1.5KiB"),
+            (10 * 1024**3, "10.0GiB"),
+            (3 * 1024**4, "3.0TiB"),
+            (-2048, "-2.0KiB"),
+            (None, "-"),
+        ],
+    )
+    def test_format_bytes(self, size, expected):
+        """Byte counts use binary units with one decimal."""
+        assert format_bytes(size) == expected
+
+    @pytest.mark.parametrize(
+        "duration,expected",
+        [
+            (timedelta(0), "0s"),
+            (timedelta(milliseconds=500), "0s"),
+            (timedelta(seconds=45), "45s"),
+            (timedelta(minutes=90), "1h30m"),
+            (timedelta(days=2), "2d"),
+            (timedelta(days=3, hours=4, minutes=10), "3d4h"),
+            (timedelta(days=2, minutes=5), "2d"),
+            (timedelta(hours=-2), "-2h"),
+            (3600, "1h"),
+            (None, "-"),
+        ],
+    )
+    def test_format_duration(self, duration, expected):
+        """Durations show their two largest units."""
+        assert format_duration(duration) == expected
+
+    def test_format_percent(self):
+        """Percentages have one decimal."""
+        assert format_percent(44.444) == "44.4%"
+        assert format_percent(90) == "90.0%"
+        assert format_percent(None) == "-"
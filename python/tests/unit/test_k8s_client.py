@@ -66,6 +66,42 @@ class TestK8sClient:
                 assert client.config == mock_k8s_config
                 mock_config.load_kube_config.assert_called_once()
 
+    def test_client_initialization_context_and_impersonation(self):
+        """The kubeconfig context is loaded and impersonation headers are set."""
+        config = K8sConfig(
+            kubeconfig="/tmp/kubeconfig",
+            context="staging",
+            impersonate_user="system:serviceaccount:storage:scanner",
+            impersonate_groups=["system:serviceaccounts"],
+        )
+        with patch("truenas_storage_monitor.k8s_client.config") as mock_config:
+            with patch("truenas_storage_monitor.k8s_client.k8s_client") as mock_api:
+                K8sClient(config)
+                mock_config.load_kube_config.assert_called_once_with(
+                    config_file="/tmp/kubeconfig", context="staging"
+                )
+                api_client = mock_api.ApiClient.return_value
+                api_client.set_default_header.assert_any_call(
+                    "Impersonate-User", "system:serviceaccount:storage:scanner"
+                )
+                api_client.set_default_header.assert_any_call(
+                    "Impersonate-Group", "system:serviceaccounts"
+                )
+
+    def test_effective_user(self, mock_client):
+        """The effective user comes from a SelfSubjectReview."""
+        mock_client.authentication_v1 = Mock()
+        info = mock_client.authentication_v1.create_self_subject_review.return_value.status.user_info
+        info.username = "system:serviceaccount:storage:scanner"
+        info.uid = "1234"
+        info.groups = ["system:serviceaccounts"]
+
+        assert mock_client.effective_user() == {
+            "username": "system:serviceaccount:storage:scanner",
+            "uid": "1234",
+            "groups": ["system:serviceaccounts"],
+        }
+
     def test_client_initialization_in_cluster(self):
         """Test in-cluster client initialization."""
         config = K8sConfig(in_cluster=True)
@@ -219,6 +255,41 @@ class TestK8sClient:
         assert pods[0]["name"] == "democratic-csi-controller-0"
         assert pods[0]["status"] == "Running"
 
+    def test_get_pods_using_claim(self, mock_client):
+        """Test resolving the pods and workloads that mount a PVC."""
+
+        def make_pod(name, claim, phase="Running", owner=None, labels=None):
+            pod = Mock()
+            pod.metadata.name = name
+            pod.metadata.namespace = "apps"
+            pod.metadata.labels = labels or {}
+            pod.metadata.owner_references = [owner] if owner else []
+            pod.status.phase = phase
+            volume = Mock()
+            volume.persistent_volume_claim.claim_name = claim
+            pod.spec.volumes = [volume]
+            return pod
+
+        replica_set = Mock(kind="ReplicaSet", controller=True)
+        replica_set.name = "web-7d9f"
+        job = Mock(kind="Job", controller=True)
+        job.name = "migrate"
+        pods = [
+            make_pod("web-7d9f-abcde", "data", owner=replica_set, labels={"pod-template-hash": "7d9f"}),
+            make_pod("debug", "data", phase="Pending"),
+            make_pod("migrate-xyz", "data", phase="Succeeded", owner=job),
+            make_pod("other", "logs"),
+        ]
+        mock_client.core_v1.list_namespaced_pod.return_value = Mock(items=pods)
+
+        result = mock_client.get_pods_using_claim("apps", "data")
+
+        mock_client.core_v1.list_namespaced_pod.assert_called_once_with("apps")
+        assert [(p["name"], p["workload_kind"], p["workload_name"]) for p in result] == [
+            ("web-7d9f-abcde", "Deployment", "web"),
+            ("debug", "Pod", "debug"),
+        ]
+
     def test_check_csi_driver_health(self, mock_client):
         """Test checking CSI driver health."""
         # Mock healthy pods
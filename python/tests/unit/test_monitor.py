@@ -30,6 +30,12 @@ class TestMonitor:
         )
         config.orphan_threshold = timedelta(hours=24)
         config.snapshot_retention = timedelta(days=30)
+        config.orphan_thresholds = {
+            "persistent_volume": timedelta(hours=24),
+            "persistent_volume_claim": timedelta(hours=24),
+            "volume_snapshot": timedelta(hours=24),
+            "truenas_snapshot": timedelta(days=30),
+        }
         config.metrics_enabled = False
         return config
 
@@ -98,6 +104,10 @@ class TestMonitor:
         assert "timestamp" in result
         assert result["total_pvs"] == 1
         assert result["total_pvcs"] == 1
+        assert result["total_k8s_snapshots"] == 0
+        assert result["total_truenas_snapshots"] == 0
+        assert result["total_snapshots"] == 0
+        assert "total_snapshots" in result["deprecated"]
         assert len(result["orphaned_pvs"]) == 1
         assert result["orphaned_pvs"][0]["name"] == "pv-test"
         assert len(result["orphaned_pvcs"]) == 1
@@ -265,6 +275,47 @@ class TestMonitor:
         assert result["components"]["truenas"]["healthy"] is True
         assert result["components"]["csi_driver"]["healthy"] is False
 
+    def test_find_dataset_owner(self, monitor):
+        """Test resolving a dataset to its PV, PVC and workloads."""
+        monitor.k8s_client.get_storage_classes.return_value = [
+            {"name": "nfs", "parameters": {"datasetParentName": "tank/k8s/nfs/v"}},
+        ]
+        monitor.k8s_client.get_persistent_volumes.return_value = [
+            PersistentVolumeInfo(
+                name="pvc-1",
+                volume_handle="pvc-1",
+                driver="org.democratic-csi.nfs",
+                capacity="10Gi",
+                access_modes=["ReadWriteOnce"],
+                phase="Bound",
+                storage_class="nfs",
+                claim_ref={"name": "data", "namespace": "apps"},
+            )
+        ]
+        monitor.k8s_client.get_pods_using_claim.return_value = [
+            {"name": "db-1", "workload_kind": "StatefulSet", "workload_name": "db"},
+            {"name": "db-0", "workload_kind": "StatefulSet", "workload_name": "db"},
+        ]
+
+        owner = monitor.find_dataset_owner("tank/k8s/nfs/v/pvc-1")
+
+        assert owner["found"] is True
+        assert owner["persistent_volume"] == "pvc-1"
+        assert owner["persistent_volume_claim"] == "data"
+        assert owner["workloads"] == [
+            {"kind": "StatefulSet", "name": "db", "pods": ["db-0", "db-1"]}
+        ]
+        monitor.k8s_client.get_pods_using_claim.assert_called_once_with("apps", "data")
+
+        missing = monitor.find_dataset_owner("tank/k8s/nfs/v/pvc-2")
+        assert missing["found"] is False
+        assert "note" not in missing
+
+        outside = monitor.find_dataset_owner("tank/home")
+        assert outside["found"] is False
+        assert outside["managed_prefixes"] == ["tank/k8s/nfs/v"]
+        assert outside["note"] == "dataset is outside the managed prefixes"
+
     def test_generate_recommendations(self, monitor):
         """Test recommendation generation."""
         mock_pvcs = [
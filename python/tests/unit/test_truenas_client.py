@@ -8,6 +8,7 @@ from truenas_storage_monitor.truenas_client import (
     TrueNASConfig,
     TrueNASError,
     AuthenticationError,
+    ResolveOverrideAdapter,
 )
 
 
@@ -410,6 +411,62 @@ class TestTrueNASClient:
         with pytest.raises(TrueNASError, match="timeout"):
             mock_client.get_pools()
 
+    def test_proxy_errors_name_the_failing_hop(self, mock_client):
+        """Proxy errors tell the proxy apart from an unreachable TrueNAS."""
+        import requests
+
+        mock_client.session.get.side_effect = requests.exceptions.ProxyError(
+            "Tunnel connection failed: 502 Bad Gateway"
+        )
+        with pytest.raises(TrueNASError, match="Proxy could not connect to TrueNAS"):
+            mock_client.test_connection()
+
+        mock_client.session.get.side_effect = requests.exceptions.ProxyError(
+            "Cannot connect to proxy."
+        )
+        with pytest.raises(TrueNASError, match="Failed to connect to proxy"):
+            mock_client.test_connection()
+
+    def test_proxy_and_resolve_override_configure_session(self):
+        """proxy_url sets the session proxies and resolve_override mounts an adapter."""
+        config = TrueNASConfig(
+            host="truenas.example.com",
+            api_key="test-api-key",
+            proxy_url="http://proxy.local:3128",
+            resolve_override={"truenas.example.com": "10.20.0.5"},
+        )
+        with patch("truenas_storage_monitor.truenas_client.requests.Session"):
+            client = TrueNASClient(config)
+
+        assert client.session.proxies == {
+            "http": "http://proxy.local:3128",
+            "https": "http://proxy.local:3128",
+        }
+        prefix, adapter = client.session.mount.call_args_list[-1].args
+        assert prefix == "https://truenas.example.com"
+        assert isinstance(adapter, ResolveOverrideAdapter)
+
+    def test_resolve_override_adapter_rewrites_direct_requests(self):
+        """Direct requests dial the override address but keep the Host header."""
+        import requests
+
+        adapter = ResolveOverrideAdapter("truenas.example.com", "10.20.0.5", tls=True)
+        request = requests.Request(
+            "GET", "https://truenas.example.com:8443/api/v2.0/pool"
+        ).prepare()
+        with patch("requests.adapters.HTTPAdapter.send") as send:
+            adapter.send(request, proxies={})
+
+        sent = send.call_args.args[0]
+        assert sent.url == "https://10.20.0.5:8443/api/v2.0/pool"
+        assert sent.headers["Host"] == "truenas.example.com:8443"
+        assert adapter.poolmanager.connection_pool_kw["server_hostname"] == "truenas.example.com"
+
+        proxied = requests.Request("GET", "https://truenas.example.com/api/v2.0/pool").prepare()
+        with patch("requests.adapters.HTTPAdapter.send") as send:
+            adapter.send(proxied, proxies={"https": "http://proxy.local:3128"})
+        assert send.call_args.args[0].url == "https://truenas.example.com/api/v2.0/pool"
+
     def test_pagination(self, mock_client):
         """Test handling paginated responses."""
         mock_response = Mock()
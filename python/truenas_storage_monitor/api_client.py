@@ -0,0 +1,103 @@
+"""Client for the Go API server's /api/v1 endpoints.
+
+The CLI reads orphans, validation results, dataset owners and reports from
+the API server when ``--api-url`` is set, so its output matches what the Go
+services compute.
+"""
+
+from datetime import timedelta
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import quote
+
+import requests
+
+from .exceptions import ConnectionError, TrueNASMonitorError
+
+# Lists of an orphan report, in the order the CLI shows them.
+ORPHAN_LISTS = (
+    "orphaned_pvs",
+    "orphaned_pvcs",
+    "orphaned_snapshots",
+    "orphaned_truenas_volumes",
+)
+
+
+class APIClient:
+    """Reads results from a running API server."""
+
+    def __init__(self, base_url: str, timeout: float = 30.0) -> None:
+        self.base_url = base_url.rstrip("/")
+        self.timeout = timeout
+        self.session = requests.Session()
+
+    def _get(
+        self, path: str, params: Optional[Dict[str, str]] = None, not_found_ok: bool = False
+    ) -> requests.Response:
+        url = f"{self.base_url}/api/v1{path}"
+        try:
+            response = self.session.get(url, params=params, timeout=self.timeout)
+        except requests.RequestException as e:
+            raise ConnectionError(f"API server at {self.base_url} is unreachable: {e}") from e
+        if response.ok or (not_found_ok and response.status_code == 404):
+            return response
+        try:
+            message = response.json()["message"]
+        except (ValueError, KeyError, TypeError):
+            message = response.text.strip() or response.reason
+        raise TrueNASMonitorError(f"GET {path}: {response.status_code} {message}")
+
+    def orphans(self, namespace: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Return the orphaned resources, with ``age`` as a timedelta.
+
+        The API reports ages in nanoseconds and splits orphans into one list
+        per type; they are flattened here.
+        """
+        params = {"namespace": namespace} if namespace else None
+        report = self._get("/orphans", params).json()
+        resources = []
+        for key in ORPHAN_LISTS:
+            for orphan in report.get(key) or []:
+                resource = dict(orphan)
+                resource["age"] = timedelta(microseconds=orphan.get("age", 0) / 1000)
+                resource["location"] = (
+                    "TrueNAS" if orphan["type"].startswith("TrueNAS") else "Kubernetes"
+                )
+                resources.append(resource)
+        return resources
+
+    def validation_checks(self) -> List[Tuple[str, bool]]:
+        """Return each validation check's name and whether it passed.
+
+        Checks with warnings pass; only ``failed`` fails.
+        """
+        checks = self._get("/validate").json().get("checks") or {}
+        return [(name, check.get("status") != "failed") for name, check in sorted(checks.items())]
+
+    def dataset_owner(self, dataset: str) -> Dict[str, Any]:
+        """Return the owner of a dataset in the shape of Monitor.find_dataset_owner."""
+        response = self._get(
+            f"/truenas/datasets/{quote(dataset, safe='')}/owner", not_found_ok=True
+        )
+        body = response.json()
+        if response.status_code == 404:
+            details = body.get("details") or {}
+            result = {
+                "found": False,
+                "dataset": dataset.strip("/"),
+                "managed_prefixes": details.get("managed_prefixes") or [],
+            }
+            if details.get("note"):
+                result["note"] = details["note"]
+            return result
+        return {
+            "found": True,
+            "storage_class": None,
+            "namespace": None,
+            "persistent_volume_claim": None,
+            "workloads": [],
+            **body["owner"],
+        }
+
+    def detailed_report(self, format: str) -> bytes:
+        """Return the detailed report rendered as ``json`` or ``html``."""
+        return self._get("/reports/detailed", {"format": format}).content
@@ -1,17 +1,207 @@
 """Command-line interface for TrueNAS Storage Monitor."""
 
+import json
 import sys
-from typing import Optional
+from datetime import datetime, timedelta, timezone
+from typing import Any, Callable, Dict, List, Optional
 
 import click
+import yaml
+from click.shell_completion import CompletionItem, get_completion_class
 from rich.console import Console
 from rich.table import Table
 
 from . import __version__
-from .config import load_config
+from .api_client import APIClient
+from .config import FORMAT_GO, detect_format, load_config, migrate_config, validate_config
 from .exceptions import TrueNASMonitorError
+from .formatting import format_bytes, format_duration
 
+# Results go to stdout; progress and notes go to stderr so that
+# ``--output json`` leaves stdout parseable.
 console = Console()
+err_console = Console(stderr=True)
+
+# Exit codes shared by every command.
+EXIT_OK = 0
+EXIT_FAILED = 1  # the command ran and found a problem
+EXIT_USAGE = 2  # invalid flags or arguments (click's own code)
+# The command could not run: bad config, unreachable API. Scripts written
+# against earlier releases expect 1 here, so it stays 1.
+EXIT_ERROR = 1
+EXIT_INTERRUPTED = 130
+
+PROG_NAME = "truenas-monitor"
+COMPLETE_VAR = "_TRUENAS_MONITOR_COMPLETE"
+
+
+def output_option(*choices: str) -> Callable:
+    """The ``--output`` option every command takes; json is stable for scripts."""
+    return click.option(
+        "--output",
+        "-o",
+        "output",
+        type=click.Choice(choices or ("table", "json")),
+        default="table",
+        show_default=True,
+        help="Output format",
+    )
+
+
+def warn_deprecated(message: str) -> Callable:
+    """An option callback that prints message on stderr when the option is given."""
+
+    def callback(ctx: click.Context, param: click.Parameter, value: Any) -> Any:
+        if value is not None:
+            err_console.print(f"[yellow]Warning: {message}[/yellow]")
+        return value
+
+    return callback
+
+
+def format_option(*choices: str) -> Callable:
+    """The hidden ``-f/--format`` option that ``--output`` replaced.
+
+    It is kept for scripts written against earlier releases and overrides
+    ``--output`` when given; see :func:`effective_output`.
+    """
+    return click.option(
+        "--format",
+        "-f",
+        "legacy_format",
+        type=click.Choice(choices),
+        hidden=True,
+        callback=warn_deprecated("--format is deprecated; use --output"),
+    )
+
+
+def effective_output(output: str, legacy_format: Optional[str]) -> str:
+    """Return the output format, preferring the deprecated --format when given."""
+    return legacy_format or output
+
+
+def emit_json(data: Any) -> None:
+    """Print data as JSON on stdout. Durations become seconds and times ISO 8601."""
+
+    def default(value: Any) -> Any:
+        if isinstance(value, timedelta):
+            return value.total_seconds()
+        if isinstance(value, datetime):
+            return value.isoformat()
+        raise TypeError(f"{type(value).__name__} is not JSON serializable")
+
+    click.echo(json.dumps(data, indent=2, default=default))
+
+
+def status(ctx: click.Context, message: str) -> None:
+    """Print a progress message on stderr unless --quiet is set."""
+    if not (ctx.obj or {}).get("quiet"):
+        err_console.print(message)
+
+
+def _completion_k8s_client(ctx: click.Context) -> Any:
+    """Build a Kubernetes client from the root command's --config, or None."""
+    from .config import Config
+    from .k8s_client import K8sClient
+
+    try:
+        return K8sClient(Config(ctx.find_root().params.get("config")).k8s_config())
+    except Exception:
+        return None
+
+
+def complete_namespaces(
+    ctx: click.Context, param: click.Parameter, incomplete: str
+) -> List[CompletionItem]:
+    """Complete namespace names from the cluster; errors complete nothing."""
+    client = _completion_k8s_client(ctx)
+    if client is None:
+        return []
+    try:
+        names = client.list_namespaces()
+    except Exception:
+        return []
+    return [CompletionItem(name) for name in sorted(names) if name.startswith(incomplete)]
+
+
+def complete_storage_classes(
+    ctx: click.Context, param: click.Parameter, incomplete: str
+) -> List[CompletionItem]:
+    """Complete StorageClass names from the cluster; errors complete nothing."""
+    client = _completion_k8s_client(ctx)
+    if client is None:
+        return []
+    try:
+        names = [storage_class["name"] for storage_class in client.get_storage_classes()]
+    except Exception:
+        return []
+    return [CompletionItem(name) for name in sorted(names) if name.startswith(incomplete)]
+
+
+def orphans_table(resources: List[Dict[str, Any]]) -> Table:
+    """Build the orphaned resources table.
+
+    Each resource has ``type``, ``name`` and ``namespace``, ``age`` as a
+    timedelta and ``size_bytes`` as an int or None.
+    """
+    table = Table(title="Orphaned Resources")
+    table.add_column("Type", style="cyan")
+    table.add_column("Name", style="magenta")
+    table.add_column("Namespace")
+    table.add_column("Age", justify="right")
+    table.add_column("Size", justify="right")
+    for resource in resources:
+        table.add_row(
+            resource["type"],
+            resource["name"],
+            resource.get("namespace") or "-",
+            format_duration(resource.get("age")),
+            format_bytes(resource.get("size_bytes")),
+        )
+    return table
+
+
+def storage_summary_table(analysis: Dict[str, Any]) -> Table:
+    """Build the storage analysis summary table from Monitor.analyze_storage_usage."""
+    table = Table(title="Storage Analysis Summary")
+    table.add_column("Metric", style="cyan")
+    table.add_column("Value", justify="right")
+    table.add_row("Total Allocated", format_bytes(analysis["total_allocated_bytes"]))
+    table.add_row("Total Used", format_bytes(analysis["total_used_bytes"]))
+    table.add_row("Thin Provisioning Efficiency", analysis["thin_provisioning_efficiency"])
+    table.add_row("PersistentVolumeClaims", str(analysis["total_pvcs"]))
+    table.add_row("PersistentVolumes", str(analysis["total_pvs"]))
+    table.add_row("Growth Trend", analysis["growth_trend"])
+    return table
+
+
+def apply_cluster_overrides(
+    config: Dict[str, Any],
+    context: Optional[str] = None,
+    user: Optional[str] = None,
+    group: Optional[str] = None,
+    uid: Optional[str] = None,
+) -> None:
+    """Override the kubeconfig context and impersonation from CLI flags.
+
+    The result is validated again, so flags obey the same rules as the
+    ``openshift`` section.
+    """
+    if not any((context, user, group, uid)):
+        return
+    cluster = config.setdefault("openshift", {})
+    if context:
+        cluster["context"] = context
+    impersonate = dict(cluster.get("impersonate") or {})
+    if user:
+        impersonate["user"] = user
+    if group:
+        impersonate["groups"] = [group]
+    if uid:
+        impersonate["uid"] = uid
+    if impersonate:
+        cluster["impersonate"] = impersonate
+    validate_config(config)
 
 
 @click.group()
@@ -30,49 +220,153 @@ console = Console()
     default="info",
     help="Set logging level",
 )
+@click.option("--context", "kube_context", help="Kubeconfig context to use")
+@click.option("--as", "as_user", help="User to impersonate for Kubernetes requests")
+@click.option("--as-group", "as_group", help="Group to impersonate (requires --as)")
+@click.option("--as-uid", "as_uid", help="UID to impersonate (requires --as)")
+@click.option(
+    "--api-url",
+    help="Read results from the API server at this URL",
+    envvar="TRUENAS_MONITOR_API_URL",
+)
+@click.option("--no-color", is_flag=True, help="Disable colored output")
+@click.option("--quiet", "-q", is_flag=True, help="Suppress progress messages")
 @click.pass_context
-def cli(ctx: click.Context, config: Optional[str], log_level: str) -> None:
-    """TrueNAS Storage Monitor - Comprehensive monitoring for OpenShift/Kubernetes with TrueNAS."""
+def cli(
+    ctx: click.Context,
+    config: Optional[str],
+    log_level: str,
+    kube_context: Optional[str],
+    as_user: Optional[str],
+    as_group: Optional[str],
+    as_uid: Optional[str],
+    api_url: Optional[str],
+    no_color: bool,
+    quiet: bool,
+) -> None:
+    """TrueNAS Storage Monitor - Comprehensive monitoring for OpenShift/Kubernetes with TrueNAS.
+
+    Every command takes --output json, which prints a single JSON document
+    on stdout; progress messages go to stderr.
+
+    \b
+    Exit codes:
+      0    success
+      1    the command ran and found a problem (failed check, no match),
+           or it could not run (bad configuration, unreachable API)
+      2    invalid flags or arguments
+      130  interrupted
+    """
     ctx.ensure_object(dict)
-
+    ctx.obj["quiet"] = quiet
+    ctx.obj["api"] = APIClient(api_url) if api_url else None
+    if no_color:
+        console.no_color = True
+        err_console.no_color = True
+
+    if ctx.invoked_subcommand in ("completion", "config"):
+        return
     try:
-        ctx.obj["config"] = load_config(config)
+        loaded = load_config(config)
+        apply_cluster_overrides(loaded, kube_context, as_user, as_group, as_uid)
+        ctx.obj["config"] = loaded
         ctx.obj["log_level"] = log_level
     except Exception as e:
-        console.print(f"[red]Error loading configuration: {e}[/red]")
-        sys.exit(1)
+        err_console.print(f"[red]Error loading configuration: {e}[/red]")
+        sys.exit(EXIT_ERROR)
+
+
+def orphans_document(resources: List[Dict[str, Any]], now: datetime) -> Dict[str, Any]:
+    """Build the ``orphans --output json`` document.
+
+    It follows shared/schemas/orphaned-resources.json; ``age`` is kept in
+    seconds next to ``created_at``, which is derived from it when the
+    resource has none.
+    """
+    orphaned = []
+    for resource in resources:
+        entry = dict(resource)
+        entry.setdefault("created_at", (now - resource["age"]).isoformat())
+        orphaned.append(entry)
+    return {
+        "timestamp": now.isoformat(),
+        "summary": {"total_orphans": len(orphaned)},
+        "orphaned_resources": orphaned,
+    }
+
+
+def placeholder_orphans() -> List[Dict[str, Any]]:
+    """Example orphans shown when no API server is configured."""
+    return [
+        {
+            "type": "PersistentVolume",
+            "name": "pvc-12345",
+            "namespace": "default",
+            "storage_class": "democratic-csi-nfs",
+            "location": "Kubernetes",
+            "reason": "No corresponding TrueNAS volume found",
+            "age": timedelta(days=7),
+            "size_bytes": 10 * 1024**3,
+        },
+        {
+            "type": "VolumeSnapshot",
+            "name": "snapshot-67890",
+            "namespace": "production",
+            "storage_class": "democratic-csi-nfs",
+            "location": "Kubernetes",
+            "reason": "No corresponding TrueNAS snapshot found",
+            "age": timedelta(days=30),
+            "size_bytes": 5 * 1024**3,
+        },
+    ]
 
 
 @cli.command()
+@output_option()
+@format_option("table", "json", "yaml")
 @click.option(
-    "--format",
-    "-f",
-    type=click.Choice(["table", "json", "yaml"]),
-    default="table",
-    help="Output format",
+    "--namespace",
+    "-n",
+    help="Only show orphans in this namespace",
+    shell_complete=complete_namespaces,
+)
+@click.option(
+    "--storage-class",
+    help="Only show orphans of this StorageClass",
+    shell_complete=complete_storage_classes,
 )
 @click.pass_context
-def orphans(ctx: click.Context, format: str) -> None:
+def orphans(
+    ctx: click.Context,
+    output: str,
+    legacy_format: Optional[str],
+    namespace: Optional[str],
+    storage_class: Optional[str],
+) -> None:
     """Check for orphaned resources."""
-    console.print("[yellow]Checking for orphaned resources...[/yellow]")
-
-    # TODO: Implement orphan detection
+    output = effective_output(output, legacy_format)
+    status(ctx, "[yellow]Checking for orphaned resources...[/yellow]")
 
-    if format == "table":
-        table = Table(title="Orphaned Resources")
-        table.add_column("Type", style="cyan")
-        table.add_column("Name", style="magenta")
-        table.add_column("Namespace")
-        table.add_column("Age")
-        table.add_column("Size")
-
-        # Example data
-        table.add_row("PV", "pvc-12345", "default", "7 days", "10Gi")
-        table.add_row("Snapshot", "snapshot-67890", "production", "30 days", "5Gi")
-
-        console.print(table)
+    api = ctx.obj.get("api")
+    if api is not None:
+        # The API filters by namespace itself and keeps the PVs bound to it.
+        resources = api.orphans(namespace)
     else:
-        console.print(f"[red]Format '{format}' not yet implemented[/red]")
+        resources = [
+            resource
+            for resource in placeholder_orphans()
+            if namespace is None or resource["namespace"] == namespace
+        ]
+    if storage_class is not None:
+        resources = [r for r in resources if r.get("storage_class") == storage_class]
+
+    if output == "json":
+        emit_json(orphans_document(resources, datetime.now(timezone.utc)))
+    elif output == "yaml":
+        # Only reachable through the deprecated --format, which offered it.
+        err_console.print("[red]Format 'yaml' not yet implemented[/red]")
+    else:
+        console.print(orphans_table(resources))
 
 
 @cli.command()
@@ -83,25 +377,34 @@ def orphans(ctx: click.Context, format: str) -> None:
     help="Time period for trend analysis (e.g., 7d, 30d)",
     default="7d",
 )
+@output_option()
 @click.pass_context
-def analyze(ctx: click.Context, trend: str) -> None:
+def analyze(ctx: click.Context, trend: str, output: str) -> None:
     """Analyze storage usage and trends."""
-    console.print(f"[yellow]Analyzing storage trends for the last {trend}...[/yellow]")
+    from .monitor import Monitor
 
-    # TODO: Implement storage analysis
+    status(ctx, f"[yellow]Analyzing storage trends for the last {trend}...[/yellow]")
 
-    console.print("\n[green]Storage Analysis Summary:[/green]")
-    console.print("• Total Allocated: 500Gi")
-    console.print("• Total Used: 350Gi (70%)")
-    console.print("• Thin Provisioning Savings: 150Gi")
-    console.print("• Growth Rate: 5Gi/day")
-    console.print("• Estimated Full: 30 days")
+    try:
+        days = int(trend.removesuffix("d"))
+    except ValueError:
+        raise click.BadParameter(
+            f"expected a number of days such as 7d, got {trend}", param_hint="--trend"
+        )
+    analysis = Monitor(ctx.obj["config"]).analyze_storage_usage(days=days)
+
+    if output == "json":
+        emit_json(analysis)
+        return
+    console.print(storage_summary_table(analysis))
+    for recommendation in analysis["recommendations"]:
+        console.print(f"• {recommendation}")
 
 
 @cli.command()
 @click.option(
-    "--output",
-    "-o",
+    "--file",
+    "path",
     type=click.Path(),
     help="Output file for the report",
     default="report.html",
@@ -113,43 +416,144 @@ def analyze(ctx: click.Context, trend: str) -> None:
     default="html",
     help="Report format",
 )
+@click.option(
+    "--output",
+    "-o",
+    "output",
+    metavar="[table|json]",
+    default="table",
+    show_default=True,
+    help="Output format",
+)
 @click.pass_context
-def report(ctx: click.Context, output: str, format: str) -> None:
+def report(ctx: click.Context, path: str, format: str, output: str) -> None:
     """Generate a comprehensive storage report."""
-    console.print(f"[yellow]Generating {format} report...[/yellow]")
+    if output not in ("table", "json"):
+        # Before --output was the output format it was the report file;
+        # that form still works, unless --file is given too.
+        err_console.print(
+            "[yellow]Warning: report --output PATH is deprecated; use --file PATH[/yellow]"
+        )
+        if ctx.get_parameter_source("path") == click.core.ParameterSource.DEFAULT:
+            path = output
+        output = "table"
+    status(ctx, f"[yellow]Generating {format} report...[/yellow]")
+
+    api = ctx.obj.get("api")
+    if api is not None:
+        if format == "pdf":
+            err_console.print("[red]The API server renders json and html reports only[/red]")
+            sys.exit(EXIT_ERROR)
+        with open(path, "wb") as f:
+            f.write(api.detailed_report(format))
+    # TODO: Implement report generation without an API server
+
+    if output == "json":
+        emit_json({"path": path, "format": format})
+    else:
+        console.print(f"[green]Report saved to: {path}[/green]")
 
-    # TODO: Implement report generation
 
-    console.print(f"[green]Report saved to: {output}[/green]")
+@cli.command()
+@click.argument("dataset")
+@output_option()
+@format_option("table", "json")
+@click.pass_context
+def whois(ctx: click.Context, dataset: str, output: str, legacy_format: Optional[str]) -> None:
+    """Show the PV, PVC and workloads using a TrueNAS dataset."""
+    from .monitor import Monitor
+
+    output = effective_output(output, legacy_format)
+
+    api = ctx.obj.get("api")
+    if api is not None:
+        owner = api.dataset_owner(dataset)
+    else:
+        owner = Monitor(ctx.obj["config"]).find_dataset_owner(dataset)
+
+    if output == "json":
+        emit_json(owner)
+    elif owner["found"]:
+        table = Table(title=f"Owner of {owner['dataset']}")
+        table.add_column("Field", style="cyan")
+        table.add_column("Value", style="magenta")
+        table.add_row("PersistentVolume", owner["persistent_volume"])
+        table.add_row("StorageClass", owner["storage_class"] or "-")
+        table.add_row("Namespace", owner["namespace"] or "-")
+        table.add_row("PersistentVolumeClaim", owner["persistent_volume_claim"] or "-")
+        for workload in owner["workloads"]:
+            table.add_row(
+                f"{workload['kind']}/{workload['name']}", ", ".join(workload["pods"])
+            )
+        console.print(table)
+    else:
+        console.print(f"[red]No PersistentVolume uses {owner['dataset']}[/red]")
+        if owner.get("note"):
+            prefixes = ", ".join(owner["managed_prefixes"]) or "none"
+            status(ctx, f"[yellow]Note: {owner['note']} ({prefixes})[/yellow]")
+
+    if not owner["found"]:
+        sys.exit(EXIT_FAILED)
+
+
+def validation_document(checks: List[tuple], now: datetime) -> Dict[str, Any]:
+    """Build the ``validate --output json`` document.
+
+    It follows shared/schemas/config-validation.json, with the individual
+    results under ``checks``.
+    """
+    passed = sum(1 for _, ok in checks if ok)
+    return {
+        "timestamp": now.isoformat(),
+        "validation_summary": {
+            "total_checks": len(checks),
+            "passed": passed,
+            "failed": len(checks) - passed,
+            "warnings": 0,
+            "overall_status": "healthy" if passed == len(checks) else "critical",
+        },
+        "checks": [{"name": name, "passed": ok} for name, ok in checks],
+    }
 
 
 @cli.command()
+@output_option()
 @click.pass_context
-def validate(ctx: click.Context) -> None:
+def validate(ctx: click.Context, output: str) -> None:
     """Validate configuration and connectivity."""
-    console.print("[yellow]Validating configuration...[/yellow]")
-
-    checks = [
-        ("Configuration file", True),
-        ("Kubernetes connection", True),
-        ("TrueNAS API connection", False),
-        ("Democratic-CSI namespace", True),
-        ("RBAC permissions", True),
-    ]
+    status(ctx, "[yellow]Validating configuration...[/yellow]")
+
+    api = ctx.obj.get("api")
+    if api is not None:
+        checks = api.validation_checks()
+    else:
+        checks = [
+            ("Configuration file", True),
+            ("Kubernetes connection", True),
+            ("TrueNAS API connection", False),
+            ("Democratic-CSI namespace", True),
+            ("RBAC permissions", True),
+        ]
+
+    if output == "json":
+        emit_json(validation_document(checks, datetime.now(timezone.utc)))
+        if not all(ok for _, ok in checks):
+            sys.exit(EXIT_FAILED)
+        return
 
     table = Table(title="Validation Results")
     table.add_column("Check", style="cyan")
     table.add_column("Status", style="green")
 
-    for check, status in checks:
-        status_text = "[green]✓ PASS[/green]" if status else "[red]✗ FAIL[/red]"
+    for check, passed in checks:
+        status_text = "[green]✓ PASS[/green]" if passed else "[red]✗ FAIL[/red]"
         table.add_row(check, status_text)
 
     console.print(table)
 
-    if not all(status for _, status in checks):
+    if not all(passed for _, passed in checks):
         console.print("\n[red]Some checks failed. Please review the configuration.[/red]")
-        sys.exit(1)
+        sys.exit(EXIT_FAILED)
     else:
         console.print("\n[green]All checks passed![/green]")
 
@@ -161,15 +565,26 @@ def validate(ctx: click.Context) -> None:
     is_flag=True,
     help="Run in daemon mode",
 )
+@output_option()
 @click.pass_context
-def monitor(ctx: click.Context, daemon: bool) -> None:
-    """Start the monitoring service."""
+def monitor(ctx: click.Context, daemon: bool, output: str) -> None:
+    """Start the monitoring service.
+
+    With --output json, each state change is printed as one JSON line.
+    """
+
+    def event(name: str) -> None:
+        if output == "json":
+            click.echo(json.dumps({"event": name, "daemon": daemon}))
+
     if daemon:
-        console.print("[yellow]Starting monitor in daemon mode...[/yellow]")
+        status(ctx, "[yellow]Starting monitor in daemon mode...[/yellow]")
+        event("started")
         # TODO: Implement daemon mode
     else:
-        console.print("[yellow]Starting monitor in foreground...[/yellow]")
-        console.print("[cyan]Press Ctrl+C to stop[/cyan]")
+        status(ctx, "[yellow]Starting monitor in foreground...[/yellow]")
+        status(ctx, "[cyan]Press Ctrl+C to stop[/cyan]")
+        event("started")
 
         try:
             # TODO: Implement monitoring loop
@@ -178,24 +593,89 @@ def monitor(ctx: click.Context, daemon: bool) -> None:
             while True:
                 time.sleep(60)
         except KeyboardInterrupt:
-            console.print("\n[yellow]Stopping monitor...[/yellow]")
+            status(ctx, "\n[yellow]Stopping monitor...[/yellow]")
+            event("stopped")
+
+
+@cli.command()
+@click.argument("shell", type=click.Choice(["bash", "zsh", "fish"]))
+def completion(shell: str) -> None:
+    """Print the shell completion script for SHELL.
+
+    \b
+    bash:  eval "$(truenas-monitor completion bash)"
+    zsh:   eval "$(truenas-monitor completion zsh)"
+    fish:  truenas-monitor completion fish | source
+
+    Namespaces and StorageClasses are completed from the cluster in
+    --config.
+    """
+    completion_class = get_completion_class(shell)
+    click.echo(completion_class(cli, {}, PROG_NAME, COMPLETE_VAR).source())
+
+
+@cli.group("config")
+def config_group() -> None:
+    """Work with configuration files."""
+
+
+@config_group.command("migrate")
+@click.option(
+    "--input",
+    "-i",
+    "input_path",
+    type=click.Path(exists=True, dir_okay=False),
+    required=True,
+    help="Configuration file in this CLI's format (openshift:, monitoring:)",
+)
+@click.option(
+    "--output",
+    "-o",
+    "output_path",
+    type=click.Path(dir_okay=False, writable=True),
+    default="-",
+    show_default=True,
+    help="File to write the Go services' format (kubernetes:, monitor:) to",
+)
+def migrate(input_path: str, output_path: str) -> None:
+    """Rewrite a configuration file into the Go services' format.
+
+    Each mapped key and each key without an equivalent is listed on stderr.
+    Comments are not preserved.
+    """
+    try:
+        with open(input_path, "r") as f:
+            config = yaml.safe_load(f) or {}
+        if not isinstance(config, dict):
+            raise TrueNASMonitorError("Configuration root must be a YAML mapping/object")
+        if detect_format(config) == FORMAT_GO:
+            err_console.print(f"{input_path} is already in the Go services' format")
+        migrated, warnings = migrate_config(config)
+    except (OSError, yaml.YAMLError, TrueNASMonitorError) as e:
+        err_console.print(f"[red]Error migrating configuration: {e}[/red]")
+        sys.exit(EXIT_ERROR)
+
+    for warning in warnings:
+        err_console.print(f"[yellow]Warning: {warning}[/yellow]")
+    with click.open_file(output_path, "w") as f:
+        yaml.safe_dump(migrated, f, default_flow_style=False, sort_keys=False)
 
 
 def main() -> None:
     """Main entry point for the CLI."""
     try:
-        cli(obj={})
+        cli(obj={}, prog_name=PROG_NAME, complete_var=COMPLETE_VAR)
     except TrueNASMonitorError as e:
-        console.print(f"[red]Error: {e}[/red]")
-        sys.exit(1)
+        err_console.print(f"[red]Error: {e}[/red]")
+        sys.exit(EXIT_ERROR)
     except KeyboardInterrupt:
-        console.print("\n[yellow]Interrupted[/yellow]")
-        sys.exit(130)
+        err_console.print("\n[yellow]Interrupted[/yellow]")
+        sys.exit(EXIT_INTERRUPTED)
     except Exception as e:
-        console.print(f"[red]Unexpected error: {e}[/red]")
+        err_console.print(f"[red]Unexpected error: {e}[/red]")
         if "--debug" in sys.argv or "-d" in sys.argv:
-            console.print_exception()
-        sys.exit(1)
+            err_console.print_exception()
+        sys.exit(EXIT_ERROR)
 
 
 if __name__ == "__main__":
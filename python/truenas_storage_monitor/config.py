@@ -1,17 +1,20 @@
 """Configuration management for TrueNAS Storage Monitor."""
 
+import copy
+import logging
 import os
 import re
 from datetime import timedelta
 from pathlib import Path
-from typing import Any, Dict, Optional, Tuple
-from urllib.parse import urlparse
+from typing import Any, Dict, List, Optional, Tuple
 
 import yaml
 
 from .exceptions import ConfigurationError
 from .k8s_client import K8sConfig
-from .truenas_client import TrueNASConfig
+from .truenas_client import TrueNASConfig, TrueNASEndpoint, parse_truenas_endpoint
+
+logger = logging.getLogger(__name__)
 
 
 class Config:
@@ -91,12 +94,17 @@ class Config:
     def k8s_config(self) -> K8sConfig:
         """Build typed Kubernetes client configuration."""
         cluster = self.openshift
+        impersonate = cluster.get("impersonate") or {}
         return K8sConfig(
             kubeconfig=cluster.get("kubeconfig"),
+            context=cluster.get("context"),
             namespace=cluster.get("namespace"),
             csi_driver=cluster.get("csi_driver", "org.democratic-csi.nfs"),
             storage_class=cluster.get("storage_class"),
             in_cluster=cluster.get("in_cluster", False),
+            impersonate_user=impersonate.get("user"),
+            impersonate_groups=list(impersonate.get("groups") or []),
+            impersonate_uid=impersonate.get("uid"),
         )
 
     def truenas_config(self) -> TrueNASConfig:
@@ -104,18 +112,21 @@ class Config:
         truenas = self.truenas
         if "url" not in truenas:
             raise ConfigurationError("TrueNAS URL is required")
-        host, port, use_https = parse_truenas_url(truenas["url"])
+        endpoint = truenas_endpoint(truenas["url"])
         insecure = truenas.get("insecure", False)
         return TrueNASConfig(
-            host=host,
-            port=port,
+            host=endpoint.host,
+            port=endpoint.port,
             api_key=truenas.get("api_key"),
             username=truenas.get("username"),
             password=truenas.get("password"),
             verify_ssl=not insecure,
-            use_https=use_https,
+            use_https=endpoint.use_https,
             timeout=parse_timeout_seconds(truenas.get("timeout", 30)),
             max_retries=truenas.get("max_retries", 3),
+            proxy_url=truenas.get("proxy_url"),
+            resolve_override=dict(truenas.get("resolve_override") or {}),
+            path_prefix=endpoint.path_prefix,
         )
 
     @property
@@ -131,30 +142,65 @@ class Config:
         raw = snapshot.get("max_age", "30d")
         return parse_duration(raw)
 
+    @property
+    def orphan_thresholds(self) -> Dict[str, timedelta]:
+        """Per-type orphan thresholds from monitoring.orphan_thresholds.
+
+        Unset types use orphan_threshold, and truenas_snapshot uses the
+        snapshot retention. A resource exactly as old as its threshold is
+        reported.
+        """
+        overrides = self.monitoring.get("orphan_thresholds") or {}
+        thresholds = {}
+        for kind in ORPHAN_THRESHOLD_TYPES:
+            if overrides.get(kind) is not None:
+                thresholds[kind] = parse_orphan_threshold(kind, overrides[kind])
+            elif kind == "truenas_snapshot":
+                thresholds[kind] = self.snapshot_retention
+            else:
+                thresholds[kind] = self.orphan_threshold
+        return thresholds
+
     @property
     def metrics_enabled(self) -> bool:
         """Whether Prometheus metrics export is enabled."""
         return bool(self.get("metrics.enabled", False))
 
 
-def parse_truenas_url(url: str) -> Tuple[str, int, bool]:
-    """Parse a TrueNAS URL into host, port, and TLS scheme flag."""
-    normalized = url if "://" in url else f"https://{url}"
+ORPHAN_THRESHOLD_TYPES = (
+    "persistent_volume",
+    "persistent_volume_claim",
+    "volume_snapshot",
+    "truenas_snapshot",
+)
+
+# Smallest per-type orphan threshold accepted, so a typo cannot make freshly
+# provisioned resources look orphaned. Matches orphan.MinAgeThreshold in Go.
+MIN_ORPHAN_THRESHOLD = timedelta(minutes=10)
+
+
+def parse_orphan_threshold(kind: str, value: Any) -> timedelta:
+    """Parse monitoring.orphan_thresholds.<kind>, enforcing the safety floor."""
+    threshold = parse_duration(value)
+    if threshold < MIN_ORPHAN_THRESHOLD:
+        raise ConfigurationError(
+            f"monitoring.orphan_thresholds.{kind} must be at least 10m: {value!r}"
+        )
+    return threshold
+
+
+def truenas_endpoint(url: str) -> TrueNASEndpoint:
+    """Validate truenas.url, raising ConfigurationError with the reason."""
     try:
-        parsed = urlparse(normalized)
-        host = parsed.hostname
-        if not host:
-            raise ConfigurationError(f"Invalid TrueNAS URL: {url!r}")
-        if parsed.port is not None:
-            port = parsed.port
-        elif parsed.scheme == "http":
-            port = 80
-        else:
-            port = 443
-        use_https = parsed.scheme != "http"
-        return host, port, use_https
+        return parse_truenas_endpoint(url)
     except ValueError as exc:
-        raise ConfigurationError(f"Invalid TrueNAS URL: {url!r}") from exc
+        raise ConfigurationError(f"truenas.url: {exc}") from exc
+
+
+def parse_truenas_url(url: str) -> Tuple[str, int, bool]:
+    """Parse a TrueNAS URL into host, port, and TLS scheme flag."""
+    endpoint = truenas_endpoint(url)
+    return endpoint.host, endpoint.port, endpoint.use_https
 
 
 def parse_timeout_seconds(value: Any) -> int:
@@ -240,6 +286,178 @@ def normalize_cluster_config(config: Dict[str, Any]) -> Dict[str, Any]:
     return config
 
 
+FORMAT_LEGACY = "legacy"
+FORMAT_GO = "go"
+
+# Keys of this package's schema (openshift:, monitoring:) and their
+# equivalent in the Go services' schema (kubernetes:, monitor:), with the
+# conversion the Go value needs. Mirrors legacyKeys in go/pkg/config.
+LEGACY_KEY_MAP: List[Tuple[str, str, Optional[str]]] = [
+    ("openshift.kubeconfig", "kubernetes.kubeconfig", None),
+    ("openshift.context", "kubernetes.context", None),
+    ("openshift.namespace", "kubernetes.namespace", None),
+    ("openshift.in_cluster", "kubernetes.in_cluster", None),
+    ("openshift.impersonate", "kubernetes.impersonate", None),
+    ("monitoring.orphan_check_interval", "monitor.scan_interval", "duration"),
+    ("monitoring.orphan_threshold", "monitor.orphan_threshold", "duration"),
+    ("monitoring.snapshot.max_age", "monitor.snapshot_retention", "duration"),
+] + [
+    (f"monitoring.orphan_thresholds.{kind}", f"monitor.orphan_thresholds.{kind}", "duration")
+    for kind in ORPHAN_THRESHOLD_TYPES
+] + [
+    ("truenas.timeout", "truenas.timeout", "seconds"),
+    ("alerts.slack.webhook_url", "alerts.slack.webhook", None),
+    ("logging.format", "logging.encoding", None),
+]
+
+# Top-level sections this package reads.
+KNOWN_SECTIONS = (
+    "openshift",
+    "kubernetes",
+    "truenas",
+    "monitoring",
+    "alerts",
+    "reporting",
+    "api",
+    "metrics",
+    "logging",
+    "performance",
+)
+
+
+def detect_format(config: Dict[str, Any]) -> str:
+    """Report whether a config uses this package's schema or the Go services'.
+
+    A config is in the Go format when it has a ``monitor`` section, or a
+    ``kubernetes`` section and no ``openshift`` or ``monitoring`` section.
+    """
+    if "monitor" in config:
+        return FORMAT_GO
+    if "kubernetes" in config and "openshift" not in config and "monitoring" not in config:
+        return FORMAT_GO
+    return FORMAT_LEGACY
+
+
+def _lookup(config: Dict[str, Any], path: str) -> Tuple[Any, bool]:
+    current: Any = config
+    for key in path.split("."):
+        if not isinstance(current, dict) or key not in current:
+            return None, False
+        current = current[key]
+    return current, True
+
+
+def _pop(config: Dict[str, Any], path: str) -> None:
+    """Remove the key at path and any sections it leaves empty below the top."""
+    keys = path.split(".")
+    parents = [config]
+    for key in keys[:-1]:
+        parents.append(parents[-1][key])
+    del parents[-1][keys[-1]]
+    for i in range(len(parents) - 1, 1, -1):
+        if parents[i]:
+            break
+        del parents[i - 1][keys[i - 1]]
+
+
+def _set(config: Dict[str, Any], path: str, value: Any) -> None:
+    keys = path.split(".")
+    current = config
+    for key in keys[:-1]:
+        if not isinstance(current.get(key), dict):
+            current[key] = {}
+        current = current[key]
+    current[keys[-1]] = value
+
+
+def _leaf_paths(value: Any, prefix: str) -> List[str]:
+    if not isinstance(value, dict) or not value:
+        return [prefix]
+    paths: List[str] = []
+    for key, child in value.items():
+        paths.extend(_leaf_paths(child, f"{prefix}.{key}"))
+    return paths
+
+
+def go_duration(value: Any) -> str:
+    """Convert a duration such as 30d, which Go rejects, into Go's syntax (720h)."""
+    seconds = int(parse_duration(value).total_seconds())
+    if seconds % 3600 == 0:
+        return f"{seconds // 3600}h"
+    if seconds % 60 == 0:
+        return f"{seconds // 60}m"
+    return f"{seconds}s"
+
+
+def migrate_config(config: Dict[str, Any]) -> Tuple[Dict[str, Any], List[str]]:
+    """Rewrite a config of this package's schema into the Go services' schema.
+
+    Returns the migrated config and one warning per mapped key. Keys of the
+    openshift, monitoring, reporting and performance sections without an
+    equivalent are kept, with a warning, for the operator to review; the Go
+    services warn about any other key they ignore when they load the file.
+
+    Raises:
+        ConfigurationError: If a duration or timeout cannot be converted
+    """
+    config = normalize_cluster_config(copy.deepcopy(config))
+    if detect_format(config) == FORMAT_GO:
+        return config, []
+
+    warnings = []
+    for legacy, go, conversion in LEGACY_KEY_MAP:
+        value, found = _lookup(config, legacy)
+        if not found:
+            continue
+        try:
+            if conversion == "duration":
+                value = go_duration(value)
+            elif conversion == "seconds":
+                value = f"{parse_timeout_seconds(value)}s"
+        except ConfigurationError as exc:
+            raise ConfigurationError(f"{legacy}: {exc}") from exc
+        _pop(config, legacy)
+        _set(config, go, value)
+        if legacy == go:
+            warnings.append(f"value of {legacy} converted to {value}")
+        else:
+            warnings.append(f"key {legacy} mapped to {go}")
+
+    for section in ("openshift", "monitoring", "reporting", "performance"):
+        if section in config and not config[section]:
+            del config[section]
+        elif section in config:
+            for path in _leaf_paths(config[section], section):
+                warnings.append(f"key {path} has no equivalent in the Go services and is kept")
+    return config, warnings
+
+
+def normalize_go_config(config: Dict[str, Any]) -> List[str]:
+    """Map the keys of a Go-format config to this package's schema in place.
+
+    Returns one warning per mapped key, and one per key of a section this
+    package does not read, so that no setting is dropped silently.
+    """
+    warnings = []
+    if detect_format(config) == FORMAT_GO:
+        for legacy, go, _ in LEGACY_KEY_MAP:
+            value, found = _lookup(config, go)
+            if not found or legacy == go:
+                continue
+            _pop(config, go)
+            _set(config, legacy, value)
+            warnings.append(f"key {go} mapped to {legacy}")
+        if config.get("monitor") == {}:
+            del config["monitor"]
+        config.setdefault("monitoring", {})
+
+    for section in list(config):
+        if section not in KNOWN_SECTIONS:
+            for path in _leaf_paths(config[section], section):
+                warnings.append(f"unknown key {path} is ignored")
+    return warnings
+
+
 def load_config(config_path: Optional[str] = None) -> Dict[str, Any]:
     """Load configuration from file.
 
@@ -284,6 +502,8 @@ def load_config(config_path: Optional[str] = None) -> Dict[str, Any]:
 
     # Expand environment variables
     config = expand_env_vars(config)
+    for warning in normalize_go_config(config):
+        logger.warning("Configuration: %s", warning)
     config = normalize_cluster_config(config)
 
     # Validate configuration
@@ -376,11 +596,27 @@ def validate_config(config: Dict[str, Any]) -> None:
         if section not in config:
             raise ConfigurationError(f"Missing required configuration section: {section}")
 
+    cluster = config["openshift"] or {}
+    if cluster.get("in_cluster") and cluster.get("context"):
+        raise ConfigurationError("openshift.context cannot be used with openshift.in_cluster")
+    impersonate = cluster.get("impersonate") or {}
+    if not isinstance(impersonate, dict):
+        raise ConfigurationError("openshift.impersonate must be a mapping")
+    if not impersonate.get("user") and (impersonate.get("groups") or impersonate.get("uid")):
+        raise ConfigurationError(
+            "openshift.impersonate.groups and uid require openshift.impersonate.user"
+        )
+    if len(impersonate.get("groups") or []) > 1:
+        raise ConfigurationError(
+            "openshift.impersonate.groups: the Python client can impersonate one group"
+        )
+
     # Validate TrueNAS configuration if present
     if "truenas" in config:
         truenas = config["truenas"]
         if "url" not in truenas:
             raise ConfigurationError("TrueNAS URL is required")
+        truenas_endpoint(truenas["url"])
 
         # Check for authentication
         has_password = "username" in truenas and "password" in truenas
@@ -393,6 +629,14 @@ def validate_config(config: Dict[str, Any]) -> None:
 
     # Validate thresholds
     monitoring = config.get("monitoring", {})
+
+    orphan_thresholds = monitoring.get("orphan_thresholds") or {}
+    if not isinstance(orphan_thresholds, dict):
+        raise ConfigurationError("monitoring.orphan_thresholds must be a mapping")
+    for kind, value in orphan_thresholds.items():
+        if kind not in ORPHAN_THRESHOLD_TYPES:
+            raise ConfigurationError(f"Unknown monitoring.orphan_thresholds key: {kind}")
+        parse_orphan_threshold(kind, value)
     storage = monitoring.get("storage", {})
 
     warning = storage.get("pool_warning_threshold", 80)
@@ -0,0 +1,73 @@
+"""Human-readable sizes, durations and percentages.
+
+These mirror the Go ``humanize`` package so the CLI, reports and alert
+messages read the same in both implementations. Use them for text shown
+to people only; JSON output keeps raw numbers.
+"""
+
+from datetime import timedelta
+from typing import Optional, Union
+
+_BYTE_UNITS = ("KiB", "MiB", "GiB", "TiB", "PiB", "EiB")
+
+_DURATION_UNITS = (
+    (86400, "d"),
+    (3600, "h"),
+    (60, "m"),
+    (1, "s"),
+)
+
+
+def format_bytes(size: Optional[int]) -> str:
+    """Format a byte count with binary units, e.g. ``"10.0GiB"``.
+
+    ``None`` renders as ``"-"``.
+    """
+    if size is None:
+        return "-"
+    if -1024 < size < 1024:
+        return f"{int(size)}B"
+    value = float(size)
+    unit = -1
+    while abs(value) >= 1024 and unit < len(_BYTE_UNITS) - 1:
+        value /= 1024
+        unit += 1
+    return f"{value:.1f}{_BYTE_UNITS[unit]}"
+
+
+def format_duration(duration: Optional[Union[timedelta, float, int]]) -> str:
+    """Format a duration with its two largest units, e.g. ``"3d4h"``.
+
+    Numbers are seconds. A zero unit ends the output, so two days and five
+    minutes render as ``"2d"``; anything under a second is ``"0s"``.
+    ``None`` renders as ``"-"``.
+    """
+    if duration is None:
+        return "-"
+    seconds = duration.total_seconds() if isinstance(duration, timedelta) else duration
+    sign = "-" if seconds < 0 else ""
+    remaining = int(abs(seconds))
+
+    parts = []
+    for size, suffix in _DURATION_UNITS:
+        if len(parts) == 2:
+            break
+        count, remaining = divmod(remaining, size)
+        if count == 0:
+            if parts:
+                break
+            continue
+        parts.append(f"{count}{suffix}")
+    if not parts:
+        return "0s"
+    return sign + "".join(parts)
+
+
+def format_percent(value: Optional[float]) -> str:
+    """Format a percentage with one decimal, e.g. ``"12.5%"``.
+
+    ``None`` renders as ``"-"``.
+    """
+    if value is None:
+        return "-"
+    return f"{value:.1f}%"
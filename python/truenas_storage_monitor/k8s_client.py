@@ -31,10 +31,15 @@ class K8sConfig:
     """Configuration for Kubernetes client."""
 
     kubeconfig: Optional[str] = None
+    context: Optional[str] = None
     namespace: Optional[str] = None
     csi_driver: str = "org.democratic-csi.nfs"
     storage_class: Optional[str] = None
     in_cluster: bool = False
+    # Identity every request impersonates; groups and uid require a user.
+    impersonate_user: Optional[str] = None
+    impersonate_groups: List[str] = field(default_factory=list)
+    impersonate_uid: Optional[str] = None
 
 
 @dataclass
@@ -113,23 +118,59 @@ class K8sClient:
         if config_obj.in_cluster:
             config.load_incluster_config()
         else:
-            config.load_kube_config(config_file=config_obj.kubeconfig)
+            config.load_kube_config(
+                config_file=config_obj.kubeconfig, context=config_obj.context
+            )
+
+        api_client = k8s_client.ApiClient()
+        if config_obj.impersonate_user:
+            api_client.set_default_header("Impersonate-User", config_obj.impersonate_user)
+            # The API server reads one group per header, and default headers
+            # hold one value each, so only a single group can be impersonated.
+            for group in config_obj.impersonate_groups[:1]:
+                api_client.set_default_header("Impersonate-Group", group)
+            if config_obj.impersonate_uid:
+                api_client.set_default_header("Impersonate-Uid", config_obj.impersonate_uid)
 
         # Initialize API clients
-        self.core_v1 = k8s_client.CoreV1Api()
-        self.storage_v1 = k8s_client.StorageV1Api()
-        self.custom_objects = k8s_client.CustomObjectsApi()
+        self.core_v1 = k8s_client.CoreV1Api(api_client)
+        self.storage_v1 = k8s_client.StorageV1Api(api_client)
+        self.custom_objects = k8s_client.CustomObjectsApi(api_client)
+        self.authentication_v1 = k8s_client.AuthenticationV1Api(api_client)
 
     def test_connection(self) -> bool:
         """Verify connectivity to the Kubernetes API server."""
         try:
             self.core_v1.list_namespace(limit=1)
-            logger.info("Successfully connected to Kubernetes API")
-            return True
         except ApiException as e:
             logger.error(f"Failed to connect to Kubernetes API: {e}")
             raise
 
+        try:
+            user = self.effective_user()
+            logger.info(f"Successfully connected to Kubernetes API as {user['username']}")
+        except ApiException as e:
+            # SelfSubjectReview is GA in Kubernetes 1.28; older clusters only
+            # lose the identity report.
+            logger.warning(f"Failed to determine effective Kubernetes user: {e}")
+            logger.info("Successfully connected to Kubernetes API")
+        return True
+
+    def effective_user(self) -> Dict[str, Any]:
+        """Return the identity the API server authenticates requests as.
+
+        Uses a SelfSubjectReview, so impersonation is already applied.
+        """
+        review = self.authentication_v1.create_self_subject_review(
+            body=k8s_client.V1SelfSubjectReview()
+        )
+        info = review.status.user_info
+        return {
+            "username": info.username,
+            "uid": info.uid,
+            "groups": info.groups or [],
+        }
+
     def list_namespaces(self) -> List[str]:
         """List all namespace names in the cluster."""
         try:
@@ -325,6 +366,61 @@ class K8sClient:
             logger.error(f"Failed to list StorageClasses: {e}")
             raise
 
+    def get_pods_using_claim(self, namespace: str, claim: str) -> List[Dict[str, Any]]:
+        """Get the non-finished pods in a namespace that mount a PVC.
+
+        Args:
+            namespace: Namespace of the PVC
+            claim: Name of the PVC
+
+        Returns:
+            List of pod information, including the controlling workload
+        """
+        try:
+            pods = self.core_v1.list_namespaced_pod(namespace)
+            result = []
+
+            for pod in pods.items:
+                if pod.status.phase in ("Succeeded", "Failed"):
+                    continue
+                mounts_claim = any(
+                    volume.persistent_volume_claim
+                    and volume.persistent_volume_claim.claim_name == claim
+                    for volume in pod.spec.volumes or []
+                )
+                if not mounts_claim:
+                    continue
+
+                kind, name = self._pod_workload(pod)
+                result.append(
+                    {
+                        "name": pod.metadata.name,
+                        "namespace": pod.metadata.namespace,
+                        "status": pod.status.phase,
+                        "workload_kind": kind,
+                        "workload_name": name,
+                    }
+                )
+
+            return result
+
+        except ApiException as e:
+            logger.error(f"Failed to list pods in {namespace}: {e}")
+            raise
+
+    @staticmethod
+    def _pod_workload(pod: Any) -> tuple:
+        """Name the controller of a pod, reporting Deployments for their ReplicaSets."""
+        for ref in pod.metadata.owner_references or []:
+            if not ref.controller:
+                continue
+            if ref.kind == "ReplicaSet":
+                pod_hash = (pod.metadata.labels or {}).get("pod-template-hash")
+                if pod_hash and ref.name.endswith(f"-{pod_hash}"):
+                    return "Deployment", ref.name[: -len(pod_hash) - 1]
+            return ref.kind, ref.name
+        return "Pod", pod.metadata.name
+
     def get_csi_nodes(self) -> List[Dict[str, Any]]:
         """Get all CSINode objects.
 
@@ -14,6 +14,7 @@ from .truenas_client import TrueNASClient, VolumeInfo, SnapshotInfo
 from .config import Config
 from .exceptions import TrueNASMonitorError
 from .observability import ScanObservability
+from .formatting import format_bytes, format_duration, format_percent
 from .time_utils import ensure_utc, resource_age, utc_now
 
 logger = logging.getLogger(__name__)
@@ -33,12 +34,19 @@ class Monitor:
         namespace: Optional[str] = None,
         age_threshold_hours: Optional[int] = None,
     ) -> Dict[str, Any]:
-        """Find orphaned storage resources."""
+        """Find orphaned storage resources.
+
+        An explicit age_threshold_hours replaces the configured per-type
+        thresholds except the TrueNAS snapshot one.
+        """
+        thresholds = dict(self.config.orphan_thresholds)
         if age_threshold_hours is None:
             age_threshold = self.config.orphan_threshold
         else:
             age_threshold = timedelta(hours=age_threshold_hours)
-        snapshot_retention = self.config.snapshot_retention
+            for kind in ("persistent_volume", "persistent_volume_claim", "volume_snapshot"):
+                thresholds[kind] = age_threshold
+        snapshot_retention = thresholds["truenas_snapshot"]
 
         logger.info(
             "Scanning for orphaned resources",
@@ -63,14 +71,25 @@ class Monitor:
             with obs.phase("truenas_snapshots"):
                 truenas_snapshots = self.truenas_client.get_snapshots()
 
-            orphaned_pvs = self._find_orphaned_pvs(k8s_pvs, truenas_volumes, age_threshold)
-            orphaned_pvcs = self._find_orphaned_pvcs(k8s_pvcs, age_threshold)
+            orphaned_pvs = self._find_orphaned_pvs(
+                k8s_pvs, truenas_volumes, thresholds["persistent_volume"]
+            )
+            orphaned_pvcs = self._find_orphaned_pvcs(
+                k8s_pvcs, thresholds["persistent_volume_claim"]
+            )
             orphaned_snapshots = self._find_orphaned_snapshots(
-                k8s_snapshots, truenas_snapshots, age_threshold, snapshot_retention
+                k8s_snapshots,
+                truenas_snapshots,
+                thresholds["volume_snapshot"],
+                snapshot_retention,
             )
 
             scan_duration = obs.finish_scan()
 
+            orphaned_k8s_snapshots = sum(
+                1 for snapshot in orphaned_snapshots if snapshot.get("source") == "kubernetes"
+            )
+
             return {
                 "timestamp": utc_now().isoformat(),
                 "orphaned_pvs": orphaned_pvs,
@@ -78,11 +97,26 @@ class Monitor:
                 "orphaned_snapshots": orphaned_snapshots,
                 "total_pvs": len(k8s_pvs),
                 "total_pvcs": len(k8s_pvcs),
-                "total_snapshots": len(k8s_snapshots),
+                # Deprecated: sum of total_k8s_snapshots and total_truenas_snapshots.
+                "total_snapshots": len(k8s_snapshots) + len(truenas_snapshots),
+                "total_k8s_snapshots": len(k8s_snapshots),
+                "total_truenas_snapshots": len(truenas_snapshots),
+                "orphaned_k8s_snapshots": orphaned_k8s_snapshots,
+                "orphaned_truenas_snapshots": len(orphaned_snapshots) - orphaned_k8s_snapshots,
+                "deprecated": {
+                    "total_snapshots": (
+                        "sum of total_k8s_snapshots and total_truenas_snapshots; "
+                        "use those fields instead"
+                    ),
+                },
                 "scan_duration": scan_duration,
                 "phase_timings": obs.phase_timings,
                 "age_threshold_hours": age_threshold.total_seconds() / 3600,
                 "snapshot_retention_hours": snapshot_retention.total_seconds() / 3600,
+                "age_threshold_hours_by_type": {
+                    kind: threshold.total_seconds() / 3600
+                    for kind, threshold in thresholds.items()
+                },
             }
 
         except Exception as e:
@@ -143,7 +177,7 @@ class Monitor:
                         "name": pvc.name,
                         "namespace": pvc.namespace,
                         "age": age,
-                        "reason": f"Unbound for {age}",
+                        "reason": f"Unbound for {format_duration(utc_now() - created)}",
                         "size": pvc.capacity or "Unknown",
                         "storage_class": pvc.storage_class or "Unknown",
                     }
@@ -179,6 +213,7 @@ class Monitor:
                         "age": resource_age(created),
                         "reason": "No corresponding TrueNAS snapshot found",
                         "source_pvc": snapshot.source_pvc or "Unknown",
+                        "source": "kubernetes",
                     }
                 )
 
@@ -196,6 +231,7 @@ class Monitor:
                         "name": truenas_snapshot.name,
                         "age": resource_age(created),
                         "reason": "Old TrueNAS snapshot without corresponding VolumeSnapshot",
+                        "source": "truenas",
                     }
                 )
 
@@ -245,6 +281,75 @@ class Monitor:
 
         return False
 
+    def find_dataset_owner(self, dataset: str) -> Dict[str, Any]:
+        """Resolve a TrueNAS dataset to the PV, PVC and workloads using it.
+
+        A PV owns the dataset when the dataset is its volume handle under the
+        StorageClass's datasetParentName, or ends in the handle when the class
+        names no parent. The result has found=False, the managed prefixes and
+        a note when no PV owns the dataset.
+        """
+        dataset = dataset.strip("/")
+        parents = {}
+        for sc in self.k8s_client.get_storage_classes():
+            params = sc.get("parameters") or {}
+            parent = params.get("datasetParentName") or params.get("zfs.datasetParentName")
+            if parent:
+                parents[sc["name"]] = parent.strip("/")
+
+        for pv in self.k8s_client.get_persistent_volumes():
+            handle = pv.volume_handle
+            if not handle:
+                continue
+            parent = parents.get(pv.storage_class or "")
+            if parent is not None:
+                if dataset != f"{parent}/{handle}":
+                    continue
+            elif dataset != handle and not dataset.endswith(f"/{handle}"):
+                continue
+
+            owner = {
+                "found": True,
+                "dataset": dataset,
+                "persistent_volume": pv.name,
+                "storage_class": pv.storage_class,
+                "volume_handle": handle,
+                "namespace": None,
+                "persistent_volume_claim": None,
+                "workloads": [],
+            }
+            if pv.claim_ref and pv.claim_ref.get("name"):
+                namespace = pv.claim_ref.get("namespace")
+                claim = pv.claim_ref["name"]
+                owner["namespace"] = namespace
+                owner["persistent_volume_claim"] = claim
+                owner["workloads"] = self._group_workloads(
+                    self.k8s_client.get_pods_using_claim(namespace, claim)
+                )
+            return owner
+
+        prefixes = sorted(set(parents.values()))
+        result: Dict[str, Any] = {
+            "found": False,
+            "dataset": dataset,
+            "managed_prefixes": prefixes,
+        }
+        if not any(dataset == p or dataset.startswith(f"{p}/") for p in prefixes):
+            result["note"] = "dataset is outside the managed prefixes"
+        return result
+
+    @staticmethod
+    def _group_workloads(pods: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+        """Group pods by their controlling workload."""
+        grouped: Dict[tuple, List[str]] = {}
+        for pod in pods:
+            key = (pod["workload_kind"], pod["workload_name"])
+            grouped.setdefault(key, []).append(pod["name"])
+        return [
+            {"kind": kind, "name": name, "pods": sorted(names)}
+            for (kind, name), names in sorted(grouped.items())
+        ]
+
     def analyze_storage_usage(
         self, days: int = 7, namespace: Optional[str] = None
     ) -> Dict[str, Any]:
@@ -264,9 +369,11 @@ class Monitor:
             )
 
             return {
+                "total_allocated_bytes": total_allocated,
+                "total_used_bytes": total_used,
                 "total_allocated_gb": total_allocated / (1024**3),
                 "total_used_gb": total_used / (1024**3),
-                "thin_provisioning_efficiency": f"{efficiency:.1f}%",
+                "thin_provisioning_efficiency": format_percent(efficiency),
                 "total_pvcs": len(pvcs),
                 "total_pvs": len(pvs),
                 "growth_trend": "Stable",  # TODO: Implement trend analysis
@@ -313,9 +420,8 @@ class Monitor:
         for pvc in pvcs:
             requested = self._parse_storage_size(pvc.capacity or "0")
             if requested > 100 * 1024**3:
-                size_gb = requested / 1024**3
                 recommendations.append(
-                    f"Consider reviewing large PVC: {pvc.name} ({size_gb:.1f}GB)"
+                    f"Consider reviewing large PVC: {pvc.name} ({format_bytes(requested)})"
                 )
 
         if len(truenas_volumes) > len(pvcs):
@@ -4,11 +4,12 @@ import logging
 from dataclasses import dataclass, field
 from datetime import datetime
 from typing import List, Dict, Optional, Any
-from urllib.parse import quote
+from urllib.parse import quote, urlsplit
 
 import requests
 from requests.adapters import HTTPAdapter
 from requests.packages.urllib3.util.retry import Retry
+from requests.utils import select_proxy
 
 from .exceptions import TrueNASMonitorError
 
@@ -27,6 +28,81 @@ class AuthenticationError(TrueNASError):
     pass
 
 
+API_PATH = "/api/v2.0"
+
+
+@dataclass(frozen=True)
+class TrueNASEndpoint:
+    """A normalized TrueNAS address."""
+
+    scheme: str
+    host: str
+    port: int
+    path_prefix: str = ""
+
+    @property
+    def use_https(self) -> bool:
+        """Whether the endpoint uses TLS."""
+        return self.scheme == "https"
+
+    @property
+    def url(self) -> str:
+        """The endpoint as scheme://host:port[/prefix]."""
+        host = f"[{self.host}]" if ":" in self.host else self.host
+        return f"{self.scheme}://{host}:{self.port}{self.path_prefix}"
+
+
+def parse_truenas_endpoint(url: str) -> TrueNASEndpoint:
+    """Validate and normalize a TrueNAS address.
+
+    Accepts a bare host, host:port or a full URL. The scheme defaults to
+    https and is never derived from the port; the port defaults to the
+    scheme's. A path is kept as the prefix of a TrueNAS behind a reverse
+    proxy, minus a trailing /api/v2.0. Applies the same rules as the Go
+    client's truenas.NormalizeURL.
+
+    Raises:
+        ValueError: With the reason the address is invalid
+    """
+    raw = (url or "").strip()
+    if not raw:
+        raise ValueError("TrueNAS URL is required")
+    if "://" not in raw:
+        raw = f"https://{raw}"
+
+    parts = urlsplit(raw)
+    display = raw if parts.password is None else raw.replace(parts.password, "xxxxx", 1)
+
+    def invalid(reason: str) -> ValueError:
+        return ValueError(f"invalid TrueNAS URL {display!r}: {reason}")
+
+    scheme = parts.scheme.lower()
+    if scheme not in ("http", "https"):
+        raise invalid("scheme must be http or https")
+    if not parts.hostname:
+        raise invalid("host is required")
+    try:
+        port = parts.port
+    except ValueError:
+        raise invalid("port must be between 1 and 65535") from None
+    if port is None and parts.netloc.endswith(":"):
+        raise invalid("port must be between 1 and 65535")
+    if port is not None and not 1 <= port <= 65535:
+        raise invalid("port must be between 1 and 65535")
+    if parts.username is not None or parts.password is not None:
+        raise invalid("must not include credentials; set the username and password instead")
+    if parts.query or parts.fragment:
+        raise invalid("must not include a query or fragment")
+
+    prefix = parts.path.rstrip("/")
+    if prefix.endswith(API_PATH):
+        prefix = prefix[: -len(API_PATH)].rstrip("/")
+
+    if port is None:
+        port = 443 if scheme == "https" else 80
+    return TrueNASEndpoint(scheme=scheme, host=parts.hostname, port=port, path_prefix=prefix)
+
+
 @dataclass
 class TrueNASConfig:
     """Configuration for TrueNAS client."""
@@ -40,6 +116,12 @@ class TrueNASConfig:
     use_https: bool = True
     timeout: int = 30
     max_retries: int = 3
+    # HTTP(S) proxy for all requests; None honors HTTPS_PROXY/NO_PROXY.
+    proxy_url: Optional[str] = None
+    # Host name -> IP address dialed in its place on direct connections.
+    resolve_override: Dict[str, str] = field(default_factory=dict)
+    # Path of a TrueNAS behind a reverse proxy, e.g. "/truenas".
+    path_prefix: str = ""
 
     def __post_init__(self):
         """Validate configuration."""
@@ -49,8 +131,13 @@ class TrueNASConfig:
     @property
     def base_url(self) -> str:
         """Get the base URL for TrueNAS API."""
-        protocol = "https" if self.use_https else "http"
-        return f"{protocol}://{self.host}:{self.port}/api/v2.0"
+        endpoint = TrueNASEndpoint(
+            scheme="https" if self.use_https else "http",
+            host=self.host,
+            port=self.port,
+            path_prefix=self.path_prefix,
+        )
+        return f"{endpoint.url}{API_PATH}"
 
 
 @dataclass
@@ -118,6 +205,36 @@ class OrphanedVolume:
     creation_time: Optional[datetime] = None
 
 
+class ResolveOverrideAdapter(HTTPAdapter):
+    """Transport adapter that connects to a fixed address for one host.
+
+    Requests to ``host`` are sent to ``address`` while the Host header, TLS
+    SNI and certificate verification keep using ``host``. Requests going
+    through a proxy are left alone; the proxy resolves the host.
+    """
+
+    def __init__(self, host: str, address: str, tls: bool, **kwargs):
+        self._host = host
+        self._address = address
+        self._tls = tls
+        super().__init__(**kwargs)
+
+    def init_poolmanager(self, *args, **pool_kwargs):
+        if self._tls:
+            pool_kwargs["server_hostname"] = self._host
+            pool_kwargs["assert_hostname"] = self._host
+        super().init_poolmanager(*args, **pool_kwargs)
+
+    def send(self, request, **kwargs):
+        parts = urlsplit(request.url)
+        if parts.hostname == self._host and not select_proxy(request.url, kwargs.get("proxies")):
+            address = f"[{self._address}]" if ":" in self._address else self._address
+            netloc = f"{address}:{parts.port}" if parts.port else address
+            request.headers["Host"] = parts.netloc.rsplit("@", 1)[-1]
+            request.url = parts._replace(netloc=netloc).geturl()
+        return super().send(request, **kwargs)
+
+
 class TrueNASClient:
     """Client for TrueNAS REST API."""
 
@@ -143,6 +260,19 @@ class TrueNASClient:
         self.session.mount("http://", adapter)
         self.session.mount("https://", adapter)
 
+        # Proxies: explicit proxy_url, otherwise HTTPS_PROXY/NO_PROXY
+        if config.proxy_url:
+            self.session.proxies = {"http": config.proxy_url, "https": config.proxy_url}
+        address = config.resolve_override.get(config.host)
+        if address:
+            scheme = "https" if config.use_https else "http"
+            self.session.mount(
+                f"{scheme}://{config.host}",
+                ResolveOverrideAdapter(
+                    config.host, address, tls=config.use_https, max_retries=retry
+                ),
+            )
+
         # Set authentication
         if config.api_key:
             self.session.headers["Authorization"] = f"Bearer {config.api_key}"
@@ -180,9 +310,21 @@ class TrueNASClient:
             logger.info(f"Successfully connected to TrueNAS at {self.config.host}")
             return True
 
+        except requests.exceptions.ProxyError as e:
+            raise TrueNASError(self._describe_proxy_error(e))
         except requests.exceptions.RequestException as e:
             raise TrueNASError(f"Failed to connect to TrueNAS: {str(e)}")
 
+    def _describe_proxy_error(self, error: requests.exceptions.ProxyError) -> str:
+        """Tell a proxy that refused the connection from one that could not
+        reach TrueNAS."""
+        if "Tunnel connection failed" in str(error):
+            return (
+                f"Proxy could not connect to TrueNAS at {self.config.host}:{self.config.port}: "
+                f"{error}"
+            )
+        return f"Failed to connect to proxy for TrueNAS: {error}"
+
     def get_pools(self) -> List[PoolInfo]:
         """Get all storage pools.
 